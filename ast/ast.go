@@ -0,0 +1,369 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package ast provides an abstract syntax tree of SysDB matchers and
+// expressions.
+//
+// Matchers and expressions may be rendered in SysQL syntax (see the String
+// methods) for use in queries, for example:
+//
+//	m := ast.Cmp{Op: ast.EQ, Left: ast.Attr("architecture"), Right: ast.Const{"amd64"}}
+//	q := "LOOKUP hosts MATCHING " + m.String() + ";"
+//
+// Alternatively, they may be encoded in binary form (see MarshalMatcher and
+// MarshalExpr) to be submitted to a server in MATCHER and EXPR messages
+// without having to be parsed by the server again. Note that, as of version
+// 0.8, SysDB uses those states internally only and does not accept them from
+// clients.
+//
+// Finally, matchers and expressions may be evaluated on the client side (see
+// Evaluator), for example, to filter cached query results:
+//
+//	hosts, err := ast.Filter(m, cached)
+package ast
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sysdb/go/proto"
+	"github.com/sysdb/go/sysdb"
+)
+
+// An Expr is an expression evaluating to a value.
+type Expr interface {
+	// String returns the expression in SysQL syntax.
+	String() string
+
+	appendTo(b []byte) ([]byte, error)
+}
+
+// A Matcher is a boolean condition on objects.
+type Matcher interface {
+	// String returns the matcher in SysQL syntax.
+	String() string
+
+	appendTo(b []byte) ([]byte, error)
+}
+
+// A Field is an expression referencing a field of an object.
+type Field int
+
+// Fields of objects.
+const (
+	FieldName Field = iota + 1
+	FieldLastUpdate
+	FieldAge
+	FieldInterval
+	FieldBackend
+	FieldValue
+	FieldTimeseries
+)
+
+var fieldNames = map[Field]string{
+	FieldName:       "name",
+	FieldLastUpdate: "last_update",
+	FieldAge:        "age",
+	FieldInterval:   "interval",
+	FieldBackend:    "backend",
+	FieldValue:      "value",
+	FieldTimeseries: "timeseries",
+}
+
+// String returns the name of the field.
+func (f Field) String() string {
+	if n, ok := fieldNames[f]; ok {
+		return n
+	}
+	return fmt.Sprintf("<field %d>", int(f))
+}
+
+// An Attr is an expression referencing the value of the named attribute of
+// an object.
+type Attr string
+
+// String returns the attribute reference in SysQL syntax.
+func (a Attr) String() string {
+	return "attribute[" + proto.EscapeString(string(a)) + "]"
+}
+
+// An ObjectType is the type of a stored object.
+type ObjectType int
+
+// Types of objects.
+const (
+	Host ObjectType = iota + 1
+	Service
+	Metric
+	Attribute
+)
+
+var objectNames = map[ObjectType]string{
+	Host:      "host",
+	Service:   "service",
+	Metric:    "metric",
+	Attribute: "attribute",
+}
+
+// String returns the name of the object type.
+func (t ObjectType) String() string {
+	if n, ok := objectNames[t]; ok {
+		return n
+	}
+	return fmt.Sprintf("<object type %d>", int(t))
+}
+
+// A Typed expression evaluates Expr in the context of the parent or child
+// objects of the specified type (e.g. host.name or service.name).
+type Typed struct {
+	Type ObjectType
+	Expr Expr
+}
+
+// String returns the expression in SysQL syntax.
+func (t Typed) String() string {
+	return t.Type.String() + "." + exprString(t.Expr)
+}
+
+// A Const is a constant value. Supported values are int64, float64, string,
+// sysdb.Time, and slices of those (arrays).
+type Const struct {
+	Value interface{}
+}
+
+// The format for date-time constants.
+const dtFormat = "2006-01-02 15:04:05.999999999"
+
+// String returns the constant in SysQL syntax.
+func (c Const) String() string {
+	switch v := c.Value.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		s := strconv.FormatFloat(v, 'f', -1, 64)
+		if !strings.ContainsAny(s, ".NI") {
+			s += ".0"
+		}
+		return s
+	case string:
+		return proto.EscapeString(v)
+	case sysdb.Time:
+		return time.Time(v).Format(dtFormat)
+	case []int64:
+		return arrayString(len(v), func(i int) interface{} { return v[i] })
+	case []float64:
+		return arrayString(len(v), func(i int) interface{} { return v[i] })
+	case []string:
+		return arrayString(len(v), func(i int) interface{} { return v[i] })
+	case []sysdb.Time:
+		return arrayString(len(v), func(i int) interface{} { return v[i] })
+	}
+	return fmt.Sprintf("<invalid %T>", c.Value)
+}
+
+func arrayString(n int, elem func(i int) interface{}) string {
+	s := make([]string, n)
+	for i := range s {
+		s[i] = Const{elem(i)}.String()
+	}
+	return "[" + strings.Join(s, ", ") + "]"
+}
+
+// An ArithOp is an arithmetic operator.
+type ArithOp int
+
+// Arithmetic operators.
+const (
+	Add ArithOp = iota + 1
+	Sub
+	Mul
+	Div
+	Mod
+	Concat
+)
+
+var arithNames = map[ArithOp]string{
+	Add:    "+",
+	Sub:    "-",
+	Mul:    "*",
+	Div:    "/",
+	Mod:    "%",
+	Concat: "||",
+}
+
+// String returns the operator in SysQL syntax.
+func (op ArithOp) String() string {
+	if n, ok := arithNames[op]; ok {
+		return n
+	}
+	return fmt.Sprintf("<operator %d>", int(op))
+}
+
+// An Arith expression applies an arithmetic operator to two operands.
+type Arith struct {
+	Op          ArithOp
+	Left, Right Expr
+}
+
+// String returns the expression in SysQL syntax.
+func (a Arith) String() string {
+	return "(" + exprString(a.Left) + " " + a.Op.String() + " " + exprString(a.Right) + ")"
+}
+
+// An Op is a matcher operator.
+type Op int
+
+// Matcher operators.
+const (
+	Or Op = iota + 1
+	And
+	Not
+	Any
+	All
+	In
+	LT
+	LE
+	EQ
+	NE
+	GE
+	GT
+	Regex
+	NRegex
+	IsNull
+	IsTrue
+	IsFalse
+)
+
+var opNames = map[Op]string{
+	Or:      "OR",
+	And:     "AND",
+	Not:     "NOT",
+	Any:     "ANY",
+	All:     "ALL",
+	In:      "IN",
+	LT:      "<",
+	LE:      "<=",
+	EQ:      "=",
+	NE:      "!=",
+	GE:      ">=",
+	GT:      ">",
+	Regex:   "=~",
+	NRegex:  "!~",
+	IsNull:  "IS NULL",
+	IsTrue:  "IS TRUE",
+	IsFalse: "IS FALSE",
+}
+
+// String returns the operator in SysQL syntax.
+func (op Op) String() string {
+	if n, ok := opNames[op]; ok {
+		return n
+	}
+	return fmt.Sprintf("<operator %d>", int(op))
+}
+
+// isCmp reports whether op compares two values.
+func (op Op) isCmp() bool {
+	return In <= op && op <= NRegex
+}
+
+// A Logical matcher combines two matchers using Or or And.
+type Logical struct {
+	Op          Op
+	Left, Right Matcher
+}
+
+// String returns the matcher in SysQL syntax.
+func (l Logical) String() string {
+	return "(" + matcherString(l.Left) + " " + l.Op.String() + " " + matcherString(l.Right) + ")"
+}
+
+// A Negation matches if the negated matcher does not match.
+type Negation struct {
+	Matcher Matcher
+}
+
+// String returns the matcher in SysQL syntax.
+func (n Negation) String() string {
+	return "NOT " + matcherString(n.Matcher)
+}
+
+// An Iter matcher compares each element of an iterable expression (e.g. the
+// backends or the names of the services of a host) to Value using the
+// comparison operator Cmp. It matches if any (Op Any) or all (Op All) of the
+// elements match.
+type Iter struct {
+	Op    Op
+	Iter  Expr
+	Cmp   Op
+	Value Expr
+}
+
+// String returns the matcher in SysQL syntax.
+func (i Iter) String() string {
+	return i.Op.String() + " " + exprString(i.Iter) + " " + i.Cmp.String() + " " + exprString(i.Value)
+}
+
+// A Cmp matcher compares two expressions using a comparison operator (In, LT,
+// LE, EQ, NE, GE, GT, Regex, or NRegex).
+type Cmp struct {
+	Op          Op
+	Left, Right Expr
+}
+
+// String returns the matcher in SysQL syntax.
+func (c Cmp) String() string {
+	return exprString(c.Left) + " " + c.Op.String() + " " + exprString(c.Right)
+}
+
+// A Unary matcher checks a single expression using IsNull, IsTrue, or
+// IsFalse.
+type Unary struct {
+	Op   Op
+	Expr Expr
+}
+
+// String returns the matcher in SysQL syntax.
+func (u Unary) String() string {
+	return exprString(u.Expr) + " " + u.Op.String()
+}
+
+func exprString(e Expr) string {
+	if e == nil {
+		return "<nil>"
+	}
+	return e.String()
+}
+
+func matcherString(m Matcher) string {
+	if m == nil {
+		return "<nil>"
+	}
+	return m.String()
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
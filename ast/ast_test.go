@@ -0,0 +1,157 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package ast
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sysdb/go/proto"
+	"github.com/sysdb/go/sysdb"
+)
+
+var (
+	ts = sysdb.Time(time.Date(2015, 5, 1, 12, 0, 0, 500, time.UTC))
+
+	matchers = []struct {
+		m    Matcher
+		want string
+	}{
+		{
+			Cmp{Op: EQ, Left: Attr("architecture"), Right: Const{"amd64"}},
+			"attribute['architecture'] = 'amd64'",
+		},
+		{
+			Logical{Op: And,
+				Left:  Cmp{Op: Regex, Left: FieldName, Right: Const{"^web"}},
+				Right: Negation{Unary{Op: IsNull, Expr: Attr("it's")}},
+			},
+			"(name =~ '^web' AND NOT attribute['it''s'] IS NULL)",
+		},
+		{
+			Iter{Op: Any, Iter: Typed{Type: Service, Expr: FieldName}, Cmp: EQ, Value: Const{"sshd"}},
+			"ANY service.name = 'sshd'",
+		},
+		{
+			Cmp{Op: In, Left: FieldBackend, Right: Const{[]string{"a", "b"}}},
+			"backend IN ['a', 'b']",
+		},
+		{
+			Cmp{Op: GT, Left: Arith{Op: Mul, Left: FieldAge, Right: Const{int64(2)}}, Right: Const{1.5}},
+			"(age * 2) > 1.5",
+		},
+		{
+			Logical{Op: Or,
+				Left:  Cmp{Op: LT, Left: FieldLastUpdate, Right: Const{ts}},
+				Right: Cmp{Op: In, Left: Const{2.0}, Right: Const{[]float64{1, 2.5}}},
+			},
+			"(last_update < 2015-05-01 12:00:00.0000005 OR 2.0 IN [1.0, 2.5])",
+		},
+	}
+)
+
+func TestString(t *testing.T) {
+	for _, test := range matchers {
+		if got := test.m.String(); got != test.want {
+			t.Errorf("%#v.String() = %q; want %q", test.m, got, test.want)
+		}
+	}
+
+	if got, want := (Unary{Op: IsTrue}).String(), "<nil> IS TRUE"; got != want {
+		t.Errorf("Unary{IsTrue}.String() = %q; want %q", got, want)
+	}
+}
+
+func TestMarshalMatcher(t *testing.T) {
+	for _, test := range matchers {
+		msg, err := MarshalMatcher(test.m)
+		if err != nil || msg.Type != proto.ConnectionMatcher {
+			t.Errorf("MarshalMatcher(%s) = %v, %v; want <MATCHER>, <nil>", test.want, msg, err)
+			continue
+		}
+
+		got, err := UnmarshalMatcher(msg)
+		if err != nil || !reflect.DeepEqual(got, test.m) {
+			t.Errorf("UnmarshalMatcher(MarshalMatcher(%s)) = %#v, %v; want %#v, <nil>", test.want, got, err, test.m)
+		}
+
+		for i := 0; i < len(msg.Raw); i++ {
+			m := &proto.Message{Type: proto.ConnectionMatcher, Raw: msg.Raw[:i]}
+			if got, err := UnmarshalMatcher(m); sysdb.ErrorCode(err) != sysdb.CodeInvalidFormat {
+				t.Errorf("UnmarshalMatcher(<truncated to %d>) = %v, %v; want <error %v>", i, got, err, sysdb.CodeInvalidFormat)
+			}
+		}
+		m := &proto.Message{Type: proto.ConnectionMatcher, Raw: append(msg.Raw, 0)}
+		if got, err := UnmarshalMatcher(m); sysdb.ErrorCode(err) != sysdb.CodeInvalidFormat {
+			t.Errorf("UnmarshalMatcher(<trailing data>) = %v, %v; want <error %v>", got, err, sysdb.CodeInvalidFormat)
+		}
+	}
+}
+
+func TestMarshalErrors(t *testing.T) {
+	for _, m := range []Matcher{
+		Cmp{Op: And, Left: FieldName, Right: Const{"a"}},
+		Logical{Op: EQ, Left: Negation{}, Right: Negation{}},
+		Cmp{Op: EQ, Left: Field(42), Right: Const{"a"}},
+		Cmp{Op: EQ, Left: FieldName, Right: Const{int32(1)}},
+		Cmp{Op: EQ, Left: FieldName, Right: Const{[]byte("a")}},
+		Iter{Op: Any, Iter: FieldBackend, Cmp: IsNull, Value: Const{"a"}},
+		Unary{Op: Not, Expr: FieldName},
+		Unary{Op: IsTrue},
+		nil,
+	} {
+		if msg, err := MarshalMatcher(m); sysdb.ErrorCode(err) != sysdb.CodeInvalidArgument {
+			t.Errorf("MarshalMatcher(%s) = %v, %v; want <error %v>", m, msg, err, sysdb.CodeInvalidArgument)
+		}
+	}
+}
+
+func TestMarshalExpr(t *testing.T) {
+	e := Arith{Op: Concat, Left: Typed{Type: Host, Expr: Attr("a")}, Right: Const{[]sysdb.Time{ts}}}
+	msg, err := MarshalExpr(e)
+	if err != nil || msg.Type != proto.ConnectionExpr {
+		t.Fatalf("MarshalExpr(%s) = %v, %v; want <EXPR>, <nil>", e, msg, err)
+	}
+	if got, err := UnmarshalExpr(msg); err != nil || !reflect.DeepEqual(got, e) {
+		t.Errorf("UnmarshalExpr(MarshalExpr(%s)) = %#v, %v; want %#v, <nil>", e, got, err, e)
+	}
+
+	if got, err := UnmarshalMatcher(msg); sysdb.ErrorCode(err) != sysdb.CodeUnexpectedMessage {
+		t.Errorf("UnmarshalMatcher(<EXPR>) = %v, %v; want <error %v>", got, err, sysdb.CodeUnexpectedMessage)
+	}
+
+	deep := make([]byte, 2*maxDepth)
+	for i := range deep {
+		deep[i] = byte(Add)
+	}
+	m := &proto.Message{Type: proto.ConnectionExpr, Raw: deep}
+	if got, err := UnmarshalExpr(m); sysdb.ErrorCode(err) != sysdb.CodeInvalidFormat {
+		t.Errorf("UnmarshalExpr(<nested>) = %v, %v; want <error %v>", got, err, sysdb.CodeInvalidFormat)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
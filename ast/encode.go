@@ -0,0 +1,469 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package ast
+
+import (
+	"encoding/binary"
+	"math"
+	"reflect"
+	"time"
+
+	"github.com/sysdb/go/proto"
+	"github.com/sysdb/go/sysdb"
+)
+
+// The binary encoding of matchers and expressions follows the in-memory
+// representation used by SysDB: Each node starts with a single byte
+// identifying its kind (the operator of matchers and arithmetic expressions
+// or one of the kinds below) followed by its operands. Strings are prefixed
+// by their length (uint32). Constants are prefixed by their data type
+// (uint32) and arrays further by their number of elements (uint32). Integers
+// are encoded as int64, decimals as IEEE 754 binary64, and date-time values
+// as nanoseconds since the Unix epoch (int64). All integers are in network
+// byte order.
+
+// Kinds of expressions other than arithmetic expressions.
+const (
+	kindConst = 0x00
+	kindTyped = 0xfd
+	kindAttr  = 0xfe
+	kindField = 0xff
+)
+
+// Data types of constants as used by SysDB.
+const (
+	typeInteger  = 1
+	typeDecimal  = 2
+	typeString   = 3
+	typeDatetime = 4
+	typeArray    = 0x100
+)
+
+// maxDepth limits the nesting of decoded nodes.
+const maxDepth = 1000
+
+var nbo = binary.BigEndian
+
+// MarshalMatcher returns a MATCHER message carrying the binary encoding of m.
+func MarshalMatcher(m Matcher) (*proto.Message, error) {
+	b, err := appendMatcher(nil, m)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.Message{Type: proto.ConnectionMatcher, Raw: b}, nil
+}
+
+// UnmarshalMatcher decodes the matcher carried by the MATCHER message m.
+func UnmarshalMatcher(m *proto.Message) (Matcher, error) {
+	if m.Type != proto.ConnectionMatcher {
+		return nil, sysdb.Errorf(sysdb.CodeUnexpectedMessage, "unmarshaling matcher from message of type %s not supported", m.Type.CommandString())
+	}
+	d := &decoder{b: m.Raw}
+	matcher, err := d.matcher()
+	if err != nil {
+		return nil, err
+	}
+	return matcher, d.done()
+}
+
+// MarshalExpr returns an EXPR message carrying the binary encoding of e.
+func MarshalExpr(e Expr) (*proto.Message, error) {
+	b, err := appendExpr(nil, e)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.Message{Type: proto.ConnectionExpr, Raw: b}, nil
+}
+
+// UnmarshalExpr decodes the expression carried by the EXPR message m.
+func UnmarshalExpr(m *proto.Message) (Expr, error) {
+	if m.Type != proto.ConnectionExpr {
+		return nil, sysdb.Errorf(sysdb.CodeUnexpectedMessage, "unmarshaling expression from message of type %s not supported", m.Type.CommandString())
+	}
+	d := &decoder{b: m.Raw}
+	e, err := d.expr()
+	if err != nil {
+		return nil, err
+	}
+	return e, d.done()
+}
+
+func appendExpr(b []byte, e Expr) ([]byte, error) {
+	if e == nil {
+		return nil, sysdb.Errorf(sysdb.CodeInvalidArgument, "missing expression")
+	}
+	return e.appendTo(b)
+}
+
+func appendMatcher(b []byte, m Matcher) ([]byte, error) {
+	if m == nil {
+		return nil, sysdb.Errorf(sysdb.CodeInvalidArgument, "missing matcher")
+	}
+	return m.appendTo(b)
+}
+
+func appendString(b []byte, s string) []byte {
+	b = nbo.AppendUint32(b, uint32(len(s)))
+	return append(b, s...)
+}
+
+func (f Field) appendTo(b []byte) ([]byte, error) {
+	if _, ok := fieldNames[f]; !ok {
+		return nil, sysdb.Errorf(sysdb.CodeInvalidArgument, "invalid field %d", int(f))
+	}
+	return append(b, kindField, byte(f)), nil
+}
+
+func (a Attr) appendTo(b []byte) ([]byte, error) {
+	return appendString(append(b, kindAttr), string(a)), nil
+}
+
+func (t Typed) appendTo(b []byte) ([]byte, error) {
+	if _, ok := objectNames[t.Type]; !ok {
+		return nil, sysdb.Errorf(sysdb.CodeInvalidArgument, "invalid object type %d", int(t.Type))
+	}
+	return appendExpr(append(b, kindTyped, byte(t.Type)), t.Expr)
+}
+
+// scalarType returns the data type of a scalar constant value.
+func scalarType(v interface{}) (uint32, bool) {
+	switch v.(type) {
+	case int64:
+		return typeInteger, true
+	case float64:
+		return typeDecimal, true
+	case string:
+		return typeString, true
+	case sysdb.Time:
+		return typeDatetime, true
+	}
+	return 0, false
+}
+
+func appendScalar(b []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case int64:
+		return nbo.AppendUint64(b, uint64(v))
+	case float64:
+		return nbo.AppendUint64(b, math.Float64bits(v))
+	case string:
+		return appendString(b, v)
+	case sysdb.Time:
+		return nbo.AppendUint64(b, uint64(time.Time(v).UnixNano()))
+	}
+	panic("unreachable")
+}
+
+func (c Const) appendTo(b []byte) ([]byte, error) {
+	b = append(b, kindConst)
+	if t, ok := scalarType(c.Value); ok {
+		return appendScalar(nbo.AppendUint32(b, t), c.Value), nil
+	}
+
+	v := reflect.ValueOf(c.Value)
+	if v.Kind() == reflect.Slice {
+		if t, ok := scalarType(reflect.Zero(v.Type().Elem()).Interface()); ok {
+			b = nbo.AppendUint32(b, typeArray|t)
+			b = nbo.AppendUint32(b, uint32(v.Len()))
+			for i := 0; i < v.Len(); i++ {
+				b = appendScalar(b, v.Index(i).Interface())
+			}
+			return b, nil
+		}
+	}
+	return nil, sysdb.Errorf(sysdb.CodeInvalidArgument, "unsupported constant of type %T", c.Value)
+}
+
+func (a Arith) appendTo(b []byte) ([]byte, error) {
+	if _, ok := arithNames[a.Op]; !ok {
+		return nil, sysdb.Errorf(sysdb.CodeInvalidArgument, "invalid arithmetic operator %d", int(a.Op))
+	}
+	b, err := appendExpr(append(b, byte(a.Op)), a.Left)
+	if err != nil {
+		return nil, err
+	}
+	return appendExpr(b, a.Right)
+}
+
+func (l Logical) appendTo(b []byte) ([]byte, error) {
+	if l.Op != Or && l.Op != And {
+		return nil, sysdb.Errorf(sysdb.CodeInvalidArgument, "invalid logical operator %s", l.Op)
+	}
+	b, err := appendMatcher(append(b, byte(l.Op)), l.Left)
+	if err != nil {
+		return nil, err
+	}
+	return appendMatcher(b, l.Right)
+}
+
+func (n Negation) appendTo(b []byte) ([]byte, error) {
+	return appendMatcher(append(b, byte(Not)), n.Matcher)
+}
+
+func (i Iter) appendTo(b []byte) ([]byte, error) {
+	if i.Op != Any && i.Op != All {
+		return nil, sysdb.Errorf(sysdb.CodeInvalidArgument, "invalid iterator operator %s", i.Op)
+	}
+	if !i.Cmp.isCmp() {
+		return nil, sysdb.Errorf(sysdb.CodeInvalidArgument, "invalid comparison operator %s", i.Cmp)
+	}
+	b, err := appendExpr(append(b, byte(i.Op)), i.Iter)
+	if err != nil {
+		return nil, err
+	}
+	return appendExpr(append(b, byte(i.Cmp)), i.Value)
+}
+
+func (c Cmp) appendTo(b []byte) ([]byte, error) {
+	if !c.Op.isCmp() {
+		return nil, sysdb.Errorf(sysdb.CodeInvalidArgument, "invalid comparison operator %s", c.Op)
+	}
+	b, err := appendExpr(append(b, byte(c.Op)), c.Left)
+	if err != nil {
+		return nil, err
+	}
+	return appendExpr(b, c.Right)
+}
+
+func (u Unary) appendTo(b []byte) ([]byte, error) {
+	if u.Op != IsNull && u.Op != IsTrue && u.Op != IsFalse {
+		return nil, sysdb.Errorf(sysdb.CodeInvalidArgument, "invalid unary operator %s", u.Op)
+	}
+	return appendExpr(append(b, byte(u.Op)), u.Expr)
+}
+
+// A decoder decodes binary encoded matchers and expressions.
+type decoder struct {
+	b     []byte
+	depth int
+}
+
+func (d *decoder) next(n int) ([]byte, error) {
+	if len(d.b) < n {
+		return nil, sysdb.Errorf(sysdb.CodeInvalidFormat, "encoded node truncated")
+	}
+	v := d.b[:n]
+	d.b = d.b[n:]
+	return v, nil
+}
+
+func (d *decoder) byte() (byte, error) {
+	b, err := d.next(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (d *decoder) uint32() (uint32, error) {
+	b, err := d.next(4)
+	if err != nil {
+		return 0, err
+	}
+	return nbo.Uint32(b), nil
+}
+
+func (d *decoder) string() (string, error) {
+	n, err := d.uint32()
+	if err != nil {
+		return "", err
+	}
+	b, err := d.next(int(n))
+	return string(b), err
+}
+
+func (d *decoder) done() error {
+	if len(d.b) > 0 {
+		return sysdb.Errorf(sysdb.CodeInvalidFormat, "%d bytes of trailing data after encoded node", len(d.b))
+	}
+	return nil
+}
+
+func (d *decoder) enter() error {
+	if d.depth++; d.depth > maxDepth {
+		return sysdb.Errorf(sysdb.CodeInvalidFormat, "encoded node nested too deeply")
+	}
+	return nil
+}
+
+func (d *decoder) expr() (Expr, error) {
+	if err := d.enter(); err != nil {
+		return nil, err
+	}
+	defer func() { d.depth-- }()
+
+	kind, err := d.byte()
+	if err != nil {
+		return nil, err
+	}
+	switch kind {
+	case kindField:
+		f, err := d.byte()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := fieldNames[Field(f)]; !ok {
+			return nil, sysdb.Errorf(sysdb.CodeInvalidFormat, "unknown field %d", f)
+		}
+		return Field(f), nil
+	case kindAttr:
+		s, err := d.string()
+		return Attr(s), err
+	case kindTyped:
+		t, err := d.byte()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := objectNames[ObjectType(t)]; !ok {
+			return nil, sysdb.Errorf(sysdb.CodeInvalidFormat, "unknown object type %d", t)
+		}
+		e, err := d.expr()
+		return Typed{Type: ObjectType(t), Expr: e}, err
+	case kindConst:
+		v, err := d.value()
+		return Const{v}, err
+	}
+
+	op := ArithOp(kind)
+	if _, ok := arithNames[op]; !ok {
+		return nil, sysdb.Errorf(sysdb.CodeInvalidFormat, "unknown expression kind %d", kind)
+	}
+	l, err := d.expr()
+	if err != nil {
+		return nil, err
+	}
+	r, err := d.expr()
+	return Arith{Op: op, Left: l, Right: r}, err
+}
+
+// Zero values of the scalar data types.
+var scalarZero = map[uint32]interface{}{
+	typeInteger:  int64(0),
+	typeDecimal:  float64(0),
+	typeString:   "",
+	typeDatetime: sysdb.Time{},
+}
+
+func (d *decoder) scalar(t uint32) (interface{}, error) {
+	if t == typeString {
+		return d.string()
+	}
+	b, err := d.next(8)
+	if err != nil {
+		return nil, err
+	}
+	v := nbo.Uint64(b)
+	switch t {
+	case typeInteger:
+		return int64(v), nil
+	case typeDecimal:
+		return math.Float64frombits(v), nil
+	default: // typeDatetime
+		return sysdb.Time(time.Unix(0, int64(v)).UTC()), nil
+	}
+}
+
+func (d *decoder) value() (interface{}, error) {
+	t, err := d.uint32()
+	if err != nil {
+		return nil, err
+	}
+	zero, ok := scalarZero[t&^typeArray]
+	if !ok {
+		return nil, sysdb.Errorf(sysdb.CodeInvalidFormat, "unsupported data type %#x", t)
+	}
+	if t&typeArray == 0 {
+		return d.scalar(t)
+	}
+
+	n, err := d.uint32()
+	if err != nil {
+		return nil, err
+	}
+	if int64(n) > int64(len(d.b)/4) { // every element takes at least 4 bytes
+		return nil, sysdb.Errorf(sysdb.CodeInvalidFormat, "encoded node truncated")
+	}
+	a := reflect.MakeSlice(reflect.SliceOf(reflect.TypeOf(zero)), int(n), int(n))
+	for i := 0; i < int(n); i++ {
+		v, err := d.scalar(t &^ typeArray)
+		if err != nil {
+			return nil, err
+		}
+		a.Index(i).Set(reflect.ValueOf(v))
+	}
+	return a.Interface(), nil
+}
+
+func (d *decoder) matcher() (Matcher, error) {
+	if err := d.enter(); err != nil {
+		return nil, err
+	}
+	defer func() { d.depth-- }()
+
+	b, err := d.byte()
+	if err != nil {
+		return nil, err
+	}
+	switch op := Op(b); {
+	case op == Or || op == And:
+		l, err := d.matcher()
+		if err != nil {
+			return nil, err
+		}
+		r, err := d.matcher()
+		return Logical{Op: op, Left: l, Right: r}, err
+	case op == Not:
+		m, err := d.matcher()
+		return Negation{m}, err
+	case op == Any || op == All:
+		iter, err := d.expr()
+		if err != nil {
+			return nil, err
+		}
+		cmp, err := d.byte()
+		if err != nil {
+			return nil, err
+		}
+		if !Op(cmp).isCmp() {
+			return nil, sysdb.Errorf(sysdb.CodeInvalidFormat, "unknown comparison operator %d", cmp)
+		}
+		v, err := d.expr()
+		return Iter{Op: op, Iter: iter, Cmp: Op(cmp), Value: v}, err
+	case op.isCmp():
+		l, err := d.expr()
+		if err != nil {
+			return nil, err
+		}
+		r, err := d.expr()
+		return Cmp{Op: op, Left: l, Right: r}, err
+	case op == IsNull || op == IsTrue || op == IsFalse:
+		e, err := d.expr()
+		return Unary{Op: op, Expr: e}, err
+	}
+	return nil, sysdb.Errorf(sysdb.CodeInvalidFormat, "unknown matcher operator %d", b)
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,666 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package ast
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+// An object is a host, service, metric, or attribute along with its parent
+// objects. It is the context in which expressions are evaluated.
+type object struct {
+	typ     ObjectType
+	host    *sysdb.Host
+	service *sysdb.Service
+	metric  *sysdb.Metric
+	attr    *sysdb.Attribute
+}
+
+func hostObject(h *sysdb.Host) object {
+	return object{typ: Host, host: h}
+}
+
+func (o object) name() string {
+	switch o.typ {
+	case Service:
+		return o.service.Name
+	case Metric:
+		return o.metric.Name
+	case Attribute:
+		return o.attr.Name
+	}
+	return o.host.Name
+}
+
+func (o object) lastUpdate() sysdb.Time {
+	switch o.typ {
+	case Service:
+		return o.service.LastUpdate
+	case Metric:
+		return o.metric.LastUpdate
+	case Attribute:
+		return o.attr.LastUpdate
+	}
+	return o.host.LastUpdate
+}
+
+func (o object) interval() sysdb.Duration {
+	switch o.typ {
+	case Service:
+		return o.service.UpdateInterval
+	case Metric:
+		return o.metric.UpdateInterval
+	case Attribute:
+		return o.attr.UpdateInterval
+	}
+	return o.host.UpdateInterval
+}
+
+func (o object) backends() []string {
+	switch o.typ {
+	case Service:
+		return o.service.Backends
+	case Metric:
+		return o.metric.Backends
+	case Attribute:
+		return o.attr.Backends
+	}
+	return o.host.Backends
+}
+
+func (o object) attributes() []sysdb.Attribute {
+	switch o.typ {
+	case Service:
+		return o.service.Attributes
+	case Metric:
+		return o.metric.Attributes
+	case Attribute:
+		return nil
+	}
+	return o.host.Attributes
+}
+
+// children returns the child objects of the specified type. Attributes are
+// children of the object itself; services and metrics are children of the
+// host.
+func (o object) children(typ ObjectType) []object {
+	var res []object
+	switch typ {
+	case Service:
+		for i := range o.host.Services {
+			res = append(res, object{typ: typ, host: o.host, service: &o.host.Services[i]})
+		}
+	case Metric:
+		for i := range o.host.Metrics {
+			res = append(res, object{typ: typ, host: o.host, metric: &o.host.Metrics[i]})
+		}
+	case Attribute:
+		attrs := o.attributes()
+		for i := range attrs {
+			c := o
+			c.typ, c.attr = typ, &attrs[i]
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+// parent returns the object itself or its parent object of the specified
+// type.
+func (o object) parent(typ ObjectType) (object, bool) {
+	switch {
+	case typ == o.typ:
+		return o, true
+	case typ == Host:
+		return hostObject(o.host), true
+	case typ == Service && o.service != nil:
+		return object{typ: typ, host: o.host, service: o.service}, true
+	case typ == Metric && o.metric != nil:
+		return object{typ: typ, host: o.host, metric: o.metric}, true
+	}
+	return object{}, false
+}
+
+// An Evaluator evaluates matchers and expressions against objects on the
+// client side, for example, to post-filter cached query results or to test
+// queries offline. It follows the semantics of SysDB as far as possible.
+// Since attribute values are not typed in the JSON representation of
+// objects, they are converted to numbers when compared with numeric values.
+// Comparisons involving NULL values (e.g. missing attributes) never match.
+//
+// Values of expressions are represented by nil (NULL), bool, int64, float64,
+// string, sysdb.Time, sysdb.Duration (ages and intervals), or []interface{}
+// (arrays). Date-time values and durations compare equal to integers
+// representing the same number of nanoseconds.
+//
+// An Evaluator caches compiled regular expressions; it is not safe for
+// concurrent use. The zero value is ready to use.
+type Evaluator struct {
+	// Now is the current time used to determine the age of objects. If
+	// zero, the time of the evaluation is used.
+	Now time.Time
+
+	regexps map[string]*regexp.Regexp
+}
+
+// MatchHost reports whether the host matches m.
+func (e *Evaluator) MatchHost(m Matcher, h *sysdb.Host) (bool, error) {
+	return e.match(m, hostObject(h))
+}
+
+// MatchService reports whether the service of host h matches m.
+func (e *Evaluator) MatchService(m Matcher, h *sysdb.Host, s *sysdb.Service) (bool, error) {
+	return e.match(m, object{typ: Service, host: h, service: s})
+}
+
+// MatchMetric reports whether the metric of host h matches m.
+func (e *Evaluator) MatchMetric(m Matcher, h *sysdb.Host, met *sysdb.Metric) (bool, error) {
+	return e.match(m, object{typ: Metric, host: h, metric: met})
+}
+
+// Eval evaluates the expression in the context of the host.
+func (e *Evaluator) Eval(x Expr, h *sysdb.Host) (interface{}, error) {
+	return e.eval(x, hostObject(h))
+}
+
+// Match reports whether the host matches m. See Evaluator for details.
+func Match(m Matcher, h *sysdb.Host) (bool, error) {
+	return new(Evaluator).MatchHost(m, h)
+}
+
+// Filter returns the hosts matching m. See Evaluator for details.
+func Filter(m Matcher, hosts []sysdb.Host) ([]sysdb.Host, error) {
+	var e Evaluator
+	var res []sysdb.Host
+	for i := range hosts {
+		ok, err := e.MatchHost(m, &hosts[i])
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			res = append(res, hosts[i])
+		}
+	}
+	return res, nil
+}
+
+func (e *Evaluator) now() time.Time {
+	if e.Now.IsZero() {
+		return time.Now()
+	}
+	return e.Now
+}
+
+func invalidf(format string, args ...interface{}) error {
+	return sysdb.Errorf(sysdb.CodeInvalidArgument, format, args...)
+}
+
+// match reports whether the object matches m.
+func (e *Evaluator) match(m Matcher, o object) (bool, error) {
+	switch m := m.(type) {
+	case Logical:
+		l, err := e.match(m.Left, o)
+		if err != nil {
+			return false, err
+		}
+		switch m.Op {
+		case And:
+			if !l {
+				return false, nil
+			}
+		case Or:
+			if l {
+				return true, nil
+			}
+		default:
+			return false, invalidf("invalid logical operator %s", m.Op)
+		}
+		return e.match(m.Right, o)
+	case Negation:
+		ok, err := e.match(m.Matcher, o)
+		return !ok, err
+	case Unary:
+		v, err := e.eval(m.Expr, o)
+		if err != nil {
+			return false, err
+		}
+		switch m.Op {
+		case IsNull:
+			return v == nil, nil
+		case IsTrue:
+			return v == true, nil
+		case IsFalse:
+			return v == false, nil
+		}
+		return false, invalidf("invalid unary operator %s", m.Op)
+	case Cmp:
+		l, err := e.eval(m.Left, o)
+		if err != nil {
+			return false, err
+		}
+		r, err := e.eval(m.Right, o)
+		if err != nil {
+			return false, err
+		}
+		return e.compare(m.Op, l, r)
+	case Iter:
+		return e.iter(m, o)
+	case nil:
+		return false, invalidf("missing matcher")
+	}
+	return false, invalidf("unsupported matcher %T", m)
+}
+
+func (e *Evaluator) iter(m Iter, o object) (bool, error) {
+	if m.Op != Any && m.Op != All {
+		return false, invalidf("invalid iterator %s", m.Op)
+	}
+	v, err := e.eval(m.Iter, o)
+	if err != nil {
+		return false, err
+	}
+	r, err := e.eval(m.Value, o)
+	if err != nil {
+		return false, err
+	}
+
+	var elems []interface{}
+	switch v := v.(type) {
+	case []interface{}:
+		elems = v
+	case nil:
+	default:
+		return false, invalidf("cannot iterate over %s", m.Iter)
+	}
+	for _, elem := range elems {
+		ok, err := e.compare(m.Cmp, elem, r)
+		if err != nil {
+			return false, err
+		}
+		if m.Op == Any && ok {
+			return true, nil
+		}
+		if m.Op == All && !ok {
+			return false, nil
+		}
+	}
+	return m.Op == All, nil
+}
+
+// eval evaluates the expression in the context of the object.
+func (e *Evaluator) eval(expr Expr, o object) (interface{}, error) {
+	switch expr := expr.(type) {
+	case Const:
+		return constValue(expr.Value)
+	case Field:
+		return e.field(expr, o)
+	case Attr:
+		for _, a := range o.attributes() {
+			if a.Name == string(expr) {
+				return a.Value, nil
+			}
+		}
+		return nil, nil
+	case Typed:
+		if p, ok := o.parent(expr.Type); ok {
+			return e.eval(expr.Expr, p)
+		}
+		var res []interface{}
+		for _, c := range o.children(expr.Type) {
+			v, err := e.eval(expr.Expr, c)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, v)
+		}
+		return res, nil
+	case Arith:
+		l, err := e.eval(expr.Left, o)
+		if err != nil {
+			return nil, err
+		}
+		r, err := e.eval(expr.Right, o)
+		if err != nil {
+			return nil, err
+		}
+		return arith(expr.Op, l, r)
+	case nil:
+		return nil, invalidf("missing expression")
+	}
+	return nil, invalidf("unsupported expression %T", expr)
+}
+
+func (e *Evaluator) field(f Field, o object) (interface{}, error) {
+	switch f {
+	case FieldName:
+		return o.name(), nil
+	case FieldLastUpdate:
+		return o.lastUpdate(), nil
+	case FieldAge:
+		return sysdb.Duration(e.now().Sub(time.Time(o.lastUpdate()))), nil
+	case FieldInterval:
+		return o.interval(), nil
+	case FieldBackend:
+		var res []interface{}
+		for _, b := range o.backends() {
+			res = append(res, b)
+		}
+		return res, nil
+	case FieldValue:
+		if o.typ == Attribute {
+			return o.attr.Value, nil
+		}
+		return nil, nil
+	case FieldTimeseries:
+		if o.typ == Metric {
+			return o.metric.Timeseries, nil
+		}
+		return nil, nil
+	}
+	return nil, invalidf("unsupported field %s", f)
+}
+
+// constValue converts a constant to its internal representation.
+func constValue(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case int64, float64, string, sysdb.Time:
+		return v, nil
+	case []int64:
+		res := make([]interface{}, len(v))
+		for i := range v {
+			res[i] = v[i]
+		}
+		return res, nil
+	case []float64:
+		res := make([]interface{}, len(v))
+		for i := range v {
+			res[i] = v[i]
+		}
+		return res, nil
+	case []string:
+		res := make([]interface{}, len(v))
+		for i := range v {
+			res[i] = v[i]
+		}
+		return res, nil
+	case []sysdb.Time:
+		res := make([]interface{}, len(v))
+		for i := range v {
+			res[i] = v[i]
+		}
+		return res, nil
+	}
+	return nil, invalidf("unsupported constant of type %T", v)
+}
+
+// number converts a numeric value to int64 or float64. Date-time values and
+// durations are represented by nanoseconds. Strings are parsed if possible.
+func number(v interface{}) (interface{}, bool) {
+	switch v := v.(type) {
+	case int64, float64:
+		return v, true
+	case sysdb.Time:
+		return time.Time(v).UnixNano(), true
+	case sysdb.Duration:
+		return int64(v), true
+	case string:
+		if i, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil {
+			return i, true
+		}
+		if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+func toFloat(v interface{}) float64 {
+	if i, ok := v.(int64); ok {
+		return float64(i)
+	}
+	return v.(float64)
+}
+
+// cmp compares two non-NULL scalar values. It returns false if the values
+// are not comparable.
+func cmp(l, r interface{}) (int, bool) {
+	ls, lok := l.(string)
+	rs, rok := r.(string)
+	if lok && rok {
+		return strings.Compare(ls, rs), true
+	}
+	if lb, ok := l.(bool); ok {
+		rb, ok := r.(bool)
+		if !ok {
+			return 0, false
+		}
+		if lb == rb {
+			return 0, true
+		}
+		if rb {
+			return -1, true
+		}
+		return 1, true
+	}
+
+	ln, lok := number(l)
+	rn, rok := number(r)
+	if !lok || !rok {
+		return 0, false
+	}
+	li, lint := ln.(int64)
+	ri, rint := rn.(int64)
+	if lint && rint {
+		switch {
+		case li < ri:
+			return -1, true
+		case li > ri:
+			return 1, true
+		}
+		return 0, true
+	}
+	lf, rf := toFloat(ln), toFloat(rn)
+	switch {
+	case lf < rf:
+		return -1, true
+	case lf > rf:
+		return 1, true
+	case lf == rf:
+		return 0, true
+	}
+	return 0, false // NaN
+}
+
+// compare applies a comparison operator. Comparisons involving NULL never
+// match.
+func (e *Evaluator) compare(op Op, l, r interface{}) (bool, error) {
+	if l == nil || r == nil {
+		return false, nil
+	}
+
+	switch op {
+	case In:
+		arr, ok := r.([]interface{})
+		if !ok {
+			return false, invalidf("IN requires an array")
+		}
+		if la, ok := l.([]interface{}); ok {
+			for _, v := range la {
+				if ok, _ := e.compare(In, v, arr); !ok {
+					return false, nil
+				}
+			}
+			return true, nil
+		}
+		for _, v := range arr {
+			if c, ok := cmp(l, v); ok && c == 0 {
+				return true, nil
+			}
+		}
+		return false, nil
+	case Regex, NRegex:
+		pattern, ok := r.(string)
+		if !ok {
+			return false, invalidf("regular expression must be a string")
+		}
+		re, ok := e.regexps[pattern]
+		if !ok {
+			if e.regexps == nil {
+				e.regexps = make(map[string]*regexp.Regexp)
+			}
+			var err error
+			if re, err = regexp.Compile(pattern); err != nil {
+				return false, invalidf("invalid regular expression %q: %v", pattern, err)
+			}
+			e.regexps[pattern] = re
+		}
+		s, ok := l.(string)
+		if !ok {
+			s = fmt.Sprint(l)
+		}
+		return re.MatchString(s) == (op == Regex), nil
+	}
+
+	if _, ok := l.([]interface{}); ok {
+		return false, nil
+	}
+	if _, ok := r.([]interface{}); ok {
+		return false, nil
+	}
+	c, ok := cmp(l, r)
+	if !ok {
+		return false, nil
+	}
+	switch op {
+	case LT:
+		return c < 0, nil
+	case LE:
+		return c <= 0, nil
+	case EQ:
+		return c == 0, nil
+	case NE:
+		return c != 0, nil
+	case GE:
+		return c >= 0, nil
+	case GT:
+		return c > 0, nil
+	}
+	return false, invalidf("invalid comparison operator %s", op)
+}
+
+// arith applies an arithmetic operator. Operations involving NULL or
+// incompatible values evaluate to NULL.
+func arith(op ArithOp, l, r interface{}) (interface{}, error) {
+	if l == nil || r == nil {
+		return nil, nil
+	}
+	if op == Concat {
+		la, lok := l.([]interface{})
+		ra, rok := r.([]interface{})
+		if lok && rok {
+			return append(append([]interface{}{}, la...), ra...), nil
+		}
+		ls, lok := l.(string)
+		rs, rok := r.(string)
+		if lok && rok {
+			return ls + rs, nil
+		}
+		return nil, nil
+	}
+	if op < Add || op > Mod {
+		return nil, invalidf("invalid arithmetic operator %s", op)
+	}
+
+	ln, lok := number(l)
+	rn, rok := number(r)
+	if !lok || !rok {
+		return nil, nil
+	}
+	li, lint := ln.(int64)
+	ri, rint := rn.(int64)
+	if lint && rint {
+		var res int64
+		switch op {
+		case Add:
+			res = li + ri
+		case Sub:
+			res = li - ri
+		case Mul:
+			res = li * ri
+		case Div, Mod:
+			if ri == 0 {
+				return nil, nil
+			}
+			if op == Div {
+				res = li / ri
+			} else {
+				res = li % ri
+			}
+		}
+		return datetimeResult(l, r, res), nil
+	}
+
+	lf, rf := toFloat(ln), toFloat(rn)
+	switch op {
+	case Add:
+		return lf + rf, nil
+	case Sub:
+		return lf - rf, nil
+	case Mul:
+		return lf * rf, nil
+	case Div:
+		return lf / rf, nil
+	}
+	return math.Mod(lf, rf), nil
+}
+
+// datetimeResult converts the integer result of an arithmetic operation on
+// date-time values or durations back to the appropriate type: time ± duration
+// is a time, time - time and duration ± duration are durations.
+func datetimeResult(l, r interface{}, res int64) interface{} {
+	_, lt := l.(sysdb.Time)
+	_, rt := r.(sysdb.Time)
+	_, ld := l.(sysdb.Duration)
+	_, rd := r.(sysdb.Duration)
+	switch {
+	case lt && rt:
+		return sysdb.Duration(res)
+	case lt || rt:
+		return sysdb.Time(time.Unix(0, res))
+	case ld || rd:
+		return sysdb.Duration(res)
+	}
+	return res
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
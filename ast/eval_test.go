@@ -0,0 +1,194 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package ast
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+var (
+	now   = time.Date(2015, 5, 1, 12, 0, 0, 0, time.UTC)
+	hosts = []sysdb.Host{
+		{
+			Name:           "h1",
+			LastUpdate:     sysdb.Time(now.Add(-time.Minute)),
+			UpdateInterval: sysdb.Minute,
+			Backends:       []string{"collectd", "puppet"},
+			Attributes: []sysdb.Attribute{
+				{Name: "architecture", Value: "amd64"},
+				{Name: "cpus", Value: "16"},
+			},
+			Metrics: []sysdb.Metric{
+				{Name: "load/load", Timeseries: true},
+				{Name: "cpu/idle"},
+			},
+			Services: []sysdb.Service{
+				{Name: "www", Attributes: []sysdb.Attribute{{Name: "port", Value: "80"}}},
+				{Name: "ssh", Attributes: []sysdb.Attribute{{Name: "port", Value: "22"}}},
+			},
+		},
+		{
+			Name:       "h2",
+			LastUpdate: sysdb.Time(now.Add(-time.Hour)),
+			Attributes: []sysdb.Attribute{{Name: "architecture", Value: "i386"}},
+		},
+		{Name: "h3"},
+	}
+)
+
+func TestMatch(t *testing.T) {
+	h := &hosts[0]
+	svc := object{typ: Service, host: h, service: &h.Services[0]}
+	e := &Evaluator{Now: now}
+
+	str := func(s string) Const { return Const{Value: s} }
+	num := func(i int64) Const { return Const{Value: i} }
+	for _, test := range []struct {
+		m        Matcher
+		o        object
+		expected bool
+		err      bool
+	}{
+		// comparisons
+		{Cmp{Op: EQ, Left: FieldName, Right: str("h1")}, hostObject(h), true, false},
+		{Cmp{Op: LT, Left: FieldName, Right: str("h2")}, hostObject(h), true, false},
+		{Cmp{Op: GE, Left: Attr("cpus"), Right: num(16)}, hostObject(h), true, false},
+		{Cmp{Op: LT, Left: Attr("cpus"), Right: Const{Value: 16.5}}, hostObject(h), true, false},
+		{Cmp{Op: EQ, Left: Attr("architecture"), Right: num(1)}, hostObject(h), false, false},
+		{Cmp{Op: NE, Left: Attr("missing"), Right: str("x")}, hostObject(h), false, false},
+		{Cmp{Op: NRegex, Left: FieldName, Right: str("^h2")}, hostObject(h), true, false},
+		{Cmp{Op: In, Left: FieldName, Right: Const{Value: []string{"h0", "h1"}}}, hostObject(h), true, false},
+		{Cmp{Op: In, Left: FieldBackend, Right: Const{Value: []string{"collectd", "puppet", "x"}}}, hostObject(h), true, false},
+		{Cmp{Op: In, Left: FieldBackend, Right: Const{Value: []string{"collectd"}}}, hostObject(h), false, false},
+		{Cmp{Op: In, Left: FieldName, Right: str("h1")}, hostObject(h), false, true},
+		{Cmp{Op: Op(0), Left: FieldName, Right: str("h1")}, hostObject(h), false, true},
+
+		// date-time values and durations
+		{Cmp{Op: LT, Left: FieldAge, Right: num(int64(2 * time.Minute))}, hostObject(h), true, false},
+		{Cmp{Op: GT, Left: FieldLastUpdate, Right: Const{Value: sysdb.Time(now.Add(-time.Hour))}}, hostObject(h), true, false},
+		{Cmp{Op: EQ, Left: FieldInterval, Right: num(int64(time.Minute))}, hostObject(h), true, false},
+		{
+			Cmp{
+				Op:    EQ,
+				Left:  Arith{Op: Add, Left: FieldLastUpdate, Right: FieldInterval},
+				Right: Const{Value: sysdb.Time(now)},
+			},
+			hostObject(h), true, false,
+		},
+
+		// arithmetic
+		{Cmp{Op: EQ, Left: Arith{Op: Mul, Left: Attr("cpus"), Right: num(2)}, Right: num(32)}, hostObject(h), true, false},
+		{Cmp{Op: EQ, Left: Arith{Op: Div, Left: Attr("cpus"), Right: Const{Value: 32.0}}, Right: Const{Value: 0.5}}, hostObject(h), true, false},
+		{Unary{Op: IsNull, Expr: Arith{Op: Mod, Left: num(1), Right: num(0)}}, hostObject(h), true, false},
+		{Cmp{Op: EQ, Left: Arith{Op: Concat, Left: FieldName, Right: str(".example.com")}, Right: str("h1.example.com")}, hostObject(h), true, false},
+
+		// unary and logical matchers
+		{Unary{Op: IsNull, Expr: FieldValue}, hostObject(h), true, false},
+		{Unary{Op: IsFalse, Expr: FieldTimeseries}, hostObject(h), false, false},
+		{Negation{Matcher: Unary{Op: IsNull, Expr: Attr("cpus")}}, hostObject(h), true, false},
+		{Logical{Op: Or, Left: Unary{Op: IsNull, Expr: Attr("cpus")}, Right: Cmp{Op: EQ, Left: FieldName, Right: str("h1")}}, hostObject(h), true, false},
+		{Logical{Op: Not, Left: Unary{Op: IsNull, Expr: FieldName}}, hostObject(h), false, true},
+
+		// iterators
+		{Iter{Op: All, Iter: Typed{Type: Metric, Expr: FieldName}, Cmp: Regex, Value: str("/")}, hostObject(h), true, false},
+		{Iter{Op: All, Iter: Typed{Type: Service, Expr: FieldName}, Cmp: Regex, Value: str("^nope")}, hostObject(&hosts[2]), true, false},
+		{Iter{Op: Any, Iter: Typed{Type: Service, Expr: FieldName}, Cmp: EQ, Value: str("x")}, hostObject(&hosts[2]), false, false},
+		{Iter{Op: Any, Iter: Typed{Type: Attribute, Expr: FieldValue}, Cmp: EQ, Value: str("amd64")}, hostObject(h), true, false},
+		{Iter{Op: Any, Iter: FieldName, Cmp: EQ, Value: str("h1")}, hostObject(h), false, true},
+
+		// child and parent contexts
+		{Cmp{Op: EQ, Left: FieldName, Right: str("www")}, svc, true, false},
+		{Cmp{Op: EQ, Left: Typed{Type: Service, Expr: FieldName}, Right: str("www")}, svc, true, false},
+		{Cmp{Op: EQ, Left: Typed{Type: Host, Expr: FieldName}, Right: str("h1")}, svc, true, false},
+		{Cmp{Op: EQ, Left: Attr("port"), Right: num(80)}, svc, true, false},
+	} {
+		got, err := e.match(test.m, test.o)
+		if (err != nil) != test.err || got != test.expected {
+			t.Errorf("match(%v, %s) = %v, %v; want %v (error: %v)",
+				test.m, test.o.name(), got, err, test.expected, test.err)
+		}
+	}
+}
+
+func TestEvaluator(t *testing.T) {
+	e := &Evaluator{Now: now}
+	h := &hosts[0]
+
+	if ok, err := e.MatchService(Cmp{Op: EQ, Left: Attr("port"), Right: Const{Value: int64(22)}}, h, &h.Services[1]); !ok || err != nil {
+		t.Errorf("MatchService(port = 22, h1.ssh) = %v, %v; want true, <nil>", ok, err)
+	}
+	if ok, err := e.MatchMetric(Unary{Op: IsTrue, Expr: FieldTimeseries}, h, &h.Metrics[1]); ok || err != nil {
+		t.Errorf("MatchMetric(timeseries IS TRUE, h1.cpu/idle) = %v, %v; want false, <nil>", ok, err)
+	}
+
+	for _, test := range []struct {
+		x        Expr
+		expected interface{}
+	}{
+		{FieldName, "h1"},
+		{FieldAge, sysdb.Minute},
+		{FieldInterval, sysdb.Minute},
+		{Attr("cpus"), "16"},
+		{Attr("missing"), nil},
+		{Typed{Type: Service, Expr: FieldName}, []interface{}{"www", "ssh"}},
+		{Arith{Op: Add, Left: Const{Value: int64(1)}, Right: Const{Value: 0.5}}, 1.5},
+	} {
+		if v, err := e.Eval(test.x, h); err != nil || !reflect.DeepEqual(v, test.expected) {
+			t.Errorf("Eval(%s) = %#v, %v; want %#v, <nil>", test.x, v, err, test.expected)
+		}
+	}
+	if v, err := e.Eval(nil, h); sysdb.ErrorCode(err) != sysdb.CodeInvalidArgument {
+		t.Errorf("Eval(<nil>) = %v, %v; want <error %v>", v, err, sysdb.CodeInvalidArgument)
+	}
+
+	// The zero value uses the current time.
+	var zero Evaluator
+	if ok, err := zero.MatchHost(Cmp{Op: GT, Left: FieldAge, Right: Const{Value: int64(time.Hour)}}, &hosts[1]); !ok || err != nil {
+		t.Errorf("MatchHost(age > 1h, h2) = %v, %v; want true, <nil>", ok, err)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	m := Cmp{Op: Regex, Left: Attr("architecture"), Right: Const{Value: "^(amd64|i386)$"}}
+	got, err := Filter(m, hosts)
+	if err != nil || len(got) != 2 || got[0].Name != "h1" || got[1].Name != "h2" {
+		t.Errorf("Filter(%s) = %v, %v; want [h1 h2], <nil>", m, got, err)
+	}
+	if ok, err := Match(m, &hosts[2]); ok || err != nil {
+		t.Errorf("Match(%s, h3) = %v, %v; want false, <nil>", m, ok, err)
+	}
+
+	m = Cmp{Op: Regex, Left: Attr("architecture"), Right: Const{Value: "("}}
+	if got, err := Filter(m, hosts); sysdb.ErrorCode(err) != sysdb.CodeInvalidArgument {
+		t.Errorf("Filter(%s) = %v, %v; want <error %v>", m, got, err, sysdb.CodeInvalidArgument)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,248 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package client
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sysdb/go/proto"
+	"github.com/sysdb/go/sysdb"
+)
+
+// A BatchResult is the outcome of a single request of a batch.
+type BatchResult struct {
+	Res *proto.Message
+	Err error
+}
+
+// Batch sends all requests on a single connection without waiting for the
+// replies in between, saving a network round-trip per request. It blocks
+// until all replies have been received. Requests are sent and results
+// returned in the order of the requests.
+//
+// Each request is passed through all interceptors registered with the client
+// first. Only the requests reaching the end of the interceptor chain are
+// batched; requests answered by an interceptor, for example from the cache
+// or by rejecting them as violating the query policy, are not sent at all. If
+// an interceptor passes on a request repeatedly, any further attempts are
+// sent individually.
+//
+// Failed requests are reported in the respective result. If the connection
+// fails, all outstanding requests will fail with the same error.
+func (c *Client) Batch(reqs ...*proto.Message) []BatchResult {
+	return c.BatchContext(context.Background(), reqs...)
+}
+
+// BatchContext is like Batch but takes a context. If the context is done
+// before all replies have been received, all outstanding requests fail with
+// the context's error.
+func (c *Client) BatchContext(ctx context.Context, reqs ...*proto.Message) []BatchResult {
+	results := make([]BatchResult, len(reqs))
+
+	var (
+		mu      sync.Mutex
+		pending []*batchCall
+		sent    bool
+		wg      sync.WaitGroup
+	)
+	// Each request signals once when it has either been queued for the
+	// batch or answered by an interceptor.
+	settled := make(chan struct{}, len(reqs))
+	for i, req := range reqs {
+		wg.Add(1)
+		go func(i int, req *proto.Message) {
+			defer wg.Done()
+			var once sync.Once
+			settle := func() { once.Do(func() { settled <- struct{}{} }) }
+			defer settle()
+
+			call := chain(func(ctx context.Context, req *proto.Message) (*proto.Message, error) {
+				mu.Lock()
+				if sent {
+					mu.Unlock()
+					return c.roundTrip(ctx, req)
+				}
+				bc := &batchCall{index: i, req: req, done: make(chan BatchResult, 1)}
+				pending = append(pending, bc)
+				mu.Unlock()
+
+				settle()
+				r := <-bc.done
+				return r.Res, r.Err
+			}, c.interceptors)
+			res, err := call(ctx, req)
+			results[i] = BatchResult{Res: res, Err: err}
+		}(i, req)
+	}
+
+	for range reqs {
+		<-settled
+	}
+	mu.Lock()
+	sent = true
+	calls := pending
+	mu.Unlock()
+
+	// The interceptors run concurrently; restore the order of the requests.
+	sort.Slice(calls, func(i, j int) bool { return calls[i].index < calls[j].index })
+	if len(calls) > 0 {
+		msgs := make([]*proto.Message, len(calls))
+		for i, bc := range calls {
+			msgs[i] = bc.req
+		}
+		for i, r := range c.batch(ctx, msgs) {
+			calls[i].done <- r
+		}
+	}
+	wg.Wait()
+	return results
+}
+
+// A batchCall is a request queued for a batch by Batch.
+type batchCall struct {
+	index int
+	req   *proto.Message
+	done  chan BatchResult
+}
+
+// batch sends reqs as a single batch on one of the pooled connections.
+func (c *Client) batch(ctx context.Context, reqs []*proto.Message) []BatchResult {
+	conn, _, err := c.acquire(ctx)
+	if err != nil {
+		results := make([]BatchResult, len(reqs))
+		for i := range results {
+			results[i].Err = err
+		}
+		return results
+	}
+	defer c.release(conn)
+
+	start := time.Now()
+	var st Stats
+	results := batch(ctx, conn, reqs, &st)
+	for i, req := range reqs {
+		if results[i].Err != nil && c.closed() {
+			results[i].Err = ErrClosed
+		}
+		c.metrics.ObserveRequest(req.Type, results[i].Err, time.Since(start))
+	}
+	c.metrics.ObserveBytes(st.Sent, st.Received)
+	return results
+}
+
+// batch sends reqs on conn and reads the replies concurrently, so that
+// neither side blocks on full socket buffers.
+func batch(ctx context.Context, conn *Conn, reqs []*proto.Message, st *Stats) []BatchResult {
+	results := make([]BatchResult, len(reqs))
+	fail := func(err error) []BatchResult {
+		for i := range results {
+			if results[i].Res == nil && results[i].Err == nil {
+				results[i].Err = err
+			}
+		}
+		conn.Close()
+		return results
+	}
+
+	if err := ctx.Err(); err != nil {
+		return fail(err)
+	}
+	stop := conn.interruptOn(ctx)
+	defer func() {
+		if !stop() {
+			// The connection may have been interrupted at any point.
+			conn.Close()
+		}
+	}()
+
+	// Unlike Send and Receive, don't reconnect in the middle of a batch:
+	// the replies to earlier requests would be lost.
+	nc := conn.netConn()
+	if nc == nil {
+		if err := conn.dial(); err != nil {
+			return fail(err)
+		}
+		if err := ctx.Err(); err != nil {
+			// The connection may have been established after being
+			// interrupted.
+			return fail(err)
+		}
+		nc = conn.netConn()
+	}
+
+	// The first failure aborts the batch; closing the connection unblocks
+	// the other side.
+	var (
+		once    sync.Once
+		failure error
+	)
+	abort := func(err error) {
+		once.Do(func() {
+			failure = err
+			nc.Close()
+		})
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		read := func() (*proto.Message, error) { return proto.Read(nc) }
+		for i := range reqs {
+			res, err := reply(read, st, conn.logHandler)
+			if err != nil && sysdb.ErrorCode(err) != sysdb.CodeRequestFailed {
+				abort(err)
+				return
+			}
+			results[i] = BatchResult{Res: res, Err: err}
+		}
+	}()
+
+	w := proto.NewWriter(nc)
+	for _, req := range reqs {
+		if err := w.WriteMessage(req); err != nil {
+			abort(err)
+			break
+		}
+		st.Sent += 8 + len(req.Raw)
+	}
+	if err := w.Flush(); err != nil {
+		abort(err)
+	}
+	<-done
+
+	if failure != nil {
+		if !stop() {
+			failure = ctx.Err()
+		}
+		return fail(failure)
+	}
+	return results
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
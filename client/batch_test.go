@@ -0,0 +1,221 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sysdb/go/proto"
+	"github.com/sysdb/go/sysdb"
+)
+
+func TestBatch(t *testing.T) {
+	s := newTestServer(t, func(req *proto.Message) []*proto.Message {
+		if string(req.Raw) == "fail" {
+			return []*proto.Message{{Type: proto.ConnectionError, Raw: []byte("failed")}}
+		}
+		return []*proto.Message{
+			{Type: proto.ConnectionLog, Raw: []byte("\x00\x00\x00\x06info")},
+			{Type: proto.ConnectionOK, Raw: req.Raw},
+		}
+	})
+	defer s.close()
+
+	c, err := Connect(s.addr(), "test")
+	if err != nil {
+		t.Fatalf("Connect() = %v", err)
+	}
+	defer c.Close()
+
+	var reqs []*proto.Message
+	for _, q := range []string{"a", "fail", "b", "c"} {
+		reqs = append(reqs, &proto.Message{Type: proto.ConnectionQuery, Raw: []byte(q)})
+	}
+	results := c.Batch(reqs...)
+	if len(results) != len(reqs) {
+		t.Fatalf("Batch() returned %d results; want %d", len(results), len(reqs))
+	}
+	for i, want := range []string{"a", "", "b", "c"} {
+		r := results[i]
+		if want == "" {
+			if r.Err == nil {
+				t.Errorf("Batch()[%d] = %v, <nil>; want <err>", i, r.Res)
+			}
+			continue
+		}
+		if r.Err != nil || string(r.Res.Raw) != want {
+			t.Errorf("Batch()[%d] = %v, %v; want %q, <nil>", i, r.Res, r.Err, want)
+		}
+	}
+
+	// The connection has to be usable afterwards.
+	for i := 0; i < 2*cap(c.conns); i++ {
+		res, err := c.Call(&proto.Message{Type: proto.ConnectionQuery, Raw: []byte("x")})
+		if err != nil || string(res.Raw) != "x" {
+			t.Fatalf("Call() = %v, %v; want x, <nil>", res, err)
+		}
+	}
+}
+
+func TestBatchInterceptors(t *testing.T) {
+	var mu sync.Mutex
+	var queries []string
+	s := newTestServer(t, func(req *proto.Message) []*proto.Message {
+		mu.Lock()
+		defer mu.Unlock()
+		queries = append(queries, string(req.Raw))
+		return []*proto.Message{{Type: proto.ConnectionOK, Raw: req.Raw}}
+	})
+	defer s.close()
+
+	// Pass on "twice" a second time to exercise requests issued after the
+	// batch has been sent.
+	twice := func(next CallFunc) CallFunc {
+		return func(ctx context.Context, req *proto.Message) (*proto.Message, error) {
+			res, err := next(ctx, req)
+			if err == nil && string(req.Raw) == "twice" {
+				return next(ctx, req)
+			}
+			return res, err
+		}
+	}
+	c, err := Connect(s.addr(), "test", WithPoolSize(1), WithQueryPolicy(RejectUnbounded(nil)), WithInterceptor(twice))
+	if err != nil {
+		t.Fatalf("Connect() = %v", err)
+	}
+	defer c.Close()
+
+	var reqs []*proto.Message
+	for _, q := range []string{"a", "LIST hosts", "twice", "LOOKUP hosts"} {
+		reqs = append(reqs, &proto.Message{Type: proto.ConnectionQuery, Raw: []byte(q)})
+	}
+	results := c.Batch(reqs...)
+	if len(results) != len(reqs) {
+		t.Fatalf("Batch() returned %d results; want %d", len(results), len(reqs))
+	}
+	for i, want := range []string{"a", "", "twice", ""} {
+		r := results[i]
+		if want == "" {
+			if sysdb.ErrorCode(r.Err) != sysdb.CodePolicyViolation {
+				t.Errorf("Batch()[%d] = %v, %v; want <policy violation>", i, r.Res, r.Err)
+			}
+			continue
+		}
+		if r.Err != nil || string(r.Res.Raw) != want {
+			t.Errorf("Batch()[%d] = %v, %v; want %q, <nil>", i, r.Res, r.Err, want)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	sort.Strings(queries)
+	if got, want := queries, []string{"a", "twice", "twice"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Batch() sent %q; want %q", got, want)
+	}
+}
+
+func TestBatchLarge(t *testing.T) {
+	s := newTestServer(t, func(req *proto.Message) []*proto.Message {
+		return []*proto.Message{{Type: proto.ConnectionOK, Raw: req.Raw}}
+	})
+	defer s.close()
+
+	c, err := Connect(s.addr(), "test", WithPoolSize(1))
+	if err != nil {
+		t.Fatalf("Connect() = %v", err)
+	}
+	defer c.Close()
+
+	// Requests and replies exceed the socket buffers by far; the server
+	// stops reading requests while its replies are not being read.
+	payload := bytes.Repeat([]byte("x"), 128<<10)
+	reqs := make([]*proto.Message, 128)
+	for i := range reqs {
+		reqs[i] = &proto.Message{Type: proto.ConnectionQuery, Raw: payload}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for i, r := range c.BatchContext(ctx, reqs...) {
+		if r.Err != nil || len(r.Res.Raw) != len(payload) {
+			t.Fatalf("BatchContext()[%d] = %v, %v; want <%d bytes>, <nil>", i, r.Res, r.Err, len(payload))
+		}
+	}
+}
+
+func TestBatchContext(t *testing.T) {
+	unblock := make(chan struct{})
+	defer close(unblock)
+	s := newTestServer(t, func(req *proto.Message) []*proto.Message {
+		if string(req.Raw) == "block" {
+			// Stall the connection until the test is done.
+			<-unblock
+			return nil
+		}
+		return []*proto.Message{{Type: proto.ConnectionOK, Raw: req.Raw}}
+	})
+	defer s.close()
+
+	c, err := Connect(s.addr(), "test", WithPoolSize(1))
+	if err != nil {
+		t.Fatalf("Connect() = %v", err)
+	}
+	defer c.Close()
+
+	var reqs []*proto.Message
+	for _, q := range []string{"a", "block", "b"} {
+		reqs = append(reqs, &proto.Message{Type: proto.ConnectionQuery, Raw: []byte(q)})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	results := c.BatchContext(ctx, reqs...)
+	if r := results[0]; r.Err != nil || string(r.Res.Raw) != "a" {
+		t.Errorf("BatchContext()[0] = %v, %v; want a, <nil>", r.Res, r.Err)
+	}
+	for i := 1; i < len(results); i++ {
+		if r := results[i]; r.Err != context.DeadlineExceeded {
+			t.Errorf("BatchContext()[%d] = %v, %v; want <nil>, %v", i, r.Res, r.Err, context.DeadlineExceeded)
+		}
+	}
+
+	// The interrupted connection is not reused.
+	if res, err := c.Call(&proto.Message{Type: proto.ConnectionQuery, Raw: []byte("x")}); err != nil || string(res.Raw) != "x" {
+		t.Errorf("Call() after canceled batch = %v, %v; want x, <nil>", res, err)
+	}
+
+	// A batch is not sent if the context is done already.
+	results = c.BatchContext(ctx, reqs[0])
+	if r := results[0]; r.Err != context.DeadlineExceeded {
+		t.Errorf("BatchContext(<done>) = %v, %v; want <nil>, %v", r.Res, r.Err, context.DeadlineExceeded)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
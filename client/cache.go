@@ -0,0 +1,239 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package client
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sysdb/go/proto"
+)
+
+// A Cache memoizes the results of LIST, LOOKUP, and FETCH queries for a
+// limited time. This avoids hitting the server with the same query over and
+// over again, for example, when many dashboards refresh concurrently. The
+// cache is installed using WithCache:
+//
+//	cache := client.NewCache(10 * time.Second)
+//	c, err := client.Connect(addr, user, client.WithCache(cache))
+//
+// Results are keyed by the normalized query text: white-space is collapsed,
+// keywords are case-insensitive, and a trailing semicolon is ignored. Only
+// queries consisting of a single statement are cached, and failed queries
+// are never cached. Concurrent misses of the same query are coalesced into
+// a single request to the server. A Cache may be shared between clients
+// connected to the same server.
+type Cache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	calls   map[string]*cacheCall
+	gen     uint64
+	swept   time.Time
+}
+
+type cacheEntry struct {
+	res     proto.Message
+	expires time.Time
+}
+
+// A cacheCall is a query in flight which concurrent misses wait for.
+type cacheCall struct {
+	done chan struct{}
+	// gen is the generation of the cache when the query was sent. Results
+	// of queries sent before invalidating the cache are not stored.
+	gen uint64
+
+	// res and err are set before closing done.
+	res *proto.Message
+	err error
+}
+
+// cacheNow returns the current time; it may be overridden for testing.
+var cacheNow = time.Now
+
+// NewCache returns an empty cache keeping results for the specified time.
+func NewCache(ttl time.Duration) *Cache {
+	return &Cache{ttl: ttl, entries: make(map[string]cacheEntry), calls: make(map[string]*cacheCall)}
+}
+
+// WithCache serves queries from the cache c if possible and stores the
+// results of all other LIST, LOOKUP, and FETCH queries in it.
+func WithCache(c *Cache) Option {
+	return WithInterceptor(c.intercept)
+}
+
+func (c *Cache) intercept(next CallFunc) CallFunc {
+	return func(ctx context.Context, req *proto.Message) (*proto.Message, error) {
+		if req.Type != proto.ConnectionQuery {
+			return next(ctx, req)
+		}
+		key, ok := cacheKey(string(req.Raw))
+		if !ok {
+			return next(ctx, req)
+		}
+		res, call, wait := c.get(key)
+		if res != nil {
+			return res, nil
+		}
+		if wait {
+			select {
+			case <-call.done:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			if call.err != nil {
+				// The error may be specific to the other caller, for
+				// example, if its context is done; retry independently.
+				return next(ctx, req)
+			}
+			return copyMessage(call.res), nil
+		}
+
+		res, err := next(ctx, req)
+		c.finish(key, call, res, err)
+		return res, err
+	}
+}
+
+// get returns a copy of the cached result of key. On a miss, it returns the
+// call in flight for key and true, or registers a new call which the caller
+// has to complete using finish and false.
+func (c *Cache) get(key string) (*proto.Message, *cacheCall, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		if cacheNow().Before(e.expires) {
+			return copyMessage(&e.res), nil, false
+		}
+		delete(c.entries, key)
+	}
+	if call, ok := c.calls[key]; ok {
+		return nil, call, true
+	}
+	call := &cacheCall{done: make(chan struct{}), gen: c.gen}
+	c.calls[key] = call
+	return nil, call, false
+}
+
+// finish completes the call for key, storing successful results in the cache
+// and passing them on to all waiting callers.
+func (c *Cache) finish(key string, call *cacheCall, res *proto.Message, err error) {
+	if err == nil {
+		call.res = copyMessage(res)
+	}
+	call.err = err
+
+	c.mu.Lock()
+	if c.calls[key] == call {
+		delete(c.calls, key)
+	}
+	if err == nil && res.Type == proto.ConnectionData && call.gen == c.gen {
+		c.put(key, call.res)
+	}
+	c.mu.Unlock()
+	close(call.done)
+}
+
+// put stores res in the cache. c.mu must be held.
+func (c *Cache) put(key string, res *proto.Message) {
+	now := cacheNow()
+	// Drop expired entries once per TTL to bound the size of the cache.
+	if now.Sub(c.swept) >= c.ttl {
+		for k, e := range c.entries {
+			if !now.Before(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		c.swept = now
+	}
+	c.entries[key] = cacheEntry{res: *copyMessage(res), expires: now.Add(c.ttl)}
+}
+
+// Invalidate removes the result of the query q from the cache.
+func (c *Cache) Invalidate(q string) {
+	key, ok := cacheKey(q)
+	if !ok {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+	delete(c.calls, key)
+	c.gen++
+}
+
+// InvalidateAll removes all results from the cache.
+func (c *Cache) InvalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]cacheEntry)
+	c.calls = make(map[string]*cacheCall)
+	c.gen++
+}
+
+// Len returns the number of results in the cache, including expired ones
+// which have not been removed yet.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// copyMessage returns a deep copy of m such that cached replies are not
+// affected by modifications of the caller.
+func copyMessage(m *proto.Message) *proto.Message {
+	return &proto.Message{Type: m.Type, Raw: append([]byte(nil), m.Raw...)}
+}
+
+// cacheKey returns the normalized text of the query q and whether its result
+// may be cached. Only single LIST, LOOKUP, and FETCH statements are cached.
+func cacheKey(q string) (string, bool) {
+	stmts, err := proto.SplitStatements(q)
+	if err != nil || len(stmts) != 1 {
+		return "", false
+	}
+	fields, err := proto.Fields(stmts[0])
+	if err != nil || len(fields) == 0 {
+		return "", false
+	}
+	for i, f := range fields {
+		// Keywords are case-insensitive while string literals are not.
+		if !strings.Contains(f, "'") {
+			fields[i] = strings.ToUpper(f)
+		}
+	}
+	switch fields[0] {
+	case "LIST", "LOOKUP", "FETCH":
+		return strings.Join(fields, " "), true
+	}
+	return "", false
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
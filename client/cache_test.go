@@ -0,0 +1,200 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package client
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sysdb/go/proto"
+)
+
+func TestCacheKey(t *testing.T) {
+	for _, test := range []struct {
+		q   string
+		key string
+		ok  bool
+	}{
+		{"LIST hosts", "LIST HOSTS", true},
+		{"  list\thosts ; ", "LIST HOSTS", true},
+		{"LIST hosts;", "LIST HOSTS", true},
+		{"fetch host 'Host A';", "FETCH HOST 'Host A'", true},
+		{"LOOKUP hosts MATCHING name =~ 'a  b'", "LOOKUP HOSTS MATCHING NAME =~ 'a  b'", true},
+		{"TIMESERIES 'h'.'m'", "", false},
+		{"", "", false},
+		{";", "", false},
+		{"FETCH host 'unterminated", "", false},
+		{"FETCH host 'a;b';", "FETCH HOST 'a;b'", true},
+		{"LIST hosts;;", "LIST HOSTS", true},
+		{"LIST hosts; STORE host 'h'", "", false},
+		{"LOOKUP hosts MATCHING name = 'h'; LIST hosts", "", false},
+	} {
+		if key, ok := cacheKey(test.q); key != test.key || ok != test.ok {
+			t.Errorf("cacheKey(%q) = %q, %v; want %q, %v", test.q, key, ok, test.key, test.ok)
+		}
+	}
+}
+
+func TestCache(t *testing.T) {
+	defer func(f func() time.Time) { cacheNow = f }(cacheNow)
+	now := time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC)
+	cacheNow = func() time.Time { return now }
+
+	var requests int32
+	s := newTestServer(t, func(req *proto.Message) []*proto.Message {
+		atomic.AddInt32(&requests, 1)
+		switch string(req.Raw) {
+		case "FETCH host 'missing'":
+			return []*proto.Message{{Type: proto.ConnectionError, Raw: []byte("not found")}}
+		case "TIMESERIES 'h'.'m'":
+			return []*proto.Message{dataMessage(proto.ConnectionTimeseries, `{"start": "2015-01-01 00:00:00 +0000", "end": "2015-01-01 00:00:00 +0000", "data": {}}`)}
+		}
+		return []*proto.Message{dataMessage(proto.ConnectionList, `[{"name": "h1"}]`)}
+	})
+	defer s.close()
+
+	cache := NewCache(time.Minute)
+	c, err := Connect(s.addr(), "test", WithCache(cache), WithPoolSize(1))
+	if err != nil {
+		t.Fatalf("Connect() = %v", err)
+	}
+	defer c.Close()
+
+	for _, test := range []struct {
+		q        string
+		advance  time.Duration
+		requests int32
+		err      bool
+	}{
+		{"LIST hosts", 0, 1, false},
+		{"list  hosts;", 0, 1, false},
+		{"LIST hosts", 59 * time.Second, 1, false},
+		{"LIST hosts", time.Second, 2, false},
+		{"FETCH host 'missing'", 0, 3, true},
+		{"FETCH host 'missing'", 0, 4, true},
+		{"TIMESERIES 'h'.'m'", 0, 5, false},
+		{"TIMESERIES 'h'.'m'", 0, 6, false},
+	} {
+		now = now.Add(test.advance)
+		res, err := c.Query(test.q)
+		got := atomic.LoadInt32(&requests)
+		if (err != nil) != test.err || got != test.requests {
+			t.Errorf("Query(%q) = %v, %v (%d requests); want error = %v (%d requests)",
+				test.q, res, err, got, test.err, test.requests)
+		}
+	}
+
+	if cache.Len() != 1 {
+		t.Errorf("Len() = %d; want 1", cache.Len())
+	}
+	cache.Invalidate("LIST HOSTS;")
+	if _, err := c.Query("LIST hosts"); err != nil || atomic.LoadInt32(&requests) != 7 {
+		t.Errorf("Query(<after Invalidate>) = %v (%d requests); want <nil> (7 requests)", err, requests)
+	}
+	cache.InvalidateAll()
+	if cache.Len() != 0 {
+		t.Errorf("Len(<after InvalidateAll>) = %d; want 0", cache.Len())
+	}
+
+	// Cached results are not affected by modifications of earlier replies.
+	res, err := c.Call(&proto.Message{Type: proto.ConnectionQuery, Raw: []byte("LIST hosts")})
+	if err != nil {
+		t.Fatalf("Call() = %v", err)
+	}
+	for i := range res.Raw {
+		res.Raw[i] = 0
+	}
+	if hosts, err := c.Query("LIST hosts"); err != nil || atomic.LoadInt32(&requests) != 8 {
+		t.Errorf("Query(<cached>) = %v, %v (%d requests); want h1 (8 requests)", hosts, err, requests)
+	}
+}
+
+func TestCacheCoalesce(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	call := NewCache(time.Minute).intercept(func(ctx context.Context, req *proto.Message) (*proto.Message, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return dataMessage(proto.ConnectionList, `[{"name": "h1"}]`), nil
+	})
+
+	var wg sync.WaitGroup
+	results := make([]*proto.Message, 8)
+	errs := make([]error, len(results))
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = call(context.Background(), &proto.Message{Type: proto.ConnectionQuery, Raw: []byte("LIST hosts")})
+		}(i)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("Concurrent misses sent %d queries; want 1", n)
+	}
+	for i, res := range results {
+		if errs[i] != nil || res == nil || string(res.Raw[4:]) != `[{"name": "h1"}]` {
+			t.Errorf("call()[%d] = %v, %v; want <h1>, <nil>", i, res, errs[i])
+		}
+	}
+	// Each caller owns its reply.
+	if &results[0].Raw[0] == &results[1].Raw[0] {
+		t.Errorf("call() returned shared replies")
+	}
+
+	// Waiting callers give up once their context is done.
+	block := make(chan struct{})
+	defer close(block)
+	cache := NewCache(time.Minute)
+	call = cache.intercept(func(ctx context.Context, req *proto.Message) (*proto.Message, error) {
+		<-block
+		return nil, context.Canceled
+	})
+	req := &proto.Message{Type: proto.ConnectionQuery, Raw: []byte("LIST services")}
+	go call(context.Background(), req)
+	for {
+		cache.mu.Lock()
+		n := len(cache.calls)
+		cache.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if res, err := call(ctx, req); err != context.DeadlineExceeded {
+		t.Errorf("call(<waiting>) = %v, %v; want <nil>, %v", res, err, context.DeadlineExceeded)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -52,7 +52,11 @@ or:
 
 or execute queries:
 
-	q, err := client.QueryString("FETCH %s %s", client.Identifier(typ), name)
+	id, err := client.EscapeIdentifier(typ)
+	if err != nil {
+		// handle error
+	}
+	q, err := client.QueryString("FETCH %s %s", id, name)
 	if err != nil {
 		// handle error
 	}
@@ -99,107 +103,409 @@ server:
 		// handle failed query
 	}
 	// ...
+
+Errors returned by this package carry a machine-readable code which may be
+retrieved using sysdb.ErrorCode:
+
+	if _, err := c.Query(q); sysdb.ErrorCode(err) == sysdb.CodeRequestFailed {
+		// handle rejected query
+	}
 */
 package client
 
 import (
-	"encoding/binary"
+	"context"
 	"fmt"
 	"log"
 	"runtime"
+	"sync"
+	"time"
 
 	"github.com/sysdb/go/proto"
+	"github.com/sysdb/go/sysdb"
 )
 
 // A Client is a client for SysDB.
 //
 // A client may be used from multiple goroutines in parallel.
 type Client struct {
-	conns chan *Conn
+	conns   chan *Conn
+	all     []*Conn
+	call    CallFunc
+	metrics Metrics
+
+	// Interceptors wrapping call; see Batch.
+	interceptors []Interceptor
+	// Query policies; see Stream.
+	policies []QueryPolicy
+
+	done      chan struct{}
+	closeOnce sync.Once
+
+	maxLifetime time.Duration
+	maxRequests int
+	maxPoolWait time.Duration
+
+	// Cached server version; see Supports.
+	versionMu sync.Mutex
+	version   *version
 }
 
 // Connect creates a new client connected to a SysDB server instance at the
 // specified address using the specified user.
 //
-// The address may be a IP address or a UNIX domain socket, either prefixed
-// with 'unix:' or specifying an absolute file-system path.
-func Connect(addr, user string) (*Client, error) {
-	c := &Client{conns: make(chan *Conn, 2*runtime.NumCPU())}
+// The address may be a TCP address or a UNIX domain socket. See Dial for the
+// supported address formats and how an empty user name is handled.
+//
+// The user's configuration file (see DefaultConfigFile), if it exists,
+// provides defaults: an empty address or user name is taken from the file and
+// options derived from the file (see Config.Options) are applied before the
+// specified ones. The address defaults to DefaultAddr if the file does not
+// specify one either. A malformed configuration file is ignored if both the
+// address and the user name are specified. Use Config.Connect to ignore the
+// configuration file altogether.
+func Connect(addr, user string, opts ...Option) (*Client, error) {
+	defaults, err := fileConfig()
+	if err != nil {
+		if addr == "" || user == "" {
+			return nil, err
+		}
+		// The file would only provide optional settings.
+		defaults = Config{}
+	}
+	return Config{Addr: addr, User: user}.merge(defaults).Connect(opts...)
+}
+
+// connect creates a new client connected to addr as user.
+func connect(addr, user string, opts []Option) (*Client, error) {
+	o := newOptions(opts)
+	size := o.poolSize
+	if size <= 0 {
+		size = 2 * runtime.NumCPU()
+	}
+	c := &Client{
+		conns:       make(chan *Conn, size),
+		metrics:     o.metrics,
+		done:        make(chan struct{}),
+		maxLifetime: o.maxLifetime,
+		maxRequests: o.maxRequests,
+		maxPoolWait: o.maxPoolWait,
+
+		interceptors: o.interceptors,
+		policies:     o.policies,
+	}
+	c.call = chain(c.roundTrip, c.interceptors)
 
 	for i := 0; i < cap(c.conns); i++ {
-		conn, err := Dial(addr, user)
+		conn, err := Dial(addr, user, opts...)
 		if err != nil {
+			for _, conn := range c.all {
+				conn.Close()
+			}
 			return nil, err
 		}
+		c.all = append(c.all, conn)
 		c.conns <- conn
 	}
+	if o.keepalive > 0 {
+		go c.keepalive(o.keepalive)
+	}
 	return c, nil
 }
 
+// ErrClosed is returned by all requests issued after a client has been
+// closed and by requests aborted by Shutdown.
+var ErrClosed = sysdb.Errorf(sysdb.CodeClosed, "client is closed")
+
 // Close closes a client connection. It may not be further used after calling
 // this function.
 //
 // The function waits for all pending operations to finish.
 func (c *Client) Close() {
-	for i := 0; i < cap(c.conns); i++ {
-		conn := <-c.conns
-		conn.Close()
+	c.Shutdown(context.Background())
+}
+
+// Shutdown closes a client connection. Any new requests fail with ErrClosed
+// while pending requests are allowed to finish until ctx is done. Then, all
+// remaining connections are closed, causing the respective requests to
+// return ErrClosed, and ctx.Err() is returned.
+func (c *Client) Shutdown(ctx context.Context) error {
+	c.closeOnce.Do(func() { close(c.done) })
+
+	// Keep all connections in the pool to allow for repeated calls.
+	var idle []*Conn
+	defer func() {
+		for _, conn := range idle {
+			c.conns <- conn
+		}
+	}()
+
+	for len(idle) < len(c.all) {
+		select {
+		case conn := <-c.conns:
+			conn.kill()
+			idle = append(idle, conn)
+		case <-ctx.Done():
+			for _, conn := range c.all {
+				conn.kill()
+			}
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// closed reports whether the client has been closed.
+func (c *Client) closed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
 	}
-	close(c.conns)
-	c.conns = nil
 }
 
 // Call sends the specified request to the server and waits for its reply. It
 // blocks until the full reply has been received.
+//
+// The request is passed through all interceptors registered with the client.
+//
+// The returned message is owned by the caller. It may have been obtained
+// from the message pool, so the caller may return it using
+// proto.ReleaseMessage once it is no longer used; doing so is optional.
 func (c *Client) Call(req *proto.Message) (*proto.Message, error) {
-	conn := <-c.conns
-	defer func() { c.conns <- conn }()
+	return c.CallContext(context.Background(), req)
+}
 
-	err := conn.Send(req)
+// CallContext is like Call but passes the specified context to all
+// interceptors. The context may carry a Stats object (see WithStats).
+//
+// If ctx is done before the reply has been received, the request is aborted
+// and ctx.Err() is returned. The affected connection is closed and replaced
+// to make sure the outstanding reply does not interfere with later requests.
+func (c *Client) CallContext(ctx context.Context, req *proto.Message) (*proto.Message, error) {
+	return c.call(ctx, req)
+}
+
+// roundTrip sends a request on one of the pooled connections and waits for
+// its reply.
+func (c *Client) roundTrip(ctx context.Context, req *proto.Message) (*proto.Message, error) {
+	st := statsFromContext(ctx)
+
+	conn, wait, err := c.acquire(ctx)
+	st.PoolWait = wait
 	if err != nil {
 		return nil, err
 	}
+	defer c.release(conn)
+
+	start := time.Now()
+	res, err := exchange(ctx, conn, req, st)
+	if err != nil && c.closed() {
+		err = ErrClosed
+	}
+	c.metrics.ObserveRequest(req.Type, err, time.Since(start))
+	c.metrics.ObserveBytes(st.Sent, st.Received)
+	if !st.query {
+		observeStats(c.metrics, req.Type, st)
+	}
+	return res, err
+}
+
+// A PoolExhaustedError is returned if no pooled connection became available
+// in time (see WithMaxPoolWait). Its code is sysdb.CodeExhausted.
+type PoolExhaustedError struct {
+	// Wait is the time spent waiting for a connection.
+	Wait time.Duration
+}
+
+var errPoolExhausted = sysdb.Errorf(sysdb.CodeExhausted, "connection pool exhausted")
+
+// Error implements the error interface.
+func (e *PoolExhaustedError) Error() string {
+	return fmt.Sprintf("connection pool exhausted after waiting %v", e.Wait)
+}
+
+// Unwrap returns an error carrying the code sysdb.CodeExhausted.
+func (e *PoolExhaustedError) Unwrap() error { return errPoolExhausted }
 
+// acquire takes a connection from the pool and returns it along with the
+// time spent waiting for it. Connections exceeding their maximum lifetime or
+// number of requests are closed; they will reconnect on first use. It fails
+// if ctx is done or the maximum wait time is exceeded before a connection
+// becomes available.
+func (c *Client) acquire(ctx context.Context) (*Conn, time.Duration, error) {
+	start := time.Now()
+	var conn *Conn
+	var err error
+	select {
+	case conn = <-c.conns:
+	default:
+		var timeout <-chan time.Time
+		if c.maxPoolWait == 0 {
+			err = &PoolExhaustedError{}
+			break
+		} else if c.maxPoolWait > 0 {
+			t := time.NewTimer(c.maxPoolWait)
+			defer t.Stop()
+			timeout = t.C
+		}
+
+		select {
+		case conn = <-c.conns:
+		case <-c.done:
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-timeout:
+			err = &PoolExhaustedError{Wait: time.Since(start)}
+		}
+	}
+	wait := time.Since(start)
+	c.metrics.ObservePoolWait(wait)
+	if err != nil {
+		return nil, wait, err
+	}
+
+	if c.closed() {
+		if conn != nil {
+			c.conns <- conn
+		}
+		return nil, wait, ErrClosed
+	}
+
+	if conn.netConn() != nil && ((c.maxLifetime > 0 && time.Since(conn.established) >= c.maxLifetime) ||
+		(c.maxRequests > 0 && conn.requests >= c.maxRequests)) {
+		conn.Close()
+	}
+	return conn, wait, nil
+}
+
+// release returns a connection to the pool.
+func (c *Client) release(conn *Conn) {
+	conn.requests++
+	conn.lastUsed = time.Now()
+	c.conns <- conn
+}
+
+// exchange sends a request on conn and waits for its reply, skipping any
+// log messages. It records the number of bytes transferred and the time
+// spent in st.
+//
+// If ctx is done before the reply has been received, the request is aborted
+// and ctx.Err() is returned. The connection is closed in that case, so the
+// outstanding reply will never be read by any other request; it reconnects
+// on next use.
+func exchange(ctx context.Context, conn *Conn, req *proto.Message, st *Stats) (res *proto.Message, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	stop := conn.interruptOn(ctx)
+	defer func() {
+		if !stop() {
+			// The connection may have been interrupted at any point.
+			conn.Close()
+			if err != nil {
+				res, err = nil, ctx.Err()
+			}
+		}
+	}()
+
+	start := time.Now()
+	if err := conn.Send(req); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		// Send may have reconnected after being interrupted.
+		return nil, err
+	}
+	sent := time.Now()
+	st.Write = sent.Sub(start)
+	st.Sent += 8 + len(req.Raw)
+
+	var first time.Time
+	res, err = reply(func() (*proto.Message, error) { return conn.receive(&first, false) }, st, conn.logHandler)
+	if !first.IsZero() {
+		st.ServerWait = first.Sub(sent)
+		st.Read = time.Since(first)
+	}
+	return res, err
+}
+
+// reply reads messages using read until a reply is received, passing any log
+// messages to h. Chunked DATA replies are merged into a single DATA message.
+// It records the number of bytes read in st.
+func reply(read func() (*proto.Message, error), st *Stats, h LogHandler) (*proto.Message, error) {
+	var chunks []*proto.Message
+	for {
+		res, err := next(read, st, h)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case res.Type == proto.ConnectionDataChunk:
+			chunks = append(chunks, res)
+			continue
+		case res.Type == proto.ConnectionOK && len(chunks) > 0:
+			proto.ReleaseMessage(res)
+			defer func() {
+				for _, c := range chunks {
+					proto.ReleaseMessage(c)
+				}
+			}()
+			return proto.MergeChunks(chunks)
+		}
+		return res, nil
+	}
+}
+
+// next reads messages using read until a message other than a log message
+// is received, passing any log messages to h. Error replies are returned as
+// errors. It records the number of bytes read in st.
+func next(read func() (*proto.Message, error), st *Stats, h LogHandler) (*proto.Message, error) {
 	for {
-		res, err := conn.Receive()
+		res, err := read()
+		if err == nil {
+			st.Received += 8 + len(res.Raw)
+			err = proto.Validate(res)
+		}
 		switch {
 		case err != nil:
 			return nil, err
 		case res.Type == proto.ConnectionError:
-			return nil, fmt.Errorf("request failed: %s", string(res.Raw))
+			err = sysdb.Errorf(sysdb.CodeRequestFailed, "request failed: %s", string(res.Raw))
+			proto.ReleaseMessage(res)
+			return nil, err
 		case res.Type != proto.ConnectionLog:
 			return res, err
 		}
 
-		if len(res.Raw) > 4 {
-			log.Println(string(res.Raw[4:]))
+		if l, err := proto.DecodeLog(res); err == nil {
+			h(l.Priority, l.Message)
 		}
+		proto.ReleaseMessage(res)
 	}
+}
+
+// A LogHandler handles log messages sent by the server.
+type LogHandler func(prio sysdb.LogPriority, msg string)
 
-	// Not reached; needed for Go1 compatibility.
-	return nil, nil
+// logMessage is the default LogHandler writing messages to the standard
+// logger.
+func logMessage(prio sysdb.LogPriority, msg string) {
+	log.Printf("[%s] %s", prio, msg)
 }
 
 // ServerVersion queries and returns the version of the remote server.
 func (c *Client) ServerVersion() (major, minor, patch int, extra string, err error) {
 	res, err := c.Call(&proto.Message{Type: proto.ConnectionServerVersion})
-	if err != nil || res.Type != proto.ConnectionOK {
-		if err == nil {
-			err = fmt.Errorf("SERVER_VERSION command failed with status %d", res.Type)
-		}
+	if err != nil {
 		return 0, 0, 0, "", err
 	}
-	if len(res.Raw) < 4 {
-		return 0, 0, 0, "", fmt.Errorf("SERVER_VERSION reply is too short")
-	}
-	version := int(binary.BigEndian.Uint32(res.Raw[:4]))
-	major = version / 10000
-	minor = version/100 - 100*major
-	patch = version - 10000*major - 100*minor
-	if len(res.Raw) > 4 {
-		extra = string(res.Raw[4:])
+	v, err := proto.DecodeVersion(res)
+	if err != nil {
+		return 0, 0, 0, "", err
 	}
-	return major, minor, patch, extra, nil
+	return v.Major, v.Minor, v.Patch, v.Extra, nil
 }
 
 // vim: set tw=78 sw=4 sw=4 noexpandtab :
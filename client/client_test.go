@@ -0,0 +1,290 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sysdb/go/proto"
+	"github.com/sysdb/go/sysdb"
+)
+
+func TestRecycling(t *testing.T) {
+	s := newTestServer(t, func(req *proto.Message) []*proto.Message {
+		return []*proto.Message{{Type: proto.ConnectionOK}}
+	})
+	defer s.close()
+
+	for _, test := range []struct {
+		opt  Option
+		wait time.Duration
+		// Expected number of sessions per pooled connection after
+		// using each connection twice.
+		expected int32
+	}{
+		{WithMaxRequests(1), 0, 2},
+		{WithMaxRequests(2), 0, 1},
+		{WithMaxLifetime(100 * time.Millisecond), 150 * time.Millisecond, 2},
+		{WithMaxLifetime(time.Hour), 0, 1},
+	} {
+		atomic.StoreInt32(&s.startups, 0)
+		c, err := Connect(s.addr(), "test", test.opt)
+		if err != nil {
+			t.Fatalf("Connect() = %v", err)
+		}
+		n := cap(c.conns)
+		for i := 0; i < 2*n; i++ {
+			if i == n {
+				time.Sleep(test.wait)
+			}
+			if _, err := c.Call(&proto.Message{Type: proto.ConnectionPing}); err != nil {
+				t.Fatalf("Call() = %v", err)
+			}
+		}
+		c.Close()
+
+		if got := atomic.LoadInt32(&s.startups); got != test.expected*int32(n) {
+			t.Errorf("got %d sessions for %d connections; want %d",
+				got, n, test.expected*int32(n))
+		}
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	s := newTestServer(t, func(req *proto.Message) []*proto.Message {
+		if string(req.Raw) == "hang" {
+			return nil
+		}
+		return []*proto.Message{{Type: proto.ConnectionOK}}
+	})
+	defer s.close()
+
+	c, err := Connect(s.addr(), "test")
+	if err != nil {
+		t.Fatalf("Connect() = %v", err)
+	}
+
+	errs := make(chan error)
+	go func() {
+		_, err := c.Call(&proto.Message{Type: proto.ConnectionQuery, Raw: []byte("hang")})
+		errs <- err
+	}()
+	// Wait for the request to be in flight.
+	for len(c.conns) == cap(c.conns) {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := c.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Shutdown() = %v; want %v", err, context.DeadlineExceeded)
+	}
+	if err := <-errs; err != ErrClosed {
+		t.Errorf("Call(<pending>) = %v; want %v", err, ErrClosed)
+	}
+	if _, err := c.Call(&proto.Message{Type: proto.ConnectionPing}); err != ErrClosed {
+		t.Errorf("Call(<after shutdown>) = %v; want %v", err, ErrClosed)
+	}
+	if err := c.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown(<again>) = %v; want <nil>", err)
+	}
+	c.Close()
+}
+
+func TestCancel(t *testing.T) {
+	release := make(chan struct{})
+	s := newTestServer(t, func(req *proto.Message) []*proto.Message {
+		if string(req.Raw) == "slow" {
+			<-release
+		}
+		return []*proto.Message{{Type: proto.ConnectionOK, Raw: req.Raw}}
+	})
+	defer s.close()
+
+	c, err := Connect(s.addr(), "test", WithPoolSize(1))
+	if err != nil {
+		t.Fatalf("Connect() = %v", err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	res, err := c.CallContext(ctx, &proto.Message{Type: proto.ConnectionQuery, Raw: []byte("slow")})
+	if err != context.DeadlineExceeded {
+		t.Errorf("CallContext(<timeout>) = %v, %v; want <nil>, %v", res, err, context.DeadlineExceeded)
+	}
+	// Let the server send the stale reply.
+	close(release)
+
+	// The next request must not receive the reply to the aborted one.
+	res, err = c.Call(&proto.Message{Type: proto.ConnectionQuery, Raw: []byte("fast")})
+	if err != nil || string(res.Raw) != "fast" {
+		t.Errorf("Call(<after cancellation>) = %v, %v; want reply \"fast\"", res, err)
+	}
+	if n := atomic.LoadInt32(&s.startups); n != 2 {
+		t.Errorf("Cancelled connection was not replaced: %d startups; want 2", n)
+	}
+
+	cancel()
+	if res, err := c.CallContext(ctx, &proto.Message{Type: proto.ConnectionPing}); err == nil {
+		t.Errorf("CallContext(<cancelled>) = %v, <nil>; want error", res)
+	}
+}
+
+func TestCancelReuse(t *testing.T) {
+	s := newTestServer(t, func(req *proto.Message) []*proto.Message {
+		return []*proto.Message{{Type: proto.ConnectionOK, Raw: req.Raw}}
+	})
+	defer s.close()
+
+	c, err := Connect(s.addr(), "test", WithPoolSize(1))
+	if err != nil {
+		t.Fatalf("Connect() = %v", err)
+	}
+	defer c.Close()
+
+	// Cancel requests while they are in flight and reuse the (single)
+	// connection right away. A late interruption of the cancelled request
+	// must not affect the next one.
+	for i := 0; i < 200; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		go cancel()
+		if i%2 == 0 {
+			c.CallContext(ctx, &proto.Message{Type: proto.ConnectionQuery, Raw: []byte("cancelled")})
+		} else if st, err := c.Stream(ctx, "cancelled"); err == nil {
+			for st.Next() {
+			}
+			st.Close()
+		}
+		cancel()
+
+		res, err := c.Call(&proto.Message{Type: proto.ConnectionQuery, Raw: []byte("next")})
+		if err != nil || string(res.Raw) != "next" {
+			t.Fatalf("Call(<after cancellation %d>) = %v, %v; want reply \"next\"", i, res, err)
+		}
+	}
+}
+
+func TestPoolWait(t *testing.T) {
+	release := make(chan struct{})
+	s := newTestServer(t, func(req *proto.Message) []*proto.Message {
+		if string(req.Raw) == "slow" {
+			<-release
+		}
+		return []*proto.Message{{Type: proto.ConnectionOK}}
+	})
+	defer s.close()
+	defer close(release)
+
+	for _, test := range []struct {
+		opts    []Option
+		timeout time.Duration
+		check   func(error) bool
+	}{
+		{nil, 20 * time.Millisecond, func(err error) bool { return err == context.DeadlineExceeded }},
+		{[]Option{WithMaxPoolWait(20 * time.Millisecond)}, time.Second, func(err error) bool {
+			var e *PoolExhaustedError
+			return errors.As(err, &e) && e.Wait >= 20*time.Millisecond && sysdb.ErrorCode(err) == sysdb.CodeExhausted
+		}},
+		{[]Option{WithMaxPoolWait(0)}, time.Second, func(err error) bool {
+			return sysdb.ErrorCode(err) == sysdb.CodeExhausted
+		}},
+	} {
+		c, err := Connect(s.addr(), "test", append(test.opts, WithPoolSize(1))...)
+		if err != nil {
+			t.Fatalf("Connect() = %v", err)
+		}
+
+		// Occupy the only connection.
+		go c.Call(&proto.Message{Type: proto.ConnectionQuery, Raw: []byte("slow")})
+		for len(c.conns) > 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), test.timeout)
+		_, err = c.CallContext(ctx, &proto.Message{Type: proto.ConnectionPing})
+		cancel()
+		if !test.check(err) {
+			t.Errorf("CallContext(<pool exhausted>) = %v (%T); want pool wait error", err, err)
+		}
+		c.Shutdown(ctxDone())
+	}
+}
+
+// ctxDone returns a context which is done already.
+func ctxDone() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return ctx
+}
+
+func TestLogHandler(t *testing.T) {
+	s := newTestServer(t, func(req *proto.Message) []*proto.Message {
+		return []*proto.Message{
+			{Type: proto.ConnectionLog, Raw: []byte("\x00\x00\x00\x04careful")},
+			{Type: proto.ConnectionLog, Raw: []byte("\x00\x00\x00\x07details")},
+			{Type: proto.ConnectionOK},
+		}
+	})
+	defer s.close()
+
+	type record struct {
+		prio sysdb.LogPriority
+		msg  string
+	}
+	var got []record
+	c, err := Connect(s.addr(), "test", WithPoolSize(1), WithLogHandler(func(prio sysdb.LogPriority, msg string) {
+		got = append(got, record{prio, msg})
+	}))
+	if err != nil {
+		t.Fatalf("Connect() = %v", err)
+	}
+	defer c.Close()
+
+	if _, err := c.Call(&proto.Message{Type: proto.ConnectionPing}); err != nil {
+		t.Fatalf("Call() = %v", err)
+	}
+	want := []record{{sysdb.LogWarning, "careful"}, {sysdb.LogDebug, "details"}}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("Call() logged %v; want %v", got, want)
+	}
+
+	// A nil handler selects the default one.
+	c, err = Connect(s.addr(), "test", WithPoolSize(1), WithLogHandler(nil))
+	if err != nil {
+		t.Fatalf("Connect(<nil log handler>) = %v", err)
+	}
+	defer c.Close()
+	if _, err := c.Call(&proto.Message{Type: proto.ConnectionPing}); err != nil {
+		t.Errorf("Call(<nil log handler>) = %v", err)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,321 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package clienttest provides an in-memory fake of the SysDB client for
+// testing application code without a SysDB server.
+//
+// A Fake implements client.Interface. Typed requests (FetchHost,
+// FetchService, FetchMetric, and Timeseries) are served from fixtures while
+// queries are answered using canned results keyed by the query string:
+//
+//	f := clienttest.NewFake(sysdb.Host{Name: "h1"})
+//	f.SetResult("LIST hosts", []sysdb.Host{{Name: "h1"}})
+//	var c client.Interface = f
+package clienttest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sysdb/go/client"
+	"github.com/sysdb/go/memstore"
+	"github.com/sysdb/go/proto"
+	"github.com/sysdb/go/sysdb"
+)
+
+// A Fake is an in-memory implementation of client.Interface. It is safe for
+// concurrent use.
+type Fake struct {
+	mu         sync.Mutex
+	store      *memstore.Store
+	timeseries map[[2]string]sysdb.Timeseries
+	results    map[string]result
+	replies    map[proto.Status]*proto.Message
+	queries    []string
+	closed     bool
+}
+
+type result struct {
+	v   interface{}
+	err error
+}
+
+var _ client.Interface = (*Fake)(nil)
+
+// NewFake returns a fake client serving the specified hosts.
+func NewFake(hosts ...sysdb.Host) *Fake {
+	return &Fake{
+		store:      memstore.New(hosts),
+		timeseries: make(map[[2]string]sysdb.Timeseries),
+		results:    make(map[string]result),
+		replies:    make(map[proto.Status]*proto.Message),
+	}
+}
+
+// SetHosts replaces the hosts served by the fake.
+func (f *Fake) SetHosts(hosts ...sysdb.Host) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.store = memstore.New(hosts)
+}
+
+// SetResult sets the result returned for the query q. Query returns v as is
+// while QueryInto and QueryHosts decode its JSON encoding.
+func (f *Fake) SetResult(q string, v interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.results[q] = result{v: v}
+}
+
+// SetError sets the error returned for the query q.
+func (f *Fake) SetError(q string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.results[q] = result{err: err}
+}
+
+// SetTimeseries sets the timeseries of the specified metric. Timeseries
+// returns the data-points within the requested time range.
+func (f *Fake) SetTimeseries(host, metric string, ts sysdb.Timeseries) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.timeseries[[2]string{host, metric}] = ts
+}
+
+// SetReply sets the reply to raw requests of the specified type sent using
+// Call. It is also used by ServerVersion.
+func (f *Fake) SetReply(typ proto.Status, res *proto.Message) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.replies[typ] = res
+}
+
+// Queries returns all queries executed so far in the order of execution.
+func (f *Fake) Queries() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.queries...)
+}
+
+// Close marks the fake as closed. All further requests fail.
+func (f *Fake) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+}
+
+func (f *Fake) check(ctx context.Context) error {
+	if f.closed {
+		return sysdb.Errorf(sysdb.CodeClosed, "client closed")
+	}
+	return ctx.Err()
+}
+
+// Call returns the reply set for requests of the type of req.
+func (f *Fake) Call(req *proto.Message) (*proto.Message, error) {
+	return f.CallContext(context.Background(), req)
+}
+
+// CallContext is like Call but fails if ctx is done.
+func (f *Fake) CallContext(ctx context.Context, req *proto.Message) (*proto.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.check(ctx); err != nil {
+		return nil, err
+	}
+	res, ok := f.replies[req.Type]
+	if !ok {
+		return nil, sysdb.Errorf(sysdb.CodeUnsupported, "no reply set for %s requests", req.Type.CommandString())
+	}
+	if res.Type == proto.ConnectionError {
+		return nil, sysdb.Errorf(sysdb.CodeRequestFailed, "request failed: %s", string(res.Raw))
+	}
+	return res, nil
+}
+
+// query records the query q and returns the result set for it.
+func (f *Fake) query(ctx context.Context, q string) (interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.check(ctx); err != nil {
+		return nil, err
+	}
+	f.queries = append(f.queries, q)
+	res, ok := f.results[q]
+	if !ok {
+		return nil, sysdb.Errorf(sysdb.CodeRequestFailed, "request failed: no result set for query %q", q)
+	}
+	return res.v, res.err
+}
+
+// queryMessage returns the result set for q encoded as a DATA message.
+func (f *Fake) queryMessage(ctx context.Context, q string) (*proto.Message, error) {
+	v, err := f.query(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(proto.ConnectionQuery, v)
+}
+
+// Query returns the result set for q.
+func (f *Fake) Query(q string) (interface{}, error) {
+	return f.query(context.Background(), q)
+}
+
+// QueryContext is like Query but fails if ctx is done.
+func (f *Fake) QueryContext(ctx context.Context, q string) (interface{}, error) {
+	return f.query(ctx, q)
+}
+
+// QueryInto unmarshals the result set for q into v.
+func (f *Fake) QueryInto(q string, v interface{}) error {
+	return f.QueryIntoContext(context.Background(), q, v)
+}
+
+// QueryIntoContext is like QueryInto but fails if ctx is done.
+func (f *Fake) QueryIntoContext(ctx context.Context, q string, v interface{}) error {
+	res, err := f.queryMessage(ctx, q)
+	if err != nil {
+		return err
+	}
+	if err := proto.Unmarshal(res, v); err != nil {
+		return sysdb.Errorf(sysdb.CodeMalformedMessage, "failed to unmarshal response: %v", err)
+	}
+	return nil
+}
+
+// QueryHosts passes the hosts of the result set for q to fn. The result
+// must be a list of hosts.
+func (f *Fake) QueryHosts(q string, fn func(*sysdb.Host) error) error {
+	return f.QueryHostsContext(context.Background(), q, fn)
+}
+
+// QueryHostsContext is like QueryHosts but fails if ctx is done.
+func (f *Fake) QueryHostsContext(ctx context.Context, q string, fn func(*sysdb.Host) error) error {
+	res, err := f.queryMessage(ctx, q)
+	if err != nil {
+		return err
+	}
+	return proto.DecodeHosts(res, fn)
+}
+
+// host returns a copy of the named host.
+func (f *Fake) host(ctx context.Context, name string) (*sysdb.Host, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.check(ctx); err != nil {
+		return nil, err
+	}
+	h, ok := f.store.Host(name)
+	if !ok {
+		return nil, sysdb.Errorf(sysdb.CodeRequestFailed, "request failed: host %s not found", name)
+	}
+	h = h.Clone()
+	return &h, nil
+}
+
+// FetchHost returns the named host including all of its children.
+func (f *Fake) FetchHost(ctx context.Context, name string) (*sysdb.Host, error) {
+	return f.host(ctx, name)
+}
+
+// FetchService returns the named service of the specified host.
+func (f *Fake) FetchService(ctx context.Context, host, name string) (*sysdb.Service, error) {
+	h, err := f.host(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	s := h.Service(name)
+	if s == nil {
+		return nil, sysdb.Errorf(sysdb.CodeRequestFailed, "request failed: service %s.%s not found", host, name)
+	}
+	return s, nil
+}
+
+// FetchMetric returns the named metric of the specified host.
+func (f *Fake) FetchMetric(ctx context.Context, host, name string) (*sysdb.Metric, error) {
+	h, err := f.host(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	m := h.Metric(name)
+	if m == nil {
+		return nil, sysdb.Errorf(sysdb.CodeRequestFailed, "request failed: metric %s.%s not found", host, name)
+	}
+	return m, nil
+}
+
+// Timeseries returns the data-points of the timeseries set for the
+// specified metric within the time range [start, end].
+func (f *Fake) Timeseries(host, metric string, start, end time.Time) (*sysdb.Timeseries, error) {
+	return f.TimeseriesContext(context.Background(), host, metric, start, end)
+}
+
+// TimeseriesContext is like Timeseries but fails if ctx is done.
+func (f *Fake) TimeseriesContext(ctx context.Context, host, metric string, start, end time.Time) (*sysdb.Timeseries, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.check(ctx); err != nil {
+		return nil, err
+	}
+	ts, ok := f.timeseries[[2]string{host, metric}]
+	if !ok {
+		return nil, sysdb.Errorf(sysdb.CodeRequestFailed, "request failed: timeseries %s.%s not found", host, metric)
+	}
+
+	res := &sysdb.Timeseries{
+		Start: sysdb.Time(start),
+		End:   sysdb.Time(end),
+		Data:  make(map[string][]sysdb.DataPoint, len(ts.Data)),
+	}
+	for src, points := range ts.Data {
+		data := []sysdb.DataPoint{}
+		for _, p := range points {
+			t := time.Time(p.Timestamp)
+			if !t.Before(start) && !t.After(end) {
+				data = append(data, p)
+			}
+		}
+		res.Data[src] = data
+	}
+	return res, nil
+}
+
+// ServerVersion returns the version encoded in the reply set for
+// SERVER_VERSION requests.
+func (f *Fake) ServerVersion() (major, minor, patch int, extra string, err error) {
+	res, err := f.Call(&proto.Message{Type: proto.ConnectionServerVersion})
+	if err != nil {
+		return 0, 0, 0, "", err
+	}
+	v, err := proto.DecodeVersion(res)
+	if err != nil {
+		return 0, 0, 0, "", err
+	}
+	return v.Major, v.Minor, v.Patch, v.Extra, nil
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,161 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package clienttest
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sysdb/go/proto"
+	"github.com/sysdb/go/sysdb"
+)
+
+func TestFake(t *testing.T) {
+	f := NewFake(sysdb.Host{
+		Name:     "h1",
+		Services: []sysdb.Service{{Name: "s1"}},
+		Metrics:  []sysdb.Metric{{Name: "m1", Timeseries: true}},
+	})
+	f.SetResult("LIST hosts", []sysdb.Host{{Name: "h1"}, {Name: "h2"}})
+	errFailed := errors.New("failed")
+	f.SetError("LIST services", errFailed)
+	ctx := context.Background()
+
+	if h, err := f.FetchHost(ctx, "H1"); err != nil || h.Name != "h1" || len(h.Services) != 1 {
+		t.Errorf("FetchHost(H1) = %v, %v; want h1, <nil>", h, err)
+	} else {
+		// the fixtures must not be modified through returned objects
+		h.Services[0].Name = "x"
+	}
+	if s, err := f.FetchService(ctx, "h1", "s1"); err != nil || s.Name != "s1" {
+		t.Errorf("FetchService(h1, s1) = %v, %v; want s1, <nil>", s, err)
+	}
+	if m, err := f.FetchMetric(ctx, "h1", "m1"); err != nil || m.Name != "m1" {
+		t.Errorf("FetchMetric(h1, m1) = %v, %v; want m1, <nil>", m, err)
+	}
+	for _, fetch := range []func() error{
+		func() error { _, err := f.FetchHost(ctx, "h2"); return err },
+		func() error { _, err := f.FetchService(ctx, "h1", "s2"); return err },
+		func() error { _, err := f.FetchMetric(ctx, "h2", "m1"); return err },
+	} {
+		if err := fetch(); sysdb.ErrorCode(err) != sysdb.CodeRequestFailed {
+			t.Errorf("Fetch(<unknown>) = %v; want code %s", err, sysdb.CodeRequestFailed)
+		}
+	}
+
+	if v, err := f.Query("LIST hosts"); err != nil || len(v.([]sysdb.Host)) != 2 {
+		t.Errorf("Query(LIST hosts) = %v, %v; want two hosts, <nil>", v, err)
+	}
+	var hosts []sysdb.Host
+	if err := f.QueryInto("LIST hosts", &hosts); err != nil || len(hosts) != 2 || hosts[1].Name != "h2" {
+		t.Errorf("QueryInto(LIST hosts) = %v (%v); want <nil> (h1, h2)", err, hosts)
+	}
+	var names []string
+	err := f.QueryHosts("LIST hosts", func(h *sysdb.Host) error {
+		names = append(names, h.Name)
+		return nil
+	})
+	if err != nil || !reflect.DeepEqual(names, []string{"h1", "h2"}) {
+		t.Errorf("QueryHosts(LIST hosts) = %v (%v); want <nil> ([h1 h2])", err, names)
+	}
+	if _, err := f.Query("LIST services"); err != errFailed {
+		t.Errorf("Query(LIST services) = %v; want %v", err, errFailed)
+	}
+	if _, err := f.Query("LIST metrics"); sysdb.ErrorCode(err) != sysdb.CodeRequestFailed {
+		t.Errorf("Query(<unknown>) = %v; want code %s", err, sysdb.CodeRequestFailed)
+	}
+
+	want := []string{"LIST hosts", "LIST hosts", "LIST hosts", "LIST services", "LIST metrics"}
+	if got := f.Queries(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Queries() = %q; want %q", got, want)
+	}
+
+	f.SetHosts(sysdb.Host{Name: "h2"})
+	if _, err := f.FetchHost(ctx, "h1"); sysdb.ErrorCode(err) != sysdb.CodeRequestFailed {
+		t.Errorf("FetchHost(<removed>) = %v; want code %s", err, sysdb.CodeRequestFailed)
+	}
+	if h, err := f.FetchHost(ctx, "h2"); err != nil || h.Name != "h2" {
+		t.Errorf("FetchHost(<added>) = %v, %v; want h2, <nil>", h, err)
+	}
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := f.QueryContext(cctx, "LIST hosts"); err != context.Canceled {
+		t.Errorf("QueryContext(<canceled>) = %v; want %v", err, context.Canceled)
+	}
+
+	f.Close()
+	if _, err := f.FetchHost(ctx, "h1"); sysdb.ErrorCode(err) != sysdb.CodeClosed {
+		t.Errorf("FetchHost(<closed>) = %v; want code %s", err, sysdb.CodeClosed)
+	}
+}
+
+func TestFakeTimeseries(t *testing.T) {
+	base := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	point := func(min int, v float64) sysdb.DataPoint {
+		return sysdb.DataPoint{Timestamp: sysdb.Time(base.Add(time.Duration(min) * time.Minute)), Value: v}
+	}
+
+	f := NewFake()
+	f.SetTimeseries("h1", "m1", sysdb.Timeseries{
+		Data: map[string][]sysdb.DataPoint{"value": {point(0, 1), point(1, 2), point(2, 3), point(3, 4)}},
+	})
+	ts, err := f.Timeseries("h1", "m1", base.Add(time.Minute), base.Add(2*time.Minute))
+	if err != nil || !reflect.DeepEqual(ts.Data["value"], []sysdb.DataPoint{point(1, 2), point(2, 3)}) {
+		t.Errorf("Timeseries(h1, m1, 1m, 2m) = %v, %v; want [2 3], <nil>", ts, err)
+	}
+	if _, err := f.Timeseries("h1", "m2", base, base); sysdb.ErrorCode(err) != sysdb.CodeRequestFailed {
+		t.Errorf("Timeseries(<unknown>) = %v; want code %s", err, sysdb.CodeRequestFailed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := f.TimeseriesContext(ctx, "h1", "m1", base, base); err != context.Canceled {
+		t.Errorf("TimeseriesContext(<cancelled>) = %v; want %v", err, context.Canceled)
+	}
+}
+
+func TestFakeCall(t *testing.T) {
+	f := NewFake()
+	if _, _, _, _, err := f.ServerVersion(); sysdb.ErrorCode(err) != sysdb.CodeUnsupported {
+		t.Errorf("ServerVersion() = %v; want code %s", err, sysdb.CodeUnsupported)
+	}
+
+	f.SetReply(proto.ConnectionServerVersion, &proto.Message{Type: proto.ConnectionOK, Raw: []byte("\x00\x00\x27\x11x")})
+	if major, minor, patch, extra, err := f.ServerVersion(); err != nil || major != 1 || minor != 0 || patch != 1 || extra != "x" {
+		t.Errorf("ServerVersion() = %d.%d.%d%s, %v; want 1.0.1x, <nil>", major, minor, patch, extra, err)
+	}
+
+	f.SetReply(proto.ConnectionPing, &proto.Message{Type: proto.ConnectionError, Raw: []byte("down")})
+	if _, err := f.Call(&proto.Message{Type: proto.ConnectionPing}); sysdb.ErrorCode(err) != sysdb.CodeRequestFailed {
+		t.Errorf("Call(PING) = %v; want code %s", err, sysdb.CodeRequestFailed)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
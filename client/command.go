@@ -0,0 +1,118 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package client
+
+import (
+	"context"
+	"strings"
+)
+
+// An ObjectType is the type of objects stored in SysDB.
+type ObjectType string
+
+// Object types supported by SysDB.
+const (
+	HostType    ObjectType = "host"
+	ServiceType ObjectType = "service"
+	MetricType  ObjectType = "metric"
+)
+
+// A Command is a SysQL command. Its arguments are embedded into the query
+// using QueryString, so they are safe to use with untrusted input.
+type Command struct {
+	format string
+	args   []interface{}
+}
+
+// Common commands.
+var (
+	ListHosts    = List(HostType)
+	ListServices = List(ServiceType)
+	ListMetrics  = List(MetricType)
+)
+
+// List returns a command listing all objects of the specified type.
+func List(typ ObjectType) Command {
+	return Command{format: "LIST %ss", args: []interface{}{Identifier(typ)}}
+}
+
+// Fetch returns a command retrieving the named object of the specified type.
+// Services and metrics are identified by the name of their host and their
+// own name, e.g. Fetch(ServiceType, "web1", "nginx").
+func Fetch(typ ObjectType, names ...string) Command {
+	args := []interface{}{Identifier(typ)}
+	for _, n := range names {
+		args = append(args, n)
+	}
+	return Command{
+		format: "FETCH %s " + strings.TrimSuffix(strings.Repeat("%s.", len(names)), "."),
+		args:   args,
+	}
+}
+
+// Lookup returns a command looking up all objects of the specified type
+// matching the specified expression. The expression may include printf
+// string verbs (%s) for each argument as supported by QueryString, e.g.
+//
+//	Lookup(HostType, "attribute[%s] = %s", "architecture", "amd64")
+func Lookup(typ ObjectType, matching string, args ...interface{}) Command {
+	return Command{
+		format: "LOOKUP %ss MATCHING " + matching,
+		args:   append([]interface{}{Identifier(typ)}, args...),
+	}
+}
+
+// Query returns the query string of the command.
+func (cmd Command) Query() (string, error) {
+	return QueryString(cmd.format+";", cmd.args...)
+}
+
+// String returns the query string of the command or a description of the
+// error if the query string cannot be formatted.
+func (cmd Command) String() string {
+	q, err := cmd.Query()
+	if err != nil {
+		return "<invalid command: " + err.Error() + ">"
+	}
+	return q
+}
+
+// Do executes the specified command on the server. See Query for the type of
+// the returned object.
+func (c *Client) Do(cmd Command) (interface{}, error) {
+	return c.DoContext(context.Background(), cmd)
+}
+
+// DoContext is like Do but passes the specified context to all interceptors.
+func (c *Client) DoContext(ctx context.Context, cmd Command) (interface{}, error) {
+	q, err := cmd.Query()
+	if err != nil {
+		return nil, err
+	}
+	return c.QueryContext(ctx, q)
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
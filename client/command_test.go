@@ -0,0 +1,83 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package client
+
+import (
+	"testing"
+
+	"github.com/sysdb/go/proto"
+	"github.com/sysdb/go/sysdb"
+)
+
+func TestCommandQuery(t *testing.T) {
+	for _, test := range []struct {
+		cmd     Command
+		want    string
+		wantErr bool
+	}{
+		{ListHosts, "LIST hosts;", false},
+		{ListServices, "LIST services;", false},
+		{ListMetrics, "LIST metrics;", false},
+		{Fetch(HostType, "h'1"), "FETCH host 'h''1';", false},
+		{Fetch(ServiceType, "h1", "s1"), "FETCH service 'h1'.'s1';", false},
+		{Fetch(MetricType, "h1", "m1"), "FETCH metric 'h1'.'m1';", false},
+		{
+			Lookup(HostType, "attribute[%s] = %s", "architecture", "amd64"),
+			"LOOKUP hosts MATCHING attribute['architecture'] = 'amd64';", false,
+		},
+		{Lookup(HostType, "name = %s"), "", true},
+	} {
+		q, err := test.cmd.Query()
+		if q != test.want || (err != nil) != test.wantErr {
+			t.Errorf("%#v.Query() = %q, %v; want %q (error: %v)", test.cmd, q, err, test.want, test.wantErr)
+		}
+	}
+}
+
+func TestDo(t *testing.T) {
+	var got string
+	s := newTestServer(t, func(req *proto.Message) []*proto.Message {
+		got = string(req.Raw)
+		return []*proto.Message{dataMessage(proto.ConnectionFetch, `{"name": "h1"}`)}
+	})
+	defer s.close()
+
+	c, err := Connect(s.addr(), "test", WithPoolSize(1))
+	if err != nil {
+		t.Fatalf("Connect() = %v", err)
+	}
+	defer c.Close()
+
+	res, err := c.Do(Fetch(HostType, "h1"))
+	if h, ok := res.(*sysdb.Host); err != nil || !ok || h.Name != "h1" {
+		t.Errorf("Do(FETCH host) = %v, %v; want host h1", res, err)
+	}
+	if want := "FETCH host 'h1';"; got != want {
+		t.Errorf("Do(FETCH host) sent %q; want %q", got, want)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,321 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package client
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+// DefaultAddr is the default address of a SysDB server.
+const DefaultAddr = "unix:/var/run/sysdbd.sock"
+
+// A Config describes how to connect to a SysDB server. Its zero value
+// connects to DefaultAddr as the current user.
+type Config struct {
+	// Addr is the address of the server (default: DefaultAddr).
+	Addr string
+	// User is the user name (see Dial for the default).
+	User string
+
+	// TLSCert and TLSKey are the files containing the client certificate
+	// and private key used for TLS connections.
+	TLSCert, TLSKey string
+	// TLSCA is a file containing the certificates of the certificate
+	// authorities used to verify the server. If empty, the system's
+	// certificate pool is used.
+	TLSCA string
+	// TLSServerName overrides the server name used to verify the server's
+	// certificate (see WithTLSServerName).
+	TLSServerName string
+
+	// DialTimeout is the maximum amount of time to wait for a connection
+	// to be established. Zero means no timeout.
+	DialTimeout time.Duration
+
+	// PoolSize is the number of connections maintained by the client (see
+	// WithPoolSize).
+	PoolSize int
+}
+
+// DefaultConfigFile returns the path of the user's client configuration
+// file, usually ~/.config/sysdb/client.conf.
+func DefaultConfigFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", sysdb.Errorf(sysdb.CodeInvalidArgument, "failed to determine configuration directory: %v", err)
+	}
+	return filepath.Join(dir, "sysdb", "client.conf"), nil
+}
+
+// ReadConfigFile reads a client configuration file. Each line of the file
+// specifies a single option and its value, separated by whitespace. Values
+// may be enclosed in double quotes. Empty lines and lines starting with '#'
+// are ignored. For example:
+//
+//	# connect to the central SysDB instance
+//	Address       "sysdb.example.com:12345"
+//	User          "monitoring"
+//	TLSCert       "/etc/sysdb/client.pem"
+//	TLSKey        "/etc/sysdb/client.key"
+//	TLSCA         "/etc/ssl/certs/ca-certificates.crt"
+//	TLSServerName "sysdb.example.com"
+//	DialTimeout   5s
+//	PoolSize      4
+//
+// Option names are case-insensitive.
+func ReadConfigFile(path string) (Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Config{}, err
+	}
+	defer f.Close()
+	cfg, err := parseConfig(f)
+	if err != nil {
+		return Config{}, sysdb.Errorf(sysdb.CodeInvalidFormat, "%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func parseConfig(r io.Reader) (Config, error) {
+	var cfg Config
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		key, val := line, ""
+		if i := strings.IndexAny(line, " \t"); i >= 0 {
+			key, val = line[:i], strings.TrimSpace(line[i+1:])
+		}
+		if len(val) >= 2 && val[0] == '"' {
+			v, err := strconv.Unquote(val)
+			if err != nil {
+				return Config{}, sysdb.Errorf(sysdb.CodeInvalidFormat, "line %d: invalid value %s", n, val)
+			}
+			val = v
+		}
+
+		var err error
+		switch strings.ToLower(key) {
+		case "address":
+			cfg.Addr = val
+		case "user":
+			cfg.User = val
+		case "tlscert":
+			cfg.TLSCert = val
+		case "tlskey":
+			cfg.TLSKey = val
+		case "tlsca":
+			cfg.TLSCA = val
+		case "tlsservername":
+			cfg.TLSServerName = val
+		case "dialtimeout":
+			cfg.DialTimeout, err = time.ParseDuration(val)
+		case "poolsize":
+			cfg.PoolSize, err = strconv.Atoi(val)
+		default:
+			return Config{}, sysdb.Errorf(sysdb.CodeInvalidFormat, "line %d: unknown option %q", n, key)
+		}
+		if err != nil {
+			return Config{}, sysdb.Errorf(sysdb.CodeInvalidFormat, "line %d: invalid %s: %v", n, key, err)
+		}
+	}
+	return cfg, s.Err()
+}
+
+// merge returns a copy of cfg with all unset values taken from defaults.
+func (cfg Config) merge(defaults Config) Config {
+	if cfg.Addr == "" {
+		cfg.Addr = defaults.Addr
+	}
+	if cfg.User == "" {
+		cfg.User = defaults.User
+	}
+	if cfg.TLSCert == "" {
+		cfg.TLSCert = defaults.TLSCert
+	}
+	if cfg.TLSKey == "" {
+		cfg.TLSKey = defaults.TLSKey
+	}
+	if cfg.TLSCA == "" {
+		cfg.TLSCA = defaults.TLSCA
+	}
+	if cfg.TLSServerName == "" {
+		cfg.TLSServerName = defaults.TLSServerName
+	}
+	if cfg.DialTimeout == 0 {
+		cfg.DialTimeout = defaults.DialTimeout
+	}
+	if cfg.PoolSize == 0 {
+		cfg.PoolSize = defaults.PoolSize
+	}
+	return cfg
+}
+
+// LoadConfig returns the user's client configuration. Settings are read from
+// the environment (see ConfigFromEnv) and default to the ones specified in
+// the default configuration file (see DefaultConfigFile), if it exists.
+func LoadConfig() (Config, error) {
+	cfg, err := ConfigFromEnv()
+	if err != nil {
+		return Config{}, err
+	}
+	defaults, err := fileConfig()
+	if err != nil {
+		return Config{}, err
+	}
+	return cfg.merge(defaults), nil
+}
+
+// fileConfig reads the default configuration file. A missing file results in
+// an empty configuration.
+func fileConfig() (Config, error) {
+	path, err := DefaultConfigFile()
+	if err != nil {
+		return Config{}, nil
+	}
+	cfg, err := ReadConfigFile(path)
+	if os.IsNotExist(err) {
+		return Config{}, nil
+	}
+	return cfg, err
+}
+
+// ConfigFromEnv returns a configuration based on the following environment
+// variables:
+//
+//	SYSDB_ADDR             the address of the server
+//	SYSDB_USER             the user name
+//	SYSDB_TLS_CERT         the client certificate file
+//	SYSDB_TLS_KEY          the client private key file
+//	SYSDB_TLS_CA           the certificate authorities file
+//	SYSDB_TLS_SERVER_NAME  the expected name of the server (see Config)
+//	SYSDB_DIAL_TIMEOUT     the dial timeout (e.g. 5s; see time.ParseDuration)
+//
+// Unset variables are left empty.
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{
+		Addr:    os.Getenv("SYSDB_ADDR"),
+		User:    os.Getenv("SYSDB_USER"),
+		TLSCert: os.Getenv("SYSDB_TLS_CERT"),
+		TLSKey:  os.Getenv("SYSDB_TLS_KEY"),
+		TLSCA:   os.Getenv("SYSDB_TLS_CA"),
+
+		TLSServerName: os.Getenv("SYSDB_TLS_SERVER_NAME"),
+	}
+	if t := os.Getenv("SYSDB_DIAL_TIMEOUT"); t != "" {
+		d, err := time.ParseDuration(t)
+		if err != nil {
+			return Config{}, sysdb.Errorf(sysdb.CodeInvalidArgument, "invalid SYSDB_DIAL_TIMEOUT: %v", err)
+		}
+		cfg.DialTimeout = d
+	}
+	return cfg, nil
+}
+
+// Options returns the options corresponding to the configuration.
+func (cfg Config) Options() ([]Option, error) {
+	var opts []Option
+	if cfg.PoolSize > 0 {
+		opts = append(opts, WithPoolSize(cfg.PoolSize))
+	}
+	if cfg.DialTimeout > 0 {
+		opts = append(opts, WithDialTimeout(cfg.DialTimeout))
+	}
+	if cfg.TLSCert != "" || cfg.TLSKey != "" || cfg.TLSCA != "" {
+		t, err := cfg.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithTLSConfig(t))
+	}
+	if cfg.TLSServerName != "" {
+		opts = append(opts, WithTLSServerName(cfg.TLSServerName))
+	}
+	return opts, nil
+}
+
+func (cfg Config) tlsConfig() (*tls.Config, error) {
+	t := &tls.Config{}
+	if cfg.TLSCert != "" || cfg.TLSKey != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			return nil, sysdb.Errorf(sysdb.CodeInvalidArgument, "failed to load client certificate: %v", err)
+		}
+		t.Certificates = []tls.Certificate{cert}
+	}
+	if cfg.TLSCA != "" {
+		pem, err := os.ReadFile(cfg.TLSCA)
+		if err != nil {
+			return nil, sysdb.Errorf(sysdb.CodeInvalidArgument, "failed to read CA file: %v", err)
+		}
+		t.RootCAs = x509.NewCertPool()
+		if !t.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, sysdb.Errorf(sysdb.CodeInvalidArgument, "no certificates found in %s", cfg.TLSCA)
+		}
+	}
+	return t, nil
+}
+
+// Connect connects to the server described by the configuration. Additional
+// options are applied after the ones derived from the configuration. Unlike
+// the Connect function, it does not read the default configuration file.
+func (cfg Config) Connect(opts ...Option) (*Client, error) {
+	o, err := cfg.Options()
+	if err != nil {
+		return nil, err
+	}
+	addr := cfg.Addr
+	if addr == "" {
+		addr = DefaultAddr
+	}
+	return connect(addr, cfg.User, append(o, opts...))
+}
+
+// ConnectFromEnv connects to the server described by the environment. Unset
+// variables default to the settings of the user's configuration file (see
+// LoadConfig).
+func ConnectFromEnv(opts ...Option) (*Client, error) {
+	cfg, err := LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	return cfg.Connect(opts...)
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,174 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package client
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sysdb/go/proto"
+	"github.com/sysdb/go/sysdb"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("SYSDB_ADDR", "db.example.com:2100")
+	t.Setenv("SYSDB_USER", "alice")
+	t.Setenv("SYSDB_DIAL_TIMEOUT", "5s")
+
+	cfg, err := ConfigFromEnv()
+	want := Config{Addr: "db.example.com:2100", User: "alice", DialTimeout: 5 * time.Second}
+	if err != nil || cfg != want {
+		t.Errorf("ConfigFromEnv() = %+v, %v; want %+v, <nil>", cfg, err, want)
+	}
+
+	t.Setenv("SYSDB_DIAL_TIMEOUT", "five seconds")
+	if cfg, err := ConfigFromEnv(); sysdb.ErrorCode(err) != sysdb.CodeInvalidArgument {
+		t.Errorf("ConfigFromEnv() = %+v, %v; want <error %v>", cfg, err, sysdb.CodeInvalidArgument)
+	}
+}
+
+func TestConfigOptions(t *testing.T) {
+	cfg := Config{TLSCA: "/nonexistent/ca.pem"}
+	if opts, err := cfg.Options(); sysdb.ErrorCode(err) != sysdb.CodeInvalidArgument {
+		t.Errorf("%+v.Options() = %v, %v; want <error %v>", cfg, opts, err, sysdb.CodeInvalidArgument)
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	for _, test := range []struct {
+		input string
+		want  Config
+		err   bool
+	}{
+		{"", Config{}, false},
+		{
+			"# comment\n\nAddress \"db.example.com:2100\"\nuser\talice\n" +
+				"TLSCert /c.pem\nTLSKey /k.pem\nTLSCA \"/ca dir/ca.pem\"\n" +
+				"DialTimeout 2s\nPoolSize 4\n",
+			Config{
+				Addr: "db.example.com:2100", User: "alice",
+				TLSCert: "/c.pem", TLSKey: "/k.pem", TLSCA: "/ca dir/ca.pem",
+				DialTimeout: 2 * time.Second, PoolSize: 4,
+			},
+			false,
+		},
+		{"Unknown 1", Config{}, true},
+		{"PoolSize many", Config{}, true},
+		{"DialTimeout 5", Config{}, true},
+		{"Address \"unterminated", Config{}, true},
+	} {
+		cfg, err := parseConfig(strings.NewReader(test.input))
+		if (err != nil) != test.err || cfg != test.want {
+			t.Errorf("parseConfig(%q) = %+v, %v; want %+v (error: %v)", test.input, cfg, err, test.want, test.err)
+		}
+		if err != nil && sysdb.ErrorCode(err) != sysdb.CodeInvalidFormat {
+			t.Errorf("parseConfig(%q) = %v; want <error %v>", test.input, err, sysdb.CodeInvalidFormat)
+		}
+	}
+}
+
+func TestConfigMerge(t *testing.T) {
+	cfg := Config{Addr: "/sock", PoolSize: 2}.merge(Config{Addr: "h:1", User: "u", PoolSize: 8})
+	want := Config{Addr: "/sock", User: "u", PoolSize: 2}
+	if cfg != want {
+		t.Errorf("merge() = %+v; want %+v", cfg, want)
+	}
+}
+
+func TestConnectConfigFile(t *testing.T) {
+	s := newTestServer(t, func(req *proto.Message) []*proto.Message {
+		return []*proto.Message{{Type: proto.ConnectionOK}}
+	})
+	defer s.close()
+
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	if err := os.Mkdir(filepath.Join(dir, "sysdb"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(content string) {
+		if err := os.WriteFile(filepath.Join(dir, "sysdb", "client.conf"), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(fmt.Sprintf("Address %q\nPoolSize 3\n", s.addr()))
+	for _, test := range []struct {
+		addr string
+		opts []Option
+		size int
+	}{
+		{"", nil, 3},
+		{"", []Option{WithPoolSize(1)}, 1},
+		{s.addr(), nil, 3},
+	} {
+		c, err := Connect(test.addr, "test", test.opts...)
+		if err != nil {
+			t.Errorf("Connect(%q, %d options) = %v", test.addr, len(test.opts), err)
+			continue
+		}
+		if got := cap(c.conns); got != test.size {
+			t.Errorf("Connect(%q, %d options) uses %d connections; want %d", test.addr, len(test.opts), got, test.size)
+		}
+		c.Close()
+	}
+	if c, err := (Config{Addr: s.addr()}).Connect(); err != nil || cap(c.conns) == 3 {
+		t.Errorf("Config.Connect() = %v; want default pool size, ignoring the configuration file", err)
+	} else {
+		c.Close()
+	}
+
+	// Explicit addresses take precedence.
+	write("Address unix:/nonexistent/sock\nPoolSize 1\n")
+	if c, err := Connect(s.addr(), "test"); err != nil {
+		t.Errorf("Connect(%q) = %v; want <nil>", s.addr(), err)
+	} else {
+		c.Close()
+	}
+	if _, err := Connect("", "test"); err == nil {
+		t.Errorf("Connect(\"\") = <nil>; want error connecting to unix:/nonexistent/sock")
+	}
+
+	// A malformed file only matters if it would provide a missing value.
+	write("PoolSize many\n")
+	if c, err := Connect(s.addr(), "test"); err != nil {
+		t.Errorf("Connect(%q, <malformed config file>) = %v; want <nil>", s.addr(), err)
+	} else {
+		c.Close()
+	}
+	if _, err := Connect("", "test"); sysdb.ErrorCode(err) != sysdb.CodeInvalidFormat {
+		t.Errorf("Connect(\"\", <malformed config file>) = %v; want <error %v>", err, sysdb.CodeInvalidFormat)
+	}
+	if _, err := Connect(s.addr(), ""); sysdb.ErrorCode(err) != sysdb.CodeInvalidFormat {
+		t.Errorf("Connect(%q, \"\", <malformed config file>) = %v; want <error %v>", s.addr(), err, sysdb.CodeInvalidFormat)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -26,11 +26,18 @@
 package client
 
 import (
-	"fmt"
+	"context"
+	"crypto/tls"
+	"io"
 	"net"
+	"os/user"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/sysdb/go/proto"
+	"github.com/sysdb/go/sysdb"
 )
 
 // A Conn is a connection to a SysDB server instance.
@@ -40,56 +47,225 @@ import (
 // messages, the communication with the server will usually happen
 // sequentially.
 type Conn struct {
-	c                   net.Conn
 	network, addr, user string
+	dialer              *net.Dialer
+	tls                 *tls.Config
+	startTLS            bool
+	maxVersion          uint32
+	logHandler          LogHandler
+	tracer              *proto.Tracer
+
+	mu sync.Mutex
+	c  net.Conn
+	// version is the negotiated protocol version.
+	version uint32
+	// killed indicates that the connection has been shut down for good.
+	killed bool
+
+	// Time of the last (re)connect and number of requests since then.
+	established time.Time
+	requests    int
+	// Time the connection has last been used.
+	lastUsed time.Time
 }
 
-func (c *Conn) dial() (err error) {
-	if c.c, err = net.Dial(c.network, c.addr); err != nil {
+func (c *Conn) dial() error {
+	// Don't reconnect a connection that has been shut down; the check below
+	// covers a kill racing with the network I/O.
+	if c.isKilled() {
+		return ErrClosed
+	}
+
+	var nc net.Conn
+	var err error
+	if c.tls != nil && c.startTLS {
+		nc, err = c.dialStartTLS()
+	} else if c.tls != nil && c.network == "tcp" {
+		nc, err = tls.DialWithDialer(c.dialer, c.network, c.addr, c.tls)
+	} else {
+		nc, err = c.dialer.Dial(c.network, c.addr)
+	}
+	if err != nil {
 		return err
 	}
-	defer func() {
-		if err != nil {
-			c.Close()
+	if c.tracer != nil {
+		nc = c.tracer.Conn(nc)
+	}
+
+	version := uint32(proto.BaseProtocolVersion)
+	if c.maxVersion > 0 {
+		if version, err = proto.NegotiateVersion(nc, c.maxVersion); err != nil {
+			nc.Close()
+			return err
 		}
-	}()
+	}
+	if err := startup(nc, c.user); err != nil {
+		nc.Close()
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.killed {
+		nc.Close()
+		return ErrClosed
+	}
+	c.c = nc
+	c.version = version
+	c.established = time.Now()
+	c.lastUsed = c.established
+	c.requests = 0
+	return nil
+}
 
+// dialStartTLS connects in plain-text and upgrades the connection to TLS.
+func (c *Conn) dialStartTLS() (net.Conn, error) {
+	nc, err := c.dialer.Dial(c.network, c.addr)
+	if err != nil {
+		return nil, err
+	}
+	cfg := c.tls
+	if cfg.ServerName == "" && c.network == "tcp" {
+		// Mimic tls.Dial which derives the server name from the address.
+		if host, _, err := net.SplitHostPort(c.addr); err == nil {
+			cfg = cfg.Clone()
+			cfg.ServerName = host
+		}
+	}
+	tc, err := proto.StartTLS(nc, cfg)
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+	return tc, nil
+}
+
+// startup sets up a session on a new connection.
+func startup(nc net.Conn, user string) error {
 	m := &proto.Message{
 		Type: proto.ConnectionStartup,
-		Raw:  []byte(c.user),
+		Raw:  []byte(user),
 	}
-	if err := c.Send(m); err != nil {
+	if err := proto.Write(nc, m); err != nil {
 		return err
 	}
 
-	m, err = c.Receive()
+	m, err := proto.Read(nc)
 	if err != nil {
 		return err
 	}
+	if m.Type == proto.ConnectionError && string(m.Raw) == proto.TLSRequired {
+		return sysdb.Errorf(sysdb.CodeStartupFailed, "failed to startup session: server requires TLS (see WithStartTLS)")
+	}
 	if m.Type == proto.ConnectionError {
-		return fmt.Errorf("failed to startup session: %s", string(m.Raw))
+		return sysdb.Errorf(sysdb.CodeStartupFailed, "failed to startup session: %s", string(m.Raw))
 	}
 	if m.Type != proto.ConnectionOK {
-		return fmt.Errorf("failed to startup session: unsupported")
+		return sysdb.Errorf(sysdb.CodeStartupFailed, "failed to startup session: unsupported")
 	}
 	return nil
 }
 
+// ProtocolVersion returns the protocol version negotiated with the server
+// (see WithProtocolVersion).
+func (c *Conn) ProtocolVersion() uint32 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.version
+}
+
+// isKilled reports whether the connection has been shut down for good (see
+// kill).
+func (c *Conn) isKilled() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.killed
+}
+
+// netConn returns the underlying network connection or nil if the connection
+// is closed.
+func (c *Conn) netConn() net.Conn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.c
+}
+
+// DefaultPort is the default TCP port of a SysDB server.
+const DefaultPort = 12345
+
+// parseAddr determines the network and address to connect to from a SysDB
+// address (see Dial).
+func parseAddr(addr string) (network, address string, err error) {
+	if strings.HasPrefix(addr, "unix:") {
+		return "unix", addr[len("unix:"):], nil
+	} else if strings.HasPrefix(addr, "/") {
+		return "unix", addr, nil
+	}
+
+	a := strings.TrimPrefix(addr, "tcp:")
+	var host, port string
+	switch {
+	case strings.HasPrefix(a, "[") && strings.HasSuffix(a, "]"):
+		// IPv6 literal without a port.
+		host = a[1 : len(a)-1]
+	case strings.Count(a, ":") > 1 && !strings.HasPrefix(a, "["):
+		// IPv6 literals have to be enclosed in brackets when
+		// specifying a port.
+		if net.ParseIP(a) == nil {
+			return "", "", sysdb.Errorf(sysdb.CodeInvalidArgument, "invalid address %q: ambiguous IPv6 literal (use [host]:port)", addr)
+		}
+		host = a
+	case strings.Contains(a, ":"):
+		if host, port, err = net.SplitHostPort(a); err != nil {
+			return "", "", sysdb.Errorf(sysdb.CodeInvalidArgument, "invalid address %q: %v", addr, err)
+		}
+	default:
+		host = a
+	}
+
+	if host == "" {
+		return "", "", sysdb.Errorf(sysdb.CodeInvalidArgument, "invalid address %q: missing host", addr)
+	}
+	if port == "" && strings.HasSuffix(a, ":") {
+		return "", "", sysdb.Errorf(sysdb.CodeInvalidArgument, "invalid address %q: missing port", addr)
+	} else if port == "" {
+		port = strconv.Itoa(DefaultPort)
+	} else if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+		return "", "", sysdb.Errorf(sysdb.CodeInvalidArgument, "invalid address %q: invalid port %q", addr, port)
+	}
+	return "tcp", net.JoinHostPort(host, port), nil
+}
+
 // Dial sets up a client connection to a SysDB server instance at the
 // specified address using the specified user.
 //
 // The address may be a UNIX domain socket, either prefixed with 'unix:' or
-// specifying an absolute file-system path.
-func Dial(addr, user string) (*Conn, error) {
-	network := "tcp"
-	if strings.HasPrefix(addr, "unix:") {
-		network = "unix"
-		addr = addr[len("unix:"):]
-	} else if len(addr) > 0 && addr[0] == '/' {
-		network = "unix"
+// specifying an absolute file-system path. Otherwise, it specifies a TCP
+// address, optionally prefixed with 'tcp:', in the form host, host:port,
+// [ipv6-host], or [ipv6-host]:port. The port defaults to DefaultPort.
+//
+// When connecting to a UNIX domain socket, an empty user name defaults to the
+// name of the current operating system user. The server authenticates such
+// connections using the peer's credentials.
+//
+// Options such as WithDialer, WithDialTimeout, and WithTLSConfig configure
+// how the connection is established.
+func Dial(addr, username string, opts ...Option) (*Conn, error) {
+	o := newOptions(opts)
+	network, addr, err := parseAddr(addr)
+	if err != nil {
+		return nil, err
 	}
 
-	c := &Conn{network: network, addr: addr, user: user}
+	if username == "" && network == "unix" {
+		u, err := user.Current()
+		if err != nil {
+			return nil, sysdb.Errorf(sysdb.CodeInvalidArgument, "failed to determine current user: %v", err)
+		}
+		username = u.Username
+	}
+
+	c := &Conn{network: network, addr: addr, user: username, dialer: o.dialer, tls: o.tls, startTLS: o.startTLS, maxVersion: o.maxVersion, logHandler: o.logHandler, tracer: o.tracer}
 	if err := c.dial(); err != nil {
 		return nil, err
 	}
@@ -100,6 +276,8 @@ func Dial(addr, user string) (*Conn, error) {
 //
 // Any blocked Send or Receive operations will be unblocked and return errors.
 func (c *Conn) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	if c.c == nil {
 		return
 	}
@@ -107,6 +285,51 @@ func (c *Conn) Close() {
 	c.c = nil
 }
 
+// interrupt aborts any blocked Send or Receive operations on the current
+// network connection without closing it. The connection must not be used
+// for further requests but has to be closed.
+func (c *Conn) interrupt() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.c != nil {
+		c.c.SetDeadline(time.Unix(1, 0))
+	}
+}
+
+// interruptOn arranges for the connection to be interrupted once ctx is
+// done (see interrupt). The returned function stops that; it reports whether
+// the interruption has been prevented. If it has not, the function waits for
+// the interruption to complete, so that it cannot affect a network
+// connection established later on.
+func (c *Conn) interruptOn(ctx context.Context) (stop func() bool) {
+	interrupted := make(chan struct{})
+	stopFunc := context.AfterFunc(ctx, func() {
+		defer close(interrupted)
+		c.interrupt()
+	})
+	var called, stopped bool
+	return func() bool {
+		if !called {
+			called = true
+			if stopped = stopFunc(); !stopped {
+				<-interrupted
+			}
+		}
+		return stopped
+	}
+}
+
+// kill closes the connection and prevents any further reconnects. Any
+// blocked Send or Receive operations will return errors.
+func (c *Conn) kill() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.killed = true
+	if c.c != nil {
+		c.c.Close()
+	}
+}
+
 // Send sends the specified raw message to the server.
 //
 // Send operations block until the full message could be written to the
@@ -114,8 +337,8 @@ func (c *Conn) Close() {
 // sync.
 func (c *Conn) Send(m *proto.Message) error {
 	var err error
-	if c.c != nil {
-		err = proto.Write(c.c, m)
+	if nc := c.netConn(); nc != nil {
+		err = proto.Write(nc, m)
 		if err == nil {
 			return nil
 		}
@@ -124,36 +347,78 @@ func (c *Conn) Send(m *proto.Message) error {
 
 	// Try to reconnect.
 	if e := c.dial(); e == nil {
-		return proto.Write(c.c, m)
+		return proto.Write(c.netConn(), m)
 	} else if err == nil {
 		err = e
 	}
 	return err
 }
 
+// Call sends the specified request to the server and waits for its reply. It
+// blocks until the full reply has been received. Log messages sent by the
+// server are logged and skipped and error replies are returned as errors of
+// code sysdb.CodeRequestFailed. Like the reply of Client.Call, the returned
+// message is owned by the caller who may release it to the message pool.
+func (c *Conn) Call(req *proto.Message) (*proto.Message, error) {
+	return c.CallContext(context.Background(), req)
+}
+
+// CallContext is like Call but aborts the request if ctx is done before the
+// reply has been received; the connection reconnects on next use in that
+// case. The context may carry a Stats object (see WithStats) which allows to
+// tell whether the request has been sent at all.
+func (c *Conn) CallContext(ctx context.Context, req *proto.Message) (*proto.Message, error) {
+	return exchange(ctx, c, req, statsFromContext(ctx))
+}
+
 // Receive waits for a reply from the server and returns the raw message.
 //
 // Receive operations block until a full message could be read from the
 // underlying socket. This ensures that server and client don't get out of
 // sync.
 func (c *Conn) Receive() (*proto.Message, error) {
+	return c.receive(nil, true)
+}
+
+// receive implements Receive. If first is not nil and zero, it will be set
+// to the time the first byte has been received. If reconnect is false, a
+// failed connection is closed without reconnecting; it will reconnect on next
+// use.
+func (c *Conn) receive(first *time.Time, reconnect bool) (*proto.Message, error) {
 	var err error
-	if c.c != nil {
+	if nc := c.netConn(); nc != nil {
 		var m *proto.Message
-		m, err = proto.Read(c.c)
+		m, err = proto.ReadPooled(&timingReader{r: nc, first: first})
 		if err == nil {
 			return m, err
 		}
 		c.Close()
+		if !reconnect {
+			return nil, err
+		}
 	}
 
 	// Try to reconnect.
 	if e := c.dial(); e == nil {
-		return proto.Read(c.c)
+		return proto.ReadPooled(&timingReader{r: c.netConn(), first: first})
 	} else if err == nil {
 		err = e
 	}
 	return nil, err
 }
 
+// A timingReader records the time the first byte has been read.
+type timingReader struct {
+	r     io.Reader
+	first *time.Time
+}
+
+func (r *timingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 && r.first != nil && r.first.IsZero() {
+		*r.first = time.Now()
+	}
+	return n, err
+}
+
 // vim: set tw=78 sw=4 sw=4 noexpandtab :
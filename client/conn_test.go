@@ -0,0 +1,157 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package client
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sysdb/go/proto"
+	"github.com/sysdb/go/sysdb"
+)
+
+func TestParseAddr(t *testing.T) {
+	for _, test := range []struct {
+		addr             string
+		network, address string
+		wantErr          bool
+	}{
+		{"unix:/var/run/sysdbd.sock", "unix", "/var/run/sysdbd.sock", false},
+		{"/var/run/sysdbd.sock", "unix", "/var/run/sysdbd.sock", false},
+		{"sysdb.example.com", "tcp", "sysdb.example.com:12345", false},
+		{"sysdb.example.com:4242", "tcp", "sysdb.example.com:4242", false},
+		{"tcp:sysdb.example.com", "tcp", "sysdb.example.com:12345", false},
+		{"tcp:127.0.0.1:4242", "tcp", "127.0.0.1:4242", false},
+		{"[::1]:4242", "tcp", "[::1]:4242", false},
+		{"[::1]", "tcp", "[::1]:12345", false},
+		{"tcp:[fe80::1]:1", "tcp", "[fe80::1]:1", false},
+		{"::1", "tcp", "[::1]:12345", false},
+		{"fe80::1:4242x", "", "", true},
+		{"", "", "", true},
+		{"tcp:", "", "", true},
+		{":4242", "", "", true},
+		{"[]", "", "", true},
+		{"host:", "", "", true},
+		{"host:http", "", "", true},
+		{"host:65536", "", "", true},
+		{"[::1]:4242:1", "", "", true},
+	} {
+		network, address, err := parseAddr(test.addr)
+		if network != test.network || address != test.address || (err != nil) != test.wantErr {
+			t.Errorf("parseAddr(%q) = %q, %q, %v; want %q, %q (error: %v)",
+				test.addr, network, address, err, test.network, test.address, test.wantErr)
+		}
+		if err != nil && sysdb.ErrorCode(err) != sysdb.CodeInvalidArgument {
+			t.Errorf("parseAddr(%q) = %v; want <error %v>", test.addr, err, sysdb.CodeInvalidArgument)
+		}
+	}
+}
+
+func TestProtocolVersion(t *testing.T) {
+	s := newTestServer(t, func(req *proto.Message) []*proto.Message {
+		// Like servers not supporting version negotiation.
+		return []*proto.Message{{Type: proto.ConnectionError, Raw: []byte("Authentication required")}}
+	})
+	defer s.close()
+
+	for _, opts := range [][]Option{nil, {WithProtocolVersion(proto.ProtocolVersion + 1)}} {
+		c, err := Dial(s.addr(), "test", opts...)
+		if err != nil {
+			t.Fatalf("Dial() = %v", err)
+		}
+		if v := c.ProtocolVersion(); v != proto.BaseProtocolVersion {
+			t.Errorf("ProtocolVersion() = %d; want %d", v, proto.BaseProtocolVersion)
+		}
+		c.Close()
+	}
+}
+
+func TestInterruptOn(t *testing.T) {
+	s := newTestServer(t, func(req *proto.Message) []*proto.Message {
+		return []*proto.Message{{Type: proto.ConnectionOK}}
+	})
+	defer s.close()
+
+	c, err := Dial(s.addr(), "test")
+	if err != nil {
+		t.Fatalf("Dial() = %v", err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stop := c.interruptOn(ctx)
+	if !stop() || !stop() {
+		t.Errorf("stop() = false; want true before cancellation")
+	}
+	cancel()
+
+	ctx, cancel = context.WithCancel(context.Background())
+	stop = c.interruptOn(ctx)
+	// Block the interruption.
+	c.mu.Lock()
+	cancel()
+	stopped := make(chan bool, 1)
+	go func() { stopped <- stop() }()
+	time.Sleep(20 * time.Millisecond)
+	if len(stopped) != 0 {
+		t.Errorf("stop() returned before the interruption completed")
+	}
+	c.mu.Unlock()
+	if <-stopped {
+		t.Errorf("stop() = true; want false after cancellation")
+	}
+	if stop() {
+		t.Errorf("stop(<again>) = true; want false")
+	}
+}
+
+func TestKill(t *testing.T) {
+	s := newTestServer(t, func(req *proto.Message) []*proto.Message {
+		return []*proto.Message{{Type: proto.ConnectionOK}}
+	})
+	defer s.close()
+
+	c, err := Dial(s.addr(), "test")
+	if err != nil {
+		t.Fatalf("Dial() = %v", err)
+	}
+	c.kill()
+
+	if err := c.dial(); err != ErrClosed {
+		t.Errorf("dial(<killed>) = %v; want %v", err, ErrClosed)
+	}
+	if err := c.Send(&proto.Message{Type: proto.ConnectionPing}); err == nil {
+		t.Errorf("Send(<killed>) = <nil>; want <err>")
+	}
+	// A killed connection does not even try to reconnect.
+	if n := atomic.LoadInt32(&s.startups); n != 1 {
+		t.Errorf("Killed connection reconnected: %d startups; want 1", n)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
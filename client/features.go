@@ -0,0 +1,82 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package client
+
+// A Feature is an optional feature of the SysDB server.
+type Feature int
+
+const (
+	// FeatureTimeseries indicates support for the TIMESERIES command.
+	FeatureTimeseries Feature = iota
+	// FeatureStore indicates support for the STORE command.
+	FeatureStore
+)
+
+// minVersions lists the first server version supporting each feature.
+var minVersions = map[Feature]version{
+	FeatureTimeseries: {0, 5, 0},
+	FeatureStore:      {0, 7, 0},
+}
+
+// A version is a SysDB server version.
+type version struct {
+	major, minor, patch int
+}
+
+func (v version) atLeast(o version) bool {
+	if v.major != o.major {
+		return v.major > o.major
+	}
+	if v.minor != o.minor {
+		return v.minor > o.minor
+	}
+	return v.patch >= o.patch
+}
+
+// Supports reports whether the server supports the specified feature. SysDB
+// servers do not advertise their capabilities, so they are derived from the
+// server version. The version is queried on first use and cached for the
+// lifetime of the client. If it cannot be determined, Supports reports false
+// and tries again on the next call.
+func (c *Client) Supports(f Feature) bool {
+	min, ok := minVersions[f]
+	if !ok {
+		return false
+	}
+
+	c.versionMu.Lock()
+	defer c.versionMu.Unlock()
+	if c.version == nil {
+		major, minor, patch, _, err := c.ServerVersion()
+		if err != nil {
+			return false
+		}
+		c.version = &version{major, minor, patch}
+	}
+	return c.version.atLeast(min)
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
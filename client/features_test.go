@@ -0,0 +1,86 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package client
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/sysdb/go/proto"
+)
+
+func TestSupports(t *testing.T) {
+	var calls int32
+	s := newTestServer(t, func(req *proto.Message) []*proto.Message {
+		if req.Type != proto.ConnectionServerVersion {
+			return []*proto.Message{{Type: proto.ConnectionError, Raw: []byte("unexpected")}}
+		}
+		atomic.AddInt32(&calls, 1)
+		return []*proto.Message{proto.EncodeVersion(proto.ServerVersion{Minor: 6})}
+	})
+	defer s.close()
+
+	c, err := Connect(s.addr(), "user", WithPoolSize(1))
+	if err != nil {
+		t.Fatalf("Connect() = %v", err)
+	}
+	defer c.Close()
+
+	for _, test := range []struct {
+		f    Feature
+		want bool
+	}{
+		{FeatureTimeseries, true},
+		{FeatureStore, false},
+		{Feature(-1), false},
+	} {
+		if got := c.Supports(test.f); got != test.want {
+			t.Errorf("Supports(%d) = %v; want %v", test.f, got, test.want)
+		}
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("Supports() queried the server version %d times; want 1", n)
+	}
+}
+
+func TestVersionAtLeast(t *testing.T) {
+	for _, test := range []struct {
+		v, o version
+		want bool
+	}{
+		{version{0, 7, 0}, version{0, 7, 0}, true},
+		{version{0, 7, 1}, version{0, 7, 0}, true},
+		{version{0, 6, 9}, version{0, 7, 0}, false},
+		{version{1, 0, 0}, version{0, 7, 0}, true},
+		{version{0, 8, 0}, version{1, 0, 0}, false},
+	} {
+		if got := test.v.atLeast(test.o); got != test.want {
+			t.Errorf("%v.atLeast(%v) = %v; want %v", test.v, test.o, got, test.want)
+		}
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
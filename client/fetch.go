@@ -0,0 +1,204 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package client
+
+import (
+	"context"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/sysdb/go/proto"
+	"github.com/sysdb/go/sysdb"
+)
+
+// The command and object type of a query.
+var queryObjectRE = regexp.MustCompile(`(?i)^\s*(FETCH|LIST|LOOKUP)\s+(host|service|metric)s?\b`)
+
+// queryObject returns the upper-case command and lower-case object type of a
+// FETCH, LIST, or LOOKUP query. It returns empty strings for other queries.
+func queryObject(q string) (cmd, typ string) {
+	m := queryObjectRE.FindStringSubmatch(q)
+	if m == nil {
+		return "", ""
+	}
+	return strings.ToUpper(m[1]), strings.ToLower(m[2])
+}
+
+// DecodeQuery decodes the DATA message res replying to the query q like
+// Decode. The query is more reliable than the structure of the reply which
+// Decode has to rely on: the server returns services and metrics along with
+// their parent hosts. Based on the query, results of LIST and LOOKUP queries
+// are decoded into a []sysdb.Host, sysdb.ServiceList, or sysdb.MetricList,
+// and results of FETCH queries into a *sysdb.Host, *sysdb.Service, or
+// *sysdb.Metric. Results of other queries are decoded by Decode.
+func DecodeQuery(q string, res *proto.Message) (interface{}, error) {
+	cmd, typ := queryObject(q)
+	if cmd == "LIST" || cmd == "LOOKUP" {
+		switch t, _ := res.DataType(); t {
+		case proto.HostList, proto.ServiceList, proto.MetricList:
+			return decodeList(res, typ)
+		}
+	}
+	obj, err := Decode(res)
+	if err != nil {
+		return nil, err
+	}
+	host, ok := obj.(*sysdb.Host)
+	if cmd != "FETCH" || !ok {
+		return obj, nil
+	}
+	switch typ {
+	case "service":
+		return fetchedService(res, host, "")
+	case "metric":
+		return fetchedMetric(res, host, "")
+	}
+	return obj, nil
+}
+
+// decodeList decodes the result of a LIST or LOOKUP query into a
+// []sysdb.Host, sysdb.ServiceList, or sysdb.MetricList depending on the type
+// of the queried objects.
+func decodeList(res *proto.Message, typ string) (interface{}, error) {
+	var v interface{}
+	switch typ {
+	case "service":
+		v = new(sysdb.ServiceList)
+	case "metric":
+		v = new(sysdb.MetricList)
+	default:
+		v = new([]sysdb.Host)
+	}
+	if err := proto.Unmarshal(res, v); err != nil {
+		return nil, sysdb.Errorf(sysdb.CodeMalformedMessage, "failed to unmarshal response: %v", err)
+	}
+	return reflect.ValueOf(v).Elem().Interface(), nil
+}
+
+// fetchedService extracts the service called name (or the only service if
+// name is empty) from the reply to a FETCH command.
+func fetchedService(res *proto.Message, host *sysdb.Host, name string) (*sysdb.Service, error) {
+	for i, s := range host.Services {
+		if s.Name == name || (name == "" && len(host.Services) == 1) {
+			return &host.Services[i], nil
+		}
+	}
+	if len(host.Services) == 0 && len(host.Metrics) == 0 {
+		// The server returned the service without its parent host.
+		var s sysdb.Service
+		if err := proto.Unmarshal(res, &s); err != nil {
+			return nil, sysdb.Errorf(sysdb.CodeMalformedMessage, "failed to unmarshal response: %v", err)
+		}
+		return &s, nil
+	}
+	return nil, sysdb.Errorf(sysdb.CodeMalformedMessage, "reply does not include service %q", name)
+}
+
+// fetchedMetric extracts the metric called name (or the only metric if name
+// is empty) from the reply to a FETCH command.
+func fetchedMetric(res *proto.Message, host *sysdb.Host, name string) (*sysdb.Metric, error) {
+	for i, m := range host.Metrics {
+		if m.Name == name || (name == "" && len(host.Metrics) == 1) {
+			return &host.Metrics[i], nil
+		}
+	}
+	if len(host.Services) == 0 && len(host.Metrics) == 0 {
+		// The server returned the metric without its parent host.
+		var m sysdb.Metric
+		if err := proto.Unmarshal(res, &m); err != nil {
+			return nil, sysdb.Errorf(sysdb.CodeMalformedMessage, "failed to unmarshal response: %v", err)
+		}
+		return &m, nil
+	}
+	return nil, sysdb.Errorf(sysdb.CodeMalformedMessage, "reply does not include metric %q", name)
+}
+
+// fetch executes a FETCH query and passes the decoded host object along
+// with the raw reply to extract which has to decode everything it needs from
+// the reply.
+func (c *Client) fetch(ctx context.Context, q string, extract func(*sysdb.Host, *proto.Message) error) error {
+	return c.query(ctx, q, func(res *proto.Message) error {
+		var host sysdb.Host
+		if err := proto.Unmarshal(res, &host); err != nil {
+			return sysdb.Errorf(sysdb.CodeMalformedMessage, "failed to unmarshal response: %v", err)
+		}
+		return extract(&host, res)
+	})
+}
+
+// FetchHost retrieves the named host including all of its children.
+func (c *Client) FetchHost(ctx context.Context, name string) (*sysdb.Host, error) {
+	q, err := QueryString("FETCH host %s", name)
+	if err != nil {
+		return nil, err
+	}
+	var host *sysdb.Host
+	err = c.fetch(ctx, q, func(h *sysdb.Host, _ *proto.Message) error {
+		host = h
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return host, nil
+}
+
+// FetchService retrieves the named service of the specified host.
+func (c *Client) FetchService(ctx context.Context, host, name string) (*sysdb.Service, error) {
+	q, err := QueryString("FETCH service %s.%s", host, name)
+	if err != nil {
+		return nil, err
+	}
+	var s *sysdb.Service
+	err = c.fetch(ctx, q, func(h *sysdb.Host, res *proto.Message) (err error) {
+		s, err = fetchedService(res, h, name)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// FetchMetric retrieves the named metric of the specified host.
+func (c *Client) FetchMetric(ctx context.Context, host, name string) (*sysdb.Metric, error) {
+	q, err := QueryString("FETCH metric %s.%s", host, name)
+	if err != nil {
+		return nil, err
+	}
+	var m *sysdb.Metric
+	err = c.fetch(ctx, q, func(h *sysdb.Host, res *proto.Message) (err error) {
+		m, err = fetchedMetric(res, h, name)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,138 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sysdb/go/proto"
+	"github.com/sysdb/go/sysdb"
+)
+
+func TestFetch(t *testing.T) {
+	replies := map[string]string{
+		"FETCH host 'h'":           `{"name": "h", "services": [{"name": "s1"}, {"name": "s2"}]}`,
+		"FETCH service 'h'.'s1'":   `{"name": "h", "services": [{"name": "s1", "backends": ["b"]}]}`,
+		"FETCH service 'h'.'bare'": `{"name": "bare", "backends": ["b"]}`,
+		"FETCH metric 'h'.'m'":     `{"name": "h", "metrics": [{"name": "m", "timeseries": true}]}`,
+		"FETCH metric 'h'.'other'": `{"name": "h", "metrics": [{"name": "m"}]}`,
+		"fetch metric 'h'.'m'":     `{"name": "h", "metrics": [{"name": "m"}]}`,
+	}
+	s := newTestServer(t, func(req *proto.Message) []*proto.Message {
+		return []*proto.Message{dataMessage(proto.ConnectionFetch, replies[string(req.Raw)])}
+	})
+	defer s.close()
+
+	c, err := Connect(s.addr(), "test")
+	if err != nil {
+		t.Fatalf("Connect() = %v", err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+
+	if h, err := c.FetchHost(ctx, "h"); err != nil || h.Name != "h" || len(h.Services) != 2 {
+		t.Errorf("FetchHost(h) = %+v, %v; want host h with two services", h, err)
+	}
+	if svc, err := c.FetchService(ctx, "h", "s1"); err != nil || svc.Name != "s1" || len(svc.Backends) != 1 {
+		t.Errorf("FetchService(h, s1) = %+v, %v; want service s1", svc, err)
+	}
+	if svc, err := c.FetchService(ctx, "h", "bare"); err != nil || svc.Name != "bare" || len(svc.Backends) != 1 {
+		t.Errorf("FetchService(h, bare) = %+v, %v; want service bare", svc, err)
+	}
+	if m, err := c.FetchMetric(ctx, "h", "m"); err != nil || m.Name != "m" || !m.Timeseries {
+		t.Errorf("FetchMetric(h, m) = %+v, %v; want metric m", m, err)
+	}
+	if m, err := c.FetchMetric(ctx, "h", "other"); err == nil {
+		t.Errorf("FetchMetric(h, other) = %+v, <nil>; want <err>", m)
+	}
+
+	for q, want := range map[string]string{
+		"FETCH host 'h'":         "*sysdb.Host",
+		"FETCH service 'h'.'s1'": "*sysdb.Service",
+		"fetch metric 'h'.'m'":   "*sysdb.Metric",
+	} {
+		obj, err := c.Query(q)
+		got := "<nil>"
+		switch obj.(type) {
+		case *sysdb.Host:
+			got = "*sysdb.Host"
+		case *sysdb.Service:
+			got = "*sysdb.Service"
+		case *sysdb.Metric:
+			got = "*sysdb.Metric"
+		}
+		if err != nil || got != want {
+			t.Errorf("Query(%q) = %T, %v; want %s, <nil>", q, obj, err, want)
+		}
+	}
+}
+
+func TestLists(t *testing.T) {
+	replies := map[string]string{
+		"LIST hosts":                         `[{"name": "h1"}, {"name": "h2"}]`,
+		"LIST services":                      `[{"name": "h1", "services": [{"name": "s1"}, {"name": "s2"}]}, {"name": "h2", "services": [{"name": "s3"}]}]`,
+		"LOOKUP metrics MATCHING name = 'm'": `[{"name": "h1", "metrics": [{"name": "m"}]}]`,
+		"LIST metrics":                       `[{"host": "h1", "name": "m1"}, {"host": "h2", "name": "m2"}]`,
+		"LOOKUP hosts MATCHING name = 'h1'":  `[{"name": "h1", "services": [{"name": "s1"}]}]`,
+	}
+	s := newTestServer(t, func(req *proto.Message) []*proto.Message {
+		return []*proto.Message{dataMessage(proto.ConnectionList, replies[string(req.Raw)])}
+	})
+	defer s.close()
+
+	c, err := Connect(s.addr(), "test")
+	if err != nil {
+		t.Fatalf("Connect() = %v", err)
+	}
+	defer c.Close()
+
+	if res, err := c.Query("LIST hosts"); err != nil || len(res.([]sysdb.Host)) != 2 {
+		t.Errorf("Query(LIST hosts) = %v, %v; want two hosts", res, err)
+	}
+
+	// Hosts carrying nothing but services are still hosts.
+	q := "LOOKUP hosts MATCHING name = 'h1'"
+	if res, err := c.Query(q); err != nil || len(res.([]sysdb.Host)) != 1 {
+		t.Errorf("Query(%s) = %v, %v; want one host", q, res, err)
+	}
+
+	res, err := c.Query("LIST services")
+	svcs, ok := res.(sysdb.ServiceList)
+	if err != nil || !ok || len(svcs) != 3 || svcs[2].Host != "h2" || svcs[2].Name != "s3" {
+		t.Errorf("Query(LIST services) = %v, %v; want three services", res, err)
+	}
+
+	for _, q := range []string{"LOOKUP metrics MATCHING name = 'm'", "LIST metrics"} {
+		res, err := c.Query(q)
+		metrics, ok := res.(sysdb.MetricList)
+		if err != nil || !ok || len(metrics) == 0 || metrics[0].Host != "h1" || metrics[0].Name[0] != 'm' {
+			t.Errorf("Query(%s) = %v, %v; want metrics of h1", q, res, err)
+		}
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,65 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package client
+
+import (
+	"context"
+
+	"github.com/sysdb/go/proto"
+)
+
+// A CallFunc sends a request to the server and returns its reply.
+type CallFunc func(ctx context.Context, req *proto.Message) (*proto.Message, error)
+
+// An Interceptor wraps the execution of a request. It receives the next
+// function in the chain and returns a function to be used in its place. This
+// allows to act on requests before they are sent, on replies after they have
+// been received, and on any errors. For example:
+//
+//	logger := func(next client.CallFunc) client.CallFunc {
+//		return func(ctx context.Context, req *proto.Message) (*proto.Message, error) {
+//			res, err := next(ctx, req)
+//			log.Printf("%d: %v", req.Type, err)
+//			return res, err
+//		}
+//	}
+//	c, err := client.Connect(addr, user, client.WithInterceptor(logger))
+//
+// Replies are returned to the message pool once the caller has decoded
+// them (see Call). Interceptors retaining a reply beyond the call, like the
+// query cache, have to store a copy.
+type Interceptor func(next CallFunc) CallFunc
+
+// chain wraps f in the specified interceptors such that the first interceptor
+// is the outermost one.
+func chain(f CallFunc, interceptors []Interceptor) CallFunc {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		f = interceptors[i](f)
+	}
+	return f
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,64 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package client
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/sysdb/go/proto"
+)
+
+func TestChain(t *testing.T) {
+	var calls []string
+	interceptor := func(name string) Interceptor {
+		return func(next CallFunc) CallFunc {
+			return func(ctx context.Context, req *proto.Message) (*proto.Message, error) {
+				calls = append(calls, name+" before")
+				res, err := next(ctx, req)
+				calls = append(calls, name+" after")
+				return res, err
+			}
+		}
+	}
+
+	f := chain(func(ctx context.Context, req *proto.Message) (*proto.Message, error) {
+		calls = append(calls, "call")
+		return &proto.Message{Type: proto.ConnectionOK}, nil
+	}, []Interceptor{interceptor("a"), interceptor("b")})
+
+	res, err := f(context.Background(), &proto.Message{Type: proto.ConnectionPing})
+	if err != nil || res.Type != proto.ConnectionOK {
+		t.Errorf("chain() = %v, %v; want OK, <nil>", res, err)
+	}
+	want := []string{"a before", "b before", "call", "b after", "a after"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("chain() calls = %v; want %v", calls, want)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
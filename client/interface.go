@@ -0,0 +1,70 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/sysdb/go/proto"
+	"github.com/sysdb/go/sysdb"
+)
+
+// Interface describes the requests supported by a Client. Application code
+// may accept an Interface rather than a *Client in order to substitute a
+// fake implementation in tests (see package clienttest).
+type Interface interface {
+	// Call sends a raw request to the server and returns the reply.
+	Call(req *proto.Message) (*proto.Message, error)
+	CallContext(ctx context.Context, req *proto.Message) (*proto.Message, error)
+
+	// Query executes a query and returns the decoded result.
+	Query(q string) (interface{}, error)
+	QueryContext(ctx context.Context, q string) (interface{}, error)
+	// QueryInto executes a query and unmarshals the result into v.
+	QueryInto(q string, v interface{}) error
+	QueryIntoContext(ctx context.Context, q string, v interface{}) error
+	// QueryHosts executes a query and passes the returned hosts to fn.
+	QueryHosts(q string, fn func(*sysdb.Host) error) error
+	QueryHostsContext(ctx context.Context, q string, fn func(*sysdb.Host) error) error
+
+	// FetchHost, FetchService, and FetchMetric retrieve single objects.
+	FetchHost(ctx context.Context, name string) (*sysdb.Host, error)
+	FetchService(ctx context.Context, host, name string) (*sysdb.Service, error)
+	FetchMetric(ctx context.Context, host, name string) (*sysdb.Metric, error)
+	// Timeseries fetches the timeseries of a metric.
+	Timeseries(host, metric string, start, end time.Time) (*sysdb.Timeseries, error)
+	TimeseriesContext(ctx context.Context, host, metric string, start, end time.Time) (*sysdb.Timeseries, error)
+
+	// ServerVersion returns the version of the server.
+	ServerVersion() (major, minor, patch int, extra string, err error)
+	// Close releases all resources.
+	Close()
+}
+
+var _ Interface = (*Client)(nil)
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
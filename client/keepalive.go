@@ -0,0 +1,88 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package client
+
+import (
+	"time"
+
+	"github.com/sysdb/go/proto"
+)
+
+// minKeepaliveInterval is the minimum interval at which keepalive checks
+// for idle connections.
+const minKeepaliveInterval = time.Millisecond
+
+// keepalive periodically pings all pooled connections which have been idle
+// for at least d until the client is closed.
+func (c *Client) keepalive(d time.Duration) {
+	interval := d / 2
+	if interval < minKeepaliveInterval {
+		interval = minKeepaliveInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-c.done:
+			return
+		}
+
+		// Connections are returned to the end of the pool, so this visits
+		// each idle connection about once without blocking any requests.
+		for i := 0; i < len(c.all); i++ {
+			var conn *Conn
+			select {
+			case conn = <-c.conns:
+			default:
+				// All remaining connections are in use.
+			}
+			if conn == nil {
+				break
+			}
+			if !c.closed() && time.Since(conn.lastUsed) >= d {
+				if err := ping(conn, d); err != nil {
+					conn.Close()
+				}
+				conn.lastUsed = time.Now()
+			}
+			c.conns <- conn
+		}
+	}
+}
+
+// ping checks that conn is alive (see proto.Ping). Unlike Send and Receive,
+// it does not reconnect: a closed connection is left alone and will
+// reconnect on first use. The server has to reply within timeout.
+func ping(conn *Conn, timeout time.Duration) error {
+	nc := conn.netConn()
+	if nc == nil {
+		return nil
+	}
+	return proto.Ping(nc, timeout)
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
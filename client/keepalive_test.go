@@ -0,0 +1,107 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package client
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sysdb/go/proto"
+)
+
+func TestKeepalive(t *testing.T) {
+	var pings int32
+	s := newTestServer(t, func(req *proto.Message) []*proto.Message {
+		if req.Type == proto.ConnectionPing {
+			atomic.AddInt32(&pings, 1)
+		}
+		return []*proto.Message{{Type: proto.ConnectionOK}}
+	})
+	defer s.close()
+
+	c, err := Connect(s.addr(), "user", WithPoolSize(2), WithKeepalive(20*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Connect() = %v", err)
+	}
+	defer c.Close()
+
+	time.Sleep(100 * time.Millisecond)
+	if n := atomic.LoadInt32(&pings); n < 2 {
+		t.Errorf("Keepalive sent %d pings; want at least 2", n)
+	}
+
+	// The connections are still usable.
+	if _, err := c.Call(&proto.Message{Type: proto.ConnectionServerVersion}); err != nil {
+		t.Errorf("Call() after keepalive = %v", err)
+	}
+}
+
+func TestKeepaliveDeadPeer(t *testing.T) {
+	s := newTestServer(t, func(req *proto.Message) []*proto.Message {
+		if req.Type == proto.ConnectionPing {
+			// Never reply.
+			return nil
+		}
+		return []*proto.Message{{Type: proto.ConnectionOK}}
+	})
+	defer s.close()
+
+	c, err := Connect(s.addr(), "user", WithPoolSize(1), WithKeepalive(20*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Connect() = %v", err)
+	}
+	defer c.Close()
+
+	time.Sleep(100 * time.Millisecond)
+	if _, err := c.Call(&proto.Message{Type: proto.ConnectionServerVersion}); err != nil {
+		t.Errorf("Call() after failed ping = %v", err)
+	}
+	if n := atomic.LoadInt32(&s.startups); n < 2 {
+		t.Errorf("Dead connection was not replaced: %d startups; want at least 2", n)
+	}
+}
+
+func TestKeepaliveTiny(t *testing.T) {
+	s := newTestServer(t, func(req *proto.Message) []*proto.Message {
+		return []*proto.Message{{Type: proto.ConnectionOK}}
+	})
+	defer s.close()
+
+	// A keepalive below the ticker resolution must not crash the client.
+	c, err := Connect(s.addr(), "user", WithPoolSize(1), WithKeepalive(1))
+	if err != nil {
+		t.Fatalf("Connect() = %v", err)
+	}
+	defer c.Close()
+
+	time.Sleep(10 * time.Millisecond)
+	if _, err := c.Call(&proto.Message{Type: proto.ConnectionServerVersion}); err != nil {
+		t.Errorf("Call() with tiny keepalive = %v", err)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
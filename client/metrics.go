@@ -0,0 +1,66 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package client
+
+import (
+	"time"
+
+	"github.com/sysdb/go/proto"
+)
+
+// Metrics receives measurements about the operation of a Client. It allows
+// to plug in any metrics system, for example by updating Prometheus counters
+// and histograms.
+//
+// Implementations have to be safe for concurrent use by multiple goroutines.
+type Metrics interface {
+	// ObservePoolWait is called whenever a request acquired a connection
+	// from the pool with the time spent waiting for it.
+	ObservePoolWait(d time.Duration)
+	// ObserveRequest is called after each request with its type, the
+	// resulting error (if any), and the time spent communicating with the
+	// server. Use sysdb.ErrorCode to classify errors.
+	ObserveRequest(typ proto.Status, err error, d time.Duration)
+	// ObserveBytes is called after each request with the number of bytes
+	// sent to and received from the server, including message headers.
+	ObserveBytes(sent, received int)
+}
+
+// WithMetrics registers m to receive measurements about all requests issued
+// through the client.
+func WithMetrics(m Metrics) Option {
+	return func(o *options) {
+		o.metrics = m
+	}
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) ObservePoolWait(time.Duration)                     {}
+func (nopMetrics) ObserveRequest(proto.Status, error, time.Duration) {}
+func (nopMetrics) ObserveBytes(int, int)                             {}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,100 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package client
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sysdb/go/proto"
+	"github.com/sysdb/go/sysdb"
+)
+
+type testMetrics struct {
+	mu              sync.Mutex
+	waits, requests int
+	codes           []sysdb.Code
+	sent, received  int
+}
+
+func (m *testMetrics) ObservePoolWait(time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.waits++
+}
+
+func (m *testMetrics) ObserveRequest(_ proto.Status, err error, _ time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests++
+	if err != nil {
+		m.codes = append(m.codes, sysdb.ErrorCode(err))
+	}
+}
+
+func (m *testMetrics) ObserveBytes(sent, received int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent += sent
+	m.received += received
+}
+
+func TestMetrics(t *testing.T) {
+	s := newTestServer(t, func(req *proto.Message) []*proto.Message {
+		if req.Type == proto.ConnectionPing {
+			return []*proto.Message{{Type: proto.ConnectionOK}}
+		}
+		return []*proto.Message{{Type: proto.ConnectionError, Raw: []byte("failed")}}
+	})
+	defer s.close()
+
+	m := &testMetrics{}
+	c, err := Connect(s.addr(), "test", WithMetrics(m))
+	if err != nil {
+		t.Fatalf("Connect() = %v", err)
+	}
+	defer c.Close()
+
+	if _, err := c.Call(&proto.Message{Type: proto.ConnectionPing}); err != nil {
+		t.Errorf("Call(PING) = %v; want <nil>", err)
+	}
+	if _, err := c.Call(&proto.Message{Type: proto.ConnectionQuery, Raw: []byte("q")}); err == nil {
+		t.Errorf("Call(QUERY) = <nil>; want <err>")
+	}
+
+	if m.waits != 2 || m.requests != 2 {
+		t.Errorf("got %d pool waits, %d requests; want 2, 2", m.waits, m.requests)
+	}
+	if len(m.codes) != 1 || m.codes[0] != sysdb.CodeRequestFailed {
+		t.Errorf("got error codes %v; want [%s]", m.codes, sysdb.CodeRequestFailed)
+	}
+	if m.sent != 17 || m.received != 22 {
+		t.Errorf("got %d bytes sent, %d received; want 17, 22", m.sent, m.received)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,266 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"time"
+
+	"github.com/sysdb/go/proto"
+)
+
+// An Option configures a Client or a Conn. Options not applicable to a Conn
+// are ignored by Dial.
+type Option func(*options)
+
+type options struct {
+	dialer       *net.Dialer
+	tls          *tls.Config
+	tlsMods      []func(*tls.Config)
+	startTLS     bool
+	maxVersion   uint32
+	interceptors []Interceptor
+	policies     []QueryPolicy
+	metrics      Metrics
+	maxLifetime  time.Duration
+	maxRequests  int
+	poolSize     int
+	keepalive    time.Duration
+	logHandler   LogHandler
+	tracer       *proto.Tracer
+	maxPoolWait  time.Duration
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{dialer: &net.Dialer{}, metrics: nopMetrics{}, logHandler: logMessage, maxPoolWait: -1}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.dialer == nil {
+		o.dialer = &net.Dialer{}
+	}
+	if o.logHandler == nil {
+		o.logHandler = logMessage
+	}
+	if len(o.tlsMods) > 0 {
+		t := &tls.Config{}
+		if o.tls != nil {
+			t = o.tls.Clone()
+		}
+		for _, mod := range o.tlsMods {
+			mod(t)
+		}
+		o.tls = t
+	}
+	return o
+}
+
+// WithDialer configures the dialer used to establish connections. It allows
+// to specify timeouts, keep-alive settings, or the local address. The dialer
+// must not be modified afterwards. A nil dialer selects the default settings.
+func WithDialer(d *net.Dialer) Option {
+	return func(o *options) {
+		o.dialer = d
+	}
+}
+
+// WithDialTimeout configures the maximum amount of time to wait for a
+// connection to be established. It overrides the timeout of any dialer
+// specified using WithDialer if specified after it.
+func WithDialTimeout(d time.Duration) Option {
+	return func(o *options) {
+		var dialer net.Dialer
+		if o.dialer != nil {
+			dialer = *o.dialer
+		}
+		dialer.Timeout = d
+		o.dialer = &dialer
+	}
+}
+
+// WithTLSConfig configures the client to use TLS for TCP connections using
+// the specified configuration. UNIX domain socket connections do not use TLS.
+// If cfg does not specify a ServerName, it is derived from the address.
+// Options modifying the TLS configuration, such as WithTLSServerName, are
+// applied to a copy of cfg regardless of their order.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(o *options) {
+		o.tls = cfg
+	}
+}
+
+// WithStartTLS configures the client to connect in plain-text and to upgrade
+// connections to TLS using the STARTTLS protocol extension (see
+// proto.StartTLS) rather than connecting using TLS directly. This works on
+// UNIX domain sockets as well; the server name has to be specified
+// explicitly in that case (see WithTLSServerName). It requires TLS to be
+// configured (e.g. using WithTLSConfig).
+func WithStartTLS() Option {
+	return func(o *options) {
+		o.startTLS = true
+	}
+}
+
+// WithProtocolVersion configures the client to negotiate the protocol
+// version with the server when connecting (see proto.NegotiateVersion),
+// requesting at most version v. By default, no negotiation takes place and
+// proto.BaseProtocolVersion is used.
+func WithProtocolVersion(v uint32) Option {
+	return func(o *options) {
+		o.maxVersion = v
+	}
+}
+
+// modifyTLS registers f for modifying the TLS configuration. Modifications
+// are applied to a copy of the configuration specified using WithTLSConfig
+// or to a new configuration once all options have been processed.
+func (o *options) modifyTLS(f func(t *tls.Config)) {
+	o.tlsMods = append(o.tlsMods, f)
+}
+
+// WithTLSServerName configures the server name used to verify the server's
+// certificate and sent to the server for Server Name Indication (SNI). This
+// is useful when connecting through a TLS-terminating proxy. It enables TLS
+// if not configured yet.
+func WithTLSServerName(name string) Option {
+	return func(o *options) {
+		o.modifyTLS(func(t *tls.Config) { t.ServerName = name })
+	}
+}
+
+// WithTLSSessionCache enables TLS session resumption using a cache holding
+// up to n sessions (using a default capacity if n < 1). The cache is shared
+// by all connections of the client, allowing reconnects to skip the full
+// handshake. It enables TLS if not configured yet.
+func WithTLSSessionCache(n int) Option {
+	// Create the cache once as options are applied to each connection.
+	cache := tls.NewLRUClientSessionCache(n)
+	return func(o *options) {
+		o.modifyTLS(func(t *tls.Config) { t.ClientSessionCache = cache })
+	}
+}
+
+// WithVerifyPeerCertificate registers a function called after the normal
+// certificate verification (see tls.Config) which may be used to implement
+// certificate pinning. If the server's certificate is verified by f alone,
+// combine it with a TLS configuration setting InsecureSkipVerify. It enables
+// TLS if not configured yet.
+func WithVerifyPeerCertificate(f func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error) Option {
+	return func(o *options) {
+		o.modifyTLS(func(t *tls.Config) { t.VerifyPeerCertificate = f })
+	}
+}
+
+// WithTLSNextProtos configures the application-layer protocols offered to
+// the server using ALPN, in order of preference. It enables TLS if not
+// configured yet.
+func WithTLSNextProtos(protos ...string) Option {
+	protos = append([]string(nil), protos...)
+	return func(o *options) {
+		o.modifyTLS(func(t *tls.Config) { t.NextProtos = protos })
+	}
+}
+
+// WithLogHandler configures the handler for log messages sent by the server
+// while processing requests. By default, log messages are written to the
+// standard logger. A nil handler selects the default.
+func WithLogHandler(h LogHandler) Option {
+	return func(o *options) {
+		o.logHandler = h
+	}
+}
+
+// WithTrace configures the client to log all messages exchanged with the
+// server to w for debugging purposes (see proto.Tracer). Messages exchanged
+// on TLS connections are logged in plain text but STARTTLS requests are not
+// logged.
+func WithTrace(w io.Writer) Option {
+	return func(o *options) {
+		o.tracer = &proto.Tracer{Out: w}
+	}
+}
+
+// WithInterceptor registers an interceptor wrapping all calls issued through
+// the client. Interceptors are applied in the order they are registered, that
+// is, the first interceptor is the outermost one.
+func WithInterceptor(i Interceptor) Option {
+	return func(o *options) {
+		o.interceptors = append(o.interceptors, i)
+	}
+}
+
+// WithPoolSize configures the number of connections maintained by the
+// client. It defaults to twice the number of CPUs.
+func WithPoolSize(n int) Option {
+	return func(o *options) {
+		o.poolSize = n
+	}
+}
+
+// WithKeepalive configures the client to send a ping on pooled connections
+// which have been idle for at least d. This keeps the state of firewalls and
+// NAT devices alive and detects dead connections before they are used for a
+// request. Connections failing to respond within d are closed; they will
+// reconnect on first use. Idle connections are checked at most once per
+// millisecond, however small d is.
+func WithKeepalive(d time.Duration) Option {
+	return func(o *options) {
+		o.keepalive = d
+	}
+}
+
+// WithMaxPoolWait limits the time a request waits for a pooled connection
+// to become available. Requests exceeding that limit fail with a
+// *PoolExhaustedError, allowing the caller to shed load. If d is zero,
+// requests fail immediately if all connections are busy. By default,
+// requests wait until their context is done.
+func WithMaxPoolWait(d time.Duration) Option {
+	return func(o *options) {
+		o.maxPoolWait = d
+	}
+}
+
+// WithMaxLifetime configures the client to recycle pooled connections once
+// they have been established for at least d. This avoids using connections
+// which have been silently dropped by firewalls or load balancers.
+func WithMaxLifetime(d time.Duration) Option {
+	return func(o *options) {
+		o.maxLifetime = d
+	}
+}
+
+// WithMaxRequests configures the client to recycle pooled connections after
+// they have been used for n requests.
+func WithMaxRequests(n int) Option {
+	return func(o *options) {
+		o.maxRequests = n
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
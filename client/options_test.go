@@ -0,0 +1,136 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package client
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sysdb/go/proto"
+)
+
+func TestTLSOptions(t *testing.T) {
+	base := &tls.Config{MinVersion: tls.VersionTLS12}
+	verify := func([][]byte, [][]*x509.Certificate) error { return nil }
+	o := newOptions([]Option{
+		WithTLSConfig(base),
+		WithTLSServerName("sysdb.example.com"),
+		WithTLSSessionCache(0),
+		WithVerifyPeerCertificate(verify),
+	})
+
+	if o.tls == base {
+		t.Errorf("TLS options modified the configuration passed to WithTLSConfig")
+	}
+	if base.ServerName != "" {
+		t.Errorf("WithTLSServerName() modified the original configuration: ServerName = %q", base.ServerName)
+	}
+	if o.tls.MinVersion != tls.VersionTLS12 || o.tls.ServerName != "sysdb.example.com" ||
+		o.tls.ClientSessionCache == nil || o.tls.VerifyPeerCertificate == nil {
+		t.Errorf("TLS options = %+v; want MinVersion, ServerName, ClientSessionCache, VerifyPeerCertificate set", o.tls)
+	}
+
+	// Modifications do not depend on the order of the options.
+	o = newOptions([]Option{
+		WithTLSServerName("sysdb.example.com"),
+		WithTLSNextProtos("sysdb/1", "sysdb"),
+		WithTLSConfig(base),
+	})
+	if o.tls == base || o.tls.MinVersion != tls.VersionTLS12 || o.tls.ServerName != "sysdb.example.com" ||
+		!reflect.DeepEqual(o.tls.NextProtos, []string{"sysdb/1", "sysdb"}) {
+		t.Errorf("TLS options before WithTLSConfig() = %+v; want MinVersion, ServerName, NextProtos set", o.tls)
+	}
+	if len(base.NextProtos) != 0 {
+		t.Errorf("WithTLSNextProtos() modified the original configuration: NextProtos = %q", base.NextProtos)
+	}
+
+	// Connections of a client share the session cache.
+	cache := []Option{WithTLSSessionCache(0)}
+	if a, b := newOptions(cache), newOptions(cache); a.tls.ClientSessionCache != b.tls.ClientSessionCache {
+		t.Errorf("WithTLSSessionCache() creates a new cache for each connection")
+	}
+
+	if o := newOptions([]Option{WithTLSServerName("db")}); o.tls == nil || o.tls.ServerName != "db" {
+		t.Errorf("WithTLSServerName() without WithTLSConfig = %+v; want ServerName db", o.tls)
+	}
+	if o := newOptions(nil); o.tls != nil {
+		t.Errorf("TLS is enabled by default: %+v", o.tls)
+	}
+}
+
+func TestDialerOptions(t *testing.T) {
+	local := &net.Dialer{KeepAlive: time.Minute}
+	for _, test := range []struct {
+		opts      []Option
+		timeout   time.Duration
+		keepAlive time.Duration
+	}{
+		{nil, 0, 0},
+		{[]Option{WithDialer(nil)}, 0, 0},
+		{[]Option{WithDialer(nil), WithDialTimeout(time.Second)}, time.Second, 0},
+		{[]Option{WithDialTimeout(time.Second), WithDialer(nil)}, 0, 0},
+		{[]Option{WithDialer(local), WithDialTimeout(time.Second)}, time.Second, time.Minute},
+		{[]Option{WithDialTimeout(time.Second), WithDialer(local)}, 0, time.Minute},
+	} {
+		o := newOptions(test.opts)
+		if o.dialer == nil || o.dialer.Timeout != test.timeout || o.dialer.KeepAlive != test.keepAlive {
+			t.Errorf("newOptions(%d options).dialer = %+v; want Timeout %v, KeepAlive %v",
+				len(test.opts), o.dialer, test.timeout, test.keepAlive)
+		}
+	}
+	if local.Timeout != 0 {
+		t.Errorf("WithDialTimeout() modified the dialer passed to WithDialer: Timeout = %v", local.Timeout)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	s := newTestServer(t, func(req *proto.Message) []*proto.Message {
+		return []*proto.Message{{Type: proto.ConnectionOK}}
+	})
+	defer s.close()
+
+	var out bytes.Buffer
+	c, err := Dial(s.addr(), "test", WithTrace(&out))
+	if err != nil {
+		t.Fatalf("Dial() = %v", err)
+	}
+	defer c.Close()
+	if _, err := c.Call(&proto.Message{Type: proto.ConnectionPing}); err != nil {
+		t.Fatalf("Call(PING) = %v", err)
+	}
+
+	want := "> STARTUP (4 bytes) \"test\"\n< OK (0 bytes)\n> PING (0 bytes)\n< OK (0 bytes)\n"
+	if got := out.String(); got != want {
+		t.Errorf("WithTrace() logged %q; want %q", got, want)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,128 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package client
+
+import (
+	"encoding/base64"
+	"reflect"
+	"strconv"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+// A Pager iterates over the result of a query in pages of a fixed size:
+//
+//	p := c.Pages("LOOKUP hosts MATCHING attribute.architecture = 'amd64'", 100)
+//	for p.Next() {
+//		hosts := p.Page().([]sysdb.Host)
+//		// ...
+//	}
+//	if err := p.Err(); err != nil {
+//		// handle error
+//	}
+//
+// Since the server does not support limiting results yet, the query is
+// executed once when requesting the first page and the result is split into
+// pages on the client side. A pager is not safe for concurrent use.
+type Pager struct {
+	c      *Client
+	q      string
+	size   int
+	offset int
+
+	res  reflect.Value
+	page interface{}
+	err  error
+}
+
+// Pages returns a Pager for iterating over the result of q in pages of size
+// elements. A size less than one results in a single page.
+func (c *Client) Pages(q string, size int) *Pager {
+	return &Pager{c: c, q: q, size: size}
+}
+
+// ResumePages returns a Pager for iterating over the result of q starting at
+// the page identified by a continuation token (see Pager.Token).
+func (c *Client) ResumePages(q string, size int, token string) (*Pager, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, sysdb.Errorf(sysdb.CodeInvalidArgument, "invalid continuation token %q", token)
+	}
+	offset, err := strconv.Atoi(string(b))
+	if err != nil || offset < 0 {
+		return nil, sysdb.Errorf(sysdb.CodeInvalidArgument, "invalid continuation token %q", token)
+	}
+	return &Pager{c: c, q: q, size: size, offset: offset}, nil
+}
+
+// Next advances to the next page, which will then be available through Page.
+// It returns false when there are no more pages or if an error occurred.
+func (p *Pager) Next() bool {
+	if p.err != nil {
+		return false
+	}
+	if !p.res.IsValid() {
+		res, err := p.c.Query(p.q)
+		if err != nil {
+			p.err = err
+			return false
+		}
+		p.res = reflect.ValueOf(res)
+		if p.res.Kind() != reflect.Slice {
+			p.err = sysdb.Errorf(sysdb.CodeUnsupported, "cannot paginate result of type %T", res)
+			return false
+		}
+	}
+
+	n := p.res.Len()
+	if p.offset >= n {
+		p.page = nil
+		return false
+	}
+	end := n
+	if p.size > 0 && p.offset+p.size < n {
+		end = p.offset + p.size
+	}
+	p.page = p.res.Slice(p.offset, end).Interface()
+	p.offset = end
+	return true
+}
+
+// Page returns the current page. It is a slice of the same type as the
+// result of Client.Query.
+func (p *Pager) Page() interface{} { return p.page }
+
+// Err returns the first error encountered by the pager.
+func (p *Pager) Err() error { return p.err }
+
+// Token returns a continuation token identifying the next page. Use it with
+// ResumePages to continue iterating, for example in a subsequent HTTP
+// request.
+func (p *Pager) Token() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(p.offset)))
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,88 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package client
+
+import (
+	"testing"
+
+	"github.com/sysdb/go/proto"
+	"github.com/sysdb/go/sysdb"
+)
+
+func TestPager(t *testing.T) {
+	s := newTestServer(t, func(req *proto.Message) []*proto.Message {
+		return []*proto.Message{dataMessage(proto.ConnectionList,
+			`[{"name": "a"}, {"name": "b"}, {"name": "c"}, {"name": "d"}, {"name": "e"}]`)}
+	})
+	defer s.close()
+
+	c, err := Connect(s.addr(), "test")
+	if err != nil {
+		t.Fatalf("Connect() = %v", err)
+	}
+	defer c.Close()
+
+	names := func(p *Pager) []string {
+		var res []string
+		for _, h := range p.Page().([]sysdb.Host) {
+			res = append(res, h.Name)
+		}
+		return res
+	}
+
+	p := c.Pages("LIST hosts", 2)
+	var pages [][]string
+	var token string
+	for p.Next() {
+		pages = append(pages, names(p))
+		if len(pages) == 1 {
+			token = p.Token()
+		}
+	}
+	if err := p.Err(); err != nil || len(pages) != 3 || len(pages[2]) != 1 || pages[2][0] != "e" {
+		t.Errorf("Pages() = %v, %v; want [[a b] [c d] [e]], <nil>", pages, err)
+	}
+
+	p, err = c.ResumePages("LIST hosts", 3, token)
+	if err != nil {
+		t.Fatalf("ResumePages(%q) = %v", token, err)
+	}
+	if !p.Next() {
+		t.Fatalf("ResumePages(%q).Next() = false; want true (%v)", token, p.Err())
+	}
+	if got := names(p); len(got) != 3 || got[0] != "c" || got[2] != "e" {
+		t.Errorf("ResumePages(%q).Page() = %v; want [c d e]", token, got)
+	}
+	if p.Next() {
+		t.Errorf("ResumePages(%q).Next() = true; want false", token)
+	}
+
+	if _, err := c.ResumePages("LIST hosts", 3, "!"); err == nil {
+		t.Errorf("ResumePages(\"!\") = <nil>; want <err>")
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,262 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package client
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/sysdb/go/proto"
+	"github.com/sysdb/go/sysdb"
+)
+
+// A QueryPolicy decides whether a query may be sent to the server. It returns
+// a non-nil error to reject the query.
+type QueryPolicy func(q string) error
+
+// WithQueryPolicy registers a policy which is checked for each query issued
+// through the client before it is sent to the server. This includes queries
+// sent using Batch or Stream.
+func WithQueryPolicy(p QueryPolicy) Option {
+	intercept := WithInterceptor(func(next CallFunc) CallFunc {
+		return func(ctx context.Context, req *proto.Message) (*proto.Message, error) {
+			if req.Type == proto.ConnectionQuery {
+				if err := p(string(req.Raw)); err != nil {
+					return nil, err
+				}
+			}
+			return next(ctx, req)
+		}
+	})
+	return func(o *options) {
+		intercept(o)
+		o.policies = append(o.policies, p)
+	}
+}
+
+// checkQuery checks q against all of the client's query policies.
+func (c *Client) checkQuery(q string) error {
+	for _, p := range c.policies {
+		if err := p(q); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsUnbounded reports whether q contains a LIST or LOOKUP statement which is
+// expected to return the entire store. These are:
+//
+//   - LIST statements without a FILTER clause,
+//   - LOOKUP statements without a MATCHING or FILTER clause, and
+//   - LOOKUP statements without a FILTER clause whose MATCHING clause is
+//     trivially true, that is, if all conditions of any of its top-level OR
+//     alternatives are trivially true. If the clause contains parentheses,
+//     all of its conditions have to be trivially true.
+//
+// A condition is trivially true if it compares the object name using != to
+// the empty string or using =~ to a regular expression obviously matching any
+// name: one which matches the empty string and does not use anchors or
+// escapes (for example '.*') or which is '.*' or '.+' with optional anchors.
+// Conditions on anything else, negated conditions, and clauses which fail to
+// parse are always considered selective; the check is purely syntactic.
+func IsUnbounded(q string) bool {
+	stmts, err := proto.SplitStatements(q)
+	if err != nil {
+		return false
+	}
+	for _, stmt := range stmts {
+		if isUnboundedStmt(tokenize(stmt)) {
+			return true
+		}
+	}
+	return false
+}
+
+func isUnboundedStmt(toks []string) bool {
+	if len(toks) < 2 {
+		return false
+	}
+	matching := -1
+	for i, tok := range toks {
+		switch strings.ToUpper(tok) {
+		case "FILTER":
+			return false
+		case "MATCHING":
+			if matching < 0 {
+				matching = i
+			}
+		}
+	}
+
+	switch strings.ToUpper(toks[0]) {
+	case "LIST":
+		return matching < 0
+	case "LOOKUP":
+		return matching < 0 || isTrivialClause(toks[matching+1:])
+	}
+	return false
+}
+
+// isTrivialClause reports whether the MATCHING clause toks is trivially
+// true.
+func isTrivialClause(toks []string) bool {
+	if len(toks) == 0 {
+		return false
+	}
+	for _, tok := range toks {
+		if strings.EqualFold(tok, "NOT") {
+			return false
+		}
+	}
+	if len(toks) > 1 && toks[0] == "(" && toks[len(toks)-1] == ")" {
+		return isTrivialClause(toks[1 : len(toks)-1])
+	}
+
+	// With parentheses, the top-level alternatives are not readily
+	// available; require all conditions to be trivially true in that case.
+	grouped := false
+	for _, tok := range toks {
+		if tok == "(" || tok == ")" {
+			grouped = true
+		}
+	}
+
+	alt := true
+	for len(toks) > 0 {
+		tok := toks[0]
+		switch {
+		case tok == "(" || tok == ")" || strings.EqualFold(tok, "AND"):
+			toks = toks[1:]
+		case strings.EqualFold(tok, "OR"):
+			if !grouped {
+				if alt {
+					return true
+				}
+				alt = true
+			}
+			toks = toks[1:]
+		case len(toks) >= 3:
+			alt = alt && isTrivialCond(toks[0], toks[1], toks[2])
+			toks = toks[3:]
+		default:
+			return false
+		}
+	}
+	return alt
+}
+
+// isTrivialCond reports whether the condition "field op value" is true for
+// any object.
+func isTrivialCond(field, op, value string) bool {
+	if !strings.EqualFold(field, "name") {
+		return false
+	}
+	v, err := proto.UnescapeString(value)
+	if err != nil {
+		return false
+	}
+	switch op {
+	case "!=":
+		return v == ""
+	case "=~":
+		return matchesAny(v)
+	}
+	return false
+}
+
+// matchesAny reports whether the regular expression re obviously matches any
+// non-empty name.
+func matchesAny(re string) bool {
+	switch strings.TrimSuffix(strings.TrimPrefix(re, "^"), "$") {
+	case ".*", ".+":
+		return true
+	}
+	r, err := regexp.Compile(re)
+	if err != nil || !r.MatchString("") {
+		return false
+	}
+	return !strings.ContainsAny(re, "^$\\")
+}
+
+// tokenize splits the statement s into words, string literals, operators,
+// and other punctuation.
+func tokenize(s string) []string {
+	var toks []string
+	for i := 0; i < len(s); {
+		c := s[i]
+		j := i + 1
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i = j
+			continue
+		case c == '\'':
+			for ; j < len(s); j++ {
+				if s[j] != '\'' {
+					continue
+				}
+				if j+1 < len(s) && s[j+1] == '\'' {
+					j++
+					continue
+				}
+				j++
+				break
+			}
+		case isWordByte(c):
+			for j < len(s) && isWordByte(s[j]) {
+				j++
+			}
+		case strings.IndexByte("=!~<>", c) >= 0:
+			for j < len(s) && strings.IndexByte("=!~<>", s[j]) >= 0 {
+				j++
+			}
+		}
+		toks = append(toks, s[i:j])
+		i = j
+	}
+	return toks
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c == '.' || c >= 0x80 ||
+		'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+// RejectUnbounded returns a policy rejecting unbounded queries (see
+// IsUnbounded) unless confirm returns true for the query. If confirm is nil,
+// all unbounded queries will be rejected with an error of code
+// sysdb.CodePolicyViolation.
+func RejectUnbounded(confirm func(q string) bool) QueryPolicy {
+	return func(q string) error {
+		if !IsUnbounded(q) || (confirm != nil && confirm(q)) {
+			return nil
+		}
+		return sysdb.Errorf(sysdb.CodePolicyViolation, "refusing unbounded query %q", q)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,83 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package client
+
+import (
+	"testing"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+func TestRejectUnbounded(t *testing.T) {
+	for _, test := range []struct {
+		q         string
+		unbounded bool
+	}{
+		{"LOOKUP hosts", true},
+		{"lookup services;", true},
+		{"LOOKUP hosts MATCHING name =~ '.*'", true},
+		{"LOOKUP hosts MATCHING name =~ '^.*$';", true},
+		{"LOOKUP hosts MATCHING name =~ ''", true},
+		{"LOOKUP hosts MATCHING name =~ 'db'", false},
+		{"LOOKUP hosts MATCHING attribute.architecture = 'amd64'", false},
+		{"LOOKUP hosts MATCHING name=~'.+'", true},
+		{"LOOKUP hosts MATCHING name =~ '^'", false},
+		{"LOOKUP hosts MATCHING name =~ 'a*'", true},
+		{"LOOKUP hosts MATCHING name != ''", true},
+		{"LOOKUP hosts MATCHING name != 'a'", false},
+		{"LOOKUP hosts MATCHING NOT name =~ '.*'", false},
+		{"LOOKUP hosts MATCHING name =~ '.*' AND name != ''", true},
+		{"LOOKUP hosts MATCHING name =~ 'db' OR name =~ '.*'", true},
+		{"LOOKUP hosts MATCHING name =~ 'db' AND name =~ '.*'", false},
+		{"LOOKUP hosts MATCHING (name =~ '.*')", true},
+		{"LOOKUP hosts MATCHING (name =~ 'db' OR name =~ '.*') AND name != ''", false},
+		{"LOOKUP hosts MATCHING (name =~ 'db') OR name =~ '.*'", false},
+		{"LOOKUP hosts MATCHING name =~ 'it''s'", false},
+		{"LOOKUP hosts MATCHING attribute.x =~ '.*'", false},
+		{"LOOKUP hosts MATCHING name =~ '.*' FILTER age < 5m", false},
+		{"LIST hosts", true},
+		{"list services;", true},
+		{"LIST metrics", true},
+		{"LIST hosts FILTER age < 5m", false},
+		{"FETCH host 'a'; LIST hosts", true},
+		{"FETCH host 'a'", false},
+		{"FETCH host 'LIST'", false},
+	} {
+		if got := IsUnbounded(test.q); got != test.unbounded {
+			t.Errorf("IsUnbounded(%q) = %v; want %v", test.q, got, test.unbounded)
+		}
+
+		err := RejectUnbounded(nil)(test.q)
+		if (err != nil) != test.unbounded || (err != nil && sysdb.ErrorCode(err) != sysdb.CodePolicyViolation) {
+			t.Errorf("RejectUnbounded(nil)(%q) = %v; want error: %v", test.q, err, test.unbounded)
+		}
+		if err := RejectUnbounded(func(string) bool { return true })(test.q); err != nil {
+			t.Errorf("RejectUnbounded(<confirm>)(%q) = %v; want <nil>", test.q, err)
+		}
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
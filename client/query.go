@@ -26,9 +26,11 @@
 package client
 
 import (
-	"errors"
+	"context"
 	"fmt"
+	"reflect"
 	"regexp"
+	"strings"
 	"time"
 
 	"github.com/sysdb/go/proto"
@@ -36,32 +38,73 @@ import (
 )
 
 // An Identifier is a string that may not be quoted or escaped in a query.
+// It is embedded into queries as is, so it must never carry untrusted input;
+// use EscapeIdentifier to construct identifiers from such input.
 type Identifier string
 
+var identifierRE = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$]*(\.[A-Za-z_][A-Za-z0-9_$]*)*$`)
+
+// EscapeIdentifier validates s for use as an identifier (e.g. an object type
+// or field name) in a query. SysQL does not support quoting identifiers, so
+// anything but letters, digits, underscores, and dollar signs, optionally
+// separated by dots (as in attribute.name), is rejected. In particular, this
+// includes whitespace, quotes, and semicolons.
+func EscapeIdentifier(s string) (Identifier, error) {
+	if !identifierRE.MatchString(s) {
+		return "", sysdb.Errorf(sysdb.CodeInvalidArgument, "invalid identifier %q", s)
+	}
+	return Identifier(s), nil
+}
+
 // The default format for date-time values.
 var dtFormat = "2006-01-02 15:04:05"
 
 func stringify(values ...interface{}) ([]interface{}, error) {
 	str := make([]interface{}, len(values))
 	for i, v := range values {
-		switch val := v.(type) {
-		case uint8, uint16, uint32, uint64, int8, int16, int32, int64, int:
-			str[i] = fmt.Sprintf("%d", val)
-		case float32, float64:
-			str[i] = fmt.Sprintf("%e", val)
-		case Identifier:
-			str[i] = string(val)
-		case string:
-			str[i] = proto.EscapeString(val)
-		case time.Time:
-			str[i] = val.Format(dtFormat)
-		default:
-			return nil, fmt.Errorf("cannot embed value %v of type %T in query", v, v)
+		s, err := stringifyValue(v)
+		if err != nil {
+			return nil, err
 		}
+		str[i] = s
 	}
 	return str, nil
 }
 
+func stringifyValue(v interface{}) (string, error) {
+	switch val := v.(type) {
+	case uint8, uint16, uint32, uint64, int8, int16, int32, int64, int:
+		return fmt.Sprintf("%d", val), nil
+	case float32, float64:
+		return fmt.Sprintf("%e", val), nil
+	case bool:
+		return fmt.Sprintf("%t", val), nil
+	case Identifier:
+		return string(val), nil
+	case string:
+		return proto.EscapeString(val), nil
+	case time.Time:
+		return val.Format(dtFormat), nil
+	case time.Duration:
+		return stringifyValue(sysdb.Duration(val))
+	case sysdb.Duration:
+		return val.Format(sysdb.Compact), nil
+	}
+
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		elems := make([]string, rv.Len())
+		for i := range elems {
+			s, err := stringifyValue(rv.Index(i).Interface())
+			if err != nil {
+				return "", err
+			}
+			elems[i] = s
+		}
+		return "[" + strings.Join(elems, ", ") + "]", nil
+	}
+	return "", sysdb.Errorf(sysdb.CodeInvalidArgument, "cannot embed value %v of type %T in query", v, v)
+}
+
 // The fmt package does not expose these errors except through the formatted
 // string. Let's just assume that this pattern never occurs in a real query
 // string (or else, users will have to work around this by not using
@@ -70,8 +113,12 @@ var badArgRE = regexp.MustCompile(`%!?[A-Za-z]?\(.+`)
 
 // QueryString formats a query string. The query q may include printf string
 // verbs (%s) for each argument. The arguments may be of type Identifier,
-// string, or time.Time and will be formatted to make them suitable for use in
-// a query.
+// string, any integer or floating point type, bool, time.Time, time.Duration,
+// or sysdb.Duration and will be formatted to make them suitable for use in a
+// query. Durations are formatted as interval literals. Slices and arrays of
+// any of these types are formatted as array literals (e.g. for use with the
+// IN operator). All values are formatted independent of the user's
+// locale to ensure that the server is able to parse them.
 //
 // This function tries to prevent injection attacks but it's not fool-proof.
 // It will go away once the SysDB network protocol supports arguments to
@@ -86,28 +133,109 @@ func QueryString(q string, args ...interface{}) (string, error) {
 
 	// Try to identify format string errors.
 	if e := badArgRE.Find([]byte(str)); e != nil {
-		return "", errors.New(string(e))
+		return "", sysdb.Errorf(sysdb.CodeInvalidArgument, "%s", e)
 	}
 
 	return str, nil
 }
 
-// Query executes a query on the server. It returns a sysdb object on success.
-func (c *Client) Query(q string) (interface{}, error) {
-	res, err := c.Call(&proto.Message{
+// query executes a query on the server and passes the DATA reply to decode.
+// The reply is released to the message pool afterwards, so decode must not
+// retain any references to it. The time spent decoding is recorded in the
+// request's stats which are reported once the result has been decoded.
+func (c *Client) query(ctx context.Context, q string, decode func(*proto.Message) error) error {
+	st := statsFromContext(ctx)
+	st.query = true
+	defer func() {
+		st.query = false
+		observeStats(c.metrics, proto.ConnectionQuery, st)
+	}()
+
+	res, err := c.CallContext(WithStats(ctx, st), &proto.Message{
 		Type: proto.ConnectionQuery,
 		Raw:  []byte(q),
 	})
 	if err != nil {
-		return nil, err
+		return err
 	}
+	// Nothing refers to the reply once it has been decoded.
+	defer proto.ReleaseMessage(res)
 	if res.Type != proto.ConnectionData {
-		return nil, fmt.Errorf("unexpected result type %d", res.Type)
+		return sysdb.Errorf(sysdb.CodeUnexpectedMessage, "unexpected result type %s", res.Type)
 	}
 
+	start := time.Now()
+	err = decode(res)
+	st.Decode = time.Since(start)
+	return err
+}
+
+// QueryInto executes a query on the server and decodes the result into the
+// value pointed to by v. Any type suitable for decoding the JSON
+// representation of the result may be used, allowing to use custom types
+// instead of the types defined in the sysdb package.
+func (c *Client) QueryInto(q string, v interface{}) error {
+	return c.QueryIntoContext(context.Background(), q, v)
+}
+
+// QueryIntoContext is like QueryInto but passes the specified context to all
+// interceptors.
+func (c *Client) QueryIntoContext(ctx context.Context, q string, v interface{}) error {
+	return c.query(ctx, q, func(res *proto.Message) error {
+		if err := proto.Unmarshal(res, v); err != nil {
+			return sysdb.Errorf(sysdb.CodeMalformedMessage, "failed to unmarshal response: %v", err)
+		}
+		return nil
+	})
+}
+
+// QueryHosts executes a LIST or LOOKUP query on the server and passes the
+// returned hosts to fn one at a time. Unlike QueryInto, the hosts are
+// decoded incrementally such that the complete list never has to be held in
+// memory. Decoding stops at the first error returned by fn which is then
+// returned by QueryHosts. See proto.DecodeHosts for details.
+func (c *Client) QueryHosts(q string, fn func(*sysdb.Host) error) error {
+	return c.QueryHostsContext(context.Background(), q, fn)
+}
+
+// QueryHostsContext is like QueryHosts but passes the specified context to
+// all interceptors.
+func (c *Client) QueryHostsContext(ctx context.Context, q string, fn func(*sysdb.Host) error) error {
+	return c.query(ctx, q, func(res *proto.Message) error {
+		return proto.DecodeHosts(res, fn)
+	})
+}
+
+// Query executes a query on the server. It returns a sysdb object on success.
+//
+// FETCH queries return a *sysdb.Host, *sysdb.Service, or *sysdb.Metric
+// depending on the type of the fetched object. LIST and LOOKUP queries return
+// []sysdb.Host, sysdb.ServiceList, or sysdb.MetricList depending on the type
+// of the queried objects.
+func (c *Client) Query(q string) (interface{}, error) {
+	return c.QueryContext(context.Background(), q)
+}
+
+// QueryContext is like Query but passes the specified context to all
+// interceptors.
+func (c *Client) QueryContext(ctx context.Context, q string) (interface{}, error) {
+	var obj interface{}
+	err := c.query(ctx, q, func(res *proto.Message) (err error) {
+		obj, err = DecodeQuery(q, res)
+		return err
+	})
+	return obj, err
+}
+
+// Decode decodes the DATA message res into the matching object type defined
+// in the sysdb package. Data of types registered using
+// proto.RegisterDataType is decoded into the value returned by the
+// respective factory. The type of lists is determined by Message.DataType;
+// use DecodeQuery if the query is known.
+func Decode(res *proto.Message) (interface{}, error) {
 	t, err := res.DataType()
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal response: %v", err)
+		return nil, sysdb.Errorf(sysdb.CodeMalformedMessage, "failed to unmarshal response: %v", err)
 	}
 
 	var obj interface{}
@@ -124,11 +252,22 @@ func (c *Client) Query(q string) (interface{}, error) {
 		var ts sysdb.Timeseries
 		err = proto.Unmarshal(res, &ts)
 		obj = &ts
+	case proto.ServiceList:
+		var l sysdb.ServiceList
+		err = proto.Unmarshal(res, &l)
+		obj = l
+	case proto.MetricList:
+		var l sysdb.MetricList
+		err = proto.Unmarshal(res, &l)
+		obj = l
 	default:
-		return nil, fmt.Errorf("unsupported data type %d", t)
+		if obj = t.New(); obj == nil {
+			return nil, sysdb.Errorf(sysdb.CodeUnsupported, "unsupported data type %s", t)
+		}
+		err = proto.Unmarshal(res, obj)
 	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal response: %v", err)
+		return nil, sysdb.Errorf(sysdb.CodeMalformedMessage, "failed to unmarshal response: %v", err)
 	}
 	return obj, nil
 }
@@ -26,8 +26,14 @@
 package client
 
 import (
+	"context"
+	"errors"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/sysdb/go/proto"
+	"github.com/sysdb/go/sysdb"
 )
 
 func TestQueryString(t *testing.T) {
@@ -48,6 +54,13 @@ func TestQueryString(t *testing.T) {
 		{"s=%s", []interface{}{`multi
 line
 text`}, "s='multi\nline\ntext'", false},
+		{"b=%s", []interface{}{true}, "b=true", false},
+		{"d=%s", []interface{}{90 * time.Minute}, "d=1h30m", false},
+		{"d=%s", []interface{}{sysdb.Year + sysdb.Day}, "d=1Y1D", false},
+		{"l=%s", []interface{}{[]string{"a", "b'c"}}, "l=['a', 'b''c']", false},
+		{"l=%s", []interface{}{[]int{1, 2, 3}}, "l=[1, 2, 3]", false},
+		{"l=%s", []interface{}{[]string{}}, "l=[]", false},
+		{"l=%s", []interface{}{[]interface{}{1, struct{}{}}}, "", true},
 		{"s=%d", []interface{}{`multi
 line
 error`}, "", true},
@@ -63,4 +76,158 @@ error`}, "", true},
 	}
 }
 
+func TestEscapeIdentifier(t *testing.T) {
+	for _, test := range []struct {
+		s       string
+		wantErr bool
+	}{
+		{"host", false},
+		{"last_update", false},
+		{"attribute.architecture", false},
+		{"_x$1", false},
+		{"", true},
+		{"1host", true},
+		{"host name", true},
+		{"host;", true},
+		{"host'", true},
+		{`ho"st`, true},
+		{"attribute.", true},
+		{"a..b", true},
+		{"host\n", true},
+	} {
+		id, err := EscapeIdentifier(test.s)
+		if test.wantErr {
+			if sysdb.ErrorCode(err) != sysdb.CodeInvalidArgument {
+				t.Errorf("EscapeIdentifier(%q) = %q, %v; want <error %v>", test.s, id, err, sysdb.CodeInvalidArgument)
+			}
+		} else if err != nil || string(id) != test.s {
+			t.Errorf("EscapeIdentifier(%q) = %q, %v; want %q, <nil>", test.s, id, err, test.s)
+		}
+	}
+}
+
+func TestQueryInto(t *testing.T) {
+	s := newTestServer(t, func(req *proto.Message) []*proto.Message {
+		return []*proto.Message{dataMessage(proto.ConnectionList,
+			`[{"name": "h1", "backends": ["b1"]}, {"name": "h2"}]`)}
+	})
+	defer s.close()
+
+	c, err := Connect(s.addr(), "test")
+	if err != nil {
+		t.Fatalf("Connect() = %v", err)
+	}
+	defer c.Close()
+
+	var hosts []struct {
+		Name     string
+		Backends []string
+	}
+	if err := c.QueryInto("LIST hosts", &hosts); err != nil {
+		t.Fatalf("QueryInto() = %v", err)
+	}
+	if len(hosts) != 2 || hosts[0].Name != "h1" || len(hosts[0].Backends) != 1 || hosts[1].Name != "h2" {
+		t.Errorf("QueryInto() decoded %+v; want [h1 [b1]] [h2 []]", hosts)
+	}
+}
+
+func TestQueryReleasesReplies(t *testing.T) {
+	s := newTestServer(t, func(req *proto.Message) []*proto.Message {
+		if string(req.Raw) == "LIST hosts" {
+			return []*proto.Message{dataMessage(proto.ConnectionList, `[{"name": "h1"}]`)}
+		}
+		return []*proto.Message{dataMessage(proto.ConnectionFetch, `{"name": "h1"}`)}
+	})
+	defer s.close()
+
+	var replies []*proto.Message
+	record := func(next CallFunc) CallFunc {
+		return func(ctx context.Context, req *proto.Message) (*proto.Message, error) {
+			res, err := next(ctx, req)
+			replies = append(replies, res)
+			return res, err
+		}
+	}
+	c, err := Connect(s.addr(), "test", WithInterceptor(record))
+	if err != nil {
+		t.Fatalf("Connect() = %v", err)
+	}
+	defer c.Close()
+
+	var host sysdb.Host
+	if err := c.QueryInto("FETCH host 'h1'", &host); err != nil || host.Name != "h1" {
+		t.Errorf("QueryInto() = %v (host: %v); want <nil> (host: h1)", err, host.Name)
+	}
+	if obj, err := c.Query("FETCH host 'h1'"); err != nil || obj.(*sysdb.Host).Name != "h1" {
+		t.Errorf("Query() = %v, %v; want h1, <nil>", obj, err)
+	}
+	if err := c.QueryHosts("LIST hosts", func(h *sysdb.Host) error { return nil }); err != nil {
+		t.Errorf("QueryHosts() = %v; want <nil>", err)
+	}
+	if len(replies) != 3 {
+		t.Fatalf("queries received %d replies; want 3", len(replies))
+	}
+	for i, res := range replies {
+		// ReleaseMessage resets the message.
+		if res.Type != 0 || len(res.Raw) != 0 {
+			t.Errorf("reply %d = %v; want it to be released", i, res)
+		}
+	}
+}
+
+func TestQueryHosts(t *testing.T) {
+	s := newTestServer(t, func(req *proto.Message) []*proto.Message {
+		return []*proto.Message{dataMessage(proto.ConnectionList,
+			`[{"name": "h1", "backends": ["b1"]}, {"name": "h2"}, {"name": "h3"}]`)}
+	})
+	defer s.close()
+
+	c, err := Connect(s.addr(), "test")
+	if err != nil {
+		t.Fatalf("Connect() = %v", err)
+	}
+	defer c.Close()
+
+	var names []string
+	if err := c.QueryHosts("LIST hosts", func(h *sysdb.Host) error {
+		names = append(names, h.Name)
+		return nil
+	}); err != nil || len(names) != 3 || names[0] != "h1" || names[2] != "h3" {
+		t.Errorf("QueryHosts() = %v (hosts: %v); want <nil> (hosts: [h1 h2 h3])", err, names)
+	}
+
+	stop := errors.New("stop")
+	names = nil
+	if err := c.QueryHosts("LIST hosts", func(h *sysdb.Host) error {
+		names = append(names, h.Name)
+		return stop
+	}); err != stop || len(names) != 1 {
+		t.Errorf("QueryHosts(<stop>) = %v (hosts: %v); want %v (hosts: [h1])", err, names, stop)
+	}
+}
+
+type testStatus struct{ Uptime int }
+
+// registerStatus registers the data type of testStatus once per process;
+// the registry does not support removing data types.
+var registerStatus = sync.OnceValue(func() error {
+	_, err := proto.RegisterDataType(4800, "ClientTestStatus", func() interface{} { return new(testStatus) })
+	return err
+})
+
+func TestDecodeRegistered(t *testing.T) {
+	cmd := proto.Status(4800)
+	if err := registerStatus(); err != nil {
+		t.Fatalf("RegisterDataType() = %v", err)
+	}
+
+	obj, err := Decode(dataMessage(cmd, `{"Uptime": 42}`))
+	if s, ok := obj.(*testStatus); err != nil || !ok || s.Uptime != 42 {
+		t.Errorf("Decode(<registered type>) = %#v, %v; want &{42}, <nil>", obj, err)
+	}
+	if obj, err := Decode(dataMessage(cmd+1, `{}`)); sysdb.ErrorCode(err) != sysdb.CodeMalformedMessage {
+		t.Errorf("Decode(<unknown type>) = %#v, %v; want <error %v>", obj, err, sysdb.CodeMalformedMessage)
+	}
+}
+
 // vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,94 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package client
+
+import (
+	"context"
+	"sync"
+)
+
+// A QueryResult is the outcome of a single query of QueryAll.
+type QueryResult struct {
+	Res interface{}
+	Err error
+}
+
+// QueryAll executes the specified queries in parallel and returns their
+// results (see Query) in the order of the queries. At most as many queries
+// as there are pooled connections are executed at the same time. It blocks
+// until all queries have finished.
+//
+// Failed queries are reported in the respective result; they do not affect
+// any other queries. Once ctx is done, any queries not yet started fail with
+// ctx.Err().
+//
+// If ctx carries a Stats object (see WithStats), each query records its
+// stats separately and the object receives the sum of all of them once all
+// queries have finished.
+func (c *Client) QueryAll(ctx context.Context, queries []string) []QueryResult {
+	results := make([]QueryResult, len(queries))
+	st, _ := ctx.Value(statsKey{}).(*Stats)
+	var stats []Stats
+	if st != nil {
+		stats = make([]Stats, len(queries))
+	}
+	sem := make(chan struct{}, cap(c.conns))
+	var wg sync.WaitGroup
+	for i, q := range queries {
+		if ctx.Err() == nil {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			for j := i; j < len(queries); j++ {
+				results[j].Err = err
+			}
+			break
+		}
+
+		wg.Add(1)
+		go func(i int, q string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			qctx := ctx
+			if stats != nil {
+				qctx = WithStats(ctx, &stats[i])
+			}
+			results[i].Res, results[i].Err = c.QueryContext(qctx, q)
+		}(i, q)
+	}
+	wg.Wait()
+	for i := range stats {
+		st.add(&stats[i])
+	}
+	return results
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
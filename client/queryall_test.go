@@ -0,0 +1,113 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/sysdb/go/proto"
+	"github.com/sysdb/go/sysdb"
+)
+
+func TestQueryAll(t *testing.T) {
+	s := newTestServer(t, func(req *proto.Message) []*proto.Message {
+		name := strings.TrimPrefix(string(req.Raw), "FETCH host ")
+		if name == "bad" {
+			return []*proto.Message{{Type: proto.ConnectionError, Raw: []byte("no such host")}}
+		}
+		return []*proto.Message{dataMessage(proto.ConnectionFetch, fmt.Sprintf(`{"name": %q}`, name))}
+	})
+	defer s.close()
+
+	c, err := Connect(s.addr(), "test", WithPoolSize(2))
+	if err != nil {
+		t.Fatalf("Connect() = %v", err)
+	}
+	defer c.Close()
+
+	queries := []string{"FETCH host h1", "FETCH host bad", "FETCH host h2", "FETCH host h3", "FETCH host h4"}
+	results := c.QueryAll(context.Background(), queries)
+	if len(results) != len(queries) {
+		t.Fatalf("QueryAll() returned %d results; want %d", len(results), len(queries))
+	}
+	for i, q := range queries {
+		r := results[i]
+		if strings.HasSuffix(q, "bad") {
+			if sysdb.ErrorCode(r.Err) != sysdb.CodeRequestFailed {
+				t.Errorf("QueryAll(): %q = %v, %v; want <error %v>", q, r.Res, r.Err, sysdb.CodeRequestFailed)
+			}
+			continue
+		}
+		h, ok := r.Res.(*sysdb.Host)
+		if r.Err != nil || !ok || "FETCH host "+h.Name != q {
+			t.Errorf("QueryAll(): %q = %v, %v; want matching host", q, r.Res, r.Err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for i, r := range c.QueryAll(ctx, queries) {
+		if r.Err == nil {
+			t.Errorf("QueryAll(<cancelled>): %q = %v, <nil>; want error", queries[i], r.Res)
+		}
+	}
+}
+
+// TestQueryAllStats is most useful when run with the race detector.
+func TestQueryAllStats(t *testing.T) {
+	s := newTestServer(t, func(req *proto.Message) []*proto.Message {
+		return []*proto.Message{dataMessage(proto.ConnectionFetch, `{"name": "h"}`)}
+	})
+	defer s.close()
+
+	c, err := Connect(s.addr(), "test", WithPoolSize(4))
+	if err != nil {
+		t.Fatalf("Connect() = %v", err)
+	}
+	defer c.Close()
+
+	var queries []string
+	sent := 0
+	for i := 0; i < 16; i++ {
+		q := fmt.Sprintf("FETCH host h%d", i)
+		queries = append(queries, q)
+		sent += 8 + len(q)
+	}
+	var st Stats
+	for i, r := range c.QueryAll(WithStats(context.Background(), &st), queries) {
+		if r.Err != nil {
+			t.Errorf("QueryAll(): %q = %v, %v; want <nil> error", queries[i], r.Res, r.Err)
+		}
+	}
+	if st.Sent != sent || st.Received == 0 {
+		t.Errorf("QueryAll() recorded %d bytes sent, %d bytes received; want %d, > 0", st.Sent, st.Received, sent)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
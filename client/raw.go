@@ -0,0 +1,73 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package client
+
+import (
+	"context"
+
+	"github.com/sysdb/go/proto"
+)
+
+// A RawResult is the reply to a raw command.
+type RawResult struct {
+	// Msg is the raw reply.
+	Msg *proto.Message
+	// Value is the decoded reply if its type is known, nil otherwise.
+	Value interface{}
+	// DecodeErr is the error encountered when decoding the reply, if any.
+	DecodeErr error
+}
+
+// Raw sends the command cmd with the specified body to the server. It allows
+// to use server commands not (yet) supported by this package. It returns the
+// raw reply along with a best-effort decoded value; failing to decode the
+// reply is not an error.
+//
+// The raw reply is owned by the caller like the reply returned by Call. The
+// decoded value does not refer to it, so the reply may be released using
+// proto.ReleaseMessage independently of the value.
+func (c *Client) Raw(cmd proto.Status, body []byte) (*RawResult, error) {
+	return c.RawContext(context.Background(), cmd, body)
+}
+
+// RawContext is like Raw but passes the specified context to all
+// interceptors.
+func (c *Client) RawContext(ctx context.Context, cmd proto.Status, body []byte) (*RawResult, error) {
+	res, err := c.CallContext(ctx, &proto.Message{Type: cmd, Raw: body})
+	if err != nil {
+		return nil, err
+	}
+
+	r := &RawResult{Msg: res}
+	if res.Type == proto.ConnectionData && cmd == proto.ConnectionQuery {
+		r.Value, r.DecodeErr = DecodeQuery(string(body), res)
+	} else if res.Type == proto.ConnectionData {
+		r.Value, r.DecodeErr = Decode(res)
+	}
+	return r, nil
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
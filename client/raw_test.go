@@ -0,0 +1,108 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package client
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sysdb/go/proto"
+	"github.com/sysdb/go/proto/prototest"
+	"github.com/sysdb/go/sysdb"
+)
+
+func TestRaw(t *testing.T) {
+	const (
+		cmdList    = proto.Status(4711)
+		cmdUnknown = proto.Status(4712)
+		cmdLog     = proto.Status(4713)
+		cmdFail    = proto.Status(4714)
+		cmdMissing = proto.Status(4715)
+	)
+	srv := prototest.NewServer()
+	defer srv.Close()
+	srv.Handle(cmdList, prototest.Response{Data: []sysdb.Host{{Name: "h1"}}, Type: proto.ConnectionList})
+	srv.Handle(cmdUnknown, prototest.Response{Data: map[string]int{"answer": 42}})
+	srv.Handle(cmdLog, prototest.Response{Log: []proto.LogMessage{{Priority: sysdb.LogInfo, Message: "working"}}})
+	srv.Handle(cmdFail, prototest.Response{Err: "not today"})
+
+	var logs []string
+	c, err := Connect(srv.Addr, "test", WithPoolSize(1), WithLogHandler(func(prio sysdb.LogPriority, msg string) {
+		logs = append(logs, msg)
+	}))
+	if err != nil {
+		t.Fatalf("Connect() = %v", err)
+	}
+	defer c.Close()
+
+	// DATA replies of known type are decoded.
+	res, err := c.Raw(cmdList, []byte("body"))
+	if err != nil {
+		t.Fatalf("Raw(%d) = %v", cmdList, err)
+	}
+	if hosts, ok := res.Value.([]sysdb.Host); res.Msg.Type != proto.ConnectionData || res.DecodeErr != nil ||
+		!ok || len(hosts) != 1 || hosts[0].Name != "h1" {
+		t.Errorf("Raw(%d) = %+v; want decoded host list", cmdList, res)
+	}
+	reqs := srv.Requests()
+	if len(reqs) != 1 || reqs[0].Type != cmdList || string(reqs[0].Raw) != "body" {
+		t.Errorf("Requests() = %v; want a single raw request", reqs)
+	}
+
+	// DATA replies of unknown type are returned as is.
+	if res, err = c.Raw(cmdUnknown, nil); err != nil {
+		t.Fatalf("Raw(%d) = %v", cmdUnknown, err)
+	}
+	if res.Msg.Type != proto.ConnectionData || res.Value != nil || res.DecodeErr == nil ||
+		!strings.HasSuffix(string(res.Msg.Raw), `{"answer":42}`) {
+		t.Errorf("Raw(%d) = %+v; want raw DATA with decode error", cmdUnknown, res)
+	}
+
+	// LOG messages are passed to the log handler.
+	if res, err = c.Raw(cmdLog, nil); err != nil {
+		t.Fatalf("Raw(%d) = %v", cmdLog, err)
+	}
+	if res.Msg.Type != proto.ConnectionOK || res.Value != nil || res.DecodeErr != nil ||
+		!reflect.DeepEqual(logs, []string{"working"}) {
+		t.Errorf("Raw(%d) = %+v (logs: %q); want OK after log message", cmdLog, res, logs)
+	}
+
+	// ERROR replies are returned as errors.
+	if res, err := c.Raw(cmdFail, nil); sysdb.ErrorCode(err) != sysdb.CodeRequestFailed || !strings.Contains(err.Error(), "not today") {
+		t.Errorf("Raw(%d) = %+v, %v; want code %s", cmdFail, res, err, sysdb.CodeRequestFailed)
+	}
+	if res, err := c.Raw(cmdMissing, nil); sysdb.ErrorCode(err) != sysdb.CodeRequestFailed || !strings.Contains(err.Error(), "Unsupported command") {
+		t.Errorf("Raw(%d) = %+v, %v; want unsupported command", cmdMissing, res, err)
+	}
+
+	// The connection remains usable.
+	if res, err := c.Raw(proto.ConnectionPing, nil); err != nil || res.Msg.Type != proto.ConnectionOK {
+		t.Errorf("Raw(PING) = %+v, %v; want OK", res, err)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
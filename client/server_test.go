@@ -0,0 +1,117 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package client
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/sysdb/go/proto"
+)
+
+// A testServer is a minimal SysDB server for testing the client. It accepts
+// any session and passes each request to a handler returning the reply
+// messages.
+type testServer struct {
+	t       *testing.T
+	dir     string
+	l       net.Listener
+	handler func(req *proto.Message) []*proto.Message
+
+	// Number of sessions started.
+	startups int32
+}
+
+func newTestServer(t *testing.T, handler func(req *proto.Message) []*proto.Message) *testServer {
+	dir, err := ioutil.TempDir("", "sysdb-client-test")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	l, err := net.Listen("unix", filepath.Join(dir, "sock"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	s := &testServer{t: t, dir: dir, l: l, handler: handler}
+	go s.serve()
+	return s
+}
+
+func (s *testServer) addr() string { return "unix:" + s.l.Addr().String() }
+
+func (s *testServer) close() {
+	s.l.Close()
+	os.RemoveAll(s.dir)
+}
+
+func (s *testServer) serve() {
+	for {
+		conn, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *testServer) handle(conn net.Conn) {
+	defer conn.Close()
+	for {
+		req, err := proto.Read(conn)
+		if err != nil {
+			return
+		}
+		var replies []*proto.Message
+		if req.Type == proto.ConnectionStartup {
+			atomic.AddInt32(&s.startups, 1)
+			replies = []*proto.Message{{Type: proto.ConnectionOK}}
+		} else {
+			replies = s.handler(req)
+		}
+		for _, res := range replies {
+			if err := proto.Write(conn, res); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// dataMessage returns a DATA message of the specified type carrying the
+// specified JSON document.
+func dataMessage(typ proto.Status, json string) *proto.Message {
+	m := &proto.Message{Type: proto.ConnectionData, Raw: make([]byte, 4+len(json))}
+	binary.BigEndian.PutUint32(m.Raw[:4], uint32(typ))
+	copy(m.Raw[4:], json)
+	return m
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
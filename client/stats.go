@@ -0,0 +1,111 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/sysdb/go/proto"
+)
+
+// Stats provides a breakdown of the time spent on a request and the amount
+// of data transferred. It allows to tell whether slow requests are caused by
+// the connection pool, the network, the server, or decoding the result.
+type Stats struct {
+	// PoolWait is the time spent waiting for a connection from the pool.
+	PoolWait time.Duration
+	// Write is the time spent sending the request.
+	Write time.Duration
+	// ServerWait is the time between sending the request and receiving
+	// the first byte of the reply.
+	ServerWait time.Duration
+	// Read is the time spent receiving the reply after its first byte.
+	Read time.Duration
+	// Decode is the time spent decoding the result of a query.
+	Decode time.Duration
+
+	// Sent and Received are the number of bytes transferred, including
+	// message headers.
+	Sent, Received int
+
+	// query indicates that the request is issued by a query function which
+	// reports the stats after decoding the result.
+	query bool
+}
+
+// Total returns the total time spent on the request.
+func (s *Stats) Total() time.Duration {
+	return s.PoolWait + s.Write + s.ServerWait + s.Read + s.Decode
+}
+
+// add adds the times and byte counts of o to s.
+func (s *Stats) add(o *Stats) {
+	s.PoolWait += o.PoolWait
+	s.Write += o.Write
+	s.ServerWait += o.ServerWait
+	s.Read += o.Read
+	s.Decode += o.Decode
+	s.Sent += o.Sent
+	s.Received += o.Received
+}
+
+// A StatsObserver receives the Stats of each request. A Metrics
+// implementation may optionally implement this interface.
+type StatsObserver interface {
+	ObserveStats(typ proto.Status, st *Stats)
+}
+
+type statsKey struct{}
+
+// WithStats returns a copy of ctx instructing the client to record the Stats
+// of a request issued using that context in st:
+//
+//	var st client.Stats
+//	res, err := c.QueryContext(client.WithStats(ctx, &st), q)
+//	log.Printf("query took %v (server: %v)", st.Total(), st.ServerWait)
+//
+// The stats object may only be used for a single request at a time.
+func WithStats(ctx context.Context, st *Stats) context.Context {
+	return context.WithValue(ctx, statsKey{}, st)
+}
+
+// statsFromContext returns the stats object of ctx or a new one.
+func statsFromContext(ctx context.Context) *Stats {
+	if st, ok := ctx.Value(statsKey{}).(*Stats); ok {
+		return st
+	}
+	return &Stats{}
+}
+
+// observeStats reports st to m if it supports it.
+func observeStats(m Metrics, typ proto.Status, st *Stats) {
+	if o, ok := m.(StatsObserver); ok {
+		o.ObserveStats(typ, st)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
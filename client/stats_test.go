@@ -0,0 +1,83 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package client
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/sysdb/go/proto"
+)
+
+type statsMetrics struct {
+	nopMetrics
+	mu    sync.Mutex
+	types []proto.Status
+}
+
+func (m *statsMetrics) ObserveStats(typ proto.Status, st *Stats) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.types = append(m.types, typ)
+}
+
+func TestStats(t *testing.T) {
+	s := newTestServer(t, func(req *proto.Message) []*proto.Message {
+		if req.Type == proto.ConnectionPing {
+			return []*proto.Message{{Type: proto.ConnectionOK}}
+		}
+		return []*proto.Message{dataMessage(proto.ConnectionFetch, `{"name": "h"}`)}
+	})
+	defer s.close()
+
+	m := &statsMetrics{}
+	c, err := Connect(s.addr(), "test", WithMetrics(m))
+	if err != nil {
+		t.Fatalf("Connect() = %v", err)
+	}
+	defer c.Close()
+
+	var st Stats
+	if _, err := c.QueryContext(WithStats(context.Background(), &st), "FETCH host 'h'"); err != nil {
+		t.Fatalf("QueryContext() = %v", err)
+	}
+	if st.Sent != 8+len("FETCH host 'h'") || st.Received != 8+4+len(`{"name": "h"}`) {
+		t.Errorf("QueryContext() stats: sent %d, received %d bytes", st.Sent, st.Received)
+	}
+	if st.Total() < st.Decode || st.Total() < st.ServerWait {
+		t.Errorf("QueryContext() stats: total %v < parts (%+v)", st.Total(), st)
+	}
+
+	if _, err := c.Call(&proto.Message{Type: proto.ConnectionPing}); err != nil {
+		t.Fatalf("Call(PING) = %v", err)
+	}
+	if len(m.types) != 2 || m.types[0] != proto.ConnectionQuery || m.types[1] != proto.ConnectionPing {
+		t.Errorf("ObserveStats() called for %v; want [QUERY PING]", m.types)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
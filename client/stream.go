@@ -0,0 +1,168 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/sysdb/go/proto"
+	"github.com/sysdb/go/sysdb"
+)
+
+// A Stream incrementally decodes the objects returned by a query. Servers
+// supporting chunked replies (see WithProtocolVersion and
+// proto.ConnectionDataChunk) send large results in multiple chunks, so only
+// a single chunk has to be held in memory at a time.
+//
+// A stream occupies one of the client's connections until all objects have
+// been read or the stream has been closed.
+type Stream struct {
+	c     *Client
+	conn  *Conn
+	stop  func() bool
+	ctx   context.Context
+	start time.Time
+	st    Stats
+
+	elems []json.RawMessage
+	cur   json.RawMessage
+	err   error
+}
+
+// Stream executes the query q and returns a stream of the returned objects.
+// The objects of lists (e.g. hosts of LIST or LOOKUP queries) are returned
+// one by one while the result of other queries is returned as a single
+// object. Unlike other requests, streamed queries are not passed through any
+// interceptors; they are checked against the client's query policies (see
+// WithQueryPolicy), though.
+func (c *Client) Stream(ctx context.Context, q string) (*Stream, error) {
+	if err := c.checkQuery(q); err != nil {
+		return nil, err
+	}
+	conn, _, err := c.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s := &Stream{c: c, conn: conn, ctx: ctx, start: time.Now()}
+	req := &proto.Message{Type: proto.ConnectionQuery, Raw: []byte(q)}
+	if err := conn.Send(req); err != nil {
+		s.finish(err)
+		return nil, err
+	}
+	s.st.Sent += 8 + len(req.Raw)
+	s.stop = conn.interruptOn(ctx)
+	return s, nil
+}
+
+// Next advances the stream to the next object which may then be decoded
+// using Decode. It returns false after the last object or if an error
+// occurred (see Err).
+func (s *Stream) Next() bool {
+	for len(s.elems) == 0 {
+		if s.conn == nil {
+			return false
+		}
+		s.read()
+	}
+	s.cur, s.elems = s.elems[0], s.elems[1:]
+	return true
+}
+
+// read reads the next chunk of the reply.
+func (s *Stream) read() {
+	res, err := next(func() (*proto.Message, error) { return s.conn.receive(nil, false) }, &s.st, s.conn.logHandler)
+	if err != nil {
+		s.finish(err)
+		return
+	}
+	switch res.Type {
+	case proto.ConnectionDataChunk:
+	case proto.ConnectionData:
+		defer s.finish(nil)
+	case proto.ConnectionOK:
+		s.finish(nil)
+		return
+	default:
+		s.finish(sysdb.Errorf(sysdb.CodeUnexpectedMessage, "unexpected result type %s", res.Type))
+		return
+	}
+	if s.elems, err = proto.Elements(res); err != nil {
+		s.finish(err)
+	}
+}
+
+// finish releases the stream's connection. Connections with a partially
+// read reply are closed.
+func (s *Stream) finish(err error) {
+	if s.conn == nil {
+		return
+	}
+	if s.stop != nil && !s.stop() {
+		s.conn.Close()
+		err = s.ctx.Err()
+	} else if err != nil && sysdb.ErrorCode(err) != sysdb.CodeRequestFailed {
+		s.conn.Close()
+	}
+	if err != nil && s.c.closed() {
+		err = ErrClosed
+	}
+	if s.err == nil {
+		s.err = err
+	}
+	s.c.metrics.ObserveRequest(proto.ConnectionQuery, err, time.Since(s.start))
+	s.c.metrics.ObserveBytes(s.st.Sent, s.st.Received)
+	s.c.release(s.conn)
+	s.conn = nil
+}
+
+// Decode decodes the current object into the value pointed to by v.
+func (s *Stream) Decode(v interface{}) error {
+	if err := json.Unmarshal(s.cur, v); err != nil {
+		return sysdb.Errorf(sysdb.CodeMalformedMessage, "failed to unmarshal object: %v", err)
+	}
+	return nil
+}
+
+// Raw returns the JSON encoding of the current object.
+func (s *Stream) Raw() json.RawMessage { return s.cur }
+
+// Err returns the first error encountered while reading the stream.
+func (s *Stream) Err() error { return s.err }
+
+// Close stops reading the stream and releases its connection. The
+// connection is closed if the reply has not been read completely.
+func (s *Stream) Close() error {
+	if s.conn != nil {
+		s.conn.Close()
+		s.finish(nil)
+	}
+	s.elems = nil
+	return nil
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,147 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/sysdb/go/proto"
+	"github.com/sysdb/go/sysdb"
+)
+
+// newChunkServer returns a server replying to all queries with n hosts,
+// using chunks of two hosts if supported by the client.
+func newChunkServer(t *testing.T, n int) (*proto.Server, string) {
+	srv := &proto.Server{
+		Handler: proto.HandlerFunc(func(s *proto.Session, req *proto.Message) (*proto.Message, error) {
+			hosts := make([]sysdb.Host, n)
+			for i := range hosts {
+				hosts[i].Name = fmt.Sprintf("h%d", i)
+			}
+			if s.Version < proto.ChunkedDataVersion {
+				return proto.Marshal(proto.ConnectionList, hosts)
+			}
+			cw := proto.NewChunkWriter(s.Conn, proto.ConnectionList, 2)
+			for _, h := range hosts {
+				if err := cw.Write(h); err != nil {
+					return nil, err
+				}
+			}
+			return nil, cw.Close()
+		}),
+	}
+	l, err := net.Listen("unix", filepath.Join(t.TempDir(), "sock"))
+	if err != nil {
+		t.Fatalf("Listen() = %v", err)
+	}
+	go srv.Serve(l)
+	return srv, "unix:" + l.Addr().String()
+}
+
+func TestStream(t *testing.T) {
+	srv, addr := newChunkServer(t, 5)
+	defer srv.Close()
+
+	for _, opts := range [][]Option{nil, {WithProtocolVersion(proto.ProtocolVersion)}} {
+		c, err := Connect(addr, "test", append(opts, WithPoolSize(1))...)
+		if err != nil {
+			t.Fatalf("Connect() = %v", err)
+		}
+
+		// Chunks are merged by Query.
+		res, err := c.Query("LIST hosts")
+		if hosts, ok := res.([]sysdb.Host); err != nil || !ok || len(hosts) != 5 || hosts[4].Name != "h4" {
+			t.Errorf("Query(LIST hosts) = %v, %v; want 5 hosts", res, err)
+		}
+
+		s, err := c.Stream(context.Background(), "LIST hosts")
+		if err != nil {
+			t.Fatalf("Stream() = %v", err)
+		}
+		var names []string
+		for s.Next() {
+			var h sysdb.Host
+			if err := s.Decode(&h); err != nil {
+				t.Errorf("Decode() = %v", err)
+			}
+			names = append(names, h.Name)
+		}
+		if err := s.Err(); err != nil || len(names) != 5 || names[0] != "h0" || names[4] != "h4" {
+			t.Errorf("Stream(LIST hosts) = %v, %v; want h0 ... h4", names, err)
+		}
+
+		// Closing a partially read stream does not affect later requests.
+		s, err = c.Stream(context.Background(), "LIST hosts")
+		if err != nil {
+			t.Fatalf("Stream() = %v", err)
+		}
+		s.Next()
+		s.Close()
+		if res, err := c.Query("LIST hosts"); err != nil || len(res.([]sysdb.Host)) != 5 {
+			t.Errorf("Query(<after Close>) = %v, %v; want 5 hosts", res, err)
+		}
+		c.Close()
+	}
+}
+
+func TestStreamPolicy(t *testing.T) {
+	srv, addr := newChunkServer(t, 5)
+	defer srv.Close()
+
+	c, err := Connect(addr, "test", WithPoolSize(1), WithMaxPoolWait(0), WithQueryPolicy(RejectUnbounded(nil)))
+	if err != nil {
+		t.Fatalf("Connect() = %v", err)
+	}
+	defer c.Close()
+
+	// The policy is checked before acquiring a connection.
+	conn, _, err := c.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("acquire() = %v", err)
+	}
+	if s, err := c.Stream(context.Background(), "LIST hosts"); sysdb.ErrorCode(err) != sysdb.CodePolicyViolation {
+		t.Errorf("Stream(LIST hosts) = %v, %v; want <policy violation>", s, err)
+	}
+	c.release(conn)
+
+	s, err := c.Stream(context.Background(), "LIST hosts FILTER age < 5m")
+	if err != nil {
+		t.Fatalf("Stream(LIST hosts FILTER ...) = %v", err)
+	}
+	n := 0
+	for s.Next() {
+		n++
+	}
+	if err := s.Err(); err != nil || n != 5 {
+		t.Errorf("Stream(LIST hosts FILTER ...) returned %d objects, %v; want 5, <nil>", n, err)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,284 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+// A ColumnType describes the values of a table column.
+type ColumnType string
+
+// Column types. Values of all types are represented as strings: times use
+// RFC 3339, durations the SysDB format, and numbers and booleans the format
+// of the strconv package. JSON columns hold the JSON encoding of nested
+// values.
+const (
+	ColumnString   ColumnType = "string"
+	ColumnTime     ColumnType = "time"
+	ColumnDuration ColumnType = "duration"
+	ColumnNumber   ColumnType = "number"
+	ColumnBool     ColumnType = "bool"
+	ColumnJSON     ColumnType = "json"
+)
+
+// A Column describes a column of a table.
+type Column struct {
+	Name string     `json:"name"`
+	Type ColumnType `json:"type"`
+}
+
+// A Table is a query result presented as rows and columns. It allows tools
+// to render any result, including results of unknown or future data types,
+// without knowing its structure.
+type Table struct {
+	Columns []Column   `json:"columns"`
+	Rows    [][]string `json:"rows"`
+}
+
+// ColumnNames returns the names of the columns.
+func (t *Table) ColumnNames() []string {
+	names := make([]string, len(t.Columns))
+	for i, c := range t.Columns {
+		names[i] = c.Name
+	}
+	return names
+}
+
+// Common columns of stored objects.
+var objectColumns = []Column{
+	{Name: "name", Type: ColumnString},
+	{Name: "last_update", Type: ColumnTime},
+	{Name: "update_interval", Type: ColumnDuration},
+	{Name: "backends", Type: ColumnString},
+}
+
+func objectRow(name string, lastUpdate sysdb.Time, interval sysdb.Duration, backends []string) []string {
+	return []string{name, formatTableTime(lastUpdate), interval.String(), strings.Join(backends, ",")}
+}
+
+func formatTableTime(t sysdb.Time) string {
+	return time.Time(t).Format(time.RFC3339)
+}
+
+// NewTable converts a query result as returned by Query into a table.
+// Hosts, services, and metrics are presented with one row per object and
+// timeseries with one row per data point. Any other value is converted
+// based on its JSON encoding: a list of objects becomes one row per element
+// with a column per field (sorted by name), a single object becomes a single
+// row, and any other value a single column named "value". NewTable returns
+// nil for nil results.
+func NewTable(res interface{}) (*Table, error) {
+	t := &Table{}
+	switch r := res.(type) {
+	case nil:
+		return nil, nil
+	case []sysdb.Host:
+		t.Columns = append([]Column(nil), objectColumns...)
+		for _, h := range r {
+			t.Rows = append(t.Rows, objectRow(h.Name, h.LastUpdate, h.UpdateInterval, h.Backends))
+		}
+	case *sysdb.Host:
+		return NewTable([]sysdb.Host{*r})
+	case sysdb.ServiceList:
+		t.Columns = append([]Column{{Name: "host", Type: ColumnString}}, objectColumns...)
+		for _, s := range r {
+			t.Rows = append(t.Rows, append([]string{s.Host}, objectRow(s.Name, s.LastUpdate, s.UpdateInterval, s.Backends)...))
+		}
+	case *sysdb.Service:
+		t.Columns = append([]Column(nil), objectColumns...)
+		t.Rows = [][]string{objectRow(r.Name, r.LastUpdate, r.UpdateInterval, r.Backends)}
+	case sysdb.MetricList:
+		t.Columns = append(append([]Column{{Name: "host", Type: ColumnString}}, objectColumns...),
+			Column{Name: "timeseries", Type: ColumnBool})
+		for _, m := range r {
+			row := append([]string{m.Host}, objectRow(m.Name, m.LastUpdate, m.UpdateInterval, m.Backends)...)
+			t.Rows = append(t.Rows, append(row, strconv.FormatBool(m.Timeseries)))
+		}
+	case *sysdb.Metric:
+		t.Columns = append(append([]Column(nil), objectColumns...), Column{Name: "timeseries", Type: ColumnBool})
+		t.Rows = [][]string{append(objectRow(r.Name, r.LastUpdate, r.UpdateInterval, r.Backends), strconv.FormatBool(r.Timeseries))}
+	case *sysdb.Timeseries:
+		t.Columns = []Column{
+			{Name: "data_source", Type: ColumnString},
+			{Name: "timestamp", Type: ColumnTime},
+			{Name: "value", Type: ColumnNumber},
+		}
+		srcs := make([]string, 0, len(r.Data))
+		for src := range r.Data {
+			srcs = append(srcs, src)
+		}
+		sort.Strings(srcs)
+		for _, src := range srcs {
+			for _, p := range r.Data[src] {
+				t.Rows = append(t.Rows, []string{src, formatTableTime(p.Timestamp), strconv.FormatFloat(p.Value, 'g', -1, 64)})
+			}
+		}
+	default:
+		return genericTable(res)
+	}
+	return t, nil
+}
+
+// genericTable converts res based on its JSON encoding.
+func genericTable(res interface{}) (*Table, error) {
+	data, err := json.Marshal(res)
+	if err != nil {
+		return nil, sysdb.Errorf(sysdb.CodeUnsupported, "cannot convert result of type %T to a table: %v", res, err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, sysdb.Errorf(sysdb.CodeUnsupported, "cannot convert result of type %T to a table: %v", res, err)
+	}
+
+	var objects []map[string]interface{}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		objects = []map[string]interface{}{v}
+	case []interface{}:
+		for _, e := range v {
+			o, ok := e.(map[string]interface{})
+			if !ok {
+				objects = nil
+				break
+			}
+			objects = append(objects, o)
+		}
+		if objects == nil && len(v) > 0 {
+			// A list of scalars (or mixed values).
+			t := &Table{Columns: []Column{{Name: "value", Type: columnType(v[0])}}}
+			for _, e := range v {
+				if columnType(e) != t.Columns[0].Type {
+					t.Columns[0].Type = ColumnJSON
+				}
+			}
+			for _, e := range v {
+				t.Rows = append(t.Rows, []string{cellValue(e, t.Columns[0].Type)})
+			}
+			return t, nil
+		}
+	}
+	if objects == nil {
+		if l, ok := v.([]interface{}); ok && len(l) == 0 {
+			return &Table{}, nil
+		}
+		typ := columnType(v)
+		return &Table{
+			Columns: []Column{{Name: "value", Type: typ}},
+			Rows:    [][]string{{cellValue(v, typ)}},
+		}, nil
+	}
+
+	types := make(map[string]ColumnType)
+	for _, o := range objects {
+		for k, e := range o {
+			if e == nil {
+				continue
+			}
+			if typ, ok := types[k]; !ok || typ == "" {
+				types[k] = columnType(e)
+			} else if typ != columnType(e) {
+				types[k] = ColumnJSON
+			}
+		}
+		for k := range o {
+			if _, ok := types[k]; !ok {
+				types[k] = ""
+			}
+		}
+	}
+	t := &Table{}
+	if len(types) == 0 {
+		return t, nil
+	}
+	for name, typ := range types {
+		if typ == "" {
+			typ = ColumnString
+		}
+		t.Columns = append(t.Columns, Column{Name: name, Type: typ})
+	}
+	sort.Slice(t.Columns, func(i, j int) bool { return t.Columns[i].Name < t.Columns[j].Name })
+	for _, o := range objects {
+		row := make([]string, len(t.Columns))
+		for i, c := range t.Columns {
+			row[i] = cellValue(o[c.Name], c.Type)
+		}
+		t.Rows = append(t.Rows, row)
+	}
+	return t, nil
+}
+
+// columnType returns the column type of a decoded JSON value.
+func columnType(v interface{}) ColumnType {
+	switch v := v.(type) {
+	case string:
+		if _, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return ColumnTime
+		}
+		return ColumnString
+	case json.Number:
+		return ColumnNumber
+	case bool:
+		return ColumnBool
+	case nil:
+		return ColumnString
+	}
+	return ColumnJSON
+}
+
+// cellValue formats a decoded JSON value for a column of the specified type.
+// Missing (nil) values are empty.
+func cellValue(v interface{}, typ ColumnType) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		if typ != ColumnJSON {
+			return v
+		}
+	case json.Number:
+		if typ != ColumnJSON {
+			return v.String()
+		}
+	case bool:
+		if typ != ColumnJSON {
+			return strconv.FormatBool(v)
+		}
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
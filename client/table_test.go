@@ -0,0 +1,109 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package client
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+func TestNewTable(t *testing.T) {
+	ts := sysdb.Time(time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC))
+	for _, test := range []struct {
+		res  interface{}
+		want *Table
+	}{
+		{nil, nil},
+		{
+			[]sysdb.Host{{Name: "h1", LastUpdate: ts, UpdateInterval: sysdb.Duration(time.Minute), Backends: []string{"a", "b"}}},
+			&Table{
+				Columns: []Column{{"name", ColumnString}, {"last_update", ColumnTime}, {"update_interval", ColumnDuration}, {"backends", ColumnString}},
+				Rows:    [][]string{{"h1", "2016-01-02T03:04:05Z", "1m", "a,b"}},
+			},
+		},
+		{
+			sysdb.MetricList{{Host: "h1", Metric: sysdb.Metric{Name: "m1", LastUpdate: ts, Timeseries: true}}},
+			&Table{
+				Columns: []Column{{"host", ColumnString}, {"name", ColumnString}, {"last_update", ColumnTime}, {"update_interval", ColumnDuration}, {"backends", ColumnString}, {"timeseries", ColumnBool}},
+				Rows:    [][]string{{"h1", "m1", "2016-01-02T03:04:05Z", "0s", "", "true"}},
+			},
+		},
+		{
+			&sysdb.Timeseries{Data: map[string][]sysdb.DataPoint{
+				"value": {{Timestamp: ts, Value: 1.5}},
+				"max":   {{Timestamp: ts, Value: 2}},
+			}},
+			&Table{
+				Columns: []Column{{"data_source", ColumnString}, {"timestamp", ColumnTime}, {"value", ColumnNumber}},
+				Rows:    [][]string{{"max", "2016-01-02T03:04:05Z", "2"}, {"value", "2016-01-02T03:04:05Z", "1.5"}},
+			},
+		},
+		{
+			[]map[string]interface{}{
+				{"name": "a", "count": 1, "tags": []string{"x"}},
+				{"name": "b", "ok": true, "when": "2016-01-02T03:04:05Z"},
+			},
+			&Table{
+				Columns: []Column{{"count", ColumnNumber}, {"name", ColumnString}, {"ok", ColumnBool}, {"tags", ColumnJSON}, {"when", ColumnTime}},
+				Rows: [][]string{
+					{"1", "a", "", `["x"]`, ""},
+					{"", "b", "true", "", "2016-01-02T03:04:05Z"},
+				},
+			},
+		},
+		{
+			struct {
+				A string      `json:"a"`
+				B interface{} `json:"b"`
+			}{"x", nil},
+			&Table{
+				Columns: []Column{{"a", ColumnString}, {"b", ColumnString}},
+				Rows:    [][]string{{"x", ""}},
+			},
+		},
+		{
+			[]interface{}{1, "two"},
+			&Table{Columns: []Column{{"value", ColumnJSON}}, Rows: [][]string{{"1"}, {`"two"`}}},
+		},
+		{42, &Table{Columns: []Column{{"value", ColumnNumber}}, Rows: [][]string{{"42"}}}},
+		{[]int{}, &Table{}},
+		{map[string]string{}, &Table{}},
+	} {
+		got, err := NewTable(test.res)
+		if err != nil || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("NewTable(%#v) = %+v, %v; want %+v, <nil>", test.res, got, err, test.want)
+		}
+	}
+
+	if got, err := NewTable(make(chan int)); sysdb.ErrorCode(err) != sysdb.CodeUnsupported {
+		t.Errorf("NewTable(<chan>) = %+v, %v; want code %s", got, err, sysdb.CodeUnsupported)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
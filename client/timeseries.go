@@ -0,0 +1,72 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+// A TimeseriesFetcher retrieves the timeseries of a metric for the specified
+// time range. See the github.com/sysdb/go/timeseries package for
+// implementations accessing data stores directly.
+type TimeseriesFetcher interface {
+	Fetch(host, metric string, start, end time.Time) (*sysdb.Timeseries, error)
+}
+
+// A TimeseriesFunc is an adapter to use ordinary functions as
+// TimeseriesFetchers. For example, TimeseriesFunc(c.Timeseries) fetches
+// timeseries using the TIMESERIES command.
+type TimeseriesFunc func(host, metric string, start, end time.Time) (*sysdb.Timeseries, error)
+
+// Fetch calls f(host, metric, start, end).
+func (f TimeseriesFunc) Fetch(host, metric string, start, end time.Time) (*sysdb.Timeseries, error) {
+	return f(host, metric, start, end)
+}
+
+// Timeseries fetches the timeseries of a metric from the server using the
+// TIMESERIES command.
+func (c *Client) Timeseries(host, metric string, start, end time.Time) (*sysdb.Timeseries, error) {
+	return c.TimeseriesContext(context.Background(), host, metric, start, end)
+}
+
+// TimeseriesContext is like Timeseries but aborts the request once ctx is
+// done.
+func (c *Client) TimeseriesContext(ctx context.Context, host, metric string, start, end time.Time) (*sysdb.Timeseries, error) {
+	q, err := QueryString("TIMESERIES %s.%s START %s END %s", host, metric, start, end)
+	if err != nil {
+		return nil, err
+	}
+	var ts sysdb.Timeseries
+	if err := c.QueryIntoContext(ctx, q, &ts); err != nil {
+		return nil, err
+	}
+	return &ts, nil
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
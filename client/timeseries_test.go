@@ -0,0 +1,69 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package client
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sysdb/go/proto"
+)
+
+func TestTimeseries(t *testing.T) {
+	reply := `{"start": "2016-01-02 02:04:05 +0000", "end": "2016-01-02 03:04:05 +0000", "data": {"value": [{"timestamp": "2016-01-02 03:00:00 +0000", "value": "1"}]}}`
+	s := newTestServer(t, func(req *proto.Message) []*proto.Message {
+		if !strings.HasPrefix(string(req.Raw), "TIMESERIES 'h'.'m' START ") {
+			return []*proto.Message{{Type: proto.ConnectionError, Raw: []byte("unexpected query")}}
+		}
+		return []*proto.Message{dataMessage(proto.ConnectionTimeseries, reply)}
+	})
+	defer s.close()
+
+	c, err := Connect(s.addr(), "test")
+	if err != nil {
+		t.Fatalf("Connect() = %v", err)
+	}
+	defer c.Close()
+
+	end := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+	start := end.Add(-time.Hour)
+	if ts, err := c.Timeseries("h", "m", start, end); err != nil || len(ts.Data["value"]) != 1 {
+		t.Errorf("Timeseries(h, m) = %+v, %v; want one data point", ts, err)
+	}
+	if ts, err := c.TimeseriesContext(context.Background(), "h", "m", start, end); err != nil || len(ts.Data["value"]) != 1 {
+		t.Errorf("TimeseriesContext(h, m) = %+v, %v; want one data point", ts, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if ts, err := c.TimeseriesContext(ctx, "h", "m", start, end); err != context.Canceled {
+		t.Errorf("TimeseriesContext(<cancelled>) = %+v, %v; want %v", ts, err, context.Canceled)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
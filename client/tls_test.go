@@ -0,0 +1,115 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package client
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sysdb/go/proto"
+	"github.com/sysdb/go/sysdb"
+)
+
+// selfSigned returns a self-signed certificate for the specified host name
+// along with a pool containing it.
+func selfSigned(t *testing.T, host string) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+func TestStartTLS(t *testing.T) {
+	cert, pool := selfSigned(t, "sysdb.test")
+	srv := &proto.Server{
+		Handler: proto.HandlerFunc(func(s *proto.Session, req *proto.Message) (*proto.Message, error) {
+			if _, ok := s.Conn.(*tls.Conn); !ok {
+				return nil, sysdb.Errorf(sysdb.CodeUnknown, "plain-text connection")
+			}
+			return &proto.Message{Type: proto.ConnectionOK}, nil
+		}),
+		TLSConfig:  &tls.Config{Certificates: []tls.Certificate{cert}},
+		RequireTLS: true,
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() = %v", err)
+	}
+	go srv.Serve(l)
+	defer srv.Close()
+	addr := l.Addr().String()
+
+	if c, err := Dial(addr, "test"); sysdb.ErrorCode(err) != sysdb.CodeStartupFailed || !strings.Contains(err.Error(), "TLS") {
+		t.Errorf("Dial(<plain-text>) = %v, %v; want <error: requires TLS>", c, err)
+	}
+
+	c, err := Connect(addr, "test", WithPoolSize(1), WithStartTLS(),
+		WithTLSConfig(&tls.Config{RootCAs: pool}), WithTLSServerName("sysdb.test"))
+	if err != nil {
+		t.Fatalf("Connect(<STARTTLS>) = %v", err)
+	}
+	defer c.Close()
+	if res, err := c.Call(&proto.Message{Type: proto.ConnectionQuery, Raw: []byte("q")}); err != nil || res.Type != proto.ConnectionOK {
+		t.Errorf("Call(<STARTTLS>) = %v, %v; want OK", res, err)
+	}
+
+	if c, err := Dial(addr, "test", WithStartTLS(), WithTLSConfig(&tls.Config{RootCAs: pool}),
+		WithTLSServerName("other.test")); err == nil {
+		t.Errorf("Dial(<wrong server name>) = %v, <nil>; want error", c)
+		c.Close()
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
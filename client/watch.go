@@ -0,0 +1,107 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package client
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+// A Snapshot is the result of a watched query at a certain point in time.
+type Snapshot struct {
+	// Time is the time the query has been executed.
+	Time time.Time
+	// Res and Err are the result of the query (see Query).
+	Res interface{}
+	Err error
+}
+
+// Watch executes the query q every interval and sends a snapshot of the
+// result on the returned channel whenever it differs from the previous one.
+// The first result is always sent. Failed queries are sent as well (once per
+// distinct error), allowing the caller to decide whether to continue
+// watching.
+//
+// Watching stops and the channel is closed once ctx is done or the client is
+// closed. Snapshots are not buffered: the query is not re-run until the
+// previous snapshot has been received.
+//
+// If interval is not positive, a single snapshot carrying an error of code
+// sysdb.CodeInvalidArgument is sent without running the query.
+func (c *Client) Watch(ctx context.Context, q string, interval time.Duration) <-chan Snapshot {
+	ch := make(chan Snapshot)
+	go func() {
+		defer close(ch)
+		if interval <= 0 {
+			err := sysdb.Errorf(sysdb.CodeInvalidArgument, "invalid watch interval %v", interval)
+			select {
+			case ch <- Snapshot{Time: time.Now(), Err: err}:
+			case <-ctx.Done():
+			}
+			return
+		}
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		var prev *Snapshot
+		for {
+			res, err := c.QueryContext(ctx, q)
+			if err == ErrClosed || ctx.Err() != nil {
+				return
+			}
+			snap := Snapshot{Time: time.Now(), Res: res, Err: err}
+			if prev == nil || !sameSnapshot(*prev, snap) {
+				select {
+				case ch <- snap:
+				case <-ctx.Done():
+					return
+				}
+				prev = &snap
+			}
+
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				return
+			case <-c.done:
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+func sameSnapshot(a, b Snapshot) bool {
+	if a.Err != nil || b.Err != nil {
+		return a.Err != nil && b.Err != nil && a.Err.Error() == b.Err.Error()
+	}
+	return reflect.DeepEqual(a.Res, b.Res)
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
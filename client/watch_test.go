@@ -0,0 +1,128 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sysdb/go/proto"
+	"github.com/sysdb/go/sysdb"
+)
+
+func TestWatch(t *testing.T) {
+	// The result changes on the third request and then stays the same.
+	var n int32
+	s := newTestServer(t, func(req *proto.Message) []*proto.Message {
+		name := "h1"
+		if atomic.AddInt32(&n, 1) >= 3 {
+			name = "h2"
+		}
+		return []*proto.Message{dataMessage(proto.ConnectionList, fmt.Sprintf(`[{"name": %q}]`, name))}
+	})
+	defer s.close()
+
+	c, err := Connect(s.addr(), "test", WithPoolSize(1))
+	if err != nil {
+		t.Fatalf("Connect() = %v", err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := c.Watch(ctx, "LIST hosts", 5*time.Millisecond)
+
+	for _, want := range []string{"h1", "h2"} {
+		select {
+		case snap := <-ch:
+			hosts, ok := snap.Res.([]sysdb.Host)
+			if snap.Err != nil || !ok || len(hosts) != 1 || hosts[0].Name != want {
+				t.Errorf("Watch() = %v, %v; want [%s]", snap.Res, snap.Err, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Watch() did not send snapshot %s", want)
+		}
+	}
+
+	// No more changes.
+	select {
+	case snap := <-ch:
+		t.Errorf("Watch() = %v, %v; want no further snapshots", snap.Res, snap.Err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	cancel()
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Errorf("Watch() sent snapshot after cancellation")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Watch() did not close the channel after cancellation")
+	}
+}
+
+func TestWatchInvalidInterval(t *testing.T) {
+	var n int32
+	s := newTestServer(t, func(req *proto.Message) []*proto.Message {
+		atomic.AddInt32(&n, 1)
+		return []*proto.Message{dataMessage(proto.ConnectionList, `[]`)}
+	})
+	defer s.close()
+
+	c, err := Connect(s.addr(), "test", WithPoolSize(1))
+	if err != nil {
+		t.Fatalf("Connect() = %v", err)
+	}
+	defer c.Close()
+
+	for _, interval := range []time.Duration{0, -time.Second} {
+		ch := c.Watch(context.Background(), "LIST hosts", interval)
+		select {
+		case snap := <-ch:
+			if sysdb.ErrorCode(snap.Err) != sysdb.CodeInvalidArgument {
+				t.Errorf("Watch(%v) = %v, %v; want <invalid argument>", interval, snap.Res, snap.Err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Watch(%v) did not send a snapshot", interval)
+		}
+		select {
+		case snap, ok := <-ch:
+			if ok {
+				t.Errorf("Watch(%v) = %v, %v; want closed channel", interval, snap.Res, snap.Err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Watch(%v) did not close the channel", interval)
+		}
+	}
+	if got := atomic.LoadInt32(&n); got != 0 {
+		t.Errorf("Watch(<invalid interval>) sent %d queries; want 0", got)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
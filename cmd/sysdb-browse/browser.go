@@ -0,0 +1,595 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sysdb/go/client"
+	"github.com/sysdb/go/sysdb"
+)
+
+// A nodeKind is the type of the object displayed by a node.
+type nodeKind int
+
+const (
+	kindHost nodeKind = iota
+	kindService
+	kindMetric
+	kindAttribute
+)
+
+// A node is an entry of the object tree.
+type node struct {
+	kind  nodeKind
+	name  string
+	value string // attribute value
+	// host is the name of the host the object belongs to.
+	host string
+	// timeseries indicates that a metric has a timeseries.
+	timeseries bool
+
+	depth    int
+	parent   *node
+	children []*node
+	expanded bool
+	// loaded indicates that the children of a host have been fetched.
+	loaded bool
+}
+
+// key returns a string identifying the node within the tree.
+func (n *node) key() string {
+	if n.parent == nil {
+		return n.name
+	}
+	return fmt.Sprintf("%s/%d:%s", n.parent.key(), n.kind, n.name)
+}
+
+func (n *node) label() string {
+	switch n.kind {
+	case kindService:
+		return "service " + n.name
+	case kindMetric:
+		if n.timeseries {
+			return "metric " + n.name + " ~"
+		}
+		return "metric " + n.name
+	case kindAttribute:
+		return n.name + " = " + n.value
+	}
+	return n.name
+}
+
+// A sparkView displays the timeseries of a metric.
+type sparkView struct {
+	host, metric string
+	ts           *sysdb.Timeseries
+	err          error
+}
+
+// A browser holds the state of the store browser. It is independent of the
+// terminal: keys are passed to handleKey and the screen is drawn by render.
+type browser struct {
+	c       client.Interface
+	timeout time.Duration
+	tsRange time.Duration
+
+	hosts  []*node
+	cursor int
+	offset int
+
+	search    string
+	searching bool
+
+	status    string
+	spark     *sparkView
+	refreshed time.Time
+}
+
+func newBrowser(c client.Interface, timeout, tsRange time.Duration) *browser {
+	return &browser{c: c, timeout: timeout, tsRange: tsRange}
+}
+
+func (b *browser) context() (context.Context, context.CancelFunc) {
+	if b.timeout > 0 {
+		return context.WithTimeout(context.Background(), b.timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// refresh re-lists all hosts and re-fetches the expanded ones. The expansion
+// state and the selection are preserved.
+func (b *browser) refresh() {
+	var selected string
+	if vis := b.visible(); b.cursor < len(vis) {
+		selected = vis[b.cursor].key()
+	}
+	expanded := make(map[string]bool)
+	var collect func(nodes []*node)
+	collect = func(nodes []*node) {
+		for _, n := range nodes {
+			if n.expanded {
+				expanded[n.key()] = true
+			}
+			collect(n.children)
+		}
+	}
+	collect(b.hosts)
+
+	ctx, cancel := b.context()
+	res, err := b.c.QueryContext(ctx, "LIST hosts")
+	cancel()
+	if err != nil {
+		b.status = "refresh failed: " + err.Error()
+		return
+	}
+	list, ok := res.([]sysdb.Host)
+	if !ok {
+		b.status = fmt.Sprintf("refresh failed: unexpected result %T", res)
+		return
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	b.hosts = b.hosts[:0]
+	for _, h := range list {
+		n := &node{kind: kindHost, name: h.Name, host: h.Name}
+		b.hosts = append(b.hosts, n)
+		if expanded[n.key()] {
+			b.load(n)
+			n.expanded = true
+			var restore func(nodes []*node)
+			restore = func(nodes []*node) {
+				for _, c := range nodes {
+					c.expanded = expanded[c.key()]
+					restore(c.children)
+				}
+			}
+			restore(n.children)
+		}
+	}
+	b.refreshed = now()
+	if strings.HasPrefix(b.status, "refresh failed") {
+		b.status = ""
+	}
+
+	b.cursor = 0
+	for i, n := range b.visible() {
+		if n.key() == selected {
+			b.cursor = i
+		}
+	}
+}
+
+// load fetches the children of a host.
+func (b *browser) load(n *node) {
+	ctx, cancel := b.context()
+	h, err := b.c.FetchHost(ctx, n.name)
+	cancel()
+	if err != nil {
+		b.status = err.Error()
+		return
+	}
+
+	attrs := func(parent *node, as []sysdb.Attribute) {
+		as = append([]sysdb.Attribute(nil), as...)
+		sort.Slice(as, func(i, j int) bool { return as[i].Name < as[j].Name })
+		for _, a := range as {
+			parent.children = append(parent.children, &node{
+				kind: kindAttribute, name: a.Name, value: a.Value,
+				host: n.name, depth: parent.depth + 1, parent: parent,
+			})
+		}
+	}
+	n.children = nil
+	attrs(n, h.Attributes)
+	for _, s := range h.Services {
+		c := &node{kind: kindService, name: s.Name, host: n.name, depth: 1, parent: n}
+		attrs(c, s.Attributes)
+		n.children = append(n.children, c)
+	}
+	for _, m := range h.Metrics {
+		c := &node{kind: kindMetric, name: m.Name, host: n.name, timeseries: m.Timeseries, depth: 1, parent: n}
+		attrs(c, m.Attributes)
+		n.children = append(n.children, c)
+	}
+	n.loaded = true
+}
+
+// matches reports whether the node or any of its loaded descendants match
+// the search string.
+func (b *browser) matches(n *node) bool {
+	if b.search == "" || strings.Contains(strings.ToLower(n.label()), strings.ToLower(b.search)) {
+		return true
+	}
+	for _, c := range n.children {
+		if b.matches(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// visible returns the nodes currently displayed in the tree.
+func (b *browser) visible() []*node {
+	var res []*node
+	var walk func(nodes []*node)
+	walk = func(nodes []*node) {
+		for _, n := range nodes {
+			if !b.matches(n) {
+				continue
+			}
+			res = append(res, n)
+			if n.expanded {
+				walk(n.children)
+			}
+		}
+	}
+	walk(b.hosts)
+	return res
+}
+
+func (b *browser) selected() *node {
+	vis := b.visible()
+	if b.cursor < 0 || b.cursor >= len(vis) {
+		return nil
+	}
+	return vis[b.cursor]
+}
+
+// expand expands the selected node, loading its children if necessary, or
+// shows the timeseries of a metric without children.
+func (b *browser) expand() {
+	n := b.selected()
+	if n == nil {
+		return
+	}
+	if n.kind == kindHost && !n.loaded {
+		b.load(n)
+	}
+	if len(n.children) > 0 {
+		n.expanded = true
+	} else if n.kind == kindMetric {
+		b.showTimeseries(n)
+	}
+}
+
+// collapse collapses the selected node or selects its parent.
+func (b *browser) collapse() {
+	n := b.selected()
+	if n == nil {
+		return
+	}
+	if n.expanded {
+		n.expanded = false
+		return
+	}
+	if n.parent != nil {
+		for i, v := range b.visible() {
+			if v == n.parent {
+				b.cursor = i
+			}
+		}
+	}
+}
+
+// showTimeseries fetches the timeseries of the metric n.
+func (b *browser) showTimeseries(n *node) {
+	if n.kind != kindMetric {
+		b.status = "not a metric"
+		return
+	}
+	if !n.timeseries {
+		b.status = "metric " + n.name + " does not have a timeseries"
+		return
+	}
+	end := now()
+	ts, err := b.c.Timeseries(n.host, n.name, end.Add(-b.tsRange), end)
+	b.spark = &sparkView{host: n.host, metric: n.name, ts: ts, err: err}
+}
+
+// move moves the cursor by delta lines.
+func (b *browser) move(delta int) {
+	b.cursor += delta
+	if max := len(b.visible()) - 1; b.cursor > max {
+		b.cursor = max
+	}
+	if b.cursor < 0 {
+		b.cursor = 0
+	}
+}
+
+// handleKey updates the state according to the pressed key. It returns
+// false if the browser should quit.
+func (b *browser) handleKey(k key, pageSize int) bool {
+	if b.searching {
+		switch {
+		case k.code == keyEnter:
+			b.searching = false
+		case k.code == keyEscape:
+			b.searching, b.search = false, ""
+		case k.code == keyBackspace:
+			if len(b.search) > 0 {
+				_, n := utf8.DecodeLastRuneInString(b.search)
+				b.search = b.search[:len(b.search)-n]
+			}
+		case k.code == keyRune:
+			b.search += string(k.r)
+		}
+		b.cursor = 0
+		return true
+	}
+	if b.spark != nil {
+		switch {
+		case k.code == keyRune && k.r == 'q', k.code == keyCtrlC:
+			return false
+		case k.code == keyRune && k.r == 'r':
+			b.showTimeseries(&node{kind: kindMetric, name: b.spark.metric, host: b.spark.host, timeseries: true})
+		default:
+			b.spark = nil
+		}
+		return true
+	}
+
+	b.status = ""
+	switch k.code {
+	case keyCtrlC:
+		return false
+	case keyUp:
+		b.move(-1)
+	case keyDown:
+		b.move(1)
+	case keyPageUp:
+		b.move(-pageSize)
+	case keyPageDown:
+		b.move(pageSize)
+	case keyHome:
+		b.cursor = 0
+	case keyEnd:
+		b.move(len(b.visible()))
+	case keyEnter, keyRight:
+		b.expand()
+	case keyLeft, keyBackspace:
+		b.collapse()
+	case keyEscape:
+		b.search = ""
+	case keyRune:
+		switch k.r {
+		case 'q':
+			return false
+		case 'k':
+			b.move(-1)
+		case 'j':
+			b.move(1)
+		case 'g':
+			b.cursor = 0
+		case 'G':
+			b.move(len(b.visible()))
+		case 'l':
+			b.expand()
+		case 'h':
+			b.collapse()
+		case '/':
+			b.searching, b.search = true, ""
+		case 'r':
+			b.refresh()
+		case 't':
+			if n := b.selected(); n != nil {
+				b.showTimeseries(n)
+			}
+		case '?':
+			b.status = helpText
+		}
+	}
+	return true
+}
+
+const helpText = "j/k: move  enter/l: expand  h: collapse  /: search  t: timeseries  r: refresh  q: quit"
+
+// render draws the screen of the specified size to w.
+func (b *browser) render(w io.Writer, width, height int) error {
+	lines := make([]string, 0, height)
+	header := fmt.Sprintf("sysdb-browse: %d hosts", len(b.hosts))
+	if !b.refreshed.IsZero() {
+		header += ", refreshed " + b.refreshed.Format("15:04:05")
+	}
+	lines = append(lines, "\x1b[1m"+truncate(header, width)+"\x1b[0m")
+
+	body := height - 2
+	if b.spark != nil {
+		lines = append(lines, b.sparkLines(width, body)...)
+	} else {
+		vis := b.visible()
+		if b.cursor < b.offset {
+			b.offset = b.cursor
+		}
+		if b.cursor >= b.offset+body {
+			b.offset = b.cursor - body + 1
+		}
+		for i := b.offset; i < len(vis) && i < b.offset+body; i++ {
+			n := vis[i]
+			marker := "  "
+			if n.kind == kindHost && !n.loaded || len(n.children) > 0 {
+				marker = "+ "
+				if n.expanded {
+					marker = "- "
+				}
+			}
+			line := truncate(strings.Repeat("  ", n.depth)+marker+n.label(), width)
+			if i == b.cursor {
+				line = "\x1b[7m" + line + "\x1b[0m"
+			}
+			lines = append(lines, line)
+		}
+	}
+	for len(lines) < height-1 {
+		lines = append(lines, "")
+	}
+
+	footer := b.status
+	switch {
+	case b.searching:
+		footer = "/" + b.search
+	case footer == "" && b.search != "":
+		footer = "search: " + b.search + " (esc to clear)"
+	case footer == "":
+		footer = "press ? for help"
+	}
+	lines = append(lines, truncate(footer, width))
+
+	var buf strings.Builder
+	buf.WriteString("\x1b[H\x1b[2J")
+	for i, l := range lines {
+		if i > 0 {
+			buf.WriteString("\r\n")
+		}
+		buf.WriteString(l)
+	}
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
+
+// sparkLines returns the lines of the timeseries view.
+func (b *browser) sparkLines(width, height int) []string {
+	s := b.spark
+	lines := []string{truncate(fmt.Sprintf("%s / %s (last %s)", s.host, s.metric, b.tsRange), width), ""}
+	if s.err != nil {
+		return append(lines, truncate("error: "+s.err.Error(), width))
+	}
+	names := make([]string, 0, len(s.ts.Data))
+	for name := range s.ts.Data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		points := s.ts.Data[name]
+		min, max, last := summary(points)
+		lines = append(lines,
+			truncate(fmt.Sprintf("%s: min %g, max %g, last %g", name, min, max, last), width),
+			sparkline(points, width),
+			"")
+	}
+	lines = append(lines, "r: reload, any other key: back")
+	if len(lines) > height {
+		lines = lines[:height]
+	}
+	return lines
+}
+
+// summary returns the minimum, maximum, and last (non-NaN) value.
+func summary(points []sysdb.DataPoint) (min, max, last float64) {
+	min, max, last = math.NaN(), math.NaN(), math.NaN()
+	for _, p := range points {
+		v := p.Value
+		if math.IsNaN(v) {
+			continue
+		}
+		if math.IsNaN(min) || v < min {
+			min = v
+		}
+		if math.IsNaN(max) || v > max {
+			max = v
+		}
+		last = v
+	}
+	return min, max, last
+}
+
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline renders the data points as a line of at most width block
+// characters. Multiple points per character are averaged; missing values are
+// rendered as spaces.
+func sparkline(points []sysdb.DataPoint, width int) string {
+	if len(points) == 0 || width <= 0 {
+		return ""
+	}
+	n := len(points)
+	if n > width {
+		n = width
+	}
+	values := make([]float64, n)
+	for i := range values {
+		from, to := i*len(points)/n, (i+1)*len(points)/n
+		sum, cnt := 0.0, 0
+		for _, p := range points[from:to] {
+			if !math.IsNaN(p.Value) && !math.IsInf(p.Value, 0) {
+				sum += p.Value
+				cnt++
+			}
+		}
+		values[i] = math.NaN()
+		if cnt > 0 {
+			values[i] = sum / float64(cnt)
+		}
+	}
+
+	min, max, _ := summary(pointsOf(values))
+	var buf strings.Builder
+	for _, v := range values {
+		switch {
+		case math.IsNaN(v):
+			buf.WriteRune(' ')
+		case max == min:
+			buf.WriteRune(sparkBlocks[len(sparkBlocks)/2])
+		default:
+			i := int((v - min) / (max - min) * float64(len(sparkBlocks)-1))
+			buf.WriteRune(sparkBlocks[i])
+		}
+	}
+	return buf.String()
+}
+
+func pointsOf(values []float64) []sysdb.DataPoint {
+	points := make([]sysdb.DataPoint, len(values))
+	for i, v := range values {
+		points[i].Value = v
+	}
+	return points
+}
+
+// truncate shortens s to at most width runes.
+func truncate(s string, width int) string {
+	if width <= 0 || utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	r := []rune(s)
+	if width == 1 {
+		return string(r[:1])
+	}
+	return string(r[:width-1]) + "…"
+}
+
+// now returns the current time; it may be overridden for testing.
+var now = time.Now
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,261 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package main
+
+import (
+	"bufio"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sysdb/go/client/clienttest"
+	"github.com/sysdb/go/sysdb"
+)
+
+func testBrowser() (*browser, *clienttest.Fake) {
+	f := clienttest.NewFake(
+		sysdb.Host{
+			Name:       "db1",
+			Attributes: []sysdb.Attribute{{Name: "os", Value: "linux"}},
+			Services:   []sysdb.Service{{Name: "postgres", Attributes: []sysdb.Attribute{{Name: "port", Value: "5432"}}}},
+			Metrics:    []sysdb.Metric{{Name: "load", Timeseries: true}},
+		},
+		sysdb.Host{Name: "web1"},
+	)
+	f.SetResult("LIST hosts", []sysdb.Host{{Name: "web1"}, {Name: "db1"}})
+	return newBrowser(f, time.Second, time.Hour), f
+}
+
+// labels returns the labels of the visible nodes including indentation.
+func labels(b *browser) []string {
+	var res []string
+	for _, n := range b.visible() {
+		res = append(res, strings.Repeat(" ", n.depth)+n.label())
+	}
+	return res
+}
+
+func press(b *browser, keys ...interface{}) {
+	for _, k := range keys {
+		switch k := k.(type) {
+		case rune:
+			b.handleKey(key{code: keyRune, r: k}, 10)
+		case string:
+			for _, r := range k {
+				b.handleKey(key{code: keyRune, r: r}, 10)
+			}
+		case keyCode:
+			b.handleKey(key{code: k}, 10)
+		}
+	}
+}
+
+func TestNavigation(t *testing.T) {
+	b, f := testBrowser()
+	b.refresh()
+	if got, want := labels(b), []string{"db1", "web1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("refresh() = %q; want %q", got, want)
+	}
+
+	press(b, keyEnter)
+	want := []string{"db1", " os = linux", " service postgres", " metric load ~", "web1"}
+	if got := labels(b); !reflect.DeepEqual(got, want) {
+		t.Errorf("expand(db1) = %q; want %q", got, want)
+	}
+
+	// Expand the service and collapse it again from one of its children.
+	press(b, 'j', 'j', 'l', 'j')
+	if n := b.selected(); n == nil || n.label() != "port = 5432" {
+		t.Errorf("selected() = %v; want port attribute", n)
+	}
+	press(b, 'h')
+	if n := b.selected(); n == nil || n.label() != "service postgres" {
+		t.Errorf("selected() = %v; want service postgres", n)
+	}
+
+	// Refreshing preserves the expansion state and the selection.
+	f.SetResult("LIST hosts", []sysdb.Host{{Name: "app1"}, {Name: "db1"}, {Name: "web1"}})
+	press(b, 'r')
+	want = []string{"app1", "db1", " os = linux", " service postgres", "  port = 5432", " metric load ~", "web1"}
+	if got := labels(b); !reflect.DeepEqual(got, want) {
+		t.Errorf("refresh() = %q; want %q", got, want)
+	}
+	if n := b.selected(); n == nil || n.label() != "service postgres" {
+		t.Errorf("selected() = %v after refresh; want service postgres", n)
+	}
+
+	press(b, 'G')
+	if n := b.selected(); n == nil || n.name != "web1" {
+		t.Errorf("selected() = %v; want web1", n)
+	}
+	press(b, keyHome, keyDown, keyLeft)
+	if got := labels(b); len(got) != 3 {
+		t.Errorf("collapse(db1) = %q; want 3 hosts", got)
+	}
+
+	if b.handleKey(key{code: keyRune, r: 'q'}, 10) {
+		t.Errorf("handleKey(q) = true; want false")
+	}
+}
+
+func TestSearch(t *testing.T) {
+	b, _ := testBrowser()
+	b.refresh()
+	press(b, keyEnter, '/', "postgrex", keyBackspace, "s")
+	if !b.searching || b.search != "postgres" {
+		t.Errorf("search = %q (searching: %v); want postgres", b.search, b.searching)
+	}
+	press(b, keyEnter)
+	want := []string{"db1", " service postgres"}
+	if got := labels(b); b.searching || !reflect.DeepEqual(got, want) {
+		t.Errorf("search(postgres) = %q; want %q", got, want)
+	}
+	press(b, '/', "web", keyEscape)
+	if got := labels(b); len(got) != 5 {
+		t.Errorf("search(<cleared>) = %q; want all objects", got)
+	}
+}
+
+func TestTimeseries(t *testing.T) {
+	defer func(f func() time.Time) { now = f }(now)
+	end := time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC)
+	now = func() time.Time { return end }
+
+	b, f := testBrowser()
+	var points []sysdb.DataPoint
+	for i := 0; i < 8; i++ {
+		points = append(points, sysdb.DataPoint{Timestamp: sysdb.Time(end.Add(time.Duration(i-8) * time.Minute)), Value: float64(i)})
+	}
+	f.SetTimeseries("db1", "load", sysdb.Timeseries{Data: map[string][]sysdb.DataPoint{"value": points}})
+	b.refresh()
+
+	press(b, 't')
+	if b.status != "not a metric" || b.spark != nil {
+		t.Errorf("timeseries(<host>) = %q, %v; want error", b.status, b.spark)
+	}
+	press(b, keyEnter, keyDown, keyDown, keyDown, keyEnter)
+	if b.spark == nil || b.spark.err != nil || b.spark.metric != "load" {
+		t.Fatalf("timeseries(load) = %+v; want timeseries", b.spark)
+	}
+
+	var buf strings.Builder
+	if err := b.render(&buf, 40, 10); err != nil {
+		t.Fatalf("render() = %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{"db1 / load (last 1h0m0s)", "value: min 0, max 7, last 7", "▁▂▃▄▅▆▇█"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("render() = %q; want %q", out, want)
+		}
+	}
+
+	press(b, 'x')
+	if b.spark != nil {
+		t.Errorf("spark = %+v after key press; want <nil>", b.spark)
+	}
+}
+
+func TestRender(t *testing.T) {
+	b, _ := testBrowser()
+	b.refresh()
+	press(b, keyEnter, keyDown)
+
+	var buf strings.Builder
+	if err := b.render(&buf, 12, 5); err != nil {
+		t.Fatalf("render() = %v", err)
+	}
+	lines := strings.Split(strings.TrimPrefix(buf.String(), "\x1b[H\x1b[2J"), "\r\n")
+	want := []string{
+		"\x1b[1msysdb-brows…\x1b[0m",
+		"- db1",
+		"\x1b[7m    os = li…\x1b[0m",
+		"  + service…",
+		"press ? for…",
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("render() =\n%q\nwant\n%q", lines, want)
+	}
+
+	// The view scrolls to keep the selection visible.
+	press(b, keyDown, keyDown, keyDown)
+	buf.Reset()
+	b.render(&buf, 20, 5)
+	if !strings.Contains(buf.String(), "\x1b[7m+ web1") || strings.Contains(buf.String(), "- db1") {
+		t.Errorf("render() = %q; want scrolled to web1", buf.String())
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	nan := math.NaN()
+	for _, test := range []struct {
+		values   []float64
+		width    int
+		expected string
+	}{
+		{nil, 10, ""},
+		{[]float64{1, 2, 3}, 0, ""},
+		{[]float64{0, 7}, 10, "▁█"},
+		{[]float64{5, 5, 5}, 10, "▅▅▅"},
+		{[]float64{0, nan, 7}, 10, "▁ █"},
+		{[]float64{0, 0, 7, 7}, 2, "▁█"},
+		{[]float64{0, math.Inf(1), 1}, 3, "▁ █"},
+	} {
+		if got := sparkline(pointsOf(test.values), test.width); got != test.expected {
+			t.Errorf("sparkline(%v, %d) = %q; want %q", test.values, test.width, got, test.expected)
+		}
+	}
+}
+
+func TestReadKey(t *testing.T) {
+	input := "a\r\x1b[A\x1b[6~\x1b\x7f\x03\x1b[99x\x1bOD"
+	want := []key{
+		{code: keyRune, r: 'a'},
+		{code: keyEnter},
+		{code: keyUp},
+		{code: keyPageDown},
+		{code: keyEscape},
+		{code: keyBackspace},
+		{code: keyCtrlC},
+		{code: keyUnknown},
+		{code: keyLeft},
+	}
+	r := bufio.NewReader(strings.NewReader(input))
+	var got []key
+	for {
+		k, err := readKey(r)
+		if err != nil {
+			break
+		}
+		got = append(got, k)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readKey(%q) = %v; want %v", input, got, want)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
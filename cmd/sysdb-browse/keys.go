@@ -0,0 +1,137 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package main
+
+import (
+	"bufio"
+	"io"
+)
+
+// A keyCode identifies a special key.
+type keyCode int
+
+const (
+	keyRune keyCode = iota
+	keyEnter
+	keyEscape
+	keyBackspace
+	keyCtrlC
+	keyUp
+	keyDown
+	keyLeft
+	keyRight
+	keyPageUp
+	keyPageDown
+	keyHome
+	keyEnd
+	keyUnknown
+)
+
+// A key is a key press read from the terminal.
+type key struct {
+	code keyCode
+	// r is the typed character of keyRune keys.
+	r rune
+}
+
+// escapes maps the ANSI escape sequences (without the leading ESC [) of
+// special keys to their codes.
+var escapes = map[string]keyCode{
+	"A":  keyUp,
+	"B":  keyDown,
+	"C":  keyRight,
+	"D":  keyLeft,
+	"H":  keyHome,
+	"F":  keyEnd,
+	"1~": keyHome,
+	"4~": keyEnd,
+	"5~": keyPageUp,
+	"6~": keyPageDown,
+}
+
+// readKey reads a single key press from r. Escape sequences are expected to
+// arrive in one piece; a lone ESC is reported as keyEscape.
+func readKey(r *bufio.Reader) (key, error) {
+	c, _, err := r.ReadRune()
+	if err != nil {
+		return key{}, err
+	}
+	switch c {
+	case '\r', '\n':
+		return key{code: keyEnter}, nil
+	case 3:
+		return key{code: keyCtrlC}, nil
+	case 8, 127:
+		return key{code: keyBackspace}, nil
+	case 27:
+	default:
+		return key{code: keyRune, r: c}, nil
+	}
+
+	if r.Buffered() == 0 {
+		return key{code: keyEscape}, nil
+	}
+	if b, _ := r.Peek(1); b[0] != '[' && b[0] != 'O' {
+		return key{code: keyEscape}, nil
+	}
+	r.ReadByte()
+	var seq []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return key{code: keyUnknown}, nil
+		}
+		seq = append(seq, b)
+		// Sequences end with a letter or a tilde.
+		if b == '~' || (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') {
+			break
+		}
+	}
+	if code, ok := escapes[string(seq)]; ok {
+		return key{code: code}, nil
+	}
+	return key{code: keyUnknown}, nil
+}
+
+// readKeys sends all key presses read from r on the returned channel. The
+// channel is closed once reading fails.
+func readKeys(r io.Reader) <-chan key {
+	ch := make(chan key)
+	go func() {
+		defer close(ch)
+		br := bufio.NewReader(r)
+		for {
+			k, err := readKey(br)
+			if err != nil {
+				return
+			}
+			ch <- k
+		}
+	}()
+	return ch
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,195 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Command sysdb-browse is an interactive terminal browser for the SysDB
+// store. It displays a tree of hosts and their services, metrics, and
+// attributes which is refreshed periodically. Hosts are fetched when they
+// are expanded for the first time. The timeseries of metrics may be viewed
+// as sparklines.
+//
+// Usage:
+//
+//	sysdb-browse [flags]
+//
+// Connection settings default to the ones of the user's client
+// configuration (see client.LoadConfig). The following flags are supported:
+//
+//	-addr address  the address of the SysDB server
+//	-user name     the user name
+//	-config file   read the client configuration from file
+//	-refresh d     the interval between refreshes (default: 30s; 0 disables
+//	               automatic refreshes)
+//	-range d       the time range of timeseries (default: 1h)
+//	-timeout d     the maximum time to wait for each request (default: 10s)
+//
+// Keys:
+//
+//	up, down, j, k      move the selection
+//	enter, right, l     expand the selected object or show the timeseries
+//	                    of the selected metric
+//	left, h, backspace  collapse the selected object or select its parent
+//	/                   search for objects (esc clears the search)
+//	t                   show the timeseries of the selected metric
+//	r                   refresh
+//	q, ctrl-c           quit
+//
+// The terminal is switched to raw mode using stty(1).
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sysdb/go/client"
+)
+
+func main() {
+	var (
+		addr    = flag.String("addr", "", "the address of the SysDB server")
+		user    = flag.String("user", "", "the user name")
+		config  = flag.String("config", "", "read the client configuration from `file`")
+		refresh = flag.Duration("refresh", 30*time.Second, "the interval between refreshes (0 disables automatic refreshes)")
+		tsRange = flag.Duration("range", time.Hour, "the time range of timeseries")
+		timeout = flag.Duration("timeout", 10*time.Second, "the maximum time to wait for each request")
+	)
+	flag.Parse()
+	if flag.NArg() > 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var cfg client.Config
+	var err error
+	if *config != "" {
+		cfg, err = client.ReadConfigFile(*config)
+	} else {
+		cfg, err = client.LoadConfig()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sysdb-browse: %v\n", err)
+		os.Exit(2)
+	}
+	if *addr != "" {
+		cfg.Addr = *addr
+	}
+	if *user != "" {
+		cfg.User = *user
+	}
+	c, err := cfg.Connect()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sysdb-browse: failed to connect: %v\n", err)
+		os.Exit(2)
+	}
+	defer c.Close()
+
+	restore, err := rawMode()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sysdb-browse: %v\n", err)
+		os.Exit(1)
+	}
+	// Use the alternate screen and hide the cursor.
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	defer func() {
+		fmt.Print("\x1b[?25h\x1b[?1049l")
+		restore()
+	}()
+
+	b := newBrowser(c, *timeout, *tsRange)
+	b.refresh()
+	loop(b, *refresh)
+}
+
+// loop handles key presses and refreshes until the user quits.
+func loop(b *browser, refresh time.Duration) {
+	var tick <-chan time.Time
+	if refresh > 0 {
+		t := time.NewTicker(refresh)
+		defer t.Stop()
+		tick = t.C
+	}
+	keys := readKeys(os.Stdin)
+	for {
+		width, height := termSize()
+		b.render(os.Stdout, width, height)
+		select {
+		case k, ok := <-keys:
+			if !ok || !b.handleKey(k, height-2) {
+				return
+			}
+		case <-tick:
+			if b.spark == nil {
+				b.refresh()
+			}
+		}
+	}
+}
+
+// stty runs stty(1) on the terminal and returns its output.
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// rawMode switches the terminal to raw mode and returns a function restoring
+// the previous settings.
+func rawMode() (func(), error) {
+	state, err := stty("-g")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get terminal settings: %v", err)
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return nil, fmt.Errorf("failed to switch terminal to raw mode: %v", err)
+	}
+	return func() { stty(state) }, nil
+}
+
+// termSize returns the size of the terminal, defaulting to 80x24.
+func termSize() (width, height int) {
+	width, height = 80, 24
+	out, err := stty("size")
+	if err != nil {
+		return width, height
+	}
+	f := strings.Fields(out)
+	if len(f) != 2 {
+		return width, height
+	}
+	if h, err := strconv.Atoi(f[0]); err == nil && h > 2 {
+		height = h
+	}
+	if w, err := strconv.Atoi(f[1]); err == nil && w > 0 {
+		width = w
+	}
+	return width, height
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,133 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package main
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/sysdb/go/client"
+	"github.com/sysdb/go/dump"
+	"github.com/sysdb/go/sysdb"
+)
+
+// A dumper writes the hosts selected by a query to an archive.
+type dumper struct {
+	c       client.Interface
+	query   string
+	series  time.Duration
+	timeout time.Duration
+	end     time.Time
+
+	// warn, if not nil, is called for objects which are skipped, for
+	// example hosts removed while creating the snapshot.
+	warn func(format string, args ...interface{})
+}
+
+func (d *dumper) context() (context.Context, context.CancelFunc) {
+	if d.timeout > 0 {
+		return context.WithTimeout(context.Background(), d.timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+func (d *dumper) warnf(format string, args ...interface{}) {
+	if d.warn != nil {
+		d.warn(format, args...)
+	}
+}
+
+// dump writes an archive with the header h to out. The query is recorded in
+// the archive's metadata.
+func (d *dumper) dump(out io.Writer, h dump.Header) error {
+	var names []string
+	ctx, cancel := d.context()
+	err := d.c.QueryHostsContext(ctx, d.query, func(h *sysdb.Host) error {
+		names = append(names, h.Name)
+		return nil
+	})
+	cancel()
+	if err != nil {
+		return err
+	}
+
+	if h.Metadata == nil {
+		h.Metadata = make(map[string]string)
+	}
+	h.Metadata["query"] = d.query
+	w, err := dump.NewWriter(out, h)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := d.host(w, name); err != nil {
+			return err
+		}
+	}
+	return w.Close()
+}
+
+// host writes the named host and, if requested, the timeseries of its
+// metrics to w.
+func (d *dumper) host(w *dump.Writer, name string) error {
+	ctx, cancel := d.context()
+	h, err := d.c.FetchHost(ctx, name)
+	cancel()
+	if sysdb.ErrorCode(err) == sysdb.CodeRequestFailed {
+		d.warnf("skipping host %s: %v", name, err)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err := w.WriteHost(h); err != nil {
+		return err
+	}
+	if d.series <= 0 {
+		return nil
+	}
+
+	for _, m := range h.Metrics {
+		if !m.Timeseries {
+			continue
+		}
+		ctx, cancel := d.context()
+		ts, err := d.c.TimeseriesContext(ctx, h.Name, m.Name, d.end.Add(-d.series), d.end)
+		cancel()
+		if sysdb.ErrorCode(err) == sysdb.CodeRequestFailed {
+			d.warnf("skipping timeseries %s.%s: %v", h.Name, m.Name, err)
+			continue
+		} else if err != nil {
+			return err
+		}
+		if err := w.WriteTimeseries(h.Name, m.Name, ts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
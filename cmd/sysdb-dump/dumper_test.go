@@ -0,0 +1,130 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/sysdb/go/client/clienttest"
+	"github.com/sysdb/go/dump"
+	"github.com/sysdb/go/sysdb"
+)
+
+func TestDumper(t *testing.T) {
+	now := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+	f := clienttest.NewFake(
+		sysdb.Host{
+			Name:     "h1",
+			Services: []sysdb.Service{{Name: "s"}},
+			Metrics:  []sysdb.Metric{{Name: "m1", Timeseries: true}, {Name: "m2"}, {Name: "m3", Timeseries: true}},
+		},
+		sysdb.Host{Name: "h2", Attributes: []sysdb.Attribute{{Name: "a", Value: "v"}}},
+	)
+	f.SetResult("LIST hosts", []sysdb.Host{{Name: "h1"}, {Name: "gone"}, {Name: "h2"}})
+	f.SetTimeseries("h1", "m1", sysdb.Timeseries{
+		Data: map[string][]sysdb.DataPoint{"value": {
+			{Timestamp: sysdb.Time(now.Add(-2 * time.Hour)), Value: 1},
+			{Timestamp: sysdb.Time(now.Add(-time.Minute)), Value: 2},
+		}},
+	})
+
+	var warnings []string
+	d := &dumper{
+		c:      f,
+		query:  "LIST hosts",
+		series: time.Hour,
+		end:    now,
+		warn: func(format string, args ...interface{}) {
+			warnings = append(warnings, fmt.Sprintf(format, args...))
+		},
+	}
+	var buf bytes.Buffer
+	if err := d.dump(&buf, dump.Header{}); err != nil {
+		t.Fatalf("dump() = %v", err)
+	}
+	if len(warnings) != 2 {
+		t.Errorf("dump() warned about %q; want the missing host and timeseries", warnings)
+	}
+
+	r, err := dump.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("NewReader() = %v", err)
+	}
+	if h := r.Header(); h.Compression != "gzip" || h.Metadata["query"] != "LIST hosts" {
+		t.Errorf("Header() = %+v; want gzip compression and query metadata", h)
+	}
+	var got []string
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Next() = %v", err)
+		}
+		switch rec.Type {
+		case dump.HostRecord:
+			got = append(got, fmt.Sprintf("host %s (%d services, %d metrics, %d attributes)",
+				rec.Host.Name, len(rec.Host.Services), len(rec.Host.Metrics), len(rec.Host.Attributes)))
+		case dump.TimeseriesRecord:
+			got = append(got, fmt.Sprintf("timeseries %s.%s (%d points)",
+				rec.HostName, rec.Metric, len(rec.Timeseries.Data["value"])))
+		}
+	}
+	want := []string{
+		"host h1 (1 services, 3 metrics, 0 attributes)",
+		"timeseries h1.m1 (1 points)",
+		"host h2 (0 services, 0 metrics, 1 attributes)",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("dump() wrote records %q; want %q", got, want)
+	}
+}
+
+func TestDumperErrors(t *testing.T) {
+	f := clienttest.NewFake()
+	f.SetError("LIST hosts", errors.New("failed"))
+
+	d := &dumper{c: f, query: "LIST hosts"}
+	var buf bytes.Buffer
+	if err := d.dump(&buf, dump.Header{}); err == nil {
+		t.Errorf("dump(<failing query>) = <nil>; want <err>")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("dump(<failing query>) wrote %d bytes; want 0", buf.Len())
+	}
+
+	f.SetResult("LIST hosts", []sysdb.Host{})
+	if err := d.dump(&buf, dump.Header{Compression: "unknown"}); sysdb.ErrorCode(err) != sysdb.CodeUnsupported {
+		t.Errorf("dump(<unknown compression>) = %v; want <error %v>", err, sysdb.CodeUnsupported)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,183 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Command sysdb-dump writes a snapshot of the SysDB store to a dump archive
+// (see package dump). Hosts are fetched one by one including all of their
+// services, metrics, and attributes and are written as they are received,
+// so snapshots of any size may be created using constant memory.
+//
+// Usage:
+//
+//	sysdb-dump [flags] [file]
+//
+// The archive is written to file or to the standard output if no file is
+// specified. Use sysdb-restore to load an archive into SysDB.
+//
+// Connection settings default to the ones of the user's client
+// configuration (see client.LoadConfig). The following flags are supported:
+//
+//	-addr address       the address of the SysDB server
+//	-user name          the user name
+//	-config file        read the client configuration from file
+//	-query q            a query selecting the hosts to dump
+//	                    (default: LIST hosts)
+//	-compression method the compression method (default: gzip)
+//	-encoding enc       the record encoding, json or gob (default: json)
+//	-timeseries d       include the timeseries of all metrics for the
+//	                    specified time range up to now (default: 0, that
+//	                    is, no timeseries)
+//	-timeout d          the maximum time to wait for each request
+//	-key file           sign the archive using the Ed25519 private key
+//	                    read from file (see dump.ParsePrivateKey)
+//	-sig file           write the detached signature to file (default:
+//	                    the archive file name with ".sig" appended)
+//
+// Signatures are written as raw bytes and may be verified using the -key
+// option of sysdb-restore.
+package main
+
+import (
+	"crypto/ed25519"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/sysdb/go/client"
+	"github.com/sysdb/go/dump"
+)
+
+func main() {
+	var (
+		addr        = flag.String("addr", "", "the address of the SysDB server")
+		user        = flag.String("user", "", "the user name")
+		config      = flag.String("config", "", "read the client configuration from `file`")
+		query       = flag.String("query", "LIST hosts", "a `query` selecting the hosts to dump")
+		compression = flag.String("compression", "gzip", "the compression `method`")
+		encoding    = flag.String("encoding", dump.JSONEncoding, "the record `encoding`, json or gob")
+		series      = flag.Duration("timeseries", 0, "include the timeseries of all metrics for the specified time range up to now")
+		timeout     = flag.Duration("timeout", 0, "the maximum time to wait for each request")
+		keyFile     = flag.String("key", "", "sign the archive using the private key read from `file`")
+		sigFile     = flag.String("sig", "", "write the signature to `file` (default: the archive file name with .sig appended)")
+	)
+	flag.Parse()
+	if flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var key ed25519.PrivateKey
+	if *keyFile != "" {
+		if *sigFile == "" && flag.NArg() == 0 {
+			fmt.Fprintf(os.Stderr, "sysdb-dump: -sig is required when signing an archive written to the standard output\n")
+			os.Exit(2)
+		} else if *sigFile == "" {
+			*sigFile = flag.Arg(0) + ".sig"
+		}
+		data, err := os.ReadFile(*keyFile)
+		if err == nil {
+			key, err = dump.ParsePrivateKey(data)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "sysdb-dump: %s: %v\n", *keyFile, err)
+			os.Exit(2)
+		}
+	}
+
+	var cfg client.Config
+	var err error
+	if *config != "" {
+		cfg, err = client.ReadConfigFile(*config)
+	} else {
+		cfg, err = client.LoadConfig()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sysdb-dump: %v\n", err)
+		os.Exit(2)
+	}
+	if *addr != "" {
+		cfg.Addr = *addr
+	}
+	if *user != "" {
+		cfg.User = *user
+	}
+	c, err := cfg.Connect()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sysdb-dump: failed to connect: %v\n", err)
+		os.Exit(2)
+	}
+	defer c.Close()
+
+	var out io.Writer = os.Stdout
+	var f *os.File
+	if flag.NArg() == 1 {
+		if f, err = os.Create(flag.Arg(0)); err != nil {
+			fmt.Fprintf(os.Stderr, "sysdb-dump: %v\n", err)
+			os.Exit(1)
+		}
+		out = f
+	}
+
+	d := &dumper{
+		c:       c,
+		query:   *query,
+		series:  *series,
+		timeout: *timeout,
+		end:     time.Now(),
+		warn: func(format string, args ...interface{}) {
+			fmt.Fprintf(os.Stderr, "sysdb-dump: "+format+"\n", args...)
+		},
+	}
+	var signer *dump.Signer
+	if key != nil {
+		signer = dump.NewSigner(out, key)
+		out = signer
+	}
+	h := dump.Header{Compression: *compression, Encoding: *encoding}
+	err = d.dump(out, h)
+	if f != nil {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err == nil && signer != nil {
+		var sig []byte
+		if sig, err = signer.Signature(); err == nil {
+			err = os.WriteFile(*sigFile, sig, 0644)
+		}
+	}
+	if err != nil && f != nil {
+		// Don't leave an incomplete or unsigned snapshot behind.
+		os.Remove(f.Name())
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sysdb-dump: %v\n", err)
+		c.Close()
+		os.Exit(1)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,177 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Command sysdb-restore loads a dump archive created by sysdb-dump into
+// SysDB. Hosts, services, metrics, and attributes are stored using the STORE
+// command, one batch of statements per host. The server has to support the
+// STORE command (SysDB 0.7 or later).
+//
+// Attribute values are stored as strings. Timeseries included in the archive
+// are skipped as SysDB does not store timeseries data itself; they remain
+// available from the archive (see package dump).
+//
+// Usage:
+//
+//	sysdb-restore [flags] [file]
+//
+// The archive is read from file or from the standard input if no file is
+// specified.
+//
+// Connection settings default to the ones of the user's client
+// configuration (see client.LoadConfig). The following flags are supported:
+//
+//	-addr address  the address of the SysDB server
+//	-user name     the user name
+//	-config file   read the client configuration from file
+//	-n             print the STORE statements instead of executing them
+//	-key file      verify the archive using the Ed25519 public key read
+//	               from file (see dump.ParsePublicKey)
+//	-sig file      read the detached signature from file (default: the
+//	               archive file name with ".sig" appended)
+//
+// If -key is specified, the full archive is verified before restoring any
+// of its records and tampered archives are refused. Archives read from a
+// pipe are copied to a temporary file for that purpose.
+package main
+
+import (
+	"crypto/ed25519"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/sysdb/go/client"
+	"github.com/sysdb/go/dump"
+)
+
+func main() {
+	var (
+		addr    = flag.String("addr", "", "the address of the SysDB server")
+		user    = flag.String("user", "", "the user name")
+		config  = flag.String("config", "", "read the client configuration from `file`")
+		dryRun  = flag.Bool("n", false, "print the STORE statements instead of executing them")
+		keyFile = flag.String("key", "", "verify the archive using the public key read from `file`")
+		sigFile = flag.String("sig", "", "read the signature from `file` (default: the archive file name with .sig appended)")
+	)
+	flag.Parse()
+	if flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var (
+		key ed25519.PublicKey
+		sig []byte
+	)
+	if *keyFile != "" {
+		if *sigFile == "" && flag.NArg() == 0 {
+			fmt.Fprintf(os.Stderr, "sysdb-restore: -sig is required when verifying an archive read from the standard input\n")
+			os.Exit(2)
+		} else if *sigFile == "" {
+			*sigFile = flag.Arg(0) + ".sig"
+		}
+		data, err := os.ReadFile(*keyFile)
+		if err == nil {
+			key, err = dump.ParsePublicKey(data)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "sysdb-restore: %s: %v\n", *keyFile, err)
+			os.Exit(2)
+		}
+		if sig, err = os.ReadFile(*sigFile); err != nil {
+			fmt.Fprintf(os.Stderr, "sysdb-restore: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	f := os.Stdin
+	if flag.NArg() == 1 {
+		var err error
+		if f, err = os.Open(flag.Arg(0)); err != nil {
+			fmt.Fprintf(os.Stderr, "sysdb-restore: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+	}
+	var in io.Reader = f
+	if key != nil {
+		var err error
+		var cleanup func()
+		if in, cleanup, err = verified(f, key, sig); err != nil {
+			fmt.Fprintf(os.Stderr, "sysdb-restore: %v\n", err)
+			os.Exit(1)
+		}
+		defer cleanup()
+	}
+	r, err := dump.NewReader(in)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sysdb-restore: %v\n", err)
+		os.Exit(1)
+	}
+	defer r.Close()
+
+	store := printStore(os.Stdout)
+	if !*dryRun {
+		var cfg client.Config
+		if *config != "" {
+			cfg, err = client.ReadConfigFile(*config)
+		} else {
+			cfg, err = client.LoadConfig()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "sysdb-restore: %v\n", err)
+			os.Exit(2)
+		}
+		if *addr != "" {
+			cfg.Addr = *addr
+		}
+		if *user != "" {
+			cfg.User = *user
+		}
+		c, err := cfg.Connect()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "sysdb-restore: failed to connect: %v\n", err)
+			os.Exit(2)
+		}
+		defer c.Close()
+		if !c.Supports(client.FeatureStore) {
+			fmt.Fprintf(os.Stderr, "sysdb-restore: the server does not support the STORE command\n")
+			os.Exit(2)
+		}
+		store = batchStore(c)
+	}
+
+	hosts, skipped, err := restore(r, store)
+	if skipped > 0 {
+		fmt.Fprintf(os.Stderr, "sysdb-restore: skipped %d records without host data\n", skipped)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sysdb-restore: failed after %d hosts: %v\n", hosts, err)
+		os.Exit(1)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
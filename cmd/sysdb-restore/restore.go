@@ -0,0 +1,187 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package main
+
+import (
+	"crypto/ed25519"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sysdb/go/client"
+	"github.com/sysdb/go/dump"
+	"github.com/sysdb/go/proto"
+	"github.com/sysdb/go/sysdb"
+)
+
+// verified checks the signature sig of the archive read from f using key and
+// returns a reader for the verified archive. Archives which cannot be read
+// twice, like pipes, are copied to a temporary file while verifying them;
+// the returned cleanup function removes that file.
+func verified(f *os.File, key ed25519.PublicKey, sig []byte) (r io.Reader, cleanup func(), err error) {
+	if _, err := f.Seek(0, io.SeekStart); err == nil {
+		if err := dump.Verify(key, f, sig); err != nil {
+			return nil, nil, err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, nil, err
+		}
+		return f, func() {}, nil
+	}
+
+	tmp, err := os.CreateTemp("", "sysdb-restore-")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup = func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}
+	if err := dump.Verify(key, io.TeeReader(f, tmp), sig); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return tmp, cleanup, nil
+}
+
+// storeQuery formats a STORE statement and appends the LAST UPDATE clause
+// unless last is zero.
+func storeQuery(last sysdb.Time, q string, args ...interface{}) (string, error) {
+	if !time.Time(last).IsZero() {
+		q += " LAST UPDATE %s"
+		args = append(args, time.Time(last))
+	}
+	return client.QueryString(q, args...)
+}
+
+// storeQueries returns the STORE statements recreating the host h including
+// all of its children. Attribute values are stored as strings.
+func storeQueries(h *sysdb.Host) ([]string, error) {
+	var queries []string
+	add := func(last sysdb.Time, q string, args ...interface{}) error {
+		s, err := storeQuery(last, q, args...)
+		if err == nil {
+			queries = append(queries, s)
+		}
+		return err
+	}
+
+	if err := add(h.LastUpdate, "STORE host %s", h.Name); err != nil {
+		return nil, err
+	}
+	for _, a := range h.Attributes {
+		if err := add(a.LastUpdate, "STORE host attribute %s.%s %s", h.Name, a.Name, a.Value); err != nil {
+			return nil, err
+		}
+	}
+	for _, s := range h.Services {
+		if err := add(s.LastUpdate, "STORE service %s.%s", h.Name, s.Name); err != nil {
+			return nil, err
+		}
+		for _, a := range s.Attributes {
+			if err := add(a.LastUpdate, "STORE service attribute %s.%s.%s %s", h.Name, s.Name, a.Name, a.Value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, m := range h.Metrics {
+		q, args := "STORE metric %s.%s", []interface{}{h.Name, m.Name}
+		if m.Store != nil {
+			q += " STORE %s %s"
+			args = append(args, m.Store.Type, m.Store.ID)
+		}
+		if err := add(m.LastUpdate, q, args...); err != nil {
+			return nil, err
+		}
+		for _, a := range m.Attributes {
+			if err := add(a.LastUpdate, "STORE metric attribute %s.%s.%s %s", h.Name, m.Name, a.Name, a.Value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return queries, nil
+}
+
+// batchStore returns a function executing STORE statements using c. The
+// statements of each host are sent as a single batch.
+func batchStore(c *client.Client) func(queries []string) error {
+	return func(queries []string) error {
+		reqs := make([]*proto.Message, len(queries))
+		for i, q := range queries {
+			reqs[i] = &proto.Message{Type: proto.ConnectionQuery, Raw: []byte(q)}
+		}
+		for i, res := range c.Batch(reqs...) {
+			if res.Err != nil {
+				return sysdb.Errorf(sysdb.ErrorCode(res.Err), "%s: %w", queries[i], res.Err)
+			}
+			if res.Res.Type != proto.ConnectionOK {
+				return sysdb.Errorf(sysdb.CodeUnexpectedMessage, "%s: unexpected reply %s", queries[i], res.Res.Type)
+			}
+		}
+		return nil
+	}
+}
+
+// printStore returns a function writing STORE statements to w.
+func printStore(w io.Writer) func(queries []string) error {
+	return func(queries []string) error {
+		_, err := io.WriteString(w, strings.Join(queries, ";\n")+";\n")
+		return err
+	}
+}
+
+// restore passes the STORE statements for all host records read from r to
+// store. It returns the number of restored hosts and of skipped timeseries
+// records; SysDB does not store timeseries data itself.
+func restore(r *dump.Reader, store func(queries []string) error) (hosts, skipped int, err error) {
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			return hosts, skipped, nil
+		} else if err != nil {
+			return hosts, skipped, err
+		}
+		if rec.Type != dump.HostRecord || rec.Host == nil {
+			skipped++
+			continue
+		}
+		queries, err := storeQueries(rec.Host)
+		if err != nil {
+			return hosts, skipped, err
+		}
+		if err := store(queries); err != nil {
+			return hosts, skipped, err
+		}
+		hosts++
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
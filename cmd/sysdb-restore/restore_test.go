@@ -0,0 +1,233 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sysdb/go/client"
+	"github.com/sysdb/go/dump"
+	"github.com/sysdb/go/proto/prototest"
+	"github.com/sysdb/go/sysdb"
+)
+
+var now = sysdb.Time(time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC))
+
+func TestStoreQueries(t *testing.T) {
+	attrs := []sysdb.Attribute{{Name: "a", Value: "it's", LastUpdate: now}}
+	for _, test := range []struct {
+		host sysdb.Host
+		want []string
+	}{
+		{
+			host: sysdb.Host{Name: "h"},
+			want: []string{"STORE host 'h'"},
+		},
+		{
+			host: sysdb.Host{
+				Name:       "h",
+				LastUpdate: now,
+				Attributes: attrs,
+				Services:   []sysdb.Service{{Name: "s", LastUpdate: now, Attributes: attrs}},
+				Metrics: []sysdb.Metric{
+					{Name: "m1", LastUpdate: now, Attributes: attrs},
+					{Name: "m2", Store: &sysdb.MetricStore{Type: "rrdtool", ID: "/var/lib/m2.rrd"}},
+				},
+			},
+			want: []string{
+				"STORE host 'h' LAST UPDATE 2016-01-02 03:04:05",
+				"STORE host attribute 'h'.'a' 'it''s' LAST UPDATE 2016-01-02 03:04:05",
+				"STORE service 'h'.'s' LAST UPDATE 2016-01-02 03:04:05",
+				"STORE service attribute 'h'.'s'.'a' 'it''s' LAST UPDATE 2016-01-02 03:04:05",
+				"STORE metric 'h'.'m1' LAST UPDATE 2016-01-02 03:04:05",
+				"STORE metric attribute 'h'.'m1'.'a' 'it''s' LAST UPDATE 2016-01-02 03:04:05",
+				"STORE metric 'h'.'m2' STORE 'rrdtool' '/var/lib/m2.rrd'",
+			},
+		},
+	} {
+		got, err := storeQueries(&test.host)
+		if err != nil || strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+			t.Errorf("storeQueries(%s) = %q, %v; want %q, <nil>", test.host.Name, got, err, test.want)
+		}
+	}
+}
+
+func TestRestore(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := dump.NewWriter(&buf, dump.Header{})
+	if err != nil {
+		t.Fatalf("NewWriter() = %v", err)
+	}
+	w.WriteHost(&sysdb.Host{Name: "h1", Services: []sysdb.Service{{Name: "s"}}})
+	w.WriteTimeseries("h1", "m", &sysdb.Timeseries{Start: now, End: now})
+	w.WriteHost(&sysdb.Host{Name: "h2"})
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+
+	r, err := dump.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("NewReader() = %v", err)
+	}
+	var out bytes.Buffer
+	hosts, skipped, err := restore(r, printStore(&out))
+	if hosts != 2 || skipped != 1 || err != nil {
+		t.Errorf("restore() = %d, %d, %v; want 2, 1, <nil>", hosts, skipped, err)
+	}
+	want := "STORE host 'h1';\nSTORE service 'h1'.'s';\nSTORE host 'h2';\n"
+	if got := out.String(); got != want {
+		t.Errorf("restore() printed %q; want %q", got, want)
+	}
+}
+
+func TestVerified(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey() = %v", err)
+	}
+	var buf bytes.Buffer
+	w, err := dump.NewWriter(&buf, dump.Header{})
+	if err != nil {
+		t.Fatalf("NewWriter() = %v", err)
+	}
+	w.WriteHost(&sysdb.Host{Name: "h"})
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+	archive := buf.Bytes()
+	sig, err := dump.Sign(priv, bytes.NewReader(archive))
+	if err != nil {
+		t.Fatalf("Sign() = %v", err)
+	}
+	tampered := append([]byte{}, archive...)
+	tampered[len(tampered)-1] ^= 0xff
+
+	// open returns data as a regular file or, if pipe is set, as a pipe.
+	dir := t.TempDir()
+	open := func(data []byte, pipe bool) *os.File {
+		if pipe {
+			r, w, err := os.Pipe()
+			if err != nil {
+				t.Fatalf("Pipe() = %v", err)
+			}
+			go func() {
+				w.Write(data)
+				w.Close()
+			}()
+			return r
+		}
+		name := filepath.Join(dir, "archive")
+		if err := os.WriteFile(name, data, 0600); err != nil {
+			t.Fatalf("WriteFile() = %v", err)
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatalf("Open() = %v", err)
+		}
+		return f
+	}
+
+	for _, pipe := range []bool{false, true} {
+		f := open(archive, pipe)
+		r, cleanup, err := verified(f, pub, sig)
+		if err != nil {
+			t.Errorf("verified(pipe=%v) = %v; want <nil>", pipe, err)
+		} else if got, err := io.ReadAll(r); err != nil || !bytes.Equal(got, archive) {
+			t.Errorf("verified(pipe=%v) returned %q, %v; want the archive", pipe, got, err)
+		}
+		if cleanup != nil {
+			cleanup()
+		}
+		f.Close()
+
+		f = open(tampered, pipe)
+		if _, _, err := verified(f, pub, sig); sysdb.ErrorCode(err) != sysdb.CodeVerificationFailed {
+			t.Errorf("verified(<tampered>, pipe=%v) = %v; want <error %v>", pipe, err, sysdb.CodeVerificationFailed)
+		}
+		f.Close()
+	}
+}
+
+func TestBatchStore(t *testing.T) {
+	srv := prototest.NewServer()
+	defer srv.Close()
+	srv.HandleQuery("STORE host 'h1'", prototest.Response{})
+	srv.HandleQuery("STORE service 'h1'.'s'", prototest.Response{})
+	srv.HandleQuery("STORE host 'h2'", prototest.Response{Err: "failed"})
+
+	c, err := client.Connect(srv.Addr, "test", client.WithPoolSize(1))
+	if err != nil {
+		t.Fatalf("Connect() = %v", err)
+	}
+	defer c.Close()
+
+	store := batchStore(c)
+	if err := store([]string{"STORE host 'h1'", "STORE service 'h1'.'s'"}); err != nil {
+		t.Errorf("store(h1) = %v; want <nil>", err)
+	}
+	err = store([]string{"STORE host 'h2'"})
+	if sysdb.ErrorCode(err) != sysdb.CodeRequestFailed || !strings.Contains(fmt.Sprint(err), "STORE host 'h2'") {
+		t.Errorf("store(h2) = %v; want <error %v> mentioning the statement", err, sysdb.CodeRequestFailed)
+	}
+	var got []string
+	for _, req := range srv.Requests() {
+		got = append(got, string(req.Raw))
+	}
+	want := []string{"STORE host 'h1'", "STORE service 'h1'.'s'", "STORE host 'h2'"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("store() sent %q; want %q", got, want)
+	}
+
+	// Hosts have to be stored before their children.
+	var queries []string
+	for i := 0; i < 20; i++ {
+		q := fmt.Sprintf("STORE host 'h%d'", i)
+		srv.HandleQuery(q, prototest.Response{})
+		queries = append(queries, q)
+	}
+	before := len(srv.Requests())
+	if err := store(queries); err != nil {
+		t.Errorf("store(h0..h19) = %v; want <nil>", err)
+	}
+	got = nil
+	for _, req := range srv.Requests()[before:] {
+		got = append(got, string(req.Raw))
+	}
+	if !reflect.DeepEqual(got, queries) {
+		t.Errorf("store() sent %q; want %q", got, queries)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,122 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"github.com/sysdb/go/client"
+	"github.com/sysdb/go/export"
+	"github.com/sysdb/go/sysdb"
+)
+
+// A formatter writes a query result to w.
+type formatter func(w io.Writer, res interface{}) error
+
+var formatters = map[string]formatter{
+	"table":     formatTable,
+	"json":      formatJSON,
+	"csv":       formatCSV,
+	"canonical": formatCanonical,
+}
+
+// formatJSON writes the indented JSON encoding of res.
+func formatJSON(w io.Writer, res interface{}) error {
+	if res == nil {
+		return nil
+	}
+	data, err := json.MarshalIndent(res, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+// formatCanonical writes the canonical JSON encoding of res (see
+// sysdb.MarshalCanonical), suitable for comparing results byte-by-byte.
+func formatCanonical(w io.Writer, res interface{}) error {
+	if res == nil {
+		return nil
+	}
+	data, err := sysdb.MarshalCanonical(res)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// formatTable writes res as a table with aligned columns (see
+// client.NewTable).
+func formatTable(w io.Writer, res interface{}) error {
+	t, err := client.NewTable(res)
+	if err != nil || t == nil || len(t.Columns) == 0 {
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.ToUpper(strings.Join(t.ColumnNames(), "\t")))
+	for _, row := range t.Rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// formatTemplate returns a formatter rendering hosts using the inventory
+// template t (see export.WriteInventory). Other results are not supported.
+func formatTemplate(t *template.Template) formatter {
+	return func(w io.Writer, res interface{}) error {
+		switch res := res.(type) {
+		case []sysdb.Host:
+			return export.WriteInventory(w, t, res)
+		case sysdb.Host:
+			return export.WriteInventory(w, t, []sysdb.Host{res})
+		case nil:
+			return nil
+		}
+		return sysdb.Errorf(sysdb.CodeUnsupported, "cannot render %T using a template", res)
+	}
+}
+
+// formatCSV writes res as CSV including a header line.
+func formatCSV(w io.Writer, res interface{}) error {
+	t, err := client.NewTable(res)
+	if err != nil || t == nil || len(t.Columns) == 0 {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	cw.Write(t.ColumnNames())
+	cw.WriteAll(t.Rows)
+	return cw.Error()
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
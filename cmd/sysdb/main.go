@@ -0,0 +1,213 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Command sysdb is a command-line client for SysDB. It executes queries on a
+// SysDB server and prints the results.
+//
+// Usage:
+//
+//	sysdb [flags] [query]
+//
+// If no query is specified on the command line, queries are read from the
+// standard input, one per line. If the standard input is a terminal or the
+// -i flag is specified, an interactive shell is started instead. In the
+// shell, queries may span multiple lines and are terminated by a semicolon.
+// Meta commands start with a backslash; enter \? for a list. The shell does
+// not provide line editing itself; use a wrapper such as rlwrap for that.
+//
+// Connection settings default to the ones of the user's client
+// configuration (see client.LoadConfig) and may be overridden using the
+// following flags:
+//
+//	-addr address   the address of the server
+//	-user name      the user name
+//	-config file    read the client configuration from file
+//	-format format  the output format: table (default), json, csv, or
+//	                canonical (deterministic JSON, see sysdb.MarshalCanonical)
+//	-template file  render host results using the text/template file (see
+//	                export.ParseTemplates); overrides -format
+//	-timeout d      the maximum time to wait for each query (e.g. 10s)
+//	-i              start an interactive shell
+//	-history file   the history file of the shell (default: ~/.sysdb_history;
+//	                an empty value disables the history file)
+//
+// The exit status is 0 if all queries succeeded, 1 if any query failed, and
+// 2 on usage or connection errors.
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sysdb/go/client"
+	"github.com/sysdb/go/export"
+)
+
+const programName = "sysdb"
+
+// Exit codes.
+const (
+	exitOK     = 0
+	exitFailed = 1
+	exitUsage  = 2
+)
+
+func main() {
+	os.Exit(realMain(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// realMain runs the command with the specified arguments and returns the
+// exit code.
+func realMain(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet(programName, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var (
+		addr        = fs.String("addr", "", "the address of the server")
+		user        = fs.String("user", "", "the user name")
+		config      = fs.String("config", "", "read the client configuration from `file`")
+		format      = fs.String("format", "table", "the output `format`: table, json, csv, or canonical")
+		timeout     = fs.Duration("timeout", 0, "the maximum time to wait for each query")
+		tmplFile    = fs.String("template", "", "render host results using the template `file`")
+		interactive = fs.Bool("i", false, "start an interactive shell")
+		history     = fs.String("history", defaultHistoryFile(), "the history `file` of the interactive shell")
+	)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: %s [flags] [query]\n\nFlags:\n", programName)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	f, ok := formatters[*format]
+	if !ok {
+		fmt.Fprintf(stderr, "%s: unknown format %q\n", programName, *format)
+		return exitUsage
+	}
+	if *tmplFile != "" {
+		t, err := export.ParseTemplates(*tmplFile)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", programName, err)
+			return exitUsage
+		}
+		f = formatTemplate(t)
+	}
+
+	var cfg client.Config
+	var err error
+	if *config != "" {
+		cfg, err = client.ReadConfigFile(*config)
+	} else {
+		cfg, err = client.LoadConfig()
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %v\n", programName, err)
+		return exitUsage
+	}
+	if *addr != "" {
+		cfg.Addr = *addr
+	}
+	if *user != "" {
+		cfg.User = *user
+	}
+
+	c, err := cfg.Connect()
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: failed to connect: %v\n", programName, err)
+		return exitUsage
+	}
+	defer c.Close()
+
+	if fs.NArg() == 0 && (*interactive || isTerminal(stdin)) {
+		return newShell(c, *format, *timeout, *history, stdin, stdout, stderr).run()
+	}
+
+	var queries []string
+	if fs.NArg() > 0 {
+		queries = []string{strings.Join(fs.Args(), " ")}
+	} else {
+		s := bufio.NewScanner(stdin)
+		for s.Scan() {
+			if q := strings.TrimSpace(s.Text()); q != "" {
+				queries = append(queries, q)
+			}
+		}
+		if err := s.Err(); err != nil {
+			fmt.Fprintf(stderr, "%s: failed to read queries: %v\n", programName, err)
+			return exitUsage
+		}
+	}
+	return run(c, queries, f, *timeout, stdout, stderr)
+}
+
+// defaultHistoryFile returns the path of the default history file or an
+// empty string if the home directory is unknown.
+func defaultHistoryFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".sysdb_history")
+}
+
+// isTerminal reports whether r is a terminal.
+func isTerminal(r io.Reader) bool {
+	f, ok := r.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// run executes the queries using c and prints their results to stdout using
+// the formatter f. Errors are reported on stderr. It returns the exit code.
+func run(c client.Interface, queries []string, f formatter, timeout time.Duration, stdout, stderr io.Writer) int {
+	code := exitOK
+	for _, q := range queries {
+		ctx, cancel := context.Background(), context.CancelFunc(func() {})
+		if timeout > 0 {
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+		}
+		res, err := c.QueryContext(ctx, strings.TrimSuffix(q, ";"))
+		cancel()
+		if err == nil {
+			err = f(stdout, res)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %s: %v\n", programName, q, err)
+			code = exitFailed
+		}
+	}
+	return code
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
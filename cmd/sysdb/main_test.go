@@ -0,0 +1,158 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sysdb/go/client/clienttest"
+	"github.com/sysdb/go/proto"
+	"github.com/sysdb/go/proto/prototest"
+	"github.com/sysdb/go/sysdb"
+)
+
+var now = sysdb.Time(time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC))
+
+func TestRun(t *testing.T) {
+	f := clienttest.NewFake()
+	f.SetResult("LIST hosts", []sysdb.Host{
+		{Name: "h1", LastUpdate: now, UpdateInterval: sysdb.Minute, Backends: []string{"a", "b"}},
+		{Name: "host2", LastUpdate: now},
+	})
+	f.SetResult("LIST metrics", sysdb.MetricList{
+		{Host: "h1", Metric: sysdb.Metric{Name: "m1", LastUpdate: now, Timeseries: true}},
+	})
+	f.SetError("LIST services", errors.New("failed"))
+
+	for _, test := range []struct {
+		queries []string
+		format  string
+		code    int
+		out     string
+		err     string
+	}{
+		{
+			[]string{"LIST hosts;"}, "table", exitOK,
+			"NAME   LAST_UPDATE           UPDATE_INTERVAL  BACKENDS\n" +
+				"h1     2016-01-02T03:04:05Z  1m               a,b\n" +
+				"host2  2016-01-02T03:04:05Z  0s               \n",
+			"",
+		},
+		{
+			[]string{"LIST hosts"}, "csv", exitOK,
+			"name,last_update,update_interval,backends\n" +
+				"h1,2016-01-02T03:04:05Z,1m,\"a,b\"\n" +
+				"host2,2016-01-02T03:04:05Z,0s,\n",
+			"",
+		},
+		{
+			[]string{"LIST metrics"}, "csv", exitOK,
+			"host,name,last_update,update_interval,backends,timeseries\n" +
+				"h1,m1,2016-01-02T03:04:05Z,0s,,true\n",
+			"",
+		},
+		{
+			[]string{"LIST services", "LIST metrics"}, "csv", exitFailed,
+			"host,name,last_update,update_interval,backends,timeseries\n" +
+				"h1,m1,2016-01-02T03:04:05Z,0s,,true\n",
+			"sysdb: LIST services: failed\n",
+		},
+	} {
+		var stdout, stderr bytes.Buffer
+		code := run(f, test.queries, formatters[test.format], 0, &stdout, &stderr)
+		if code != test.code || stdout.String() != test.out || stderr.String() != test.err {
+			t.Errorf("run(%q, %s) = %d\n%s\nstderr: %q\nwant %d\n%s\nstderr: %q",
+				test.queries, test.format, code, stdout.String(), stderr.String(),
+				test.code, test.out, test.err)
+		}
+	}
+}
+
+func TestFormatJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := formatJSON(&buf, []sysdb.Host{{Name: "h1"}}); err != nil ||
+		!strings.HasPrefix(buf.String(), "[\n\t{\n\t\t\"name\": \"h1\",") {
+		t.Errorf("formatJSON([h1]) = %v\n%s\nwant <nil> and indented JSON", err, buf.String())
+	}
+	buf.Reset()
+	if err := formatTable(&buf, map[string]string{"a": "x"}); err != nil || buf.String() != "A\nx\n" {
+		t.Errorf("formatTable(<map>) = %v\n%s\nwant <nil>\nA\nx", err, buf.String())
+	}
+	buf.Reset()
+	if err := formatCanonical(&buf, []sysdb.Host{{Name: "b"}, {Name: "a"}}); err != nil ||
+		!strings.HasPrefix(buf.String(), "[\n\t{\n\t\t\"name\": \"a\",") {
+		t.Errorf("formatCanonical([b a]) = %v\n%s\nwant <nil> and sorted JSON", err, buf.String())
+	}
+	buf.Reset()
+	if err := formatTable(&buf, make(chan int)); sysdb.ErrorCode(err) != sysdb.CodeUnsupported {
+		t.Errorf("formatTable(<chan>) = %v; want code %s", err, sysdb.CodeUnsupported)
+	}
+}
+
+func TestRealMain(t *testing.T) {
+	srv := prototest.NewServer()
+	defer srv.Close()
+	srv.HandleQuery("LIST hosts", prototest.Response{Type: proto.ConnectionList, Data: []sysdb.Host{{Name: "h1", LastUpdate: now}}})
+
+	config := filepath.Join(t.TempDir(), "client.conf")
+	if err := ioutil.WriteFile(config, []byte("Address \""+srv.Addr+"\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tmpl := filepath.Join(t.TempDir(), "hosts.tmpl")
+	if err := ioutil.WriteFile(tmpl, []byte("{{range .Hosts}}Host {{.Name}}\n{{end}}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		args  []string
+		stdin string
+		code  int
+		out   string
+	}{
+		{[]string{"-config", config, "-format", "csv", "LIST", "hosts"}, "", exitOK, "name,last_update,update_interval,backends\nh1,2016-01-02T03:04:05Z,0s,\n"},
+		{[]string{"-config", config, "-format", "csv"}, "\nLIST hosts\n\n", exitOK, "name,last_update,update_interval,backends\nh1,2016-01-02T03:04:05Z,0s,\n"},
+		{[]string{"-config", config, "LIST services"}, "", exitFailed, ""},
+		{[]string{"-config", config, "-format", "xml", "LIST hosts"}, "", exitUsage, ""},
+		{[]string{"-config", config, "-template", tmpl, "LIST hosts"}, "", exitOK, "Host h1\n"},
+		{[]string{"-config", config, "-template", tmpl + ".missing", "LIST hosts"}, "", exitUsage, ""},
+		{[]string{"-config", config, "-addr", "unix:" + filepath.Join(t.TempDir(), "none"), "LIST hosts"}, "", exitUsage, ""},
+		{[]string{"-unknown"}, "", exitUsage, ""},
+	} {
+		var stdout, stderr bytes.Buffer
+		code := realMain(test.args, strings.NewReader(test.stdin), &stdout, &stderr)
+		if code != test.code || stdout.String() != test.out {
+			t.Errorf("realMain(%q) = %d\n%s\nstderr: %s\nwant %d\n%s", test.args, code, stdout.String(), stderr.String(), test.code, test.out)
+		}
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
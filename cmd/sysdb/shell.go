@@ -0,0 +1,250 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sysdb/go/client"
+	"github.com/sysdb/go/sysdb"
+)
+
+const (
+	prompt         = "sysdb=> "
+	continuePrompt = "sysdb-> "
+)
+
+// keywords lists the query keywords offered for completion.
+var keywords = []string{
+	"END", "FETCH", "FILTER", "LIST", "LOOKUP", "MATCHING", "START",
+	"TIMESERIES", "host", "hosts", "metric", "metrics", "service",
+	"services",
+}
+
+// A shell is an interactive query shell. It reads queries, which may span
+// multiple lines and are terminated by a semicolon, and meta commands
+// starting with a backslash.
+//
+// The shell does not implement line editing itself; use a wrapper such as
+// rlwrap for that.
+type shell struct {
+	c       client.Interface
+	format  string
+	timeout time.Duration
+
+	in     *bufio.Scanner
+	out    io.Writer
+	errOut io.Writer
+
+	// history lists all queries executed in this and previous sessions.
+	// New queries are appended to histFile unless it is empty.
+	history  []string
+	histFile string
+
+	// hosts caches the names of all hosts for completion.
+	hosts []string
+
+	failed bool
+}
+
+// newShell returns a shell reading from in. If histFile is not empty, the
+// history is loaded from and saved to that file.
+func newShell(c client.Interface, format string, timeout time.Duration, histFile string, in io.Reader, out, errOut io.Writer) *shell {
+	sh := &shell{
+		c:        c,
+		format:   format,
+		timeout:  timeout,
+		in:       bufio.NewScanner(in),
+		out:      out,
+		errOut:   errOut,
+		histFile: histFile,
+	}
+	if histFile != "" {
+		if data, err := ioutil.ReadFile(histFile); err == nil {
+			for _, l := range strings.Split(string(data), "\n") {
+				if l != "" {
+					sh.history = append(sh.history, l)
+				}
+			}
+		}
+	}
+	return sh
+}
+
+// run reads and executes queries and commands until the end of the input or
+// a quit command. It returns the exit code.
+func (sh *shell) run() int {
+	var query []string
+	for {
+		if len(query) == 0 {
+			fmt.Fprint(sh.out, prompt)
+		} else {
+			fmt.Fprint(sh.out, continuePrompt)
+		}
+		if !sh.in.Scan() {
+			fmt.Fprintln(sh.out)
+			break
+		}
+		line := strings.TrimSpace(sh.in.Text())
+		if len(query) == 0 && strings.HasPrefix(line, `\`) {
+			if !sh.meta(line) {
+				return sh.exitCode()
+			}
+			continue
+		}
+		if line == "" {
+			continue
+		}
+		query = append(query, line)
+		if strings.HasSuffix(line, ";") {
+			sh.execute(strings.Join(query, " "))
+			query = nil
+		}
+	}
+	if err := sh.in.Err(); err != nil {
+		fmt.Fprintf(sh.errOut, "%s: failed to read input: %v\n", programName, err)
+		return exitUsage
+	}
+	if len(query) > 0 {
+		sh.execute(strings.Join(query, " "))
+	}
+	return sh.exitCode()
+}
+
+func (sh *shell) exitCode() int {
+	if sh.failed {
+		return exitFailed
+	}
+	return exitOK
+}
+
+// execute runs the query q and records it in the history.
+func (sh *shell) execute(q string) {
+	sh.history = append(sh.history, q)
+	if sh.histFile != "" {
+		if f, err := os.OpenFile(sh.histFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600); err == nil {
+			fmt.Fprintln(f, q)
+			f.Close()
+		}
+	}
+	q = strings.TrimSpace(strings.TrimSuffix(q, ";"))
+	if run(sh.c, []string{q}, formatters[sh.format], sh.timeout, sh.out, sh.errOut) != exitOK {
+		sh.failed = true
+	}
+}
+
+// meta executes the meta command line. It returns false if the shell should
+// quit.
+func (sh *shell) meta(line string) bool {
+	args := strings.Fields(line)
+	switch args[0] {
+	case `\q`, `\quit`:
+		return false
+	case `\?`, `\help`:
+		fmt.Fprint(sh.out, `Queries are terminated by a semicolon (;) and may span multiple lines.
+
+Meta commands:
+  \?, \help          show this help
+  \q, \quit          quit the shell
+  \format [format]   show or set the output format (table, json, csv, or canonical)
+  \history           show the query history
+  \complete [text]   list completions of the last word of text
+`)
+	case `\format`:
+		if len(args) == 1 {
+			fmt.Fprintf(sh.out, "Output format is %s.\n", sh.format)
+		} else if _, ok := formatters[args[1]]; ok {
+			sh.format = args[1]
+		} else {
+			fmt.Fprintf(sh.errOut, "%s: unknown format %q\n", programName, args[1])
+		}
+	case `\history`:
+		for i, q := range sh.history {
+			fmt.Fprintf(sh.out, "%5d  %s\n", i+1, q)
+		}
+	case `\complete`:
+		text := strings.TrimSpace(strings.TrimPrefix(line, args[0]))
+		for _, c := range sh.complete(text) {
+			fmt.Fprintln(sh.out, c)
+		}
+	default:
+		fmt.Fprintf(sh.errOut, "%s: unknown command %s; try \\?\n", programName, args[0])
+	}
+	return true
+}
+
+// complete returns all keywords and host names completing the last word of
+// line. Keywords are matched case-insensitively. Host names are retrieved
+// from the server on first use.
+func (sh *shell) complete(line string) []string {
+	word := line
+	if i := strings.LastIndexAny(line, " \t"); i >= 0 {
+		word = line[i+1:]
+	}
+	word = strings.TrimPrefix(word, "'")
+
+	if sh.hosts == nil {
+		sh.hosts = []string{}
+		ctx := context.Background()
+		if sh.timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, sh.timeout)
+			defer cancel()
+		}
+		if res, err := sh.c.QueryContext(ctx, "LIST hosts"); err == nil {
+			if hosts, ok := res.([]sysdb.Host); ok {
+				for _, h := range hosts {
+					sh.hosts = append(sh.hosts, h.Name)
+				}
+			}
+		}
+	}
+
+	var completions []string
+	lower := strings.ToLower(word)
+	for _, k := range keywords {
+		if strings.HasPrefix(strings.ToLower(k), lower) {
+			completions = append(completions, k)
+		}
+	}
+	for _, h := range sh.hosts {
+		if strings.HasPrefix(h, word) {
+			completions = append(completions, h)
+		}
+	}
+	sort.Strings(completions)
+	return completions
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
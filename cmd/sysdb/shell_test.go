@@ -0,0 +1,127 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sysdb/go/client/clienttest"
+	"github.com/sysdb/go/sysdb"
+)
+
+func TestShell(t *testing.T) {
+	f := clienttest.NewFake()
+	f.SetResult("LIST hosts", []sysdb.Host{{Name: "h1", LastUpdate: now}, {Name: "web1", LastUpdate: now}})
+	f.SetError("LIST services", errors.New("failed"))
+
+	hist := filepath.Join(t.TempDir(), "history")
+	if err := ioutil.WriteFile(hist, []byte("FETCH host 'x';\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	input := `\format csv
+LIST
+  hosts;
+\history
+\format xml
+LIST services;
+\q
+LIST hosts;
+`
+	var stdout, stderr bytes.Buffer
+	sh := newShell(f, "table", 0, hist, strings.NewReader(input), &stdout, &stderr)
+	if code := sh.run(); code != exitFailed {
+		t.Errorf("shell.run() = %d; want %d", code, exitFailed)
+	}
+
+	want := prompt + prompt + continuePrompt +
+		"name,last_update,update_interval,backends\n" +
+		"h1,2016-01-02T03:04:05Z,0s,\n" +
+		"web1,2016-01-02T03:04:05Z,0s,\n" +
+		prompt +
+		"    1  FETCH host 'x';\n" +
+		"    2  LIST hosts;\n" +
+		prompt + prompt + prompt
+	if got := stdout.String(); got != want {
+		t.Errorf("shell.run() wrote:\n%s\nwant:\n%s", got, want)
+	}
+	wantErr := "sysdb: unknown format \"xml\"\nsysdb: LIST services: failed\n"
+	if got := stderr.String(); got != wantErr {
+		t.Errorf("shell.run() reported:\n%s\nwant:\n%s", got, wantErr)
+	}
+	if got, want := f.Queries(), []string{"LIST hosts", "LIST services"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("shell.run() executed %q; want %q", got, want)
+	}
+	if data, err := ioutil.ReadFile(hist); err != nil || string(data) != "FETCH host 'x';\nLIST hosts;\nLIST services;\n" {
+		t.Errorf("history file = %q, %v; want three queries", data, err)
+	}
+}
+
+func TestShellEOF(t *testing.T) {
+	f := clienttest.NewFake()
+	f.SetResult("LIST hosts", []sysdb.Host{})
+	var stdout, stderr bytes.Buffer
+	sh := newShell(f, "table", 0, "", strings.NewReader("LIST hosts"), &stdout, &stderr)
+	if code := sh.run(); code != exitOK || stderr.Len() != 0 {
+		t.Errorf("shell.run() = %d (%s); want %d", code, stderr.String(), exitOK)
+	}
+	if got := f.Queries(); !reflect.DeepEqual(got, []string{"LIST hosts"}) {
+		t.Errorf("shell.run() executed %q; want [LIST hosts] on EOF", got)
+	}
+}
+
+func TestComplete(t *testing.T) {
+	f := clienttest.NewFake()
+	f.SetResult("LIST hosts", []sysdb.Host{{Name: "h1"}, {Name: "host2"}, {Name: "web1"}})
+	sh := newShell(f, "table", 0, "", strings.NewReader(""), ioutil.Discard, ioutil.Discard)
+
+	for _, test := range []struct {
+		line     string
+		expected []string
+	}{
+		{"fe", []string{"FETCH"}},
+		{"LIST h", []string{"h1", "host", "host2", "hosts"}},
+		{"FETCH host 'w", []string{"web1"}},
+		{"LOOKUP hosts MATCH", []string{"MATCHING"}},
+		{"x", nil},
+	} {
+		if got := sh.complete(test.line); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("complete(%q) = %q; want %q", test.line, got, test.expected)
+		}
+	}
+	// Host names are only queried once.
+	if got := f.Queries(); len(got) != 1 {
+		t.Errorf("complete() executed %q; want a single query", got)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,115 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sysdb/go/client"
+	"github.com/sysdb/go/export"
+	"github.com/sysdb/go/sysdb"
+)
+
+// An exporter periodically queries SysDB for hosts and serves metadata about
+// them in the Prometheus text exposition format.
+type exporter struct {
+	c client.Interface
+	// queries are LIST or LOOKUP queries returning hosts.
+	queries []string
+	timeout time.Duration
+
+	mu   sync.RWMutex
+	page []byte
+}
+
+// run collects metrics every interval until ctx is done.
+func (e *exporter) run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		e.collect(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// collect executes all queries and updates the served page. Failed queries
+// are reported through the sysdb_up gauge while hosts returned by successful
+// queries are still exported.
+func (e *exporter) collect(ctx context.Context) {
+	start := time.Now()
+	p := &export.Prometheus{Prefix: "sysdb_"}
+	for _, q := range e.queries {
+		qctx, cancel := ctx, context.CancelFunc(func() {})
+		if e.timeout > 0 {
+			qctx, cancel = context.WithTimeout(ctx, e.timeout)
+		}
+		var hosts []sysdb.Host
+		err := e.c.QueryIntoContext(qctx, q, &hosts)
+		cancel()
+
+		up := 1.0
+		if err != nil {
+			up = 0
+		}
+		p.AddGauge("up", "Whether the last query of SysDB succeeded.", map[string]string{"query": q}, up)
+		for i := range hosts {
+			p.AddHost(&hosts[i])
+			p.AddAttributes(&hosts[i])
+		}
+	}
+	p.AddGauge("scrape_duration_seconds", "Time spent querying SysDB.", nil, time.Since(start).Seconds())
+	p.AddGauge("last_scrape_timestamp_seconds", "Time of the last query of SysDB.", nil,
+		float64(start.UnixNano())/float64(time.Second))
+
+	var buf bytes.Buffer
+	p.WriteTo(&buf)
+	e.mu.Lock()
+	e.page = buf.Bytes()
+	e.mu.Unlock()
+}
+
+// ServeHTTP serves the metrics collected last.
+func (e *exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.RLock()
+	page := e.page
+	e.mu.RUnlock()
+	if page == nil {
+		http.Error(w, "metrics not yet collected", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(page)
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
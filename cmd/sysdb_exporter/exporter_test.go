@@ -0,0 +1,106 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sysdb/go/client/clienttest"
+	"github.com/sysdb/go/sysdb"
+)
+
+func TestExporter(t *testing.T) {
+	now := sysdb.Time(time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC))
+	f := clienttest.NewFake()
+	f.SetResult("LIST hosts", []sysdb.Host{
+		{Name: "h1", LastUpdate: now, Attributes: []sysdb.Attribute{{Name: "os", Value: "Linux"}}},
+		{Name: "h2"},
+	})
+	f.SetError("LOOKUP hosts MATCHING name =~ 'db'", errors.New("failed"))
+
+	e := &exporter{c: f, queries: []string{"LIST hosts", "LOOKUP hosts MATCHING name =~ 'db'"}}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("ServeHTTP(<not collected>) = %d; want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	e.collect(context.Background())
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("ServeHTTP() = %d (%s); want %d (text/plain)", rec.Code, rec.Header().Get("Content-Type"), http.StatusOK)
+	}
+	lines := make(map[string]bool)
+	for _, l := range strings.Split(rec.Body.String(), "\n") {
+		lines[l] = true
+	}
+	for _, want := range []string{
+		`sysdb_host_info{host="h1",os="Linux"} 1`,
+		`sysdb_host_info{host="h2"} 1`,
+		`sysdb_host_attribute_info{attribute="os",host="h1",value="Linux"} 1`,
+		`sysdb_host_last_update_timestamp_seconds{host="h1"} 1.451703845e+09`,
+		`sysdb_up{query="LIST hosts"} 1`,
+		`sysdb_up{query="LOOKUP hosts MATCHING name =~ 'db'"} 0`,
+		`# TYPE sysdb_scrape_duration_seconds gauge`,
+		`# TYPE sysdb_last_scrape_timestamp_seconds gauge`,
+	} {
+		if !lines[want] {
+			t.Errorf("ServeHTTP() did not include %q:\n%s", want, rec.Body.String())
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	f := clienttest.NewFake()
+	f.SetResult("LIST hosts", []sysdb.Host{})
+	e := &exporter{c: f, queries: []string{"LIST hosts"}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		e.run(ctx, time.Millisecond)
+		close(done)
+	}()
+	for len(f.Queries()) < 3 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("run() did not return after canceling the context")
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
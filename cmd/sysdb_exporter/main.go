@@ -0,0 +1,135 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Command sysdb_exporter exports metadata about the hosts known to SysDB to
+// Prometheus. It periodically executes LIST or LOOKUP queries and serves the
+// following metrics:
+//
+//	sysdb_host_info                           host name and attributes as labels
+//	sysdb_host_attribute_info                 one series per host attribute
+//	sysdb_host_last_update_timestamp_seconds  time of the last update of a host
+//	sysdb_up                                  whether a query succeeded
+//	sysdb_scrape_duration_seconds             time spent querying SysDB
+//	sysdb_last_scrape_timestamp_seconds       time of the last query
+//
+// Attributes are exported as far as they are included in the query results.
+// Stale hosts may be detected using an alerting rule such as:
+//
+//	time() - sysdb_host_last_update_timestamp_seconds > 3600
+//
+// Usage:
+//
+//	sysdb_exporter [flags]
+//
+// Connection settings default to the ones of the user's client
+// configuration (see client.LoadConfig). The following flags are supported:
+//
+//	-addr address    the address of the SysDB server
+//	-user name       the user name
+//	-config file     read the client configuration from file
+//	-listen address  the address to serve metrics on (default: :9323)
+//	-path path       the HTTP path of the metrics (default: /metrics)
+//	-interval d      the interval between queries (default: 1m)
+//	-timeout d       the maximum time to wait for each query
+//	-query q         a query returning hosts; may be repeated
+//	                 (default: LIST hosts)
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sysdb/go/client"
+)
+
+// queryList is a flag.Value collecting repeated -query flags.
+type queryList []string
+
+func (l *queryList) String() string { return strings.Join(*l, "; ") }
+
+func (l *queryList) Set(q string) error {
+	*l = append(*l, q)
+	return nil
+}
+
+func main() {
+	var (
+		addr     = flag.String("addr", "", "the address of the SysDB server")
+		user     = flag.String("user", "", "the user name")
+		config   = flag.String("config", "", "read the client configuration from `file`")
+		listen   = flag.String("listen", ":9323", "the `address` to serve metrics on")
+		path     = flag.String("path", "/metrics", "the HTTP `path` of the metrics")
+		interval = flag.Duration("interval", time.Minute, "the interval between queries")
+		timeout  = flag.Duration("timeout", 0, "the maximum time to wait for each query")
+		queries  queryList
+	)
+	flag.Var(&queries, "query", "a `query` returning hosts; may be repeated (default: LIST hosts)")
+	flag.Parse()
+	if flag.NArg() > 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if len(queries) == 0 {
+		queries = queryList{"LIST hosts"}
+	}
+
+	var cfg client.Config
+	var err error
+	if *config != "" {
+		cfg, err = client.ReadConfigFile(*config)
+	} else {
+		cfg, err = client.LoadConfig()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sysdb_exporter: %v\n", err)
+		os.Exit(2)
+	}
+	if *addr != "" {
+		cfg.Addr = *addr
+	}
+	if *user != "" {
+		cfg.User = *user
+	}
+	c, err := cfg.Connect()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sysdb_exporter: failed to connect: %v\n", err)
+		os.Exit(2)
+	}
+	defer c.Close()
+
+	e := &exporter{c: c, queries: queries, timeout: *timeout}
+	go e.run(context.Background(), *interval)
+
+	http.Handle(*path, e)
+	log.Fatal(http.ListenAndServe(*listen, nil))
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
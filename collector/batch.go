@@ -0,0 +1,191 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package collector
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+// A Batch collects objects to be submitted together. Objects added to a batch
+// are merged by name: adding a service to a host creates the host if
+// necessary. Objects without a last update time are updated with the time of
+// the batch. A Batch is safe for concurrent use.
+type Batch struct {
+	mu    sync.Mutex
+	time  sysdb.Time
+	hosts []sysdb.Host
+	index map[string]int
+}
+
+// NewBatch returns an empty batch using t as the default update time.
+func NewBatch(t time.Time) *Batch {
+	return &Batch{time: sysdb.Time(t), index: make(map[string]int)}
+}
+
+// Time returns the default update time of the batch.
+func (b *Batch) Time() time.Time {
+	return time.Time(b.time)
+}
+
+// host returns the named host, adding it if necessary. b.mu must be held.
+func (b *Batch) host(name string) *sysdb.Host {
+	i, ok := b.index[name]
+	if !ok {
+		i = len(b.hosts)
+		b.index[name] = i
+		b.hosts = append(b.hosts, sysdb.Host{Name: name, LastUpdate: b.time})
+	}
+	return &b.hosts[i]
+}
+
+func (b *Batch) lastUpdate(t sysdb.Time) sysdb.Time {
+	if time.Time(t).IsZero() {
+		return b.time
+	}
+	return t
+}
+
+// AddHost adds a host including all of its children to the batch.
+func (b *Batch) AddHost(h sysdb.Host) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	dst := b.host(h.Name)
+	if !time.Time(h.LastUpdate).IsZero() {
+		dst.LastUpdate = h.LastUpdate
+	}
+	if h.UpdateInterval != 0 {
+		dst.UpdateInterval = h.UpdateInterval
+	}
+	dst.Backends = append(dst.Backends, h.Backends...)
+	for _, a := range h.Attributes {
+		dst.Attributes = b.addAttribute(dst.Attributes, a)
+	}
+	for _, s := range h.Services {
+		b.addService(dst, s)
+	}
+	for _, m := range h.Metrics {
+		b.addMetric(dst, m)
+	}
+}
+
+// AddService adds a service of the named host to the batch.
+func (b *Batch) AddService(host string, s sysdb.Service) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.addService(b.host(host), s)
+}
+
+// AddMetric adds a metric of the named host to the batch.
+func (b *Batch) AddMetric(host string, m sysdb.Metric) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.addMetric(b.host(host), m)
+}
+
+// AddAttribute adds an attribute of the named host to the batch.
+func (b *Batch) AddAttribute(host string, a sysdb.Attribute) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	h := b.host(host)
+	h.Attributes = b.addAttribute(h.Attributes, a)
+}
+
+func (b *Batch) addService(h *sysdb.Host, s sysdb.Service) {
+	s = s.Clone()
+	s.LastUpdate = b.lastUpdate(s.LastUpdate)
+	attrs := s.Attributes
+	s.Attributes = nil
+	for i := range h.Services {
+		if h.Services[i].Name == s.Name {
+			h.Services[i].LastUpdate = s.LastUpdate
+			for _, a := range attrs {
+				h.Services[i].Attributes = b.addAttribute(h.Services[i].Attributes, a)
+			}
+			return
+		}
+	}
+	for _, a := range attrs {
+		s.Attributes = b.addAttribute(s.Attributes, a)
+	}
+	h.Services = append(h.Services, s)
+}
+
+func (b *Batch) addMetric(h *sysdb.Host, m sysdb.Metric) {
+	m = m.Clone()
+	m.LastUpdate = b.lastUpdate(m.LastUpdate)
+	attrs := m.Attributes
+	m.Attributes = nil
+	for i := range h.Metrics {
+		if h.Metrics[i].Name == m.Name {
+			h.Metrics[i].LastUpdate = m.LastUpdate
+			for _, a := range attrs {
+				h.Metrics[i].Attributes = b.addAttribute(h.Metrics[i].Attributes, a)
+			}
+			return
+		}
+	}
+	for _, a := range attrs {
+		m.Attributes = b.addAttribute(m.Attributes, a)
+	}
+	h.Metrics = append(h.Metrics, m)
+}
+
+// addAttribute adds a to attrs, replacing any attribute of the same name.
+func (b *Batch) addAttribute(attrs []sysdb.Attribute, a sysdb.Attribute) []sysdb.Attribute {
+	a = a.Clone()
+	a.LastUpdate = b.lastUpdate(a.LastUpdate)
+	for i := range attrs {
+		if attrs[i].Name == a.Name {
+			attrs[i] = a
+			return attrs
+		}
+	}
+	return append(attrs, a)
+}
+
+// Len returns the number of hosts in the batch.
+func (b *Batch) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.hosts)
+}
+
+// Hosts returns a copy of all hosts of the batch in the order in which they
+// have been added first.
+func (b *Batch) Hosts() []sysdb.Host {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	res := make([]sysdb.Host, len(b.hosts))
+	for i, h := range b.hosts {
+		res[i] = h.Clone()
+	}
+	return res
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,91 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package collector
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+func TestBatch(t *testing.T) {
+	now := time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC)
+	earlier := sysdb.Time(now.Add(-time.Hour))
+	b := NewBatch(now)
+
+	b.AddAttribute("h1", sysdb.Attribute{Name: "os", Value: "linux"})
+	b.AddService("h1", sysdb.Service{Name: "ssh"})
+	b.AddMetric("h2", sysdb.Metric{Name: "load", LastUpdate: earlier})
+	b.AddHost(sysdb.Host{
+		Name:       "h1",
+		Attributes: []sysdb.Attribute{{Name: "os", Value: "freebsd"}, {Name: "arch", Value: "amd64"}},
+		Services: []sysdb.Service{
+			{Name: "ssh", Attributes: []sysdb.Attribute{{Name: "port", Value: "22"}}},
+		},
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.AddAttribute("h2", sysdb.Attribute{Name: "rack", Value: "r1"})
+		}()
+	}
+	wg.Wait()
+
+	ts := sysdb.Time(now)
+	expected := []sysdb.Host{
+		{
+			Name:       "h1",
+			LastUpdate: ts,
+			Attributes: []sysdb.Attribute{
+				{Name: "os", Value: "freebsd", LastUpdate: ts},
+				{Name: "arch", Value: "amd64", LastUpdate: ts},
+			},
+			Services: []sysdb.Service{
+				{Name: "ssh", LastUpdate: ts, Attributes: []sysdb.Attribute{{Name: "port", Value: "22", LastUpdate: ts}}},
+			},
+		},
+		{
+			Name:       "h2",
+			LastUpdate: ts,
+			Attributes: []sysdb.Attribute{{Name: "rack", Value: "r1", LastUpdate: ts}},
+			Metrics:    []sysdb.Metric{{Name: "load", LastUpdate: earlier}},
+		},
+	}
+	if got := b.Hosts(); b.Len() != 2 || !reflect.DeepEqual(got, expected) {
+		t.Errorf("Hosts() = %+v; want %+v", got, expected)
+	}
+	if got := b.Time(); !got.Equal(now) {
+		t.Errorf("Time() = %v; want %v", got, now)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
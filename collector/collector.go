@@ -0,0 +1,250 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package collector provides a framework for writing SysDB backends in Go.
+//
+// A collector runs registered gatherer functions periodically. Each run of
+// a gatherer collects hosts, services, metrics, and attributes into a batch
+// which is then passed to a Submitter, storing the objects in SysDB:
+//
+//	c := &collector.Collector{Submitter: s, Jitter: 5 * time.Second}
+//	c.Register("uptime", time.Minute, func(ctx context.Context, b *collector.Batch) error {
+//		b.AddAttribute(hostname, sysdb.Attribute{Name: "uptime", Value: uptime()})
+//		return nil
+//	})
+//	err := c.Run(ctx)
+//
+// Failed submissions are retried using exponential backoff. Random jitter
+// may be added to the intervals to avoid many collectors submitting at the
+// same time.
+//
+// Gatherers are provided for host facts reported by facter (see Facts) and
+// service states of Nagios and Icinga (see NagiosStatus and Icinga).
+//
+// The client does not implement the STORE command yet. Until it does,
+// applications have to provide a Submitter of their own, for example one
+// writing to a local store or forwarding objects to another service.
+package collector
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+// Default settings of a Collector.
+const (
+	DefaultMaxRetries = 3
+	DefaultRetryDelay = time.Second
+)
+
+// A Gatherer collects objects into the batch b. It is called once per
+// interval. Objects collected before an error is returned are submitted
+// nonetheless.
+type Gatherer func(ctx context.Context, b *Batch) error
+
+// A Submitter stores collected objects in SysDB.
+type Submitter interface {
+	Submit(ctx context.Context, hosts []sysdb.Host) error
+}
+
+// The SubmitterFunc type is an adapter to allow the use of ordinary
+// functions as submitters.
+type SubmitterFunc func(ctx context.Context, hosts []sysdb.Host) error
+
+// Submit calls f(ctx, hosts).
+func (f SubmitterFunc) Submit(ctx context.Context, hosts []sysdb.Host) error {
+	return f(ctx, hosts)
+}
+
+// A Collector runs gatherers periodically and submits the collected objects.
+// A Collector must not be copied after first use.
+type Collector struct {
+	// Submitter stores the collected objects.
+	Submitter Submitter
+	// BatchSize is the maximum number of hosts submitted at once. Larger
+	// batches are split. Zero means no limit.
+	BatchSize int
+	// MaxRetries is the number of times a failed submission is retried. It
+	// defaults to DefaultMaxRetries; a negative value disables retries.
+	MaxRetries int
+	// RetryDelay is the delay before the first retry. It is doubled for
+	// each further retry and defaults to DefaultRetryDelay.
+	RetryDelay time.Duration
+	// Jitter is the maximum random delay added to each interval (and
+	// before the first run) of a gatherer.
+	Jitter time.Duration
+	// ErrorLog, if not nil, is called for each failed run of a gatherer
+	// (after all retries).
+	ErrorLog func(name string, err error)
+
+	mu        sync.Mutex
+	gatherers []gatherer
+}
+
+type gatherer struct {
+	name     string
+	interval time.Duration
+	fn       Gatherer
+}
+
+// randDuration returns a random duration in [0, max); it may be overridden
+// for testing.
+var randDuration = func(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max)))
+}
+
+// Register adds a gatherer which is run every interval. Names have to be
+// unique. Gatherers have to be registered before calling Run.
+func (c *Collector) Register(name string, interval time.Duration, g Gatherer) error {
+	if interval <= 0 {
+		return sysdb.Errorf(sysdb.CodeInvalidArgument, "invalid interval %v for gatherer %q", interval, name)
+	}
+	if g == nil {
+		return sysdb.Errorf(sysdb.CodeInvalidArgument, "missing gatherer function for %q", name)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, other := range c.gatherers {
+		if other.name == name {
+			return sysdb.Errorf(sysdb.CodeInvalidArgument, "gatherer %q already registered", name)
+		}
+	}
+	c.gatherers = append(c.gatherers, gatherer{name: name, interval: interval, fn: g})
+	return nil
+}
+
+// Run runs all registered gatherers on their intervals until ctx is done.
+// It returns the error of the context.
+func (c *Collector) Run(ctx context.Context) error {
+	c.mu.Lock()
+	gatherers := append([]gatherer(nil), c.gatherers...)
+	c.mu.Unlock()
+	if c.Submitter == nil {
+		return sysdb.Errorf(sysdb.CodeInvalidArgument, "no submitter configured")
+	}
+
+	var wg sync.WaitGroup
+	for _, g := range gatherers {
+		wg.Add(1)
+		go func(g gatherer) {
+			defer wg.Done()
+			c.loop(ctx, g)
+		}(g)
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+func (c *Collector) loop(ctx context.Context, g gatherer) {
+	t := time.NewTimer(randDuration(c.Jitter))
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+		if err := c.collect(ctx, g); err != nil && ctx.Err() == nil && c.ErrorLog != nil {
+			c.ErrorLog(g.name, err)
+		}
+		t.Reset(g.interval + randDuration(c.Jitter))
+	}
+}
+
+// Collect runs the named gatherer once and submits the collected objects.
+func (c *Collector) Collect(ctx context.Context, name string) error {
+	c.mu.Lock()
+	var g *gatherer
+	for i := range c.gatherers {
+		if c.gatherers[i].name == name {
+			g = &c.gatherers[i]
+			break
+		}
+	}
+	c.mu.Unlock()
+	if g == nil {
+		return sysdb.Errorf(sysdb.CodeInvalidArgument, "unknown gatherer %q", name)
+	}
+	if c.Submitter == nil {
+		return sysdb.Errorf(sysdb.CodeInvalidArgument, "no submitter configured")
+	}
+	return c.collect(ctx, *g)
+}
+
+func (c *Collector) collect(ctx context.Context, g gatherer) error {
+	b := NewBatch(time.Now())
+	gerr := g.fn(ctx, b)
+	hosts := b.Hosts()
+	for len(hosts) > 0 {
+		n := len(hosts)
+		if c.BatchSize > 0 && n > c.BatchSize {
+			n = c.BatchSize
+		}
+		if err := c.submit(ctx, hosts[:n]); err != nil {
+			return fmt.Errorf("%s: %w", g.name, err)
+		}
+		hosts = hosts[n:]
+	}
+	if gerr != nil {
+		return fmt.Errorf("%s: %w", g.name, gerr)
+	}
+	return nil
+}
+
+// submit submits the hosts, retrying failed submissions.
+func (c *Collector) submit(ctx context.Context, hosts []sysdb.Host) error {
+	retries := c.MaxRetries
+	if retries == 0 {
+		retries = DefaultMaxRetries
+	}
+	delay := c.RetryDelay
+	if delay <= 0 {
+		delay = DefaultRetryDelay
+	}
+	for i := 0; ; i++ {
+		err := c.Submitter.Submit(ctx, hosts)
+		if err == nil || i >= retries || ctx.Err() != nil {
+			return err
+		}
+		t := time.NewTimer(delay + randDuration(c.Jitter))
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		}
+		delay *= 2
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,194 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package collector
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+// recorder is a submitter recording all submitted batches. The first fail
+// submissions fail.
+type recorder struct {
+	mu      sync.Mutex
+	fail    int
+	calls   int
+	batches [][]string
+}
+
+func (r *recorder) Submit(ctx context.Context, hosts []sysdb.Host) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls++
+	if r.fail > 0 {
+		r.fail--
+		return errors.New("connection refused")
+	}
+	var names []string
+	for _, h := range hosts {
+		names = append(names, h.Name)
+	}
+	r.batches = append(r.batches, names)
+	return nil
+}
+
+func hostsGatherer(names ...string) Gatherer {
+	return func(ctx context.Context, b *Batch) error {
+		for _, n := range names {
+			b.AddHost(sysdb.Host{Name: n})
+		}
+		return nil
+	}
+}
+
+func TestRegister(t *testing.T) {
+	var c Collector
+	g := hostsGatherer("h1")
+	for _, test := range []struct {
+		name     string
+		interval time.Duration
+		g        Gatherer
+		ok       bool
+	}{
+		{"a", time.Second, g, true},
+		{"a", time.Second, g, false},
+		{"b", 0, g, false},
+		{"c", time.Second, nil, false},
+	} {
+		err := c.Register(test.name, test.interval, test.g)
+		if (err == nil) != test.ok || (err != nil && sysdb.ErrorCode(err) != sysdb.CodeInvalidArgument) {
+			t.Errorf("Register(%q, %v) = %v; want ok = %v", test.name, test.interval, err, test.ok)
+		}
+	}
+	if err := c.Collect(context.Background(), "a"); sysdb.ErrorCode(err) != sysdb.CodeInvalidArgument {
+		t.Errorf("Collect(<no submitter>) = %v; want CodeInvalidArgument", err)
+	}
+	c.Submitter = &recorder{}
+	if err := c.Collect(context.Background(), "unknown"); sysdb.ErrorCode(err) != sysdb.CodeInvalidArgument {
+		t.Errorf("Collect(unknown) = %v; want CodeInvalidArgument", err)
+	}
+}
+
+func TestCollect(t *testing.T) {
+	gerr := errors.New("gather failed")
+	for _, test := range []struct {
+		g         Gatherer
+		batchSize int
+		fail      int
+		retries   int
+		calls     int
+		batches   int
+		err       bool
+	}{
+		{hostsGatherer("h1", "h2", "h3"), 0, 0, 0, 1, 1, false},
+		{hostsGatherer("h1", "h2", "h3"), 2, 0, 0, 2, 2, false},
+		{hostsGatherer("h1"), 0, 2, 0, 3, 1, false},
+		{hostsGatherer("h1"), 0, 2, 1, 2, 0, true},
+		{hostsGatherer("h1"), 0, 1, -1, 1, 0, true},
+		{hostsGatherer(), 0, 0, 0, 0, 0, false},
+		{
+			func(ctx context.Context, b *Batch) error {
+				b.AddHost(sysdb.Host{Name: "partial"})
+				return gerr
+			}, 0, 0, 0, 1, 1, true,
+		},
+	} {
+		r := &recorder{fail: test.fail}
+		c := &Collector{Submitter: r, BatchSize: test.batchSize, MaxRetries: test.retries, RetryDelay: time.Millisecond}
+		if err := c.Register("g", time.Minute, test.g); err != nil {
+			t.Fatalf("Register() = %v", err)
+		}
+		err := c.Collect(context.Background(), "g")
+		if (err != nil) != test.err || r.calls != test.calls || len(r.batches) != test.batches {
+			t.Errorf("Collect(batch size %d, %d failures, %d retries) = %v; got %d calls, %d batches; want error = %v, %d calls, %d batches",
+				test.batchSize, test.fail, test.retries, err, r.calls, len(r.batches), test.err, test.calls, test.batches)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	defer func(f func(time.Duration) time.Duration) { randDuration = f }(randDuration)
+	var jitters []time.Duration
+	var mu sync.Mutex
+	randDuration = func(max time.Duration) time.Duration {
+		mu.Lock()
+		defer mu.Unlock()
+		jitters = append(jitters, max)
+		return 0
+	}
+
+	r := &recorder{}
+	errs := make(chan error, 10)
+	c := &Collector{
+		Submitter: r,
+		Jitter:    time.Millisecond,
+		ErrorLog:  func(name string, err error) { errs <- err },
+	}
+	if err := c.Register("hosts", 5*time.Millisecond, hostsGatherer("h1")); err != nil {
+		t.Fatalf("Register() = %v", err)
+	}
+	if err := c.Register("failing", 5*time.Millisecond, func(ctx context.Context, b *Batch) error {
+		return errors.New("failed")
+	}); err != nil {
+		t.Fatalf("Register() = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := c.Run(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Run() = %v; want %v", err, context.DeadlineExceeded)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.batches) < 2 {
+		t.Errorf("Run() submitted %d batches; want at least 2", len(r.batches))
+	}
+	select {
+	case err := <-errs:
+		if err.Error() != "failing: failed" {
+			t.Errorf("ErrorLog(%v); want failing: failed", err)
+		}
+	default:
+		t.Errorf("ErrorLog not called")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(jitters) == 0 || jitters[0] != time.Millisecond {
+		t.Errorf("Run() used jitter %v; want %v", jitters, time.Millisecond)
+	}
+
+	if err := (&Collector{}).Run(context.Background()); sysdb.ErrorCode(err) != sysdb.CodeInvalidArgument {
+		t.Errorf("Run(<no submitter>) = %v; want CodeInvalidArgument", err)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,208 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package collector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+// DefaultFactsCommand is the command used by Facts to collect facts if no
+// file is specified.
+var DefaultFactsCommand = []string{"facter", "--json"}
+
+// Facts gathers host facts as reported by facter (or any other tool
+// producing a JSON object) and stores each fact as an attribute of the host.
+// Structured facts are flattened using dots to separate the names of nested
+// facts (e.g. "os.release.major"). Facts may be gathered periodically by
+// registering the Gather method with a Collector:
+//
+//	f := &collector.Facts{Exclude: []string{"memory.*", "uptime*"}}
+//	c.Register("facts", time.Hour, f.Gather)
+type Facts struct {
+	// Command is the command printing the facts. It defaults to
+	// DefaultFactsCommand.
+	Command []string
+	// File, if not empty, is a JSON file to read the facts from instead of
+	// running a command.
+	File string
+	// Host is the name of the host the facts are stored for. It defaults to
+	// the fqdn fact (or networking.fqdn) or the local host name.
+	Host string
+	// Prefix is prepended to the name of each attribute.
+	Prefix string
+	// Exclude lists patterns (see path.Match) of fact names which are not
+	// stored. The patterns are matched against the flattened names without
+	// prefix.
+	Exclude []string
+}
+
+// Gather collects the facts and adds them to the batch.
+func (f *Facts) Gather(ctx context.Context, b *Batch) error {
+	facts, err := f.read(ctx)
+	if err != nil {
+		return err
+	}
+	attrs, err := FactAttributes(facts, f.Prefix, f.Exclude)
+	if err != nil {
+		return err
+	}
+
+	host := f.Host
+	if host == "" {
+		host = factHost(facts)
+	}
+	if host == "" {
+		if host, err = os.Hostname(); err != nil {
+			return err
+		}
+	}
+	b.AddHost(sysdb.Host{Name: host, Attributes: attrs})
+	return nil
+}
+
+func (f *Facts) read(ctx context.Context) (map[string]interface{}, error) {
+	if f.File != "" {
+		r, err := os.Open(f.File)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return ParseFacts(r)
+	}
+
+	command := f.Command
+	if len(command) == 0 {
+		command = DefaultFactsCommand
+	}
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, sysdb.Errorf(sysdb.CodeRequestFailed, "%s: %v: %s", command[0], err, msg)
+		}
+		return nil, sysdb.Errorf(sysdb.CodeRequestFailed, "%s: %v", command[0], err)
+	}
+	return ParseFacts(bytes.NewReader(out))
+}
+
+// factHost returns the name of the host described by the facts.
+func factHost(facts map[string]interface{}) string {
+	if s, ok := facts["fqdn"].(string); ok && s != "" {
+		return s
+	}
+	if n, ok := facts["networking"].(map[string]interface{}); ok {
+		if s, ok := n["fqdn"].(string); ok {
+			return s
+		}
+	}
+	return ""
+}
+
+// ParseFacts decodes a JSON object of facts. Numbers are decoded as
+// json.Number, preserving their original representation.
+func ParseFacts(r io.Reader) (map[string]interface{}, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	var facts map[string]interface{}
+	if err := dec.Decode(&facts); err != nil {
+		return nil, sysdb.Errorf(sysdb.CodeInvalidFormat, "invalid facts: %v", err)
+	}
+	return facts, nil
+}
+
+// FactAttributes converts facts to attributes sorted by name. Nested objects
+// are flattened; their facts are named after the path of names joined by
+// dots. Strings are stored as is, numbers in their original representation,
+// booleans as "true" or "false", and lists as JSON. Null values and facts
+// matching any of the exclude patterns are skipped.
+func FactAttributes(facts map[string]interface{}, prefix string, exclude []string) ([]sysdb.Attribute, error) {
+	for _, pattern := range exclude {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, sysdb.Errorf(sysdb.CodeInvalidArgument, "invalid exclude pattern %q: %v", pattern, err)
+		}
+	}
+
+	var attrs []sysdb.Attribute
+	var flatten func(name string, v interface{}) error
+	flatten = func(name string, v interface{}) error {
+		for _, pattern := range exclude {
+			if ok, _ := path.Match(pattern, name); ok {
+				return nil
+			}
+		}
+
+		var value string
+		switch v := v.(type) {
+		case nil:
+			return nil
+		case map[string]interface{}:
+			for k, child := range v {
+				if err := flatten(name+"."+k, child); err != nil {
+					return err
+				}
+			}
+			return nil
+		case string:
+			value = v
+		case json.Number:
+			value = v.String()
+		case bool:
+			value = "false"
+			if v {
+				value = "true"
+			}
+		default:
+			data, err := json.Marshal(v)
+			if err != nil {
+				return sysdb.Errorf(sysdb.CodeInvalidFormat, "fact %s: %v", name, err)
+			}
+			value = string(data)
+		}
+		attrs = append(attrs, sysdb.Attribute{Name: prefix + name, Value: value})
+		return nil
+	}
+	for k, v := range facts {
+		if err := flatten(k, v); err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(attrs, func(i, j int) bool { return attrs[i].Name < attrs[j].Name })
+	return attrs, nil
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,133 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package collector
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+const testFacts = `{
+	"fqdn": "h1.example.com",
+	"kernel": "Linux",
+	"processorcount": 8,
+	"load": 0.50,
+	"is_virtual": false,
+	"dhcp_servers": null,
+	"ssh": ["rsa", "ed25519"],
+	"os": {"family": "Debian", "release": {"major": "12", "minor": "5"}},
+	"memory": {"system": {"total": "15.5 GiB"}}
+}`
+
+func TestFactAttributes(t *testing.T) {
+	facts, err := ParseFacts(strings.NewReader(testFacts))
+	if err != nil {
+		t.Fatalf("ParseFacts() = %v", err)
+	}
+
+	for _, test := range []struct {
+		prefix   string
+		exclude  []string
+		expected []sysdb.Attribute
+	}{
+		{
+			"", []string{"memory.*", "fqdn", "ssh"},
+			[]sysdb.Attribute{
+				{Name: "is_virtual", Value: "false"},
+				{Name: "kernel", Value: "Linux"},
+				{Name: "load", Value: "0.50"},
+				{Name: "os.family", Value: "Debian"},
+				{Name: "os.release.major", Value: "12"},
+				{Name: "os.release.minor", Value: "5"},
+				{Name: "processorcount", Value: "8"},
+			},
+		},
+		{
+			"facter.", []string{"os", "k*", "memory", "is_*", "l*", "p*", "fqdn"},
+			[]sysdb.Attribute{
+				{Name: "facter.ssh", Value: `["rsa","ed25519"]`},
+			},
+		},
+	} {
+		attrs, err := FactAttributes(facts, test.prefix, test.exclude)
+		if err != nil || !reflect.DeepEqual(attrs, test.expected) {
+			t.Errorf("FactAttributes(%q, %q) = %v, %v; want %v, <nil>",
+				test.prefix, test.exclude, attrs, err, test.expected)
+		}
+	}
+
+	if _, err := FactAttributes(facts, "", []string{"["}); sysdb.ErrorCode(err) != sysdb.CodeInvalidArgument {
+		t.Errorf("FactAttributes(<invalid pattern>) = %v; want CodeInvalidArgument", err)
+	}
+	if _, err := ParseFacts(strings.NewReader("[1]")); sysdb.ErrorCode(err) != sysdb.CodeInvalidFormat {
+		t.Errorf("ParseFacts([1]) = %v; want CodeInvalidFormat", err)
+	}
+}
+
+func TestFacts(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "facts.json")
+	if err := os.WriteFile(file, []byte(testFacts), 0644); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	for _, test := range []struct {
+		f    Facts
+		host string
+		n    int
+		err  bool
+	}{
+		{Facts{File: file, Exclude: []string{"os", "memory"}}, "h1.example.com", 6, false},
+		{Facts{Command: []string{"cat", file}, Host: "other", Exclude: []string{"ssh"}}, "other", 9, false},
+		{Facts{File: file + ".missing"}, "", 0, true},
+		{Facts{Command: []string{"sh", "-c", "echo broken >&2; exit 1"}}, "", 0, true},
+		{Facts{Command: []string{"echo", "{}"}}, "", 0, false},
+	} {
+		b := NewBatch(now)
+		err := test.f.Gather(context.Background(), b)
+		hosts := b.Hosts()
+		if test.err {
+			if err == nil || len(hosts) != 0 {
+				t.Errorf("Gather(%+v) = %v, %v; want error", test.f, hosts, err)
+			}
+			continue
+		}
+		if err != nil || len(hosts) != 1 || len(hosts[0].Attributes) != test.n ||
+			(test.host != "" && hosts[0].Name != test.host) {
+			t.Errorf("Gather(%+v) = %+v, %v; want host %q with %d attributes",
+				test.f, hosts, err, test.host, test.n)
+		}
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
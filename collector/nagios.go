@@ -0,0 +1,327 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package collector
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+// Names of the service states as used by Nagios and Icinga.
+var serviceStates = []string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+// stateName returns the name of a numeric service state.
+func stateName(s int) string {
+	if s < 0 || s >= len(serviceStates) {
+		return "UNKNOWN"
+	}
+	return serviceStates[s]
+}
+
+// stateType returns the name of a numeric state type.
+func stateType(t int) string {
+	if t == 1 {
+		return "HARD"
+	}
+	return "SOFT"
+}
+
+// A ServiceStatus is the state of a service check of Nagios or Icinga.
+type ServiceStatus struct {
+	// Host and Name are the names of the host and the service.
+	Host, Name string
+	// State is the numeric state (0: OK, 1: WARNING, 2: CRITICAL, 3:
+	// UNKNOWN).
+	State int
+	// StateType is 1 for hard states and 0 for soft states.
+	StateType int
+	// Output is the output of the last check.
+	Output string
+	// LastCheck is the time of the last check.
+	LastCheck time.Time
+	// CheckInterval is the interval between regular checks.
+	CheckInterval time.Duration
+}
+
+// Service returns the status as a SysDB service. The state is stored in the
+// attributes "state", "state_type", and "output". The last update time of
+// the service and its attributes is the time of the last check. Services
+// which have never been checked do not have an update time.
+func (s ServiceStatus) Service() sysdb.Service {
+	var t sysdb.Time
+	if s.LastCheck.Unix() > 0 {
+		t = sysdb.Time(s.LastCheck)
+	}
+	interval := sysdb.Duration(s.CheckInterval)
+	attr := func(name, value string) sysdb.Attribute {
+		return sysdb.Attribute{Name: name, Value: value, LastUpdate: t, UpdateInterval: interval}
+	}
+	return sysdb.Service{
+		Name:           s.Name,
+		LastUpdate:     t,
+		UpdateInterval: interval,
+		Attributes: []sysdb.Attribute{
+			attr("state", stateName(s.State)),
+			attr("state_type", stateType(s.StateType)),
+			attr("output", s.Output),
+		},
+	}
+}
+
+// DefaultIntervalLength is the length of an interval unit used by Nagios
+// status files (interval_length in nagios.cfg).
+const DefaultIntervalLength = time.Minute
+
+// ParseStatusFile reads the servicestatus blocks of a Nagios or Icinga 1.x
+// status file (status.dat). Check intervals are converted using the
+// specified interval length; zero means DefaultIntervalLength.
+func ParseStatusFile(r io.Reader, intervalLength time.Duration) ([]ServiceStatus, error) {
+	if intervalLength <= 0 {
+		intervalLength = DefaultIntervalLength
+	}
+
+	var res []ServiceStatus
+	var block map[string]string
+	var line int
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		line++
+		l := strings.TrimSpace(s.Text())
+		switch {
+		case l == "" || strings.HasPrefix(l, "#"):
+		case block == nil && strings.HasSuffix(l, "{"):
+			if strings.TrimSpace(strings.TrimSuffix(l, "{")) == "servicestatus" {
+				block = make(map[string]string)
+			} else {
+				// Other blocks are parsed but ignored.
+				block = map[string]string{"": ""}
+			}
+		case block == nil:
+			return nil, sysdb.Errorf(sysdb.CodeInvalidFormat, "line %d: unexpected %q outside of block", line, l)
+		case l == "}":
+			if _, ignored := block[""]; !ignored {
+				st, err := serviceStatus(block, intervalLength)
+				if err != nil {
+					return nil, sysdb.Errorf(sysdb.CodeInvalidFormat, "line %d: %v", line, err)
+				}
+				res = append(res, st)
+			}
+			block = nil
+		default:
+			i := strings.IndexByte(l, '=')
+			if i < 0 {
+				return nil, sysdb.Errorf(sysdb.CodeInvalidFormat, "line %d: expected key=value, got %q", line, l)
+			}
+			if _, ignored := block[""]; !ignored {
+				block[l[:i]] = l[i+1:]
+			}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if block != nil {
+		return nil, sysdb.Errorf(sysdb.CodeInvalidFormat, "unexpected end of file in block")
+	}
+	return res, nil
+}
+
+func serviceStatus(block map[string]string, intervalLength time.Duration) (ServiceStatus, error) {
+	st := ServiceStatus{
+		Host:   block["host_name"],
+		Name:   block["service_description"],
+		Output: block["plugin_output"],
+	}
+	if st.Host == "" || st.Name == "" {
+		return st, sysdb.Errorf(sysdb.CodeInvalidFormat, "servicestatus without host_name or service_description")
+	}
+
+	num := func(key string) (float64, error) {
+		v, ok := block[key]
+		if !ok {
+			return 0, nil
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return 0, sysdb.Errorf(sysdb.CodeInvalidFormat, "invalid %s %q", key, v)
+		}
+		return f, nil
+	}
+	state, err := num("current_state")
+	if err != nil {
+		return st, err
+	}
+	typ, err := num("state_type")
+	if err != nil {
+		return st, err
+	}
+	last, err := num("last_check")
+	if err != nil {
+		return st, err
+	}
+	interval, err := num("check_interval")
+	if err != nil {
+		return st, err
+	}
+	st.State = int(state)
+	st.StateType = int(typ)
+	st.LastCheck = time.Unix(int64(last), 0)
+	st.CheckInterval = time.Duration(interval * float64(intervalLength))
+	return st, nil
+}
+
+// ParseIcingaServices reads the result of the Icinga 2 REST API endpoint
+// /v1/objects/services.
+func ParseIcingaServices(r io.Reader) ([]ServiceStatus, error) {
+	var doc struct {
+		Results []struct {
+			Attrs struct {
+				HostName        string  `json:"host_name"`
+				Name            string  `json:"name"`
+				State           float64 `json:"state"`
+				StateType       float64 `json:"state_type"`
+				LastCheck       float64 `json:"last_check"`
+				CheckInterval   float64 `json:"check_interval"`
+				LastCheckResult *struct {
+					Output string `json:"output"`
+				} `json:"last_check_result"`
+			} `json:"attrs"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, sysdb.Errorf(sysdb.CodeInvalidFormat, "invalid Icinga response: %v", err)
+	}
+
+	res := make([]ServiceStatus, 0, len(doc.Results))
+	for _, r := range doc.Results {
+		a := r.Attrs
+		sec, frac := math.Modf(a.LastCheck)
+		st := ServiceStatus{
+			Host:          a.HostName,
+			Name:          a.Name,
+			State:         int(a.State),
+			StateType:     int(a.StateType),
+			CheckInterval: time.Duration(a.CheckInterval * float64(time.Second)),
+		}
+		if a.LastCheck > 0 {
+			st.LastCheck = time.Unix(int64(sec), int64(frac*1e9))
+		}
+		if a.LastCheckResult != nil {
+			st.Output = a.LastCheckResult.Output
+		}
+		res = append(res, st)
+	}
+	return res, nil
+}
+
+// addServices adds the services to the batch.
+func addServices(b *Batch, services []ServiceStatus) {
+	for _, st := range services {
+		b.AddService(st.Host, st.Service())
+	}
+}
+
+// NagiosStatus gathers the service states from a Nagios or Icinga 1.x status
+// file and stores them as services of the respective hosts (see
+// ServiceStatus.Service).
+type NagiosStatus struct {
+	// File is the path of the status file (status.dat).
+	File string
+	// IntervalLength is the length of an interval unit used for check
+	// intervals. It defaults to DefaultIntervalLength.
+	IntervalLength time.Duration
+}
+
+// Gather reads the status file and adds the services to the batch.
+func (n *NagiosStatus) Gather(ctx context.Context, b *Batch) error {
+	f, err := os.Open(n.File)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	services, err := ParseStatusFile(f, n.IntervalLength)
+	if err != nil {
+		return err
+	}
+	addServices(b, services)
+	return nil
+}
+
+// Icinga gathers the service states from the Icinga 2 REST API and stores
+// them as services of the respective hosts (see ServiceStatus.Service).
+type Icinga struct {
+	// URL is the base URL of the API (e.g. https://icinga:5665).
+	URL string
+	// User and Password are used for basic authentication if User is not
+	// empty.
+	User, Password string
+	// Client is the HTTP client used for requests. It defaults to
+	// http.DefaultClient.
+	Client *http.Client
+}
+
+// Gather queries the API and adds the services to the batch.
+func (i *Icinga) Gather(ctx context.Context, b *Batch) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(i.URL, "/")+"/v1/objects/services", nil)
+	if err != nil {
+		return sysdb.Errorf(sysdb.CodeInvalidArgument, "invalid Icinga URL: %v", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if i.User != "" {
+		req.SetBasicAuth(i.User, i.Password)
+	}
+	c := i.Client
+	if c == nil {
+		c = http.DefaultClient
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return sysdb.Errorf(sysdb.CodeRequestFailed, "Icinga API: %s", resp.Status)
+	}
+	services, err := ParseIcingaServices(resp.Body)
+	if err != nil {
+		return err
+	}
+	addServices(b, services)
+	return nil
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
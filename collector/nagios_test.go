@@ -0,0 +1,201 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package collector
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+const testStatusFile = `# Nagios status file
+info {
+	created=1420167845
+	}
+
+hoststatus {
+	host_name=h1
+	current_state=0
+	}
+
+servicestatus {
+	host_name=h1
+	service_description=ssh
+	check_interval=5.000000
+	current_state=0
+	state_type=1
+	last_check=1420167800
+	plugin_output=SSH OK - OpenSSH_6.7 (protocol 2.0)
+	}
+
+servicestatus {
+	host_name=h2
+	service_description=disk /
+	check_interval=1.000000
+	current_state=2
+	state_type=0
+	last_check=0
+	plugin_output=DISK CRITICAL - free space: / 10 MB (1%); inode=90%
+	}
+`
+
+func TestParseStatusFile(t *testing.T) {
+	expected := []ServiceStatus{
+		{
+			Host: "h1", Name: "ssh", State: 0, StateType: 1,
+			Output:        "SSH OK - OpenSSH_6.7 (protocol 2.0)",
+			LastCheck:     time.Unix(1420167800, 0),
+			CheckInterval: 5 * time.Minute,
+		},
+		{
+			Host: "h2", Name: "disk /", State: 2, StateType: 0,
+			Output:        "DISK CRITICAL - free space: / 10 MB (1%); inode=90%",
+			LastCheck:     time.Unix(0, 0),
+			CheckInterval: time.Minute,
+		},
+	}
+	res, err := ParseStatusFile(strings.NewReader(testStatusFile), 0)
+	if err != nil || !reflect.DeepEqual(res, expected) {
+		t.Errorf("ParseStatusFile() = %+v, %v; want %+v, <nil>", res, err, expected)
+	}
+
+	for _, input := range []string{
+		"servicestatus {\n\thost_name=h1\n",
+		"host_name=h1\n",
+		"servicestatus {\n\tinvalid\n\t}\n",
+		"servicestatus {\n\thost_name=h1\n\t}\n",
+		"servicestatus {\n\thost_name=h1\n\tservice_description=s\n\tcurrent_state=x\n\t}\n",
+	} {
+		if res, err := ParseStatusFile(strings.NewReader(input), 0); sysdb.ErrorCode(err) != sysdb.CodeInvalidFormat {
+			t.Errorf("ParseStatusFile(%q) = %v, %v; want CodeInvalidFormat", input, res, err)
+		}
+	}
+}
+
+func TestServiceStatus(t *testing.T) {
+	last := time.Unix(1420167800, 0)
+	st := ServiceStatus{Host: "h1", Name: "http", State: 1, StateType: 1, Output: "slow", LastCheck: last, CheckInterval: time.Minute}
+	ts, iv := sysdb.Time(last), sysdb.Minute
+	expected := sysdb.Service{
+		Name: "http", LastUpdate: ts, UpdateInterval: iv,
+		Attributes: []sysdb.Attribute{
+			{Name: "state", Value: "WARNING", LastUpdate: ts, UpdateInterval: iv},
+			{Name: "state_type", Value: "HARD", LastUpdate: ts, UpdateInterval: iv},
+			{Name: "output", Value: "slow", LastUpdate: ts, UpdateInterval: iv},
+		},
+	}
+	if s := st.Service(); !reflect.DeepEqual(s, expected) {
+		t.Errorf("Service() = %+v; want %+v", s, expected)
+	}
+	if s := (ServiceStatus{State: 42}).Service(); s.Attributes[0].Value != "UNKNOWN" || !time.Time(s.LastUpdate).IsZero() {
+		t.Errorf("Service(<invalid>) = %+v; want UNKNOWN state without update time", s)
+	}
+}
+
+func TestNagiosStatus(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "status.dat")
+	if err := os.WriteFile(file, []byte(testStatusFile), 0644); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC)
+	b := NewBatch(now)
+	n := &NagiosStatus{File: file}
+	if err := n.Gather(context.Background(), b); err != nil {
+		t.Fatalf("Gather() = %v", err)
+	}
+	hosts := b.Hosts()
+	if len(hosts) != 2 || hosts[0].Name != "h1" || len(hosts[0].Services) != 1 ||
+		time.Time(hosts[0].Services[0].LastUpdate).Unix() != 1420167800 ||
+		!time.Time(hosts[1].Services[0].LastUpdate).Equal(now) {
+		t.Errorf("Gather() = %+v; want h1 (ssh) and h2 (disk /)", hosts)
+	}
+
+	n.File += ".missing"
+	if err := n.Gather(context.Background(), NewBatch(now)); err == nil {
+		t.Errorf("Gather(<missing file>) = <nil>; want error")
+	}
+}
+
+func TestIcinga(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "root" || pass != "secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/v1/objects/services" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"results": [
+			{"name": "h1!ping", "type": "Service", "attrs": {
+				"host_name": "h1", "name": "ping", "state": 0.0, "state_type": 1.0,
+				"last_check": 1420167800.5, "check_interval": 60.0,
+				"last_check_result": {"output": "PING OK"}}},
+			{"name": "h1!new", "type": "Service", "attrs": {
+				"host_name": "h1", "name": "new", "state": 3.0, "state_type": 0.0,
+				"last_check": -1.0, "check_interval": 300.0, "last_check_result": null}}
+		]}`))
+	}))
+	defer srv.Close()
+
+	now := time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC)
+	b := NewBatch(now)
+	i := &Icinga{URL: srv.URL + "/", User: "root", Password: "secret"}
+	if err := i.Gather(context.Background(), b); err != nil {
+		t.Fatalf("Gather() = %v", err)
+	}
+	hosts := b.Hosts()
+	if len(hosts) != 1 || len(hosts[0].Services) != 2 {
+		t.Fatalf("Gather() = %+v; want h1 with 2 services", hosts)
+	}
+	ping, unchecked := hosts[0].Services[0], hosts[0].Services[1]
+	if !time.Time(ping.LastUpdate).Equal(time.Unix(1420167800, 5e8)) || ping.UpdateInterval != sysdb.Minute ||
+		ping.Attributes[2].Value != "PING OK" {
+		t.Errorf("Gather() = %+v; want ping checked at 1420167800.5", ping)
+	}
+	if !time.Time(unchecked.LastUpdate).Equal(now) || unchecked.Attributes[0].Value != "UNKNOWN" ||
+		unchecked.Attributes[1].Value != "SOFT" {
+		t.Errorf("Gather() = %+v; want unchecked service", unchecked)
+	}
+
+	i.Password = "wrong"
+	if err := i.Gather(context.Background(), NewBatch(now)); sysdb.ErrorCode(err) != sysdb.CodeRequestFailed {
+		t.Errorf("Gather(<wrong password>) = %v; want CodeRequestFailed", err)
+	}
+	if _, err := ParseIcingaServices(strings.NewReader("{")); sysdb.ErrorCode(err) != sysdb.CodeInvalidFormat {
+		t.Errorf("ParseIcingaServices({) = %v; want CodeInvalidFormat", err)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
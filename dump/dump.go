@@ -0,0 +1,321 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package dump implements a versioned archive format for snapshots of the
+// SysDB store.
+//
+// An archive consists of a magic string, a JSON encoded header on a single
+// line, and a compressed stream of records, each describing a host
+// (including all of its children) or a timeseries. Records are encoded as
+// newline separated JSON objects or, for faster encoding and decoding, using
+// encoding/gob (see Header.Encoding):
+//
+//	w, err := dump.NewWriter(f, dump.Header{Compression: "gzip"})
+//	if err != nil {
+//		// handle error
+//	}
+//	for _, h := range hosts {
+//		if err := w.WriteHost(&h); err != nil {
+//			// handle error
+//		}
+//	}
+//	if err := w.Close(); err != nil {
+//		// handle error
+//	}
+//
+// Archives are read record by record, allowing to process arbitrarily large
+// snapshots:
+//
+//	r, err := dump.NewReader(f)
+//	if err != nil {
+//		// handle error
+//	}
+//	for {
+//		rec, err := r.Next()
+//		if err == io.EOF {
+//			break
+//		} else if err != nil {
+//			// handle error
+//		}
+//		// ...
+//	}
+//
+// Archives may be signed using Ed25519 keys (see Signer and Verify) to
+// detect tampered snapshots.
+//
+// Supported compression methods are "none" and "gzip", which is the default.
+// Support for "zstd" (see package github.com/sysdb/go/dump/zstd) is included
+// when building with the sysdb_zstd build tag. Further methods may be added
+// using RegisterCompression.
+package dump
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/gob"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+// Version is the current version of the archive format. Version 2 added
+// support for gob encoded records; archives using JSON records are still
+// written as version 1 for compatibility with older readers.
+const Version = 2
+
+// The magic string identifying an archive.
+const magic = "SYSDBDUMP\n"
+
+// A Header describes an archive.
+type Header struct {
+	// Version is the version of the archive format.
+	Version int `json:"version"`
+	// Compression is the name of the compression method used for records.
+	Compression string `json:"compression"`
+	// Encoding is the encoding of records, either "json" or "gob".
+	Encoding string `json:"encoding,omitempty"`
+	// Created is the time the archive was created.
+	Created sysdb.Time `json:"created"`
+	// Metadata holds arbitrary user-defined information.
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Record types.
+const (
+	HostRecord       = "host"
+	TimeseriesRecord = "timeseries"
+)
+
+// A Record is a single entry of an archive.
+type Record struct {
+	// Type is one of HostRecord or TimeseriesRecord.
+	Type string `json:"type"`
+	// Host is set for host records.
+	Host *sysdb.Host `json:"host,omitempty"`
+	// HostName and Metric identify the metric of timeseries records.
+	HostName string `json:"hostname,omitempty"`
+	Metric   string `json:"metric,omitempty"`
+	// Timeseries is set for timeseries records.
+	Timeseries *sysdb.Timeseries `json:"timeseries,omitempty"`
+}
+
+// A Compression describes a compression method.
+type Compression struct {
+	NewWriter func(w io.Writer) (io.WriteCloser, error)
+	NewReader func(r io.Reader) (io.ReadCloser, error)
+}
+
+var (
+	compressionsMu sync.RWMutex
+	compressions   = map[string]Compression{
+		"none": {
+			NewWriter: func(w io.Writer) (io.WriteCloser, error) { return nopWriteCloser{w}, nil },
+			NewReader: func(r io.Reader) (io.ReadCloser, error) { return io.NopCloser(r), nil },
+		},
+		"gzip": {
+			NewWriter: func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil },
+			NewReader: func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+		},
+	}
+)
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// RegisterCompression makes a compression method available by the specified
+// name. If a method with that name exists, it will be replaced.
+func RegisterCompression(name string, c Compression) {
+	compressionsMu.Lock()
+	defer compressionsMu.Unlock()
+	compressions[name] = c
+}
+
+func compression(name string) (Compression, error) {
+	compressionsMu.RLock()
+	defer compressionsMu.RUnlock()
+	c, ok := compressions[name]
+	if !ok {
+		return Compression{}, sysdb.Errorf(sysdb.CodeUnsupported, "unknown compression method %q", name)
+	}
+	return c, nil
+}
+
+// Record encodings.
+const (
+	JSONEncoding = "json"
+	GobEncoding  = "gob"
+)
+
+type encoder interface {
+	Encode(v interface{}) error
+}
+
+type decoder interface {
+	Decode(v interface{}) error
+}
+
+// A Writer writes an archive.
+type Writer struct {
+	w   io.WriteCloser
+	enc encoder
+}
+
+// NewWriter writes the archive header to w and returns a Writer for adding
+// records. Encoding defaults to "json", Version to the oldest version
+// supporting the encoding, Compression to "gzip", and Created to the current
+// time.
+func NewWriter(w io.Writer, h Header) (*Writer, error) {
+	switch h.Encoding {
+	case "", JSONEncoding:
+		if h.Version == 0 {
+			h.Version = 1
+		}
+	case GobEncoding:
+		if h.Version == 0 {
+			h.Version = 2
+		}
+	default:
+		return nil, sysdb.Errorf(sysdb.CodeUnsupported, "unknown record encoding %q", h.Encoding)
+	}
+	if h.Compression == "" {
+		h.Compression = "gzip"
+	}
+	if time.Time(h.Created).IsZero() {
+		h.Created = sysdb.Time(time.Now())
+	}
+	c, err := compression(h.Compression)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := io.WriteString(w, magic); err != nil {
+		return nil, err
+	}
+	if err := json.NewEncoder(w).Encode(h); err != nil {
+		return nil, err
+	}
+
+	cw, err := c.NewWriter(w)
+	if err != nil {
+		return nil, err
+	}
+	if h.Encoding == GobEncoding {
+		return &Writer{w: cw, enc: gob.NewEncoder(cw)}, nil
+	}
+	return &Writer{w: cw, enc: json.NewEncoder(cw)}, nil
+}
+
+// Write adds a record to the archive.
+func (w *Writer) Write(rec *Record) error {
+	return w.enc.Encode(rec)
+}
+
+// WriteHost adds a host record to the archive.
+func (w *Writer) WriteHost(h *sysdb.Host) error {
+	return w.Write(&Record{Type: HostRecord, Host: h})
+}
+
+// WriteTimeseries adds a timeseries record for the specified metric to the
+// archive.
+func (w *Writer) WriteTimeseries(host, metric string, ts *sysdb.Timeseries) error {
+	return w.Write(&Record{Type: TimeseriesRecord, HostName: host, Metric: metric, Timeseries: ts})
+}
+
+// Close flushes all records. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	return w.w.Close()
+}
+
+// A Reader reads an archive.
+type Reader struct {
+	h   Header
+	r   io.ReadCloser
+	dec decoder
+}
+
+// NewReader reads the archive header from r and returns a Reader for
+// accessing its records.
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	m := make([]byte, len(magic))
+	if _, err := io.ReadFull(br, m); err != nil || string(m) != magic {
+		return nil, sysdb.Errorf(sysdb.CodeInvalidFormat, "not a SysDB dump archive")
+	}
+	line, err := br.ReadBytes('\n')
+	if err != nil {
+		return nil, sysdb.Errorf(sysdb.CodeInvalidFormat, "failed to read archive header: %v", err)
+	}
+
+	var h Header
+	if err := json.Unmarshal(line, &h); err != nil {
+		return nil, sysdb.Errorf(sysdb.CodeInvalidFormat, "invalid archive header: %v", err)
+	}
+	if h.Version < 1 || h.Version > Version {
+		return nil, sysdb.Errorf(sysdb.CodeUnsupported, "unsupported archive version %d", h.Version)
+	}
+	if h.Encoding != "" && h.Encoding != JSONEncoding && h.Encoding != GobEncoding {
+		return nil, sysdb.Errorf(sysdb.CodeUnsupported, "unknown record encoding %q", h.Encoding)
+	}
+	c, err := compression(h.Compression)
+	if err != nil {
+		return nil, err
+	}
+	cr, err := c.NewReader(br)
+	if err != nil {
+		return nil, err
+	}
+	if h.Encoding == GobEncoding {
+		return &Reader{h: h, r: cr, dec: gob.NewDecoder(cr)}, nil
+	}
+	return &Reader{h: h, r: cr, dec: json.NewDecoder(cr)}, nil
+}
+
+// Header returns the archive header.
+func (r *Reader) Header() Header { return r.h }
+
+// Next returns the next record of the archive. It returns io.EOF after the
+// last record.
+func (r *Reader) Next() (*Record, error) {
+	var rec Record
+	if err := r.dec.Decode(&rec); err != nil {
+		if err == io.EOF {
+			return nil, err
+		}
+		return nil, sysdb.Errorf(sysdb.CodeInvalidFormat, "invalid record: %v", err)
+	}
+	return &rec, nil
+}
+
+// Close releases all resources associated with the reader. It does not close
+// the underlying reader.
+func (r *Reader) Close() error {
+	return r.r.Close()
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
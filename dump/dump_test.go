@@ -0,0 +1,145 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package dump
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+// sameJSON reports whether a and b have the same JSON representation.
+func sameJSON(t *testing.T, a, b interface{}) bool {
+	ja, err := json.Marshal(a)
+	if err != nil {
+		t.Fatalf("json.Marshal(%v) = %v", a, err)
+	}
+	jb, err := json.Marshal(b)
+	if err != nil {
+		t.Fatalf("json.Marshal(%v) = %v", b, err)
+	}
+	return string(ja) == string(jb)
+}
+
+func TestRoundTrip(t *testing.T) {
+	ts := sysdb.Time(time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC))
+	hosts := []sysdb.Host{
+		{Name: "h1", LastUpdate: ts, Backends: []string{"b"}},
+		{Name: "h2", LastUpdate: ts, Services: []sysdb.Service{{Name: "s", LastUpdate: ts}}},
+	}
+	series := &sysdb.Timeseries{
+		Start: ts,
+		End:   ts,
+		Data:  map[string][]sysdb.DataPoint{"value": {{Timestamp: ts, Value: 4.2}}},
+	}
+
+	for _, test := range []struct {
+		comp, enc string
+		version   int
+	}{
+		{"none", "", 1},
+		{"gzip", "", 1},
+		{"none", JSONEncoding, 1},
+		{"none", GobEncoding, 2},
+		{"gzip", GobEncoding, 2},
+		{"zstd", "", 1},
+		{"zstd", GobEncoding, 2},
+		{"", "", 1},
+	} {
+		comp, wantComp := test.comp, test.comp
+		if wantComp == "" {
+			wantComp = "gzip"
+		}
+		if _, err := compression(wantComp); err != nil {
+			// Optional methods are only available with build tags.
+			continue
+		}
+		var buf bytes.Buffer
+		w, err := NewWriter(&buf, Header{Compression: comp, Encoding: test.enc, Metadata: map[string]string{"k": "v"}})
+		if err != nil {
+			t.Fatalf("NewWriter(%s, %s) = %v", comp, test.enc, err)
+		}
+		for i := range hosts {
+			if err := w.WriteHost(&hosts[i]); err != nil {
+				t.Fatalf("WriteHost() = %v", err)
+			}
+		}
+		if err := w.WriteTimeseries("h1", "m", series); err != nil {
+			t.Fatalf("WriteTimeseries() = %v", err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close() = %v", err)
+		}
+
+		r, err := NewReader(&buf)
+		if err != nil {
+			t.Fatalf("NewReader(%s) = %v", comp, err)
+		}
+		if h := r.Header(); h.Version != test.version || h.Compression != wantComp || h.Encoding != test.enc || h.Metadata["k"] != "v" {
+			t.Errorf("Header() = %+v; want version %d, compression %s, encoding %q", h, test.version, wantComp, test.enc)
+		}
+		for i := range hosts {
+			rec, err := r.Next()
+			if err != nil || rec.Type != HostRecord || !sameJSON(t, rec.Host, &hosts[i]) {
+				t.Errorf("Next() = %+v, %v; want host %+v", rec, err, hosts[i])
+			}
+		}
+		rec, err := r.Next()
+		if err != nil || rec.Type != TimeseriesRecord || rec.HostName != "h1" || rec.Metric != "m" ||
+			!sameJSON(t, rec.Timeseries, series) {
+			t.Errorf("Next() = %+v, %v; want timeseries h1.m", rec, err)
+		}
+		if rec, err := r.Next(); err != io.EOF {
+			t.Errorf("Next() = %+v, %v; want io.EOF", rec, err)
+		}
+	}
+}
+
+func TestNewReaderErrors(t *testing.T) {
+	for _, data := range []string{
+		"",
+		"NOTADUMP\n{}\n",
+		magic + "{\"version\": 99, \"compression\": \"none\"}\n",
+		magic + "{\"version\": 1, \"compression\": \"unknown\"}\n",
+		magic + "{\"version\": 2, \"compression\": \"none\", \"encoding\": \"xml\"}\n",
+	} {
+		if _, err := NewReader(bytes.NewBufferString(data)); err == nil {
+			t.Errorf("NewReader(%q) = <nil>; want <err>", data)
+		}
+	}
+}
+
+func TestNewWriterErrors(t *testing.T) {
+	if _, err := NewWriter(new(bytes.Buffer), Header{Encoding: "xml"}); sysdb.ErrorCode(err) != sysdb.CodeUnsupported {
+		t.Errorf("NewWriter(<encoding xml>) = %v; want <error %v>", err, sysdb.CodeUnsupported)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,159 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package dump
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/pem"
+	"hash"
+	"io"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+// Archives are signed using Ed25519ph, that is, the signature is computed
+// over the SHA-512 digest of the archive which allows to sign and verify
+// archives of any size in a streaming fashion.
+var signOpts = &ed25519.Options{Hash: crypto.SHA512}
+
+// A Signer passes data through to an underlying writer while computing a
+// signature over it. Use it to sign archives while writing them:
+//
+//	s := dump.NewSigner(f, key)
+//	w, err := dump.NewWriter(s, dump.Header{})
+//	// write records and close w
+//	sig, err := s.Signature()
+type Signer struct {
+	w   io.Writer
+	h   hash.Hash
+	key ed25519.PrivateKey
+}
+
+// NewSigner returns a Signer writing to w and signing using key.
+func NewSigner(w io.Writer, key ed25519.PrivateKey) *Signer {
+	return &Signer{w: w, h: sha512.New(), key: key}
+}
+
+// Write implements the io.Writer interface.
+func (s *Signer) Write(p []byte) (int, error) {
+	n, err := s.w.Write(p)
+	s.h.Write(p[:n])
+	return n, err
+}
+
+// Signature returns the signature of all data written so far.
+func (s *Signer) Signature() ([]byte, error) {
+	if len(s.key) != ed25519.PrivateKeySize {
+		return nil, sysdb.Errorf(sysdb.CodeInvalidArgument, "invalid private key length %d", len(s.key))
+	}
+	return s.key.Sign(nil, s.h.Sum(nil), signOpts)
+}
+
+// Sign returns a detached signature of the archive read from r.
+func Sign(key ed25519.PrivateKey, r io.Reader) ([]byte, error) {
+	if len(key) != ed25519.PrivateKeySize {
+		return nil, sysdb.Errorf(sysdb.CodeInvalidArgument, "invalid private key length %d", len(key))
+	}
+	s := NewSigner(io.Discard, key)
+	if _, err := io.Copy(s, r); err != nil {
+		return nil, err
+	}
+	return s.Signature()
+}
+
+// Verify checks the detached signature sig of the archive read from r. It
+// returns an error of code sysdb.CodeVerificationFailed if the archive was
+// not signed by the owner of key or if it has been tampered with. Restore
+// tools should verify an archive before using any of its records.
+func Verify(key ed25519.PublicKey, r io.Reader, sig []byte) error {
+	if len(key) != ed25519.PublicKeySize {
+		return sysdb.Errorf(sysdb.CodeInvalidArgument, "invalid public key length %d", len(key))
+	}
+	h := sha512.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return err
+	}
+	if err := ed25519.VerifyWithOptions(key, h.Sum(nil), sig, signOpts); err != nil {
+		return sysdb.Errorf(sysdb.CodeVerificationFailed, "invalid archive signature: %v", err)
+	}
+	return nil
+}
+
+// ParsePrivateKey parses a PEM encoded Ed25519 private key in PKCS #8 form,
+// as created by 'openssl genpkey -algorithm ed25519'.
+func ParsePrivateKey(data []byte) (ed25519.PrivateKey, error) {
+	der, err := pemBlock(data, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+	k, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, sysdb.Errorf(sysdb.CodeInvalidFormat, "invalid private key: %v", err)
+	}
+	key, ok := k.(ed25519.PrivateKey)
+	if !ok {
+		return nil, sysdb.Errorf(sysdb.CodeInvalidFormat, "not an Ed25519 private key: %T", k)
+	}
+	return key, nil
+}
+
+// ParsePublicKey parses a PEM encoded Ed25519 public key in PKIX form, as
+// created by 'openssl pkey -pubout'.
+func ParsePublicKey(data []byte) (ed25519.PublicKey, error) {
+	der, err := pemBlock(data, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+	k, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, sysdb.Errorf(sysdb.CodeInvalidFormat, "invalid public key: %v", err)
+	}
+	key, ok := k.(ed25519.PublicKey)
+	if !ok {
+		return nil, sysdb.Errorf(sysdb.CodeInvalidFormat, "not an Ed25519 public key: %T", k)
+	}
+	return key, nil
+}
+
+// pemBlock returns the contents of the first PEM block of the specified type
+// in data.
+func pemBlock(data []byte, typ string) ([]byte, error) {
+	for {
+		var b *pem.Block
+		b, data = pem.Decode(data)
+		if b == nil {
+			return nil, sysdb.Errorf(sysdb.CodeInvalidFormat, "no PEM block of type %q found", typ)
+		}
+		if b.Type == typ {
+			return b.Bytes, nil
+		}
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,132 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package dump
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+func TestSignVerify(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey() = %v", err)
+	}
+	other, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey() = %v", err)
+	}
+
+	var buf bytes.Buffer
+	s := NewSigner(&buf, priv)
+	w, err := NewWriter(s, Header{})
+	if err != nil {
+		t.Fatalf("NewWriter() = %v", err)
+	}
+	if err := w.WriteHost(&sysdb.Host{Name: "h"}); err != nil {
+		t.Fatalf("WriteHost() = %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+	sig, err := s.Signature()
+	if err != nil {
+		t.Fatalf("Signature() = %v", err)
+	}
+
+	archive := buf.Bytes()
+	if detached, err := Sign(priv, bytes.NewReader(archive)); err != nil || !bytes.Equal(detached, sig) {
+		t.Errorf("Sign() = %x, %v; want %x, <nil>", detached, err, sig)
+	}
+	if err := Verify(pub, bytes.NewReader(archive), sig); err != nil {
+		t.Errorf("Verify() = %v; want <nil>", err)
+	}
+	if err := Verify(other, bytes.NewReader(archive), sig); sysdb.ErrorCode(err) != sysdb.CodeVerificationFailed {
+		t.Errorf("Verify(<other key>) = %v; want verification failure", err)
+	}
+
+	tampered := append([]byte{}, archive...)
+	tampered[len(tampered)-1] ^= 0xff
+	if err := Verify(pub, bytes.NewReader(tampered), sig); sysdb.ErrorCode(err) != sysdb.CodeVerificationFailed {
+		t.Errorf("Verify(<tampered>) = %v; want verification failure", err)
+	}
+}
+
+func TestInvalidKeys(t *testing.T) {
+	archive := []byte("archive")
+	if sig, err := Sign(ed25519.PrivateKey("short"), bytes.NewReader(archive)); sysdb.ErrorCode(err) != sysdb.CodeInvalidArgument {
+		t.Errorf("Sign(<short key>) = %x, %v; want <error %v>", sig, err, sysdb.CodeInvalidArgument)
+	}
+	s := NewSigner(&bytes.Buffer{}, nil)
+	if sig, err := s.Signature(); sysdb.ErrorCode(err) != sysdb.CodeInvalidArgument {
+		t.Errorf("Signature(<nil key>) = %x, %v; want <error %v>", sig, err, sysdb.CodeInvalidArgument)
+	}
+	if err := Verify(ed25519.PublicKey("short"), bytes.NewReader(archive), nil); sysdb.ErrorCode(err) != sysdb.CodeInvalidArgument {
+		t.Errorf("Verify(<short key>) = %v; want <error %v>", err, sysdb.CodeInvalidArgument)
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey() = %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey() = %v", err)
+	}
+	privPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if der, err = x509.MarshalPKIXPublicKey(pub); err != nil {
+		t.Fatalf("MarshalPKIXPublicKey() = %v", err)
+	}
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	if got, err := ParsePrivateKey(privPEM); err != nil || !priv.Equal(got) {
+		t.Errorf("ParsePrivateKey() = %x, %v; want %x, <nil>", got, err, priv)
+	}
+	if got, err := ParsePublicKey(pubPEM); err != nil || !pub.Equal(got) {
+		t.Errorf("ParsePublicKey() = %x, %v; want %x, <nil>", got, err, pub)
+	}
+
+	for _, data := range [][]byte{nil, []byte("garbage"), pubPEM} {
+		if _, err := ParsePrivateKey(data); sysdb.ErrorCode(err) != sysdb.CodeInvalidFormat {
+			t.Errorf("ParsePrivateKey(%q) = %v; want <error %v>", data, err, sysdb.CodeInvalidFormat)
+		}
+	}
+	broken := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte("garbage")})
+	for _, data := range [][]byte{nil, privPEM, broken} {
+		if _, err := ParsePublicKey(data); sysdb.ErrorCode(err) != sysdb.CodeInvalidFormat {
+			t.Errorf("ParsePublicKey(%q) = %v; want <error %v>", data, err, sysdb.CodeInvalidFormat)
+		}
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
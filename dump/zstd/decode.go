@@ -0,0 +1,722 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package zstd
+
+import (
+	"encoding/binary"
+	"io"
+	"math/bits"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+// Reader is an io.Reader which decompresses a stream of Zstandard frames.
+// Concatenated frames are decompressed as a single stream and skippable
+// frames are ignored.
+type Reader struct {
+	r   io.Reader
+	err error
+	buf [18]byte
+
+	// State of the current frame.
+	inFrame  bool
+	window   int
+	blockMax int
+	size     int64 // content size or -1 if unknown
+	total    int64
+	checksum bool
+	hash     *xxhash
+
+	// hist holds the decompressed data of the current frame which is still
+	// within the window. hist[off:] has not been returned yet.
+	hist []byte
+	off  int
+
+	block      []byte
+	lits       []byte
+	huff       *huffTable
+	ll, of, ml *fseTable
+	rep        [3]int
+}
+
+// NewReader returns a Reader which decompresses data from r. It reads the
+// first frame header and returns an error if r does not contain Zstandard
+// compressed data.
+func NewReader(r io.Reader) (*Reader, error) {
+	z := &Reader{r: r, hash: newXXHash()}
+	if err := z.frameHeader(); err != nil {
+		if err == io.EOF {
+			err = corrupt("no data")
+		}
+		return nil, err
+	}
+	return z, nil
+}
+
+// Read reads decompressed data into p.
+func (z *Reader) Read(p []byte) (int, error) {
+	for {
+		if z.off < len(z.hist) {
+			n := copy(p, z.hist[z.off:])
+			z.off += n
+			return n, nil
+		}
+		if z.err != nil {
+			return 0, z.err
+		}
+		if z.inFrame {
+			z.err = z.nextBlock()
+		} else {
+			z.err = z.frameHeader()
+		}
+	}
+}
+
+// Close releases all resources associated with the reader. It does not close
+// the underlying reader.
+func (z *Reader) Close() error {
+	z.hist, z.block, z.lits = nil, nil, nil
+	if z.err == nil || z.err == io.EOF {
+		z.err = sysdb.Errorf(sysdb.CodeClosed, "zstd: reader closed")
+	}
+	return nil
+}
+
+func (z *Reader) readFull(b []byte) error {
+	if _, err := io.ReadFull(z.r, b); err != nil {
+		if err == io.ErrUnexpectedEOF || err == io.EOF {
+			return corrupt("unexpected end of data")
+		}
+		return err
+	}
+	return nil
+}
+
+// frameHeader reads the header of the next frame, skipping any skippable
+// frames. It returns io.EOF if there is no further frame.
+func (z *Reader) frameHeader() error {
+	var m uint32
+	for {
+		n, err := io.ReadFull(z.r, z.buf[:4])
+		if n == 0 && err == io.EOF {
+			return io.EOF
+		} else if err != nil {
+			return z.readErr(err)
+		}
+		m = binary.LittleEndian.Uint32(z.buf[:4])
+		if m&skippableMask != skippableBase {
+			break
+		}
+		if err := z.readFull(z.buf[:4]); err != nil {
+			return err
+		}
+		size := int64(binary.LittleEndian.Uint32(z.buf[:4]))
+		if n, err := io.CopyN(io.Discard, z.r, size); err != nil {
+			if n < size && err == io.EOF {
+				return corrupt("unexpected end of data")
+			}
+			return err
+		}
+	}
+	if m != magic {
+		return corrupt("invalid frame magic number %#x", m)
+	}
+
+	if err := z.readFull(z.buf[:1]); err != nil {
+		return err
+	}
+	desc := z.buf[0]
+	single := desc&0x20 != 0
+	if desc&0x08 != 0 {
+		return corrupt("reserved frame header bit set")
+	}
+	fcsSize := [4]int{0, 2, 4, 8}[desc>>6]
+	if single && fcsSize == 0 {
+		fcsSize = 1
+	}
+	dictSize := [4]int{0, 1, 2, 4}[desc&3]
+	n := fcsSize + dictSize
+	if !single {
+		n++
+	}
+	b := z.buf[:n]
+	if err := z.readFull(b); err != nil {
+		return err
+	}
+
+	var window uint64
+	if !single {
+		exp, mantissa := uint(b[0]>>3), uint64(b[0]&7)
+		base := uint64(1) << (10 + exp)
+		window = base + base/8*mantissa
+		b = b[1:]
+	}
+	var dict uint32
+	for i := dictSize - 1; i >= 0; i-- {
+		dict = dict<<8 | uint32(b[i])
+	}
+	if dict != 0 {
+		return sysdb.Errorf(sysdb.CodeUnsupported, "zstd: dictionaries are not supported")
+	}
+	b = b[dictSize:]
+	z.size = -1
+	if fcsSize > 0 {
+		var size uint64
+		for i := fcsSize - 1; i >= 0; i-- {
+			size = size<<8 | uint64(b[i])
+		}
+		if fcsSize == 2 {
+			size += 256
+		}
+		if size > 1<<62 {
+			return corrupt("invalid content size")
+		}
+		z.size = int64(size)
+	}
+	if single {
+		window = uint64(z.size)
+	}
+	if window > maxWindowSize {
+		return sysdb.Errorf(sysdb.CodeUnsupported,
+			"zstd: window size %d exceeds the maximum of %d", window, maxWindowSize)
+	}
+
+	z.inFrame = true
+	z.window = int(window)
+	z.blockMax = maxBlockSize
+	if z.window < z.blockMax {
+		z.blockMax = z.window
+	}
+	z.total = 0
+	z.checksum = desc&0x04 != 0
+	z.hash.Reset()
+	z.hist, z.off = z.hist[:0], 0
+	z.huff, z.ll, z.of, z.ml = nil, nil, nil, nil
+	z.rep = [3]int{1, 4, 8}
+	return nil
+}
+
+func (z *Reader) readErr(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return corrupt("unexpected end of data")
+	}
+	return err
+}
+
+// nextBlock decompresses the next block of the current frame and appends it
+// to the history.
+func (z *Reader) nextBlock() error {
+	if len(z.hist) > z.window+maxBlockSize {
+		// All data has been returned, only keep the window.
+		n := copy(z.hist, z.hist[len(z.hist)-z.window:])
+		z.hist = z.hist[:n]
+		z.off = n
+	}
+
+	if err := z.readFull(z.buf[:3]); err != nil {
+		return err
+	}
+	h := uint32(z.buf[0]) | uint32(z.buf[1])<<8 | uint32(z.buf[2])<<16
+	last, typ, size := h&1 != 0, h>>1&3, int(h>>3)
+
+	start := len(z.hist)
+	switch typ {
+	case 0: // raw
+		if size > z.blockMax {
+			return corrupt("block too large")
+		}
+		z.hist = append(z.hist, make([]byte, size)...)
+		if err := z.readFull(z.hist[start:]); err != nil {
+			return err
+		}
+	case 1: // RLE
+		if size > z.blockMax {
+			return corrupt("block too large")
+		}
+		if err := z.readFull(z.buf[:1]); err != nil {
+			return err
+		}
+		for i := 0; i < size; i++ {
+			z.hist = append(z.hist, z.buf[0])
+		}
+	case 2: // compressed
+		if size > z.blockMax {
+			return corrupt("block too large")
+		}
+		if cap(z.block) < size {
+			z.block = make([]byte, size)
+		}
+		z.block = z.block[:size]
+		if err := z.readFull(z.block); err != nil {
+			return err
+		}
+		if err := z.decompress(z.block); err != nil {
+			return err
+		}
+	default:
+		return corrupt("invalid block type")
+	}
+
+	z.total += int64(len(z.hist) - start)
+	if z.size >= 0 && z.total > z.size {
+		return corrupt("frame content exceeds declared size")
+	}
+	if z.checksum {
+		z.hash.Write(z.hist[start:])
+	}
+	if !last {
+		return nil
+	}
+
+	z.inFrame = false
+	if z.size >= 0 && z.total != z.size {
+		return corrupt("frame content does not match declared size")
+	}
+	if z.checksum {
+		if err := z.readFull(z.buf[:4]); err != nil {
+			return err
+		}
+		if binary.LittleEndian.Uint32(z.buf[:4]) != uint32(z.hash.Sum64()) {
+			return sysdb.Errorf(sysdb.CodeVerificationFailed, "zstd: checksum mismatch")
+		}
+	}
+	return nil
+}
+
+// decompress decompresses the compressed block b and appends the result to
+// the history.
+func (z *Reader) decompress(b []byte) error {
+	lits, n, err := z.literals(b)
+	if err != nil {
+		return err
+	}
+	return z.sequences(b[n:], lits, len(z.hist)+z.blockMax)
+}
+
+// literals decodes the literals section at the beginning of b. It returns
+// the literals and the size of the section.
+func (z *Reader) literals(b []byte) ([]byte, int, error) {
+	if len(b) == 0 {
+		return nil, 0, corrupt("missing literals section")
+	}
+	typ, format := b[0]&3, b[0]>>2&3
+
+	if typ < 2 {
+		var size, n int
+		switch format {
+		case 0, 2:
+			size, n = int(b[0]>>3), 1
+		case 1:
+			if len(b) < 2 {
+				return nil, 0, corrupt("truncated literals section")
+			}
+			size, n = int(b[0]>>4)|int(b[1])<<4, 2
+		case 3:
+			if len(b) < 3 {
+				return nil, 0, corrupt("truncated literals section")
+			}
+			size, n = int(b[0]>>4)|int(b[1])<<4|int(b[2])<<12, 3
+		}
+		if size > z.blockMax {
+			return nil, 0, corrupt("literals section too large")
+		}
+		if typ == 0 {
+			if len(b) < n+size {
+				return nil, 0, corrupt("truncated literals section")
+			}
+			return b[n : n+size], n + size, nil
+		}
+		if len(b) < n+1 {
+			return nil, 0, corrupt("truncated literals section")
+		}
+		z.lits = z.lits[:0]
+		for i := 0; i < size; i++ {
+			z.lits = append(z.lits, b[n])
+		}
+		return z.lits, n + 1, nil
+	}
+
+	var size, csize, n int
+	switch format {
+	case 0, 1:
+		if len(b) < 3 {
+			return nil, 0, corrupt("truncated literals section")
+		}
+		v := int(b[0]) | int(b[1])<<8 | int(b[2])<<16
+		size, csize, n = v>>4&0x3ff, v>>14&0x3ff, 3
+	case 2:
+		if len(b) < 4 {
+			return nil, 0, corrupt("truncated literals section")
+		}
+		v := int(binary.LittleEndian.Uint32(b))
+		size, csize, n = v>>4&0x3fff, v>>18&0x3fff, 4
+	case 3:
+		if len(b) < 5 {
+			return nil, 0, corrupt("truncated literals section")
+		}
+		v := int(binary.LittleEndian.Uint32(b)) | int(b[4])<<32
+		size, csize, n = v>>4&0x3ffff, v>>22&0x3ffff, 5
+	}
+	if size > z.blockMax {
+		return nil, 0, corrupt("literals section too large")
+	}
+	if len(b) < n+csize {
+		return nil, 0, corrupt("truncated literals section")
+	}
+	data := b[n : n+csize]
+
+	if typ == 2 {
+		t, k, err := readHuffmanTable(data)
+		if err != nil {
+			return nil, 0, err
+		}
+		z.huff = t
+		data = data[k:]
+	} else if z.huff == nil {
+		return nil, 0, corrupt("missing Huffman table")
+	}
+
+	if cap(z.lits) < size {
+		z.lits = make([]byte, size, maxBlockSize)
+	}
+	z.lits = z.lits[:size]
+	if format == 0 {
+		if err := z.huff.decode(data, z.lits); err != nil {
+			return nil, 0, err
+		}
+		return z.lits, n + csize, nil
+	}
+
+	if len(data) < 6 {
+		return nil, 0, corrupt("truncated literals section")
+	}
+	var sizes [4]int
+	rest := len(data) - 6
+	for i := 0; i < 3; i++ {
+		sizes[i] = int(binary.LittleEndian.Uint16(data[2*i:]))
+		rest -= sizes[i]
+	}
+	sizes[3] = rest
+	seg := (size + 3) / 4
+	if rest < 0 || 3*seg > size {
+		return nil, 0, corrupt("invalid literals streams")
+	}
+	data = data[6:]
+	for i := 0; i < 4; i++ {
+		out := z.lits[i*seg:]
+		if i < 3 {
+			out = out[:seg]
+		}
+		if err := z.huff.decode(data[:sizes[i]], out); err != nil {
+			return nil, 0, err
+		}
+		data = data[sizes[i]:]
+	}
+	return z.lits, n + csize, nil
+}
+
+// sequences decodes the sequences section b and executes the sequences,
+// appending the result to the history, which may not grow beyond limit.
+func (z *Reader) sequences(b []byte, lits []byte, limit int) error {
+	if len(b) == 0 {
+		return corrupt("missing sequences section")
+	}
+	var n int
+	switch {
+	case b[0] < 128:
+		n, b = int(b[0]), b[1:]
+	case b[0] < 255:
+		if len(b) < 2 {
+			return corrupt("truncated sequences section")
+		}
+		n, b = int(b[0]-128)<<8|int(b[1]), b[2:]
+	default:
+		if len(b) < 3 {
+			return corrupt("truncated sequences section")
+		}
+		n, b = int(b[1])|int(b[2])<<8+0x7f00, b[3:]
+	}
+	if n == 0 {
+		if len(b) != 0 {
+			return corrupt("trailing data in sequences section")
+		}
+		z.hist = append(z.hist, lits...)
+		return nil
+	}
+
+	if len(b) == 0 {
+		return corrupt("truncated sequences section")
+	}
+	modes := b[0]
+	if modes&3 != 0 {
+		return corrupt("reserved sequences section bits set")
+	}
+	b = b[1:]
+	for _, t := range []struct {
+		mode   byte
+		table  **fseTable
+		def    *fseTable
+		maxSym int
+		maxLog uint8
+	}{
+		{modes >> 6, &z.ll, llTable, len(llBase) - 1, 9},
+		{modes >> 4 & 3, &z.of, ofTable, 31, 8},
+		{modes >> 2 & 3, &z.ml, mlTable, len(mlBase) - 1, 9},
+	} {
+		switch t.mode {
+		case 0:
+			*t.table = t.def
+		case 1:
+			if len(b) == 0 || int(b[0]) > t.maxSym {
+				return corrupt("invalid RLE sequence code")
+			}
+			*t.table = rleTable(b[0])
+			b = b[1:]
+		case 2:
+			norm, log, k, err := readFSEDistribution(b, t.maxSym, t.maxLog)
+			if err != nil {
+				return err
+			}
+			if *t.table, err = newFSETable(norm, log); err != nil {
+				return err
+			}
+			b = b[k:]
+		case 3:
+			if *t.table == nil {
+				return corrupt("missing FSE table")
+			}
+		}
+	}
+
+	br, err := newBitReader(b)
+	if err != nil {
+		return err
+	}
+	ll, of, ml := z.ll, z.of, z.ml
+	sll, sof, sml := br.read(ll.log), br.read(of.log), br.read(ml.log)
+	for i := 0; i < n; i++ {
+		llc, ofc, mlc := ll.e[sll].sym, of.e[sof].sym, ml.e[sml].sym
+		if int(llc) >= len(llBase) || int(mlc) >= len(mlBase) || ofc > 31 {
+			return corrupt("invalid sequence code")
+		}
+		ofv := int(1)<<ofc + int(br.read(ofc))
+		mlen := int(mlBase[mlc]) + int(br.read(mlBits[mlc]))
+		llen := int(llBase[llc]) + int(br.read(llBits[llc]))
+
+		var off int
+		if ofv > 3 {
+			off = ofv - 3
+			z.rep = [3]int{off, z.rep[0], z.rep[1]}
+		} else {
+			idx := ofv - 1
+			if llen == 0 {
+				idx++
+			}
+			switch idx {
+			case 0:
+				off = z.rep[0]
+			case 1:
+				off = z.rep[1]
+				z.rep[1] = z.rep[0]
+				z.rep[0] = off
+			case 2:
+				off = z.rep[2]
+				z.rep = [3]int{off, z.rep[0], z.rep[1]}
+			case 3:
+				off = z.rep[0] - 1
+				z.rep = [3]int{off, z.rep[0], z.rep[1]}
+			}
+		}
+
+		if i < n-1 {
+			e := ll.e[sll]
+			sll = uint64(e.base) + br.read(e.nb)
+			e = ml.e[sml]
+			sml = uint64(e.base) + br.read(e.nb)
+			e = of.e[sof]
+			sof = uint64(e.base) + br.read(e.nb)
+		}
+		if br.overflow() {
+			return corrupt("truncated sequences bit stream")
+		}
+
+		if llen > len(lits) {
+			return corrupt("literals length exceeds literals")
+		}
+		z.hist = append(z.hist, lits[:llen]...)
+		lits = lits[llen:]
+		if off <= 0 || off > len(z.hist) || off > z.window {
+			return corrupt("invalid match offset %d", off)
+		}
+		if len(z.hist)+mlen+len(lits) > limit {
+			return corrupt("block too large")
+		}
+		start := len(z.hist) - off
+		for mlen > 0 {
+			c := len(z.hist) - start
+			if c > mlen {
+				c = mlen
+			}
+			z.hist = append(z.hist, z.hist[start:start+c]...)
+			mlen -= c
+		}
+	}
+	if !br.finished() {
+		return corrupt("invalid sequences bit stream")
+	}
+	z.hist = append(z.hist, lits...)
+	return nil
+}
+
+// huffEntry is an entry of a Huffman decoding table.
+type huffEntry struct {
+	sym uint8
+	nb  uint8
+}
+
+// huffTable is a Huffman decoding table indexed by the next maxBits bits of
+// the stream.
+type huffTable struct {
+	maxBits uint8
+	e       []huffEntry
+}
+
+// readHuffmanTable reads a Huffman tree description from b. It returns the
+// decoding table and the number of bytes consumed.
+func readHuffmanTable(b []byte) (*huffTable, int, error) {
+	if len(b) == 0 {
+		return nil, 0, corrupt("missing Huffman tree description")
+	}
+	var weights []byte
+	n := 1
+	if hb := int(b[0]); hb >= 128 {
+		count := hb - 127
+		n += (count + 1) / 2
+		if len(b) < n {
+			return nil, 0, corrupt("truncated Huffman tree description")
+		}
+		for i := 0; i < count; i++ {
+			w := b[1+i/2]
+			if i%2 == 0 {
+				w >>= 4
+			}
+			weights = append(weights, w&0xf)
+		}
+	} else {
+		n += hb
+		if len(b) < n {
+			return nil, 0, corrupt("truncated Huffman tree description")
+		}
+		data := b[1:n]
+		norm, log, k, err := readFSEDistribution(data, 255, 6)
+		if err != nil {
+			return nil, 0, err
+		}
+		t, err := newFSETable(norm, log)
+		if err != nil {
+			return nil, 0, err
+		}
+		br, err := newBitReader(data[k:])
+		if err != nil {
+			return nil, 0, err
+		}
+		s1, s2 := br.read(log), br.read(log)
+		for {
+			if len(weights) >= 255 {
+				return nil, 0, corrupt("too many Huffman weights")
+			}
+			e := t.e[s1]
+			weights = append(weights, e.sym)
+			s1 = uint64(e.base) + br.read(e.nb)
+			if br.overflow() {
+				weights = append(weights, t.e[s2].sym)
+				break
+			}
+			e = t.e[s2]
+			weights = append(weights, e.sym)
+			s2 = uint64(e.base) + br.read(e.nb)
+			if br.overflow() {
+				weights = append(weights, t.e[s1].sym)
+				break
+			}
+		}
+	}
+	if len(weights) > 255 {
+		return nil, 0, corrupt("too many Huffman weights")
+	}
+
+	var total int
+	for _, w := range weights {
+		if w > 11 {
+			return nil, 0, corrupt("invalid Huffman weight")
+		}
+		if w > 0 {
+			total += 1 << (w - 1)
+		}
+	}
+	if total == 0 {
+		return nil, 0, corrupt("invalid Huffman weights")
+	}
+	maxBits := bits.Len(uint(total))
+	rest := 1<<maxBits - total
+	if maxBits > 11 || rest&(rest-1) != 0 {
+		return nil, 0, corrupt("invalid Huffman weights")
+	}
+	weights = append(weights, byte(bits.Len(uint(rest))))
+
+	t := &huffTable{maxBits: uint8(maxBits), e: make([]huffEntry, 0, 1<<maxBits)}
+	for w := 1; w <= maxBits; w++ {
+		for s, sw := range weights {
+			if int(sw) != w {
+				continue
+			}
+			e := huffEntry{sym: uint8(s), nb: uint8(maxBits + 1 - w)}
+			for i := 0; i < 1<<(w-1); i++ {
+				t.e = append(t.e, e)
+			}
+		}
+	}
+	return t, n, nil
+}
+
+// decode decodes the Huffman coded stream b into out.
+func (t *huffTable) decode(b []byte, out []byte) error {
+	br, err := newBitReader(b)
+	if err != nil {
+		return err
+	}
+	for i := range out {
+		e := t.e[br.peek(t.maxBits)]
+		out[i] = e.sym
+		br.pos -= int(e.nb)
+	}
+	if !br.finished() {
+		return corrupt("invalid Huffman stream")
+	}
+	return nil
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,571 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package zstd
+
+import (
+	"encoding/binary"
+	"io"
+	"math/bits"
+	"sort"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+const (
+	windowLog  = 20
+	windowSize = 1 << windowLog
+	hashLog    = 16
+	minMatch   = 4
+
+	// maxHuffmanBits is the maximum length of a Huffman code.
+	maxHuffmanBits = 11
+)
+
+// fseEncoder is an FSE encoding table.
+type fseEncoder struct {
+	log   uint
+	state []uint16
+	sym   []symbolTransform
+}
+
+type symbolTransform struct {
+	deltaNbBits int
+	deltaState  int
+}
+
+var (
+	llEncoder = newFSEEncoder(llDefault, llTable)
+	mlEncoder = newFSEEncoder(mlDefault, mlTable)
+	ofEncoder = newFSEEncoder(ofDefault, ofTable)
+)
+
+// newFSEEncoder builds the encoding table for the normalized distribution
+// norm and its decoding table t.
+func newFSEEncoder(norm []int16, t *fseTable) *fseEncoder {
+	size := 1 << t.log
+	enc := &fseEncoder{
+		log:   uint(t.log),
+		state: make([]uint16, size),
+		sym:   make([]symbolTransform, len(norm)),
+	}
+
+	cumul := make([]int, len(norm))
+	total := 0
+	for s, c := range norm {
+		cumul[s] = total
+		switch {
+		case c == 0:
+			enc.sym[s].deltaNbBits = (int(t.log)+1)<<16 - size
+		case c == -1 || c == 1:
+			enc.sym[s].deltaNbBits = int(t.log)<<16 - size
+			enc.sym[s].deltaState = total - 1
+			total++
+		default:
+			maxBits := int(t.log) - (bits.Len(uint(c-1)) - 1)
+			enc.sym[s].deltaNbBits = maxBits<<16 - int(c)<<maxBits
+			enc.sym[s].deltaState = total - int(c)
+			total += int(c)
+		}
+	}
+	for u, e := range t.e {
+		enc.state[cumul[e.sym]] = uint16(size + u)
+		cumul[e.sym]++
+	}
+	return enc
+}
+
+// init returns the initial state for encoding sym.
+func (enc *fseEncoder) init(sym uint8) int {
+	tr := enc.sym[sym]
+	nb := (tr.deltaNbBits + 1<<15) >> 16
+	v := nb<<16 - tr.deltaNbBits
+	return int(enc.state[v>>uint(nb)+tr.deltaState])
+}
+
+// encode writes the bits needed to reach state from the state for sym and
+// returns the new state.
+func (enc *fseEncoder) encode(bw *bitWriter, state int, sym uint8) int {
+	tr := enc.sym[sym]
+	nb := uint((state + tr.deltaNbBits) >> 16)
+	bw.add(uint64(state), nb)
+	return int(enc.state[state>>nb+tr.deltaState])
+}
+
+// code returns the code for v given the baseline values of all codes.
+func code(base []uint32, v uint32) uint8 {
+	i := len(base) - 1
+	for base[i] > v {
+		i--
+	}
+	return uint8(i)
+}
+
+type sequence struct {
+	ll, ml, off uint32
+}
+
+// Writer is an io.WriteCloser which compresses data into a single
+// Zstandard frame. The data is compressed in blocks of 128 KiB; Close has to
+// be called to write the final block and the content checksum.
+type Writer struct {
+	w      io.Writer
+	err    error
+	header bool
+
+	// hist holds the window followed by the data of the current block
+	// starting at hist[start].
+	hist  []byte
+	start int
+	table []int32
+	hash  *xxhash
+
+	seqs []sequence
+	lits []byte
+	out  []byte
+}
+
+// NewWriter returns a Writer which writes compressed data to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{
+		w:     w,
+		table: make([]int32, 1<<hashLog),
+		hash:  newXXHash(),
+	}
+}
+
+// Write compresses p and writes it to the underlying writer. Data is written
+// in full blocks, so some of it may be buffered until the next call to Write
+// or Close.
+func (z *Writer) Write(p []byte) (int, error) {
+	if z.err != nil {
+		return 0, z.err
+	}
+	n := len(p)
+	z.hash.Write(p)
+	for len(p) > 0 {
+		c := maxBlockSize - (len(z.hist) - z.start)
+		if c > len(p) {
+			c = len(p)
+		}
+		z.hist = append(z.hist, p[:c]...)
+		p = p[c:]
+		if len(z.hist)-z.start == maxBlockSize {
+			if z.err = z.block(false); z.err != nil {
+				return n - len(p), z.err
+			}
+		}
+	}
+	return n, nil
+}
+
+// Close writes any buffered data and finishes the frame. It does not close
+// the underlying writer.
+func (z *Writer) Close() error {
+	if z.err != nil {
+		return z.err
+	}
+	if z.err = z.block(true); z.err == nil {
+		z.err = sysdb.Errorf(sysdb.CodeClosed, "zstd: writer closed")
+		return nil
+	}
+	return z.err
+}
+
+// block compresses and writes the current block.
+func (z *Writer) block(last bool) error {
+	out := z.out[:0]
+	if !z.header {
+		// No content size, no dictionary, content checksum.
+		out = binary.LittleEndian.AppendUint32(out, magic)
+		out = append(out, 0x04, (windowLog-10)<<3)
+		z.header = true
+	}
+
+	src := z.hist[z.start:]
+	var lastBit uint32
+	if last {
+		lastBit = 1
+	}
+	hdr := len(out)
+	out = append(out, 0, 0, 0)
+	typ, size := uint32(0), len(src)
+	if rle(src) {
+		typ = 1
+		out = append(out, src[0])
+	} else if z.parse(); len(z.seqs) > 0 {
+		if c := z.compress(out); len(c)-len(out) < len(src) {
+			typ = 2
+			size = len(c) - len(out)
+			out = c
+		}
+	}
+	if typ == 0 {
+		out = append(out, src...)
+	}
+	h := lastBit | typ<<1 | uint32(size)<<3
+	out[hdr], out[hdr+1], out[hdr+2] = byte(h), byte(h>>8), byte(h>>16)
+	if last {
+		out = binary.LittleEndian.AppendUint32(out, uint32(z.hash.Sum64()))
+	}
+	z.out = out
+	if _, err := z.w.Write(out); err != nil {
+		return err
+	}
+
+	z.start = len(z.hist)
+	if len(z.hist) >= 2*windowSize {
+		shift := len(z.hist) - windowSize
+		copy(z.hist, z.hist[shift:])
+		z.hist = z.hist[:windowSize]
+		z.start -= shift
+		for i, v := range z.table {
+			if v -= int32(shift); v < 0 {
+				v = 0
+			}
+			z.table[i] = v
+		}
+	}
+	return nil
+}
+
+// rle reports whether b consists of more than one repetition of a single
+// byte.
+func rle(b []byte) bool {
+	if len(b) < 2 {
+		return false
+	}
+	for _, c := range b[1:] {
+		if c != b[0] {
+			return false
+		}
+	}
+	return true
+}
+
+func load32(b []byte, i int) uint32 {
+	return binary.LittleEndian.Uint32(b[i:])
+}
+
+func hash4(v uint32) uint32 {
+	return v * 2654435761 >> (32 - hashLog)
+}
+
+// parse splits the current block into sequences using a greedy hash based
+// match finder. The hash table stores positions in the history plus one.
+func (z *Writer) parse() {
+	z.seqs, z.lits = z.seqs[:0], z.lits[:0]
+	src, end := z.hist, len(z.hist)
+	anchor, pos := z.start, z.start
+	for pos+minMatch <= end {
+		cur := load32(src, pos)
+		h := hash4(cur)
+		cand := int(z.table[h]) - 1
+		z.table[h] = int32(pos + 1)
+		if cand < 0 || pos-cand > windowSize || load32(src, cand) != cur {
+			pos += 1 + (pos-anchor)>>6
+			continue
+		}
+
+		ml := minMatch
+		for pos+ml < end && src[cand+ml] == src[pos+ml] {
+			ml++
+		}
+		for pos > anchor && cand > 0 && src[pos-1] == src[cand-1] {
+			pos--
+			cand--
+			ml++
+		}
+		z.lits = append(z.lits, src[anchor:pos]...)
+		z.seqs = append(z.seqs, sequence{
+			ll:  uint32(pos - anchor),
+			ml:  uint32(ml),
+			off: uint32(pos - cand),
+		})
+		pos += ml
+		anchor = pos
+		if i := pos - 2; i+minMatch <= end {
+			z.table[hash4(load32(src, i))] = int32(i + 1)
+		}
+	}
+	z.lits = append(z.lits, src[anchor:end]...)
+}
+
+// compress encodes the sequences and literals of the current block,
+// appending to out.
+func (z *Writer) compress(out []byte) []byte {
+	if c := z.huffmanLiterals(out); c != nil {
+		out = c
+	} else {
+		switch n := len(z.lits); {
+		case n < 32:
+			out = append(out, byte(n<<3))
+		case n < 4096:
+			out = append(out, byte(n<<4|1<<2), byte(n>>4))
+		default:
+			out = append(out, byte(n<<4|3<<2), byte(n>>4), byte(n>>12))
+		}
+		out = append(out, z.lits...)
+	}
+
+	// Sequences section using the predefined tables.
+	switch n := len(z.seqs); {
+	case n < 128:
+		out = append(out, byte(n))
+	case n < 0x7f00:
+		out = append(out, byte(n>>8+128), byte(n))
+	default:
+		out = append(out, 255, byte(n-0x7f00), byte((n-0x7f00)>>8))
+	}
+	out = append(out, 0)
+
+	n := len(z.seqs)
+	llc := make([]uint8, n)
+	mlc := make([]uint8, n)
+	ofc := make([]uint8, n)
+	for i, s := range z.seqs {
+		llc[i] = code(llBase[:], s.ll)
+		mlc[i] = code(mlBase[:], s.ml)
+		ofc[i] = uint8(bits.Len32(s.off+3) - 1)
+	}
+
+	bw := bitWriter{out: out}
+	extra := func(i int) {
+		s := z.seqs[i]
+		bw.add(uint64(s.ll-llBase[llc[i]]), uint(llBits[llc[i]]))
+		bw.add(uint64(s.ml-mlBase[mlc[i]]), uint(mlBits[mlc[i]]))
+		bw.add(uint64(s.off+3), uint(ofc[i]))
+	}
+	sml := mlEncoder.init(mlc[n-1])
+	sof := ofEncoder.init(ofc[n-1])
+	sll := llEncoder.init(llc[n-1])
+	extra(n - 1)
+	for i := n - 2; i >= 0; i-- {
+		sof = ofEncoder.encode(&bw, sof, ofc[i])
+		sml = mlEncoder.encode(&bw, sml, mlc[i])
+		sll = llEncoder.encode(&bw, sll, llc[i])
+		extra(i)
+	}
+	bw.add(uint64(sml), mlEncoder.log)
+	bw.add(uint64(sof), ofEncoder.log)
+	bw.add(uint64(sll), llEncoder.log)
+	return bw.close()
+}
+
+// huffmanLiterals appends a Huffman compressed literals section to out. It
+// returns nil if the literals cannot be compressed that way or if it would
+// not save any space. Only literals below 128 are supported, which allows
+// to describe the tree by its weights directly.
+func (z *Writer) huffmanLiterals(out []byte) []byte {
+	lits := z.lits
+	if len(lits) < 64 {
+		return nil
+	}
+	freq := make([]int, 128)
+	for _, c := range lits {
+		if c >= 128 {
+			return nil
+		}
+		freq[c]++
+	}
+	lengths := huffmanLengths(freq)
+	if lengths == nil {
+		return nil
+	}
+
+	var maxBits uint8
+	last := 0
+	for s, l := range lengths {
+		if l > 0 {
+			last = s
+			if l > maxBits {
+				maxBits = l
+			}
+		}
+	}
+	weights := make([]uint8, last+1)
+	for s, l := range lengths[:last+1] {
+		if l > 0 {
+			weights[s] = maxBits + 1 - l
+		}
+	}
+	var codes [128]uint16
+	idx := 0
+	for w := uint8(1); w <= maxBits; w++ {
+		for s, sw := range weights {
+			if sw == w {
+				codes[s] = uint16(idx >> (w - 1))
+				idx += 1 << (w - 1)
+			}
+		}
+	}
+
+	streams := 1
+	if len(lits) > 1023 {
+		streams = 4
+	}
+	hdr := len(out)
+	out = append(out, make([]byte, 3+streams/4*2)...)
+	start := len(out)
+
+	// The weight of the last symbol is implied.
+	out = append(out, byte(127+last))
+	for i := 0; i < last; i += 2 {
+		b := weights[i] << 4
+		if i+1 < last {
+			b |= weights[i+1]
+		}
+		out = append(out, b)
+	}
+
+	encode := func(out, src []byte) []byte {
+		bw := bitWriter{out: out}
+		for i := len(src) - 1; i >= 0; i-- {
+			s := src[i]
+			bw.add(uint64(codes[s]), uint(lengths[s]))
+		}
+		return bw.close()
+	}
+	if streams == 1 {
+		out = encode(out, lits)
+	} else {
+		jump := len(out)
+		out = append(out, make([]byte, 6)...)
+		seg := (len(lits) + 3) / 4
+		for i := 0; i < 4; i++ {
+			src := lits[i*seg:]
+			if i < 3 {
+				src = src[:seg]
+			}
+			n := len(out)
+			out = encode(out, src)
+			if i < 3 {
+				binary.LittleEndian.PutUint16(out[jump+2*i:], uint16(len(out)-n))
+			}
+		}
+	}
+
+	size, csize := len(lits), len(out)-start
+	if len(out)-hdr >= len(lits)+3 {
+		return nil
+	}
+	var format int
+	switch {
+	case streams == 1 && csize < 1024:
+		format = 0
+	case streams == 1:
+		return nil
+	case size < 1024 && csize < 1024:
+		format = 1
+	case size < 16384 && csize < 16384:
+		format = 2
+	default:
+		format = 3
+	}
+	h := uint64(2) | uint64(format)<<2
+	var n int
+	switch format {
+	case 0, 1:
+		h |= uint64(size)<<4 | uint64(csize)<<14
+		n = 3
+	case 2:
+		h |= uint64(size)<<4 | uint64(csize)<<18
+		n = 4
+	case 3:
+		h |= uint64(size)<<4 | uint64(csize)<<22
+		n = 5
+	}
+	hb := make([]byte, 8)
+	binary.LittleEndian.PutUint64(hb, h)
+	if n != start-hdr {
+		out = append(out[:hdr+n], out[start:]...)
+	}
+	copy(out[hdr:], hb[:n])
+	return out
+}
+
+// huffmanLengths returns the Huffman code lengths for the symbol
+// frequencies freq, limited to maxHuffmanBits. It returns nil if there are
+// less than two symbols.
+func huffmanLengths(freq []int) []uint8 {
+	var syms []int
+	for s, f := range freq {
+		if f > 0 {
+			syms = append(syms, s)
+		}
+	}
+	if len(syms) < 2 {
+		return nil
+	}
+
+	f := append([]int(nil), freq...)
+	for {
+		sort.SliceStable(syms, func(i, j int) bool { return f[syms[i]] < f[syms[j]] })
+
+		// Two queue construction of the Huffman tree: leaves in
+		// syms order followed by internal nodes in creation order.
+		n := len(syms)
+		weight := make([]int, n, 2*n-1)
+		for i, s := range syms {
+			weight[i] = f[s]
+		}
+		parent := make([]int, 2*n-1)
+		leaf, inner := 0, n
+		pick := func() int {
+			if leaf < n && (inner >= len(weight) || weight[leaf] <= weight[inner]) {
+				leaf++
+				return leaf - 1
+			}
+			inner++
+			return inner - 1
+		}
+		for len(weight) < 2*n-1 {
+			a, b := pick(), pick()
+			parent[a], parent[b] = len(weight), len(weight)
+			weight = append(weight, weight[a]+weight[b])
+		}
+
+		depth := make([]int, 2*n-1)
+		for i := 2*n - 3; i >= 0; i-- {
+			depth[i] = depth[parent[i]] + 1
+		}
+		lengths := make([]uint8, len(freq))
+		fits := true
+		for i, s := range syms {
+			if depth[i] > maxHuffmanBits {
+				fits = false
+			}
+			lengths[s] = uint8(depth[i])
+		}
+		if fits {
+			return lengths
+		}
+		for _, s := range syms {
+			f[s] = (f[s] + 1) / 2
+		}
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
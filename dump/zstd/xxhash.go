@@ -0,0 +1,140 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package zstd
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// XXH64 constants.
+var (
+	prime1 uint64 = 11400714785074694791
+	prime2 uint64 = 14029467366897019727
+	prime3 uint64 = 1609587929392839161
+	prime4 uint64 = 9650029242287828579
+	prime5 uint64 = 2870177450012600261
+)
+
+// xxhash is a streaming implementation of the 64-bit xxHash algorithm with a
+// seed of zero, as used for zstd content checksums.
+type xxhash struct {
+	v     [4]uint64
+	total uint64
+	buf   [32]byte
+	n     int
+}
+
+func newXXHash() *xxhash {
+	h := &xxhash{}
+	h.Reset()
+	return h
+}
+
+// Reset resets the hash to its initial state.
+func (h *xxhash) Reset() {
+	h.v = [4]uint64{prime1 + prime2, prime2, 0, -prime1}
+	h.total = 0
+	h.n = 0
+}
+
+func round(acc, input uint64) uint64 {
+	acc += input * prime2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * prime1
+}
+
+func mergeRound(acc, val uint64) uint64 {
+	acc ^= round(0, val)
+	return acc*prime1 + prime4
+}
+
+func (h *xxhash) stripe(b []byte) {
+	h.v[0] = round(h.v[0], binary.LittleEndian.Uint64(b))
+	h.v[1] = round(h.v[1], binary.LittleEndian.Uint64(b[8:]))
+	h.v[2] = round(h.v[2], binary.LittleEndian.Uint64(b[16:]))
+	h.v[3] = round(h.v[3], binary.LittleEndian.Uint64(b[24:]))
+}
+
+// Write adds b to the hashed data. It never fails.
+func (h *xxhash) Write(b []byte) (int, error) {
+	n := len(b)
+	h.total += uint64(n)
+	if h.n > 0 {
+		c := copy(h.buf[h.n:], b)
+		h.n += c
+		b = b[c:]
+		if h.n < len(h.buf) {
+			return n, nil
+		}
+		h.stripe(h.buf[:])
+		h.n = 0
+	}
+	for ; len(b) >= 32; b = b[32:] {
+		h.stripe(b)
+	}
+	h.n = copy(h.buf[:], b)
+	return n, nil
+}
+
+// Sum64 returns the hash of all data written so far.
+func (h *xxhash) Sum64() uint64 {
+	var v uint64
+	if h.total >= 32 {
+		v = bits.RotateLeft64(h.v[0], 1) + bits.RotateLeft64(h.v[1], 7) +
+			bits.RotateLeft64(h.v[2], 12) + bits.RotateLeft64(h.v[3], 18)
+		for _, x := range h.v {
+			v = mergeRound(v, x)
+		}
+	} else {
+		v = prime5
+	}
+	v += h.total
+
+	b := h.buf[:h.n]
+	for ; len(b) >= 8; b = b[8:] {
+		v ^= round(0, binary.LittleEndian.Uint64(b))
+		v = bits.RotateLeft64(v, 27)*prime1 + prime4
+	}
+	if len(b) >= 4 {
+		v ^= uint64(binary.LittleEndian.Uint32(b)) * prime1
+		v = bits.RotateLeft64(v, 23)*prime2 + prime3
+		b = b[4:]
+	}
+	for _, c := range b {
+		v ^= uint64(c) * prime5
+		v = bits.RotateLeft64(v, 11) * prime1
+	}
+
+	v ^= v >> 33
+	v *= prime2
+	v ^= v >> 29
+	v *= prime3
+	v ^= v >> 32
+	return v
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,346 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package zstd implements reading and writing of Zstandard compressed data
+// as specified in RFC 8878.
+//
+// The Reader supports all features of the format except for dictionaries.
+// The Writer uses a fast greedy match finder and the predefined entropy
+// tables; it favors speed and simplicity over compression ratio. Data
+// written by either implementation may be processed by any other conforming
+// implementation, for example the zstd command line tool.
+//
+// Both the Reader and the Writer only depend on the Go standard library.
+package zstd
+
+import (
+	"math/bits"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+const (
+	magic         = 0xfd2fb528
+	skippableMask = 0xfffffff0
+	skippableBase = 0x184d2a50
+
+	// maxBlockSize is the maximum size of the decompressed content of a
+	// block.
+	maxBlockSize = 128 << 10
+
+	// maxWindowSize is the largest window size supported by the Reader.
+	// It matches the default limit of the reference implementation.
+	maxWindowSize = 1 << 27
+)
+
+func corrupt(format string, args ...interface{}) error {
+	return sysdb.Errorf(sysdb.CodeInvalidFormat, "zstd: "+format, args...)
+}
+
+// Literals length and match length codes: baseline values and number of
+// additional bits.
+var (
+	llBase = [36]uint32{
+		0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+		16, 18, 20, 22, 24, 28, 32, 40, 48, 64, 128, 256, 512, 1024, 2048, 4096,
+		8192, 16384, 32768, 65536,
+	}
+	llBits = [36]uint8{
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		1, 1, 1, 1, 2, 2, 3, 3, 4, 6, 7, 8, 9, 10, 11, 12,
+		13, 14, 15, 16,
+	}
+	mlBase = [53]uint32{
+		3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18,
+		19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32, 33, 34,
+		35, 37, 39, 41, 43, 47, 51, 59, 67, 83, 99, 131, 259, 515, 1027, 2051,
+		4099, 8195, 16387, 32771, 65539,
+	}
+	mlBits = [53]uint8{
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		1, 1, 1, 1, 2, 2, 3, 3, 4, 4, 5, 7, 8, 9, 10, 11,
+		12, 13, 14, 15, 16,
+	}
+)
+
+// Predefined distributions of the literals length, match length and offset
+// codes.
+var (
+	llDefault = []int16{
+		4, 3, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1, 1, 1,
+		2, 2, 2, 2, 2, 2, 2, 2, 2, 3, 2, 1, 1, 1, 1, 1,
+		-1, -1, -1, -1,
+	}
+	mlDefault = []int16{
+		1, 4, 3, 2, 2, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, -1, -1,
+		-1, -1, -1, -1, -1,
+	}
+	ofDefault = []int16{
+		1, 1, 1, 1, 1, 1, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, -1, -1, -1, -1, -1,
+	}
+
+	llTable = mustFSETable(llDefault, 6)
+	mlTable = mustFSETable(mlDefault, 6)
+	ofTable = mustFSETable(ofDefault, 5)
+)
+
+// fseEntry is a state of an FSE decoding table.
+type fseEntry struct {
+	sym  uint8
+	nb   uint8
+	base uint16
+}
+
+// fseTable is an FSE decoding table.
+type fseTable struct {
+	log uint8
+	e   []fseEntry
+}
+
+func mustFSETable(norm []int16, log uint8) *fseTable {
+	t, err := newFSETable(norm, log)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// newFSETable builds the decoding table for the normalized distribution
+// norm whose probabilities sum up to 1<<log.
+func newFSETable(norm []int16, log uint8) (*fseTable, error) {
+	size := 1 << log
+	t := &fseTable{log: log, e: make([]fseEntry, size)}
+	next := make([]int, len(norm))
+	high := size - 1
+	for s, c := range norm {
+		if c == -1 {
+			if high < 0 {
+				return nil, corrupt("invalid FSE distribution")
+			}
+			t.e[high].sym = uint8(s)
+			high--
+			next[s] = 1
+		} else {
+			next[s] = int(c)
+		}
+	}
+
+	step, mask, pos := size>>1+size>>3+3, size-1, 0
+	for s, c := range norm {
+		for i := 0; i < int(c); i++ {
+			t.e[pos].sym = uint8(s)
+			for pos = (pos + step) & mask; pos > high; pos = (pos + step) & mask {
+			}
+		}
+	}
+	if pos != 0 {
+		return nil, corrupt("invalid FSE distribution")
+	}
+
+	for u := range t.e {
+		s := t.e[u].sym
+		n := next[s]
+		next[s]++
+		nb := int(log) - (bits.Len(uint(n)) - 1)
+		if nb < 0 {
+			return nil, corrupt("invalid FSE distribution")
+		}
+		t.e[u].nb = uint8(nb)
+		t.e[u].base = uint16(n<<nb - size)
+	}
+	return t, nil
+}
+
+// rleTable returns a decoding table which always produces sym.
+func rleTable(sym uint8) *fseTable {
+	return &fseTable{e: []fseEntry{{sym: sym}}}
+}
+
+// readFSEDistribution reads an FSE table description from b. It returns the
+// normalized distribution, its accuracy log, and the number of bytes
+// consumed.
+func readFSEDistribution(b []byte, maxSym int, maxLog uint8) ([]int16, uint8, int, error) {
+	var pos int
+	get := func(n int) int {
+		var v int
+		for i := 0; i < n; i++ {
+			if idx := (pos + i) >> 3; idx < len(b) && b[idx]>>uint((pos+i)&7)&1 != 0 {
+				v |= 1 << uint(i)
+			}
+		}
+		return v
+	}
+
+	log := uint8(get(4) + 5)
+	pos += 4
+	if log > maxLog {
+		return nil, 0, 0, corrupt("FSE accuracy log %d too large", log)
+	}
+
+	norm := make([]int16, 0, maxSym+1)
+	remaining, threshold, nb := 1<<log+1, 1<<log, int(log)+1
+	prev0 := false
+	for remaining > 1 && len(norm) <= maxSym {
+		if prev0 {
+			for {
+				r := get(2)
+				pos += 2
+				for i := 0; i < r; i++ {
+					norm = append(norm, 0)
+				}
+				if r != 3 {
+					break
+				}
+			}
+			if len(norm) > maxSym {
+				return nil, 0, 0, corrupt("invalid FSE distribution")
+			}
+		}
+
+		max := 2*threshold - 1 - remaining
+		v := get(nb)
+		var count int
+		if v&(threshold-1) < max {
+			count = v & (threshold - 1)
+			pos += nb - 1
+		} else {
+			count = v & (2*threshold - 1)
+			if count >= threshold {
+				count -= max
+			}
+			pos += nb
+		}
+		count--
+		if count < 0 {
+			remaining--
+		} else {
+			remaining -= count
+		}
+		if remaining < 1 {
+			return nil, 0, 0, corrupt("invalid FSE distribution")
+		}
+		norm = append(norm, int16(count))
+		prev0 = count == 0
+		for remaining < threshold {
+			nb--
+			threshold >>= 1
+		}
+	}
+	if remaining != 1 || pos > len(b)*8 {
+		return nil, 0, 0, corrupt("invalid FSE distribution")
+	}
+	return norm, log, (pos + 7) / 8, nil
+}
+
+// bitReader reads a backward bit stream as used for Huffman and FSE coded
+// data. Reading past the beginning of the stream yields zero bits.
+type bitReader struct {
+	b   []byte
+	pos int // number of unread bits
+}
+
+func newBitReader(b []byte) (*bitReader, error) {
+	if len(b) == 0 || b[len(b)-1] == 0 {
+		return nil, corrupt("invalid bit stream")
+	}
+	return &bitReader{b: b, pos: (len(b)-1)*8 + bits.Len8(b[len(b)-1]) - 1}, nil
+}
+
+// peek returns the next n bits (n <= 32) without consuming them.
+func (br *bitReader) peek(n uint8) uint64 {
+	if n == 0 {
+		return 0
+	}
+	start := br.pos - int(n)
+	if start < 0 {
+		if br.pos <= 0 {
+			return 0
+		}
+		return br.at(0, uint8(br.pos)) << uint(-start)
+	}
+	return br.at(start, n)
+}
+
+// at returns n bits starting at bit offset start.
+func (br *bitReader) at(start int, n uint8) uint64 {
+	idx := start >> 3
+	var v uint64
+	if idx+8 <= len(br.b) {
+		v = uint64(br.b[idx]) | uint64(br.b[idx+1])<<8 | uint64(br.b[idx+2])<<16 |
+			uint64(br.b[idx+3])<<24 | uint64(br.b[idx+4])<<32 | uint64(br.b[idx+5])<<40 |
+			uint64(br.b[idx+6])<<48 | uint64(br.b[idx+7])<<56
+	} else {
+		for i := idx; i < len(br.b); i++ {
+			v |= uint64(br.b[i]) << uint(8*(i-idx))
+		}
+	}
+	return v >> uint(start&7) & (1<<n - 1)
+}
+
+// read consumes and returns the next n bits (n <= 32).
+func (br *bitReader) read(n uint8) uint64 {
+	v := br.peek(n)
+	br.pos -= int(n)
+	return v
+}
+
+// overflow reports whether more bits have been read than are available.
+func (br *bitReader) overflow() bool { return br.pos < 0 }
+
+// finished reports whether the stream has been consumed exactly.
+func (br *bitReader) finished() bool { return br.pos == 0 }
+
+// bitWriter writes a backward bit stream.
+type bitWriter struct {
+	out  []byte
+	acc  uint64
+	nacc uint
+}
+
+// add appends the low n bits of v to the stream.
+func (bw *bitWriter) add(v uint64, n uint) {
+	bw.acc |= (v & (1<<n - 1)) << bw.nacc
+	bw.nacc += n
+	for bw.nacc >= 8 {
+		bw.out = append(bw.out, byte(bw.acc))
+		bw.acc >>= 8
+		bw.nacc -= 8
+	}
+}
+
+// close terminates the stream and returns the written data.
+func (bw *bitWriter) close() []byte {
+	bw.add(1, 1)
+	if bw.nacc > 0 {
+		bw.out = append(bw.out, byte(bw.acc))
+	}
+	return bw.out
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,241 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package zstd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+// sample returns n bytes of dump-like NDJSON data. The files in testdata
+// have been created from the same data using the zstd command line tool.
+func sample(n int) []byte {
+	var b bytes.Buffer
+	for i := 0; b.Len() < n; i++ {
+		fmt.Fprintf(&b, `{"type":"host","host":{"name":"host%d.example.com","attributes":[{"name":"load","value":"%d"}]}}`+"\n", i, i*7919%1000)
+	}
+	return b.Bytes()[:n]
+}
+
+func TestXXHash(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want uint64
+	}{
+		{"", 0xef46db3751d8e999},
+		{"a", 0xd24ec4f1a98c6e5b},
+		{"abc", 0x44bc2cf5ad770999},
+		{"Nobody inspects the spammish repetition", 0xfbcea83c8a378bf1},
+	} {
+		h := newXXHash()
+		h.Write([]byte(test.in))
+		if got := h.Sum64(); got != test.want {
+			t.Errorf("XXH64(%q) = %#x; want %#x", test.in, got, test.want)
+		}
+
+		// Writing byte by byte has to give the same result.
+		h.Reset()
+		for i := 0; i < len(test.in); i++ {
+			h.Write([]byte{test.in[i]})
+		}
+		if got := h.Sum64(); got != test.want {
+			t.Errorf("XXH64(%q) (bytewise) = %#x; want %#x", test.in, got, test.want)
+		}
+	}
+}
+
+func TestReadReference(t *testing.T) {
+	files, err := filepath.Glob("testdata/sample-*.zst")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("Glob(testdata/sample-*.zst) = %v, %v", files, err)
+	}
+	for _, file := range files {
+		var n int
+		fmt.Sscanf(strings.TrimPrefix(file, filepath.Join("testdata", "sample-")), "%d", &n)
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("ReadFile(%s) = %v", file, err)
+		}
+		r, err := NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Errorf("NewReader(%s) = %v", file, err)
+			continue
+		}
+		got, err := io.ReadAll(r)
+		if err != nil || !bytes.Equal(got, sample(n)) {
+			t.Errorf("ReadAll(%s) = <%d bytes>, %v; want <%d bytes>, <nil>", file, len(got), err, n)
+		}
+	}
+}
+
+func TestReadCrafted(t *testing.T) {
+	for _, test := range []struct {
+		frame, want string
+	}{
+		// RLE literals, no sequences.
+		{"\x28\xb5\x2f\xfd\x20\x05\x1d\x00\x00\x29a\x00", "aaaaa"},
+		// Raw literals, one sequence using RLE mode for all codes.
+		{"\x28\xb5\x2f\xfd\x00\x00\x55\x00\x00\x18abc\x01\x54\x03\x02\x03\x06", "abcabcabc"},
+		// RLE block followed by a raw block.
+		{"\x28\xb5\x2f\xfd\x00\x00\x1a\x00\x00x\x19\x00\x00abc", "xxxabc"},
+	} {
+		r, err := NewReader(strings.NewReader(test.frame))
+		if err != nil {
+			t.Errorf("NewReader(%q) = %v", test.frame, err)
+			continue
+		}
+		if got, err := io.ReadAll(r); err != nil || string(got) != test.want {
+			t.Errorf("ReadAll(%q) = %q, %v; want %q, <nil>", test.frame, got, err, test.want)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	rnd := rand.New(rand.NewSource(42))
+	random := make([]byte, 200000)
+	rnd.Read(random)
+
+	for _, test := range []struct {
+		name       string
+		data       []byte
+		chunk      int
+		compresses bool
+	}{
+		{"empty", nil, 1, false},
+		{"byte", []byte{'x'}, 1, false},
+		{"short", []byte("foo bar foo bar foo bar"), 1, false},
+		{"zeros", make([]byte, 300000), 4096, true},
+		{"random", random, 100000, false},
+		{"sample", sample(1000), 1, true},
+		{"sample", sample(5000000), 65536, true},
+		{"sample", append(sample(300000), random...), 300000, true},
+	} {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		for data := test.data; len(data) > 0; {
+			n := test.chunk
+			if n > len(data) {
+				n = len(data)
+			}
+			if _, err := w.Write(data[:n]); err != nil {
+				t.Fatalf("Write(<%s>) = %v", test.name, err)
+			}
+			data = data[n:]
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close(<%s>) = %v", test.name, err)
+		}
+		if _, err := w.Write([]byte("x")); sysdb.ErrorCode(err) != sysdb.CodeClosed {
+			t.Errorf("Write(<%s>) after Close() = %v; want <error %v>", test.name, err, sysdb.CodeClosed)
+		}
+		if test.compresses && buf.Len() >= len(test.data)/2 {
+			t.Errorf("Writer(<%s>) wrote %d bytes for %d bytes of input; want less than half",
+				test.name, buf.Len(), len(test.data))
+		}
+
+		r, err := NewReader(&buf)
+		if err != nil {
+			t.Fatalf("NewReader(<%s>) = %v", test.name, err)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil || !bytes.Equal(got, test.data) {
+			t.Errorf("ReadAll(<%s>) = <%d bytes>, %v; want <%d bytes>, <nil>",
+				test.name, len(got), err, len(test.data))
+		}
+	}
+}
+
+func TestConcatenatedFrames(t *testing.T) {
+	var buf bytes.Buffer
+	for _, s := range []string{"foo", "", "bar"} {
+		w := NewWriter(&buf)
+		io.WriteString(w, s)
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close() = %v", err)
+		}
+		// Skippable frame with three bytes of content.
+		buf.WriteString("\x5a\x2a\x4d\x18\x03\x00\x00\x00xyz")
+	}
+
+	r, err := NewReader(&buf)
+	if err != nil {
+		t.Fatalf("NewReader() = %v", err)
+	}
+	if got, err := io.ReadAll(r); err != nil || string(got) != "foobar" {
+		t.Errorf("ReadAll() = %q, %v; want %q, <nil>", got, err, "foobar")
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Write(sample(1000))
+	w.Close()
+	valid := buf.String()
+	badChecksum := []byte(valid)
+	badChecksum[len(badChecksum)-1] ^= 1
+
+	for _, test := range []struct {
+		data string
+		want sysdb.Code
+	}{
+		{"", sysdb.CodeInvalidFormat},
+		{"not zstd", sysdb.CodeInvalidFormat},
+		{valid[:3], sysdb.CodeInvalidFormat},
+		{valid[:len(valid)/2], sysdb.CodeInvalidFormat},
+		{valid[:len(valid)-1], sysdb.CodeInvalidFormat},
+		{string(badChecksum), sysdb.CodeVerificationFailed},
+		{valid + "trailing", sysdb.CodeInvalidFormat},
+		// Reserved bit set.
+		{"\x28\xb5\x2f\xfd\x08\x00", sysdb.CodeInvalidFormat},
+		// Dictionary ID 5.
+		{"\x28\xb5\x2f\xfd\x01\x00\x05\x01\x00\x00", sysdb.CodeUnsupported},
+		// Window size of 2 TiB.
+		{"\x28\xb5\x2f\xfd\x00\xf8\x01\x00\x00", sysdb.CodeUnsupported},
+		// Reserved block type.
+		{"\x28\xb5\x2f\xfd\x20\x00\x07\x00\x00", sysdb.CodeInvalidFormat},
+		// Raw block exceeding the content size.
+		{"\x28\xb5\x2f\xfd\x20\x01\x11\x00\x00ab", sysdb.CodeInvalidFormat},
+	} {
+		r, err := NewReader(strings.NewReader(test.data))
+		if err == nil {
+			_, err = io.ReadAll(r)
+		}
+		if sysdb.ErrorCode(err) != test.want {
+			t.Errorf("Read(%q) = %v; want <error %v>", test.data, err, test.want)
+		}
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,68 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package export encodes SysDB objects and timeseries in the formats of other
+// monitoring systems.
+//
+// This allows to republish data collected by SysDB for consumption by other
+// tools, for example:
+//
+//	ts, err := c.Timeseries("host.example.com", "load/load", start, end)
+//	// ...
+//	h := ... // the host as returned by FETCH host
+//	p := new(export.Prometheus)
+//	p.Add("load", export.Labels(h, &h.Metrics[0]), ts)
+//	_, err = p.WriteTo(w)
+package export
+
+import (
+	"github.com/sysdb/go/sysdb"
+)
+
+// Labels returns the metadata of a metric as a set of name/value pairs
+// suitable as labels or tags of a timeseries. It includes the name of the
+// host and the metric (labels "host" and "metric") and all attributes of the
+// host and the metric. Attributes of the metric take precedence over
+// attributes of the host. Either h or m may be nil.
+func Labels(h *sysdb.Host, m *sysdb.Metric) map[string]string {
+	labels := make(map[string]string)
+	if h != nil {
+		for _, a := range h.Attributes {
+			labels[a.Name] = a.Value
+		}
+	}
+	if m != nil {
+		for _, a := range m.Attributes {
+			labels[a.Name] = a.Value
+		}
+		labels["metric"] = m.Name
+	}
+	if h != nil {
+		labels["host"] = h.Name
+	}
+	return labels
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,85 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package export
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+func TestLabels(t *testing.T) {
+	h := &sysdb.Host{
+		Name: "h1",
+		Attributes: []sysdb.Attribute{
+			{Name: "arch", Value: "amd64"},
+			{Name: "host", Value: "ignored"},
+			{Name: "unit", Value: "host"},
+		},
+	}
+	m := &sysdb.Metric{
+		Name:       "load/load",
+		Attributes: []sysdb.Attribute{{Name: "unit", Value: "load"}},
+	}
+
+	for _, test := range []struct {
+		h        *sysdb.Host
+		m        *sysdb.Metric
+		expected map[string]string
+	}{
+		{nil, nil, map[string]string{}},
+		{h, nil, map[string]string{"host": "h1", "arch": "amd64", "unit": "host"}},
+		{nil, m, map[string]string{"metric": "load/load", "unit": "load"}},
+		{h, m, map[string]string{"host": "h1", "metric": "load/load", "arch": "amd64", "unit": "load"}},
+	} {
+		if got := Labels(test.h, test.m); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("Labels(%v, %v) = %v; want %v", test.h, test.m, got, test.expected)
+		}
+	}
+}
+
+// timeseries returns a timeseries with data points at the specified offsets
+// (in seconds) relative to base for each data source.
+func timeseries(base time.Time, offsets []int, values map[string][]float64) *sysdb.Timeseries {
+	ts := &sysdb.Timeseries{
+		Start: sysdb.Time(base),
+		End:   sysdb.Time(base.Add(time.Duration(offsets[len(offsets)-1]) * time.Second)),
+		Data:  make(map[string][]sysdb.DataPoint),
+	}
+	for src, vals := range values {
+		for i, o := range offsets {
+			ts.Data[src] = append(ts.Data[src], sysdb.DataPoint{
+				Timestamp: sysdb.Time(base.Add(time.Duration(o) * time.Second)),
+				Value:     vals[i],
+			})
+		}
+	}
+	return ts
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,103 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package export
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+// DefaultGraphiteTemplate is the metric name template used by Graphite if
+// none is specified.
+const DefaultGraphiteTemplate = "{host}.{metric}.{source}"
+
+// Graphite writes timeseries in the Graphite plaintext protocol as accepted
+// by carbon and its relays ("<metric path> <value> <timestamp>").
+type Graphite struct {
+	// Template determines the metric path of each data source. The
+	// placeholders {host}, {metric}, and {source} are replaced by the
+	// respective names. Dots in the host name and any whitespace are
+	// replaced by underscores while slashes in the metric name (as used by
+	// collectd) become path separators. The default is
+	// DefaultGraphiteTemplate.
+	Template string
+}
+
+var (
+	graphiteHost = strings.NewReplacer(".", "_", " ", "_", "\t", "_", "\n", "_")
+	graphitePath = strings.NewReplacer("/", ".", " ", "_", "\t", "_", "\n", "_")
+)
+
+// Path returns the metric path of the specified data source of a metric.
+func (g *Graphite) Path(host, metric, source string) string {
+	tmpl := g.Template
+	if tmpl == "" {
+		tmpl = DefaultGraphiteTemplate
+	}
+	return strings.NewReplacer(
+		"{host}", graphiteHost.Replace(host),
+		"{metric}", graphitePath.Replace(metric),
+		"{source}", graphitePath.Replace(source),
+	).Replace(tmpl)
+}
+
+// Write writes all data points of the timeseries of the specified metric to
+// w. Data sources are written in lexical order. NaN and infinite values
+// cannot be represented and are omitted. Timestamps are truncated to
+// seconds.
+func (g *Graphite) Write(w io.Writer, host, metric string, ts *sysdb.Timeseries) error {
+	sources := make([]string, 0, len(ts.Data))
+	for src := range ts.Data {
+		sources = append(sources, src)
+	}
+	sort.Strings(sources)
+
+	bw := bufio.NewWriter(w)
+	for _, src := range sources {
+		path := g.Path(host, metric, src)
+		for _, p := range ts.Data[src] {
+			if math.IsNaN(p.Value) || math.IsInf(p.Value, 0) {
+				continue
+			}
+			bw.WriteString(path)
+			bw.WriteByte(' ')
+			bw.WriteString(strconv.FormatFloat(p.Value, 'g', -1, 64))
+			bw.WriteByte(' ')
+			bw.WriteString(strconv.FormatInt(time.Time(p.Timestamp).Unix(), 10))
+			bw.WriteByte('\n')
+		}
+	}
+	return bw.Flush()
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,74 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package export
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestGraphitePath(t *testing.T) {
+	for _, test := range []struct {
+		template             string
+		host, metric, source string
+		expected             string
+	}{
+		{"", "h1", "load", "value", "h1.load.value"},
+		{"", "h1.example.com", "cpu-0/cpu-idle", "value", "h1_example_com.cpu-0.cpu-idle.value"},
+		{"sysdb.{host}.{metric}", "my host", "if/octets rx", "rx", "sysdb.my_host.if.octets_rx"},
+		{"{source}", "h1", "load", "shortterm", "shortterm"},
+		{"static", "h1", "load", "value", "static"},
+	} {
+		g := &Graphite{Template: test.template}
+		if got := g.Path(test.host, test.metric, test.source); got != test.expected {
+			t.Errorf("Graphite{%q}.Path(%q, %q, %q) = %q; want %q",
+				test.template, test.host, test.metric, test.source, got, test.expected)
+		}
+	}
+}
+
+func TestGraphiteWrite(t *testing.T) {
+	base := time.Date(2015, 5, 1, 12, 0, 0, 500, time.UTC)
+	ts := timeseries(base, []int{0, 10}, map[string][]float64{
+		"shortterm": {1, math.NaN()},
+		"midterm":   {0.5, math.Inf(-1)},
+		"longterm":  {2, 3.25},
+	})
+	expected := "h1_example_com.load.longterm 2 1430481600\n" +
+		"h1_example_com.load.longterm 3.25 1430481610\n" +
+		"h1_example_com.load.midterm 0.5 1430481600\n" +
+		"h1_example_com.load.shortterm 1 1430481600\n"
+
+	var buf bytes.Buffer
+	g := new(Graphite)
+	if err := g.Write(&buf, "h1.example.com", "load", ts); err != nil || buf.String() != expected {
+		t.Errorf("Write() = %v:\n%s\nwant <nil>:\n%s", err, buf.String(), expected)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,113 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package export
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+// WriteInflux writes the timeseries to w in the InfluxDB line protocol. Each
+// timestamp is written as a single line of the specified measurement using
+// the specified tags (for example, as returned by Labels) and one float
+// field per data source. Lines are ordered by time; timestamps have
+// nanosecond precision.
+//
+// The line protocol does not support NaN or infinite values. Those are
+// omitted; timestamps without any valid values are skipped. Tags with an
+// empty value are omitted as well.
+func WriteInflux(w io.Writer, measurement string, tags map[string]string, ts *sysdb.Timeseries) error {
+	if measurement == "" {
+		return sysdb.Errorf(sysdb.CodeInvalidArgument, "missing measurement")
+	}
+
+	prefix := measurementEscaper.Replace(measurement) + formatTags(tags) + " "
+
+	sources := make([]string, 0, len(ts.Data))
+	for src := range ts.Data {
+		sources = append(sources, src)
+	}
+	sort.Strings(sources)
+
+	// Collect the fields of each timestamp.
+	fields := make(map[int64][]string)
+	var times []int64
+	for _, src := range sources {
+		key := tagEscaper.Replace(src) + "="
+		for _, p := range ts.Data[src] {
+			if math.IsNaN(p.Value) || math.IsInf(p.Value, 0) {
+				continue
+			}
+			t := time.Time(p.Timestamp).UnixNano()
+			if _, ok := fields[t]; !ok {
+				times = append(times, t)
+			}
+			fields[t] = append(fields[t], key+strconv.FormatFloat(p.Value, 'g', -1, 64))
+		}
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+
+	bw := bufio.NewWriter(w)
+	for _, t := range times {
+		bw.WriteString(prefix)
+		bw.WriteString(strings.Join(fields[t], ","))
+		bw.WriteByte(' ')
+		bw.WriteString(strconv.FormatInt(t, 10))
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+var (
+	measurementEscaper = strings.NewReplacer(`\`, `\\`, ",", `\,`, " ", `\ `, "\n", `\n`)
+	tagEscaper         = strings.NewReplacer(`\`, `\\`, ",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`)
+)
+
+// formatTags returns the tags in the line protocol format, sorted by key.
+func formatTags(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k, v := range tags {
+		if k != "" && v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString("," + tagEscaper.Replace(k) + "=" + tagEscaper.Replace(tags[k]))
+	}
+	return b.String()
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,77 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package export
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+func TestWriteInflux(t *testing.T) {
+	base := time.Date(2015, 5, 1, 12, 0, 0, 0, time.UTC)
+	nan := math.NaN()
+	ts := timeseries(base, []int{0, 10, 20}, map[string][]float64{
+		"shortterm": {1, 2, nan},
+		"midterm":   {0.5, math.Inf(1), nan},
+	})
+	ts.Data["longterm"] = []sysdb.DataPoint{{Timestamp: sysdb.Time(base.Add(5 * time.Second)), Value: -1e21}}
+
+	for _, test := range []struct {
+		measurement string
+		tags        map[string]string
+		expected    string
+	}{
+		{
+			"load", nil,
+			"load midterm=0.5,shortterm=1 1430481600000000000\n" +
+				"load longterm=-1e+21 1430481605000000000\n" +
+				"load shortterm=2 1430481610000000000\n",
+		},
+		{
+			"cpu load", map[string]string{"host": "h1", "os name": "a,b=c", "empty": ""},
+			"cpu\\ load,host=h1,os\\ name=a\\,b\\=c midterm=0.5,shortterm=1 1430481600000000000\n" +
+				"cpu\\ load,host=h1,os\\ name=a\\,b\\=c longterm=-1e+21 1430481605000000000\n" +
+				"cpu\\ load,host=h1,os\\ name=a\\,b\\=c shortterm=2 1430481610000000000\n",
+		},
+	} {
+		var buf bytes.Buffer
+		err := WriteInflux(&buf, test.measurement, test.tags, ts)
+		if err != nil || buf.String() != test.expected {
+			t.Errorf("WriteInflux(%q, %v) = %v:\n%s\nwant <nil>:\n%s",
+				test.measurement, test.tags, err, buf.String(), test.expected)
+		}
+	}
+
+	if err := WriteInflux(new(bytes.Buffer), "", nil, ts); sysdb.ErrorCode(err) != sysdb.CodeInvalidArgument {
+		t.Errorf("WriteInflux(\"\") = %v; want <error %v>", err, sysdb.CodeInvalidArgument)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,260 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package export
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+// Prometheus collects samples and writes them in the Prometheus text
+// exposition format.
+//
+// Each data source of a timeseries is exported as a separate series with an
+// additional "source" label. Since a series may only appear once in an
+// exposition, only the latest (non-NaN) data point of each data source is
+// exported along with its timestamp.
+type Prometheus struct {
+	// Prefix is prepended to all metric names.
+	Prefix string
+
+	families map[string]*family
+}
+
+// A family is a set of series sharing the same metric name.
+type family struct {
+	help   string
+	series map[string]sample
+}
+
+type sample struct {
+	value float64
+	ts    int64 // milliseconds; 0 if unset
+}
+
+func (p *Prometheus) add(name, help string, labels map[string]string, s sample) {
+	if p.families == nil {
+		p.families = make(map[string]*family)
+	}
+	name = PrometheusName(p.Prefix + name)
+	f, ok := p.families[name]
+	if !ok {
+		f = &family{help: help, series: make(map[string]sample)}
+		p.families[name] = f
+	}
+	f.series[formatLabels(labels)] = s
+}
+
+// Add adds the latest data point of each data source of the timeseries using
+// the specified metric name and labels. Data sources without any non-NaN
+// data points are ignored.
+func (p *Prometheus) Add(name string, labels map[string]string, ts *sysdb.Timeseries) {
+	for src, points := range ts.Data {
+		for i := len(points) - 1; i >= 0; i-- {
+			if math.IsNaN(points[i].Value) {
+				continue
+			}
+
+			l := make(map[string]string, len(labels)+1)
+			for k, v := range labels {
+				l[k] = v
+			}
+			l["source"] = src
+			ms := time.Time(points[i].Timestamp).UnixNano() / int64(time.Millisecond)
+			p.add(name, "", l, sample{value: points[i].Value, ts: ms})
+			break
+		}
+	}
+}
+
+// AddHost adds metadata about a host: a "host_info" series with a constant
+// value of 1 labeled with the host name and all host attributes and a
+// "host_last_update_timestamp_seconds" series (unless the time of the last
+// update is unknown).
+func (p *Prometheus) AddHost(h *sysdb.Host) {
+	labels := Labels(h, nil)
+	p.add("host_info", "Information about a host known to SysDB.", labels, sample{value: 1})
+	if !time.Time(h.LastUpdate).IsZero() {
+		p.add("host_last_update_timestamp_seconds", "Time of the last update of a host.",
+			map[string]string{"host": h.Name}, sample{value: unixSeconds(h.LastUpdate)})
+	}
+}
+
+// AddAttributes adds a "host_attribute_info" series with a constant value of
+// 1 for each attribute of the host, labeled with the host name and the
+// attribute name and value. Unlike the labels of "host_info", the series
+// allow matching on attributes whose names are not known in advance.
+func (p *Prometheus) AddAttributes(h *sysdb.Host) {
+	for _, a := range h.Attributes {
+		p.add("host_attribute_info", "An attribute of a host known to SysDB.",
+			map[string]string{"host": h.Name, "attribute": a.Name, "value": a.Value}, sample{value: 1})
+	}
+}
+
+// AddGauge adds a single sample of a gauge using the specified metric name,
+// help text, and labels. The help text of a metric is set by the first sample
+// added for it.
+func (p *Prometheus) AddGauge(name, help string, labels map[string]string, value float64) {
+	p.add(name, help, labels, sample{value: value})
+}
+
+// WriteTo writes all collected samples to w. Metric families and series are
+// written in lexical order.
+func (p *Prometheus) WriteTo(w io.Writer) (int64, error) {
+	names := make([]string, 0, len(p.families))
+	for name := range p.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, name := range names {
+		f := p.families[name]
+		if f.help != "" {
+			bw.WriteString("# HELP " + name + " " + helpEscaper.Replace(f.help) + "\n")
+		}
+		bw.WriteString("# TYPE " + name + " gauge\n")
+
+		series := make([]string, 0, len(f.series))
+		for labels := range f.series {
+			series = append(series, labels)
+		}
+		sort.Strings(series)
+		for _, labels := range series {
+			s := f.series[labels]
+			bw.WriteString(name + labels + " " + formatValue(s.value))
+			if s.ts != 0 {
+				bw.WriteString(" " + strconv.FormatInt(s.ts, 10))
+			}
+			bw.WriteByte('\n')
+		}
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// PrometheusName returns a valid Prometheus metric name for s by replacing
+// all invalid characters with underscores.
+func PrometheusName(s string) string {
+	return sanitize(s, true)
+}
+
+func sanitize(s string, colon bool) string {
+	b := []byte(s)
+	for i, c := range b {
+		if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || c == '_' ||
+			(colon && c == ':') || (i > 0 && '0' <= c && c <= '9') {
+			continue
+		}
+		b[i] = '_'
+	}
+	if len(b) == 0 {
+		return "_"
+	}
+	return string(b)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+// formatLabels returns the labels in the exposition format, sorted by name.
+// Labels with an empty value are equivalent to missing labels and, thus,
+// omitted. If multiple labels map to the same sanitized name, the
+// lexically first one wins.
+func formatLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	names := make([]string, 0, len(labels))
+	values := make(map[string]string, len(labels))
+	for _, k := range keys {
+		v := labels[k]
+		if v == "" {
+			continue
+		}
+		k = sanitize(k, false)
+		if strings.HasPrefix(k, "__") {
+			// reserved for internal use
+			k = "attr" + k[1:]
+		}
+		if _, ok := values[k]; ok {
+			continue
+		}
+		names = append(names, k)
+		values[k] = v
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, k := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(k + `="` + labelEscaper.Replace(values[k]) + `"`)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func unixSeconds(t sysdb.Time) float64 {
+	return float64(time.Time(t).UnixNano()) / float64(time.Second)
+}
+
+// countingWriter counts the number of bytes written to the underlying
+// writer.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
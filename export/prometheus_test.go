@@ -0,0 +1,112 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package export
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+func TestPrometheus(t *testing.T) {
+	base := time.Date(2015, 5, 1, 12, 0, 0, 0, time.UTC)
+	nan := math.NaN()
+	h := &sysdb.Host{
+		Name:       "h1",
+		LastUpdate: sysdb.Time(base),
+		Attributes: []sysdb.Attribute{
+			{Name: "architecture", Value: "amd64"},
+			{Name: "os-name", Value: `Linux "x86"`},
+			{Name: "__name__", Value: "x"},
+			{Name: "empty", Value: ""},
+		},
+	}
+
+	p := &Prometheus{Prefix: "sysdb_"}
+	p.Add("load", map[string]string{"host": "h1", "metric": "load/load"},
+		timeseries(base, []int{0, 10, 20}, map[string][]float64{
+			"shortterm": {1, 2, nan},
+			"midterm":   {0.5, math.Inf(1), 3},
+			"longterm":  {nan, nan, nan},
+		}))
+	p.Add("if-octets", map[string]string{"host": "h2"},
+		timeseries(base, []int{0}, map[string][]float64{"rx": {42}}))
+	p.AddHost(h)
+	p.AddHost(&sysdb.Host{Name: "h2"})
+	p.AddAttributes(h)
+	p.AddGauge("up", "Whether SysDB is up.", nil, 1)
+
+	expected := `# HELP sysdb_host_attribute_info An attribute of a host known to SysDB.
+# TYPE sysdb_host_attribute_info gauge
+sysdb_host_attribute_info{attribute="__name__",host="h1",value="x"} 1
+sysdb_host_attribute_info{attribute="architecture",host="h1",value="amd64"} 1
+sysdb_host_attribute_info{attribute="empty",host="h1"} 1
+sysdb_host_attribute_info{attribute="os-name",host="h1",value="Linux \"x86\""} 1
+# HELP sysdb_host_info Information about a host known to SysDB.
+# TYPE sysdb_host_info gauge
+sysdb_host_info{architecture="amd64",attr_name__="x",host="h1",os_name="Linux \"x86\""} 1
+sysdb_host_info{host="h2"} 1
+# HELP sysdb_host_last_update_timestamp_seconds Time of the last update of a host.
+# TYPE sysdb_host_last_update_timestamp_seconds gauge
+sysdb_host_last_update_timestamp_seconds{host="h1"} 1.4304816e+09
+# TYPE sysdb_if_octets gauge
+sysdb_if_octets{host="h2",source="rx"} 42 1430481600000
+# TYPE sysdb_load gauge
+sysdb_load{host="h1",metric="load/load",source="midterm"} 3 1430481620000
+sysdb_load{host="h1",metric="load/load",source="shortterm"} 2 1430481610000
+# HELP sysdb_up Whether SysDB is up.
+# TYPE sysdb_up gauge
+sysdb_up 1
+`
+	var buf bytes.Buffer
+	n, err := p.WriteTo(&buf)
+	if err != nil || buf.String() != expected || n != int64(buf.Len()) {
+		t.Errorf("WriteTo() = %d, %v:\n%s\nwant %d, <nil>:\n%s", n, err, buf.String(), len(expected), expected)
+	}
+}
+
+func TestPrometheusName(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		expected string
+	}{
+		{"", "_"},
+		{"load", "load"},
+		{"load/load", "load_load"},
+		{"ns:if-octets", "ns:if_octets"},
+		{"1load", "_load"},
+		{"cpu0", "cpu0"},
+	} {
+		if got := PrometheusName(test.name); got != test.expected {
+			t.Errorf("PrometheusName(%q) = %q; want %q", test.name, got, test.expected)
+		}
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,73 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package export
+
+import (
+	"io"
+	"path/filepath"
+	"text/template"
+	"time"
+
+	"github.com/sysdb/go/sysdb"
+	"github.com/sysdb/go/tmpl"
+)
+
+// TemplateData is the data passed to inventory templates.
+type TemplateData struct {
+	// Hosts is the list of hosts to be rendered.
+	Hosts []sysdb.Host
+	// Time is the time the inventory was generated.
+	Time time.Time
+}
+
+// ParseTemplates parses the named template files for use with
+// WriteInventory. The helper functions of the tmpl package are available to
+// the templates. The resulting template has the name of the first file (see
+// template.ParseFiles).
+//
+// Templates may render arbitrary inventory formats, for example ssh_config
+// Host blocks:
+//
+//	{{range .Hosts}}{{if hasAttr . "ip"}}Host {{.Name}}
+//	    HostName {{attr . "ip"}}
+//	{{end}}{{end}}
+func ParseTemplates(files ...string) (*template.Template, error) {
+	if len(files) == 0 {
+		return nil, sysdb.Errorf(sysdb.CodeInvalidArgument, "no template files specified")
+	}
+	return template.New(filepath.Base(files[0])).Funcs(tmpl.FuncMap()).ParseFiles(files...)
+}
+
+// WriteInventory renders the hosts using the template t and writes the
+// result to w. The template is executed with a TemplateData value.
+func WriteInventory(w io.Writer, t *template.Template, hosts []sysdb.Host) error {
+	return t.Execute(w, TemplateData{Hosts: hosts, Time: now()})
+}
+
+// now returns the current time; it may be overridden for testing.
+var now = time.Now
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,110 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package export
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+func TestWriteInventory(t *testing.T) {
+	defer func(f func() time.Time) { now = f }(now)
+	now = func() time.Time { return time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+	hosts := []sysdb.Host{
+		{Name: "db1", Attributes: []sysdb.Attribute{{Name: "ip", Value: "10.0.0.1"}, {Name: "role", Value: "db"}}},
+		{Name: "web1", Attributes: []sysdb.Attribute{{Name: "ip", Value: "10.0.0.2"}, {Name: "role", Value: "web"}}},
+		{Name: "misc"},
+	}
+
+	for _, test := range []struct {
+		files    map[string]string
+		expected string
+	}{
+		{
+			map[string]string{
+				"ssh_config": `# generated {{time .Time}}
+{{range .Hosts}}{{if hasAttr . "ip"}}Host {{.Name}}
+    HostName {{attr . "ip"}}
+{{end}}{{end}}`,
+			},
+			"# generated 2015-01-02 03:04:05 +0000\nHost db1\n    HostName 10.0.0.1\nHost web1\n    HostName 10.0.0.2\n",
+		},
+		{
+			map[string]string{
+				"zone": `{{range where .Hosts "role" "db"}}{{template "record" .}}{{end}}`,
+				"record": `{{define "record"}}{{.Name}} IN A {{attr . "ip"}}
+{{end}}`,
+			},
+			"db1 IN A 10.0.0.1\n",
+		},
+		{
+			map[string]string{
+				"tfvars": `{{range groupBy .Hosts "role"}}{{if .Key}}{{.Key}} = [{{range $i, $h := .Hosts}}{{if $i}}, {{end}}"{{$h.Name}}"{{end}}]
+{{end}}{{end}}`,
+			},
+			"db = [\"db1\"]\nweb = [\"web1\"]\n",
+		},
+	} {
+		dir := t.TempDir()
+		var files []string
+		for _, name := range []string{"ssh_config", "zone", "tfvars", "record"} {
+			content, ok := test.files[name]
+			if !ok {
+				continue
+			}
+			file := filepath.Join(dir, name)
+			if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+				t.Fatalf("WriteFile(%s) = %v", file, err)
+			}
+			files = append(files, file)
+		}
+
+		tm, err := ParseTemplates(files...)
+		if err != nil {
+			t.Errorf("ParseTemplates(%v) = %v", files, err)
+			continue
+		}
+		var buf bytes.Buffer
+		if err := WriteInventory(&buf, tm, hosts); err != nil || buf.String() != test.expected {
+			t.Errorf("WriteInventory(%v) = %q, %v; want %q, <nil>", files, buf.String(), err, test.expected)
+		}
+	}
+
+	if _, err := ParseTemplates(); sysdb.ErrorCode(err) != sysdb.CodeInvalidArgument {
+		t.Errorf("ParseTemplates() = %v; want CodeInvalidArgument", err)
+	}
+	if _, err := ParseTemplates(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Errorf("ParseTemplates(<missing>) = <nil>; want error")
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
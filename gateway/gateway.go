@@ -0,0 +1,340 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package gateway implements the SysDB gateway service defined in
+// sysdb.proto on top of a client.Interface.
+//
+// The types of this package mirror the messages of sysdb.proto using the
+// types of the github.com/sysdb/go/sysdb package, and the methods of Service
+// implement the respective RPCs. As all packages of this repository only
+// depend on the Go standard library, this package does not include the
+// code generated from sysdb.proto or a gRPC server; it is transport
+// independent and may back any RPC framework. For gRPC, a server built
+// using protoc-gen-go and protoc-gen-go-grpc implements SysDBServer by
+// converting the generated messages and delegating to a Service:
+//
+//	func (s *server) List(ctx context.Context, req *sysdbpb.ListRequest) (*sysdbpb.ObjectList, error) {
+//		l, err := s.svc.List(ctx, &gateway.ListRequest{Type: gateway.ObjectType(req.Type), Filter: req.Filter})
+//		if err != nil {
+//			return nil, status.Error(codes.Code(gateway.StatusCode(err)), err.Error())
+//		}
+//		return toObjectList(l), nil
+//	}
+package gateway
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/sysdb/go/client"
+	"github.com/sysdb/go/proto"
+	"github.com/sysdb/go/sysdb"
+)
+
+// An ObjectType selects the type of queried objects. Its values match the
+// ObjectType enum of sysdb.proto.
+type ObjectType int32
+
+// Object types.
+const (
+	ObjectTypeUnspecified ObjectType = iota
+	ObjectTypeHost
+	ObjectTypeService
+	ObjectTypeMetric
+)
+
+// clientType returns the client object type corresponding to t.
+func (t ObjectType) clientType() (client.ObjectType, error) {
+	switch t {
+	case ObjectTypeHost:
+		return client.HostType, nil
+	case ObjectTypeService:
+		return client.ServiceType, nil
+	case ObjectTypeMetric:
+		return client.MetricType, nil
+	}
+	return "", sysdb.Errorf(sysdb.CodeInvalidArgument, "invalid object type %d", t)
+}
+
+// A ListRequest mirrors the ListRequest message.
+type ListRequest struct {
+	Type ObjectType
+	// Filter is an optional filter expression (the FILTER clause).
+	Filter string
+}
+
+// A LookupRequest mirrors the LookupRequest message.
+type LookupRequest struct {
+	Type ObjectType
+	// Matching is the matcher expression (the MATCHING clause).
+	Matching string
+	// Filter is an optional filter expression (the FILTER clause).
+	Filter string
+}
+
+// An ObjectList mirrors the ObjectList message. Only the field matching the
+// requested object type is set.
+type ObjectList struct {
+	Hosts    []sysdb.Host
+	Services sysdb.ServiceList
+	Metrics  sysdb.MetricList
+}
+
+// A FetchRequest mirrors the FetchRequest message.
+type FetchRequest struct {
+	Type ObjectType
+	Host string
+	// Name is the name of the service or metric. It is ignored for hosts.
+	Name string
+}
+
+// A FetchResponse mirrors the FetchResponse message. Exactly one of its
+// fields is set.
+type FetchResponse struct {
+	Host    *sysdb.Host
+	Service *sysdb.Service
+	Metric  *sysdb.Metric
+}
+
+// A TimeseriesRequest mirrors the TimeseriesRequest message.
+type TimeseriesRequest struct {
+	Host, Metric string
+	Start, End   time.Time
+}
+
+// A WatchRequest mirrors the WatchRequest message.
+type WatchRequest struct {
+	// Query is any LIST or LOOKUP query.
+	Query    string
+	Interval time.Duration
+}
+
+// A Service implements the SysDB gateway service using a client.
+//
+// Filter and matcher expressions are embedded into the queries as is; the
+// server validates them like any other query. Requests whose expressions
+// would result in multiple statements are rejected.
+type Service struct {
+	Client client.Interface
+}
+
+// List implements the List RPC.
+func (s *Service) List(ctx context.Context, req *ListRequest) (*ObjectList, error) {
+	typ, err := req.Type.clientType()
+	if err != nil {
+		return nil, err
+	}
+	q := "LIST " + string(typ) + "s"
+	if req.Filter != "" {
+		q += " FILTER " + req.Filter
+	}
+	return s.query(ctx, q)
+}
+
+// Lookup implements the Lookup RPC.
+func (s *Service) Lookup(ctx context.Context, req *LookupRequest) (*ObjectList, error) {
+	typ, err := req.Type.clientType()
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(req.Matching) == "" {
+		return nil, sysdb.Errorf(sysdb.CodeInvalidArgument, "missing matcher expression")
+	}
+	q := "LOOKUP " + string(typ) + "s MATCHING " + req.Matching
+	if req.Filter != "" {
+		q += " FILTER " + req.Filter
+	}
+	return s.query(ctx, q)
+}
+
+// query executes the LIST or LOOKUP query q.
+func (s *Service) query(ctx context.Context, q string) (*ObjectList, error) {
+	if err := checkQuery(q); err != nil {
+		return nil, err
+	}
+	res, err := s.Client.QueryContext(ctx, q+";")
+	if err != nil {
+		return nil, err
+	}
+	return objectList(res)
+}
+
+// checkQuery makes sure that q is a single LIST or LOOKUP statement.
+func checkQuery(q string) error {
+	stmts, err := proto.SplitStatements(q)
+	if err != nil {
+		return err
+	}
+	if len(stmts) != 1 {
+		return sysdb.Errorf(sysdb.CodeInvalidArgument, "query %q does not consist of a single statement", q)
+	}
+	fields := strings.Fields(stmts[0])
+	if len(fields) == 0 || (!strings.EqualFold(fields[0], "LIST") && !strings.EqualFold(fields[0], "LOOKUP")) {
+		return sysdb.Errorf(sysdb.CodeInvalidArgument, "query %q is not a LIST or LOOKUP query", q)
+	}
+	return nil
+}
+
+// objectList converts the result of a LIST or LOOKUP query.
+func objectList(res interface{}) (*ObjectList, error) {
+	switch v := res.(type) {
+	case []sysdb.Host:
+		return &ObjectList{Hosts: v}, nil
+	case sysdb.ServiceList:
+		return &ObjectList{Services: v}, nil
+	case sysdb.MetricList:
+		return &ObjectList{Metrics: v}, nil
+	}
+	return nil, sysdb.Errorf(sysdb.CodeUnexpectedMessage, "unexpected result type %T", res)
+}
+
+// Fetch implements the Fetch RPC.
+func (s *Service) Fetch(ctx context.Context, req *FetchRequest) (*FetchResponse, error) {
+	if req.Host == "" {
+		return nil, sysdb.Errorf(sysdb.CodeInvalidArgument, "missing host name")
+	}
+	if req.Type != ObjectTypeHost && req.Name == "" {
+		return nil, sysdb.Errorf(sysdb.CodeInvalidArgument, "missing object name")
+	}
+
+	var res FetchResponse
+	var err error
+	switch req.Type {
+	case ObjectTypeHost:
+		res.Host, err = s.Client.FetchHost(ctx, req.Host)
+	case ObjectTypeService:
+		res.Service, err = s.Client.FetchService(ctx, req.Host, req.Name)
+	case ObjectTypeMetric:
+		res.Metric, err = s.Client.FetchMetric(ctx, req.Host, req.Name)
+	default:
+		_, err = req.Type.clientType()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Timeseries implements the Timeseries RPC.
+func (s *Service) Timeseries(ctx context.Context, req *TimeseriesRequest) (*sysdb.Timeseries, error) {
+	if req.Host == "" || req.Metric == "" {
+		return nil, sysdb.Errorf(sysdb.CodeInvalidArgument, "missing host or metric name")
+	}
+	return s.Client.TimeseriesContext(ctx, req.Host, req.Metric, req.Start, req.End)
+}
+
+// Watch implements the Watch RPC. It executes the query every interval and
+// passes the result to send whenever it differs from the previous one,
+// starting with the first result. It returns once ctx is done, returning
+// ctx.Err(), or once the query or send fails.
+func (s *Service) Watch(ctx context.Context, req *WatchRequest, send func(*ObjectList) error) error {
+	if req.Interval <= 0 {
+		return sysdb.Errorf(sysdb.CodeInvalidArgument, "invalid watch interval %v", req.Interval)
+	}
+	q := strings.TrimSpace(req.Query)
+	if err := checkQuery(q); err != nil {
+		return err
+	}
+	if !strings.HasSuffix(q, ";") {
+		q += ";"
+	}
+
+	t := time.NewTicker(req.Interval)
+	defer t.Stop()
+	var prev *ObjectList
+	for {
+		res, err := s.Client.QueryContext(ctx, q)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		l, err := objectList(res)
+		if err != nil {
+			return err
+		}
+		if prev == nil || !reflect.DeepEqual(prev, l) {
+			if err := send(l); err != nil {
+				return err
+			}
+			prev = l
+		}
+
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// gRPC status codes as defined by the gRPC specification.
+const (
+	codeOK                = 0
+	codeCanceled          = 1
+	codeUnknown           = 2
+	codeInvalidArgument   = 3
+	codeDeadlineExceeded  = 4
+	codePermissionDenied  = 7
+	codeResourceExhausted = 8
+	codeUnimplemented     = 12
+	codeInternal          = 13
+	codeUnavailable       = 14
+)
+
+// StatusCode returns the gRPC status code (as defined by the gRPC
+// specification and the google.golang.org/grpc/codes package) describing
+// err.
+func StatusCode(err error) uint32 {
+	switch {
+	case err == nil:
+		return codeOK
+	case errors.Is(err, context.Canceled):
+		return codeCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return codeDeadlineExceeded
+	}
+	switch sysdb.ErrorCode(err) {
+	case sysdb.CodeInvalidArgument, sysdb.CodeInvalidFormat:
+		return codeInvalidArgument
+	case sysdb.CodePolicyViolation:
+		return codePermissionDenied
+	case sysdb.CodeExhausted, sysdb.CodeTooLarge:
+		return codeResourceExhausted
+	case sysdb.CodeUnsupported:
+		return codeUnimplemented
+	case sysdb.CodeUnexpectedMessage, sysdb.CodeMalformedMessage, sysdb.CodeVerificationFailed:
+		return codeInternal
+	case sysdb.CodeClosed, sysdb.CodeStartupFailed:
+		return codeUnavailable
+	}
+	return codeUnknown
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
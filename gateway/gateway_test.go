@@ -0,0 +1,236 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package gateway
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sysdb/go/client/clienttest"
+	"github.com/sysdb/go/sysdb"
+)
+
+func TestQueries(t *testing.T) {
+	f := clienttest.NewFake()
+	hosts := []sysdb.Host{{Name: "h1"}, {Name: "h2"}}
+	svcs := sysdb.ServiceList{{Host: "h1", Service: sysdb.Service{Name: "s1"}}}
+	metrics := sysdb.MetricList{{Host: "h1", Metric: sysdb.Metric{Name: "m1"}}}
+	f.SetResult("LIST hosts;", hosts)
+	f.SetResult("LIST services FILTER age < 5m;", svcs)
+	f.SetResult("LOOKUP metrics MATCHING name = 'm1';", metrics)
+	f.SetResult("LOOKUP hosts MATCHING name =~ 'h' FILTER backend = 'b';", hosts)
+	s := &Service{Client: f}
+	ctx := context.Background()
+
+	for _, test := range []struct {
+		desc string
+		call func() (*ObjectList, error)
+		want *ObjectList
+	}{
+		{"List(hosts)", func() (*ObjectList, error) {
+			return s.List(ctx, &ListRequest{Type: ObjectTypeHost})
+		}, &ObjectList{Hosts: hosts}},
+		{"List(services, filter)", func() (*ObjectList, error) {
+			return s.List(ctx, &ListRequest{Type: ObjectTypeService, Filter: "age < 5m"})
+		}, &ObjectList{Services: svcs}},
+		{"Lookup(metrics)", func() (*ObjectList, error) {
+			return s.Lookup(ctx, &LookupRequest{Type: ObjectTypeMetric, Matching: "name = 'm1'"})
+		}, &ObjectList{Metrics: metrics}},
+		{"Lookup(hosts, filter)", func() (*ObjectList, error) {
+			return s.Lookup(ctx, &LookupRequest{Type: ObjectTypeHost, Matching: "name =~ 'h'", Filter: "backend = 'b'"})
+		}, &ObjectList{Hosts: hosts}},
+	} {
+		if got, err := test.call(); err != nil || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s = %+v, %v; want %+v, <nil>", test.desc, got, err, test.want)
+		}
+	}
+
+	queries := len(f.Queries())
+	for _, test := range []struct {
+		desc string
+		call func() (*ObjectList, error)
+	}{
+		{"List(unspecified)", func() (*ObjectList, error) {
+			return s.List(ctx, &ListRequest{})
+		}},
+		{"List(filter with statement)", func() (*ObjectList, error) {
+			return s.List(ctx, &ListRequest{Type: ObjectTypeHost, Filter: "age < 5m; STORE host 'x'"})
+		}},
+		{"Lookup(missing matcher)", func() (*ObjectList, error) {
+			return s.Lookup(ctx, &LookupRequest{Type: ObjectTypeHost, Matching: " "})
+		}},
+		{"Lookup(matcher with statement)", func() (*ObjectList, error) {
+			return s.Lookup(ctx, &LookupRequest{Type: ObjectTypeHost, Matching: "name = 'a'; STORE host 'x'"})
+		}},
+		{"Lookup(unterminated string)", func() (*ObjectList, error) {
+			return s.Lookup(ctx, &LookupRequest{Type: ObjectTypeHost, Matching: "name = 'a"})
+		}},
+	} {
+		if got, err := test.call(); sysdb.ErrorCode(err) != sysdb.CodeInvalidArgument {
+			t.Errorf("%s = %+v, %v; want <error %v>", test.desc, got, err, sysdb.CodeInvalidArgument)
+		}
+	}
+	if got := f.Queries(); len(got) != queries {
+		t.Errorf("invalid requests sent queries %q", got[queries:])
+	}
+}
+
+func TestFetch(t *testing.T) {
+	f := clienttest.NewFake(sysdb.Host{
+		Name:     "h1",
+		Services: []sysdb.Service{{Name: "s1"}},
+		Metrics:  []sysdb.Metric{{Name: "m1", Timeseries: true}},
+	})
+	now := time.Unix(1e9, 0)
+	f.SetTimeseries("h1", "m1", sysdb.Timeseries{Data: map[string][]sysdb.DataPoint{
+		"value": {{Timestamp: sysdb.Time(now), Value: 1}},
+	}})
+	s := &Service{Client: f}
+	ctx := context.Background()
+
+	if res, err := s.Fetch(ctx, &FetchRequest{Type: ObjectTypeHost, Host: "h1", Name: "ignored"}); err != nil || res.Host == nil || res.Host.Name != "h1" || res.Service != nil || res.Metric != nil {
+		t.Errorf("Fetch(host h1) = %+v, %v; want host h1", res, err)
+	}
+	if res, err := s.Fetch(ctx, &FetchRequest{Type: ObjectTypeService, Host: "h1", Name: "s1"}); err != nil || res.Service == nil || res.Service.Name != "s1" || res.Host != nil {
+		t.Errorf("Fetch(service h1.s1) = %+v, %v; want service s1", res, err)
+	}
+	if res, err := s.Fetch(ctx, &FetchRequest{Type: ObjectTypeMetric, Host: "h1", Name: "m1"}); err != nil || res.Metric == nil || res.Metric.Name != "m1" || res.Host != nil {
+		t.Errorf("Fetch(metric h1.m1) = %+v, %v; want metric m1", res, err)
+	}
+	for _, req := range []*FetchRequest{
+		{Type: ObjectTypeHost},
+		{Type: ObjectTypeService, Host: "h1"},
+		{Host: "h1", Name: "s1"},
+	} {
+		if res, err := s.Fetch(ctx, req); sysdb.ErrorCode(err) != sysdb.CodeInvalidArgument {
+			t.Errorf("Fetch(%+v) = %+v, %v; want <error %v>", req, res, err, sysdb.CodeInvalidArgument)
+		}
+	}
+	if res, err := s.Fetch(ctx, &FetchRequest{Type: ObjectTypeHost, Host: "h2"}); sysdb.ErrorCode(err) != sysdb.CodeRequestFailed {
+		t.Errorf("Fetch(host h2) = %+v, %v; want <error %v>", res, err, sysdb.CodeRequestFailed)
+	}
+
+	ts, err := s.Timeseries(ctx, &TimeseriesRequest{Host: "h1", Metric: "m1", Start: now.Add(-time.Minute), End: now})
+	if err != nil || len(ts.Data["value"]) != 1 {
+		t.Errorf("Timeseries(h1, m1) = %+v, %v; want one data-point", ts, err)
+	}
+	if ts, err := s.Timeseries(ctx, &TimeseriesRequest{Host: "h1"}); sysdb.ErrorCode(err) != sysdb.CodeInvalidArgument {
+		t.Errorf("Timeseries(h1, <empty>) = %+v, %v; want <error %v>", ts, err, sysdb.CodeInvalidArgument)
+	}
+}
+
+// changingClient changes the result of the query q after the third request.
+type changingClient struct {
+	*clienttest.Fake
+	q string
+	n int
+	v interface{}
+}
+
+func (c *changingClient) QueryContext(ctx context.Context, q string) (interface{}, error) {
+	if c.n++; c.n == 3 {
+		c.SetResult(c.q, c.v)
+	}
+	return c.Fake.QueryContext(ctx, q)
+}
+
+func TestWatch(t *testing.T) {
+	const q = "LIST hosts;"
+	f := clienttest.NewFake()
+	f.SetResult(q, []sysdb.Host{{Name: "h1"}})
+	c := &changingClient{Fake: f, q: q, v: []sysdb.Host{{Name: "h2"}}}
+	s := &Service{Client: c}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var got []string
+	err := s.Watch(ctx, &WatchRequest{Query: "LIST hosts", Interval: time.Millisecond}, func(l *ObjectList) error {
+		got = append(got, l.Hosts[0].Name)
+		if len(got) == 2 {
+			cancel()
+		}
+		return nil
+	})
+	if err != context.Canceled {
+		t.Errorf("Watch() = %v; want %v", err, context.Canceled)
+	}
+	if want := []string{"h1", "h2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Watch() sent %q; want %q", got, want)
+	}
+	if c.n < 3 {
+		t.Errorf("Watch() sent %d queries; want at least 3", c.n)
+	}
+
+	errSend := errors.New("send failed")
+	if err := s.Watch(context.Background(), &WatchRequest{Query: q, Interval: time.Millisecond}, func(*ObjectList) error {
+		return errSend
+	}); err != errSend {
+		t.Errorf("Watch(<failing send>) = %v; want %v", err, errSend)
+	}
+
+	for _, req := range []*WatchRequest{
+		{Query: q},
+		{Query: q, Interval: -time.Second},
+		{Query: "FETCH host 'h1'", Interval: time.Second},
+		{Query: "LIST hosts; LIST services", Interval: time.Second},
+	} {
+		err := s.Watch(context.Background(), req, func(*ObjectList) error {
+			t.Errorf("Watch(%+v) sent a result", req)
+			return nil
+		})
+		if sysdb.ErrorCode(err) != sysdb.CodeInvalidArgument {
+			t.Errorf("Watch(%+v) = %v; want <error %v>", req, err, sysdb.CodeInvalidArgument)
+		}
+	}
+}
+
+func TestStatusCode(t *testing.T) {
+	for _, test := range []struct {
+		err  error
+		want uint32
+	}{
+		{nil, codeOK},
+		{context.Canceled, codeCanceled},
+		{context.DeadlineExceeded, codeDeadlineExceeded},
+		{sysdb.Errorf(sysdb.CodeInvalidArgument, "x"), codeInvalidArgument},
+		{sysdb.Errorf(sysdb.CodePolicyViolation, "x"), codePermissionDenied},
+		{sysdb.Errorf(sysdb.CodeExhausted, "x"), codeResourceExhausted},
+		{sysdb.Errorf(sysdb.CodeUnsupported, "x"), codeUnimplemented},
+		{sysdb.Errorf(sysdb.CodeMalformedMessage, "x"), codeInternal},
+		{sysdb.Errorf(sysdb.CodeClosed, "x"), codeUnavailable},
+		{sysdb.Errorf(sysdb.CodeRequestFailed, "x"), codeUnknown},
+		{errors.New("x"), codeUnknown},
+	} {
+		if got := StatusCode(test.err); got != test.want {
+			t.Errorf("StatusCode(%v) = %d; want %d", test.err, got, test.want)
+		}
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,3 @@
+module github.com/sysdb/go
+
+go 1.21
@@ -0,0 +1,588 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package graphql provides a GraphQL API for SysDB. It allows clients to
+// fetch exactly the nested objects (hosts, services, metrics, attributes,
+// and timeseries) they need in a single request.
+//
+// The API is described by Schema. A Handler serves it over HTTP following
+// the common GraphQL-over-HTTP conventions: queries are passed as the query
+// parameter of GET requests or as a JSON object with the fields query and
+// variables in the body of POST requests:
+//
+//	c, err := client.Connect("unix:/var/run/sysdbd.sock", "www")
+//	if err != nil {
+//		// handle error
+//	}
+//	http.Handle("/graphql", &graphql.Handler{Client: c})
+//
+// The implementation only depends on the standard library and supports the
+// subset of the GraphQL query language commonly used for fetching data: a
+// single (optionally named) query operation including variables, fields,
+// aliases, arguments, and the __typename meta field. Fragments, directives,
+// list and object input values, mutations, subscriptions, and
+// introspection are not supported and rejected with an error, as are
+// selection sets nested more than ten levels deep.
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/sysdb/go/client"
+	"github.com/sysdb/go/sysdb"
+)
+
+// Schema is the GraphQL schema of the API in the GraphQL schema definition
+// language. Time values are formatted according to RFC 3339 and durations
+// as described for sysdb.Duration. Arguments of type Time accept any format
+// supported by sysdb.ParseTime. The timeseries range defaults to the hour
+// preceding the end time which defaults to the current time.
+const Schema = `type Query {
+	hosts: [Host!]!
+	host(name: String!): Host
+}
+
+type Host {
+	name: String!
+	lastUpdate: String!
+	updateInterval: String!
+	backends: [String!]!
+	attributes(name: String): [Attribute!]!
+	services(name: String): [Service!]!
+	metrics(name: String): [Metric!]!
+}
+
+type Service {
+	name: String!
+	lastUpdate: String!
+	updateInterval: String!
+	backends: [String!]!
+	attributes(name: String): [Attribute!]!
+}
+
+type Metric {
+	name: String!
+	lastUpdate: String!
+	updateInterval: String!
+	backends: [String!]!
+	attributes(name: String): [Attribute!]!
+	hasTimeseries: Boolean!
+	dataNames: [String!]!
+	timeseries(start: String, end: String): Timeseries
+}
+
+type Attribute {
+	name: String!
+	value: String!
+	lastUpdate: String!
+	updateInterval: String!
+	backends: [String!]!
+}
+
+type Timeseries {
+	start: String!
+	end: String!
+	data: [DataSource!]!
+}
+
+type DataSource {
+	name: String!
+	points: [DataPoint!]!
+}
+
+type DataPoint {
+	timestamp: String!
+	value: Float
+}
+`
+
+// DefaultTimeseriesRange is the time range of timeseries if no start time
+// is specified.
+const DefaultTimeseriesRange = time.Hour
+
+// A Response is the result of executing a query.
+type Response struct {
+	// Data is the result of the query. It is nil if the query could not
+	// be executed at all.
+	Data interface{} `json:"data,omitempty"`
+	// Errors lists all errors which occurred while parsing, validating,
+	// or executing the query.
+	Errors []Error `json:"errors,omitempty"`
+}
+
+// An Error describes an error which occurred while processing a query.
+type Error struct {
+	Message string `json:"message"`
+	// Path is the response path of the field which failed to resolve.
+	Path []interface{} `json:"path,omitempty"`
+}
+
+// Execute executes the GraphQL query using c. Variables referenced by the
+// query are looked up in vars.
+func Execute(ctx context.Context, c client.Interface, query string, vars map[string]interface{}) *Response {
+	doc, err := parse(query)
+	if err != nil {
+		return &Response{Errors: []Error{{Message: err.Error()}}}
+	}
+
+	values := make(map[string]interface{}, len(doc.vars))
+	for n, def := range doc.vars {
+		values[n] = def
+		if v, ok := vars[n]; ok {
+			values[n] = v
+		}
+	}
+	e := &executor{ctx: ctx, c: c, vars: values}
+	e.validate(queryType, doc.selections, nil)
+	if len(e.errs) > 0 {
+		return &Response{Errors: e.errs}
+	}
+	return &Response{Data: e.object(queryType, root{}, doc.selections, nil), Errors: e.errs}
+}
+
+// An objectType describes a GraphQL object type.
+type objectType struct {
+	name   string
+	fields map[string]*fieldDef
+}
+
+// A fieldDef describes a field of an object type.
+type fieldDef struct {
+	// args lists the names of the arguments accepted by the field.
+	args []string
+	// typ is the type of the field's values. It is nil for scalars.
+	typ *objectType
+	// resolve returns the value of the field of the object src.
+	resolve func(e *executor, src interface{}, args map[string]interface{}) (interface{}, error)
+}
+
+// Source objects passed to resolvers.
+type (
+	root    struct{}
+	hostObj struct {
+		h *sysdb.Host
+		// full indicates whether h includes all children.
+		full bool
+	}
+	metricObj struct {
+		host string
+		m    *sysdb.Metric
+	}
+	dataSource struct {
+		name   string
+		points []sysdb.DataPoint
+	}
+)
+
+var (
+	queryType      = &objectType{name: "Query"}
+	hostType       = &objectType{name: "Host"}
+	serviceType    = &objectType{name: "Service"}
+	metricType     = &objectType{name: "Metric"}
+	attributeType  = &objectType{name: "Attribute"}
+	timeseriesType = &objectType{name: "Timeseries"}
+	dataSourceType = &objectType{name: "DataSource"}
+	dataPointType  = &objectType{name: "DataPoint"}
+)
+
+func init() {
+	queryType.fields = map[string]*fieldDef{
+		"hosts": {typ: hostType, resolve: func(e *executor, _ interface{}, _ map[string]interface{}) (interface{}, error) {
+			var hosts []sysdb.Host
+			if err := e.c.QueryIntoContext(e.ctx, "LIST hosts", &hosts); err != nil {
+				return nil, err
+			}
+			objs := make([]interface{}, len(hosts))
+			for i := range hosts {
+				objs[i] = &hostObj{h: &hosts[i]}
+			}
+			return objs, nil
+		}},
+		"host": {args: []string{"name"}, typ: hostType, resolve: func(e *executor, _ interface{}, args map[string]interface{}) (interface{}, error) {
+			name, err := stringArg(args, "name", true)
+			if err != nil {
+				return nil, err
+			}
+			h, err := e.c.FetchHost(e.ctx, name)
+			if sysdb.ErrorCode(err) == sysdb.CodeRequestFailed {
+				// unknown host
+				return nil, nil
+			} else if err != nil {
+				return nil, err
+			}
+			return &hostObj{h: h, full: true}, nil
+		}},
+	}
+
+	hostType.fields = objectFields(func(src interface{}) sysdb.Object { return src.(*hostObj).h })
+	hostType.fields["services"] = &fieldDef{args: []string{"name"}, typ: serviceType, resolve: func(e *executor, src interface{}, args map[string]interface{}) (interface{}, error) {
+		h, err := e.fullHost(src.(*hostObj))
+		if err != nil {
+			return nil, err
+		}
+		var objs []interface{}
+		err = filterNamed(args, len(h.Services), func(i int) string { return h.Services[i].Name }, func(i int) {
+			objs = append(objs, &h.Services[i])
+		})
+		return objs, err
+	}}
+	hostType.fields["metrics"] = &fieldDef{args: []string{"name"}, typ: metricType, resolve: func(e *executor, src interface{}, args map[string]interface{}) (interface{}, error) {
+		h, err := e.fullHost(src.(*hostObj))
+		if err != nil {
+			return nil, err
+		}
+		var objs []interface{}
+		err = filterNamed(args, len(h.Metrics), func(i int) string { return h.Metrics[i].Name }, func(i int) {
+			objs = append(objs, &metricObj{host: h.Name, m: &h.Metrics[i]})
+		})
+		return objs, err
+	}}
+
+	serviceType.fields = objectFields(func(src interface{}) sysdb.Object { return src.(*sysdb.Service) })
+
+	metricType.fields = objectFields(func(src interface{}) sysdb.Object { return src.(*metricObj).m })
+	metricType.fields["hasTimeseries"] = scalar(func(src interface{}) interface{} { return src.(*metricObj).m.Timeseries })
+	metricType.fields["dataNames"] = scalar(func(src interface{}) interface{} { return nonNil(src.(*metricObj).m.DataNames) })
+	metricType.fields["timeseries"] = &fieldDef{args: []string{"start", "end"}, typ: timeseriesType, resolve: func(e *executor, src interface{}, args map[string]interface{}) (interface{}, error) {
+		m := src.(*metricObj)
+		if !m.m.Timeseries {
+			return nil, nil
+		}
+		start, end, err := timeRange(args)
+		if err != nil {
+			return nil, err
+		}
+		return e.c.TimeseriesContext(e.ctx, m.host, m.m.Name, start, end)
+	}}
+
+	attributeType.fields = objectFields(func(src interface{}) sysdb.Object { return src.(*sysdb.Attribute) })
+	delete(attributeType.fields, "attributes")
+	attributeType.fields["value"] = scalar(func(src interface{}) interface{} { return src.(*sysdb.Attribute).Value })
+
+	timeseriesType.fields = map[string]*fieldDef{
+		"start": scalar(func(src interface{}) interface{} { return formatTime(src.(*sysdb.Timeseries).Start) }),
+		"end":   scalar(func(src interface{}) interface{} { return formatTime(src.(*sysdb.Timeseries).End) }),
+		"data": {typ: dataSourceType, resolve: func(_ *executor, src interface{}, _ map[string]interface{}) (interface{}, error) {
+			ts := src.(*sysdb.Timeseries)
+			names := make([]string, 0, len(ts.Data))
+			for n := range ts.Data {
+				names = append(names, n)
+			}
+			sort.Strings(names)
+			objs := make([]interface{}, len(names))
+			for i, n := range names {
+				objs[i] = &dataSource{name: n, points: ts.Data[n]}
+			}
+			return objs, nil
+		}},
+	}
+	dataSourceType.fields = map[string]*fieldDef{
+		"name": scalar(func(src interface{}) interface{} { return src.(*dataSource).name }),
+		"points": {typ: dataPointType, resolve: func(_ *executor, src interface{}, _ map[string]interface{}) (interface{}, error) {
+			points := src.(*dataSource).points
+			objs := make([]interface{}, len(points))
+			for i := range points {
+				objs[i] = &points[i]
+			}
+			return objs, nil
+		}},
+	}
+	dataPointType.fields = map[string]*fieldDef{
+		"timestamp": scalar(func(src interface{}) interface{} { return formatTime(src.(*sysdb.DataPoint).Timestamp) }),
+		"value": scalar(func(src interface{}) interface{} {
+			v := src.(*sysdb.DataPoint).Value
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return nil
+			}
+			return v
+		}),
+	}
+}
+
+// objectFields returns the definitions of the fields common to all stored
+// objects. obj returns the sysdb.Object of a source object.
+func objectFields(obj func(src interface{}) sysdb.Object) map[string]*fieldDef {
+	return map[string]*fieldDef{
+		"name":           scalar(func(src interface{}) interface{} { return obj(src).GetName() }),
+		"lastUpdate":     scalar(func(src interface{}) interface{} { return formatTime(obj(src).GetLastUpdate()) }),
+		"updateInterval": scalar(func(src interface{}) interface{} { return obj(src).GetUpdateInterval().String() }),
+		"backends":       scalar(func(src interface{}) interface{} { return nonNil(obj(src).GetBackends()) }),
+		"attributes": {args: []string{"name"}, typ: attributeType, resolve: func(_ *executor, src interface{}, args map[string]interface{}) (interface{}, error) {
+			attrs := obj(src).GetAttributes()
+			var objs []interface{}
+			err := filterNamed(args, len(attrs), func(i int) string { return attrs[i].Name }, func(i int) {
+				objs = append(objs, &attrs[i])
+			})
+			return objs, err
+		}},
+	}
+}
+
+// scalar returns the definition of a scalar field without arguments.
+func scalar(value func(src interface{}) interface{}) *fieldDef {
+	return &fieldDef{resolve: func(_ *executor, src interface{}, _ map[string]interface{}) (interface{}, error) {
+		return value(src), nil
+	}}
+}
+
+// nonNil returns l or an empty list if l is nil.
+func nonNil(l []string) []string {
+	if l == nil {
+		return []string{}
+	}
+	return l
+}
+
+func formatTime(t sysdb.Time) string {
+	return time.Time(t).Format(time.RFC3339Nano)
+}
+
+// filterNamed calls add for each of the n objects whose name matches the
+// optional name argument.
+func filterNamed(args map[string]interface{}, n int, name func(i int) string, add func(i int)) error {
+	want, err := stringArg(args, "name", false)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		if want == "" || name(i) == want {
+			add(i)
+		}
+	}
+	return nil
+}
+
+// stringArg returns the value of the named string argument.
+func stringArg(args map[string]interface{}, name string, required bool) (string, error) {
+	v, ok := args[name]
+	if !ok || v == nil {
+		if required {
+			return "", fmt.Errorf("argument %q is required", name)
+		}
+		return "", nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("argument %q: expected String, got %v", name, v)
+	}
+	return s, nil
+}
+
+// timeRange returns the time range specified by the start and end
+// arguments.
+func timeRange(args map[string]interface{}) (start, end time.Time, err error) {
+	end = time.Now()
+	if s, err := stringArg(args, "end", false); err != nil {
+		return start, end, err
+	} else if s != "" {
+		t, err := sysdb.ParseTime(s)
+		if err != nil {
+			return start, end, err
+		}
+		end = time.Time(t)
+	}
+	start = end.Add(-DefaultTimeseriesRange)
+	if s, err := stringArg(args, "start", false); err != nil {
+		return start, end, err
+	} else if s != "" {
+		t, err := sysdb.ParseTime(s)
+		if err != nil {
+			return start, end, err
+		}
+		start = time.Time(t)
+	}
+	if !start.Before(end) {
+		return start, end, fmt.Errorf("start time must be before end time")
+	}
+	return start, end, nil
+}
+
+// An executor executes a parsed query.
+type executor struct {
+	ctx  context.Context
+	c    client.Interface
+	vars map[string]interface{}
+	errs []Error
+}
+
+func (e *executor) errorf(path []interface{}, format string, a ...interface{}) {
+	e.errs = append(e.errs, Error{Message: fmt.Sprintf(format, a...), Path: append([]interface{}(nil), path...)})
+}
+
+// validate checks the selections against the type and reports all errors.
+func (e *executor) validate(typ *objectType, selections []*field, path []interface{}) {
+	for _, f := range selections {
+		p := append(path, f.key())
+		if f.name == "__typename" {
+			if f.selections != nil {
+				e.errorf(p, "field \"__typename\" must not have a selection")
+			}
+			continue
+		}
+		def, ok := typ.fields[f.name]
+		if !ok {
+			e.errorf(p, "cannot query field %q on type %q", f.name, typ.name)
+			continue
+		}
+		names := make([]string, 0, len(f.args))
+		for a := range f.args {
+			names = append(names, a)
+		}
+		sort.Strings(names)
+		for _, a := range names {
+			known := false
+			for _, n := range def.args {
+				known = known || n == a
+			}
+			if !known {
+				e.errorf(p, "unknown argument %q on field %q of type %q", a, f.name, typ.name)
+			}
+			if v, ok := f.args[a].(variable); ok {
+				if _, ok := e.vars[string(v)]; !ok {
+					e.errorf(p, "variable $%s is not defined", v)
+				}
+			}
+		}
+		switch {
+		case def.typ == nil && f.selections != nil:
+			e.errorf(p, "field %q of type %q must not have a selection", f.name, typ.name)
+		case def.typ != nil && f.selections == nil:
+			e.errorf(p, "field %q of type %q must have a selection", f.name, typ.name)
+		case def.typ != nil:
+			e.validate(def.typ, f.selections, p)
+		}
+	}
+}
+
+// object resolves the selections on the object src of the specified type.
+func (e *executor) object(typ *objectType, src interface{}, selections []*field, path []interface{}) object {
+	obj := make(object, 0, len(selections))
+	for _, f := range selections {
+		key := f.key()
+		if obj.has(key) {
+			// The same field may be selected multiple times.
+			continue
+		}
+		if f.name == "__typename" {
+			obj = append(obj, member{key, typ.name})
+			continue
+		}
+
+		p := append(path, key)
+		args := make(map[string]interface{}, len(f.args))
+		for n, v := range f.args {
+			if name, ok := v.(variable); ok {
+				v = e.vars[string(name)]
+			}
+			args[n] = v
+		}
+		def := typ.fields[f.name]
+		v, err := def.resolve(e, src, args)
+		if err != nil {
+			e.errorf(p, "%v", err)
+			v = nil
+		}
+		obj = append(obj, member{key, e.complete(def.typ, v, f.selections, p)})
+	}
+	return obj
+}
+
+// complete completes the resolved value v of a field.
+func (e *executor) complete(typ *objectType, v interface{}, selections []*field, path []interface{}) interface{} {
+	switch x := v.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		l := make([]interface{}, len(x))
+		for i, elem := range x {
+			l[i] = e.complete(typ, elem, selections, append(path, i))
+		}
+		return l
+	}
+	if typ == nil {
+		return v
+	}
+	if ts, ok := v.(*sysdb.Timeseries); ok && ts == nil {
+		return nil
+	}
+	return e.object(typ, v, selections, path)
+}
+
+// fullHost returns the host h including all of its children, fetching it
+// from the server if necessary.
+func (e *executor) fullHost(h *hostObj) (*sysdb.Host, error) {
+	if !h.full {
+		full, err := e.c.FetchHost(e.ctx, h.h.Name)
+		if err != nil {
+			return nil, err
+		}
+		h.h, h.full = full, true
+	}
+	return h.h, nil
+}
+
+// An object is a JSON object preserving the order of its members.
+type object []member
+
+type member struct {
+	key   string
+	value interface{}
+}
+
+func (o object) has(key string) bool {
+	for _, m := range o {
+		if m.key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (o object) MarshalJSON() ([]byte, error) {
+	buf := []byte{'{'}
+	for i, m := range o {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		k, err := json.Marshal(m.key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(m.value)
+		if err != nil {
+			return nil, err
+		}
+		buf = append(append(append(buf, k...), ':'), v...)
+	}
+	return append(buf, '}'), nil
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,230 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sysdb/go/client/clienttest"
+	"github.com/sysdb/go/sysdb"
+)
+
+var now = time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func testClient() *clienttest.Fake {
+	f := clienttest.NewFake(sysdb.Host{
+		Name:       "h1",
+		LastUpdate: sysdb.Time(now),
+		Backends:   []string{"puppet"},
+		Attributes: []sysdb.Attribute{{Name: "arch", Value: "amd64"}, {Name: "os", Value: "Linux"}},
+		Services:   []sysdb.Service{{Name: "ssh", UpdateInterval: sysdb.Minute}, {Name: "www"}},
+		Metrics: []sysdb.Metric{
+			{Name: "load", Timeseries: true, DataNames: []string{"value"}},
+			{Name: "users"},
+		},
+	})
+	f.SetResult("LIST hosts", []sysdb.Host{{Name: "h1", LastUpdate: sysdb.Time(now)}})
+	f.SetTimeseries("h1", "load", sysdb.Timeseries{Data: map[string][]sysdb.DataPoint{
+		"value": {
+			{Timestamp: sysdb.Time(now.Add(-time.Minute)), Value: 0.5},
+			{Timestamp: sysdb.Time(now), Value: math.NaN()},
+		},
+	}})
+	return f
+}
+
+func TestExecute(t *testing.T) {
+	for _, test := range []struct {
+		query    string
+		vars     map[string]interface{}
+		expected string
+	}{
+		{
+			`{ hosts { name lastUpdate } }`, nil,
+			`{"data":{"hosts":[{"name":"h1","lastUpdate":"2016-01-02T03:04:05Z"}]}}`,
+		},
+		{
+			// children are fetched on demand
+			`{ hosts { name services { name updateInterval } } }`, nil,
+			`{"data":{"hosts":[{"name":"h1","services":[{"name":"ssh","updateInterval":"1m"},{"name":"www","updateInterval":"0s"}]}]}}`,
+		},
+		{
+			`query Q($h: String!) { h: host(name: $h) { __typename backends attributes(name: "arch") { name value } } }`,
+			map[string]interface{}{"h": "h1"},
+			`{"data":{"h":{"__typename":"Host","backends":["puppet"],"attributes":[{"name":"arch","value":"amd64"}]}}}`,
+		},
+		{
+			`query($h: String = "h2") { host(name: $h) { name } }`, nil,
+			`{"data":{"host":null}}`,
+		},
+		{
+			`{ host(name: "h1") { metrics { name hasTimeseries dataNames
+				timeseries(start: "2016-01-02T03:00:00Z", end: "2016-01-02T03:04:05Z") {
+					start data { name points { timestamp value } }
+				}
+			} } }`, nil,
+			`{"data":{"host":{"metrics":[` +
+				`{"name":"load","hasTimeseries":true,"dataNames":["value"],"timeseries":{"start":"2016-01-02T03:00:00Z","data":[{"name":"value","points":[` +
+				`{"timestamp":"2016-01-02T03:03:05Z","value":0.5},{"timestamp":"2016-01-02T03:04:05Z","value":null}]}]}},` +
+				`{"name":"users","hasTimeseries":false,"dataNames":[],"timeseries":null}]}}}`,
+		},
+		{
+			`{ host(name: "h1") { metrics(name: "load") { timeseries(start: "soon") { start } } } }`, nil,
+			`{"data":{"host":{"metrics":[{"timeseries":null}]}},"errors":[{"message":"invalid time \"soon\"","path":["host","metrics",0,"timeseries"]}]}`,
+		},
+		{
+			`{ host { name } }`, nil,
+			`{"data":{"host":null},"errors":[{"message":"argument \"name\" is required","path":["host"]}]}`,
+		},
+		{
+			`{ hosts { name owner } host(name: $x, id: 1) { name } services { name } }`, nil,
+			`{"errors":[` +
+				`{"message":"cannot query field \"owner\" on type \"Host\"","path":["hosts","owner"]},` +
+				`{"message":"unknown argument \"id\" on field \"host\" of type \"Query\"","path":["host"]},` +
+				`{"message":"variable $x is not defined","path":["host"]},` +
+				`{"message":"cannot query field \"services\" on type \"Query\"","path":["services"]}]}`,
+		},
+		{
+			`{ hosts }`, nil,
+			`{"errors":[{"message":"field \"hosts\" of type \"Query\" must have a selection","path":["hosts"]}]}`,
+		},
+		{
+			`{ hosts { name { x } } }`, nil,
+			`{"errors":[{"message":"field \"name\" of type \"Host\" must not have a selection","path":["hosts","name"]}]}`,
+		},
+		{
+			`{ hosts`, nil,
+			`{"errors":[{"message":"syntax error at offset 7: expected name, got end of input"}]}`,
+		},
+	} {
+		res := Execute(context.Background(), testClient(), test.query, test.vars)
+		got, err := json.Marshal(res)
+		if err != nil || string(got) != test.expected {
+			t.Errorf("Execute(%q) = %s (%v)\nwant %s", test.query, got, err, test.expected)
+		}
+	}
+}
+
+// ctxClient records the context passed to TimeseriesContext.
+type ctxClient struct {
+	*clienttest.Fake
+	ctx context.Context
+}
+
+func (c *ctxClient) TimeseriesContext(ctx context.Context, host, metric string, start, end time.Time) (*sysdb.Timeseries, error) {
+	c.ctx = ctx
+	return c.Fake.TimeseriesContext(ctx, host, metric, start, end)
+}
+
+func TestExecuteContext(t *testing.T) {
+	type key struct{}
+	ctx := context.WithValue(context.Background(), key{}, "request")
+	c := &ctxClient{Fake: testClient()}
+	q := `{ host(name: "h1") { metrics(name: "load") { timeseries { start } } } }`
+	if res := Execute(ctx, c, q, nil); len(res.Errors) != 0 {
+		t.Errorf("Execute(%q) = %+v; want no errors", q, res)
+	}
+	if c.ctx == nil || c.ctx.Value(key{}) != "request" {
+		t.Errorf("Execute(%q) fetched the timeseries using context %v; want the request context", q, c.ctx)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	srv := httptest.NewServer(&Handler{Client: testClient()})
+	defer srv.Close()
+
+	get := func(q, vars string) (*http.Response, error) {
+		return http.Get(srv.URL + "?query=" + url.QueryEscape(q) + "&variables=" + url.QueryEscape(vars))
+	}
+	post := func(typ, body string) func() (*http.Response, error) {
+		return func() (*http.Response, error) {
+			return http.Post(srv.URL, typ, strings.NewReader(body))
+		}
+	}
+
+	for _, test := range []struct {
+		desc   string
+		do     func() (*http.Response, error)
+		status int
+		body   string
+	}{
+		{
+			"GET", func() (*http.Response, error) {
+				return get(`query($n: String) { host(name: $n) { name } }`, `{"n": "h1"}`)
+			},
+			http.StatusOK, `{"data":{"host":{"name":"h1"}}}`,
+		},
+		{
+			"GET invalid variables", func() (*http.Response, error) { return get(`{ hosts { name } }`, `{`) },
+			http.StatusBadRequest, `{"errors":[{"message":"invalid variables: unexpected end of JSON input"}]}`,
+		},
+		{
+			"POST JSON", post("application/json", `{"query": "query($n: String) { host(name: $n) { name } }", "variables": {"n": "h1"}}`),
+			http.StatusOK, `{"data":{"host":{"name":"h1"}}}`,
+		},
+		{
+			"POST GraphQL", post("application/graphql; charset=utf-8", `{ hosts { name } }`),
+			http.StatusOK, `{"data":{"hosts":[{"name":"h1"}]}}`,
+		},
+		{
+			"POST invalid JSON", post("application/json", `{"query": 1}`),
+			http.StatusBadRequest, `{"errors":[{"message":"invalid request: json: cannot unmarshal number into Go struct field request.query of type string"}]}`,
+		},
+		{
+			"POST invalid query", post("application/graphql", `{ x }`),
+			http.StatusBadRequest, `{"errors":[{"message":"cannot query field \"x\" on type \"Query\"","path":["x"]}]}`,
+		},
+		{
+			"PUT", func() (*http.Response, error) {
+				req, _ := http.NewRequest("PUT", srv.URL, nil)
+				return http.DefaultClient.Do(req)
+			},
+			http.StatusMethodNotAllowed, "Method Not Allowed",
+		},
+	} {
+		res, err := test.do()
+		if err != nil {
+			t.Errorf("%s: %v", test.desc, err)
+			continue
+		}
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil || res.StatusCode != test.status || strings.TrimSpace(string(body)) != test.body {
+			t.Errorf("%s = %d %s (%v); want %d %s", test.desc, res.StatusCode, body, err, test.status, test.body)
+		}
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,402 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package graphql
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// A document is a parsed GraphQL query document consisting of a single
+// query operation.
+type document struct {
+	// vars lists the variables declared by the operation along with their
+	// default values (nil if none).
+	vars       map[string]interface{}
+	selections []*field
+}
+
+// A field is a field selection.
+type field struct {
+	alias, name string
+	args        map[string]interface{}
+	selections  []*field
+}
+
+// key returns the response key of the field.
+func (f *field) key() string {
+	if f.alias != "" {
+		return f.alias
+	}
+	return f.name
+}
+
+// A variable refers to a variable of the operation.
+type variable string
+
+// tokens
+const (
+	tokEOF = iota
+	tokPunct
+	tokName
+	tokString
+	tokNumber
+)
+
+type token struct {
+	kind int
+	text string
+	// value is the decoded value of string and number tokens.
+	value interface{}
+	pos   int
+}
+
+// maxDepth is the maximum nesting depth of selection sets. It is well above
+// the depth of the schema and bounds the work spent on malicious queries.
+const maxDepth = 10
+
+// A parser parses a GraphQL query document.
+type parser struct {
+	src string
+	pos int
+	tok token
+	// depth is the nesting depth of the current selection set.
+	depth int
+}
+
+// parse parses a GraphQL document. Only a subset of the language is
+// supported (see the package documentation).
+func parse(src string) (doc *document, err error) {
+	p := &parser{src: src}
+	defer func() {
+		if r := recover(); r != nil {
+			pe, ok := r.(parseError)
+			if !ok {
+				panic(r)
+			}
+			doc, err = nil, pe
+		}
+	}()
+	p.next()
+	doc = p.document()
+	if p.tok.kind != tokEOF {
+		p.errorf("unexpected %s; only a single operation is supported", p.tok.text)
+	}
+	return doc, nil
+}
+
+type parseError struct {
+	pos int
+	msg string
+}
+
+func (e parseError) Error() string {
+	return fmt.Sprintf("syntax error at offset %d: %s", e.pos, e.msg)
+}
+
+func (p *parser) errorf(format string, a ...interface{}) {
+	panic(parseError{pos: p.tok.pos, msg: fmt.Sprintf(format, a...)})
+}
+
+// next scans the next token.
+func (p *parser) next() {
+	// skip ignored tokens: whitespace, commas, and comments
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == '#' {
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		} else if c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',' {
+			p.pos++
+		} else if strings.HasPrefix(p.src[p.pos:], "\ufeff") {
+			p.pos += len("\ufeff")
+		} else {
+			break
+		}
+	}
+
+	start := p.pos
+	p.tok = token{pos: start}
+	if p.pos >= len(p.src) {
+		p.tok.kind, p.tok.text = tokEOF, "end of input"
+		return
+	}
+
+	c := p.src[p.pos]
+	switch {
+	case strings.HasPrefix(p.src[p.pos:], "..."):
+		p.pos += 3
+		p.tok.kind = tokPunct
+	case strings.IndexByte("{}():!$[]=@", c) >= 0:
+		p.pos++
+		p.tok.kind = tokPunct
+	case c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z':
+		for p.pos < len(p.src) && isNameChar(p.src[p.pos]) {
+			p.pos++
+		}
+		p.tok.kind = tokName
+	case c == '-' || '0' <= c && c <= '9':
+		p.number()
+	case c == '"':
+		p.string()
+	default:
+		r, _ := utf8.DecodeRuneInString(p.src[p.pos:])
+		p.errorf("unexpected character %q", r)
+	}
+	p.tok.text = p.src[start:p.pos]
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+func (p *parser) number() {
+	start := p.pos
+	digits := func() int {
+		n := 0
+		for p.pos < len(p.src) && '0' <= p.src[p.pos] && p.src[p.pos] <= '9' {
+			p.pos++
+			n++
+		}
+		return n
+	}
+
+	isFloat := false
+	if p.src[p.pos] == '-' {
+		p.pos++
+	}
+	if digits() == 0 {
+		p.errorf("invalid number %q", p.src[start:p.pos])
+	}
+	if p.pos < len(p.src) && p.src[p.pos] == '.' {
+		p.pos++
+		isFloat = true
+		if digits() == 0 {
+			p.errorf("invalid number %q", p.src[start:p.pos])
+		}
+	}
+	if p.pos < len(p.src) && (p.src[p.pos] == 'e' || p.src[p.pos] == 'E') {
+		p.pos++
+		isFloat = true
+		if p.pos < len(p.src) && (p.src[p.pos] == '+' || p.src[p.pos] == '-') {
+			p.pos++
+		}
+		if digits() == 0 {
+			p.errorf("invalid number %q", p.src[start:p.pos])
+		}
+	}
+
+	var v json.Number = json.Number(p.src[start:p.pos])
+	p.tok.kind = tokNumber
+	if isFloat {
+		f, err := v.Float64()
+		if err != nil {
+			p.errorf("invalid number %q", v)
+		}
+		p.tok.value = f
+	} else {
+		i, err := v.Int64()
+		if err != nil {
+			p.errorf("invalid integer %q", v)
+		}
+		p.tok.value = i
+	}
+}
+
+func (p *parser) string() {
+	start := p.pos
+	if strings.HasPrefix(p.src[p.pos:], `"""`) {
+		p.errorf("block strings are not supported")
+	}
+	p.pos++
+	for {
+		if p.pos >= len(p.src) || p.src[p.pos] == '\n' {
+			p.errorf("unterminated string")
+		}
+		c := p.src[p.pos]
+		p.pos++
+		if c == '\\' {
+			p.pos++
+		} else if c == '"' {
+			break
+		}
+	}
+	// GraphQL string escapes are the same as the ones of JSON.
+	var s string
+	if err := json.Unmarshal([]byte(p.src[start:p.pos]), &s); err != nil {
+		p.errorf("invalid string %s", p.src[start:p.pos])
+	}
+	p.tok.kind, p.tok.value = tokString, s
+}
+
+// accept consumes the current token and returns true if it is the
+// specified punctuator.
+func (p *parser) accept(punct string) bool {
+	if p.tok.kind == tokPunct && p.tok.text == punct {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(punct string) {
+	if !p.accept(punct) {
+		p.errorf("expected %s, got %s", punct, p.tok.text)
+	}
+}
+
+func (p *parser) name() string {
+	if p.tok.kind != tokName {
+		p.errorf("expected name, got %s", p.tok.text)
+	}
+	n := p.tok.text
+	p.next()
+	return n
+}
+
+func (p *parser) document() *document {
+	doc := &document{vars: make(map[string]interface{})}
+	if p.tok.kind == tokName {
+		switch p.tok.text {
+		case "query":
+			p.next()
+		case "mutation", "subscription":
+			p.errorf("%s operations are not supported", p.tok.text)
+		case "fragment":
+			p.errorf("fragments are not supported")
+		default:
+			p.errorf("unexpected %s", p.tok.text)
+		}
+		if p.tok.kind == tokName {
+			p.next() // operation name
+		}
+		if p.accept("(") {
+			for !p.accept(")") {
+				p.expect("$")
+				n := p.name()
+				p.expect(":")
+				p.typeRef()
+				var def interface{}
+				if p.accept("=") {
+					def = p.value(true)
+				}
+				doc.vars[n] = def
+			}
+		}
+	}
+	doc.selections = p.selectionSet()
+	return doc
+}
+
+// typeRef parses and discards a type reference. Variable values are checked
+// by the resolvers.
+func (p *parser) typeRef() {
+	if p.accept("[") {
+		p.typeRef()
+		p.expect("]")
+	} else {
+		p.name()
+	}
+	p.accept("!")
+}
+
+func (p *parser) selectionSet() []*field {
+	if p.depth++; p.depth > maxDepth {
+		p.errorf("selection sets nested deeper than %d levels", maxDepth)
+	}
+	defer func() { p.depth-- }()
+	p.expect("{")
+	var fields []*field
+	for !p.accept("}") {
+		if p.tok.kind == tokPunct && p.tok.text == "..." {
+			p.errorf("fragments are not supported")
+		}
+		fields = append(fields, p.field())
+	}
+	if len(fields) == 0 {
+		p.errorf("empty selection set")
+	}
+	return fields
+}
+
+func (p *parser) field() *field {
+	f := &field{name: p.name()}
+	if p.accept(":") {
+		f.alias, f.name = f.name, p.name()
+	}
+	if p.accept("(") {
+		f.args = make(map[string]interface{})
+		for !p.accept(")") {
+			n := p.name()
+			p.expect(":")
+			f.args[n] = p.value(false)
+		}
+	}
+	if p.tok.kind == tokPunct && p.tok.text == "@" {
+		p.errorf("directives are not supported")
+	}
+	if p.tok.kind == tokPunct && p.tok.text == "{" {
+		f.selections = p.selectionSet()
+	}
+	return f
+}
+
+// value parses an input value. Constant values may not contain variables.
+func (p *parser) value(constant bool) interface{} {
+	switch p.tok.kind {
+	case tokString, tokNumber:
+		v := p.tok.value
+		p.next()
+		return v
+	case tokName:
+		n := p.name()
+		switch n {
+		case "true":
+			return true
+		case "false":
+			return false
+		case "null":
+			return nil
+		}
+		// enum values are treated as strings
+		return n
+	case tokPunct:
+		if p.tok.text == "$" && !constant {
+			p.next()
+			return variable(p.name())
+		}
+		if p.tok.text == "[" || p.tok.text == "{" {
+			p.errorf("list and object values are not supported")
+		}
+	}
+	p.errorf("expected value, got %s", p.tok.text)
+	return nil
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
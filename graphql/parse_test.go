@@ -0,0 +1,110 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package graphql
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	for _, test := range []struct {
+		src      string
+		expected *document
+	}{
+		{
+			`{ hosts { name } }`,
+			&document{
+				vars:       map[string]interface{}{},
+				selections: []*field{{name: "hosts", selections: []*field{{name: "name"}}}},
+			},
+		},
+		{
+			`# comment
+			query Q($n: String! = "h1", $s: [String]) {
+				h: host(name: $n) { name, services(name: "a\"b") { __typename } }
+				x: host(name: "xA") { lastUpdate }
+				metrics(n: -1, f: 1.5e3, b: true, e: ENUM, z: null) { name }
+			}`,
+			&document{
+				vars: map[string]interface{}{"n": "h1", "s": nil},
+				selections: []*field{
+					{alias: "h", name: "host", args: map[string]interface{}{"name": variable("n")}, selections: []*field{
+						{name: "name"},
+						{name: "services", args: map[string]interface{}{"name": `a"b`}, selections: []*field{{name: "__typename"}}},
+					}},
+					{alias: "x", name: "host", args: map[string]interface{}{"name": "xA"}, selections: []*field{{name: "lastUpdate"}}},
+					{name: "metrics", args: map[string]interface{}{
+						"n": int64(-1), "f": 1500.0, "b": true, "e": "ENUM", "z": nil,
+					}, selections: []*field{{name: "name"}}},
+				},
+			},
+		},
+		{
+			`query { hosts { name } }`,
+			&document{
+				vars:       map[string]interface{}{},
+				selections: []*field{{name: "hosts", selections: []*field{{name: "name"}}}},
+			},
+		},
+	} {
+		doc, err := parse(test.src)
+		if err != nil || !reflect.DeepEqual(doc, test.expected) {
+			t.Errorf("parse(%q) = %+v, %v; want %+v, <nil>", test.src, doc, err, test.expected)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, test := range []struct {
+		src string
+		err string
+	}{
+		{``, "expected {, got end of input"},
+		{`{}`, "empty selection set"},
+		{`{ hosts { name }`, "expected name, got end of input"},
+		{`{ hosts } { name }`, "only a single operation is supported"},
+		{`mutation { x }`, "mutation operations are not supported"},
+		{`fragment F on Host { name }`, "fragments are not supported"},
+		{`{ hosts { ...F } }`, "fragments are not supported"},
+		{`{ hosts @skip(if: true) }`, "directives are not supported"},
+		{`{ host(name: ["a"]) { name } }`, "list and object values are not supported"},
+		{`query($n: String = $m) { x }`, "expected value, got $"},
+		{`{ host(name: "abc) { name } }`, "unterminated string"},
+		{`{ host(name: """abc""") { name } }`, "block strings are not supported"},
+		{`{ host(n: 1.) { name } }`, "invalid number"},
+		{`{ host(n: 99999999999999999999) { name } }`, "invalid integer"},
+		{`{ hosts % }`, "unexpected character '%'"},
+		{strings.Repeat("{ a ", 10) + "{ b }" + strings.Repeat(" }", 10), "nested deeper than 10 levels"},
+	} {
+		if _, err := parse(test.src); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("parse(%q) = %v; want error containing %q", test.src, err, test.err)
+		}
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,302 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package httpapi provides an HTTP gateway to a SysDB server. It allows web
+// frontends to access the SysDB store using JSON over HTTP rather than the
+// SysDB front-end protocol.
+//
+// A Server serves the following resources, encoded using the JSON format of
+// the respective sysdb types:
+//
+//	GET /hosts                                      all hosts ([]sysdb.Host)
+//	GET /hosts/{name}                               a host including its children
+//	GET /hosts/{name}/services/{service}            a service
+//	GET /hosts/{name}/metrics/{metric}              a metric
+//	GET /hosts/{name}/metrics/{metric}/timeseries   a timeseries
+//	GET /query?q={query}                            any query result (client.Table)
+//
+// Names are single path segments, so slashes within names have to be
+// escaped as %2F (e.g. /hosts/h1/metrics/cpu-0%2Fcpu-idle/timeseries).
+//
+// The timeseries resource accepts the optional query parameters start and
+// end in any format supported by sysdb.ParseTime. They default to the last
+// hour. The query resource executes a single read-only (LIST, LOOKUP, FETCH,
+// or TIMESERIES) query and returns its result as a table, allowing frontends
+// to render results of any type generically. Errors are reported as a JSON
+// object with a single "error" field.
+//
+// A Server is an http.Handler and may be served using HTTP or HTTPS:
+//
+//	c, err := client.Connect("unix:/var/run/sysdbd.sock", "www")
+//	if err != nil {
+//		// handle error
+//	}
+//	log.Fatal(http.ListenAndServeTLS(":8443", "cert.pem", "key.pem", &httpapi.Server{Client: c}))
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sysdb/go/client"
+	"github.com/sysdb/go/proto"
+	"github.com/sysdb/go/sysdb"
+)
+
+// DefaultTimeseriesRange is the time range of timeseries returned if the
+// request does not specify a start time.
+const DefaultTimeseriesRange = time.Hour
+
+// A Server serves the SysDB store over HTTP.
+type Server struct {
+	// Client is used to query the SysDB server. A *client.Client may be
+	// shared by all requests since it maintains a pool of connections.
+	Client client.Interface
+	// Timeout, if not zero, limits the time spent on each request.
+	Timeout time.Duration
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// path is either ["hosts"], ["hosts", name], ["hosts", name, type,
+	// name], or ["hosts", name, "metrics", name, "timeseries"]
+	path, err := splitPath(r.URL)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if len(path) == 1 && path[0] == "query" {
+		s.serveQuery(w, r)
+		return
+	}
+	if path[0] != "hosts" || len(path) > 5 || len(path) == 3 ||
+		len(path) >= 4 && path[2] != "services" && path[2] != "metrics" ||
+		len(path) == 5 && (path[2] != "metrics" || path[4] != "timeseries") {
+		http.NotFound(w, r)
+		return
+	}
+	for _, p := range path {
+		if p == "" {
+			http.NotFound(w, r)
+			return
+		}
+	}
+	if !allowMethod(w, r) {
+		return
+	}
+	ctx, cancel := s.context(r)
+	defer cancel()
+
+	var v interface{}
+	switch len(path) {
+	case 1:
+		v, err = s.hosts(ctx)
+	case 2:
+		v, err = s.Client.FetchHost(ctx, path[1])
+	case 4:
+		if path[2] == "services" {
+			v, err = s.Client.FetchService(ctx, path[1], path[3])
+		} else {
+			v, err = s.Client.FetchMetric(ctx, path[1], path[3])
+		}
+	case 5:
+		v, err = s.timeseries(ctx, r, path[1], path[3])
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, v)
+}
+
+// serveQuery serves the /query resource.
+func (s *Server) serveQuery(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r) {
+		return
+	}
+	ctx, cancel := s.context(r)
+	defer cancel()
+
+	q, err := readOnlyQuery(r.FormValue("q"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	res, err := s.Client.QueryContext(ctx, q)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	t, err := client.NewTable(res)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if t == nil {
+		t = &client.Table{}
+	}
+	if t.Columns == nil {
+		t.Columns = []client.Column{}
+	}
+	if t.Rows == nil {
+		t.Rows = [][]string{}
+	}
+	writeJSON(w, t)
+}
+
+// readOnlyQuery verifies that q is a single query which does not modify the
+// store. It returns the query without its terminating semicolon.
+func readOnlyQuery(q string) (string, error) {
+	stmts, err := proto.SplitStatements(q)
+	if err != nil {
+		return "", err
+	}
+	if len(stmts) != 1 {
+		return "", sysdb.Errorf(sysdb.CodeInvalidArgument, "expected a single query, got %d", len(stmts))
+	}
+	fields, err := proto.Fields(stmts[0])
+	if err != nil {
+		return "", err
+	}
+	switch strings.ToUpper(fields[0]) {
+	case "LIST", "LOOKUP", "FETCH", "TIMESERIES":
+		return stmts[0], nil
+	}
+	return "", sysdb.Errorf(sysdb.CodeInvalidArgument, "unsupported query %q; only LIST, LOOKUP, FETCH, and TIMESERIES are allowed", fields[0])
+}
+
+// allowMethod reports whether the method of r is allowed and writes an error
+// response if it is not.
+func allowMethod(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
+
+// context returns the context for serving r, limited by the configured
+// timeout.
+func (s *Server) context(r *http.Request) (context.Context, context.CancelFunc) {
+	if s.Timeout > 0 {
+		return context.WithTimeout(r.Context(), s.Timeout)
+	}
+	return context.WithCancel(r.Context())
+}
+
+func (s *Server) hosts(ctx context.Context) ([]sysdb.Host, error) {
+	var hosts []sysdb.Host
+	if err := s.Client.QueryIntoContext(ctx, "LIST hosts", &hosts); err != nil {
+		return nil, err
+	}
+	if hosts == nil {
+		hosts = []sysdb.Host{}
+	}
+	return hosts, nil
+}
+
+func (s *Server) timeseries(ctx context.Context, r *http.Request, host, metric string) (*sysdb.Timeseries, error) {
+	end := time.Now()
+	if v := r.FormValue("end"); v != "" {
+		t, err := sysdb.ParseTime(v)
+		if err != nil {
+			return nil, err
+		}
+		end = time.Time(t)
+	}
+	start := end.Add(-DefaultTimeseriesRange)
+	if v := r.FormValue("start"); v != "" {
+		t, err := sysdb.ParseTime(v)
+		if err != nil {
+			return nil, err
+		}
+		start = time.Time(t)
+	}
+	if !start.Before(end) {
+		return nil, sysdb.Errorf(sysdb.CodeInvalidArgument, "start time must be before end time")
+	}
+	return s.Client.TimeseriesContext(ctx, host, metric, start, end)
+}
+
+// splitPath returns the unescaped segments of the path of u. Segments are
+// split before unescaping them, so names may include slashes encoded as
+// %2F (e.g. collectd metric names like cpu-0/cpu-idle).
+func splitPath(u *url.URL) ([]string, error) {
+	path := strings.Split(strings.Trim(u.EscapedPath(), "/"), "/")
+	for i, p := range path {
+		var err error
+		if path[i], err = url.PathUnescape(p); err != nil {
+			return nil, err
+		}
+	}
+	return path, nil
+}
+
+// writeJSON writes the JSON encoding of v.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(data, '\n'))
+}
+
+// writeError writes err as a JSON object using a status code derived from
+// the error.
+func writeError(w http.ResponseWriter, err error) {
+	data, _ := json.Marshal(struct {
+		Error string `json:"error"`
+	}{err.Error()})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode(err))
+	w.Write(append(data, '\n'))
+}
+
+// statusCode returns the HTTP status code for err.
+func statusCode(err error) int {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
+	}
+	switch sysdb.ErrorCode(err) {
+	case sysdb.CodeInvalidArgument, sysdb.CodeInvalidFormat:
+		return http.StatusBadRequest
+	case sysdb.CodeRequestFailed:
+		// The server rejects requests for unknown objects.
+		return http.StatusNotFound
+	case sysdb.CodeUnknown:
+		return http.StatusInternalServerError
+	}
+	return http.StatusBadGateway
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,165 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package httpapi
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sysdb/go/client/clienttest"
+	"github.com/sysdb/go/sysdb"
+)
+
+func TestServer(t *testing.T) {
+	now := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+	f := clienttest.NewFake(sysdb.Host{
+		Name:       "h1",
+		LastUpdate: sysdb.Time(now),
+		Services:   []sysdb.Service{{Name: "s1", LastUpdate: sysdb.Time(now)}},
+		Metrics: []sysdb.Metric{
+			{Name: "m1", LastUpdate: sysdb.Time(now), Timeseries: true},
+			{Name: "cpu-0/cpu-idle", LastUpdate: sysdb.Time(now), Timeseries: true},
+		},
+	})
+	f.SetResult("LIST hosts", []sysdb.Host{{Name: "h1", LastUpdate: sysdb.Time(now)}})
+	f.SetResult("LOOKUP hosts MATCHING name = 'h1'", []sysdb.Host{{Name: "h1", LastUpdate: sysdb.Time(now)}})
+	f.SetResult("LIST nothing", nil)
+	f.SetTimeseries("h1", "cpu-0/cpu-idle", sysdb.Timeseries{
+		Data: map[string][]sysdb.DataPoint{"value": {{Timestamp: sysdb.Time(now.Add(-time.Minute)), Value: 3}}},
+	})
+	f.SetTimeseries("h1", "m1", sysdb.Timeseries{
+		Data: map[string][]sysdb.DataPoint{"value": {
+			{Timestamp: sysdb.Time(now.Add(-2 * time.Hour)), Value: 1},
+			{Timestamp: sysdb.Time(now.Add(-time.Minute)), Value: 2},
+		}},
+	})
+
+	srv := httptest.NewServer(&Server{Client: f})
+	defer srv.Close()
+
+	for _, test := range []struct {
+		method, path string
+		status       int
+		body         string
+	}{
+		{
+			"GET", "/hosts", http.StatusOK,
+			`[{"name":"h1","last_update":"2016-01-02 03:04:05 +0000","update_interval":"0s","backends":null,"attributes":null,"metrics":null,"services":null}]`,
+		},
+		{
+			"GET", "/hosts/h1/services/s1", http.StatusOK,
+			`{"name":"s1","last_update":"2016-01-02 03:04:05 +0000","update_interval":"0s","backends":null,"attributes":null}`,
+		},
+		{
+			"GET", "/hosts/h1/metrics/m1", http.StatusOK,
+			`{"name":"m1","timeseries":true,"last_update":"2016-01-02 03:04:05 +0000","update_interval":"0s","backends":null,"attributes":null}`,
+		},
+		{
+			"GET", "/hosts/h1/metrics/m1/timeseries?end=2016-01-02T03:04:05Z", http.StatusOK,
+			`{"start":"2016-01-02 02:04:05 +0000","end":"2016-01-02 03:04:05 +0000","data":{"value":[{"timestamp":"2016-01-02 03:03:05 +0000","value":"2"}]}}`,
+		},
+		{
+			"GET", "/hosts/h1/metrics/m1/timeseries?start=1451692800&end=2016-01-02T03:04:05Z", http.StatusOK,
+			`{"start":"2016-01-02 00:00:00 +0000","end":"2016-01-02 03:04:05 +0000","data":{"value":[{"timestamp":"2016-01-02 01:04:05 +0000","value":"1"},{"timestamp":"2016-01-02 03:03:05 +0000","value":"2"}]}}`,
+		},
+		{
+			"GET", "/hosts/h1/metrics/m1/timeseries?start=yesterday", http.StatusBadRequest,
+			`{"error":"invalid time \"yesterday\""}`,
+		},
+		{
+			"GET", "/hosts/h1/metrics/m1/timeseries?start=2016-01-02T03:04:05Z&end=2016-01-02T03:04:05Z", http.StatusBadRequest,
+			`{"error":"start time must be before end time"}`,
+		},
+		{
+			"GET", "/hosts/h1/metrics/cpu-0%2Fcpu-idle", http.StatusOK,
+			`{"name":"cpu-0/cpu-idle","timeseries":true,"last_update":"2016-01-02 03:04:05 +0000","update_interval":"0s","backends":null,"attributes":null}`,
+		},
+		{
+			"GET", "/hosts/h1/metrics/cpu-0%2fcpu-idle/timeseries?end=2016-01-02T03:04:05Z", http.StatusOK,
+			`{"start":"2016-01-02 02:04:05 +0000","end":"2016-01-02 03:04:05 +0000","data":{"value":[{"timestamp":"2016-01-02 03:03:05 +0000","value":"3"}]}}`,
+		},
+		{"GET", "/hosts/h1/metrics/cpu-0/cpu-idle", http.StatusNotFound, "404 page not found"},
+		{"GET", "/hosts/h2", http.StatusNotFound, `{"error":"request failed: host h2 not found"}`},
+		{"GET", "/hosts/h1/services/s2", http.StatusNotFound, `{"error":"request failed: service h1.s2 not found"}`},
+		{
+			"GET", "/query?q=" + url.QueryEscape("LOOKUP hosts MATCHING name = 'h1';"), http.StatusOK,
+			`{"columns":[{"name":"name","type":"string"},{"name":"last_update","type":"time"},{"name":"update_interval","type":"duration"},{"name":"backends","type":"string"}],"rows":[["h1","2016-01-02T03:04:05Z","0s",""]]}`,
+		},
+		{"GET", "/query?q=LIST+nothing", http.StatusOK, `{"columns":[],"rows":[]}`},
+		{"GET", "/query?q=" + url.QueryEscape("STORE host 'h2'"), http.StatusBadRequest, `{"error":"unsupported query \"STORE\"; only LIST, LOOKUP, FETCH, and TIMESERIES are allowed"}`},
+		{"GET", "/query?q=" + url.QueryEscape("LIST hosts; LIST services"), http.StatusBadRequest, `{"error":"expected a single query, got 2"}`},
+		{"GET", "/query", http.StatusBadRequest, `{"error":"expected a single query, got 0"}`},
+		{"POST", "/query?q=LIST+hosts", http.StatusMethodNotAllowed, "Method Not Allowed"},
+		{"GET", "/unknown", http.StatusNotFound, "404 page not found"},
+		{"POST", "/hosts", http.StatusMethodNotAllowed, "Method Not Allowed"},
+	} {
+		req, err := http.NewRequest(test.method, srv.URL+test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Errorf("%s %s: %v", test.method, test.path, err)
+			continue
+		}
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil || res.StatusCode != test.status || strings.TrimSpace(string(body)) != test.body {
+			t.Errorf("%s %s = %d %s (%v); want %d %s",
+				test.method, test.path, res.StatusCode, body, err, test.status, test.body)
+		}
+	}
+
+	// Timeseries requests are aborted once the client went away.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest("GET", "/hosts/h1/metrics/m1/timeseries", nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	(&Server{Client: f}).ServeHTTP(rec, req)
+	if rec.Code == http.StatusOK {
+		t.Errorf("GET /hosts/h1/metrics/m1/timeseries (cancelled) = %d %s; want error", rec.Code, rec.Body)
+	}
+
+	// The full host is fetched including its children.
+	res, err := http.Get(srv.URL + "/hosts/h1")
+	if err != nil {
+		t.Fatalf("GET /hosts/h1: %v", err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || !strings.Contains(string(body), `"services":[{"name":"s1"`) ||
+		res.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("GET /hosts/h1 = %d %s (%s); want 200 including services", res.StatusCode, body, res.Header.Get("Content-Type"))
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,259 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package memstore provides an in-memory copy of (parts of) the SysDB store
+// which may be queried locally.
+//
+// A Store is usually populated from the result of a single LOOKUP or LIST
+// query and then used to answer many sub-queries without contacting the
+// server again:
+//
+//	var hosts []sysdb.Host
+//	err := c.QueryInto("LOOKUP hosts MATCHING attribute['location'] = 'dc1';", &hosts)
+//	// ...
+//	s := memstore.New(hosts)
+//	amd64, err := s.Lookup(ast.Cmp{Op: ast.EQ, Left: ast.Attr("architecture"), Right: ast.Const{Value: "amd64"}})
+//
+// Matchers are evaluated using ast.Evaluator.
+package memstore
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/sysdb/go/ast"
+	"github.com/sysdb/go/sysdb"
+)
+
+// A Store holds a set of hosts indexed by name and attribute values. A Store
+// is immutable and may be used concurrently.
+type Store struct {
+	hosts  []sysdb.Host
+	byName map[string]int
+	byAttr map[string]map[string][]int
+}
+
+// New creates a store holding the specified hosts. The hosts are sorted by
+// name; if multiple hosts share the same name (ignoring case), the last one
+// wins. The store takes ownership of the hosts, that is, they must not be
+// modified afterwards.
+func New(hosts []sysdb.Host) *Store {
+	s := &Store{
+		byName: make(map[string]int, len(hosts)),
+		byAttr: make(map[string]map[string][]int),
+	}
+
+	uniq := make(map[string]sysdb.Host, len(hosts))
+	for _, h := range hosts {
+		uniq[strings.ToLower(h.Name)] = h
+	}
+	s.hosts = make([]sysdb.Host, 0, len(uniq))
+	for _, h := range uniq {
+		s.hosts = append(s.hosts, h)
+	}
+	sort.Slice(s.hosts, func(i, j int) bool {
+		return strings.ToLower(s.hosts[i].Name) < strings.ToLower(s.hosts[j].Name)
+	})
+
+	for i, h := range s.hosts {
+		s.byName[strings.ToLower(h.Name)] = i
+		for _, a := range h.Attributes {
+			values, ok := s.byAttr[a.Name]
+			if !ok {
+				values = make(map[string][]int)
+				s.byAttr[a.Name] = values
+			}
+			values[a.Value] = append(values[a.Value], i)
+		}
+	}
+	return s
+}
+
+// Len returns the number of hosts in the store.
+func (s *Store) Len() int {
+	return len(s.hosts)
+}
+
+// Hosts returns all hosts sorted by name.
+func (s *Store) Hosts() []sysdb.Host {
+	return append([]sysdb.Host(nil), s.hosts...)
+}
+
+// Host returns the host with the specified name (ignoring case).
+func (s *Store) Host(name string) (sysdb.Host, bool) {
+	i, ok := s.byName[strings.ToLower(name)]
+	if !ok {
+		return sysdb.Host{}, false
+	}
+	return s.hosts[i], true
+}
+
+// WithAttribute returns all hosts having an attribute of the specified name
+// and value, sorted by name.
+func (s *Store) WithAttribute(name, value string) []sysdb.Host {
+	var res []sysdb.Host
+	for _, i := range s.byAttr[name][value] {
+		res = append(res, s.hosts[i])
+	}
+	return res
+}
+
+// candidates returns the indexes of all hosts which may match m based on the
+// indexes of the store. It returns false if all hosts have to be
+// considered.
+func (s *Store) candidates(m ast.Matcher) ([]int, bool) {
+	switch m := m.(type) {
+	case ast.Cmp:
+		if m.Op != ast.EQ {
+			return nil, false
+		}
+		c, ok := m.Right.(ast.Const)
+		if !ok {
+			return nil, false
+		}
+		v, ok := c.Value.(string)
+		if !ok {
+			return nil, false
+		}
+		switch l := m.Left.(type) {
+		case ast.Attr:
+			return s.byAttr[string(l)][v], true
+		case ast.Field:
+			if l != ast.FieldName {
+				return nil, false
+			}
+			if i, ok := s.byName[strings.ToLower(v)]; ok {
+				// names are compared exactly by the matcher
+				return []int{i}, true
+			}
+			return nil, true
+		}
+	case ast.Logical:
+		if m.Op != ast.And {
+			return nil, false
+		}
+		l, lok := s.candidates(m.Left)
+		r, rok := s.candidates(m.Right)
+		if lok && (!rok || len(l) <= len(r)) {
+			return l, true
+		}
+		return r, rok
+	}
+	return nil, false
+}
+
+// Lookup returns all hosts matching m, sorted by name. Matchers are
+// evaluated in the context of each host, similar to a "LOOKUP hosts
+// MATCHING" query. An error is returned if the matcher is invalid; use a nil
+// matcher to return all hosts.
+func (s *Store) Lookup(m ast.Matcher) ([]sysdb.Host, error) {
+	if m == nil {
+		return s.Hosts(), nil
+	}
+
+	idx, ok := s.candidates(m)
+	if !ok {
+		idx = make([]int, len(s.hosts))
+		for i := range idx {
+			idx[i] = i
+		}
+	}
+
+	var e ast.Evaluator
+	var res []sysdb.Host
+	for _, i := range idx {
+		ok, err := e.MatchHost(m, &s.hosts[i])
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			res = append(res, s.hosts[i])
+		}
+	}
+	return res, nil
+}
+
+// LookupServices returns all services matching m along with the name of
+// their host, ordered by host and service name. Matchers are evaluated in
+// the context of each service, similar to a "LOOKUP services MATCHING"
+// query.
+func (s *Store) LookupServices(m ast.Matcher) (sysdb.ServiceList, error) {
+	var e ast.Evaluator
+	var res sysdb.ServiceList
+	for i := range s.hosts {
+		h := &s.hosts[i]
+		svcs := make([]*sysdb.Service, len(h.Services))
+		for j := range h.Services {
+			svcs[j] = &h.Services[j]
+		}
+		sort.SliceStable(svcs, func(i, j int) bool { return svcs[i].Name < svcs[j].Name })
+
+		for _, svc := range svcs {
+			if m != nil {
+				ok, err := e.MatchService(m, h, svc)
+				if err != nil {
+					return nil, err
+				}
+				if !ok {
+					continue
+				}
+			}
+			res = append(res, sysdb.HostService{Host: h.Name, Service: *svc})
+		}
+	}
+	return res, nil
+}
+
+// LookupMetrics returns all metrics matching m along with the name of their
+// host, ordered by host and metric name. Matchers are evaluated in the
+// context of each metric, similar to a "LOOKUP metrics MATCHING" query.
+func (s *Store) LookupMetrics(m ast.Matcher) (sysdb.MetricList, error) {
+	var e ast.Evaluator
+	var res sysdb.MetricList
+	for i := range s.hosts {
+		h := &s.hosts[i]
+		metrics := make([]*sysdb.Metric, len(h.Metrics))
+		for j := range h.Metrics {
+			metrics[j] = &h.Metrics[j]
+		}
+		sort.SliceStable(metrics, func(i, j int) bool { return metrics[i].Name < metrics[j].Name })
+
+		for _, met := range metrics {
+			if m != nil {
+				ok, err := e.MatchMetric(m, h, met)
+				if err != nil {
+					return nil, err
+				}
+				if !ok {
+					continue
+				}
+			}
+			res = append(res, sysdb.HostMetric{Host: h.Name, Metric: *met})
+		}
+	}
+	return res, nil
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,178 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package memstore
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sysdb/go/ast"
+	"github.com/sysdb/go/sysdb"
+)
+
+var (
+	now   = time.Date(2015, 5, 1, 12, 0, 0, 0, time.UTC)
+	hosts = []sysdb.Host{
+		{
+			Name:           "h2",
+			LastUpdate:     sysdb.Time(now.Add(-time.Hour)),
+			UpdateInterval: 5 * sysdb.Minute,
+			Backends:       []string{"puppet"},
+			Attributes: []sysdb.Attribute{
+				{Name: "architecture", Value: "i386"},
+				{Name: "cpus", Value: "2"},
+			},
+			Services: []sysdb.Service{
+				{Name: "ssh", Attributes: []sysdb.Attribute{{Name: "port", Value: "22"}}},
+			},
+		},
+		{
+			Name:           "h1",
+			LastUpdate:     sysdb.Time(now.Add(-time.Minute)),
+			UpdateInterval: sysdb.Minute,
+			Backends:       []string{"collectd", "puppet"},
+			Attributes: []sysdb.Attribute{
+				{Name: "architecture", Value: "amd64"},
+				{Name: "cpus", Value: "16"},
+			},
+			Metrics: []sysdb.Metric{
+				{Name: "load/load", Timeseries: true},
+				{Name: "cpu/idle"},
+			},
+			Services: []sysdb.Service{
+				{Name: "www", Attributes: []sysdb.Attribute{{Name: "port", Value: "80"}}},
+				{Name: "ssh", Attributes: []sysdb.Attribute{{Name: "port", Value: "22"}}},
+			},
+		},
+		{Name: "h3"},
+	}
+)
+
+func names(hosts []sysdb.Host) []string {
+	var res []string
+	for _, h := range hosts {
+		res = append(res, h.Name)
+	}
+	return res
+}
+
+func TestStore(t *testing.T) {
+	s := New(append(hosts, sysdb.Host{Name: "H3", Backends: []string{"dup"}}))
+	if s.Len() != 3 {
+		t.Errorf("Len() = %d; want 3", s.Len())
+	}
+	if got, expected := names(s.Hosts()), []string{"h1", "h2", "H3"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Hosts() = %v; want %v", got, expected)
+	}
+	if h, ok := s.Host("H1"); !ok || h.Name != "h1" {
+		t.Errorf("Host(H1) = %v, %v; want h1, true", h.Name, ok)
+	}
+	if h, ok := s.Host("h3"); !ok || len(h.Backends) != 1 || h.Backends[0] != "dup" {
+		t.Errorf("Host(h3) = %v, %v; want H3, true", h, ok)
+	}
+	if _, ok := s.Host("h4"); ok {
+		t.Errorf("Host(h4) = _, true; want false")
+	}
+
+	for _, test := range []struct {
+		name, value string
+		expected    []string
+	}{
+		{"architecture", "amd64", []string{"h1"}},
+		{"architecture", "sparc", nil},
+		{"cpus", "2", []string{"h2"}},
+		{"unknown", "2", nil},
+	} {
+		if got := names(s.WithAttribute(test.name, test.value)); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("WithAttribute(%q, %q) = %v; want %v", test.name, test.value, got, test.expected)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	s := New(hosts)
+	for _, test := range []struct {
+		m        ast.Matcher
+		expected []string
+	}{
+		{nil, []string{"h1", "h2", "h3"}},
+		{ast.Cmp{Op: ast.EQ, Left: ast.Attr("architecture"), Right: ast.Const{Value: "amd64"}}, []string{"h1"}},
+		{ast.Cmp{Op: ast.EQ, Left: ast.FieldName, Right: ast.Const{Value: "h2"}}, []string{"h2"}},
+		{ast.Cmp{Op: ast.EQ, Left: ast.FieldName, Right: ast.Const{Value: "H2"}}, nil},
+		{
+			ast.Logical{
+				Op:    ast.And,
+				Left:  ast.Cmp{Op: ast.Regex, Left: ast.Attr("architecture"), Right: ast.Const{Value: "^(i386|amd64)$"}},
+				Right: ast.Cmp{Op: ast.GT, Left: ast.Attr("cpus"), Right: ast.Const{Value: int64(4)}},
+			},
+			[]string{"h1"},
+		},
+		{ast.Cmp{Op: ast.NE, Left: ast.Attr("architecture"), Right: ast.Const{Value: "amd64"}}, []string{"h2"}},
+		{ast.Unary{Op: ast.IsNull, Expr: ast.Attr("architecture")}, []string{"h3"}},
+		{ast.Iter{Op: ast.Any, Iter: ast.Typed{Type: ast.Service, Expr: ast.FieldName}, Cmp: ast.EQ, Value: ast.Const{Value: "www"}}, []string{"h1"}},
+		{ast.Iter{Op: ast.Any, Iter: ast.FieldBackend, Cmp: ast.EQ, Value: ast.Const{Value: "puppet"}}, []string{"h1", "h2"}},
+	} {
+		got, err := s.Lookup(test.m)
+		if err != nil || !reflect.DeepEqual(names(got), test.expected) {
+			t.Errorf("Lookup(%v) = %v, %v; want %v, <nil>", test.m, names(got), err, test.expected)
+		}
+	}
+
+	if _, err := s.Lookup(ast.Cmp{Op: ast.Regex, Left: ast.FieldName, Right: ast.Const{Value: "("}}); sysdb.ErrorCode(err) != sysdb.CodeInvalidArgument {
+		t.Errorf("Lookup(<invalid regex>) = %v; want <error %v>", err, sysdb.CodeInvalidArgument)
+	}
+}
+
+func TestLookupChildren(t *testing.T) {
+	s := New(hosts)
+
+	svcs, err := s.LookupServices(ast.Cmp{Op: ast.EQ, Left: ast.Attr("port"), Right: ast.Const{Value: int64(22)}})
+	expected := sysdb.ServiceList{
+		{Host: "h1", Service: hosts[1].Services[1]},
+		{Host: "h2", Service: hosts[0].Services[0]},
+	}
+	if err != nil || !reflect.DeepEqual(svcs, expected) {
+		t.Errorf("LookupServices(port = 22) = %v, %v; want %v, <nil>", svcs, err, expected)
+	}
+
+	svcs, err = s.LookupServices(ast.Cmp{Op: ast.EQ, Left: ast.Typed{Type: ast.Host, Expr: ast.Attr("architecture")}, Right: ast.Const{Value: "amd64"}})
+	if err != nil || len(svcs) != 2 || svcs[0].Name != "ssh" || svcs[1].Name != "www" {
+		t.Errorf("LookupServices(host.architecture = amd64) = %v, %v; want h1.ssh, h1.www", svcs, err)
+	}
+
+	metrics, err := s.LookupMetrics(ast.Unary{Op: ast.IsTrue, Expr: ast.FieldTimeseries})
+	if err != nil || len(metrics) != 1 || metrics[0].Host != "h1" || metrics[0].Name != "load/load" {
+		t.Errorf("LookupMetrics(timeseries IS TRUE) = %v, %v; want h1.load/load", metrics, err)
+	}
+
+	metrics, err = s.LookupMetrics(nil)
+	if err != nil || len(metrics) != 2 || metrics[0].Name != "cpu/idle" {
+		t.Errorf("LookupMetrics(<nil>) = %v, %v; want h1.cpu/idle, h1.load/load", metrics, err)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,141 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package mirror
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+// An EventType describes the kind of an inventory change.
+type EventType int
+
+// Types of events.
+const (
+	HostAdded EventType = iota + 1
+	HostRemoved
+	// HostStale indicates that a host has not been updated for longer
+	// than the StaleAfter period of the mirror.
+	HostStale
+	ServiceAdded
+	ServiceRemoved
+	MetricAdded
+	MetricRemoved
+	AttributeAdded
+	AttributeChanged
+	AttributeRemoved
+)
+
+var eventTypeNames = map[EventType]string{
+	HostAdded:        "HostAdded",
+	HostRemoved:      "HostRemoved",
+	HostStale:        "HostStale",
+	ServiceAdded:     "ServiceAdded",
+	ServiceRemoved:   "ServiceRemoved",
+	MetricAdded:      "MetricAdded",
+	MetricRemoved:    "MetricRemoved",
+	AttributeAdded:   "AttributeAdded",
+	AttributeChanged: "AttributeChanged",
+	AttributeRemoved: "AttributeRemoved",
+}
+
+// String returns the name of the event type.
+func (t EventType) String() string {
+	if s, ok := eventTypeNames[t]; ok {
+		return s
+	}
+	return fmt.Sprintf("EventType(%d)", int(t))
+}
+
+// An Event describes a change of the inventory between two syncs.
+type Event struct {
+	Type EventType
+	// Time is the time of the sync which detected the change.
+	Time time.Time
+	// Change identifies the affected object and, for attributes, includes
+	// the old and new values. For HostStale events, only the host name is
+	// set.
+	Change sysdb.Change
+}
+
+// String returns a textual description of the event.
+func (e Event) String() string {
+	if e.Type == HostStale {
+		return fmt.Sprintf("%s %s", e.Type, e.Change.Host)
+	}
+	return fmt.Sprintf("%s: %s", e.Type, e.Change)
+}
+
+type changeKey struct {
+	typ  string
+	kind sysdb.ChangeKind
+}
+
+var changeEvents = map[changeKey]EventType{
+	{"host", sysdb.Added}:        HostAdded,
+	{"host", sysdb.Removed}:      HostRemoved,
+	{"service", sysdb.Added}:     ServiceAdded,
+	{"service", sysdb.Removed}:   ServiceRemoved,
+	{"metric", sysdb.Added}:      MetricAdded,
+	{"metric", sysdb.Removed}:    MetricRemoved,
+	{"attribute", sysdb.Added}:   AttributeAdded,
+	{"attribute", sysdb.Changed}: AttributeChanged,
+	{"attribute", sysdb.Removed}: AttributeRemoved,
+}
+
+// events returns the events describing the changes from old to new. Hosts
+// are stale if they have not been updated within staleAfter before the time
+// of the respective snapshot; zero disables stale events.
+func events(old, new *Snapshot, staleAfter time.Duration) []Event {
+	var res []Event
+	for _, c := range sysdb.DiffHosts(old.Store.Hosts(), new.Store.Hosts()) {
+		if typ, ok := changeEvents[changeKey{c.Type, c.Kind}]; ok {
+			res = append(res, Event{Type: typ, Time: new.Time, Change: c})
+		}
+	}
+	if staleAfter <= 0 {
+		return res
+	}
+	for _, h := range new.Store.Hosts() {
+		if !stale(h, new.Time, staleAfter) {
+			continue
+		}
+		// Report hosts only once when they become stale.
+		if prev, ok := old.Store.Host(h.Name); ok && stale(prev, old.Time, staleAfter) {
+			continue
+		}
+		res = append(res, Event{Type: HostStale, Time: new.Time, Change: sysdb.Change{Type: "host", Host: h.Name}})
+	}
+	return res
+}
+
+func stale(h sysdb.Host, now time.Time, staleAfter time.Duration) bool {
+	return now.Sub(time.Time(h.LastUpdate)) > staleAfter
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,120 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package mirror
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sysdb/go/client/clienttest"
+	"github.com/sysdb/go/sysdb"
+)
+
+func TestEvents(t *testing.T) {
+	defer func(f func() time.Time) { now = f }(now)
+	clock := time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC)
+	now = func() time.Time { return clock }
+
+	fresh := sysdb.Time(clock)
+	recent := sysdb.Time(clock.Add(-30 * time.Minute))
+	old := sysdb.Time(clock.Add(-90 * time.Minute))
+	f := clienttest.NewFake()
+	setHosts(f,
+		sysdb.Host{Name: "h1", LastUpdate: recent, Attributes: []sysdb.Attribute{{Name: "os", Value: "linux"}}},
+		sysdb.Host{Name: "h2", LastUpdate: fresh, Services: []sysdb.Service{{Name: "ssh"}}},
+		sysdb.Host{Name: "h3", LastUpdate: old},
+	)
+
+	ch := make(chan Event, 100)
+	m := &Mirror{Client: f, Events: ch, StaleAfter: time.Hour}
+	if err := m.Sync(context.Background()); err != nil {
+		t.Fatalf("Sync() = %v", err)
+	}
+	if len(ch) != 0 {
+		t.Errorf("Sync() sent %d events on first sync; want 0", len(ch))
+	}
+
+	clock = clock.Add(45 * time.Minute)
+	setHosts(f,
+		sysdb.Host{Name: "h1", LastUpdate: recent, Attributes: []sysdb.Attribute{{Name: "os", Value: "bsd"}}},
+		sysdb.Host{Name: "h2", LastUpdate: sysdb.Time(clock), Metrics: []sysdb.Metric{{Name: "load"}}},
+		sysdb.Host{Name: "h3", LastUpdate: old},
+		sysdb.Host{Name: "h4", LastUpdate: sysdb.Time(clock)},
+	)
+	if err := m.Sync(context.Background()); err != nil {
+		t.Fatalf("Sync() = %v", err)
+	}
+	close(ch)
+	var got []string
+	for e := range ch {
+		if !e.Time.Equal(clock) {
+			t.Errorf("Event.Time = %v; want %v", e.Time, clock)
+		}
+		got = append(got, e.String())
+	}
+	// h3 was stale before already; h1 became stale during this sync.
+	expected := []string{
+		`AttributeChanged: changed attribute h1.os: "linux" -> "bsd"`,
+		`MetricAdded: added metric h2.load`,
+		`ServiceRemoved: removed service h2.ssh`,
+		`HostAdded: added host h4`,
+		`HostStale h1`,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Sync() sent events\n%q\nwant\n%q", got, expected)
+	}
+
+	// Delivery is aborted once the context is done.
+	m.Events = make(chan Event)
+	setHosts(f)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := m.Sync(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Sync(<blocked>) = %v; want %v", err, context.DeadlineExceeded)
+	}
+	if m.Snapshot().Store.Len() != 0 {
+		t.Errorf("Snapshot() not updated after undelivered events")
+	}
+}
+
+func TestEventTypeString(t *testing.T) {
+	for _, test := range []struct {
+		typ      EventType
+		expected string
+	}{
+		{HostAdded, "HostAdded"},
+		{AttributeRemoved, "AttributeRemoved"},
+		{EventType(0), "EventType(0)"},
+	} {
+		if s := test.typ.String(); s != test.expected {
+			t.Errorf("%d.String() = %q; want %q", int(test.typ), s, test.expected)
+		}
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
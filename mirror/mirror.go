@@ -0,0 +1,346 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package mirror maintains a full local copy of the SysDB store.
+//
+// A Mirror periodically lists all hosts and fetches each of them including
+// all of its children. Hosts removed between listing and fetching them are
+// skipped; any other failure fails the sweep. The result of each successful sweep is published as an immutable
+// snapshot which may be queried locally using memstore. If the server is
+// unavailable, the previous snapshot remains available:
+//
+//	m := &mirror.Mirror{Client: c, Interval: 5 * time.Minute}
+//	go m.Run(ctx)
+//	// ...
+//	if snap := m.Snapshot(); snap != nil {
+//		hosts, err := snap.Store.Lookup(matcher)
+//	}
+//
+// Changes between successive syncs may be received as typed events, allowing
+// automation to react to inventory changes:
+//
+//	events := make(chan mirror.Event)
+//	m := &mirror.Mirror{Client: c, Events: events, StaleAfter: time.Hour}
+//	go m.Run(ctx)
+//	for e := range events {
+//		if e.Type == mirror.HostAdded {
+//			// ...
+//		}
+//	}
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sysdb/go/client"
+	"github.com/sysdb/go/memstore"
+	"github.com/sysdb/go/sysdb"
+)
+
+// Default settings of a Mirror.
+const (
+	DefaultInterval    = 5 * time.Minute
+	DefaultConcurrency = 4
+)
+
+// A Snapshot is the state of the store as of a single sync.
+type Snapshot struct {
+	// Store holds all hosts including their children.
+	Store *memstore.Store
+	// Time is the time the sync finished.
+	Time time.Time
+	// Duration is the time it took to sync.
+	Duration time.Duration
+	// Tombstones lists objects which have disappeared during the
+	// retention period of the mirror. Each tombstone is last seen at the
+	// time of the last snapshot including the object. Tombstones of objects
+	// which reappear are dropped.
+	Tombstones sysdb.Tombstones
+}
+
+// Status describes the state of the synchronization.
+type Status struct {
+	// LastSync is the time of the last successful sync.
+	LastSync time.Time
+	// LastAttempt is the time of the last sync, successful or not.
+	LastAttempt time.Time
+	// LastError is the error of the last sync, if it failed.
+	LastError error
+	// Syncs and Failures count successful and failed syncs.
+	Syncs, Failures int
+}
+
+// A Mirror keeps a local copy of the store in sync with the server. A
+// Mirror must not be copied after first use.
+type Mirror struct {
+	// Client is used to query the server.
+	Client client.Interface
+	// Interval is the time between syncs. It defaults to DefaultInterval.
+	Interval time.Duration
+	// Timeout, if positive, limits the time of each sync.
+	Timeout time.Duration
+	// Concurrency is the number of hosts fetched concurrently. It
+	// defaults to DefaultConcurrency.
+	Concurrency int
+	// Retention is the time for which tombstones of removed objects are
+	// kept after the last sync which included them. Zero keeps them
+	// forever.
+	Retention sysdb.Duration
+	// ErrorLog, if not nil, is called for each failed sync.
+	ErrorLog func(err error)
+
+	// Events, if not nil, receives an event for each change detected
+	// between two successive syncs. Sync blocks until all events have been
+	// received or its context is done. The first sync does not produce any
+	// events.
+	Events chan<- Event
+	// StaleAfter, if positive, enables HostStale events for hosts which
+	// have not been updated for longer than the specified time.
+	StaleAfter time.Duration
+
+	mu     sync.RWMutex
+	snap   *Snapshot
+	status Status
+}
+
+// now returns the current time; it may be overridden for testing.
+var now = time.Now
+
+// Snapshot returns the most recent snapshot or nil if no sync has succeeded
+// yet.
+func (m *Mirror) Snapshot() *Snapshot {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.snap
+}
+
+// Status returns the current sync status.
+func (m *Mirror) Status() Status {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.status
+}
+
+// Run syncs the mirror immediately and then every interval until ctx is
+// done. It returns the error of the context. Failed syncs are reported to
+// ErrorLog and retried on the next interval.
+func (m *Mirror) Run(ctx context.Context) error {
+	interval := m.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if err := m.Sync(ctx); err != nil && ctx.Err() == nil && m.ErrorLog != nil {
+			m.ErrorLog(err)
+		}
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Sync fetches all hosts from the server and publishes a new snapshot. The
+// previous snapshot is kept if any request fails. Changes since the previous
+// snapshot are sent to the Events channel, if any.
+func (m *Mirror) Sync(ctx context.Context) error {
+	if m.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.Timeout)
+		defer cancel()
+	}
+
+	start := now()
+	hosts, err := m.fetchAll(ctx)
+	evs, err := m.publish(hosts, start, err)
+	for _, e := range evs {
+		select {
+		case m.Events <- e:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return err
+}
+
+// publish records the result of a sync and returns the resulting events.
+func (m *Mirror) publish(hosts []sysdb.Host, start time.Time, err error) ([]Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.status.LastAttempt = start
+	m.status.LastError = err
+	if err != nil {
+		m.status.Failures++
+		return nil, err
+	}
+
+	end := now()
+	snap := &Snapshot{
+		Store:    memstore.New(hosts),
+		Time:     end,
+		Duration: end.Sub(start),
+	}
+	if m.snap != nil {
+		// Removed objects were last seen by the previous sync.
+		removed := sysdb.TombstonesOf(sysdb.DiffHosts(m.snap.Store.Hosts(), snap.Store.Hosts()), sysdb.Time(m.snap.Time))
+		snap.Tombstones = append(append(sysdb.Tombstones(nil), m.snap.Tombstones...), removed...)
+	}
+	snap.Tombstones = snap.Tombstones.Revive(hosts).Retain(end, m.Retention)
+
+	var evs []Event
+	if m.snap != nil && m.Events != nil {
+		evs = events(m.snap, snap, m.StaleAfter)
+	}
+	m.snap = snap
+	m.status.LastSync = end
+	m.status.Syncs++
+	return evs, nil
+}
+
+// list lists all hosts.
+func (m *Mirror) list(ctx context.Context) ([]sysdb.Host, error) {
+	res, err := m.Client.QueryContext(ctx, "LIST hosts")
+	if err != nil {
+		return nil, err
+	}
+	list, ok := res.([]sysdb.Host)
+	if !ok {
+		return nil, sysdb.Errorf(sysdb.CodeUnexpectedMessage, "unexpected result of LIST hosts: %T", res)
+	}
+	return list, nil
+}
+
+// fetchAll lists all hosts and fetches each of them. Hosts removed after
+// listing them are skipped. The server does not tell why a request failed,
+// so hosts which cannot be fetched are considered to be removed only if
+// listing all hosts again confirms that.
+func (m *Mirror) fetchAll(ctx context.Context) ([]sysdb.Host, error) {
+	list, err := m.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	n := m.Concurrency
+	if n <= 0 {
+		n = DefaultConcurrency
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	hosts := make([]sysdb.Host, len(list))
+	found := make([]bool, len(list))
+	rejected := make([]error, len(list))
+	names := make(chan int)
+	var wg sync.WaitGroup
+	var once sync.Once
+	var ferr error
+	for w := 0; w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range names {
+				h, err := m.Client.FetchHost(ctx, list[i].Name)
+				if sysdb.ErrorCode(err) == sysdb.CodeRequestFailed && ctx.Err() == nil {
+					// The server rejected the request, possibly
+					// because the host has been removed in the meantime.
+					rejected[i] = err
+					continue
+				}
+				if err != nil {
+					once.Do(func() {
+						ferr = fmt.Errorf("fetch host %q: %w", list[i].Name, err)
+						cancel()
+					})
+					continue
+				}
+				hosts[i], found[i] = *h, true
+			}
+		}()
+	}
+loop:
+	for i := range list {
+		select {
+		case names <- i:
+		case <-ctx.Done():
+			break loop
+		}
+	}
+	close(names)
+	wg.Wait()
+	if ferr != nil {
+		return nil, ferr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := m.checkRemoved(ctx, list, rejected); err != nil {
+		return nil, err
+	}
+	fetched := hosts[:0]
+	for i, h := range hosts {
+		if found[i] {
+			fetched = append(fetched, h)
+		}
+	}
+	return fetched, nil
+}
+
+// checkRemoved lists all hosts again and returns an error if any of the hosts
+// which could not be fetched, as indicated by a non-nil error in rejected,
+// still exists.
+func (m *Mirror) checkRemoved(ctx context.Context, list []sysdb.Host, rejected []error) error {
+	n := 0
+	for _, err := range rejected {
+		if err != nil {
+			n++
+		}
+	}
+	if n == 0 {
+		return nil
+	}
+
+	current, err := m.list(ctx)
+	if err != nil {
+		return err
+	}
+	exists := make(map[string]bool, len(current))
+	for _, h := range current {
+		exists[h.Name] = true
+	}
+	for i, err := range rejected {
+		if err != nil && exists[list[i].Name] {
+			return fmt.Errorf("fetch host %q: %w", list[i].Name, err)
+		}
+	}
+	return nil
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
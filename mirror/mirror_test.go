@@ -0,0 +1,227 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package mirror
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sysdb/go/client/clienttest"
+	"github.com/sysdb/go/sysdb"
+)
+
+func setHosts(f *clienttest.Fake, hosts ...sysdb.Host) {
+	list := make([]sysdb.Host, len(hosts))
+	for i, h := range hosts {
+		list[i] = sysdb.Host{Name: h.Name, LastUpdate: h.LastUpdate}
+	}
+	f.SetResult("LIST hosts", list)
+	f.SetHosts(hosts...)
+}
+
+func TestSync(t *testing.T) {
+	defer func(f func() time.Time) { now = f }(now)
+	clock := time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC)
+	now = func() time.Time { return clock }
+
+	t1 := sysdb.Time(clock.Add(-time.Hour))
+	t2 := sysdb.Time(clock.Add(-time.Minute))
+	// h3 has not been updated for longer than the retention period.
+	t3 := sysdb.Time(clock.Add(-3 * time.Hour))
+	f := clienttest.NewFake()
+	setHosts(f,
+		sysdb.Host{Name: "h1", LastUpdate: t1, Services: []sysdb.Service{{Name: "s1", LastUpdate: t1}}},
+		sysdb.Host{Name: "h2", LastUpdate: t2, Metrics: []sysdb.Metric{{Name: "m1", LastUpdate: t2}}},
+		sysdb.Host{Name: "h3", LastUpdate: t3},
+	)
+	synced := sysdb.Time(clock)
+
+	m := &Mirror{Client: f, Concurrency: 2, Retention: sysdb.Duration(2 * time.Hour)}
+	if m.Snapshot() != nil {
+		t.Errorf("Snapshot() = %v; want <nil> before first sync", m.Snapshot())
+	}
+	if err := m.Sync(context.Background()); err != nil {
+		t.Fatalf("Sync() = %v", err)
+	}
+	snap := m.Snapshot()
+	if snap == nil || snap.Store.Len() != 3 || !snap.Time.Equal(clock) || len(snap.Tombstones) != 0 {
+		t.Fatalf("Snapshot() = %+v; want 3 hosts synced at %v", snap, clock)
+	}
+	if h, ok := snap.Store.Host("h1"); !ok || len(h.Services) != 1 {
+		t.Errorf("Store.Host(h1) = %+v, %v; want h1 including services", h, ok)
+	}
+
+	// Failed syncs keep the previous snapshot.
+	failed := errors.New("connection refused")
+	f.SetError("LIST hosts", failed)
+	clock = clock.Add(time.Minute)
+	if err := m.Sync(context.Background()); err != failed {
+		t.Errorf("Sync(<failing>) = %v; want %v", err, failed)
+	}
+	if m.Snapshot() != snap {
+		t.Errorf("Snapshot() changed after failed sync")
+	}
+	st := m.Status()
+	if st.Syncs != 1 || st.Failures != 1 || st.LastError != failed ||
+		!st.LastAttempt.Equal(clock) || !st.LastSync.Equal(clock.Add(-time.Minute)) {
+		t.Errorf("Status() = %+v; want one sync and one failure", st)
+	}
+
+	// Removed objects are recorded as tombstones, last seen by the previous
+	// successful sync, even if they have not been updated for longer than
+	// the retention period.
+	setHosts(f,
+		sysdb.Host{Name: "h1", LastUpdate: t1},
+		sysdb.Host{Name: "h2", LastUpdate: t2, Metrics: []sysdb.Metric{{Name: "m1", LastUpdate: t2}}},
+	)
+	if err := m.Sync(context.Background()); err != nil {
+		t.Fatalf("Sync() = %v", err)
+	}
+	expected := sysdb.Tombstones{
+		{Type: "service", Host: "h1", Name: "s1", LastSeen: synced},
+		{Type: "host", Name: "h3", LastSeen: synced},
+	}
+	if got := m.Snapshot().Tombstones; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Tombstones = %+v; want %+v", got, expected)
+	}
+	if len(snap.Tombstones) != 0 {
+		t.Errorf("previous snapshot modified: %+v", snap.Tombstones)
+	}
+
+	// Tombstones of objects which reappear are dropped.
+	clock = clock.Add(time.Minute)
+	setHosts(f,
+		sysdb.Host{Name: "h1", LastUpdate: t1},
+		sysdb.Host{Name: "h2", LastUpdate: t2, Metrics: []sysdb.Metric{{Name: "m1", LastUpdate: t2}}},
+		sysdb.Host{Name: "h3", LastUpdate: sysdb.Time(clock)},
+	)
+	if err := m.Sync(context.Background()); err != nil {
+		t.Fatalf("Sync() = %v", err)
+	}
+	if got := m.Snapshot().Tombstones; !reflect.DeepEqual(got, expected[:1]) {
+		t.Errorf("Tombstones = %+v; want %+v", got, expected[:1])
+	}
+
+	// Tombstones expire after the retention period.
+	clock = time.Time(synced).Add(2*time.Hour + time.Second)
+	if err := m.Sync(context.Background()); err != nil {
+		t.Fatalf("Sync() = %v", err)
+	}
+	if got := m.Snapshot().Tombstones; len(got) != 0 {
+		t.Errorf("Tombstones = %+v; want none", got)
+	}
+
+	// Hosts which cannot be fetched but are still listed fail the sync.
+	before := m.Snapshot()
+	f.SetResult("LIST hosts", []sysdb.Host{{Name: "h1"}, {Name: "rejected"}})
+	if err := m.Sync(context.Background()); sysdb.ErrorCode(err) != sysdb.CodeRequestFailed {
+		t.Errorf("Sync(<rejected host>) = %v; want code %s", err, sysdb.CodeRequestFailed)
+	}
+	if snap := m.Snapshot(); snap != before {
+		t.Errorf("Sync(<rejected host>) published a new snapshot")
+	}
+	f.SetResult("LIST hosts", sysdb.ServiceList{})
+	if err := m.Sync(context.Background()); sysdb.ErrorCode(err) != sysdb.CodeUnexpectedMessage {
+		t.Errorf("Sync(<unexpected result>) = %v; want code %s", err, sysdb.CodeUnexpectedMessage)
+	}
+}
+
+// churnClient modifies the store while the mirror fetches hosts.
+type churnClient struct {
+	*clienttest.Fake
+	fetch func(name string) error
+}
+
+func (c *churnClient) FetchHost(ctx context.Context, name string) (*sysdb.Host, error) {
+	if err := c.fetch(name); err != nil {
+		return nil, err
+	}
+	return c.Fake.FetchHost(ctx, name)
+}
+
+func TestSyncChurn(t *testing.T) {
+	f := clienttest.NewFake()
+	setHosts(f, sysdb.Host{Name: "h1"}, sysdb.Host{Name: "h2"}, sysdb.Host{Name: "h3"})
+	c := &churnClient{Fake: f}
+	m := &Mirror{Client: c, Concurrency: 1}
+
+	// h2 is deleted while fetching h1.
+	c.fetch = func(name string) error {
+		if name == "h1" {
+			setHosts(f, sysdb.Host{Name: "h1"}, sysdb.Host{Name: "h3"})
+		}
+		return nil
+	}
+	if err := m.Sync(context.Background()); err != nil {
+		t.Fatalf("Sync(<churn>) = %v; want <nil>", err)
+	}
+	var names []string
+	for _, h := range m.Snapshot().Store.Hosts() {
+		names = append(names, h.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"h1", "h3"}) {
+		t.Errorf("Snapshot() = %v; want [h1 h3]", names)
+	}
+
+	// Any other failure fails the sync.
+	failed := errors.New("connection reset")
+	c.fetch = func(name string) error {
+		if name == "h3" {
+			return failed
+		}
+		return nil
+	}
+	if err := m.Sync(context.Background()); !errors.Is(err, failed) {
+		t.Errorf("Sync(<failing fetch>) = %v; want %v", err, failed)
+	}
+	if st := m.Status(); st.Syncs != 1 || st.Failures != 1 {
+		t.Errorf("Status() = %+v; want one sync and one failure", st)
+	}
+}
+
+func TestRun(t *testing.T) {
+	f := clienttest.NewFake()
+	setHosts(f, sysdb.Host{Name: "h1"})
+	errs := make(chan error, 100)
+	m := &Mirror{Client: f, Interval: 5 * time.Millisecond, ErrorLog: func(err error) { errs <- err }}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := m.Run(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Run() = %v; want %v", err, context.DeadlineExceeded)
+	}
+	if st := m.Status(); st.Syncs < 2 || m.Snapshot().Store.Len() != 1 {
+		t.Errorf("Status() = %+v; want multiple successful syncs", st)
+	}
+	if len(errs) != 0 {
+		t.Errorf("ErrorLog called: %v", <-errs)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
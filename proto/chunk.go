@@ -0,0 +1,129 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package proto
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+// A ChunkWriter writes a list of objects as a sequence of DATA chunks (see
+// ConnectionDataChunk), allowing servers to stream large results without
+// building them in memory. Handlers of a Server may write chunks to the
+// session's connection and return a nil message to terminate the result
+// with ConnectionOK.
+type ChunkWriter struct {
+	w    io.Writer
+	cmd  Status
+	size int
+	buf  []json.RawMessage
+}
+
+// NewChunkWriter returns a writer sending the reply to a command of type cmd
+// to w in chunks of up to size objects.
+func NewChunkWriter(w io.Writer, cmd Status, size int) *ChunkWriter {
+	if size < 1 {
+		size = 1
+	}
+	return &ChunkWriter{w: w, cmd: cmd, size: size}
+}
+
+// Write adds the JSON encoding of v to the result, sending a chunk once it is
+// full.
+func (cw *ChunkWriter) Write(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return sysdb.Errorf(sysdb.CodeInvalidArgument, "failed to marshal object: %v", err)
+	}
+	cw.buf = append(cw.buf, data)
+	if len(cw.buf) >= cw.size {
+		return cw.Flush()
+	}
+	return nil
+}
+
+// Flush sends all buffered objects as a chunk.
+func (cw *ChunkWriter) Flush() error {
+	if len(cw.buf) == 0 {
+		return nil
+	}
+	m, err := Marshal(cw.cmd, cw.buf)
+	if err != nil {
+		return err
+	}
+	m.Type = ConnectionDataChunk
+	cw.buf = cw.buf[:0]
+	return Write(cw.w, m)
+}
+
+// Close flushes any buffered objects. It does not send the terminating
+// ConnectionOK message which is up to the caller (or the Server).
+func (cw *ChunkWriter) Close() error {
+	return cw.Flush()
+}
+
+// Elements returns the JSON encoded objects of a DATA message or chunk. The
+// result of commands returning a single object is returned as a list of one
+// element.
+func Elements(m *Message) ([]json.RawMessage, error) {
+	if m.Type != ConnectionData && m.Type != ConnectionDataChunk {
+		return nil, sysdb.Errorf(sysdb.CodeUnexpectedMessage, "message is not of type DATA")
+	}
+	if len(m.Raw) < 4 {
+		return nil, sysdb.Errorf(sysdb.CodeMalformedMessage, "DATA message body too short")
+	}
+	data := bytes.TrimSpace(m.Raw[4:])
+	if len(data) == 0 || data[0] != '[' {
+		return []json.RawMessage{json.RawMessage(data)}, nil
+	}
+	var elems []json.RawMessage
+	if err := json.Unmarshal(data, &elems); err != nil {
+		return nil, sysdb.Errorf(sysdb.CodeMalformedMessage, "failed to unmarshal DATA message: %v", err)
+	}
+	return elems, nil
+}
+
+// MergeChunks returns a single DATA message carrying the objects of all
+// chunks.
+func MergeChunks(chunks []*Message) (*Message, error) {
+	if len(chunks) == 0 {
+		return nil, sysdb.Errorf(sysdb.CodeInvalidArgument, "no chunks to merge")
+	}
+	all := []json.RawMessage{}
+	for _, c := range chunks {
+		elems, err := Elements(c)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, elems...)
+	}
+	return Marshal(Status(nbo.Uint32(chunks[0].Raw[:4])), all)
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,159 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package proto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+// A DeadlineReader is a reader supporting read deadlines (e.g. a net.Conn).
+type DeadlineReader interface {
+	io.Reader
+	SetReadDeadline(t time.Time) error
+}
+
+// An InterruptedError is returned by ReadContext if the read was aborted
+// after part of a message had been consumed. The connection is out of sync
+// and has to be closed.
+type InterruptedError struct {
+	// N is the number of bytes of the message consumed before the read was
+	// aborted.
+	N   int
+	Err error
+}
+
+// Error implements the error interface.
+func (e *InterruptedError) Error() string {
+	return fmt.Sprintf("read interrupted after %d bytes: %v", e.N, e.Err)
+}
+
+// Unwrap returns the error of the context that aborted the read.
+func (e *InterruptedError) Unwrap() error { return e.Err }
+
+// A countingReader counts the bytes read from the underlying reader.
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += n
+	return n, err
+}
+
+// ReadContext is like Read but aborts the read once ctx is done by setting a
+// read deadline in the past rather than closing r. The deadline is reset
+// before returning.
+//
+// If the read was aborted before any data was consumed, ctx.Err() is
+// returned and r may still be used to read the next message. Otherwise, an
+// *InterruptedError is returned and r is out of sync. Use a Conn to resume
+// reading interrupted messages instead. Errors not caused by aborting the
+// read, for example a *FramingError or io.EOF, are returned as is, even if
+// ctx is done.
+func ReadContext(ctx context.Context, r DeadlineReader) (*Message, error) {
+	cr := &countingReader{r: r}
+	m, interrupted, err := interruptible(ctx, r, func() (*Message, error) { return Read(cr) })
+	if !interrupted || err == nil {
+		return m, err
+	}
+	if cr.n > 0 {
+		return nil, &InterruptedError{N: cr.n, Err: ctx.Err()}
+	}
+	return nil, ctx.Err()
+}
+
+// interruptible calls read, aborting it once ctx is done by setting a read
+// deadline on r in the past. It reports whether the read has been aborted,
+// that is, whether it failed due to the deadline.
+func interruptible(ctx context.Context, r DeadlineReader, read func() (*Message, error)) (*Message, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, true, err
+	}
+
+	interrupted := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		defer close(interrupted)
+		r.SetReadDeadline(time.Unix(1, 0))
+	})
+
+	m, err := read()
+	if stop() {
+		return m, false, err
+	}
+
+	<-interrupted
+	r.SetReadDeadline(time.Time{})
+	// The message may have been read completely or failed for a different
+	// reason before the deadline applied.
+	return m, err != nil && isTimeout(err), err
+}
+
+// isTimeout reports whether err is caused by an expired deadline.
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.Is(err, os.ErrDeadlineExceeded) || (errors.As(err, &ne) && ne.Timeout())
+}
+
+// A Conn is a network connection for exchanging messages. Reads may be
+// aborted using a context without losing the part of a message read so far
+// (see Reader).
+type Conn struct {
+	net.Conn
+
+	r *Reader
+}
+
+// NewConn returns a Conn for exchanging messages on c.
+func NewConn(c net.Conn) *Conn {
+	return &Conn{Conn: c, r: NewReader(c)}
+}
+
+// ReadMessage reads the next message from the connection. It returns
+// ctx.Err() if ctx is done before the message has been read completely, in
+// which case the next call continues reading the same message. Other errors
+// are returned as is.
+func (c *Conn) ReadMessage(ctx context.Context) (*Message, error) {
+	m, interrupted, err := interruptible(ctx, c.Conn, c.r.ReadMessage)
+	if interrupted && err != nil {
+		return nil, ctx.Err()
+	}
+	return m, err
+}
+
+// WriteMessage writes m to the connection. See Write.
+func (c *Conn) WriteMessage(m *Message) error {
+	return Write(c.Conn, m)
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
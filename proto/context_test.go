@@ -0,0 +1,130 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package proto
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestReadContext(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if m, err := ReadContext(ctx, client); err != context.DeadlineExceeded {
+		t.Fatalf("ReadContext(<idle>) = %v, %v; want <nil>, %v", m, err, context.DeadlineExceeded)
+	}
+
+	// The connection is still in sync.
+	want := &Message{Type: ConnectionData, Raw: []byte("abcd")}
+	go Write(server, want)
+	if m, err := ReadContext(context.Background(), client); err != nil || m.Type != want.Type || string(m.Raw) != string(want.Raw) {
+		t.Fatalf("ReadContext() = %v, %v; want %v, <nil>", m, err, want)
+	}
+
+	// Send the header only.
+	go server.Write([]byte{0, 0, 0, 100, 0, 0, 0, 4})
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	m, err := ReadContext(ctx, client)
+	var ie *InterruptedError
+	if !errors.As(err, &ie) || ie.N != 8 || !errors.Is(err, context.Canceled) {
+		t.Errorf("ReadContext(<partial>) = %v, %v; want <nil>, <interrupted after 8 bytes>", m, err)
+	}
+}
+
+func TestConn(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	c := NewConn(client)
+
+	// Send the header only.
+	go server.Write([]byte{0, 0, 0, 100, 0, 0, 0, 4})
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if m, err := c.ReadMessage(ctx); err != context.Canceled {
+		t.Fatalf("ReadMessage(<partial>) = %v, %v; want <nil>, %v", m, err, context.Canceled)
+	}
+
+	// Reading resumes with the body.
+	go server.Write([]byte("abcd"))
+	if m, err := c.ReadMessage(context.Background()); err != nil || m.Type != ConnectionData || string(m.Raw) != "abcd" {
+		t.Errorf("ReadMessage(<resumed>) = %v, %v; want DATA \"abcd\", <nil>", m, err)
+	}
+
+	go Read(server)
+	if err := c.WriteMessage(&Message{Type: ConnectionPing}); err != nil {
+		t.Errorf("WriteMessage(PING) = %v; want <nil>", err)
+	}
+}
+
+// eofOnDeadline is a connection whose reads fail with io.EOF once a read
+// deadline is set, as if the peer closed the connection while the read was
+// being aborted.
+type eofOnDeadline struct {
+	net.Conn
+	deadline chan struct{}
+}
+
+func newEOFOnDeadline() *eofOnDeadline {
+	return &eofOnDeadline{deadline: make(chan struct{})}
+}
+
+func (c *eofOnDeadline) Read(p []byte) (int, error) {
+	<-c.deadline
+	return 0, io.EOF
+}
+
+func (c *eofOnDeadline) SetReadDeadline(t time.Time) error {
+	if !t.IsZero() {
+		close(c.deadline)
+	}
+	return nil
+}
+
+func TestReadContextOtherErrors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if m, err := ReadContext(ctx, newEOFOnDeadline()); err != io.EOF {
+		t.Errorf("ReadContext(<EOF>) = %v, %v; want <nil>, %v", m, err, io.EOF)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if m, err := NewConn(newEOFOnDeadline()).ReadMessage(ctx); err != io.EOF {
+		t.Errorf("ReadMessage(<EOF>) = %v, %v; want <nil>, %v", m, err, io.EOF)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
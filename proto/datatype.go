@@ -0,0 +1,135 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package proto
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+// A DataTypeFactory returns a pointer to a new value which DATA messages of
+// a registered data type may be unmarshaled into.
+type DataTypeFactory func() interface{}
+
+type dataTypeInfo struct {
+	name string
+	new  DataTypeFactory
+}
+
+var registry = struct {
+	sync.RWMutex
+	byCmd  map[Status]DataType
+	byType map[DataType]dataTypeInfo
+	next   DataType
+}{
+	byCmd:  make(map[Status]DataType),
+	byType: make(map[DataType]dataTypeInfo),
+	next:   MetricList + 1,
+}
+
+// builtinCommands are the commands replying with built-in data types.
+var builtinCommands = map[Status]bool{
+	ConnectionList:       true,
+	ConnectionLookup:     true,
+	ConnectionFetch:      true,
+	ConnectionTimeseries: true,
+}
+
+// RegisterDataType registers a new data type called name for DATA replies to
+// commands of type cmd, allowing to decode replies to commands not known to
+// this package. The factory f returns values to unmarshal the data into (see
+// DataType.New). It returns the new data type. Registering a data type for a
+// command which already has one or using the name of an existing data type
+// fails with an error of code sysdb.CodeInvalidArgument.
+func RegisterDataType(cmd Status, name string, f DataTypeFactory) (DataType, error) {
+	if f == nil {
+		return 0, sysdb.Errorf(sysdb.CodeInvalidArgument, "missing factory for data type %q", name)
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+	for _, n := range dataTypeNames {
+		if strings.EqualFold(n, name) {
+			return 0, sysdb.Errorf(sysdb.CodeInvalidArgument, "data type %q already registered", name)
+		}
+	}
+	for _, info := range registry.byType {
+		if strings.EqualFold(info.name, name) {
+			return 0, sysdb.Errorf(sysdb.CodeInvalidArgument, "data type %q already registered", name)
+		}
+	}
+	if _, ok := registry.byCmd[cmd]; ok || builtinCommands[cmd] {
+		return 0, sysdb.Errorf(sysdb.CodeInvalidArgument, "data type for command %s already registered", cmd.CommandString())
+	}
+	t := registry.next
+	registry.next++
+	registry.byCmd[cmd] = t
+	registry.byType[t] = dataTypeInfo{name: name, new: f}
+	return t, nil
+}
+
+// New returns a pointer to a new value which data of the registered type t
+// may be unmarshaled into. It returns nil for built-in or unknown types.
+func (t DataType) New() interface{} {
+	registry.RLock()
+	defer registry.RUnlock()
+	if info, ok := registry.byType[t]; ok {
+		return info.new()
+	}
+	return nil
+}
+
+// registeredType returns the data type registered for replies to cmd.
+func registeredType(cmd Status) (DataType, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	t, ok := registry.byCmd[cmd]
+	return t, ok
+}
+
+// registeredName returns the name of the registered data type t.
+func registeredName(t DataType) (string, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	info, ok := registry.byType[t]
+	return info.name, ok
+}
+
+// parseRegistered returns the registered data type called name.
+func parseRegistered(name string) (DataType, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	for t, info := range registry.byType {
+		if strings.EqualFold(info.name, name) {
+			return t, true
+		}
+	}
+	return 0, false
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,93 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package proto
+
+import (
+	"testing"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+// unregisterDataType removes the registered data type t such that tests
+// registering data types may run repeatedly.
+func unregisterDataType(t DataType) {
+	registry.Lock()
+	defer registry.Unlock()
+	for cmd, typ := range registry.byCmd {
+		if typ == t {
+			delete(registry.byCmd, cmd)
+		}
+	}
+	delete(registry.byType, t)
+}
+
+func TestRegisterDataType(t *testing.T) {
+	type stats struct{ Hosts int }
+	cmd := Status(4711)
+	typ, err := RegisterDataType(cmd, "Stats", func() interface{} { return new(stats) })
+	if err != nil {
+		t.Fatalf("RegisterDataType(4711, Stats) = %v", err)
+	}
+	t.Cleanup(func() { unregisterDataType(typ) })
+
+	for _, test := range []struct {
+		cmd  Status
+		name string
+	}{
+		{cmd, "OtherStats"},
+		{ConnectionFetch, "Other"},
+		{Status(4712), "stats"},
+		{Status(4712), "HostList"},
+	} {
+		if _, err := RegisterDataType(test.cmd, test.name, func() interface{} { return new(int) }); sysdb.ErrorCode(err) != sysdb.CodeInvalidArgument {
+			t.Errorf("RegisterDataType(%d, %s) = %v; want <error %v>", test.cmd, test.name, err, sysdb.CodeInvalidArgument)
+		}
+	}
+	if _, err := RegisterDataType(Status(4712), "Nil", nil); sysdb.ErrorCode(err) != sysdb.CodeInvalidArgument {
+		t.Errorf("RegisterDataType(<nil factory>) = %v; want <error %v>", err, sysdb.CodeInvalidArgument)
+	}
+
+	if got := typ.String(); got != "Stats" {
+		t.Errorf("%d.String() = %q; want \"Stats\"", int(typ), got)
+	}
+	if got, err := ParseDataType("stats"); err != nil || got != typ {
+		t.Errorf("ParseDataType(stats) = %v, %v; want %v, <nil>", got, err, typ)
+	}
+
+	m := &Message{Type: ConnectionData, Raw: append([]byte{0, 0, 0x12, 0x67}, `{"Hosts":3}`...)}
+	if got, err := m.DataType(); err != nil || got != typ {
+		t.Fatalf("DataType() = %v, %v; want %v, <nil>", got, err, typ)
+	}
+	v := typ.New()
+	if err := Unmarshal(m, v); err != nil || v.(*stats).Hosts != 3 {
+		t.Errorf("Unmarshal(%v) = %v, %v; want {3}, <nil>", m, v, err)
+	}
+	if v := Host.New(); v != nil {
+		t.Errorf("Host.New() = %v; want <nil>", v)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,97 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package proto
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+// A FramingError is returned when reading a frame with an implausible header,
+// that is, of an unknown type or claiming a body larger than the maximum
+// message size. The body has not been read.
+//
+// If the type is known and only the size exceeds the limit, the error wraps
+// a *MessageTooLargeError and the connection may be resynchronized by
+// discarding the body using Drain. Otherwise, the stream is most likely
+// corrupt and the length cannot be trusted, so the connection has to be
+// closed.
+type FramingError struct {
+	Type Status
+	Size int
+	Err  error
+}
+
+// Error implements the error interface.
+func (e *FramingError) Error() string {
+	return fmt.Sprintf("invalid frame (type %d, %d bytes): %v", uint32(e.Type), e.Size, e.Err)
+}
+
+// Unwrap returns the cause of the error.
+func (e *FramingError) Unwrap() error { return e.Err }
+
+// Recoverable reports whether the stream may be resynchronized by draining
+// the body of the frame.
+func (e *FramingError) Recoverable() bool {
+	_, ok := e.Err.(*MessageTooLargeError)
+	return ok
+}
+
+// Drain discards the body of the frame from r, the reader returning the
+// error, such that the next message may be read. It fails if the error is
+// not recoverable.
+func (e *FramingError) Drain(r io.Reader) error {
+	if !e.Recoverable() {
+		return sysdb.Errorf(sysdb.CodeMalformedMessage, "cannot resynchronize after %v", e)
+	}
+	_, err := io.CopyN(io.Discard, r, int64(e.Size))
+	return unexpectedEOF(err)
+}
+
+var errUnknownFrame = sysdb.Errorf(sysdb.CodeMalformedMessage, "unknown message type")
+
+// known reports whether s is a known reply status or command.
+func (s Status) known() bool {
+	_, isStatus := statusNames[s]
+	_, isCommand := commandNames[s]
+	return isStatus || isCommand
+}
+
+// checkHeader checks the plausibility of a frame header. Unknown types are
+// accepted if anyType is true.
+func checkHeader(typ Status, size uint32, max int, anyType bool) error {
+	if !anyType && !typ.known() {
+		return &FramingError{Type: typ, Size: int(size), Err: errUnknownFrame}
+	}
+	if uint64(size) > uint64(max) {
+		return &FramingError{Type: typ, Size: int(size), Err: &MessageTooLargeError{Type: typ, Size: int(size), Max: max}}
+	}
+	return nil
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
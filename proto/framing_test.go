@@ -0,0 +1,78 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package proto
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+func TestFramingError(t *testing.T) {
+	var buf bytes.Buffer
+	Write(&buf, &Message{Type: ConnectionQuery, Raw: bytes.Repeat([]byte("x"), 10)})
+	Write(&buf, &Message{Type: ConnectionPing})
+	Write(&buf, &Message{Type: Status(4711), Raw: []byte("abc")})
+	Write(&buf, &Message{Type: ConnectionPing})
+	r := bytes.NewReader(buf.Bytes())
+
+	m, err := ReadLimit(r, 5)
+	var fe *FramingError
+	if !errors.As(err, &fe) || !fe.Recoverable() || fe.Size != 10 || sysdb.ErrorCode(err) != sysdb.CodeTooLarge {
+		t.Fatalf("ReadLimit(<10 bytes>, 5) = %v, %v; want <recoverable framing error>", m, err)
+	}
+	var tle *MessageTooLargeError
+	if !errors.As(err, &tle) || tle.Max != 5 {
+		t.Errorf("ReadLimit(<10 bytes>, 5) = %v; want <message too large>", err)
+	}
+	if err := fe.Drain(r); err != nil {
+		t.Fatalf("Drain() = %v", err)
+	}
+	if m, err := Read(r); err != nil || m.Type != ConnectionPing {
+		t.Errorf("Read(<after drain>) = %v, %v; want PING, <nil>", m, err)
+	}
+
+	m, err = Read(r)
+	if !errors.As(err, &fe) || fe.Recoverable() || fe.Type != Status(4711) || sysdb.ErrorCode(err) != sysdb.CodeMalformedMessage {
+		t.Fatalf("Read(<unknown type>) = %v, %v; want <unrecoverable framing error>", m, err)
+	}
+	if err := fe.Drain(r); sysdb.ErrorCode(err) != sysdb.CodeMalformedMessage {
+		t.Errorf("Drain(<unknown type>) = %v; want <error %v>", err, sysdb.CodeMalformedMessage)
+	}
+
+	// A Reader does not continue after unrecoverable errors.
+	rd := NewReader(bytes.NewReader(buf.Bytes()[26:]))
+	if _, err := rd.ReadMessage(); !errors.As(err, &fe) || fe.Recoverable() {
+		t.Fatalf("ReadMessage(<unknown type>) = %v; want <unrecoverable framing error>", err)
+	}
+	if m, err := rd.ReadMessage(); err != fe {
+		t.Errorf("ReadMessage(<after unknown type>) = %v, %v; want <nil>, %v", m, err, fe)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,127 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package proto
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+// A HostDecoder reads a JSON list of hosts (as returned by LIST and LOOKUP
+// commands) and decodes one host at a time. Unlike unmarshaling the whole
+// list, only a single decoded host has to be held in memory at any time.
+type HostDecoder struct {
+	dec     *json.Decoder
+	started bool
+	err     error
+}
+
+// NewHostDecoder returns a decoder reading a JSON list of hosts from r.
+func NewHostDecoder(r io.Reader) *HostDecoder {
+	return &HostDecoder{dec: json.NewDecoder(r)}
+}
+
+// Next decodes the next host of the list into h. It returns io.EOF after the
+// last host. Any other error is sticky; the decoder must not be used
+// afterwards.
+func (d *HostDecoder) Next(h *sysdb.Host) error {
+	if d.err != nil {
+		return d.err
+	}
+	if d.err = d.next(h); d.err == io.EOF {
+		return io.EOF
+	} else if d.err != nil {
+		d.err = sysdb.Errorf(sysdb.CodeMalformedMessage, "failed to decode host list: %v", d.err)
+	}
+	return d.err
+}
+
+func (d *HostDecoder) next(h *sysdb.Host) error {
+	if !d.started {
+		t, err := d.dec.Token()
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		} else if err != nil {
+			return err
+		}
+		if t != json.Delim('[') {
+			return sysdb.Errorf(sysdb.CodeMalformedMessage, "expected list, got %v", t)
+		}
+		d.started = true
+	}
+
+	if !d.dec.More() {
+		// consume the closing bracket
+		if _, err := d.dec.Token(); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		if _, err := d.dec.Token(); err != io.EOF {
+			return sysdb.Errorf(sysdb.CodeMalformedMessage, "trailing data after host list")
+		}
+		return io.EOF
+	}
+
+	*h = sysdb.Host{}
+	return d.dec.Decode(h)
+}
+
+// DecodeHosts decodes the hosts carried by the DATA message (or chunk) m
+// one at a time and passes each of them to fn. It stops at the first error
+// returned by fn and returns that error. The host passed to fn is reused for
+// the next host, so fn must copy it if it has to be retained. An empty DATA
+// message (as returned by empty commands) carries no hosts.
+func DecodeHosts(m *Message, fn func(*sysdb.Host) error) error {
+	if m.Type != ConnectionData && m.Type != ConnectionDataChunk {
+		return sysdb.Errorf(sysdb.CodeUnexpectedMessage, "message is not of type DATA")
+	}
+	if len(m.Raw) == 0 {
+		return nil
+	} else if len(m.Raw) < 4 {
+		return sysdb.Errorf(sysdb.CodeMalformedMessage, "DATA message body too short")
+	}
+
+	d := NewHostDecoder(bytes.NewReader(m.Raw[4:]))
+	var h sysdb.Host
+	for {
+		err := d.Next(&h)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := fn(&h); err != nil {
+			return err
+		}
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
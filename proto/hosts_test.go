@@ -0,0 +1,117 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package proto
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+func TestHostDecoder(t *testing.T) {
+	for _, test := range []struct {
+		data  string
+		names []string
+		err   bool
+	}{
+		{`[]`, nil, false},
+		{` [ {"name": "h1", "backends": ["b"]}, {"name": "h2", "services": [{"name": "s1"}]} ] `, []string{"h1", "h2"}, false},
+		{``, nil, true},
+		{`{"name": "h1"}`, nil, true},
+		{`[{"name": "h1"}`, []string{"h1"}, true},
+		{`[{"name": "h1"}, {"name": 1}]`, []string{"h1"}, true},
+		{`[{"name": "h1"}] [`, []string{"h1"}, true},
+	} {
+		d := NewHostDecoder(strings.NewReader(test.data))
+		var names []string
+		var err error
+		for {
+			var h sysdb.Host
+			if err = d.Next(&h); err != nil {
+				break
+			}
+			names = append(names, h.Name)
+		}
+		if err == io.EOF {
+			err = nil
+		}
+		if (err != nil) != test.err || strings.Join(names, ",") != strings.Join(test.names, ",") {
+			t.Errorf("HostDecoder(%q) = %v, %v; want %v (error: %v)", test.data, names, err, test.names, test.err)
+		}
+		if err != nil {
+			if sysdb.ErrorCode(err) != sysdb.CodeMalformedMessage {
+				t.Errorf("HostDecoder(%q) = %v; want <error %v>", test.data, err, sysdb.CodeMalformedMessage)
+			}
+			if err2 := d.Next(new(sysdb.Host)); err2 != err {
+				t.Errorf("HostDecoder(%q).Next() = %v after error; want %v", test.data, err2, err)
+			}
+		}
+	}
+}
+
+func TestDecodeHosts(t *testing.T) {
+	m, err := Marshal(ConnectionLookup, []sysdb.Host{{Name: "h1"}, {Name: "h2"}, {Name: "h3"}})
+	if err != nil {
+		t.Fatalf("Marshal() = %v", err)
+	}
+
+	var names []string
+	err = DecodeHosts(m, func(h *sysdb.Host) error {
+		names = append(names, h.Name)
+		return nil
+	})
+	if err != nil || strings.Join(names, ",") != "h1,h2,h3" {
+		t.Errorf("DecodeHosts() = %v (hosts: %v); want <nil> (hosts: [h1 h2 h3])", err, names)
+	}
+
+	stop := errors.New("stop")
+	names = nil
+	err = DecodeHosts(m, func(h *sysdb.Host) error {
+		names = append(names, h.Name)
+		if len(names) == 2 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || len(names) != 2 {
+		t.Errorf("DecodeHosts(<stop>) = %v (hosts: %v); want %v (hosts: [h1 h2])", err, names, stop)
+	}
+
+	if err := DecodeHosts(&Message{Type: ConnectionData}, nil); err != nil {
+		t.Errorf("DecodeHosts(<empty>) = %v; want <nil>", err)
+	}
+	if err := DecodeHosts(&Message{Type: ConnectionData, Raw: []byte{0}}, nil); sysdb.ErrorCode(err) != sysdb.CodeMalformedMessage {
+		t.Errorf("DecodeHosts(<short>) = %v; want <error %v>", err, sysdb.CodeMalformedMessage)
+	}
+	if err := DecodeHosts(&Message{Type: ConnectionOK}, nil); sysdb.ErrorCode(err) != sysdb.CodeUnexpectedMessage {
+		t.Errorf("DecodeHosts(OK) = %v; want <error %v>", err, sysdb.CodeUnexpectedMessage)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
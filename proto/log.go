@@ -0,0 +1,58 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package proto
+
+import "github.com/sysdb/go/sysdb"
+
+// A LogMessage is the payload of a ConnectionLog message.
+type LogMessage struct {
+	Priority sysdb.LogPriority
+	Message  string
+}
+
+// EncodeLog returns a ConnectionLog message carrying l.
+func EncodeLog(l LogMessage) *Message {
+	raw := make([]byte, 4+len(l.Message))
+	nbo.PutUint32(raw[:4], uint32(l.Priority))
+	copy(raw[4:], l.Message)
+	return &Message{Type: ConnectionLog, Raw: raw}
+}
+
+// DecodeLog decodes the payload of the ConnectionLog message m.
+func DecodeLog(m *Message) (LogMessage, error) {
+	if m.Type != ConnectionLog {
+		return LogMessage{}, sysdb.Errorf(sysdb.CodeUnexpectedMessage, "message is not of type LOG")
+	}
+	if len(m.Raw) < 4 {
+		return LogMessage{}, sysdb.Errorf(sysdb.CodeMalformedMessage, "LOG message body too short")
+	}
+	return LogMessage{
+		Priority: sysdb.LogPriority(nbo.Uint32(m.Raw[:4])),
+		Message:  string(m.Raw[4:]),
+	}, nil
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,61 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package proto
+
+import (
+	"testing"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+func TestLogCodec(t *testing.T) {
+	for _, l := range []LogMessage{
+		{sysdb.LogWarning, "careful"},
+		{sysdb.LogDebug, ""},
+	} {
+		m := EncodeLog(l)
+		if m.Type != ConnectionLog || len(m.Raw) != 4+len(l.Message) {
+			t.Errorf("EncodeLog(%v) = %v; want LOG message", l, m)
+		}
+		if got, err := DecodeLog(m); err != nil || got != l {
+			t.Errorf("DecodeLog(EncodeLog(%v)) = %v, %v; want %v, <nil>", l, got, err, l)
+		}
+	}
+
+	for _, test := range []struct {
+		m    *Message
+		code sysdb.Code
+	}{
+		{&Message{Type: ConnectionOK}, sysdb.CodeUnexpectedMessage},
+		{&Message{Type: ConnectionLog, Raw: []byte{0, 0}}, sysdb.CodeMalformedMessage},
+	} {
+		if got, err := DecodeLog(test.m); sysdb.ErrorCode(err) != test.code {
+			t.Errorf("DecodeLog(%v) = %v, %v; want <error %v>", test.m, got, err, test.code)
+		}
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,134 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package proto
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+// Names of reply statuses.
+var statusNames = map[Status]string{
+	ConnectionOK:    "OK",
+	ConnectionError: "ERROR",
+	ConnectionLog:   "LOG",
+	ConnectionData:  "DATA",
+	// Shared with EXPR.
+	ConnectionDataChunk: "DATA_CHUNK",
+}
+
+// Names of commands and connection states.
+var commandNames = map[Status]string{
+	ConnectionIdle:           "IDLE",
+	ConnectionPing:           "PING",
+	ConnectionStartup:        "STARTUP",
+	ConnectionQuery:          "QUERY",
+	ConnectionFetch:          "FETCH",
+	ConnectionList:           "LIST",
+	ConnectionLookup:         "LOOKUP",
+	ConnectionTimeseries:     "TIMESERIES",
+	ConnectionStore:          "STORE",
+	ConnectionStoreHost:      "STORE_HOST",
+	ConnectionStoreService:   "STORE_SERVICE",
+	ConnectionStoreMetric:    "STORE_METRIC",
+	ConnectionStoreAttribute: "STORE_ATTRIBUTE",
+	ConnectionMatcher:        "MATCHER",
+	ConnectionExpr:           "EXPR",
+	ConnectionServerVersion:  "SERVER_VERSION",
+	ConnectionStartTLS:       "STARTTLS",
+	ConnectionVersion:        "VERSION",
+}
+
+// String returns the name of the status. Some reply statuses share their
+// value with commands (e.g. OK and IDLE); String returns the name of the
+// reply status for those. Use CommandString for requests.
+func (s Status) String() string {
+	if n, ok := statusNames[s]; ok {
+		return n
+	}
+	return s.CommandString()
+}
+
+// CommandString returns the name of the status when used as a command or
+// connection state.
+func (s Status) CommandString() string {
+	if n, ok := commandNames[s]; ok {
+		return n
+	}
+	return fmt.Sprintf("Status(%d)", uint32(s))
+}
+
+// ParseStatus returns the status called name which may be the name of any
+// reply status, command, or connection state as returned by String and
+// CommandString (e.g. "DATA" or "LOOKUP"). Names are case-insensitive.
+func ParseStatus(name string) (Status, error) {
+	n := strings.ToUpper(name)
+	for _, names := range []map[Status]string{statusNames, commandNames} {
+		for s, sn := range names {
+			if sn == n {
+				return s, nil
+			}
+		}
+	}
+	return 0, sysdb.Errorf(sysdb.CodeInvalidArgument, "unknown status %q", name)
+}
+
+var dataTypeNames = map[DataType]string{
+	HostList:    "HostList",
+	Host:        "Host",
+	Timeseries:  "Timeseries",
+	ServiceList: "ServiceList",
+	MetricList:  "MetricList",
+}
+
+// String returns the name of the data type.
+func (t DataType) String() string {
+	if n, ok := dataTypeNames[t]; ok {
+		return n
+	}
+	if n, ok := registeredName(t); ok {
+		return n
+	}
+	return fmt.Sprintf("DataType(%d)", int(t))
+}
+
+// ParseDataType returns the data type called name as returned by String.
+// Names are case-insensitive.
+func ParseDataType(name string) (DataType, error) {
+	for t, n := range dataTypeNames {
+		if strings.EqualFold(n, name) {
+			return t, nil
+		}
+	}
+	if t, ok := parseRegistered(name); ok {
+		return t, nil
+	}
+	return 0, sysdb.Errorf(sysdb.CodeInvalidArgument, "unknown data type %q", name)
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
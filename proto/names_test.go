@@ -0,0 +1,93 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package proto
+
+import (
+	"testing"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+func TestStatusNames(t *testing.T) {
+	for _, test := range []struct {
+		s       Status
+		str     string
+		command string
+	}{
+		{ConnectionOK, "OK", "IDLE"},
+		{ConnectionError, "ERROR", "PING"},
+		{ConnectionData, "DATA", "MATCHER"},
+		{ConnectionLookup, "LOOKUP", "LOOKUP"},
+		{ConnectionStoreHost, "STORE_HOST", "STORE_HOST"},
+		{ConnectionStoreMetric, "STORE_METRIC", "STORE_METRIC"},
+		{ConnectionStoreAttribute, "STORE_ATTRIBUTE", "STORE_ATTRIBUTE"},
+		{ConnectionServerVersion, "SERVER_VERSION", "SERVER_VERSION"},
+		{Status(4711), "Status(4711)", "Status(4711)"},
+	} {
+		if got := test.s.String(); got != test.str {
+			t.Errorf("Status(%d).String() = %q; want %q", uint32(test.s), got, test.str)
+		}
+		if got := test.s.CommandString(); got != test.command {
+			t.Errorf("Status(%d).CommandString() = %q; want %q", uint32(test.s), got, test.command)
+		}
+	}
+
+	for _, names := range []map[Status]string{statusNames, commandNames} {
+		for s, n := range names {
+			if got, err := ParseStatus(n); err != nil || got != s {
+				t.Errorf("ParseStatus(%q) = %d, %v; want %d, <nil>", n, got, err, s)
+			}
+		}
+	}
+	if got, err := ParseStatus("lookup"); err != nil || got != ConnectionLookup {
+		t.Errorf("ParseStatus(\"lookup\") = %d, %v; want %d, <nil>", got, err, ConnectionLookup)
+	}
+	if got, err := ParseStatus("SELECT"); sysdb.ErrorCode(err) != sysdb.CodeInvalidArgument {
+		t.Errorf("ParseStatus(\"SELECT\") = %d, %v; want <error %v>", got, err, sysdb.CodeInvalidArgument)
+	}
+}
+
+func TestDataTypeNames(t *testing.T) {
+	for typ, n := range dataTypeNames {
+		if got := typ.String(); got != n {
+			t.Errorf("DataType(%d).String() = %q; want %q", int(typ), got, n)
+		}
+		if got, err := ParseDataType(n); err != nil || got != typ {
+			t.Errorf("ParseDataType(%q) = %d, %v; want %d, <nil>", n, got, err, typ)
+		}
+	}
+	if got := DataType(42).String(); got != "DataType(42)" {
+		t.Errorf("DataType(42).String() = %q; want \"DataType(42)\"", got)
+	}
+	if got, err := ParseDataType("hostlist"); err != nil || got != HostList {
+		t.Errorf("ParseDataType(\"hostlist\") = %d, %v; want %d, <nil>", got, err, HostList)
+	}
+	if got, err := ParseDataType("Table"); sysdb.ErrorCode(err) != sysdb.CodeInvalidArgument {
+		t.Errorf("ParseDataType(\"Table\") = %d, %v; want <error %v>", got, err, sysdb.CodeInvalidArgument)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
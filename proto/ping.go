@@ -0,0 +1,126 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package proto
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+// Ping checks that the connection c is alive by sending a PING request. The
+// server has to reply with OK within timeout unless timeout is zero. Log
+// messages sent by the server are ignored. The connection must not be in use
+// by anybody else during the ping.
+func Ping(c net.Conn, timeout time.Duration) error {
+	if timeout > 0 {
+		if err := c.SetDeadline(time.Now().Add(timeout)); err != nil {
+			return err
+		}
+		defer c.SetDeadline(time.Time{})
+	}
+
+	if err := Write(c, &Message{Type: ConnectionPing}); err != nil {
+		return err
+	}
+	for {
+		res, err := ReadPooled(c)
+		if err != nil {
+			return err
+		}
+		defer ReleaseMessage(res)
+		switch res.Type {
+		case ConnectionOK:
+			return nil
+		case ConnectionLog:
+			continue
+		case ConnectionError:
+			return sysdb.Errorf(sysdb.CodeRequestFailed, "PING failed: %s", string(res.Raw))
+		}
+		return sysdb.Errorf(sysdb.CodeUnexpectedMessage, "unexpected reply %s to PING", res.Type)
+	}
+}
+
+// A Pinger keeps a connection alive and monitors its liveness by pinging it
+// periodically.
+type Pinger struct {
+	// Interval is the time between two pings.
+	Interval time.Duration
+	// Timeout is the time the server has to reply to a ping. It defaults to
+	// Interval.
+	Timeout time.Duration
+
+	// Lock, if not nil, is held during each ping. It allows to use the
+	// connection for other requests while the pinger is running as long as
+	// all users hold the lock.
+	Lock sync.Locker
+
+	// OnPing, if not nil, is called with the round-trip time after each
+	// successful ping.
+	OnPing func(rtt time.Duration)
+}
+
+// Run pings c every p.Interval until a ping fails or ctx is done. It returns
+// the error of the failed ping or ctx.Err().
+func (p *Pinger) Run(ctx context.Context, c net.Conn) error {
+	if p.Interval <= 0 {
+		return sysdb.Errorf(sysdb.CodeInvalidArgument, "invalid ping interval %v", p.Interval)
+	}
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = p.Interval
+	}
+
+	t := time.NewTicker(p.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		if p.Lock != nil {
+			p.Lock.Lock()
+		}
+		start := time.Now()
+		err := Ping(c, timeout)
+		if p.Lock != nil {
+			p.Lock.Unlock()
+		}
+		if err != nil {
+			return err
+		}
+		if p.OnPing != nil {
+			p.OnPing(time.Since(start))
+		}
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
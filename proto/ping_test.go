@@ -0,0 +1,110 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package proto
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+// pongs serves PING requests on c, replying with the specified messages in
+// order (one list per request). It stops replying once all replies are used
+// up.
+func pongs(c net.Conn, replies ...[]*Message) {
+	for _, res := range replies {
+		if _, err := Read(c); err != nil {
+			return
+		}
+		for _, m := range res {
+			if err := Write(c, m); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func TestPing(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	log := EncodeLog(LogMessage{Priority: sysdb.LogInfo, Message: "pong"})
+	go pongs(server,
+		[]*Message{log, {Type: ConnectionOK}},
+		[]*Message{{Type: ConnectionError, Raw: []byte("failed")}},
+		[]*Message{{Type: ConnectionData, Raw: []byte{0, 0, 0, 1}}},
+	)
+
+	for _, want := range []sysdb.Code{sysdb.CodeUnknown, sysdb.CodeRequestFailed, sysdb.CodeUnexpectedMessage} {
+		err := Ping(client, time.Second)
+		if sysdb.ErrorCode(err) != want || (want == sysdb.CodeUnknown) != (err == nil) {
+			t.Errorf("Ping() = %v; want <code %v>", err, want)
+		}
+	}
+
+	// No more replies.
+	if err := Ping(client, 10*time.Millisecond); err == nil {
+		t.Errorf("Ping(<dead peer>) = <nil>; want <timeout>")
+	}
+}
+
+func TestPinger(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	ok := []*Message{{Type: ConnectionOK}}
+	go pongs(server, ok, ok, []*Message{{Type: ConnectionError, Raw: []byte("failed")}})
+
+	var mu sync.Mutex
+	pings := 0
+	p := &Pinger{
+		Interval: time.Millisecond,
+		Timeout:  time.Second,
+		Lock:     &mu,
+		OnPing:   func(time.Duration) { pings++ },
+	}
+	if err := p.Run(context.Background(), client); sysdb.ErrorCode(err) != sysdb.CodeRequestFailed || pings != 2 {
+		t.Errorf("Run() = %v after %d pings; want <code %v> after 2 pings", err, pings, sysdb.CodeRequestFailed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p.Interval = time.Hour
+	if err := p.Run(ctx, client); err != context.Canceled {
+		t.Errorf("Run(<canceled>) = %v; want %v", err, context.Canceled)
+	}
+	if err := (&Pinger{}).Run(context.Background(), client); sysdb.ErrorCode(err) != sysdb.CodeInvalidArgument {
+		t.Errorf("Run(<no interval>) = %v; want <code %v>", err, sysdb.CodeInvalidArgument)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
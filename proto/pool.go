@@ -0,0 +1,76 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package proto
+
+import (
+	"io"
+	"sync"
+)
+
+// maxPooledSize is the maximum capacity of message bodies kept in the pool.
+// Larger buffers are left to the garbage collector.
+const maxPooledSize = 64 << 10
+
+var messagePool = sync.Pool{
+	New: func() interface{} { return new(Message) },
+}
+
+// AcquireMessage returns a message of type typ with a body of n bytes from a
+// pool of messages. The content of the body is undefined. Messages should be
+// returned to the pool using ReleaseMessage once they are no longer used,
+// reducing the number of allocations when processing many messages.
+func AcquireMessage(typ Status, n int) *Message {
+	m := messagePool.Get().(*Message)
+	m.Type = typ
+	if cap(m.Raw) < n {
+		m.Raw = make([]byte, n)
+	} else {
+		m.Raw = m.Raw[:n]
+	}
+	return m
+}
+
+// ReleaseMessage returns m to the pool of messages. Neither m nor its body
+// (including any slices referencing it) may be used afterwards. It is safe
+// to release messages not obtained from the pool.
+func ReleaseMessage(m *Message) {
+	if m == nil {
+		return
+	}
+	if cap(m.Raw) > maxPooledSize {
+		m.Raw = nil
+	}
+	m.Type, m.Raw = 0, m.Raw[:0]
+	messagePool.Put(m)
+}
+
+// ReadPooled is like Read but returns a message obtained using
+// AcquireMessage which should be released once it is no longer used.
+func ReadPooled(r io.Reader) (*Message, error) {
+	return readLimit(r, MaxMessageSize, false, AcquireMessage)
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
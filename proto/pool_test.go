@@ -0,0 +1,63 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package proto
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMessagePool(t *testing.T) {
+	for _, n := range []int{0, 10, 100, maxPooledSize + 1, 5} {
+		m := AcquireMessage(ConnectionData, n)
+		if m.Type != ConnectionData || len(m.Raw) != n {
+			t.Errorf("AcquireMessage(DATA, %d) = <%s, %d bytes>; want <DATA, %d bytes>", n, m.Type, len(m.Raw), n)
+		}
+		ReleaseMessage(m)
+		if m.Type != 0 || len(m.Raw) != 0 || cap(m.Raw) > maxPooledSize {
+			t.Errorf("ReleaseMessage() left <%s, %d bytes, capacity %d>; want empty message", m.Type, len(m.Raw), cap(m.Raw))
+		}
+	}
+	ReleaseMessage(nil)
+
+	var buf bytes.Buffer
+	want := &Message{Type: ConnectionQuery, Raw: []byte("LIST hosts;")}
+	Write(&buf, want)
+	Write(&buf, &Message{Type: ConnectionPing})
+	m, err := ReadPooled(&buf)
+	if err != nil || m.Type != want.Type || !bytes.Equal(m.Raw, want.Raw) {
+		t.Errorf("ReadPooled() = %v, %v; want %v, <nil>", m, err, want)
+	}
+	ReleaseMessage(m)
+	if m, err := ReadPooled(&buf); err != nil || m.Type != ConnectionPing || len(m.Raw) != 0 {
+		t.Errorf("ReadPooled() = %v, %v; want PING, <nil>", m, err)
+	}
+	if m, err := ReadPooled(&buf); err == nil {
+		t.Errorf("ReadPooled(<empty>) = %v, <nil>; want <error>", m)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
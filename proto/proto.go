@@ -29,11 +29,15 @@
 package proto
 
 import (
+	"bytes"
+	"encoding"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"io"
 	"strings"
+
+	"github.com/sysdb/go/sysdb"
 )
 
 // Network byte order.
@@ -53,6 +57,11 @@ const (
 
 	// ConnectionData indicates a successful query returning data.
 	ConnectionData = Status(100)
+	// ConnectionDataChunk indicates a partial result of a query returning
+	// a list (see ChunkWriter). More chunks follow until the result is
+	// terminated by ConnectionOK. Servers only send chunks after
+	// negotiating ChunkedDataVersion.
+	ConnectionDataChunk = Status(101)
 )
 
 const (
@@ -84,11 +93,19 @@ const (
 	// command in the server.
 	ConnectionStore = Status(50)
 
-	// Object-specific STORE commands.
-	ConnectionStoreHost      = Status(51)
-	ConnectionStoreService   = Status(52)
-	ConnectionStoreMetric    = Status(53)
-	ConnectionStoreAttribute = Status(54)
+	// The object-specific STORE commands store a single object. The server
+	// identifies them by adding the object type to ConnectionStore
+	// (host: 1, service: 2, metric: 3, attribute: 4).
+
+	// ConnectionStoreHost is the state requesting to store a host.
+	ConnectionStoreHost = ConnectionStore + 1
+	// ConnectionStoreService is the state requesting to store a service.
+	ConnectionStoreService = ConnectionStore + 2
+	// ConnectionStoreMetric is the state requesting to store a metric.
+	ConnectionStoreMetric = ConnectionStore + 3
+	// ConnectionStoreAttribute is the state requesting to store an
+	// attribute of a host, service, or metric.
+	ConnectionStoreAttribute = ConnectionStore + 4
 
 	// ConnectionMatcher is the internal state for parsing matchers.
 	ConnectionMatcher = Status(100)
@@ -97,6 +114,15 @@ const (
 
 	// ConnectionServerVersion is the state requesting the server version.
 	ConnectionServerVersion = Status(1000)
+
+	// ConnectionStartTLS is the state requesting to upgrade the connection
+	// to TLS (see StartTLS). This is an extension of the SysDB protocol
+	// which is not supported by all servers.
+	ConnectionStartTLS = Status(1001)
+	// ConnectionVersion is the state requesting the negotiation of the
+	// protocol version (see NegotiateVersion). This is an extension of the
+	// SysDB protocol which is not supported by all servers.
+	ConnectionVersion = Status(1002)
 )
 
 // The DataType describes the type of data in a ConnectionData message.
@@ -109,6 +135,10 @@ const (
 	Host
 	// A Timeseries can be unmarshaled to sysdb.Timeseries.
 	Timeseries
+	// A ServiceList can be unmarshaled to sysdb.ServiceList.
+	ServiceList
+	// A MetricList can be unmarshaled to sysdb.MetricList.
+	MetricList
 )
 
 // A Message represents a raw message of the SysDB front-end protocol.
@@ -117,14 +147,61 @@ type Message struct {
 	Raw  []byte
 }
 
+// MaxMessageSize is the maximum size of the body of a message accepted by
+// Read. It protects against corrupted or malicious peers claiming huge
+// message sizes.
+var MaxMessageSize = 64 << 20
+
+// A MessageTooLargeError describes a message exceeding the maximum size. Its
+// code is sysdb.CodeTooLarge. It is returned wrapped in a *FramingError when
+// reading messages.
+type MessageTooLargeError struct {
+	Type      Status
+	Size, Max int
+}
+
+// Error implements the error interface.
+func (e *MessageTooLargeError) Error() string {
+	return fmt.Sprintf("message of type %s too large: %d bytes (maximum: %d)", e.Type, e.Size, e.Max)
+}
+
+// Unwrap returns an error carrying the code sysdb.CodeTooLarge.
+func (e *MessageTooLargeError) Unwrap() error { return errTooLarge }
+
+var errTooLarge = sysdb.Errorf(sysdb.CodeTooLarge, "message too large")
+
 // Read reads a raw message encoded in the SysDB wire format from r. The
 // function parses the header but the raw body of the message will still be
-// encoded in the wire format.
+// encoded in the wire format. Messages of unknown type or larger than
+// MaxMessageSize are rejected with a *FramingError before reading their body.
 //
 // The reader has to be in blocking mode. Otherwise, the client and server
 // will be out of sync after reading a partial message and cannot recover from
-// that.
+// that. Use a Reader to read from other readers.
 func Read(r io.Reader) (*Message, error) {
+	return ReadLimit(r, MaxMessageSize)
+}
+
+// ReadLimit is like Read but rejects messages with a body larger than max
+// bytes.
+func ReadLimit(r io.Reader, max int) (*Message, error) {
+	return readLimit(r, max, false, newMessage)
+}
+
+// readRequest reads a request sent to a server. Unlike Read, it accepts
+// requests of unknown type, leaving it to the server to reject them (or to
+// support them as an extension).
+func readRequest(r io.Reader) (*Message, error) {
+	return readLimit(r, MaxMessageSize, true, newMessage)
+}
+
+func newMessage(typ Status, n int) *Message {
+	return &Message{Type: typ, Raw: make([]byte, n)}
+}
+
+// readLimit implements ReadLimit using alloc to allocate the message. If
+// anyType is true, messages of unknown type are accepted.
+func readLimit(r io.Reader, max int, anyType bool, alloc func(typ Status, n int) *Message) (*Message, error) {
 	var header [8]byte
 	if _, err := io.ReadFull(r, header[:]); err != nil {
 		return nil, err
@@ -132,68 +209,158 @@ func Read(r io.Reader) (*Message, error) {
 
 	typ := nbo.Uint32(header[:4])
 	l := nbo.Uint32(header[4:])
-	msg := make([]byte, l)
-	if _, err := io.ReadFull(r, msg); err != nil {
+	if err := checkHeader(Status(typ), l, max, anyType); err != nil {
 		return nil, err
 	}
-
-	return &Message{Status(typ), msg}, nil
+	m := alloc(Status(typ), int(l))
+	if _, err := io.ReadFull(r, m.Raw); err != nil {
+		ReleaseMessage(m)
+		return nil, err
+	}
+	return m, nil
 }
 
 // Write writes a raw message to w. The raw body of m has to be encoded in the
 // SysDB wire format. The function adds the right header to the message.
 //
+// The full frame is passed to w in a single write, so concurrent writes to
+// connections (see net.Conn) do not interleave partial frames. Use a Writer
+// to send multiple messages at once.
+//
 // The writer has to be in blocking mode. Otherwise, the client and server
 // will be out of sync after writing a partial message and cannot recover from
 // that.
 func Write(w io.Writer, m *Message) error {
-	var header [8]byte
-	nbo.PutUint32(header[:4], uint32(m.Type))
-	nbo.PutUint32(header[4:], uint32(len(m.Raw)))
+	_, err := w.Write(appendFrame(make([]byte, 0, 8+len(m.Raw)), m))
+	return err
+}
 
-	if _, err := io.WriteString(w, string(header[:])); err != nil {
-		return err
-	}
-	if _, err := io.WriteString(w, string(m.Raw)); err != nil {
-		return err
-	}
-	return nil
+// appendFrame appends the wire format of m to b.
+func appendFrame(b []byte, m *Message) []byte {
+	b = nbo.AppendUint32(b, uint32(m.Type))
+	b = nbo.AppendUint32(b, uint32(len(m.Raw)))
+	return append(b, m.Raw...)
 }
 
 // DataType determines the type of data in a ConnectionData message.
+//
+// The message only specifies the command it replies to, so the type of
+// objects returned by LIST and LOOKUP commands is derived from the first
+// element of the list: services or metrics returned along with the name of
+// their host (metrics carrying a "timeseries" field) are reported as service
+// or metric lists. Any other lists are considered to be host lists; this
+// includes services or metrics nested in their hosts, so callers knowing the
+// query should rather rely on that to determine the type of objects.
+//
+// Replies to other commands are supported if a data type has been registered
+// for the command (see RegisterDataType).
 func (m Message) DataType() (DataType, error) {
 	if m.Type != ConnectionData {
-		return 0, fmt.Errorf("message is not of type DATA")
+		return 0, sysdb.Errorf(sysdb.CodeUnexpectedMessage, "message is not of type DATA")
+	}
+	if len(m.Raw) < 4 {
+		return 0, sysdb.Errorf(sysdb.CodeMalformedMessage, "DATA message body too short")
 	}
 
 	typ := nbo.Uint32(m.Raw[:4])
 	switch Status(typ) {
 	case ConnectionList, ConnectionLookup:
-		return HostList, nil
+		return listType(m.Raw[4:]), nil
 	case ConnectionFetch:
 		return Host, nil
 	case ConnectionTimeseries:
 		return Timeseries, nil
 	}
-	return 0, fmt.Errorf("unknown DATA type %d", typ)
+	if t, ok := registeredType(Status(typ)); ok {
+		return t, nil
+	}
+	return 0, sysdb.Errorf(sysdb.CodeUnsupported, "unknown DATA type %s", Status(typ).CommandString())
+}
+
+// listType determines the type of objects in a JSON list. Only the first
+// element is decoded.
+func listType(data []byte) DataType {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') || !dec.More() {
+		return HostList
+	}
+	var o map[string]json.RawMessage
+	if err := dec.Decode(&o); err != nil {
+		return HostList
+	}
+	_, host := o["host"]
+	_, ts := o["timeseries"]
+	switch {
+	case host && ts:
+		return MetricList
+	case host:
+		return ServiceList
+	}
+	return HostList
 }
 
 // Unmarshal parses the raw body of m and stores the result in the value
 // pointed to by v which has to match the type of the message and its data.
+// Binary encoded data (see MarshalBinary) is decoded using v's
+// UnmarshalBinary method.
 func Unmarshal(m *Message, v interface{}) error {
 	if m.Type != ConnectionData {
-		return fmt.Errorf("unmarshaling message of type %d not supported", m.Type)
+		return sysdb.Errorf(sysdb.CodeUnexpectedMessage, "unmarshaling message of type %s not supported", m.Type)
 	}
 	if len(m.Raw) == 0 { // empty command
 		return nil
 	} else if len(m.Raw) < 4 {
-		return fmt.Errorf("DATA message body too short")
+		return sysdb.Errorf(sysdb.CodeMalformedMessage, "DATA message body too short")
+	}
+	if isBinary(m.Raw[4:]) {
+		u, ok := v.(encoding.BinaryUnmarshaler)
+		if !ok {
+			return sysdb.Errorf(sysdb.CodeUnsupported, "cannot unmarshal binary data into %T", v)
+		}
+		return u.UnmarshalBinary(m.Raw[4:])
 	}
 	return json.Unmarshal(m.Raw[4:], v)
 }
 
+// isBinary reports whether a DATA body uses a binary encoding rather than
+// JSON.
+func isBinary(data []byte) bool {
+	return len(data) > 0 && data[0] == sysdb.BinaryTimeseriesFormat
+}
+
+// MarshalBinary returns a DATA message carrying the binary encoding of v as
+// the reply to a command of type cmd. Currently, this is supported for
+// sysdb.Timeseries (in reply to ConnectionTimeseries) only and requires the
+// client to have negotiated BinaryTimeseriesVersion.
+func MarshalBinary(cmd Status, v encoding.BinaryMarshaler) (*Message, error) {
+	data, err := v.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	raw := make([]byte, 4+len(data))
+	nbo.PutUint32(raw[:4], uint32(cmd))
+	copy(raw[4:], data)
+	return &Message{Type: ConnectionData, Raw: raw}, nil
+}
+
+// Marshal returns a DATA message carrying the JSON encoding of v as the
+// reply to a command of type cmd (e.g. ConnectionFetch for a sysdb.Host,
+// ConnectionList or ConnectionLookup for []sysdb.Host, or
+// ConnectionTimeseries for a sysdb.Timeseries). It is the counterpart of
+// Unmarshal.
+func Marshal(cmd Status, v interface{}) (*Message, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, sysdb.Errorf(sysdb.CodeInvalidArgument, "failed to marshal DATA message: %v", err)
+	}
+	raw := make([]byte, 4+len(data))
+	nbo.PutUint32(raw[:4], uint32(cmd))
+	copy(raw[4:], data)
+	return &Message{Type: ConnectionData, Raw: raw}, nil
+}
+
 // EscapeString returns the quoted and escaped string s suitable for use
-// in a query.
+// in a query. See UnescapeString for the inverse.
 func EscapeString(s string) string {
 	// Currently, the server only handles double-quotes.
 	// Backslashes do not serve any special purpose.
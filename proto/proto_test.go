@@ -0,0 +1,240 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package proto
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+func TestMarshal(t *testing.T) {
+	ts := sysdb.Time(time.Date(2015, 5, 1, 12, 0, 0, 0, time.UTC))
+	host := sysdb.Host{Name: "h1", LastUpdate: ts, Backends: []string{"b1"}}
+
+	for _, test := range []struct {
+		cmd  Status
+		v    interface{}
+		want DataType
+	}{
+		{ConnectionFetch, host, Host},
+		{ConnectionList, []sysdb.Host{host}, HostList},
+		{ConnectionLookup, []sysdb.Host{}, HostList},
+		{ConnectionTimeseries, sysdb.Timeseries{Start: ts, End: ts}, Timeseries},
+	} {
+		m, err := Marshal(test.cmd, test.v)
+		if err != nil {
+			t.Errorf("Marshal(%d, %v) = %v; want <nil>", test.cmd, test.v, err)
+			continue
+		}
+		if m.Type != ConnectionData {
+			t.Errorf("Marshal(%d, %v) = <type %d>; want <type %d>", test.cmd, test.v, m.Type, ConnectionData)
+		}
+		if typ, err := m.DataType(); err != nil || typ != test.want {
+			t.Errorf("Marshal(%d, %v).DataType() = %d, %v; want %d, <nil>", test.cmd, test.v, typ, err, test.want)
+		}
+	}
+
+	m, err := Marshal(ConnectionFetch, host)
+	if err != nil {
+		t.Fatalf("Marshal(FETCH, %v) = %v", host, err)
+	}
+	var got sysdb.Host
+	if err := Unmarshal(m, &got); err != nil || got.Name != host.Name ||
+		!got.LastUpdate.Equal(host.LastUpdate) || len(got.Backends) != 1 {
+		t.Errorf("Unmarshal(Marshal(%v)) = %v, %v; want %v, <nil>", host, got, err, host)
+	}
+
+	if m, err := Marshal(ConnectionFetch, make(chan int)); sysdb.ErrorCode(err) != sysdb.CodeInvalidArgument {
+		t.Errorf("Marshal(<chan>) = %v, %v; want <error %v>", m, err, sysdb.CodeInvalidArgument)
+	}
+}
+
+func TestMarshalBinary(t *testing.T) {
+	start := sysdb.Time(time.Date(2015, 5, 1, 12, 0, 0, 0, time.UTC))
+	ts := sysdb.Timeseries{Start: start, End: start, Data: map[string][]sysdb.DataPoint{
+		"value": {{Timestamp: start, Value: 42}},
+	}}
+
+	m, err := MarshalBinary(ConnectionTimeseries, ts)
+	if err != nil {
+		t.Fatalf("MarshalBinary(TIMESERIES, %v) = %v; want <nil>", ts, err)
+	}
+	if typ, err := m.DataType(); err != nil || typ != Timeseries {
+		t.Errorf("MarshalBinary(TIMESERIES, %v).DataType() = %s, %v; want %s, <nil>", ts, typ, err, Timeseries)
+	}
+
+	var got sysdb.Timeseries
+	if err := Unmarshal(m, &got); err != nil || len(got.Data["value"]) != 1 ||
+		got.Data["value"][0].Value != 42 || !time.Time(got.Start).Equal(time.Time(start)) {
+		t.Errorf("Unmarshal(MarshalBinary(%v)) = %v, %v; want %v, <nil>", ts, got, err, ts)
+	}
+
+	var host sysdb.Host
+	if err := Unmarshal(m, &host); sysdb.ErrorCode(err) != sysdb.CodeUnsupported {
+		t.Errorf("Unmarshal(<binary>, <host>) = %v; want <error %v>", err, sysdb.CodeUnsupported)
+	}
+}
+
+func TestListDataType(t *testing.T) {
+	for _, test := range []struct {
+		json string
+		want DataType
+	}{
+		{`[]`, HostList},
+		{`[{"name": "h1"}, {"name": "h2"}]`, HostList},
+		{`[{"name": "h1", "attributes": [], "services": [], "metrics": []}]`, HostList},
+		{`[{"name": "h1", "services": [{"name": "s1"}]}]`, HostList},
+		{`[{"name": "h1", "metrics": [{"name": "m1"}]}]`, HostList},
+		{`[{"host": "h1", "name": "s1"}]`, ServiceList},
+		{`[{"host": "h1", "name": "m1", "timeseries": false}]`, MetricList},
+		// Only the first element is considered.
+		{`[{"host": "h1", "name": "s1"}, not JSON`, ServiceList},
+		{`[{"name": "h1"}, {"host": "h1", "name": "s1"}]`, HostList},
+		{`{"name": "h1"}`, HostList},
+	} {
+		for _, cmd := range []Status{ConnectionList, ConnectionLookup} {
+			m := &Message{Type: ConnectionData, Raw: append([]byte{0, 0, 0, byte(cmd)}, test.json...)}
+			if typ, err := m.DataType(); err != nil || typ != test.want {
+				t.Errorf("DataType(%d, %s) = %d, %v; want %d, <nil>", cmd, test.json, typ, err, test.want)
+			}
+		}
+	}
+
+	m := &Message{Type: ConnectionData, Raw: []byte{0, 0}}
+	if typ, err := m.DataType(); sysdb.ErrorCode(err) != sysdb.CodeMalformedMessage {
+		t.Errorf("DataType(<short>) = %d, %v; want <error %v>", typ, err, sysdb.CodeMalformedMessage)
+	}
+}
+
+func TestReadLimit(t *testing.T) {
+	frame := []byte{0, 0, 0, 100, 0, 0, 0, 5, 'h', 'e', 'l', 'l', 'o'}
+	for _, test := range []struct {
+		max     int
+		wantErr bool
+	}{
+		{5, false},
+		{4, true},
+		{0, true},
+	} {
+		m, err := ReadLimit(bytes.NewReader(frame), test.max)
+		if test.wantErr {
+			var e *MessageTooLargeError
+			if !errors.As(err, &e) || e.Size != 5 || e.Max != test.max || sysdb.ErrorCode(err) != sysdb.CodeTooLarge {
+				t.Errorf("ReadLimit(<5 bytes>, %d) = %v, %v; want <message too large>", test.max, m, err)
+			}
+		} else if err != nil || string(m.Raw) != "hello" {
+			t.Errorf("ReadLimit(<5 bytes>, %d) = %v, %v; want hello, <nil>", test.max, m, err)
+		}
+	}
+
+	// The default limit rejects absurd sizes.
+	frame = []byte{0, 0, 0, 100, 0xff, 0xff, 0xff, 0xff}
+	if m, err := Read(bytes.NewReader(frame)); sysdb.ErrorCode(err) != sysdb.CodeTooLarge {
+		t.Errorf("Read(<4GB>) = %v, %v; want <error %v>", m, err, sysdb.CodeTooLarge)
+	}
+}
+
+// A countingWriter records each write separately.
+type countingWriter struct {
+	writes [][]byte
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.writes = append(w.writes, append([]byte(nil), p...))
+	return len(p), nil
+}
+
+func TestWrite(t *testing.T) {
+	for _, m := range []*Message{
+		{Type: ConnectionQuery, Raw: []byte("LIST hosts;")},
+		{Type: ConnectionPing},
+	} {
+		var w countingWriter
+		if err := Write(&w, m); err != nil {
+			t.Errorf("Write(%v) = %v; want <nil>", m, err)
+			continue
+		}
+		if len(w.writes) != 1 {
+			t.Errorf("Write(%v) issued %d writes; want 1", m, len(w.writes))
+			continue
+		}
+		got, err := Read(bytes.NewReader(w.writes[0]))
+		if err != nil || got.Type != m.Type || !bytes.Equal(got.Raw, m.Raw) {
+			t.Errorf("Read(Write(%v)) = %v, %v; want %v, <nil>", m, got, err, m)
+		}
+	}
+}
+
+func TestChunks(t *testing.T) {
+	var buf bytes.Buffer
+	cw := NewChunkWriter(&buf, ConnectionLookup, 2)
+	for _, name := range []string{"h1", "h2", "h3"} {
+		if err := cw.Write(sysdb.Host{Name: name}); err != nil {
+			t.Fatalf("ChunkWriter.Write(%s) = %v", name, err)
+		}
+	}
+	if err := cw.Close(); err != nil {
+		t.Fatalf("ChunkWriter.Close() = %v", err)
+	}
+
+	var chunks []*Message
+	for buf.Len() > 0 {
+		m, err := Read(&buf)
+		if err != nil || m.Type != ConnectionDataChunk {
+			t.Fatalf("Read(<chunk>) = %v, %v; want DATA_CHUNK", m, err)
+		}
+		chunks = append(chunks, m)
+	}
+	if len(chunks) != 2 {
+		t.Fatalf("ChunkWriter wrote %d chunks; want 2", len(chunks))
+	}
+	if elems, err := Elements(chunks[1]); err != nil || len(elems) != 1 {
+		t.Errorf("Elements(<chunk 2>) = %s, %v; want one element", elems, err)
+	}
+
+	m, err := MergeChunks(chunks)
+	if err != nil {
+		t.Fatalf("MergeChunks() = %v", err)
+	}
+	var hosts []sysdb.Host
+	if typ, err := m.DataType(); err != nil || typ != HostList {
+		t.Errorf("MergeChunks().DataType() = %v, %v; want %v", typ, err, HostList)
+	}
+	if err := Unmarshal(m, &hosts); err != nil || len(hosts) != 3 || hosts[2].Name != "h3" {
+		t.Errorf("Unmarshal(MergeChunks()) = %v, %v; want [h1 h2 h3]", hosts, err)
+	}
+
+	m, _ = Marshal(ConnectionFetch, sysdb.Host{Name: "h1"})
+	if elems, err := Elements(m); err != nil || len(elems) != 1 {
+		t.Errorf("Elements(<FETCH>) = %s, %v; want one element", elems, err)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
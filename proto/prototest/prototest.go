@@ -0,0 +1,193 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package prototest provides a scriptable SysDB server for testing code
+// using the SysDB client or protocol packages.
+//
+// A Server listens on a UNIX socket in a temporary directory and speaks the
+// SysDB front-end protocol (including session startup, version negotiation,
+// and PING). All other requests are answered by scripted responses:
+//
+//	srv := prototest.NewServer()
+//	defer srv.Close()
+//	srv.HandleQuery("LIST hosts", prototest.Response{
+//		Type: proto.ConnectionList,
+//		Data: []sysdb.Host{{Name: "h1"}},
+//	})
+//	c, err := client.Connect(srv.Addr, "test")
+package prototest
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sysdb/go/proto"
+	"github.com/sysdb/go/sysdb"
+)
+
+// A Response describes the scripted reply to a request.
+type Response struct {
+	// Log lists log messages sent to the client before the reply.
+	Log []proto.LogMessage
+	// Delay delays the reply (after sending the log messages).
+	Delay time.Duration
+
+	// Err, if not empty, is sent as an ERROR message.
+	Err string
+	// Message, if not nil, is sent as the reply as is.
+	Message *proto.Message
+	// Data, if not nil, is sent as the JSON encoded payload of a DATA
+	// message of type Type. Type defaults to the type of the request.
+	// Otherwise, an empty OK message is sent.
+	Data interface{}
+	Type proto.Status
+}
+
+// A Server is a SysDB server replying to requests with scripted responses.
+type Server struct {
+	// Addr is the address of the server in the format accepted by the
+	// client package ("unix:<path>").
+	Addr string
+
+	srv *proto.Server
+	dir string
+
+	mu       sync.Mutex
+	queries  map[string]Response
+	commands map[proto.Status]Response
+	requests []*proto.Message
+	closing  chan struct{}
+}
+
+// NewServer starts and returns a new server. It panics if the server cannot
+// be started. The caller should call Close when done.
+func NewServer() *Server {
+	dir, err := ioutil.TempDir("", "sysdb-prototest")
+	if err != nil {
+		panic("prototest: failed to create temporary directory: " + err.Error())
+	}
+	l, err := net.Listen("unix", filepath.Join(dir, "sock"))
+	if err != nil {
+		os.RemoveAll(dir)
+		panic("prototest: failed to listen: " + err.Error())
+	}
+
+	s := &Server{
+		Addr:     "unix:" + l.Addr().String(),
+		dir:      dir,
+		queries:  make(map[string]Response),
+		commands: make(map[proto.Status]Response),
+		closing:  make(chan struct{}),
+	}
+	s.srv = &proto.Server{Handler: proto.HandlerFunc(s.serve)}
+	go s.srv.Serve(l)
+	return s
+}
+
+// Close shuts down the server, closing all client connections, and removes
+// the socket.
+func (s *Server) Close() {
+	s.mu.Lock()
+	select {
+	case <-s.closing:
+	default:
+		close(s.closing)
+	}
+	s.mu.Unlock()
+	s.srv.Close()
+	os.RemoveAll(s.dir)
+}
+
+// Handle scripts the response to all requests of the specified type
+// (e.g. ConnectionList). It replaces any previously scripted response for
+// that type.
+func (s *Server) Handle(typ proto.Status, res Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commands[typ] = res
+}
+
+// HandleQuery scripts the response to the QUERY request with the specified
+// query string. It takes precedence over a response scripted for all QUERY
+// requests using Handle.
+func (s *Server) HandleQuery(q string, res Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queries[q] = res
+}
+
+// Requests returns all requests received by the server so far, excluding
+// requests handled by the protocol itself (session startup, PING, etc.).
+func (s *Server) Requests() []*proto.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*proto.Message(nil), s.requests...)
+}
+
+// serve implements proto.Handler.
+func (s *Server) serve(sess *proto.Session, req *proto.Message) (*proto.Message, error) {
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	res, ok := s.queries[string(req.Raw)]
+	if !ok || req.Type != proto.ConnectionQuery {
+		res, ok = s.commands[req.Type]
+	}
+	s.mu.Unlock()
+	if !ok {
+		return nil, sysdb.Errorf(sysdb.CodeUnsupported, "Unsupported command %s", req.Type.CommandString())
+	}
+
+	for _, l := range res.Log {
+		if err := sess.Log(l.Priority, l.Message); err != nil {
+			return nil, err
+		}
+	}
+	if res.Delay > 0 {
+		select {
+		case <-time.After(res.Delay):
+		case <-s.closing:
+		}
+	}
+
+	switch {
+	case res.Err != "":
+		return &proto.Message{Type: proto.ConnectionError, Raw: []byte(res.Err)}, nil
+	case res.Message != nil:
+		return res.Message, nil
+	case res.Data != nil:
+		typ := res.Type
+		if typ == 0 {
+			typ = req.Type
+		}
+		return proto.Marshal(typ, res.Data)
+	}
+	return nil, nil
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
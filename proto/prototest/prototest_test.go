@@ -0,0 +1,125 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package prototest_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sysdb/go/client"
+	"github.com/sysdb/go/proto"
+	"github.com/sysdb/go/proto/prototest"
+	"github.com/sysdb/go/sysdb"
+)
+
+func TestServer(t *testing.T) {
+	srv := prototest.NewServer()
+	defer srv.Close()
+
+	hosts := []sysdb.Host{{Name: "h1"}, {Name: "h2"}}
+	srv.HandleQuery("LIST hosts", prototest.Response{
+		Type: proto.ConnectionList,
+		Data: hosts,
+		Log:  []proto.LogMessage{{Priority: sysdb.LogInfo, Message: "listing"}},
+	})
+	srv.HandleQuery("FETCH host 'x'", prototest.Response{Err: "host x not found"})
+	srv.HandleQuery("LIST services", prototest.Response{Delay: time.Second})
+
+	var logs []string
+	c, err := client.Connect(srv.Addr, "test", client.WithPoolSize(1),
+		client.WithLogHandler(func(_ sysdb.LogPriority, msg string) {
+			logs = append(logs, msg)
+		}))
+	if err != nil {
+		t.Fatalf("Connect(%s) = %v", srv.Addr, err)
+	}
+	defer c.Close()
+
+	var got []sysdb.Host
+	if err := c.QueryInto("LIST hosts", &got); err != nil || len(got) != 2 || got[0].Name != "h1" || got[1].Name != "h2" {
+		t.Errorf("QueryInto(LIST hosts) = %v (%v); want <nil> (%v)", err, got, hosts)
+	}
+	if !reflect.DeepEqual(logs, []string{"listing"}) {
+		t.Errorf("QueryInto(LIST hosts) logged %q; want [listing]", logs)
+	}
+
+	if _, err := c.Query("FETCH host 'x'"); sysdb.ErrorCode(err) != sysdb.CodeRequestFailed ||
+		err.Error() != "request failed: host x not found" {
+		t.Errorf("Query(FETCH host 'x') = %v; want request failed: host x not found", err)
+	}
+	if _, err := c.Query("LIST metrics"); err == nil {
+		t.Errorf("Query(<unscripted>) = <nil>; want error")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := c.QueryContext(ctx, "LIST services"); err == nil {
+		t.Errorf("QueryContext(<delayed>) = <nil>; want error")
+	}
+
+	var queries []string
+	for _, req := range srv.Requests() {
+		if req.Type != proto.ConnectionQuery {
+			t.Errorf("Requests() included %s request; want QUERY", req.Type.CommandString())
+		}
+		queries = append(queries, string(req.Raw))
+	}
+	want := []string{"LIST hosts", "FETCH host 'x'", "LIST metrics", "LIST services"}
+	if !reflect.DeepEqual(queries, want) {
+		t.Errorf("Requests() = %q; want %q", queries, want)
+	}
+}
+
+func TestHandle(t *testing.T) {
+	srv := prototest.NewServer()
+	defer srv.Close()
+
+	srv.Handle(proto.ConnectionQuery, prototest.Response{Err: "unknown query"})
+	srv.HandleQuery("LIST hosts", prototest.Response{Type: proto.ConnectionList, Data: []sysdb.Host{}})
+	srv.Handle(proto.ConnectionServerVersion, prototest.Response{
+		Message: &proto.Message{Type: proto.ConnectionOK, Raw: []byte("\x00\x00\x27\x11x")},
+	})
+
+	c, err := client.Connect(srv.Addr, "test")
+	if err != nil {
+		t.Fatalf("Connect(%s) = %v", srv.Addr, err)
+	}
+	defer c.Close()
+
+	if _, err := c.Query("LIST hosts"); err != nil {
+		t.Errorf("Query(LIST hosts) = %v; want <nil>", err)
+	}
+	if _, err := c.Query("LIST services"); err == nil || err.Error() != "request failed: unknown query" {
+		t.Errorf("Query(LIST services) = %v; want request failed: unknown query", err)
+	}
+	if major, minor, patch, _, err := c.ServerVersion(); err != nil || major != 1 || minor != 0 || patch != 1 {
+		t.Errorf("ServerVersion() = %d.%d.%d, %v; want 1.0.1, <nil>", major, minor, patch, err)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
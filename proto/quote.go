@@ -0,0 +1,106 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package proto
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+// UnescapeString returns the value of the quoted string literal s as
+// produced by EscapeString. It fails if s is not enclosed in single quotes or
+// if it contains unescaped quotes.
+func UnescapeString(s string) (string, error) {
+	if len(s) < 2 || s[0] != '\'' || s[len(s)-1] != '\'' {
+		return "", sysdb.Errorf(sysdb.CodeInvalidArgument, "string literal %q not enclosed in quotes", s)
+	}
+	inner := s[1 : len(s)-1]
+	if strings.Contains(strings.Replace(inner, "''", "", -1), "'") {
+		return "", sysdb.Errorf(sysdb.CodeInvalidArgument, "unescaped quote in string literal %q", s)
+	}
+	return strings.Replace(inner, "''", "'", -1), nil
+}
+
+// split splits s at all runes outside of string literals for which sep
+// returns true.
+func split(s string, sep func(r rune) bool) ([]string, error) {
+	var parts []string
+	quoted := false
+	start := 0
+	for i, r := range s {
+		switch {
+		case r == '\'':
+			// An escaped quote ends and re-opens the literal.
+			quoted = !quoted
+		case !quoted && sep(r):
+			parts = append(parts, s[start:i])
+			start = i + utf8.RuneLen(r)
+		}
+	}
+	if quoted {
+		return nil, sysdb.Errorf(sysdb.CodeInvalidArgument, "unterminated string literal in %q", s)
+	}
+	return append(parts, s[start:]), nil
+}
+
+// SplitStatements splits the query q into the individual statements
+// separated by semicolons, ignoring semicolons in string literals. The
+// statements are returned without their terminating semicolon and with
+// surrounding whitespace removed. Empty statements are dropped.
+func SplitStatements(q string) ([]string, error) {
+	parts, err := split(q, func(r rune) bool { return r == ';' })
+	if err != nil {
+		return nil, err
+	}
+	var stmts []string
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			stmts = append(stmts, p)
+		}
+	}
+	return stmts, nil
+}
+
+// Fields splits s at white-space outside of string literals. Literals are
+// returned including their quotes and may be decoded using UnescapeString.
+func Fields(s string) ([]string, error) {
+	parts, err := split(s, unicode.IsSpace)
+	if err != nil {
+		return nil, err
+	}
+	var fields []string
+	for _, p := range parts {
+		if p != "" {
+			fields = append(fields, p)
+		}
+	}
+	return fields, nil
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,86 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package proto
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+func TestUnescapeString(t *testing.T) {
+	for _, s := range []string{"", "abc", "it's", "''", "a;b 'c'", "'"} {
+		if got, err := UnescapeString(EscapeString(s)); err != nil || got != s {
+			t.Errorf("UnescapeString(EscapeString(%q)) = %q, %v; want %q, <nil>", s, got, err, s)
+		}
+	}
+
+	for _, s := range []string{"", "'", "abc", "'abc", "abc'", "'a'b'", "'a''"} {
+		if got, err := UnescapeString(s); sysdb.ErrorCode(err) != sysdb.CodeInvalidArgument {
+			t.Errorf("UnescapeString(%q) = %q, %v; want <error %v>", s, got, err, sysdb.CodeInvalidArgument)
+		}
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	for _, test := range []struct {
+		q    string
+		want []string
+		err  bool
+	}{
+		{"", nil, false},
+		{"LIST hosts;", []string{"LIST hosts"}, false},
+		{" LIST hosts ; FETCH host 'a;b';;", []string{"LIST hosts", "FETCH host 'a;b'"}, false},
+		{"FETCH host 'it''s;'; LIST hosts", []string{"FETCH host 'it''s;'", "LIST hosts"}, false},
+		{"FETCH host 'a;", nil, true},
+	} {
+		got, err := SplitStatements(test.q)
+		if (err != nil) != test.err || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("SplitStatements(%q) = %q, %v; want %q, <err: %v>", test.q, got, err, test.want, test.err)
+		}
+	}
+}
+
+func TestFields(t *testing.T) {
+	for _, test := range []struct {
+		s    string
+		want []string
+		err  bool
+	}{
+		{"", nil, false},
+		{"  LOOKUP\thosts  ", []string{"LOOKUP", "hosts"}, false},
+		{"name = 'a b' AND x = 'it''s  here'", []string{"name", "=", "'a b'", "AND", "x", "=", "'it''s  here'"}, false},
+		{"name = 'a b", nil, true},
+	} {
+		got, err := Fields(test.s)
+		if (err != nil) != test.err || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Fields(%q) = %q, %v; want %q, <err: %v>", test.s, got, err, test.want, test.err)
+		}
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
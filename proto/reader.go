@@ -0,0 +1,156 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package proto
+
+import (
+	"io"
+)
+
+// A Reader reads messages from an underlying reader, buffering partial
+// messages across calls. Unlike Read, it may be used with readers returning
+// errors after reading part of a message (e.g. non-blocking connections or
+// connections with read deadlines): the next call resumes reading the
+// message where the previous one stopped.
+type Reader struct {
+	r io.Reader
+
+	// Max is the maximum size of the body of a message. It defaults to
+	// MaxMessageSize.
+	Max int
+
+	header [8]byte
+	n      int // bytes of the header read so far
+	body   []byte
+	m      int // bytes of the body read so far
+	skip   int64
+	err    error
+}
+
+// NewReader returns a Reader reading messages from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: r}
+}
+
+// Buffered returns the number of bytes of a partial message read so far.
+func (r *Reader) Buffered() int {
+	return r.n + r.m
+}
+
+// fill reads into b until it is full. It returns the number of bytes read.
+func (r *Reader) fill(b []byte) (int, error) {
+	n := 0
+	for n < len(b) {
+		k, err := r.r.Read(b[n:])
+		n += k
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// discard skips the body of a previously rejected message.
+func (r *Reader) discard() error {
+	var buf [4096]byte
+	for r.skip > 0 {
+		b := buf[:]
+		if int64(len(b)) > r.skip {
+			b = b[:r.skip]
+		}
+		n, err := r.fill(b)
+		r.skip -= int64(n)
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+	}
+	return nil
+}
+
+// ReadMessage reads the next message. If an error occurs while reading a
+// message, the data read so far is retained and the next call continues
+// reading the same message. io.EOF is returned only if the underlying reader
+// reached the end of its input at a message boundary.
+//
+// Messages with an implausible header are rejected with a *FramingError. If
+// the error is recoverable (see FramingError.Recoverable), the body is
+// skipped by the next call, so the reader stays in sync. Otherwise, all
+// further calls fail with the same error.
+func (r *Reader) ReadMessage() (*Message, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	if err := r.discard(); err != nil {
+		return nil, err
+	}
+
+	if r.n < len(r.header) {
+		n, err := r.fill(r.header[r.n:])
+		r.n += n
+		if err != nil {
+			if r.n == 0 {
+				return nil, err
+			}
+			return nil, unexpectedEOF(err)
+		}
+
+		typ := nbo.Uint32(r.header[:4])
+		l := nbo.Uint32(r.header[4:])
+		max := r.Max
+		if max <= 0 {
+			max = MaxMessageSize
+		}
+		if err := checkHeader(Status(typ), l, max, false); err != nil {
+			if err.(*FramingError).Recoverable() {
+				r.n, r.skip = 0, int64(l)
+			} else {
+				r.err = err
+			}
+			return nil, err
+		}
+		r.body = make([]byte, l)
+	}
+
+	n, err := r.fill(r.body[r.m:])
+	r.m += n
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	m := &Message{Type: Status(nbo.Uint32(r.header[:4])), Raw: r.body}
+	r.n, r.body, r.m = 0, nil, 0
+	return m, nil
+}
+
+// unexpectedEOF converts io.EOF into io.ErrUnexpectedEOF for reads ending in
+// the middle of a message.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,117 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package proto
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// A flakyReader returns the data in chunks of the specified size, failing
+// every other read.
+type flakyReader struct {
+	data  []byte
+	chunk int
+	fail  bool
+}
+
+var errTemporary = errors.New("temporary failure")
+
+func (r *flakyReader) Read(p []byte) (int, error) {
+	if r.fail = !r.fail; r.fail {
+		return 0, errTemporary
+	}
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	n := r.chunk
+	if n > len(p) {
+		n = len(p)
+	}
+	if n > len(r.data) {
+		n = len(r.data)
+	}
+	copy(p, r.data[:n])
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestReader(t *testing.T) {
+	want := []*Message{
+		{Type: ConnectionQuery, Raw: []byte("LIST hosts;")},
+		{Type: ConnectionOK, Raw: []byte{}},
+		{Type: ConnectionData, Raw: bytes.Repeat([]byte("x"), 100)},
+		{Type: ConnectionError, Raw: []byte("failed")},
+	}
+	var buf bytes.Buffer
+	for _, m := range want {
+		Write(&buf, m)
+	}
+
+	for _, chunk := range []int{1, 3, 8, 1000} {
+		r := NewReader(&flakyReader{data: buf.Bytes(), chunk: chunk})
+		r.Max = 50
+
+		var got []*Message
+		tooLarge := 0
+		for {
+			m, err := r.ReadMessage()
+			if err == io.EOF {
+				break
+			}
+			var tle *MessageTooLargeError
+			switch {
+			case errors.As(err, &tle):
+				tooLarge++
+			case err == errTemporary:
+			case err != nil:
+				t.Fatalf("ReadMessage(<chunks of %d>) = %v, %v", chunk, m, err)
+			default:
+				got = append(got, m)
+			}
+		}
+
+		if tooLarge != 1 || len(got) != 3 {
+			t.Errorf("ReadMessage(<chunks of %d>) returned %d messages, %d too large; want 3, 1", chunk, len(got), tooLarge)
+			continue
+		}
+		for i, j := range []int{0, 1, 3} {
+			if got[i].Type != want[j].Type || !bytes.Equal(got[i].Raw, want[j].Raw) {
+				t.Errorf("ReadMessage(<chunks of %d>) = %v; want %v", chunk, got[i], want[j])
+			}
+		}
+	}
+
+	r := NewReader(bytes.NewReader(buf.Bytes()[:5]))
+	if m, err := r.ReadMessage(); err != io.ErrUnexpectedEOF || r.Buffered() != 5 {
+		t.Errorf("ReadMessage(<truncated>) = %v, %v (%d bytes buffered); want <nil>, %v (5 bytes buffered)",
+			m, err, r.Buffered(), io.ErrUnexpectedEOF)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,285 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package proto
+
+import (
+	"crypto/tls"
+	"net"
+	"sync"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+// A Session describes a client session on a Server.
+type Session struct {
+	// User is the name of the user who started the session.
+	User string
+	// Conn is the connection of the session.
+	Conn net.Conn
+	// Version is the negotiated protocol version.
+	Version uint32
+}
+
+// Log sends a log message to the client. It may be used by handlers to
+// report progress before replying to a request.
+func (s *Session) Log(prio sysdb.LogPriority, msg string) error {
+	return Write(s.Conn, EncodeLog(LogMessage{Priority: prio, Message: msg}))
+}
+
+// A Handler responds to requests of a client session. The returned message
+// is sent to the client as the reply to the request. If an error is
+// returned, the client receives an ERROR message with the error message
+// instead. A nil message is sent as an empty OK message.
+type Handler interface {
+	Serve(s *Session, req *Message) (*Message, error)
+}
+
+// The HandlerFunc type is an adapter to allow the use of ordinary functions
+// as handlers.
+type HandlerFunc func(s *Session, req *Message) (*Message, error)
+
+// Serve calls f(s, req).
+func (f HandlerFunc) Serve(s *Session, req *Message) (*Message, error) {
+	return f(s, req)
+}
+
+// A Server accepts client connections speaking the SysDB front-end protocol.
+// It handles the session startup and PING requests and passes all other
+// requests to its handler, including commands unknown to this package. If
+// there is no handler, such requests are answered with an ERROR message
+// "Unsupported command".
+type Server struct {
+	// Handler handles all requests after the session has been started.
+	Handler Handler
+	// Authenticate, if not nil, is called on session startup and rejects
+	// the session if it returns an error. Otherwise, all users are
+	// accepted.
+	Authenticate func(user string, c net.Conn) error
+
+	// TLSConfig, if not nil, enables clients to upgrade their connections
+	// to TLS before starting a session (see StartTLS).
+	TLSConfig *tls.Config
+	// RequireTLS rejects sessions on connections which have not been
+	// upgraded to TLS with the error message TLSRequired.
+	RequireTLS bool
+	// MaxVersion is the maximum protocol version supported by the server.
+	// It defaults to ProtocolVersion.
+	MaxVersion uint32
+
+	mu        sync.Mutex
+	listeners map[net.Listener]bool
+	conns     map[net.Conn]bool
+	closed    bool
+}
+
+// ErrServerClosed is returned by Serve after the server has been closed.
+var ErrServerClosed = sysdb.Errorf(sysdb.CodeClosed, "server closed")
+
+// ListenAndServe listens on the specified network address and serves
+// client connections (see Serve).
+func (srv *Server) ListenAndServe(network, addr string) error {
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		return err
+	}
+	return srv.Serve(l)
+}
+
+// Serve accepts client connections on l and handles each of them in a new
+// goroutine. It blocks until accepting a connection fails or the server is
+// closed, in which case it returns ErrServerClosed. The listener is closed
+// when Serve returns.
+func (srv *Server) Serve(l net.Listener) error {
+	defer l.Close()
+	srv.mu.Lock()
+	if srv.closed {
+		srv.mu.Unlock()
+		return ErrServerClosed
+	}
+	if srv.listeners == nil {
+		srv.listeners = make(map[net.Listener]bool)
+	}
+	srv.listeners[l] = true
+	srv.mu.Unlock()
+	defer func() {
+		srv.mu.Lock()
+		delete(srv.listeners, l)
+		srv.mu.Unlock()
+	}()
+
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			if srv.isClosed() {
+				return ErrServerClosed
+			}
+			return err
+		}
+		srv.mu.Lock()
+		if srv.closed {
+			srv.mu.Unlock()
+			c.Close()
+			return ErrServerClosed
+		}
+		if srv.conns == nil {
+			srv.conns = make(map[net.Conn]bool)
+		}
+		srv.conns[c] = true
+		srv.mu.Unlock()
+		go srv.serveConn(c)
+	}
+}
+
+// Close closes all listeners and active connections.
+func (srv *Server) Close() error {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	srv.closed = true
+	for l := range srv.listeners {
+		l.Close()
+	}
+	for c := range srv.conns {
+		c.Close()
+	}
+	return nil
+}
+
+func (srv *Server) isClosed() bool {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return srv.closed
+}
+
+// serveConn handles a single client connection until the client disconnects
+// or the server is closed.
+func (srv *Server) serveConn(nc net.Conn) {
+	// c is the current connection which may be upgraded to TLS.
+	c := nc
+	defer func() {
+		srv.mu.Lock()
+		delete(srv.conns, nc)
+		srv.mu.Unlock()
+		c.Close()
+	}()
+
+	var s *Session
+	version := uint32(BaseProtocolVersion)
+	for {
+		req, err := readRequest(c)
+		if err != nil {
+			return
+		}
+
+		var res *Message
+		_, isTLS := c.(*tls.Conn)
+		switch {
+		case req.Type == ConnectionStartTLS && s == nil && !isTLS:
+			if srv.TLSConfig == nil {
+				res = errorMessage("TLS not supported")
+				break
+			}
+			if err := Write(c, &Message{Type: ConnectionOK}); err != nil {
+				return
+			}
+			tc := tls.Server(c, srv.TLSConfig)
+			if err := tc.Handshake(); err != nil {
+				return
+			}
+			c = tc
+			continue
+		case req.Type == ConnectionVersion && s == nil:
+			res, version = srv.negotiate(req)
+		case req.Type == ConnectionStartup && s == nil && srv.RequireTLS && !isTLS:
+			res = errorMessage(TLSRequired)
+		case req.Type == ConnectionStartup && s == nil:
+			if res, s = srv.startup(c, string(req.Raw)); s != nil {
+				s.Version = version
+			}
+		case s == nil:
+			res = errorMessage("Authentication required")
+		case req.Type == ConnectionPing:
+			res = &Message{Type: ConnectionOK}
+		case req.Type == ConnectionStartup:
+			res = errorMessage("Session already started")
+		default:
+			res = serve(srv.Handler, s, req)
+		}
+		if err := Write(c, res); err != nil {
+			return
+		}
+	}
+}
+
+func (srv *Server) startup(c net.Conn, user string) (*Message, *Session) {
+	if srv.Authenticate != nil {
+		if err := srv.Authenticate(user, c); err != nil {
+			return errorMessage(err.Error()), nil
+		}
+	}
+	return &Message{Type: ConnectionOK}, &Session{User: user, Conn: c}
+}
+
+// negotiate handles a VERSION request and returns the reply and the
+// negotiated version.
+func (srv *Server) negotiate(req *Message) (*Message, uint32) {
+	if len(req.Raw) < 4 {
+		return errorMessage("Invalid VERSION request"), BaseProtocolVersion
+	}
+	v := nbo.Uint32(req.Raw[:4])
+	max := srv.MaxVersion
+	if max == 0 {
+		max = ProtocolVersion
+	}
+	if v > max {
+		v = max
+	}
+	if v < BaseProtocolVersion {
+		return errorMessage("Unsupported protocol version"), BaseProtocolVersion
+	}
+	res := &Message{Type: ConnectionOK, Raw: make([]byte, 4)}
+	nbo.PutUint32(res.Raw, v)
+	return res, v
+}
+
+func serve(h Handler, s *Session, req *Message) *Message {
+	if h == nil {
+		return errorMessage("Unsupported command")
+	}
+	res, err := h.Serve(s, req)
+	if err != nil {
+		return errorMessage(err.Error())
+	}
+	if res == nil {
+		return &Message{Type: ConnectionOK}
+	}
+	return res
+}
+
+func errorMessage(msg string) *Message {
+	return &Message{Type: ConnectionError, Raw: []byte(msg)}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,233 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package proto
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+func TestServer(t *testing.T) {
+	srv := &Server{
+		Handler: HandlerFunc(func(s *Session, req *Message) (*Message, error) {
+			switch string(req.Raw) {
+			case "fail":
+				return nil, errors.New("failed")
+			case "log":
+				if err := s.Log(sysdb.LogInfo, "working"); err != nil {
+					return nil, err
+				}
+				return nil, nil
+			}
+			return &Message{Type: ConnectionOK, Raw: []byte(s.User + ":" + string(req.Raw))}, nil
+		}),
+		Authenticate: func(user string, c net.Conn) error {
+			if user == "mallory" {
+				return errors.New("access denied")
+			}
+			return nil
+		},
+	}
+	l, err := net.Listen("unix", filepath.Join(t.TempDir(), "sock"))
+	if err != nil {
+		t.Fatalf("Listen() = %v", err)
+	}
+	done := make(chan error)
+	go func() { done <- srv.Serve(l) }()
+
+	c, err := net.Dial("unix", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial() = %v", err)
+	}
+	defer c.Close()
+
+	for _, test := range []struct {
+		req  *Message
+		want []Message
+	}{
+		{&Message{Type: ConnectionQuery, Raw: []byte("q")}, []Message{{ConnectionError, []byte("Authentication required")}}},
+		{&Message{Type: ConnectionStartup, Raw: []byte("mallory")}, []Message{{ConnectionError, []byte("access denied")}}},
+		{&Message{Type: ConnectionStartup, Raw: []byte("alice")}, []Message{{ConnectionOK, []byte{}}}},
+		{&Message{Type: ConnectionStartup, Raw: []byte("bob")}, []Message{{ConnectionError, []byte("Session already started")}}},
+		{&Message{Type: ConnectionPing}, []Message{{ConnectionOK, []byte{}}}},
+		{&Message{Type: ConnectionQuery, Raw: []byte("q")}, []Message{{ConnectionOK, []byte("alice:q")}}},
+		{&Message{Type: ConnectionQuery, Raw: []byte("fail")}, []Message{{ConnectionError, []byte("failed")}}},
+		{&Message{Type: ConnectionQuery, Raw: []byte("log")}, []Message{
+			{ConnectionLog, []byte("\x00\x00\x00\x06working")},
+			{ConnectionOK, []byte{}},
+		}},
+		// Commands unknown to this package are passed to the handler.
+		{&Message{Type: Status(4711), Raw: []byte("new")}, []Message{{ConnectionOK, []byte("alice:new")}}},
+		{&Message{Type: ConnectionPing}, []Message{{ConnectionOK, []byte{}}}},
+	} {
+		if err := Write(c, test.req); err != nil {
+			t.Fatalf("Write(%v) = %v", test.req, err)
+		}
+		for _, want := range test.want {
+			res, err := Read(c)
+			if err != nil || res.Type != want.Type || string(res.Raw) != string(want.Raw) {
+				t.Errorf("Request %d %q: Read() = %v, %v; want %v, <nil>", test.req.Type, test.req.Raw, res, err, want)
+			}
+		}
+	}
+
+	srv.Close()
+	if err := <-done; err != ErrServerClosed {
+		t.Errorf("Serve() = %v; want %v", err, ErrServerClosed)
+	}
+	if res, err := Read(c); err == nil {
+		t.Errorf("Read() after Close() = %v, <nil>; want error", res)
+	}
+}
+
+func TestServerUnsupportedCommand(t *testing.T) {
+	srv := &Server{}
+	l, err := net.Listen("unix", filepath.Join(t.TempDir(), "sock"))
+	if err != nil {
+		t.Fatalf("Listen() = %v", err)
+	}
+	defer srv.Close()
+	go srv.Serve(l)
+
+	c, err := net.Dial("unix", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial() = %v", err)
+	}
+	defer c.Close()
+
+	for _, test := range []struct {
+		req  *Message
+		want Message
+	}{
+		{&Message{Type: ConnectionStartup, Raw: []byte("alice")}, Message{ConnectionOK, []byte{}}},
+		{&Message{Type: Status(4711), Raw: []byte("new")}, Message{ConnectionError, []byte("Unsupported command")}},
+		{&Message{Type: ConnectionQuery, Raw: []byte("q")}, Message{ConnectionError, []byte("Unsupported command")}},
+		{&Message{Type: ConnectionPing}, Message{ConnectionOK, []byte{}}},
+	} {
+		if err := Write(c, test.req); err != nil {
+			t.Fatalf("Write(%v) = %v", test.req, err)
+		}
+		res, err := Read(c)
+		if err != nil || res.Type != test.want.Type || string(res.Raw) != string(test.want.Raw) {
+			t.Errorf("Request %d %q: Read() = %v, %v; want %v, <nil>", test.req.Type, test.req.Raw, res, err, test.want)
+		}
+	}
+
+	// Oversized requests are still rejected, closing the connection.
+	hdr := make([]byte, 8)
+	nbo.PutUint32(hdr[:4], 4711)
+	nbo.PutUint32(hdr[4:], uint32(MaxMessageSize+1))
+	if _, err := c.Write(hdr); err != nil {
+		t.Fatalf("Write(<oversized>) = %v", err)
+	}
+	if res, err := Read(c); err == nil {
+		t.Errorf("Read() after oversized request = %v, <nil>; want error", res)
+	}
+}
+
+func TestStartTLSUnsupported(t *testing.T) {
+	srv := &Server{}
+	l, err := net.Listen("unix", filepath.Join(t.TempDir(), "sock"))
+	if err != nil {
+		t.Fatalf("Listen() = %v", err)
+	}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	c, err := net.Dial("unix", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial() = %v", err)
+	}
+	defer c.Close()
+
+	if tc, err := StartTLS(c, &tls.Config{}); sysdb.ErrorCode(err) != sysdb.CodeUnsupported {
+		t.Errorf("StartTLS(<unsupported>) = %v, %v; want <error %v>", tc, err, sysdb.CodeUnsupported)
+	}
+	// The connection may still be used.
+	if err := Write(c, &Message{Type: ConnectionStartup, Raw: []byte("u")}); err != nil {
+		t.Fatalf("Write(STARTUP) = %v", err)
+	}
+	if res, err := Read(c); err != nil || res.Type != ConnectionOK {
+		t.Errorf("STARTUP after failed StartTLS = %v, %v; want OK", res, err)
+	}
+}
+
+func TestNegotiateVersion(t *testing.T) {
+	versions := make(chan uint32, 1)
+	srv := &Server{
+		Handler: HandlerFunc(func(s *Session, req *Message) (*Message, error) {
+			versions <- s.Version
+			return nil, nil
+		}),
+		MaxVersion: 3,
+	}
+	l, err := net.Listen("unix", filepath.Join(t.TempDir(), "sock"))
+	if err != nil {
+		t.Fatalf("Listen() = %v", err)
+	}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	for _, test := range []struct {
+		max  uint32
+		want uint32
+	}{
+		{1, 1},
+		{2, 2},
+		{5, 3},
+	} {
+		c, err := net.Dial("unix", l.Addr().String())
+		if err != nil {
+			t.Fatalf("Dial() = %v", err)
+		}
+		if v, err := NegotiateVersion(c, test.max); err != nil || v != test.want {
+			t.Errorf("NegotiateVersion(%d) = %d, %v; want %d, <nil>", test.max, v, err, test.want)
+		}
+		Write(c, &Message{Type: ConnectionStartup, Raw: []byte("u")})
+		Read(c)
+		Write(c, &Message{Type: ConnectionQuery})
+		Read(c)
+		if v := <-versions; v != test.want {
+			t.Errorf("Session.Version = %d; want %d", v, test.want)
+		}
+		c.Close()
+	}
+
+	// Servers not supporting negotiation reply with an error.
+	var rw bytes.Buffer
+	Write(&rw, &Message{Type: ConnectionError, Raw: []byte("Authentication required")})
+	if v, err := NegotiateVersion(&rw, 3); err != nil || v != BaseProtocolVersion {
+		t.Errorf("NegotiateVersion(<unsupported>) = %d, %v; want %d, <nil>", v, err, BaseProtocolVersion)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,76 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package proto
+
+import (
+	"fmt"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+// A ServerVersion is the version of a SysDB server as returned in reply to
+// a ConnectionServerVersion request.
+type ServerVersion struct {
+	Major, Minor, Patch int
+	// Extra is additional version information (e.g. a version control
+	// revision).
+	Extra string
+}
+
+// String returns the version in the format used by SysDB (e.g. "0.8.0").
+func (v ServerVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d%s", v.Major, v.Minor, v.Patch, v.Extra)
+}
+
+// EncodeVersion returns the ConnectionOK reply to a ConnectionServerVersion
+// request carrying v. The version is encoded as a single number
+// (major * 10000 + minor * 100 + patch), so minor and patch have to be less
+// than 100.
+func EncodeVersion(v ServerVersion) *Message {
+	raw := make([]byte, 4+len(v.Extra))
+	nbo.PutUint32(raw[:4], uint32(10000*v.Major+100*v.Minor+v.Patch))
+	copy(raw[4:], v.Extra)
+	return &Message{Type: ConnectionOK, Raw: raw}
+}
+
+// DecodeVersion decodes the reply m to a ConnectionServerVersion request.
+func DecodeVersion(m *Message) (ServerVersion, error) {
+	if m.Type != ConnectionOK {
+		return ServerVersion{}, sysdb.Errorf(sysdb.CodeUnexpectedMessage, "SERVER_VERSION command failed with status %s", m.Type)
+	}
+	if err := ValidateReply(ConnectionServerVersion, m); err != nil {
+		return ServerVersion{}, err
+	}
+	version := int(nbo.Uint32(m.Raw[:4]))
+	return ServerVersion{
+		Major: version / 10000,
+		Minor: version / 100 % 100,
+		Patch: version % 100,
+		Extra: string(m.Raw[4:]),
+	}, nil
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,70 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package proto
+
+import (
+	"testing"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+func TestServerVersion(t *testing.T) {
+	for _, test := range []struct {
+		v    ServerVersion
+		want string
+	}{
+		{ServerVersion{}, "0.0.0"},
+		{ServerVersion{Major: 0, Minor: 8, Patch: 0}, "0.8.0"},
+		{ServerVersion{Major: 1, Minor: 23, Patch: 45, Extra: ".git"}, "1.23.45.git"},
+	} {
+		if got := test.v.String(); got != test.want {
+			t.Errorf("%#v.String() = %q; want %q", test.v, got, test.want)
+		}
+		got, err := DecodeVersion(EncodeVersion(test.v))
+		if err != nil || got != test.v {
+			t.Errorf("DecodeVersion(EncodeVersion(%s)) = %#v, %v; want %#v, <nil>", test.v, got, err, test.v)
+		}
+	}
+
+	m := &Message{Type: ConnectionOK, Raw: []byte{0, 0, 31, 64}} // 0.80.0
+	if got, err := DecodeVersion(m); err != nil || got.String() != "0.80.0" {
+		t.Errorf("DecodeVersion(8000) = %s, %v; want 0.80.0, <nil>", got, err)
+	}
+
+	for _, test := range []struct {
+		m    *Message
+		code sysdb.Code
+	}{
+		{&Message{Type: ConnectionError, Raw: []byte("failed")}, sysdb.CodeUnexpectedMessage},
+		{&Message{Type: ConnectionOK, Raw: []byte{1, 2}}, sysdb.CodeMalformedMessage},
+	} {
+		if got, err := DecodeVersion(test.m); sysdb.ErrorCode(err) != test.code {
+			t.Errorf("DecodeVersion(%v) = %s, %v; want <code %v>", test.m, got, err, test.code)
+		}
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
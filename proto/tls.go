@@ -0,0 +1,69 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package proto
+
+import (
+	"crypto/tls"
+	"net"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+// TLSRequired is the error message sent by servers requiring TLS in reply to
+// a session startup on a plain-text connection.
+const TLSRequired = "TLS required"
+
+// StartTLS upgrades the plain-text connection c to TLS using the specified
+// configuration. It has to be called before starting a session. The server
+// acknowledges the request before both sides perform the TLS handshake,
+// allowing a single listener to serve plain-text and TLS connections.
+//
+// If the server does not support TLS, an error of code sysdb.CodeUnsupported
+// is returned and c may still be used without TLS.
+func StartTLS(c net.Conn, cfg *tls.Config) (*tls.Conn, error) {
+	if err := Write(c, &Message{Type: ConnectionStartTLS}); err != nil {
+		return nil, err
+	}
+	res, err := Read(c)
+	if err != nil {
+		return nil, err
+	}
+	switch res.Type {
+	case ConnectionOK:
+	case ConnectionError:
+		return nil, sysdb.Errorf(sysdb.CodeUnsupported, "failed to start TLS: %s", string(res.Raw))
+	default:
+		return nil, sysdb.Errorf(sysdb.CodeUnexpectedMessage, "failed to start TLS: unexpected reply %s", res.Type)
+	}
+
+	tc := tls.Client(c, cfg)
+	if err := tc.Handshake(); err != nil {
+		return nil, err
+	}
+	return tc, nil
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
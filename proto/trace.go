@@ -0,0 +1,211 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package proto
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+// MaxTraceBody is the maximum number of bytes of a message body logged by a
+// Tracer. Longer bodies are truncated.
+var MaxTraceBody = 4096
+
+// A Tracer logs messages exchanged on a connection in a human readable form
+// for debugging purposes. Each message is logged with its direction ('>' for
+// sent and '<' for received messages), type, and size, followed by its body
+// as pretty-printed JSON, a quoted string, or a hex dump, for example:
+//
+//	> QUERY (11 bytes) "LIST hosts;"
+//	< DATA (27 bytes) LIST [
+//	  {
+//	    "name": "h1"
+//	  }
+//	]
+type Tracer struct {
+	// Out receives the trace.
+	Out io.Writer
+	// Server indicates that the tracer is used by a server, that is, sent
+	// messages are replies and received messages are requests.
+	Server bool
+
+	mu sync.Mutex
+}
+
+// Read reads a message from r as Read does and logs it.
+func (t *Tracer) Read(r io.Reader) (*Message, error) {
+	m, err := Read(r)
+	if err == nil {
+		t.Trace(false, m)
+	}
+	return m, err
+}
+
+// Write writes m to w as Write does and logs it.
+func (t *Tracer) Write(w io.Writer, m *Message) error {
+	t.Trace(true, m)
+	return Write(w, m)
+}
+
+// Conn returns a connection wrapping c which logs all messages sent or
+// received on c. When tracing TLS connections, wrap the TLS connection to log
+// the plain-text messages.
+func (t *Tracer) Conn(c net.Conn) net.Conn {
+	return &traceConn{Conn: c, t: t}
+}
+
+// Trace logs the message m which has been sent or received.
+func (t *Tracer) Trace(sent bool, m *Message) {
+	dir := "<"
+	if sent {
+		dir = ">"
+	}
+	request := sent != t.Server
+	name := m.Type.String()
+	if request {
+		name = m.Type.CommandString()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fmt.Fprintf(t.Out, "%s %s (%d bytes)%s\n", dir, name, len(m.Raw), formatBody(m, request))
+}
+
+// formatBody returns the human readable representation of the body of m
+// including a leading separator.
+func formatBody(m *Message, request bool) string {
+	raw := m.Raw
+	if len(raw) == 0 {
+		return ""
+	}
+
+	prefix := ""
+	if !request && len(raw) >= 4 {
+		switch m.Type {
+		case ConnectionData, ConnectionDataChunk:
+			prefix = " " + Status(nbo.Uint32(raw[:4])).CommandString()
+			raw = raw[4:]
+			if len(raw) <= MaxTraceBody && !isBinary(raw) {
+				var buf bytes.Buffer
+				if err := json.Indent(&buf, raw, "", "  "); err == nil {
+					return prefix + " " + buf.String()
+				}
+			}
+		case ConnectionLog:
+			prefix = " " + sysdb.LogPriority(nbo.Uint32(raw[:4])).String()
+			raw = raw[4:]
+		}
+	}
+
+	var more string
+	if len(raw) > MaxTraceBody {
+		more = fmt.Sprintf(" ... (%d more bytes)", len(raw)-MaxTraceBody)
+		raw = raw[:MaxTraceBody]
+	}
+	if isText(raw) {
+		return prefix + " " + strconv.Quote(string(raw)) + more
+	}
+	return prefix + "\n" + strings.TrimSuffix(hex.Dump(raw), "\n") + more
+}
+
+// isText reports whether b is printable UTF-8 text.
+func isText(b []byte) bool {
+	if !utf8.Valid(b) {
+		return false
+	}
+	for _, r := range string(b) {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// A frameBuffer assembles messages from a stream of bytes.
+type frameBuffer struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+// feed adds p to the buffer and returns all completed messages.
+func (b *frameBuffer) feed(p []byte) []*Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.buf = append(b.buf, p...)
+	var msgs []*Message
+	for len(b.buf) >= 8 {
+		l := uint64(nbo.Uint32(b.buf[4:8]))
+		if uint64(len(b.buf)-8) < l {
+			break
+		}
+		raw := make([]byte, l)
+		copy(raw, b.buf[8:])
+		msgs = append(msgs, &Message{Type: Status(nbo.Uint32(b.buf[:4])), Raw: raw})
+		b.buf = b.buf[8+l:]
+	}
+	if len(b.buf) == 0 {
+		b.buf = nil
+	}
+	return msgs
+}
+
+// A traceConn logs all messages exchanged on a connection.
+type traceConn struct {
+	net.Conn
+	t *Tracer
+
+	in, out frameBuffer
+}
+
+func (c *traceConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	for _, m := range c.in.feed(p[:n]) {
+		c.t.Trace(false, m)
+	}
+	return n, err
+}
+
+func (c *traceConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	for _, m := range c.out.feed(p[:n]) {
+		c.t.Trace(true, m)
+	}
+	return n, err
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,109 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package proto
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+func TestTracer(t *testing.T) {
+	var out bytes.Buffer
+	tr := &Tracer{Out: &out}
+
+	log := EncodeLog(LogMessage{Priority: sysdb.LogWarning, Message: "careful"})
+	data := &Message{Type: ConnectionData, Raw: append([]byte{0, 0, 0, 4}, `{"name":"h1"}`...)}
+
+	for _, test := range []struct {
+		sent bool
+		m    *Message
+		want string
+	}{
+		{true, &Message{Type: ConnectionQuery, Raw: []byte("LIST hosts;")}, `> QUERY (11 bytes) "LIST hosts;"` + "\n"},
+		{false, &Message{Type: ConnectionOK}, "< OK (0 bytes)\n"},
+		{false, log, `< LOG (11 bytes) WARNING "careful"` + "\n"},
+		{false, data, "< DATA (17 bytes) FETCH {\n  \"name\": \"h1\"\n}\n"},
+		{true, &Message{Type: ConnectionVersion, Raw: []byte{0, 0, 0, 2}}, "> VERSION (4 bytes)\n" +
+			"00000000  00 00 00 02                                       |....|\n"},
+	} {
+		out.Reset()
+		tr.Trace(test.sent, test.m)
+		if got := out.String(); got != test.want {
+			t.Errorf("Trace(%v, %v) wrote %q; want %q", test.sent, test.m, got, test.want)
+		}
+	}
+
+	out.Reset()
+	tr.Server = true
+	tr.Trace(false, &Message{Type: ConnectionStartup, Raw: []byte("user")})
+	if got, want := out.String(), "< STARTUP (4 bytes) \"user\"\n"; got != want {
+		t.Errorf("Trace(<server>, STARTUP) wrote %q; want %q", got, want)
+	}
+
+	out.Reset()
+	tr.Trace(true, &Message{Type: ConnectionError, Raw: []byte(strings.Repeat("x", MaxTraceBody+3))})
+	if got, want := out.String(), "... (3 more bytes)\n"; !strings.HasSuffix(got, want) {
+		t.Errorf("Trace(<long message>) wrote %q; want suffix %q", got, want)
+	}
+}
+
+func TestTraceConn(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	var out bytes.Buffer
+	c := (&Tracer{Out: &out}).Conn(client)
+	defer c.Close()
+
+	go func() {
+		req, err := Read(server)
+		if err != nil {
+			return
+		}
+		// Split the reply into multiple writes.
+		var buf bytes.Buffer
+		Write(&buf, &Message{Type: ConnectionError, Raw: req.Raw})
+		for _, b := range buf.Bytes() {
+			server.Write([]byte{b})
+		}
+	}()
+
+	if err := Write(c, &Message{Type: ConnectionQuery, Raw: []byte("X")}); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+	if _, err := Read(c); err != nil {
+		t.Fatalf("Read() = %v", err)
+	}
+	if got, want := out.String(), "> QUERY (1 bytes) \"X\"\n< ERROR (1 bytes) \"X\"\n"; got != want {
+		t.Errorf("Trace = %q; want %q", got, want)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,132 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package proto
+
+import (
+	"fmt"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+// A ValidationError describes a malformed message. It wraps an error of code
+// sysdb.CodeUnexpectedMessage for messages of unknown type and of code
+// sysdb.CodeMalformedMessage otherwise.
+type ValidationError struct {
+	// Type is the type of the invalid message.
+	Type Status
+	// Request indicates whether the message is a request rather than a
+	// reply.
+	Request bool
+	// Reason describes the problem.
+	Reason string
+
+	err error
+}
+
+// Error implements the error interface.
+func (e *ValidationError) Error() string {
+	name := e.Type.String()
+	if e.Request {
+		name = e.Type.CommandString()
+	}
+	return fmt.Sprintf("invalid %s message: %s", name, e.Reason)
+}
+
+// Unwrap returns an error carrying the code of the validation error.
+func (e *ValidationError) Unwrap() error { return e.err }
+
+var (
+	errUnknownType = sysdb.Errorf(sysdb.CodeUnexpectedMessage, "unknown message type")
+	errMalformed   = sysdb.Errorf(sysdb.CodeMalformedMessage, "malformed message")
+)
+
+func invalid(m *Message, request bool, format string, args ...interface{}) error {
+	return &ValidationError{Type: m.Type, Request: request, Reason: fmt.Sprintf(format, args...), err: errMalformed}
+}
+
+func unknown(m *Message, request bool) error {
+	return &ValidationError{Type: m.Type, Request: request, Reason: "unknown type", err: errUnknownType}
+}
+
+// minReplySize is the minimum size of the body of replies by type.
+var minReplySize = map[Status]int{
+	ConnectionOK:        0,
+	ConnectionError:     0,
+	ConnectionLog:       4, // priority
+	ConnectionData:      4, // command
+	ConnectionDataChunk: 4, // command
+}
+
+// Validate checks that the reply m is of a known type and that its body
+// satisfies the constraints of that type (e.g. DATA messages start with the
+// command they reply to). It returns a *ValidationError otherwise.
+func Validate(m *Message) error {
+	min, ok := minReplySize[m.Type]
+	if !ok {
+		return unknown(m, false)
+	}
+	if len(m.Raw) < min {
+		return invalid(m, false, "body too short (%d bytes; minimum: %d)", len(m.Raw), min)
+	}
+	return nil
+}
+
+// ValidateReply is like Validate but further checks that m is a valid reply
+// to a command of type cmd, e.g. that DATA messages carry the result of that
+// command and that replies to SERVER_VERSION include the version.
+func ValidateReply(cmd Status, m *Message) error {
+	if err := Validate(m); err != nil {
+		return err
+	}
+	switch m.Type {
+	case ConnectionData, ConnectionDataChunk:
+		// QUERY replies carry the result of the command included in the
+		// query.
+		if got := Status(nbo.Uint32(m.Raw[:4])); cmd != ConnectionQuery && got != cmd {
+			return invalid(m, false, "reply to %s carries the result of %s", cmd.CommandString(), got.CommandString())
+		}
+	case ConnectionOK:
+		if (cmd == ConnectionServerVersion || cmd == ConnectionVersion) && len(m.Raw) < 4 {
+			return invalid(m, false, "reply to %s too short (%d bytes; minimum: 4)", cmd.CommandString(), len(m.Raw))
+		}
+	}
+	return nil
+}
+
+// ValidateRequest checks that the request m is of a known type and that its
+// body satisfies the constraints of that type. It returns a
+// *ValidationError otherwise.
+func ValidateRequest(m *Message) error {
+	if _, ok := commandNames[m.Type]; !ok {
+		return unknown(m, true)
+	}
+	if m.Type == ConnectionVersion && len(m.Raw) < 4 {
+		return invalid(m, true, "body too short (%d bytes; minimum: 4)", len(m.Raw))
+	}
+	return nil
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
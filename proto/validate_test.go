@@ -0,0 +1,99 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package proto
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+func TestValidate(t *testing.T) {
+	data := func(cmd Status) *Message {
+		m := &Message{Type: ConnectionData, Raw: make([]byte, 6)}
+		nbo.PutUint32(m.Raw, uint32(cmd))
+		copy(m.Raw[4:], "[]")
+		return m
+	}
+
+	for _, test := range []struct {
+		cmd  Status
+		m    *Message
+		code sysdb.Code
+	}{
+		{ConnectionPing, &Message{Type: ConnectionOK}, sysdb.CodeUnknown},
+		{ConnectionQuery, &Message{Type: ConnectionError, Raw: []byte("failed")}, sysdb.CodeUnknown},
+		{ConnectionQuery, &Message{Type: ConnectionLog, Raw: []byte{0, 0, 0, 1}}, sysdb.CodeUnknown},
+		{ConnectionQuery, &Message{Type: ConnectionLog, Raw: []byte{0, 0, 1}}, sysdb.CodeMalformedMessage},
+		{ConnectionQuery, data(ConnectionList), sysdb.CodeUnknown},
+		{ConnectionList, data(ConnectionList), sysdb.CodeUnknown},
+		{ConnectionFetch, data(ConnectionList), sysdb.CodeMalformedMessage},
+		{ConnectionQuery, &Message{Type: ConnectionData, Raw: []byte{0}}, sysdb.CodeMalformedMessage},
+		{ConnectionQuery, &Message{Type: ConnectionDataChunk}, sysdb.CodeMalformedMessage},
+		{ConnectionServerVersion, &Message{Type: ConnectionOK, Raw: []byte{0, 0, 1}}, sysdb.CodeMalformedMessage},
+		{ConnectionServerVersion, &Message{Type: ConnectionOK, Raw: []byte{0, 0, 1, 2}}, sysdb.CodeUnknown},
+		{ConnectionQuery, &Message{Type: ConnectionStore}, sysdb.CodeUnexpectedMessage},
+		{ConnectionQuery, &Message{Type: Status(4711)}, sysdb.CodeUnexpectedMessage},
+	} {
+		err := ValidateReply(test.cmd, test.m)
+		if sysdb.ErrorCode(err) != test.code || (test.code == sysdb.CodeUnknown) != (err == nil) {
+			t.Errorf("ValidateReply(%s, %v) = %v; want <code %v>", test.cmd.CommandString(), test.m, err, test.code)
+		}
+		var ve *ValidationError
+		if err != nil && (!errors.As(err, &ve) || ve.Type != test.m.Type || ve.Request) {
+			t.Errorf("ValidateReply(%s, %v) = %#v; want *ValidationError", test.cmd.CommandString(), test.m, err)
+		}
+	}
+
+	if err := Validate(data(ConnectionFetch)); err != nil {
+		t.Errorf("Validate(<DATA>) = %v; want <nil>", err)
+	}
+}
+
+func TestValidateRequest(t *testing.T) {
+	for _, test := range []struct {
+		m    *Message
+		code sysdb.Code
+	}{
+		{&Message{Type: ConnectionPing}, sysdb.CodeUnknown},
+		{&Message{Type: ConnectionQuery, Raw: []byte("LIST hosts;")}, sysdb.CodeUnknown},
+		{&Message{Type: ConnectionVersion, Raw: []byte{0, 0, 0, 2}}, sysdb.CodeUnknown},
+		{&Message{Type: ConnectionVersion, Raw: []byte{2}}, sysdb.CodeMalformedMessage},
+		{&Message{Type: ConnectionDataChunk + 1}, sysdb.CodeUnexpectedMessage},
+		{&Message{Type: Status(4711)}, sysdb.CodeUnexpectedMessage},
+	} {
+		err := ValidateRequest(test.m)
+		if sysdb.ErrorCode(err) != test.code || (test.code == sysdb.CodeUnknown) != (err == nil) {
+			t.Errorf("ValidateRequest(%v) = %v; want <code %v>", test.m, err, test.code)
+		}
+		if ve, ok := err.(*ValidationError); err != nil && (!ok || !ve.Request) {
+			t.Errorf("ValidateRequest(%v) = %#v; want *ValidationError", test.m, err)
+		}
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
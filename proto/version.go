@@ -0,0 +1,81 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package proto
+
+import (
+	"io"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+const (
+	// BaseProtocolVersion is the version of the protocol spoken by servers
+	// which do not support version negotiation.
+	BaseProtocolVersion = 1
+	// ChunkedDataVersion is the first version of the protocol supporting
+	// chunked DATA replies (see ConnectionDataChunk).
+	ChunkedDataVersion = 2
+	// BinaryTimeseriesVersion is the first version of the protocol
+	// supporting binary encoded timeseries (see MarshalBinary).
+	BinaryTimeseriesVersion = 3
+
+	// ProtocolVersion is the latest version of the protocol supported by
+	// this package.
+	ProtocolVersion = 3
+)
+
+// NegotiateVersion negotiates the protocol version with the server on rw
+// before starting a session. It sends the maximum version supported by the
+// client and returns the version chosen by the server which is never larger
+// than max. Servers not supporting version negotiation reply with an error
+// in which case BaseProtocolVersion is returned.
+func NegotiateVersion(rw io.ReadWriter, max uint32) (uint32, error) {
+	req := &Message{Type: ConnectionVersion, Raw: make([]byte, 4)}
+	nbo.PutUint32(req.Raw, max)
+	if err := Write(rw, req); err != nil {
+		return 0, err
+	}
+	res, err := Read(rw)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case res.Type == ConnectionError:
+		return BaseProtocolVersion, nil
+	case res.Type != ConnectionOK:
+		return 0, sysdb.Errorf(sysdb.CodeUnexpectedMessage, "unexpected reply %s to VERSION", res.Type)
+	}
+	if err := ValidateReply(ConnectionVersion, res); err != nil {
+		return 0, err
+	}
+	v := nbo.Uint32(res.Raw[:4])
+	if v < BaseProtocolVersion || v > max {
+		return 0, sysdb.Errorf(sysdb.CodeUnsupported, "server chose unsupported protocol version %d", v)
+	}
+	return v, nil
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,105 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package proto
+
+import (
+	"io"
+)
+
+// The default size of the buffer of a Writer.
+const defaultWriterSize = 4096
+
+// A Writer buffers messages written to an underlying writer, allowing to
+// send multiple (small) messages in a single write. Messages are written
+// once the buffer is full or when calling Flush.
+//
+// If an error occurs writing to the underlying writer, part of a message may
+// have been written and all further writes fail with the same error.
+type Writer struct {
+	w   io.Writer
+	buf []byte
+	err error
+}
+
+// NewWriter returns a Writer writing messages to w using a buffer of the
+// default size.
+func NewWriter(w io.Writer) *Writer {
+	return NewWriterSize(w, defaultWriterSize)
+}
+
+// NewWriterSize returns a Writer writing messages to w using a buffer of the
+// specified size in bytes. Messages larger than the buffer are written
+// directly.
+func NewWriterSize(w io.Writer, size int) *Writer {
+	if size <= 0 {
+		size = defaultWriterSize
+	}
+	return &Writer{w: w, buf: make([]byte, 0, size)}
+}
+
+// Buffered returns the number of bytes buffered but not yet written.
+func (w *Writer) Buffered() int {
+	return len(w.buf)
+}
+
+// WriteMessage adds m to the buffer, writing the buffered messages first if
+// m does not fit.
+func (w *Writer) WriteMessage(m *Message) error {
+	if w.err != nil {
+		return w.err
+	}
+
+	n := 8 + len(m.Raw)
+	if len(w.buf)+n > cap(w.buf) {
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	if n > cap(w.buf) {
+		if err := Write(w.w, m); err != nil {
+			w.err = err
+		}
+		return w.err
+	}
+	w.buf = appendFrame(w.buf, m)
+	return nil
+}
+
+// Flush writes all buffered messages to the underlying writer.
+func (w *Writer) Flush() error {
+	if w.err != nil || len(w.buf) == 0 {
+		return w.err
+	}
+	n, err := w.w.Write(w.buf)
+	if err == nil && n < len(w.buf) {
+		err = io.ErrShortWrite
+	}
+	w.buf = w.buf[:0]
+	w.err = err
+	return err
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,89 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package proto
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// A failingWriter fails all writes.
+type failingWriter struct{}
+
+var errWrite = errors.New("write failed")
+
+func (failingWriter) Write(p []byte) (int, error) { return 0, errWrite }
+
+func TestWriter(t *testing.T) {
+	var cw countingWriter
+	w := NewWriterSize(&cw, 64)
+
+	msgs := []*Message{
+		{Type: ConnectionQuery, Raw: []byte("LIST hosts;")},
+		{Type: ConnectionPing},
+		{Type: ConnectionQuery, Raw: []byte("FETCH host 'h1';")},
+	}
+	for _, m := range msgs {
+		if err := w.WriteMessage(m); err != nil {
+			t.Fatalf("WriteMessage(%v) = %v", m, err)
+		}
+	}
+	if len(cw.writes) != 0 || w.Buffered() != 51 {
+		t.Errorf("WriteMessage() wrote %d times (%d bytes buffered); want 0 (51 bytes buffered)", len(cw.writes), w.Buffered())
+	}
+
+	// Messages not fitting into the buffer flush it first.
+	msgs = append(msgs, &Message{Type: ConnectionQuery, Raw: []byte("LIST services;")})
+	w.WriteMessage(msgs[3])
+	large := &Message{Type: ConnectionQuery, Raw: bytes.Repeat([]byte("x"), 100)}
+	msgs = append(msgs, large)
+	w.WriteMessage(large)
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush() = %v", err)
+	}
+	if err := w.Flush(); err != nil || len(cw.writes) != 3 {
+		t.Errorf("Flush() = %v (%d writes); want <nil> (3 writes)", err, len(cw.writes))
+	}
+
+	r := NewReader(bytes.NewReader(bytes.Join(cw.writes, nil)))
+	for _, want := range msgs {
+		if m, err := r.ReadMessage(); err != nil || m.Type != want.Type || !bytes.Equal(m.Raw, want.Raw) {
+			t.Errorf("ReadMessage() = %v, %v; want %v, <nil>", m, err, want)
+		}
+	}
+
+	w = NewWriter(failingWriter{})
+	w.WriteMessage(msgs[0])
+	if err := w.Flush(); err != errWrite {
+		t.Errorf("Flush(<failing writer>) = %v; want %v", err, errWrite)
+	}
+	if err := w.WriteMessage(msgs[1]); err != errWrite {
+		t.Errorf("WriteMessage(<after failure>) = %v; want %v", err, errWrite)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
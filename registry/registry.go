@@ -0,0 +1,131 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package registry provides a registry of optional integrations.
+//
+// Integrations (timeseries fetchers, importers, exporters, etc.) register a
+// factory under a kind and a name when their package is initialized. Tools
+// may then instantiate them by name, for example based on a configuration
+// file, without depending on any specific integration:
+//
+//	import (
+//		"github.com/sysdb/go/registry"
+//		_ "github.com/sysdb/go/timeseries" // registers timeseries fetchers
+//	)
+//
+//	f, err := registry.New(registry.TimeseriesFetcher, "rrdtool",
+//		map[string]string{"dir": "/var/lib/collectd/rrd"})
+//
+// Users compile only the integrations they import. Integrations may further
+// be excluded using build tags as documented in the respective package, for
+// example:
+//
+//	go build -tags sysdb_no_rrd ./...
+//
+// All packages of this repository, including the integrations, only depend
+// on the Go standard library. Integrations requiring third-party
+// dependencies belong into separate repositories; they register themselves
+// the same way once imported.
+package registry
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+// A Kind identifies the type of values created by a factory.
+type Kind string
+
+// Kinds of integrations.
+const (
+	// A TimeseriesFetcher factory creates a client.TimeseriesFetcher.
+	TimeseriesFetcher = Kind("timeseries-fetcher")
+	// An Importer factory creates an integration feeding data into SysDB.
+	Importer = Kind("importer")
+	// An Exporter factory creates an integration publishing SysDB data.
+	Exporter = Kind("exporter")
+)
+
+// A Factory creates a new instance of an integration using the specified
+// configuration options.
+type Factory func(config map[string]string) (interface{}, error)
+
+var (
+	mu        sync.RWMutex
+	factories = make(map[Kind]map[string]Factory)
+)
+
+// Register makes a factory available under the specified kind and name. It
+// panics if a factory with that name has already been registered or if f is
+// nil.
+func Register(kind Kind, name string, f Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	if f == nil {
+		panic("registry: Register factory is nil")
+	}
+	if factories[kind] == nil {
+		factories[kind] = make(map[string]Factory)
+	}
+	if _, dup := factories[kind][name]; dup {
+		panic(fmt.Sprintf("registry: Register called twice for %s %q", kind, name))
+	}
+	factories[kind][name] = f
+}
+
+// Lookup returns the factory registered under the specified kind and name.
+func Lookup(kind Kind, name string) (Factory, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	f, ok := factories[kind][name]
+	return f, ok
+}
+
+// Names returns the sorted names of all factories of the specified kind.
+func Names(kind Kind) []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	var names []string
+	for name := range factories[kind] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New creates a new instance of the integration registered under the
+// specified kind and name.
+func New(kind Kind, name string, config map[string]string) (interface{}, error) {
+	f, ok := Lookup(kind, name)
+	if !ok {
+		return nil, sysdb.Errorf(sysdb.CodeUnsupported, "unknown %s %q", kind, name)
+	}
+	return f(config)
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
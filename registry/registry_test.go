@@ -0,0 +1,121 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package registry
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+func TestRegistry(t *testing.T) {
+	const kind = Kind("registry-test")
+	t.Cleanup(func() { unregister(kind) })
+	errFailing := errors.New("failing")
+	Register(kind, "b", func(config map[string]string) (interface{}, error) {
+		return config["v"], nil
+	})
+	Register(kind, "a", func(config map[string]string) (interface{}, error) {
+		return nil, errFailing
+	})
+
+	if got, want := Names(kind), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Names(%s) = %q; want %q", kind, got, want)
+	}
+	if got := Names(Kind("registry-test-unknown")); len(got) != 0 {
+		t.Errorf("Names(<unknown kind>) = %q; want none", got)
+	}
+
+	if f, ok := Lookup(kind, "b"); !ok || f == nil {
+		t.Errorf("Lookup(%s, b) = %v, %v; want <factory>, true", kind, f, ok)
+	}
+	for _, k := range []Kind{kind, Importer} {
+		if f, ok := Lookup(k, "c"); ok || f != nil {
+			t.Errorf("Lookup(%s, c) = %v, %v; want <nil>, false", k, f, ok)
+		}
+	}
+	// Names are scoped by kind.
+	if _, ok := Lookup(Exporter, "b"); ok {
+		t.Errorf("Lookup(%s, b) = _, true; want false", Exporter)
+	}
+
+	if v, err := New(kind, "b", map[string]string{"v": "value"}); err != nil || v != "value" {
+		t.Errorf("New(%s, b) = %v, %v; want value, <nil>", kind, v, err)
+	}
+	if v, err := New(kind, "a", nil); err != errFailing {
+		t.Errorf("New(%s, a) = %v, %v; want <nil>, %v", kind, v, err, errFailing)
+	}
+	if v, err := New(kind, "c", nil); sysdb.ErrorCode(err) != sysdb.CodeUnsupported {
+		t.Errorf("New(%s, c) = %v, %v; want <error %v>", kind, v, err, sysdb.CodeUnsupported)
+	}
+}
+
+func TestRegisterPanics(t *testing.T) {
+	const kind = Kind("registry-test-panics")
+	t.Cleanup(func() {
+		unregister(kind)
+		unregister(Kind("registry-test-panics-other"))
+	})
+	f := func(map[string]string) (interface{}, error) { return nil, nil }
+	Register(kind, "a", f)
+
+	for _, test := range []struct {
+		desc string
+		name string
+		f    Factory
+	}{
+		{"duplicate", "a", f},
+		{"nil factory", "b", nil},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Register(<%s>) did not panic", test.desc)
+				}
+			}()
+			Register(kind, test.name, test.f)
+		}()
+	}
+
+	// The original registration is unaffected.
+	if got, want := Names(kind), []string{"a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Names(%s) = %q; want %q", kind, got, want)
+	}
+	// The same name may be used for a different kind.
+	Register(Kind("registry-test-panics-other"), "a", f)
+}
+
+// unregister removes all factories of the specified kind so that tests may
+// be run repeatedly.
+func unregister(kind Kind) {
+	mu.Lock()
+	defer mu.Unlock()
+	delete(factories, kind)
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
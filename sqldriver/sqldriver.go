@@ -0,0 +1,318 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package sqldriver provides a database/sql driver for SysDB.
+//
+// The driver registers itself under the name "sysdb". The data source name
+// specifies the server address, optionally prefixed with a user name:
+//
+//	db, err := sql.Open("sysdb", "user@unix:/var/run/sysdbd.sock")
+//	if err != nil {
+//		// handle error
+//	}
+//	rows, err := db.Query("LOOKUP hosts MATCHING attribute.architecture = ?", "amd64")
+//
+// Queries may use '?' placeholders which will be replaced by the respective
+// arguments formatted as described for client.QueryString.
+//
+// Host lists and hosts are returned as rows with one row per host and the
+// columns name, last_update, update_interval, backends (a comma-separated
+// list), and attributes (a JSON encoded list). Service and metric lists are
+// returned the same way with an additional leading host column; metrics also
+// include a trailing timeseries column. Fetched services and metrics are
+// returned like lists of a single object. The layout is determined by the
+// query rather than by the structure of the reply. Timeseries are returned as one row
+// per data-point with the columns data_source, timestamp, and value.
+//
+// Transactions are not supported.
+package sqldriver
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sysdb/go/client"
+	"github.com/sysdb/go/proto"
+	"github.com/sysdb/go/sysdb"
+)
+
+func init() {
+	sql.Register("sysdb", &Driver{})
+}
+
+// Driver implements the driver.Driver interface.
+type Driver struct{}
+
+// Open opens a new connection to a SysDB server. See the package
+// documentation for the format of the data source name.
+func (d *Driver) Open(dsn string) (driver.Conn, error) {
+	user, addr := "", dsn
+	if i := strings.Index(dsn, "@"); i >= 0 {
+		user, addr = dsn[:i], dsn[i+1:]
+	}
+	c, err := client.Dial(addr, user)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{c: c}, nil
+}
+
+type conn struct {
+	c *client.Conn
+	// bad is set if the connection may be out of sync with the server.
+	bad bool
+}
+
+// IsValid implements the driver.Validator interface.
+func (c *conn) IsValid() bool { return !c.bad }
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	q, n := placeholders(query)
+	return &stmt{c: c, q: q, n: n}, nil
+}
+
+func (c *conn) Close() error {
+	c.c.Close()
+	return nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return nil, sysdb.Errorf(sysdb.CodeUnsupported, "transactions are not supported")
+}
+
+// placeholders turns '?' placeholders outside of string literals into
+// printf verbs and escapes all other percent signs. It returns the number of
+// placeholders.
+func placeholders(query string) (string, int) {
+	var b strings.Builder
+	n := 0
+	quoted := false
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+		case r == '%':
+			b.WriteRune('%')
+		case r == '?' && !quoted:
+			b.WriteString("%s")
+			n++
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String(), n
+}
+
+type stmt struct {
+	c *conn
+	q string
+	n int
+}
+
+func (s *stmt) Close() error  { return nil }
+func (s *stmt) NumInput() int { return s.n }
+
+func (s *stmt) call(args []driver.Value) (interface{}, error) {
+	a := make([]interface{}, len(args))
+	for i, v := range args {
+		if b, ok := v.([]byte); ok {
+			v = string(b)
+		}
+		a[i] = v
+	}
+	q, err := client.QueryString(s.q, a...)
+	if err != nil {
+		return nil, err
+	}
+
+	var st client.Stats
+	res, err := s.c.c.CallContext(client.WithStats(context.Background(), &st), &proto.Message{Type: proto.ConnectionQuery, Raw: []byte(q)})
+	if err != nil {
+		if st.Sent == 0 {
+			// The query has not reached the server, so database/sql may
+			// safely retry it on another connection.
+			return nil, driver.ErrBadConn
+		}
+		if sysdb.ErrorCode(err) != sysdb.CodeRequestFailed {
+			// The query may have been executed. Report the error but let
+			// database/sql discard the connection afterwards.
+			s.c.bad = true
+		}
+		return nil, err
+	}
+	defer proto.ReleaseMessage(res)
+	if res.Type != proto.ConnectionData {
+		return nil, nil
+	}
+	obj, err := client.DecodeQuery(q, res)
+	if err != nil {
+		return nil, err
+	}
+	switch o := obj.(type) {
+	case *sysdb.Service:
+		return sysdb.ServiceList{{Host: fetchedHost(res), Service: *o}}, nil
+	case *sysdb.Metric:
+		return sysdb.MetricList{{Host: fetchedHost(res), Metric: *o}}, nil
+	}
+	return obj, nil
+}
+
+// fetchedHost returns the name of the host including the service or metric
+// returned in reply to a FETCH command. It returns an empty string if the
+// server returned the object without its host.
+func fetchedHost(res *proto.Message) string {
+	var h sysdb.Host
+	if err := proto.Unmarshal(res, &h); err != nil || len(h.Services)+len(h.Metrics) == 0 {
+		return ""
+	}
+	return h.Name
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	if _, err := s.call(args); err != nil {
+		return nil, err
+	}
+	return driver.ResultNoRows, nil
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	obj, err := s.call(args)
+	if err != nil {
+		return nil, err
+	}
+
+	switch o := obj.(type) {
+	case nil:
+		return &rows{}, nil
+	case []sysdb.Host:
+		return hostRows(o)
+	case *sysdb.Host:
+		return hostRows([]sysdb.Host{*o})
+	case sysdb.ServiceList:
+		return serviceRows(o)
+	case sysdb.MetricList:
+		return metricRows(o)
+	case *sysdb.Timeseries:
+		return timeseriesRows(o), nil
+	}
+	return nil, sysdb.Errorf(sysdb.CodeUnsupported, "unsupported result type %T", obj)
+}
+
+type rows struct {
+	cols []string
+	data [][]driver.Value
+}
+
+func (r *rows) Columns() []string { return r.cols }
+func (r *rows) Close() error      { return nil }
+
+func (r *rows) Next(dest []driver.Value) error {
+	if len(r.data) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.data[0])
+	r.data = r.data[1:]
+	return nil
+}
+
+func hostRows(hosts []sysdb.Host) (driver.Rows, error) {
+	r := &rows{cols: []string{"name", "last_update", "update_interval", "backends", "attributes"}}
+	for _, h := range hosts {
+		attrs, err := json.Marshal(h.Attributes)
+		if err != nil {
+			return nil, err
+		}
+		r.data = append(r.data, []driver.Value{
+			h.Name,
+			time.Time(h.LastUpdate),
+			int64(h.UpdateInterval),
+			strings.Join(h.Backends, ","),
+			string(attrs),
+		})
+	}
+	return r, nil
+}
+
+func serviceRows(svcs sysdb.ServiceList) (driver.Rows, error) {
+	r := &rows{cols: []string{"host", "name", "last_update", "update_interval", "backends", "attributes"}}
+	for _, s := range svcs {
+		attrs, err := json.Marshal(s.Attributes)
+		if err != nil {
+			return nil, err
+		}
+		r.data = append(r.data, []driver.Value{
+			s.Host,
+			s.Name,
+			time.Time(s.LastUpdate),
+			int64(s.UpdateInterval),
+			strings.Join(s.Backends, ","),
+			string(attrs),
+		})
+	}
+	return r, nil
+}
+
+func metricRows(metrics sysdb.MetricList) (driver.Rows, error) {
+	r := &rows{cols: []string{"host", "name", "last_update", "update_interval", "backends", "attributes", "timeseries"}}
+	for _, m := range metrics {
+		attrs, err := json.Marshal(m.Attributes)
+		if err != nil {
+			return nil, err
+		}
+		r.data = append(r.data, []driver.Value{
+			m.Host,
+			m.Name,
+			time.Time(m.LastUpdate),
+			int64(m.UpdateInterval),
+			strings.Join(m.Backends, ","),
+			string(attrs),
+			m.Timeseries,
+		})
+	}
+	return r, nil
+}
+
+func timeseriesRows(ts *sysdb.Timeseries) driver.Rows {
+	r := &rows{cols: []string{"data_source", "timestamp", "value"}}
+	srcs := make([]string, 0, len(ts.Data))
+	for src := range ts.Data {
+		srcs = append(srcs, src)
+	}
+	sort.Strings(srcs)
+	for _, src := range srcs {
+		for _, p := range ts.Data[src] {
+			r.data = append(r.data, []driver.Value{src, time.Time(p.Timestamp), p.Value})
+		}
+	}
+	return r
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,272 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sqldriver
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/sysdb/go/client"
+	"github.com/sysdb/go/proto"
+	"github.com/sysdb/go/proto/prototest"
+	"github.com/sysdb/go/sysdb"
+)
+
+func TestPlaceholders(t *testing.T) {
+	for _, test := range []struct {
+		query string
+		want  string
+		n     int
+	}{
+		{"LIST hosts", "LIST hosts", 0},
+		{"FETCH host ?", "FETCH host %s", 1},
+		{"LOOKUP hosts MATCHING name = ? AND attribute.x = ?",
+			"LOOKUP hosts MATCHING name = %s AND attribute.x = %s", 2},
+		{"LOOKUP hosts MATCHING name =~ 'a?%' AND attribute.x = ?",
+			"LOOKUP hosts MATCHING name =~ 'a?%%' AND attribute.x = %s", 1},
+	} {
+		got, n := placeholders(test.query)
+		if got != test.want || n != test.n {
+			t.Errorf("placeholders(%q) = %q, %d; want %q, %d",
+				test.query, got, n, test.want, test.n)
+		}
+	}
+}
+
+func TestRows(t *testing.T) {
+	now := time.Unix(1e9, 0).UTC()
+	attrs := []sysdb.Attribute{{Name: "k", Value: "v", LastUpdate: sysdb.Time(now)}}
+	srv := prototest.NewServer()
+	defer srv.Close()
+	srv.HandleQuery("LIST hosts", prototest.Response{
+		Type: proto.ConnectionList,
+		Data: []sysdb.Host{
+			{Name: "h1", LastUpdate: sysdb.Time(now), UpdateInterval: sysdb.Duration(time.Minute), Backends: []string{"a", "b"}, Attributes: attrs},
+			{Name: "h2", LastUpdate: sysdb.Time(now)},
+		},
+	})
+	srv.HandleQuery("FETCH host 'h1'", prototest.Response{
+		Type: proto.ConnectionFetch,
+		Data: sysdb.Host{Name: "h1", LastUpdate: sysdb.Time(now)},
+	})
+	srv.HandleQuery("FETCH service 'h1'.'s1'", prototest.Response{
+		Type: proto.ConnectionFetch,
+		Data: sysdb.Host{Name: "h1", Services: []sysdb.Service{{Name: "s1", LastUpdate: sysdb.Time(now)}}},
+	})
+	srv.HandleQuery("LOOKUP services MATCHING name = 's1'", prototest.Response{
+		Type: proto.ConnectionLookup,
+		Data: []sysdb.Host{{Name: "h1", Services: []sysdb.Service{{Name: "s1", LastUpdate: sysdb.Time(now)}}}},
+	})
+	srv.HandleQuery("LIST services", prototest.Response{
+		Type: proto.ConnectionList,
+		Data: sysdb.ServiceList{{Host: "h1", Service: sysdb.Service{Name: "s1", LastUpdate: sysdb.Time(now), Backends: []string{"a"}}}},
+	})
+	srv.HandleQuery("LIST metrics", prototest.Response{
+		Type: proto.ConnectionList,
+		Data: sysdb.MetricList{{Host: "h1", Metric: sysdb.Metric{Name: "m1", LastUpdate: sysdb.Time(now), Timeseries: true}}},
+	})
+	srv.HandleQuery("TIMESERIES 'h1'.'m1'", prototest.Response{
+		Type: proto.ConnectionTimeseries,
+		Data: sysdb.Timeseries{
+			Start: sysdb.Time(now),
+			End:   sysdb.Time(now.Add(time.Minute)),
+			Data: map[string][]sysdb.DataPoint{
+				"value": {{Timestamp: sysdb.Time(now), Value: 1.5}, {Timestamp: sysdb.Time(now.Add(time.Minute)), Value: 2}},
+				"max":   {{Timestamp: sysdb.Time(now), Value: 3}},
+			},
+		},
+	})
+	srv.HandleQuery("STORE host 'h3'", prototest.Response{})
+
+	db, err := sql.Open("sysdb", "test@"+srv.Addr)
+	if err != nil {
+		t.Fatalf("Open() = %v", err)
+	}
+	defer db.Close()
+
+	for _, test := range []struct {
+		query string
+		cols  []string
+		want  [][]interface{}
+	}{
+		{
+			"LIST hosts",
+			[]string{"name", "last_update", "update_interval", "backends", "attributes"},
+			[][]interface{}{
+				{"h1", now, int64(time.Minute), "a,b", `[{"name":"k","value":"v","last_update":"2001-09-09 01:46:40 +0000","update_interval":"0s","backends":null}]`},
+				{"h2", now, int64(0), "", "null"},
+			},
+		},
+		{
+			"FETCH host 'h1'",
+			[]string{"name", "last_update", "update_interval", "backends", "attributes"},
+			[][]interface{}{{"h1", now, int64(0), "", "null"}},
+		},
+		{
+			"FETCH service 'h1'.'s1'",
+			[]string{"host", "name", "last_update", "update_interval", "backends", "attributes"},
+			[][]interface{}{{"h1", "s1", now, int64(0), "", "null"}},
+		},
+		{
+			"LOOKUP services MATCHING name = 's1'",
+			[]string{"host", "name", "last_update", "update_interval", "backends", "attributes"},
+			[][]interface{}{{"h1", "s1", now, int64(0), "", "null"}},
+		},
+		{
+			"LIST services",
+			[]string{"host", "name", "last_update", "update_interval", "backends", "attributes"},
+			[][]interface{}{{"h1", "s1", now, int64(0), "a", "null"}},
+		},
+		{
+			"LIST metrics",
+			[]string{"host", "name", "last_update", "update_interval", "backends", "attributes", "timeseries"},
+			[][]interface{}{{"h1", "m1", now, int64(0), "", "null", true}},
+		},
+		{
+			"TIMESERIES 'h1'.'m1'",
+			[]string{"data_source", "timestamp", "value"},
+			[][]interface{}{
+				{"max", now, 3.0},
+				{"value", now, 1.5},
+				{"value", now.Add(time.Minute), 2.0},
+			},
+		},
+		{"STORE host 'h3'", nil, nil},
+	} {
+		rows, err := db.Query(test.query)
+		if err != nil {
+			t.Errorf("Query(%q) = %v", test.query, err)
+			continue
+		}
+		cols, err := rows.Columns()
+		if err != nil || !equalStrings(cols, test.cols) {
+			t.Errorf("Query(%q).Columns() = %q, %v; want %q", test.query, cols, err, test.cols)
+		}
+
+		var got [][]interface{}
+		for rows.Next() {
+			vals := make([]interface{}, len(cols))
+			ptrs := make([]interface{}, len(cols))
+			for i := range vals {
+				ptrs[i] = &vals[i]
+			}
+			if err := rows.Scan(ptrs...); err != nil {
+				t.Errorf("Query(%q).Scan() = %v", test.query, err)
+			}
+			got = append(got, vals)
+		}
+		if err := rows.Err(); err != nil {
+			t.Errorf("Query(%q).Err() = %v", test.query, err)
+		}
+		rows.Close()
+
+		if len(got) != len(test.want) {
+			t.Errorf("Query(%q) returned %d rows; want %d", test.query, len(got), len(test.want))
+			continue
+		}
+		for i, row := range got {
+			for j, v := range row {
+				if !equalValue(v, test.want[i][j]) {
+					t.Errorf("Query(%q)[%d][%s] = %#v; want %#v", test.query, i, cols[j], v, test.want[i][j])
+				}
+			}
+		}
+	}
+
+	if rows, err := db.Query("LIST hosts FILTER"); sysdb.ErrorCode(err) != sysdb.CodeRequestFailed {
+		t.Errorf("Query(<failed>) = %v, %v; want <error %v>", rows, err, sysdb.CodeRequestFailed)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func equalValue(v, want interface{}) bool {
+	if t, ok := v.(time.Time); ok {
+		w, ok := want.(time.Time)
+		return ok && t.Equal(w)
+	}
+	return v == want
+}
+
+func TestBadConn(t *testing.T) {
+	srv := prototest.NewServer()
+	defer srv.Close()
+	// A reply the client fails to read after having sent the query.
+	srv.HandleQuery("STORE host 'h1'", prototest.Response{
+		Message: &proto.Message{Type: proto.ConnectionData, Raw: []byte{0}},
+	})
+	srv.HandleQuery("LIST hosts", prototest.Response{Type: proto.ConnectionList, Data: []sysdb.Host{}})
+
+	db, err := sql.Open("sysdb", "test@"+srv.Addr)
+	if err != nil {
+		t.Fatalf("Open() = %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec("STORE host 'h1'"); err == nil || err == driver.ErrBadConn {
+		t.Errorf("Exec(STORE) = %v; want <malformed reply error>", err)
+	}
+	if n := len(srv.Requests()); n != 1 {
+		t.Errorf("Exec(STORE) sent %d requests; want 1", n)
+	}
+	// The affected connection has been discarded.
+	rows, err := db.Query("LIST hosts")
+	if err != nil {
+		t.Fatalf("Query(<after failure>) = %v", err)
+	}
+	rows.Close()
+
+	// Queries which could not be sent may be retried.
+	c, err := client.Dial(srv.Addr, "test")
+	if err != nil {
+		t.Fatalf("Dial() = %v", err)
+	}
+	defer c.Close()
+	cn := &conn{c: c}
+	srv.Close()
+	c.Close()
+	if _, err := (&stmt{c: cn, q: "LIST hosts"}).call(nil); err != driver.ErrBadConn {
+		t.Errorf("call(<closed server>) = %v; want %v", err, driver.ErrBadConn)
+	}
+	if !cn.IsValid() {
+		t.Errorf("IsValid(<send failed>) = false; want true")
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,151 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sysdb
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+	"time"
+)
+
+// BinaryTimeseriesFormat is the first byte of the binary encoding of a
+// Timeseries. It allows to distinguish the encoding from JSON.
+const BinaryTimeseriesFormat = 0x01
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface. The
+// compact binary encoding consists of the format byte
+// (BinaryTimeseriesFormat), the start and end times, and the number of data
+// sources followed by each data source's name and data points. Strings are
+// prefixed by their length (uint16), times are encoded as nanoseconds since
+// the Unix epoch (int64), values as IEEE 754 binary64, and lists are
+// prefixed by their number of elements (uint32). All integers are in network
+// byte order.
+func (ts Timeseries) MarshalBinary() ([]byte, error) {
+	size := 1 + 8 + 8 + 4
+	srcs := make([]string, 0, len(ts.Data))
+	for src, points := range ts.Data {
+		if len(src) > math.MaxUint16 {
+			return nil, Errorf(CodeInvalidArgument, "data source name too long: %d bytes", len(src))
+		}
+		srcs = append(srcs, src)
+		size += 2 + len(src) + 4 + 16*len(points)
+	}
+	sort.Strings(srcs)
+
+	b := make([]byte, 0, size)
+	b = append(b, BinaryTimeseriesFormat)
+	b = binary.BigEndian.AppendUint64(b, uint64(time.Time(ts.Start).UnixNano()))
+	b = binary.BigEndian.AppendUint64(b, uint64(time.Time(ts.End).UnixNano()))
+	b = binary.BigEndian.AppendUint32(b, uint32(len(srcs)))
+	for _, src := range srcs {
+		b = binary.BigEndian.AppendUint16(b, uint16(len(src)))
+		b = append(b, src...)
+		b = binary.BigEndian.AppendUint32(b, uint32(len(ts.Data[src])))
+		for _, p := range ts.Data[src] {
+			b = binary.BigEndian.AppendUint64(b, uint64(time.Time(p.Timestamp).UnixNano()))
+			b = binary.BigEndian.AppendUint64(b, math.Float64bits(p.Value))
+		}
+	}
+	return b, nil
+}
+
+// A binaryReader consumes a binary encoding, recording the first error.
+type binaryReader struct {
+	b   []byte
+	err error
+}
+
+func (r *binaryReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.b) < n {
+		r.err = Errorf(CodeInvalidFormat, "binary timeseries truncated")
+		return nil
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *binaryReader) uint16() int {
+	if b := r.next(2); b != nil {
+		return int(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (r *binaryReader) uint32() int {
+	if b := r.next(4); b != nil {
+		return int(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (r *binaryReader) uint64() uint64 {
+	if b := r.next(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (r *binaryReader) time() Time {
+	return Time(time.Unix(0, int64(r.uint64())))
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface. See
+// MarshalBinary for the format.
+func (ts *Timeseries) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 || data[0] != BinaryTimeseriesFormat {
+		return Errorf(CodeInvalidFormat, "unknown binary timeseries format")
+	}
+	r := &binaryReader{b: data[1:]}
+	res := Timeseries{Start: r.time(), End: r.time(), Data: make(map[string][]DataPoint)}
+	for n := r.uint32(); n > 0 && r.err == nil; n-- {
+		src := string(r.next(r.uint16()))
+		count := r.uint32()
+		if r.err == nil && count > len(r.b)/16 {
+			return Errorf(CodeInvalidFormat, "binary timeseries truncated")
+		}
+		points := make([]DataPoint, count)
+		for i := range points {
+			points[i].Timestamp = r.time()
+			points[i].Value = math.Float64frombits(r.uint64())
+		}
+		res.Data[src] = points
+	}
+	if r.err != nil {
+		return r.err
+	}
+	if len(r.b) > 0 {
+		return Errorf(CodeInvalidFormat, "%d bytes of trailing data after binary timeseries", len(r.b))
+	}
+	*ts = res
+	return nil
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,86 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sysdb
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTimeseriesBinary(t *testing.T) {
+	start := Time(time.Date(2015, 5, 1, 12, 0, 0, 0, time.UTC))
+	end := Time(time.Date(2015, 5, 1, 13, 0, 0, 500, time.UTC))
+	for _, ts := range []Timeseries{
+		{Start: start, End: end, Data: map[string][]DataPoint{}},
+		{Start: start, End: end, Data: map[string][]DataPoint{
+			"value": {{start, 1.5}, {end, math.Inf(-1)}},
+			"other": {},
+		}},
+	} {
+		data, err := ts.MarshalBinary()
+		if err != nil {
+			t.Errorf("%v.MarshalBinary() = %v; want <nil>", ts, err)
+			continue
+		}
+		if data[0] != BinaryTimeseriesFormat {
+			t.Errorf("%v.MarshalBinary() = <format %#x>; want <format %#x>", ts, data[0], BinaryTimeseriesFormat)
+		}
+
+		var got Timeseries
+		if err := got.UnmarshalBinary(data); err != nil {
+			t.Errorf("UnmarshalBinary(%v) = %v; want <nil>", data, err)
+			continue
+		}
+		if !reflect.DeepEqual(normalize(got), normalize(ts)) {
+			t.Errorf("UnmarshalBinary(MarshalBinary(%v)) = %v", ts, got)
+		}
+
+		for i := 0; i < len(data); i++ {
+			if err := got.UnmarshalBinary(data[:i]); ErrorCode(err) != CodeInvalidFormat {
+				t.Errorf("UnmarshalBinary(<truncated to %d>) = %v; want <error %v>", i, err, CodeInvalidFormat)
+			}
+		}
+		if err := got.UnmarshalBinary(append(data, 0)); ErrorCode(err) != CodeInvalidFormat {
+			t.Errorf("UnmarshalBinary(<trailing data>) = %v; want <error %v>", err, CodeInvalidFormat)
+		}
+	}
+}
+
+// normalize converts all times of ts to UTC for comparison.
+func normalize(ts Timeseries) Timeseries {
+	ts.Start = Time(time.Time(ts.Start).UTC())
+	ts.End = Time(time.Time(ts.End).UTC())
+	for _, points := range ts.Data {
+		for i := range points {
+			points[i].Timestamp = Time(time.Time(points[i].Timestamp).UTC())
+		}
+	}
+	return ts
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,265 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sysdb
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// MarshalCanonical returns the canonical JSON encoding of v, which has to be
+// a store object (Host, Service, Metric, or Attribute), a list of hosts, a
+// ServiceList, a MetricList, a HostService, a HostMetric, or a Timeseries, or
+// a pointer to any of them.
+//
+// The canonical encoding is deterministic: equal objects are encoded into
+// identical bytes regardless of the order of their children or the location
+// of their timestamps. That allows to compare snapshots byte-by-byte or to
+// use them as golden files in tests. To achieve that, objects are normalized
+// (see Host.Normalize), lists of objects are sorted by (host) name,
+// timeseries data points are sorted by timestamp, all times are converted to
+// UTC, and empty lists are encoded as null. Fields are encoded in the order
+// of their declaration, one per line, indented using tabs. The encoding ends
+// with a newline.
+//
+// The canonical encoding is a valid SysDB JSON encoding, that is, it may be
+// decoded using encoding/json. v is not modified.
+func MarshalCanonical(v interface{}) ([]byte, error) {
+	var c interface{}
+	switch v := v.(type) {
+	case Attribute:
+		c = canonicalAttribute(v)
+	case *Attribute:
+		c = canonicalAttribute(*v)
+	case Metric:
+		c = canonicalMetric(v)
+	case *Metric:
+		c = canonicalMetric(*v)
+	case Service:
+		c = canonicalService(v)
+	case *Service:
+		c = canonicalService(*v)
+	case Host:
+		c = canonicalHost(v)
+	case *Host:
+		c = canonicalHost(*v)
+	case []Host:
+		c = canonicalHosts(v)
+	case *[]Host:
+		c = canonicalHosts(*v)
+	case HostService:
+		c = HostService{Host: v.Host, Service: canonicalService(v.Service)}
+	case *HostService:
+		c = HostService{Host: v.Host, Service: canonicalService(v.Service)}
+	case HostMetric:
+		c = HostMetric{Host: v.Host, Metric: canonicalMetric(v.Metric)}
+	case *HostMetric:
+		c = HostMetric{Host: v.Host, Metric: canonicalMetric(v.Metric)}
+	case ServiceList:
+		c = canonicalServiceList(v)
+	case *ServiceList:
+		c = canonicalServiceList(*v)
+	case MetricList:
+		c = canonicalMetricList(v)
+	case *MetricList:
+		c = canonicalMetricList(*v)
+	case Timeseries:
+		c = canonicalTimeseries(v)
+	case *Timeseries:
+		c = canonicalTimeseries(*v)
+	default:
+		return nil, Errorf(CodeUnsupported, "no canonical encoding for type %T", v)
+	}
+	data, err := json.MarshalIndent(c, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func canonicalTime(t Time) Time {
+	return Time(time.Time(t).UTC())
+}
+
+func canonicalStrings(s []string) []string {
+	if len(s) == 0 {
+		return nil
+	}
+	return s
+}
+
+func canonicalAttribute(a Attribute) Attribute {
+	a = a.Clone()
+	a.Normalize()
+	canonicalizeAttribute(&a)
+	return a
+}
+
+func canonicalMetric(m Metric) Metric {
+	m = m.Clone()
+	m.Normalize()
+	canonicalizeMetric(&m)
+	return m
+}
+
+func canonicalService(s Service) Service {
+	s = s.Clone()
+	s.Normalize()
+	canonicalizeService(&s)
+	return s
+}
+
+func canonicalHost(h Host) Host {
+	h = h.Clone()
+	h.Normalize()
+	canonicalizeHost(&h)
+	return h
+}
+
+// canonicalize* convert times to UTC and empty lists to nil in place. The
+// objects are expected to be normalized already.
+
+func canonicalizeAttribute(a *Attribute) {
+	a.LastUpdate = canonicalTime(a.LastUpdate)
+	a.Backends = canonicalStrings(a.Backends)
+}
+
+func canonicalizeAttributes(attrs []Attribute) []Attribute {
+	for i := range attrs {
+		canonicalizeAttribute(&attrs[i])
+	}
+	if len(attrs) == 0 {
+		return nil
+	}
+	return attrs
+}
+
+func canonicalizeMetric(m *Metric) {
+	m.LastUpdate = canonicalTime(m.LastUpdate)
+	m.Backends = canonicalStrings(m.Backends)
+	m.Attributes = canonicalizeAttributes(m.Attributes)
+	m.DataNames = canonicalStrings(m.DataNames)
+}
+
+func canonicalizeService(s *Service) {
+	s.LastUpdate = canonicalTime(s.LastUpdate)
+	s.Backends = canonicalStrings(s.Backends)
+	s.Attributes = canonicalizeAttributes(s.Attributes)
+}
+
+func canonicalizeHost(h *Host) {
+	h.LastUpdate = canonicalTime(h.LastUpdate)
+	h.Backends = canonicalStrings(h.Backends)
+	h.Attributes = canonicalizeAttributes(h.Attributes)
+	for i := range h.Metrics {
+		canonicalizeMetric(&h.Metrics[i])
+	}
+	if len(h.Metrics) == 0 {
+		h.Metrics = nil
+	}
+	for i := range h.Services {
+		canonicalizeService(&h.Services[i])
+	}
+	if len(h.Services) == 0 {
+		h.Services = nil
+	}
+}
+
+func canonicalHosts(hosts []Host) []Host {
+	if len(hosts) == 0 {
+		return nil
+	}
+	res := make([]Host, len(hosts))
+	for i, h := range hosts {
+		res[i] = canonicalHost(h)
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+func canonicalServiceList(l ServiceList) ServiceList {
+	if len(l) == 0 {
+		return nil
+	}
+	res := make(ServiceList, len(l))
+	for i, s := range l {
+		res[i] = HostService{Host: s.Host, Service: canonicalService(s.Service)}
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].Host != res[j].Host {
+			return res[i].Host < res[j].Host
+		}
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
+
+func canonicalMetricList(l MetricList) MetricList {
+	if len(l) == 0 {
+		return nil
+	}
+	res := make(MetricList, len(l))
+	for i, m := range l {
+		res[i] = HostMetric{Host: m.Host, Metric: canonicalMetric(m.Metric)}
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].Host != res[j].Host {
+			return res[i].Host < res[j].Host
+		}
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
+
+func canonicalTimeseries(ts Timeseries) Timeseries {
+	res := Timeseries{
+		Start: canonicalTime(ts.Start),
+		End:   canonicalTime(ts.End),
+	}
+	if len(ts.Data) == 0 {
+		return res
+	}
+	// encoding/json sorts map keys.
+	res.Data = make(map[string][]DataPoint, len(ts.Data))
+	for src, points := range ts.Data {
+		if len(points) == 0 {
+			res.Data[src] = nil
+			continue
+		}
+		sorted := make([]DataPoint, len(points))
+		for i, p := range points {
+			sorted[i] = DataPoint{Timestamp: canonicalTime(p.Timestamp), Value: p.Value}
+		}
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return time.Time(sorted[i].Timestamp).Before(time.Time(sorted[j].Timestamp))
+		})
+		res.Data[src] = sorted
+	}
+	return res
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
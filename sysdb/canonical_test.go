@@ -0,0 +1,142 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sysdb
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMarshalCanonical(t *testing.T) {
+	cet := time.FixedZone("CET", 3600)
+	ts := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	h := testHost()
+	h.LastUpdate = Time(ts.In(cet))
+	h.Services[0].Backends = []string{}
+	h.Metrics[1].LastUpdate = Time(ts)
+	got, err := MarshalCanonical(&h)
+	if err != nil {
+		t.Fatalf("MarshalCanonical(%+v) = %v", h, err)
+	}
+	if !reflect.DeepEqual(h.Backends, []string{"puppet", "collectd", "puppet"}) || h.Services[0].Name != "s2" {
+		t.Errorf("MarshalCanonical() modified its argument: %+v", h)
+	}
+
+	// The same host with children in a different order, backends listed
+	// differently, and a different time zone is encoded identically.
+	other := testHost()
+	other.LastUpdate = Time(ts)
+	other.Backends = []string{"collectd", "puppet"}
+	other.Metrics[0], other.Metrics[1] = other.Metrics[1], other.Metrics[0]
+	other.Metrics[0].LastUpdate = Time(ts.In(cet))
+	other.Services[0], other.Services[1] = other.Services[1], other.Services[0]
+	if data, err := MarshalCanonical(other); err != nil || string(data) != string(got) {
+		t.Errorf("MarshalCanonical(%+v) = %v\n%s\nwant <nil>\n%s", other, err, data, got)
+	}
+
+	var decoded Host
+	if err := json.Unmarshal(got, &decoded); err != nil || decoded.Name != "h1" || len(decoded.Services) != 2 {
+		t.Errorf("json.Unmarshal(%s) = %v, %+v; want h1 with two services", got, err, decoded)
+	}
+
+	for _, test := range []struct {
+		v    interface{}
+		want string
+	}{
+		{
+			Attribute{Name: "a", Value: "v", LastUpdate: Time(ts.In(cet)), Backends: []string{}},
+			"{\n\t\"name\": \"a\",\n\t\"value\": \"v\",\n\t\"last_update\": \"2016-01-02 03:04:05 +0000\",\n" +
+				"\t\"update_interval\": \"0s\",\n\t\"backends\": null\n}\n",
+		},
+		{
+			[]Host{{Name: "b"}, {Name: "a", Services: []Service{}}},
+			"[\n\t{\n\t\t\"name\": \"a\",\n\t\t\"last_update\": \"0001-01-01 00:00:00 +0000\",\n" +
+				"\t\t\"update_interval\": \"0s\",\n\t\t\"backends\": null,\n\t\t\"attributes\": null,\n" +
+				"\t\t\"metrics\": null,\n\t\t\"services\": null\n\t},\n" +
+				"\t{\n\t\t\"name\": \"b\",\n\t\t\"last_update\": \"0001-01-01 00:00:00 +0000\",\n" +
+				"\t\t\"update_interval\": \"0s\",\n\t\t\"backends\": null,\n\t\t\"attributes\": null,\n" +
+				"\t\t\"metrics\": null,\n\t\t\"services\": null\n\t}\n]\n",
+		},
+		{[]Host{}, "null\n"},
+		{
+			ServiceList{{Host: "h2", Service: Service{Name: "a"}}, {Host: "h1", Service: Service{Name: "b"}}, {Host: "h1", Service: Service{Name: "a"}}},
+			`[{"host":"h1","name":"a"},{"host":"h1","name":"b"},{"host":"h2","name":"a"}]`,
+		},
+		{
+			MetricList{{Host: "h2", Metric: Metric{Name: "a"}}, {Host: "h1", Metric: Metric{Name: "b"}}},
+			`[{"host":"h1","name":"b"},{"host":"h2","name":"a"}]`,
+		},
+		{
+			&Timeseries{
+				Start: Time(ts.In(cet)),
+				End:   Time(ts.Add(time.Minute)),
+				Data: map[string][]DataPoint{
+					"value": {{Timestamp: Time(ts.Add(time.Minute)), Value: 2}, {Timestamp: Time(ts.In(cet)), Value: 1}},
+					"max":   {},
+				},
+			},
+			"{\n\t\"start\": \"2016-01-02 03:04:05 +0000\",\n\t\"end\": \"2016-01-02 03:05:05 +0000\",\n" +
+				"\t\"data\": {\n\t\t\"max\": null,\n\t\t\"value\": [\n" +
+				"\t\t\t{\n\t\t\t\t\"timestamp\": \"2016-01-02 03:04:05 +0000\",\n\t\t\t\t\"value\": \"1\"\n\t\t\t},\n" +
+				"\t\t\t{\n\t\t\t\t\"timestamp\": \"2016-01-02 03:05:05 +0000\",\n\t\t\t\t\"value\": \"2\"\n\t\t\t}\n" +
+				"\t\t]\n\t}\n}\n",
+		},
+	} {
+		data, err := MarshalCanonical(test.v)
+		if err != nil {
+			t.Errorf("MarshalCanonical(%+v) = %v", test.v, err)
+			continue
+		}
+		if strings.HasSuffix(test.want, "\n") {
+			if string(data) != test.want {
+				t.Errorf("MarshalCanonical(%+v) =\n%s\nwant\n%s", test.v, data, test.want)
+			}
+			continue
+		}
+		// Otherwise, compare the order of the host and name fields only.
+		var got []struct {
+			Host string `json:"host"`
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Errorf("MarshalCanonical(%+v) = %s; invalid JSON: %v", test.v, data, err)
+			continue
+		}
+		if short, _ := json.Marshal(got); string(short) != test.want {
+			t.Errorf("MarshalCanonical(%+v) = %s; want order %s", test.v, short, test.want)
+		}
+	}
+
+	if _, err := MarshalCanonical(map[string]string{}); ErrorCode(err) != CodeUnsupported {
+		t.Errorf("MarshalCanonical(<map>) = %v; want code %s", err, CodeUnsupported)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
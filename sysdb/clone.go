@@ -0,0 +1,153 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sysdb
+
+import "sort"
+
+// Clone returns a deep copy of the attribute.
+func (a Attribute) Clone() Attribute {
+	a.Backends = cloneStrings(a.Backends)
+	return a
+}
+
+// Clone returns a deep copy of the metric.
+func (m Metric) Clone() Metric {
+	m.Backends = cloneStrings(m.Backends)
+	m.Attributes = cloneAttributes(m.Attributes)
+	m.DataNames = cloneStrings(m.DataNames)
+	if m.Store != nil {
+		st := *m.Store
+		m.Store = &st
+	}
+	return m
+}
+
+// Clone returns a deep copy of the service.
+func (s Service) Clone() Service {
+	s.Backends = cloneStrings(s.Backends)
+	s.Attributes = cloneAttributes(s.Attributes)
+	return s
+}
+
+// Clone returns a deep copy of the host including all of its children.
+func (h Host) Clone() Host {
+	h.Backends = cloneStrings(h.Backends)
+	h.Attributes = cloneAttributes(h.Attributes)
+	if h.Metrics != nil {
+		metrics := make([]Metric, len(h.Metrics))
+		for i, m := range h.Metrics {
+			metrics[i] = m.Clone()
+		}
+		h.Metrics = metrics
+	}
+	if h.Services != nil {
+		services := make([]Service, len(h.Services))
+		for i, s := range h.Services {
+			services[i] = s.Clone()
+		}
+		h.Services = services
+	}
+	return h
+}
+
+func cloneStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+	return append(make([]string, 0, len(s)), s...)
+}
+
+func cloneAttributes(attrs []Attribute) []Attribute {
+	if attrs == nil {
+		return nil
+	}
+	res := make([]Attribute, len(attrs))
+	for i, a := range attrs {
+		res[i] = a.Clone()
+	}
+	return res
+}
+
+// Normalize brings the attribute into its canonical form: its backends are
+// sorted and duplicates are removed.
+func (a *Attribute) Normalize() {
+	a.Backends = normalizeStrings(a.Backends)
+}
+
+// Normalize brings the metric into its canonical form: backends and
+// attributes are sorted (by name) and duplicate backends are removed.
+func (m *Metric) Normalize() {
+	m.Backends = normalizeStrings(m.Backends)
+	normalizeAttributes(m.Attributes)
+}
+
+// Normalize brings the service into its canonical form: backends and
+// attributes are sorted (by name) and duplicate backends are removed.
+func (s *Service) Normalize() {
+	s.Backends = normalizeStrings(s.Backends)
+	normalizeAttributes(s.Attributes)
+}
+
+// Normalize brings the host and all of its children into their canonical
+// form: backends, attributes, metrics, and services are sorted (by name) and
+// duplicate backends are removed. Normalized hosts may be compared using
+// reflect.DeepEqual, for example.
+func (h *Host) Normalize() {
+	h.Backends = normalizeStrings(h.Backends)
+	normalizeAttributes(h.Attributes)
+	for i := range h.Metrics {
+		h.Metrics[i].Normalize()
+	}
+	sort.SliceStable(h.Metrics, func(i, j int) bool { return h.Metrics[i].Name < h.Metrics[j].Name })
+	for i := range h.Services {
+		h.Services[i].Normalize()
+	}
+	sort.SliceStable(h.Services, func(i, j int) bool { return h.Services[i].Name < h.Services[j].Name })
+}
+
+// normalizeStrings sorts s and removes duplicates in place.
+func normalizeStrings(s []string) []string {
+	if len(s) < 2 {
+		return s
+	}
+	sort.Strings(s)
+	res := s[:1]
+	for _, v := range s[1:] {
+		if v != res[len(res)-1] {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+func normalizeAttributes(attrs []Attribute) {
+	for i := range attrs {
+		attrs[i].Normalize()
+	}
+	sort.SliceStable(attrs, func(i, j int) bool { return attrs[i].Name < attrs[j].Name })
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
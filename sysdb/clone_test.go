@@ -0,0 +1,102 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sysdb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testHost() Host {
+	return Host{
+		Name:       "h1",
+		Backends:   []string{"puppet", "collectd", "puppet"},
+		Attributes: []Attribute{{Name: "b", Value: "2"}, {Name: "a", Value: "1", Backends: []string{"y", "x", "y"}}},
+		Metrics: []Metric{
+			{Name: "m2", Backends: []string{"b", "a"}, Timeseries: true, DataNames: []string{"value"}, Store: &MetricStore{Type: "rrdtool", ID: "m2.rrd"}},
+			{Name: "m1", Attributes: []Attribute{{Name: "unit", Value: "s"}, {Name: "type", Value: "gauge"}}},
+		},
+		Services: []Service{
+			{Name: "s2"},
+			{Name: "s1", Backends: []string{"b", "b"}, Attributes: []Attribute{{Name: "z"}, {Name: "y"}}},
+		},
+	}
+}
+
+func TestClone(t *testing.T) {
+	h := testHost()
+	c := h.Clone()
+	if !reflect.DeepEqual(c, h) {
+		t.Fatalf("Clone() = %+v; want %+v", c, h)
+	}
+
+	// Modifying the clone must not affect the original.
+	c.Backends[0] = "x"
+	c.Attributes[1].Backends[0] = "x"
+	c.Metrics[0].Backends[0] = "x"
+	c.Metrics[0].DataNames[0] = "x"
+	c.Metrics[0].Store.ID = "x"
+	c.Metrics[1].Attributes[0].Value = "x"
+	c.Services[1].Attributes[0].Name = "x"
+	c.Services[1].Backends[0] = "x"
+	if !reflect.DeepEqual(h, testHost()) {
+		t.Errorf("Modifying clone changed original: %+v", h)
+	}
+
+	var empty Host
+	if c := empty.Clone(); !reflect.DeepEqual(c, empty) {
+		t.Errorf("Clone(<empty>) = %#v; want %#v", c, empty)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	h := testHost()
+	h.Normalize()
+	expected := Host{
+		Name:       "h1",
+		Backends:   []string{"collectd", "puppet"},
+		Attributes: []Attribute{{Name: "a", Value: "1", Backends: []string{"x", "y"}}, {Name: "b", Value: "2"}},
+		Metrics: []Metric{
+			{Name: "m1", Attributes: []Attribute{{Name: "type", Value: "gauge"}, {Name: "unit", Value: "s"}}},
+			{Name: "m2", Backends: []string{"a", "b"}, Timeseries: true, DataNames: []string{"value"}, Store: &MetricStore{Type: "rrdtool", ID: "m2.rrd"}},
+		},
+		Services: []Service{
+			{Name: "s1", Backends: []string{"b"}, Attributes: []Attribute{{Name: "y"}, {Name: "z"}}},
+			{Name: "s2"},
+		},
+	}
+	if !reflect.DeepEqual(h, expected) {
+		t.Errorf("Normalize() = %+v; want %+v", h, expected)
+	}
+
+	// Normalizing is idempotent.
+	h.Normalize()
+	if !reflect.DeepEqual(h, expected) {
+		t.Errorf("Normalize(Normalize()) = %+v; want %+v", h, expected)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -26,6 +26,8 @@
 // Package sysdb declares core constants and types used by SysDB packages.
 package sysdb
 
+import "fmt"
+
 // The LogPriority describes the priority of a log message.
 type LogPriority int
 
@@ -39,4 +41,21 @@ const (
 	LogDebug   = LogPriority(7)
 )
 
+var logPriorities = map[LogPriority]string{
+	LogEmerg:   "EMERG",
+	LogErr:     "ERROR",
+	LogWarning: "WARNING",
+	LogNotice:  "NOTICE",
+	LogInfo:    "INFO",
+	LogDebug:   "DEBUG",
+}
+
+// String returns the name of the log priority.
+func (p LogPriority) String() string {
+	if s, ok := logPriorities[p]; ok {
+		return s
+	}
+	return fmt.Sprintf("LogPriority(%d)", int(p))
+}
+
 // vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,131 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sysdb
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// DefaultCSVTimeFormat is the time format used for CSV data if none is
+// specified.
+const DefaultCSVTimeFormat = time.RFC3339Nano
+
+// csvHeader lists the columns of CSV encoded timeseries.
+var csvHeader = []string{"timestamp", "source", "value"}
+
+// WriteCSV writes the timeseries to w as comma-separated values. The output
+// starts with a header row followed by one row per data point consisting of
+// the timestamp (formatted using the specified layout, see time.Format), the
+// name of the data source, and the value. Data sources are written in
+// lexical order. An empty layout selects DefaultCSVTimeFormat.
+func (ts Timeseries) WriteCSV(w io.Writer, layout string) error {
+	if layout == "" {
+		layout = DefaultCSVTimeFormat
+	}
+
+	sources := make([]string, 0, len(ts.Data))
+	for src := range ts.Data {
+		sources = append(sources, src)
+	}
+	sort.Strings(sources)
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, src := range sources {
+		for _, p := range ts.Data[src] {
+			err := cw.Write([]string{
+				time.Time(p.Timestamp).Format(layout),
+				src,
+				strconv.FormatFloat(p.Value, 'g', -1, 64),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ReadCSV reads comma-separated values as written by WriteCSV from r and
+// stores the resulting timeseries in ts. The header row is optional. Start
+// and end of the timeseries are set to the earliest and latest timestamp
+// respectively. An empty layout selects DefaultCSVTimeFormat.
+func (ts *Timeseries) ReadCSV(r io.Reader, layout string) error {
+	if layout == "" {
+		layout = DefaultCSVTimeFormat
+	}
+
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = len(csvHeader)
+	cr.TrimLeadingSpace = true
+
+	res := Timeseries{Data: make(map[string][]DataPoint)}
+	first := true
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return &Error{Code: CodeInvalidFormat, Err: err}
+		}
+		if first {
+			first = false
+			if rec[0] == csvHeader[0] && rec[1] == csvHeader[1] && rec[2] == csvHeader[2] {
+				continue
+			}
+		}
+
+		line, _ := cr.FieldPos(0)
+		t, err := time.Parse(layout, rec[0])
+		if err != nil {
+			return Errorf(CodeInvalidFormat, "line %d: invalid timestamp %q", line, rec[0])
+		}
+		v, err := strconv.ParseFloat(rec[2], 64)
+		if err != nil {
+			return Errorf(CodeInvalidFormat, "line %d: invalid value %q", line, rec[2])
+		}
+
+		if len(res.Data) == 0 || t.Before(time.Time(res.Start)) {
+			res.Start = Time(t)
+		}
+		if len(res.Data) == 0 || t.After(time.Time(res.End)) {
+			res.End = Time(t)
+		}
+		res.Data[rec[1]] = append(res.Data[rec[1]], DataPoint{Timestamp: Time(t), Value: v})
+	}
+	*ts = res
+	return nil
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,124 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sysdb
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCSV(t *testing.T) {
+	base := time.Date(2015, 5, 1, 12, 0, 0, 0, time.UTC)
+	ts := Timeseries{
+		Start: Time(base),
+		End:   Time(base.Add(20 * time.Second)),
+		Data: map[string][]DataPoint{
+			"value": series(base, []int{0, 10, 20}, []float64{1, 2.5, math.NaN()}).Data["value"],
+			"count": series(base, []int{10}, []float64{-3}).Data["value"],
+		},
+	}
+
+	for _, test := range []struct {
+		layout   string
+		expected string
+	}{
+		{
+			"",
+			"timestamp,source,value\n" +
+				"2015-05-01T12:00:10Z,count,-3\n" +
+				"2015-05-01T12:00:00Z,value,1\n" +
+				"2015-05-01T12:00:10Z,value,2.5\n" +
+				"2015-05-01T12:00:20Z,value,NaN\n",
+		},
+		{
+			"2006-01-02 15:04:05",
+			"timestamp,source,value\n" +
+				"2015-05-01 12:00:10,count,-3\n" +
+				"2015-05-01 12:00:00,value,1\n" +
+				"2015-05-01 12:00:10,value,2.5\n" +
+				"2015-05-01 12:00:20,value,NaN\n",
+		},
+	} {
+		var buf bytes.Buffer
+		if err := ts.WriteCSV(&buf, test.layout); err != nil || buf.String() != test.expected {
+			t.Errorf("WriteCSV(%q) = %q, %v; want %q, <nil>", test.layout, buf.String(), err, test.expected)
+			continue
+		}
+
+		var got Timeseries
+		if err := got.ReadCSV(&buf, test.layout); err != nil {
+			t.Errorf("ReadCSV(%q) = %v; want <nil>", test.layout, err)
+			continue
+		}
+		if !got.Start.Equal(ts.Start) || !got.End.Equal(ts.End) || len(got.Data) != len(ts.Data) {
+			t.Errorf("ReadCSV(%q) = %v; want %v", test.layout, got, ts)
+			continue
+		}
+		for src, points := range ts.Data {
+			if !equalPoints(got.Data[src], points) {
+				t.Errorf("ReadCSV(%q)[%s] = %v; want %v", test.layout, src, got.Data[src], points)
+			}
+		}
+	}
+}
+
+func TestReadCSV(t *testing.T) {
+	for _, test := range []struct {
+		data string
+		n    int
+		err  bool
+	}{
+		{"", 0, false},
+		{"timestamp,source,value\n", 0, false},
+		{"2015-05-01T12:00:00Z,value,1\n", 1, false},
+		{"2015-05-01T12:00:00Z, value, 1\n2015-05-01T12:00:10Z,value,inf\n", 2, false},
+		{"2015-05-01T12:00:00Z,value\n", 0, true},
+		{"2015-05-01,value,1\n", 0, true},
+		{"2015-05-01T12:00:00Z,value,abc\n", 0, true},
+		{"timestamp,source,value\ntimestamp,source,value\n", 0, true},
+	} {
+		var ts Timeseries
+		err := ts.ReadCSV(strings.NewReader(test.data), "")
+		if (err != nil) != test.err {
+			t.Errorf("ReadCSV(%q) = %v; want error: %v", test.data, err, test.err)
+			continue
+		}
+		if err != nil {
+			if ErrorCode(err) != CodeInvalidFormat {
+				t.Errorf("ReadCSV(%q) = %v; want <error %v>", test.data, err, CodeInvalidFormat)
+			}
+			continue
+		}
+		if n := len(ts.Data["value"]); n != test.n {
+			t.Errorf("ReadCSV(%q) = %d data points; want %d", test.data, n, test.n)
+		}
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
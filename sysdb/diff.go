@@ -0,0 +1,266 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sysdb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A ChangeKind describes how an object differs between two snapshots.
+type ChangeKind int
+
+// Kinds of changes.
+const (
+	// Added objects only exist in the new snapshot.
+	Added ChangeKind = iota + 1
+	// Removed objects only exist in the old snapshot.
+	Removed
+	// Changed attributes exist in both snapshots but with different
+	// values.
+	Changed
+)
+
+var changeKindNames = map[ChangeKind]string{
+	Added:   "added",
+	Removed: "removed",
+	Changed: "changed",
+}
+
+// String returns the name of the change kind.
+func (k ChangeKind) String() string {
+	if s, ok := changeKindNames[k]; ok {
+		return s
+	}
+	return fmt.Sprintf("ChangeKind(%d)", int(k))
+}
+
+// A Change describes a single difference between two snapshots of the
+// store.
+//
+// The object is identified by the names of the host and, if applicable, the
+// service or metric and the attribute. Type is the type of the object
+// ("host", "service", "metric", or "attribute") which also determines the
+// innermost name.
+type Change struct {
+	Kind ChangeKind
+	Type string
+
+	Host      string
+	Service   string
+	Metric    string
+	Attribute string
+
+	// Old and New are the old and new values of attributes. They are empty
+	// for all other objects.
+	Old, New string
+}
+
+// String returns a textual description of the change.
+func (c Change) String() string {
+	var path []string
+	for _, n := range []string{c.Host, c.Service, c.Metric, c.Attribute} {
+		if n != "" {
+			path = append(path, n)
+		}
+	}
+	s := fmt.Sprintf("%s %s %s", c.Kind, c.Type, strings.Join(path, "."))
+	switch c.Kind {
+	case Added:
+		if c.Type == "attribute" {
+			s += fmt.Sprintf(" = %q", c.New)
+		}
+	case Removed:
+		if c.Type == "attribute" {
+			s += fmt.Sprintf(" (was %q)", c.Old)
+		}
+	case Changed:
+		s += fmt.Sprintf(": %q -> %q", c.Old, c.New)
+	}
+	return s
+}
+
+// diffNames calls f for each name in the union of the old and new names in
+// lexical order along with the indexes of the name in old and new
+// respectively (or -1 if missing).
+func diffNames(old, new []string, f func(i, j int)) {
+	oi := make(map[string]int, len(old))
+	for i, n := range old {
+		oi[n] = i
+	}
+	ni := make(map[string]int, len(new))
+	for i, n := range new {
+		ni[n] = i
+	}
+
+	names := make([]string, 0, len(old)+len(new))
+	names = append(names, old...)
+	for _, n := range new {
+		if _, ok := oi[n]; !ok {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+
+	for _, n := range names {
+		i, ok := oi[n]
+		if !ok {
+			i = -1
+		}
+		j, ok := ni[n]
+		if !ok {
+			j = -1
+		}
+		f(i, j)
+	}
+}
+
+func attributeNames(attrs []Attribute) []string {
+	names := make([]string, len(attrs))
+	for i, a := range attrs {
+		names[i] = a.Name
+	}
+	return names
+}
+
+// DiffAttributes reports added, removed, and changed attributes. Only the
+// attribute names are set in the reported changes; see DiffHost for changes
+// identifying the owner of the attributes.
+func DiffAttributes(old, new []Attribute) []Change {
+	return diffAttributes(Change{}, old, new)
+}
+
+// diffAttributes reports attribute changes using owner as a template
+// identifying the owner of the attributes.
+func diffAttributes(owner Change, old, new []Attribute) []Change {
+	var changes []Change
+	diffNames(attributeNames(old), attributeNames(new), func(i, j int) {
+		c := owner
+		c.Type = "attribute"
+		switch {
+		case i < 0:
+			c.Kind, c.Attribute, c.New = Added, new[j].Name, new[j].Value
+		case j < 0:
+			c.Kind, c.Attribute, c.Old = Removed, old[i].Name, old[i].Value
+		case old[i].Value != new[j].Value:
+			c.Kind, c.Attribute, c.Old, c.New = Changed, old[i].Name, old[i].Value, new[j].Value
+		default:
+			return
+		}
+		changes = append(changes, c)
+	})
+	return changes
+}
+
+// DiffMetric reports the differences between two versions of a metric of
+// the specified host, that is, added, removed, and changed attributes.
+func DiffMetric(host string, old, new Metric) []Change {
+	return diffAttributes(Change{Host: host, Metric: new.Name}, old.Attributes, new.Attributes)
+}
+
+// DiffService reports the differences between two versions of a service of
+// the specified host, that is, added, removed, and changed attributes.
+func DiffService(host string, old, new Service) []Change {
+	return diffAttributes(Change{Host: host, Service: new.Name}, old.Attributes, new.Attributes)
+}
+
+// DiffHost reports the differences between two versions of a host: added,
+// removed, and changed attributes of the host and added and removed
+// services and metrics as well as their changed attributes. Changes are
+// ordered by object type (attributes, metrics, services) and name.
+//
+// Added or removed services and metrics are reported as a single change
+// (not including their attributes). Update times, intervals, and backends
+// are not considered.
+func DiffHost(old, new Host) []Change {
+	changes := diffAttributes(Change{Host: new.Name}, old.Attributes, new.Attributes)
+
+	metrics := func(ms []Metric) []string {
+		names := make([]string, len(ms))
+		for i, m := range ms {
+			names[i] = m.Name
+		}
+		return names
+	}
+	diffNames(metrics(old.Metrics), metrics(new.Metrics), func(i, j int) {
+		switch {
+		case i < 0:
+			changes = append(changes, Change{Kind: Added, Type: "metric", Host: new.Name, Metric: new.Metrics[j].Name})
+		case j < 0:
+			changes = append(changes, Change{Kind: Removed, Type: "metric", Host: new.Name, Metric: old.Metrics[i].Name})
+		default:
+			changes = append(changes, DiffMetric(new.Name, old.Metrics[i], new.Metrics[j])...)
+		}
+	})
+
+	services := func(ss []Service) []string {
+		names := make([]string, len(ss))
+		for i, s := range ss {
+			names[i] = s.Name
+		}
+		return names
+	}
+	diffNames(services(old.Services), services(new.Services), func(i, j int) {
+		switch {
+		case i < 0:
+			changes = append(changes, Change{Kind: Added, Type: "service", Host: new.Name, Service: new.Services[j].Name})
+		case j < 0:
+			changes = append(changes, Change{Kind: Removed, Type: "service", Host: new.Name, Service: old.Services[i].Name})
+		default:
+			changes = append(changes, DiffService(new.Name, old.Services[i], new.Services[j])...)
+		}
+	})
+	return changes
+}
+
+// DiffHosts reports the differences between two snapshots of a list of
+// hosts. Added and removed hosts are reported as a single change; see
+// DiffHost for all other changes. Changes are ordered by host name.
+func DiffHosts(old, new []Host) []Change {
+	hosts := func(hs []Host) []string {
+		names := make([]string, len(hs))
+		for i, h := range hs {
+			names[i] = h.Name
+		}
+		return names
+	}
+
+	var changes []Change
+	diffNames(hosts(old), hosts(new), func(i, j int) {
+		switch {
+		case i < 0:
+			changes = append(changes, Change{Kind: Added, Type: "host", Host: new[j].Name})
+		case j < 0:
+			changes = append(changes, Change{Kind: Removed, Type: "host", Host: old[i].Name})
+		default:
+			changes = append(changes, DiffHost(old[i], new[j])...)
+		}
+	})
+	return changes
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,122 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sysdb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffAttributes(t *testing.T) {
+	old := []Attribute{{Name: "a", Value: "1"}, {Name: "b", Value: "2"}, {Name: "c", Value: "3"}}
+	new := []Attribute{{Name: "d", Value: "4"}, {Name: "c", Value: "3"}, {Name: "b", Value: "20"}}
+	expected := []Change{
+		{Kind: Removed, Type: "attribute", Attribute: "a", Old: "1"},
+		{Kind: Changed, Type: "attribute", Attribute: "b", Old: "2", New: "20"},
+		{Kind: Added, Type: "attribute", Attribute: "d", New: "4"},
+	}
+	if got := DiffAttributes(old, new); !reflect.DeepEqual(got, expected) {
+		t.Errorf("DiffAttributes() = %v; want %v", got, expected)
+	}
+	if got := DiffAttributes(old, old); got != nil {
+		t.Errorf("DiffAttributes(<same>) = %v; want <nil>", got)
+	}
+}
+
+func TestDiffHosts(t *testing.T) {
+	old := []Host{
+		{
+			Name:       "h1",
+			Attributes: []Attribute{{Name: "arch", Value: "i386"}},
+			Metrics: []Metric{
+				{Name: "m1", Attributes: []Attribute{{Name: "unit", Value: "s"}}},
+				{Name: "m2"},
+			},
+			Services: []Service{
+				{Name: "s1", Attributes: []Attribute{{Name: "port", Value: "22"}}},
+				{Name: "s2"},
+			},
+		},
+		{Name: "h2"},
+	}
+	new := []Host{
+		{Name: "h3"},
+		{
+			Name:       "h1",
+			Attributes: []Attribute{{Name: "arch", Value: "amd64"}},
+			Metrics: []Metric{
+				{Name: "m1", Attributes: []Attribute{{Name: "unit", Value: "ms"}}},
+			},
+			Services: []Service{
+				{Name: "s3"},
+				{Name: "s1", Attributes: []Attribute{{Name: "port", Value: "22"}, {Name: "proto", Value: "tcp"}}},
+			},
+		},
+	}
+
+	expected := []string{
+		`changed attribute h1.arch: "i386" -> "amd64"`,
+		`changed attribute h1.m1.unit: "s" -> "ms"`,
+		`removed metric h1.m2`,
+		`added attribute h1.s1.proto = "tcp"`,
+		`removed service h1.s2`,
+		`added service h1.s3`,
+		`removed host h2`,
+		`added host h3`,
+	}
+	got := DiffHosts(old, new)
+	var s []string
+	for _, c := range got {
+		s = append(s, c.String())
+	}
+	if !reflect.DeepEqual(s, expected) {
+		t.Errorf("DiffHosts() = %q; want %q", s, expected)
+	}
+
+	if c := got[3]; c.Type != "attribute" || c.Host != "h1" || c.Service != "s1" || c.Metric != "" {
+		t.Errorf("DiffHosts()[3] = %#v; want attribute of service h1.s1", c)
+	}
+	if got := DiffHosts(old, old); got != nil {
+		t.Errorf("DiffHosts(<same>) = %v; want <nil>", got)
+	}
+}
+
+func TestChangeString(t *testing.T) {
+	for _, test := range []struct {
+		c        Change
+		expected string
+	}{
+		{Change{Kind: Removed, Type: "attribute", Host: "h1", Metric: "m1", Attribute: "a", Old: "x"}, `removed attribute h1.m1.a (was "x")`},
+		{Change{Kind: Added, Type: "attribute", Attribute: "a", New: "x"}, `added attribute a = "x"`},
+		{Change{Kind: ChangeKind(42), Type: "host", Host: "h1"}, `ChangeKind(42) host h1`},
+	} {
+		if got := test.c.String(); got != test.expected {
+			t.Errorf("%#v.String() = %q; want %q", test.c, got, test.expected)
+		}
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,101 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sysdb
+
+import (
+	"errors"
+	"fmt"
+)
+
+// A Code is a stable, machine-readable identifier for a class of errors or
+// events. Codes will not change between releases, so unlike error messages,
+// they may be used to programmatically react to specific conditions.
+type Code string
+
+// Codes used by SysDB packages.
+const (
+	// CodeUnknown is used for errors which do not carry a code.
+	CodeUnknown = Code("unknown")
+	// CodeInvalidArgument indicates an invalid argument passed by the
+	// caller.
+	CodeInvalidArgument = Code("invalid_argument")
+	// CodeInvalidFormat indicates a value which could not be parsed.
+	CodeInvalidFormat = Code("invalid_format")
+	// CodeStartupFailed indicates that a session could not be set up.
+	CodeStartupFailed = Code("startup_failed")
+	// CodeRequestFailed indicates that the server rejected a request.
+	CodeRequestFailed = Code("request_failed")
+	// CodeUnexpectedMessage indicates a message of an unexpected type.
+	CodeUnexpectedMessage = Code("unexpected_message")
+	// CodeMalformedMessage indicates a message which could not be decoded.
+	CodeMalformedMessage = Code("malformed_message")
+	// CodeUnsupported indicates an operation or data type which is not
+	// supported.
+	CodeUnsupported = Code("unsupported")
+	// CodePolicyViolation indicates a request rejected by a client-side
+	// policy.
+	CodePolicyViolation = Code("policy_violation")
+	// CodeVerificationFailed indicates data which failed an integrity or
+	// authenticity check.
+	CodeVerificationFailed = Code("verification_failed")
+	// CodeClosed indicates an operation on a closed object.
+	CodeClosed = Code("closed")
+	// CodeExhausted indicates that a resource, such as a connection pool,
+	// has been exhausted.
+	CodeExhausted = Code("exhausted")
+	// CodeTooLarge indicates data exceeding a size limit.
+	CodeTooLarge = Code("too_large")
+)
+
+// An Error is an error annotated with a Code.
+type Error struct {
+	Code Code
+	Err  error
+}
+
+// Errorf formats an error message according to the format specifier and
+// returns it as an Error with the specified code.
+func Errorf(code Code, format string, a ...interface{}) *Error {
+	return &Error{Code: code, Err: fmt.Errorf(format, a...)}
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string { return e.Err.Error() }
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error { return e.Err }
+
+// ErrorCode returns the code of the first Error in err's chain or CodeUnknown
+// if there is none.
+func ErrorCode(err error) Code {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return CodeUnknown
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,56 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sysdb
+
+import (
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestErrorCode(t *testing.T) {
+	for _, test := range []struct {
+		err      error
+		expected Code
+	}{
+		{nil, CodeUnknown},
+		{io.EOF, CodeUnknown},
+		{Errorf(CodeRequestFailed, "failed"), CodeRequestFailed},
+		{fmt.Errorf("wrapped: %w", Errorf(CodeUnsupported, "x")), CodeUnsupported},
+	} {
+		if got := ErrorCode(test.err); got != test.expected {
+			t.Errorf("ErrorCode(%v) = %q; want %q", test.err, got, test.expected)
+		}
+	}
+
+	var d Duration
+	if err := d.UnmarshalJSON([]byte(`"1x"`)); ErrorCode(err) != CodeInvalidFormat {
+		t.Errorf("UnmarshalJSON(\"1x\") = %v; want error with code %q",
+			err, CodeInvalidFormat)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
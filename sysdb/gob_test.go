@@ -0,0 +1,104 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sysdb
+
+import (
+	"bytes"
+	"encoding/gob"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGob(t *testing.T) {
+	now := Time(time.Date(2015, 5, 1, 12, 0, 0, 123, time.UTC))
+	h := testHost()
+	h.LastUpdate = now
+	h.UpdateInterval = 5 * Minute
+	h.Metrics[0].LastUpdate = now
+	h.Metrics[0].Timeseries = true
+	h.Services[1].Attributes[0].LastUpdate = now
+	ts := Timeseries{
+		Start: now,
+		End:   now,
+		Data:  map[string][]DataPoint{"value": {{Timestamp: now, Value: 1.5}, {Timestamp: now, Value: math.Inf(-1)}}},
+	}
+
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	for _, v := range []interface{}{h, h.Services[1], h.Metrics[0], h.Attributes[0], ts, Host{}} {
+		if err := enc.Encode(v); err != nil {
+			t.Fatalf("Encode(%T) = %v", v, err)
+		}
+	}
+
+	dec := gob.NewDecoder(&buf)
+	var (
+		host   Host
+		svc    Service
+		metric Metric
+		attr   Attribute
+		series Timeseries
+		empty  Host
+	)
+	for _, v := range []interface{}{&host, &svc, &metric, &attr, &series, &empty} {
+		if err := dec.Decode(v); err != nil {
+			t.Fatalf("Decode(%T) = %v", v, err)
+		}
+	}
+
+	if !reflect.DeepEqual(host, h) {
+		t.Errorf("Decode(Host) = %+v; want %+v", host, h)
+	}
+	if !reflect.DeepEqual(svc, h.Services[1]) || !reflect.DeepEqual(metric, h.Metrics[0]) || !reflect.DeepEqual(attr, h.Attributes[0]) {
+		t.Errorf("Decode(Service, Metric, Attribute) = %+v, %+v, %+v; want %+v, %+v, %+v",
+			svc, metric, attr, h.Services[1], h.Metrics[0], h.Attributes[0])
+	}
+	if !series.Start.Equal(ts.Start) || len(series.Data["value"]) != 2 || series.Data["value"][1].Value != math.Inf(-1) {
+		t.Errorf("Decode(Timeseries) = %+v; want %+v", series, ts)
+	}
+	if !reflect.DeepEqual(empty, Host{}) {
+		t.Errorf("Decode(Host{}) = %+v; want %+v", empty, Host{})
+	}
+
+	// Time zone offsets are preserved (but not their names).
+	cest := Time(time.Date(2015, 5, 1, 12, 0, 0, 0, time.FixedZone("CEST", 7200)))
+	data, err := cest.GobEncode()
+	if err != nil {
+		t.Fatalf("GobEncode() = %v", err)
+	}
+	var tm Time
+	if err := tm.GobDecode(data); err != nil || !tm.Equal(cest) || tm.String() != "2015-05-01 12:00:00 +0200 +0200" {
+		t.Errorf("GobDecode(GobEncode(%s)) = %s, %v; want 2015-05-01 12:00:00 +0200 +0200, <nil>", cest, tm, err)
+	}
+
+	if err := tm.GobDecode([]byte{42}); ErrorCode(err) != CodeInvalidFormat {
+		t.Errorf("GobDecode(<invalid>) = %v; want <error %v>", err, CodeInvalidFormat)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
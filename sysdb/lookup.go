@@ -0,0 +1,135 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sysdb
+
+func findAttribute(attrs []Attribute, name string) *Attribute {
+	for i := range attrs {
+		if attrs[i].Name == name {
+			return &attrs[i]
+		}
+	}
+	return nil
+}
+
+// Attribute returns the named attribute of the host or nil if it does not
+// exist. The returned pointer refers to the host's attribute.
+func (h *Host) Attribute(name string) *Attribute {
+	return findAttribute(h.Attributes, name)
+}
+
+// Service returns the named service of the host or nil if it does not
+// exist. The returned pointer refers to the host's service.
+func (h *Host) Service(name string) *Service {
+	for i := range h.Services {
+		if h.Services[i].Name == name {
+			return &h.Services[i]
+		}
+	}
+	return nil
+}
+
+// Metric returns the named metric of the host or nil if it does not exist.
+// The returned pointer refers to the host's metric.
+func (h *Host) Metric(name string) *Metric {
+	for i := range h.Metrics {
+		if h.Metrics[i].Name == name {
+			return &h.Metrics[i]
+		}
+	}
+	return nil
+}
+
+// Attribute returns the named attribute of the service or nil if it does not
+// exist. The returned pointer refers to the service's attribute.
+func (s *Service) Attribute(name string) *Attribute {
+	return findAttribute(s.Attributes, name)
+}
+
+// Attribute returns the named attribute of the metric or nil if it does not
+// exist. The returned pointer refers to the metric's attribute.
+func (m *Metric) Attribute(name string) *Attribute {
+	return findAttribute(m.Attributes, name)
+}
+
+// A HostIndex provides constant-time lookups of the attributes, services,
+// and metrics of a host, which is useful when looking up many children of
+// hosts with large numbers of them. The index refers to the children of the
+// host; it has to be recreated when adding or removing any of them.
+type HostIndex struct {
+	host     *Host
+	attrs    map[string]int
+	services map[string]int
+	metrics  map[string]int
+}
+
+// NewHostIndex creates an index of the children of h. If multiple children
+// share the same name, the first one is used, matching the behavior of the
+// accessors of Host.
+func NewHostIndex(h *Host) *HostIndex {
+	x := &HostIndex{
+		host:     h,
+		attrs:    make(map[string]int, len(h.Attributes)),
+		services: make(map[string]int, len(h.Services)),
+		metrics:  make(map[string]int, len(h.Metrics)),
+	}
+	for i := len(h.Attributes) - 1; i >= 0; i-- {
+		x.attrs[h.Attributes[i].Name] = i
+	}
+	for i := len(h.Services) - 1; i >= 0; i-- {
+		x.services[h.Services[i].Name] = i
+	}
+	for i := len(h.Metrics) - 1; i >= 0; i-- {
+		x.metrics[h.Metrics[i].Name] = i
+	}
+	return x
+}
+
+// Attribute returns the named attribute of the host or nil if it does not
+// exist.
+func (x *HostIndex) Attribute(name string) *Attribute {
+	if i, ok := x.attrs[name]; ok {
+		return &x.host.Attributes[i]
+	}
+	return nil
+}
+
+// Service returns the named service of the host or nil if it does not exist.
+func (x *HostIndex) Service(name string) *Service {
+	if i, ok := x.services[name]; ok {
+		return &x.host.Services[i]
+	}
+	return nil
+}
+
+// Metric returns the named metric of the host or nil if it does not exist.
+func (x *HostIndex) Metric(name string) *Metric {
+	if i, ok := x.metrics[name]; ok {
+		return &x.host.Metrics[i]
+	}
+	return nil
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
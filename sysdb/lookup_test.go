@@ -0,0 +1,93 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sysdb
+
+import "testing"
+
+func TestAccessors(t *testing.T) {
+	h := testHost()
+	h.Services = append(h.Services, Service{Name: "s1", Backends: []string{"dup"}})
+	x := NewHostIndex(&h)
+
+	for _, test := range []struct {
+		name     string
+		attr     *Attribute
+		xattr    *Attribute
+		expected string
+	}{
+		{"a", h.Attribute("a"), x.Attribute("a"), "1"},
+		{"b", h.Attribute("b"), x.Attribute("b"), "2"},
+		{"unit", h.Metric("m1").Attribute("unit"), nil, "s"},
+		{"z", h.Service("s1").Attribute("z"), nil, ""},
+	} {
+		if test.attr == nil || test.attr.Name != test.name || test.attr.Value != test.expected {
+			t.Errorf("Attribute(%q) = %+v; want {%s %s}", test.name, test.attr, test.name, test.expected)
+		}
+		if test.xattr != nil && test.xattr != test.attr {
+			t.Errorf("HostIndex.Attribute(%q) = %p; want %p", test.name, test.xattr, test.attr)
+		}
+	}
+
+	if a := h.Attribute("c"); a != nil {
+		t.Errorf("Attribute(c) = %+v; want <nil>", a)
+	}
+	if a := h.Metric("m2").Attribute("unit"); a != nil {
+		t.Errorf("Metric(m2).Attribute(unit) = %+v; want <nil>", a)
+	}
+	if a := x.Attribute("c"); a != nil {
+		t.Errorf("HostIndex.Attribute(c) = %+v; want <nil>", a)
+	}
+
+	for _, name := range []string{"s1", "s2"} {
+		s, xs := h.Service(name), x.Service(name)
+		if s == nil || s.Name != name || s != xs {
+			t.Errorf("Service(%q) = %p, HostIndex.Service(%q) = %p; want the same service", name, s, name, xs)
+		}
+	}
+	if s := h.Service("s1"); s == nil || len(s.Backends) == 1 && s.Backends[0] == "dup" {
+		t.Errorf("Service(s1) = %+v; want first service named s1", s)
+	}
+	for _, name := range []string{"m1", "m2"} {
+		m, xm := h.Metric(name), x.Metric(name)
+		if m == nil || m.Name != name || m != xm {
+			t.Errorf("Metric(%q) = %p, HostIndex.Metric(%q) = %p; want the same metric", name, m, name, xm)
+		}
+	}
+	if s, m := x.Service("s3"), x.Metric("m3"); s != nil || m != nil {
+		t.Errorf("HostIndex.Service(s3), Metric(m3) = %v, %v; want <nil>, <nil>", s, m)
+	}
+	if s, m := h.Service("s3"), h.Metric("m3"); s != nil || m != nil {
+		t.Errorf("Service(s3), Metric(m3) = %v, %v; want <nil>, <nil>", s, m)
+	}
+
+	// The accessors return pointers to the host's children.
+	h.Attribute("a").Value = "42"
+	if h.Attributes[1].Value != "42" {
+		t.Errorf("Attribute(a).Value = 42 did not update the host")
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
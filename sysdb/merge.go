@@ -0,0 +1,164 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sysdb
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// An Interpolation describes how to determine the value of a timeseries
+// between its data points.
+type Interpolation int
+
+// Interpolations supported when aligning timeseries.
+const (
+	// NoInterpolation uses NaN for any time without a data point.
+	NoInterpolation Interpolation = iota
+	// Previous uses the value of the latest earlier data point.
+	Previous
+	// Linear interpolates linearly between the surrounding data points.
+	Linear
+)
+
+var interpolationNames = map[Interpolation]string{
+	NoInterpolation: "none",
+	Previous:        "previous",
+	Linear:          "linear",
+}
+
+// String returns the name of the interpolation.
+func (i Interpolation) String() string {
+	if s, ok := interpolationNames[i]; ok {
+		return s
+	}
+	return fmt.Sprintf("Interpolation(%d)", int(i))
+}
+
+// Merge merges multiple timeseries (e.g. the same metric of multiple hosts)
+// onto a common time axis. The data sources of the result are named
+// "<name>/<source>" where name is the key of the respective timeseries in
+// series. All of them have data points at the same times, that is, at each
+// multiple of step from the earliest start time to the latest end time or,
+// if step is zero, at each time any of the timeseries has a data point.
+// Values between data points are determined using the specified
+// interpolation; values before the first or after the last data point of a
+// data source are NaN.
+func Merge(series map[string]Timeseries, step Duration, interp Interpolation) (Timeseries, error) {
+	if step < 0 {
+		return Timeseries{}, Errorf(CodeInvalidArgument, "invalid step %s", step)
+	}
+	if _, ok := interpolationNames[interp]; !ok {
+		return Timeseries{}, Errorf(CodeInvalidArgument, "unknown interpolation %s", interp)
+	}
+
+	var start, end time.Time
+	for _, ts := range series {
+		s, e := time.Time(ts.Start), time.Time(ts.End)
+		if s.IsZero() || e.IsZero() {
+			first, last := ts.span()
+			if s.IsZero() {
+				s = first
+			}
+			if e.IsZero() {
+				e = last
+			}
+		}
+		if !s.IsZero() && (start.IsZero() || s.Before(start)) {
+			start = s
+		}
+		if e.After(end) {
+			end = e
+		}
+	}
+
+	var axis []time.Time
+	if step > 0 {
+		for t := start; !t.After(end); t = t.Add(time.Duration(step)) {
+			axis = append(axis, t)
+		}
+	} else {
+		axis = timeAxis(series)
+	}
+
+	res := Timeseries{Start: Time(start), End: Time(end), Data: make(map[string][]DataPoint)}
+	for name, ts := range series {
+		for src, points := range ts.Data {
+			res.Data[name+"/"+src] = align(sortedPoints(points), axis, interp)
+		}
+	}
+	return res, nil
+}
+
+// timeAxis returns the sorted union of the times of all data points.
+func timeAxis(series map[string]Timeseries) []time.Time {
+	seen := make(map[int64]bool)
+	var axis []time.Time
+	for _, ts := range series {
+		for _, points := range ts.Data {
+			for _, p := range points {
+				t := time.Time(p.Timestamp)
+				if !seen[t.UnixNano()] {
+					seen[t.UnixNano()] = true
+					axis = append(axis, t)
+				}
+			}
+		}
+	}
+	sort.Slice(axis, func(i, j int) bool { return axis[i].Before(axis[j]) })
+	return axis
+}
+
+// align determines the values of the sorted data points at the sorted times
+// of the axis.
+func align(points []DataPoint, axis []time.Time, interp Interpolation) []DataPoint {
+	res := make([]DataPoint, len(axis))
+	i := 0 // index of the first data point not before t
+	for j, t := range axis {
+		for i < len(points) && time.Time(points[i].Timestamp).Before(t) {
+			i++
+		}
+		res[j] = DataPoint{Timestamp: Time(t), Value: math.NaN()}
+		switch {
+		case i < len(points) && time.Time(points[i].Timestamp).Equal(t):
+			res[j].Value = points[i].Value
+		case i == 0 || i == len(points):
+			// Before the first or after the last data point.
+		case interp == Previous:
+			res[j].Value = points[i-1].Value
+		case interp == Linear:
+			p, n := points[i-1], points[i]
+			pt, nt := time.Time(p.Timestamp), time.Time(n.Timestamp)
+			f := float64(t.Sub(pt)) / float64(nt.Sub(pt))
+			res[j].Value = p.Value + f*(n.Value-p.Value)
+		}
+	}
+	return res
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
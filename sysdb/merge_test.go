@@ -0,0 +1,101 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sysdb
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestMerge(t *testing.T) {
+	base := time.Date(2015, 5, 1, 12, 0, 0, 0, time.UTC)
+	nan := math.NaN()
+	series := map[string]Timeseries{
+		"h1": series(base, []int{0, 20, 40}, []float64{0, 2, 4}),
+		"h2": series(base, []int{10, 30}, []float64{10, 30}),
+	}
+	values := func(points []DataPoint) []float64 {
+		var v []float64
+		for _, p := range points {
+			v = append(v, p.Value)
+		}
+		return v
+	}
+	equal := func(a, b []float64) bool {
+		if len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if a[i] != b[i] && !(math.IsNaN(a[i]) && math.IsNaN(b[i])) {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, test := range []struct {
+		step   Duration
+		interp Interpolation
+		h1, h2 []float64
+	}{
+		{0, NoInterpolation, []float64{0, nan, 2, nan, 4}, []float64{nan, 10, nan, 30, nan}},
+		{0, Previous, []float64{0, 0, 2, 2, 4}, []float64{nan, 10, 10, 30, nan}},
+		{0, Linear, []float64{0, 1, 2, 3, 4}, []float64{nan, 10, 20, 30, nan}},
+		{20 * Second, Linear, []float64{0, 2, 4}, []float64{nan, 20, nan}},
+		{5 * Second, Previous, []float64{0, 0, 0, 0, 2, 2, 2, 2, 4}, []float64{nan, nan, 10, 10, 10, 10, 30, nan, nan}},
+	} {
+		got, err := Merge(series, test.step, test.interp)
+		if err != nil {
+			t.Errorf("Merge(%s, %s) = %v", test.step, test.interp, err)
+			continue
+		}
+		if len(got.Data) != 2 || !equal(values(got.Data["h1/value"]), test.h1) || !equal(values(got.Data["h2/value"]), test.h2) {
+			t.Errorf("Merge(%s, %s) = %v, %v; want %v, %v", test.step, test.interp,
+				values(got.Data["h1/value"]), values(got.Data["h2/value"]), test.h1, test.h2)
+		}
+		if !got.Start.Equal(Time(base)) || !got.End.Equal(Time(base.Add(40*time.Second))) {
+			t.Errorf("Merge(%s, %s) = [%s, %s]; want [%s, %s]", test.step, test.interp,
+				got.Start, got.End, base, base.Add(40*time.Second))
+		}
+		h1, h2 := got.Data["h1/value"], got.Data["h2/value"]
+		for i := range h1 {
+			if !h1[i].Timestamp.Equal(h2[i].Timestamp) {
+				t.Errorf("Merge(%s, %s): data sources not aligned at index %d", test.step, test.interp, i)
+				break
+			}
+		}
+	}
+
+	if _, err := Merge(series, -Second, Linear); ErrorCode(err) != CodeInvalidArgument {
+		t.Errorf("Merge(-1s) = %v; want <error %v>", err, CodeInvalidArgument)
+	}
+	if _, err := Merge(series, 0, Interpolation(42)); ErrorCode(err) != CodeInvalidArgument {
+		t.Errorf("Merge(<invalid interpolation>) = %v; want <error %v>", err, CodeInvalidArgument)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
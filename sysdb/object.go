@@ -0,0 +1,113 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sysdb
+
+// Object is the common interface of all stored objects. It is implemented by
+// *Host, *Service, *Metric, and *Attribute. Since the object types export
+// their properties as fields of the same name, the methods use a Get prefix.
+type Object interface {
+	// GetName returns the name of the object.
+	GetName() string
+	// GetLastUpdate returns the time of the last update of the object.
+	GetLastUpdate() Time
+	// GetUpdateInterval returns the interval at which the object is being
+	// updated.
+	GetUpdateInterval() Duration
+	// GetBackends returns the names of the backends providing the object.
+	GetBackends() []string
+	// GetAttributes returns the attributes of the object. Attributes do not
+	// have any attributes themselves.
+	GetAttributes() []Attribute
+}
+
+var (
+	_ Object = (*Host)(nil)
+	_ Object = (*Service)(nil)
+	_ Object = (*Metric)(nil)
+	_ Object = (*Attribute)(nil)
+)
+
+// GetName returns the name of the host.
+func (h *Host) GetName() string { return h.Name }
+
+// GetLastUpdate returns the time of the last update of the host.
+func (h *Host) GetLastUpdate() Time { return h.LastUpdate }
+
+// GetUpdateInterval returns the update interval of the host.
+func (h *Host) GetUpdateInterval() Duration { return h.UpdateInterval }
+
+// GetBackends returns the backends providing the host.
+func (h *Host) GetBackends() []string { return h.Backends }
+
+// GetAttributes returns the attributes of the host.
+func (h *Host) GetAttributes() []Attribute { return h.Attributes }
+
+// GetName returns the name of the service.
+func (s *Service) GetName() string { return s.Name }
+
+// GetLastUpdate returns the time of the last update of the service.
+func (s *Service) GetLastUpdate() Time { return s.LastUpdate }
+
+// GetUpdateInterval returns the update interval of the service.
+func (s *Service) GetUpdateInterval() Duration { return s.UpdateInterval }
+
+// GetBackends returns the backends providing the service.
+func (s *Service) GetBackends() []string { return s.Backends }
+
+// GetAttributes returns the attributes of the service.
+func (s *Service) GetAttributes() []Attribute { return s.Attributes }
+
+// GetName returns the name of the metric.
+func (m *Metric) GetName() string { return m.Name }
+
+// GetLastUpdate returns the time of the last update of the metric.
+func (m *Metric) GetLastUpdate() Time { return m.LastUpdate }
+
+// GetUpdateInterval returns the update interval of the metric.
+func (m *Metric) GetUpdateInterval() Duration { return m.UpdateInterval }
+
+// GetBackends returns the backends providing the metric.
+func (m *Metric) GetBackends() []string { return m.Backends }
+
+// GetAttributes returns the attributes of the metric.
+func (m *Metric) GetAttributes() []Attribute { return m.Attributes }
+
+// GetName returns the name of the attribute.
+func (a *Attribute) GetName() string { return a.Name }
+
+// GetLastUpdate returns the time of the last update of the attribute.
+func (a *Attribute) GetLastUpdate() Time { return a.LastUpdate }
+
+// GetUpdateInterval returns the update interval of the attribute.
+func (a *Attribute) GetUpdateInterval() Duration { return a.UpdateInterval }
+
+// GetBackends returns the backends providing the attribute.
+func (a *Attribute) GetBackends() []string { return a.Backends }
+
+// GetAttributes returns nil.
+func (a *Attribute) GetAttributes() []Attribute { return nil }
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,58 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sysdb
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestObject(t *testing.T) {
+	ts := Time(time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC))
+	attrs := []Attribute{{Name: "a", Value: "v"}}
+
+	for _, test := range []struct {
+		obj   Object
+		attrs []Attribute
+	}{
+		{&Host{Name: "o", LastUpdate: ts, UpdateInterval: Minute, Backends: []string{"b"}, Attributes: attrs}, attrs},
+		{&Service{Name: "o", LastUpdate: ts, UpdateInterval: Minute, Backends: []string{"b"}, Attributes: attrs}, attrs},
+		{&Metric{Name: "o", LastUpdate: ts, UpdateInterval: Minute, Backends: []string{"b"}, Attributes: attrs}, attrs},
+		{&Attribute{Name: "o", LastUpdate: ts, UpdateInterval: Minute, Backends: []string{"b"}}, nil},
+	} {
+		o := test.obj
+		if o.GetName() != "o" || o.GetLastUpdate() != ts || o.GetUpdateInterval() != Minute ||
+			!reflect.DeepEqual(o.GetBackends(), []string{"b"}) ||
+			!reflect.DeepEqual(o.GetAttributes(), test.attrs) {
+			t.Errorf("%T: GetName, GetLastUpdate, GetUpdateInterval, GetBackends, GetAttributes = %q, %v, %v, %v, %v; want %q, %v, %v, %v, %v",
+				o, o.GetName(), o.GetLastUpdate(), o.GetUpdateInterval(), o.GetBackends(), o.GetAttributes(),
+				"o", ts, Minute, []string{"b"}, test.attrs)
+		}
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,224 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sysdb
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// An Aggregation describes how to combine the values of multiple data points
+// into a single value.
+type Aggregation int
+
+// Aggregations supported when resampling timeseries.
+const (
+	// Mean is the arithmetic mean of all values.
+	Mean Aggregation = iota
+	// Min is the minimum of all values.
+	Min
+	// Max is the maximum of all values.
+	Max
+	// Last is the value of the latest data point.
+	Last
+)
+
+var aggregationNames = map[Aggregation]string{
+	Mean: "mean",
+	Min:  "min",
+	Max:  "max",
+	Last: "last",
+}
+
+// String returns the name of the aggregation.
+func (a Aggregation) String() string {
+	if s, ok := aggregationNames[a]; ok {
+		return s
+	}
+	return fmt.Sprintf("Aggregation(%d)", int(a))
+}
+
+// A bucket collects the data points of a single interval.
+type bucket struct {
+	// total is the number of data points; n is the number of non-NaN
+	// values.
+	total, n            int
+	sum, min, max, last float64
+}
+
+func (b *bucket) add(p DataPoint) {
+	// Data points are added in order.
+	b.last = p.Value
+	b.total++
+	if math.IsNaN(p.Value) {
+		return
+	}
+	if b.n == 0 || p.Value < b.min {
+		b.min = p.Value
+	}
+	if b.n == 0 || p.Value > b.max {
+		b.max = p.Value
+	}
+	b.sum += p.Value
+	b.n++
+}
+
+func (b *bucket) value(agg Aggregation) float64 {
+	if agg == Last {
+		return b.last
+	}
+	if b.n == 0 {
+		return math.NaN()
+	}
+	switch agg {
+	case Min:
+		return b.min
+	case Max:
+		return b.max
+	}
+	return b.sum / float64(b.n)
+}
+
+// resample aggregates points into buckets of step starting at origin.
+func resample(points []DataPoint, origin time.Time, step time.Duration, agg Aggregation) []DataPoint {
+	var res []DataPoint
+	var cur bucket
+	idx := int64(0)
+	flush := func() {
+		if cur.total > 0 {
+			res = append(res, DataPoint{
+				Timestamp: Time(origin.Add(time.Duration(idx) * step)),
+				Value:     cur.value(agg),
+			})
+		}
+		cur = bucket{}
+	}
+
+	for _, p := range sortedPoints(points) {
+		d := time.Time(p.Timestamp).Sub(origin)
+		i := int64(d / step)
+		if d < 0 && d%step != 0 {
+			i-- // round towards negative infinity
+		}
+		if i != idx {
+			flush()
+			idx = i
+		}
+		cur.add(p)
+	}
+	flush()
+	return res
+}
+
+// sortedPoints returns points sorted by timestamp. The slice is only copied
+// if it is not sorted yet.
+func sortedPoints(points []DataPoint) []DataPoint {
+	less := func(i, j int) bool {
+		return time.Time(points[i].Timestamp).Before(time.Time(points[j].Timestamp))
+	}
+	if sort.SliceIsSorted(points, less) {
+		return points
+	}
+	points = append([]DataPoint(nil), points...)
+	sort.SliceStable(points, less)
+	return points
+}
+
+// Resample returns a copy of the timeseries with the data points of each
+// data source aggregated into intervals of the specified step, starting at
+// the start of the timeseries. Each interval containing data points is
+// represented by a single data point with the timestamp of the start of the
+// interval and the aggregated value. NaN values are ignored (except by Last)
+// and intervals without any other values are aggregated to NaN.
+func (ts Timeseries) Resample(step Duration, agg Aggregation) (Timeseries, error) {
+	if step <= 0 {
+		return Timeseries{}, Errorf(CodeInvalidArgument, "invalid resampling step %s", step)
+	}
+	if _, ok := aggregationNames[agg]; !ok {
+		return Timeseries{}, Errorf(CodeInvalidArgument, "unknown aggregation %s", agg)
+	}
+
+	origin := time.Time(ts.Start)
+	if origin.IsZero() {
+		origin, _ = ts.span()
+	}
+	res := Timeseries{Start: ts.Start, End: ts.End, Data: make(map[string][]DataPoint, len(ts.Data))}
+	for src, points := range ts.Data {
+		res.Data[src] = resample(points, origin, time.Duration(step), agg)
+	}
+	return res, nil
+}
+
+// Downsample returns a copy of the timeseries with at most n data points per
+// data source by resampling it (see Resample) using equally sized intervals
+// covering the time between the start and end of the timeseries (or the
+// first and last data point if those are not set). Data sources with no more
+// than n data points are copied unchanged.
+func (ts Timeseries) Downsample(n int, agg Aggregation) (Timeseries, error) {
+	if n <= 0 {
+		return Timeseries{}, Errorf(CodeInvalidArgument, "invalid number of data points %d", n)
+	}
+	if _, ok := aggregationNames[agg]; !ok {
+		return Timeseries{}, Errorf(CodeInvalidArgument, "unknown aggregation %s", agg)
+	}
+
+	start, end := time.Time(ts.Start), time.Time(ts.End)
+	if start.IsZero() || !end.After(start) {
+		start, end = ts.span()
+	}
+	// Make sure that a data point at the end falls into the last interval.
+	step := end.Sub(start)/time.Duration(n) + 1
+
+	res := Timeseries{Start: ts.Start, End: ts.End, Data: make(map[string][]DataPoint, len(ts.Data))}
+	for src, points := range ts.Data {
+		if len(points) <= n {
+			res.Data[src] = append([]DataPoint(nil), points...)
+			continue
+		}
+		res.Data[src] = resample(points, start, step, agg)
+	}
+	return res, nil
+}
+
+// span returns the times of the first and last data point.
+func (ts Timeseries) span() (first, last time.Time) {
+	for _, points := range ts.Data {
+		for _, p := range points {
+			t := time.Time(p.Timestamp)
+			if first.IsZero() || t.Before(first) {
+				first = t
+			}
+			if last.IsZero() || t.After(last) {
+				last = t
+			}
+		}
+	}
+	return first, last
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,141 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sysdb
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// series returns a timeseries starting at base with a data point with the
+// specified value at each of the offsets (in seconds).
+func series(base time.Time, offsets []int, values []float64) Timeseries {
+	points := make([]DataPoint, len(offsets))
+	for i, o := range offsets {
+		points[i] = DataPoint{Timestamp: Time(base.Add(time.Duration(o) * time.Second)), Value: values[i]}
+	}
+	return Timeseries{
+		Start: Time(base),
+		End:   Time(base.Add(time.Duration(offsets[len(offsets)-1]) * time.Second)),
+		Data:  map[string][]DataPoint{"value": points},
+	}
+}
+
+// equalPoints compares data points treating NaN values as equal.
+func equalPoints(a, b []DataPoint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		va, vb := a[i].Value, b[i].Value
+		if !a[i].Timestamp.Equal(b[i].Timestamp) || (va != vb && !(math.IsNaN(va) && math.IsNaN(vb))) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestResample(t *testing.T) {
+	base := time.Date(2015, 5, 1, 12, 0, 0, 0, time.UTC)
+	nan := math.NaN()
+	// Unsorted data points with a gap between 20s and 40s.
+	ts := series(base, []int{0, 5, 15, 10, 40, 45}, []float64{1, 3, 2, 6, nan, nan})
+	at := func(offsets ...int) []DataPoint {
+		var points []DataPoint
+		for _, o := range offsets {
+			points = append(points, DataPoint{Timestamp: Time(base.Add(time.Duration(o) * time.Second))})
+		}
+		return points
+	}
+
+	for _, test := range []struct {
+		agg  Aggregation
+		want []float64
+	}{
+		{Mean, []float64{2, 4, nan}},
+		{Min, []float64{1, 2, nan}},
+		{Max, []float64{3, 6, nan}},
+		{Last, []float64{3, 2, nan}},
+	} {
+		got, err := ts.Resample(10*Second, test.agg)
+		want := at(0, 10, 40)
+		for i := range want {
+			want[i].Value = test.want[i]
+		}
+		if err != nil || !equalPoints(got.Data["value"], want) {
+			t.Errorf("Resample(10s, %s) = %v, %v; want %v, <nil>", test.agg, got.Data["value"], err, want)
+		}
+		if len(ts.Data["value"]) != 6 || ts.Data["value"][2].Value != 2 {
+			t.Errorf("Resample(10s, %s) modified the original timeseries: %v", test.agg, ts.Data["value"])
+		}
+	}
+
+	if _, err := ts.Resample(0, Mean); ErrorCode(err) != CodeInvalidArgument {
+		t.Errorf("Resample(0, mean) = %v; want <error %v>", err, CodeInvalidArgument)
+	}
+	if _, err := ts.Resample(Second, Aggregation(42)); ErrorCode(err) != CodeInvalidArgument {
+		t.Errorf("Resample(1s, <invalid>) = %v; want <error %v>", err, CodeInvalidArgument)
+	}
+}
+
+func TestDownsample(t *testing.T) {
+	base := time.Date(2015, 5, 1, 12, 0, 0, 0, time.UTC)
+	var offsets []int
+	var values []float64
+	for i := 0; i <= 100; i++ {
+		offsets = append(offsets, i)
+		values = append(values, float64(i))
+	}
+	ts := series(base, offsets, values)
+
+	for _, n := range []int{1, 3, 10, 100, 101, 200} {
+		got, err := ts.Downsample(n, Max)
+		if err != nil {
+			t.Errorf("Downsample(%d, max) = %v", n, err)
+			continue
+		}
+		points := got.Data["value"]
+		if len(points) > n || (n >= 101 && len(points) != 101) {
+			t.Errorf("Downsample(%d, max) returned %d data points", n, len(points))
+			continue
+		}
+		if last := points[len(points)-1]; last.Value != 100 {
+			t.Errorf("Downsample(%d, max) = %v; want last value 100", n, points)
+		}
+	}
+
+	// Use the data points if start and end are not set.
+	ts.Start, ts.End = Time{}, Time{}
+	if got, err := ts.Downsample(2, Min); err != nil || len(got.Data["value"]) != 2 || got.Data["value"][0].Value != 0 {
+		t.Errorf("Downsample(2, min) = %v, %v; want 2 data points starting with 0", got.Data["value"], err)
+	}
+	if _, err := ts.Downsample(0, Min); ErrorCode(err) != CodeInvalidArgument {
+		t.Errorf("Downsample(0, min) = %v; want <error %v>", err, CodeInvalidArgument)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -26,7 +26,12 @@
 package sysdb
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"math"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -52,48 +57,136 @@ const (
 	Year   = Duration(3652425 * 24 * 60 * 60 * 100000)
 )
 
-// MarshalJSON implements the json.Marshaler interface. The duration is a
-// quoted string in the SysDB JSON format.
-func (d Duration) MarshalJSON() ([]byte, error) {
+// A DurationStyle determines the verbosity of formatted durations.
+type DurationStyle int
+
+// Supported duration styles.
+const (
+	// Compact is the SysDB interval format as used in queries and in the
+	// JSON format (e.g. 1Y6M7D2h).
+	Compact DurationStyle = iota
+	// Long spells out all units (e.g. 1 year 6 months 7 days 2 hours).
+	Long
+)
+
+// durationUnits lists the units of durations in descending order.
+var durationUnits = []struct {
+	interval Duration
+	suffix   string
+	name     string
+}{
+	{Year, "Y", "year"},
+	{Month, "M", "month"},
+	{Day, "D", "day"},
+	{Hour, "h", "hour"},
+	{Minute, "m", "minute"},
+	{Second, "s", "second"},
+}
+
+// Format returns the duration formatted using the specified style. Fractions
+// of a second are formatted as decimal fractions with up to nine digits.
+func (d Duration) Format(style DurationStyle) string {
 	if d == 0 {
-		return []byte(`"0s"`), nil
-	}
-
-	s := `"`
-	secs := false
-	for _, spec := range []struct {
-		interval Duration
-		suffix   string
-	}{{Year, "Y"}, {Month, "M"}, {Day, "D"}, {Hour, "h"}, {Minute, "m"}, {Second, ""}} {
-		if d >= spec.interval {
-			s += fmt.Sprintf("%d%s", d/spec.interval, spec.suffix)
-			d %= spec.interval
-			if spec.interval == Second {
-				secs = true
-			}
+		if style == Long {
+			return "0 seconds"
 		}
+		return "0s"
+	}
+
+	sign := ""
+	if d < 0 {
+		sign, d = "-", -d
 	}
 
-	if d > 0 {
-		s += fmt.Sprintf(".%09d", d)
-		for i := len(s) - 1; i > 0; i-- {
-			if s[i] != '0' {
-				break
+	var parts []string
+	for _, u := range durationUnits {
+		if u.interval != Second {
+			if d >= u.interval {
+				n := int64(d / u.interval)
+				d %= u.interval
+				if style == Long {
+					parts = append(parts, fmt.Sprintf("%d %s", n, plural(u.name, n != 1)))
+				} else {
+					parts = append(parts, fmt.Sprintf("%d%s", n, u.suffix))
+				}
 			}
-			s = s[:i]
+			continue
+		}
+
+		if d == 0 {
+			break
+		}
+		secs := ""
+		if d >= Second || style == Long {
+			secs = fmt.Sprintf("%d", d/Second)
+		}
+		if frac := d % Second; frac > 0 {
+			secs += strings.TrimRight(fmt.Sprintf(".%09d", frac), "0")
+		}
+		if style == Long {
+			parts = append(parts, secs+" "+plural(u.name, d != Second))
+		} else {
+			parts = append(parts, secs+u.suffix)
 		}
-		secs = true
 	}
-	if secs {
-		s += "s"
+
+	sep := ""
+	if style == Long {
+		sep = " "
 	}
-	s += `"`
-	return []byte(s), nil
+	return sign + strings.Join(parts, sep)
 }
 
-// UnmarshalJSON implements the json.Unmarshaler interface. The duration is
-// expected to be a quoted string in the SysDB JSON format.
-func (d *Duration) UnmarshalJSON(data []byte) error {
+// FormatPrecision is like Format but limits the output to at most the
+// specified number of units, rounding the last one (e.g. 1Y2M rather than
+// 1Y2M1D1h2m). Seconds including their fractional part count as a single
+// unit. A precision of zero or less does not limit the output.
+func (d Duration) FormatPrecision(style DurationStyle, units int) string {
+	return d.round(units).Format(style)
+}
+
+// round rounds the duration to its n-th largest non-zero unit.
+func (d Duration) round(n int) Duration {
+	if n <= 0 {
+		return d
+	}
+	if d < 0 {
+		return -(-d).round(n)
+	}
+
+	// Years and months are not multiples of the smaller units, so round the
+	// remainder left after all larger units.
+	rem := d
+	for _, u := range durationUnits {
+		if u.interval == Second || rem < u.interval {
+			continue
+		}
+		if n--; n == 0 {
+			return d - rem + (rem+u.interval/2)/u.interval*u.interval
+		}
+		rem %= u.interval
+	}
+	return d
+}
+
+func plural(name string, many bool) string {
+	if many {
+		return name + "s"
+	}
+	return name
+}
+
+// MarshalJSON implements the json.Marshaler interface. The duration is a
+// quoted string in the SysDB JSON format.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + d.Format(Compact) + `"`), nil
+}
+
+// ParseDuration parses a duration in the SysDB interval format: a sequence
+// of decimal numbers, each with a unit suffix (Y, M, D, h, m, or s), for
+// example "1Y6M7D2h" or "1.5s". Only seconds may have a fractional part. A
+// leading minus sign denotes a negative duration.
+func ParseDuration(s string) (Duration, error) {
 	m := map[string]Duration{
 		"Y": Year,
 		"M": Month,
@@ -103,12 +196,16 @@ func (d *Duration) UnmarshalJSON(data []byte) error {
 		"s": Second,
 	}
 
-	if data[0] != '"' || data[len(data)-1] != '"' {
-		return fmt.Errorf("unquoted duration %q", string(data))
+	orig := s
+	data := []byte(s)
+	neg := false
+	if len(data) > 1 && data[0] == '-' {
+		neg, data = true, data[1:]
+	}
+	if len(data) == 0 {
+		return 0, Errorf(CodeInvalidFormat, "empty duration")
 	}
-	data = data[1 : len(data)-1]
 
-	orig := string(data)
 	var res Duration
 	for len(data) != 0 {
 		// consume digits
@@ -135,11 +232,11 @@ func (d *Duration) UnmarshalJSON(data []byte) error {
 			dec *= m
 		}
 		if n >= len(data) {
-			return fmt.Errorf("missing unit in duration %q", orig)
+			return 0, Errorf(CodeInvalidFormat, "missing unit in duration %q", orig)
 		}
 		if n == 0 {
 			// we found something which is not a number
-			return fmt.Errorf("invalid duration %q", orig)
+			return 0, Errorf(CodeInvalidFormat, "invalid duration %q", orig)
 		}
 
 		// consume unit
@@ -154,7 +251,7 @@ func (d *Duration) UnmarshalJSON(data []byte) error {
 		// convert to Duration
 		d, ok := m[unit]
 		if !ok {
-			return fmt.Errorf("invalid unit %q in duration %q", unit, orig)
+			return 0, Errorf(CodeInvalidFormat, "invalid unit %q in duration %q", unit, orig)
 		}
 
 		if d == Second {
@@ -162,22 +259,43 @@ func (d *Duration) UnmarshalJSON(data []byte) error {
 				d = 1
 			}
 		} else if frac {
-			return fmt.Errorf("invalid fraction %q%s in duration %q", dec, unit, orig)
+			return 0, Errorf(CodeInvalidFormat, "invalid fraction %d%s in duration %q", dec, unit, orig)
 		}
 
 		res += Duration(dec) * d
 	}
+	if neg {
+		res = -res
+	}
+	return res, nil
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface. The duration is
+// expected to be a quoted string in the SysDB JSON format.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	if len(data) < 2 || data[0] != '"' || data[len(data)-1] != '"' {
+		return Errorf(CodeInvalidFormat, "unquoted duration %q", string(data))
+	}
+	if len(data) == 2 {
+		*d = 0
+		return nil
+	}
+	res, err := ParseDuration(string(data[1 : len(data)-1]))
+	if err != nil {
+		return err
+	}
 	*d = res
 	return nil
 }
 
-// String returns the duration formatted using a predefined format string.
-func (d Duration) String() string { return time.Duration(d).String() }
+// String returns the duration in the SysDB interval format (see Format).
+func (d Duration) String() string { return d.Format(Compact) }
 
 // A Time represents an instant in time with nanosecond precision.
 //
 // It supports marshaling to and unmarshaling from the SysDB JSON format
-// (YYYY-MM-DD hh:mm:ss +-zzzz).
+// (YYYY-MM-DD hh:mm:ss +-zzzz). When unmarshaling, other common formats are
+// accepted as well (see TimeParser).
 type Time time.Time
 
 // MarshalJSON implements the json.Marshaler interface. The time is a quoted
@@ -187,13 +305,25 @@ func (t Time) MarshalJSON() ([]byte, error) {
 }
 
 // UnmarshalJSON implements the json.Unmarshaler interface. The time is
-// expected to be a quoted string in the SysDB JSON format.
+// expected to be a quoted string in the SysDB JSON format or any other
+// format supported by DefaultTimeParser, or a number of seconds since the
+// epoch. A JSON null leaves the time unchanged.
 func (t *Time) UnmarshalJSON(data []byte) error {
-	parsed, err := time.Parse(jsonTime, string(data))
-	if err == nil {
-		*t = Time(parsed)
+	s := string(bytes.TrimSpace(data))
+	if s == "null" {
+		return nil
+	}
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		s = s[1 : len(s)-1]
+	} else if _, ok := parseEpoch(s); !ok {
+		return Errorf(CodeInvalidFormat, "unquoted time %q", s)
 	}
-	return err
+	parsed, err := DefaultTimeParser.Parse(s)
+	if err != nil {
+		return err
+	}
+	*t = parsed
+	return nil
 }
 
 // Equal reports whether t and u represent the same time instant.
@@ -213,6 +343,14 @@ type Attribute struct {
 	Backends       []string `json:"backends"`
 }
 
+// A MetricStore describes the backing store of a metric's timeseries.
+type MetricStore struct {
+	// Type is the type of the store (e.g. "rrdtool").
+	Type string `json:"type"`
+	// ID identifies the timeseries within the store (e.g. a filename).
+	ID string `json:"id"`
+}
+
 // A Metric describes a metric known to SysDB.
 type Metric struct {
 	Name           string      `json:"name"`
@@ -221,6 +359,13 @@ type Metric struct {
 	UpdateInterval Duration    `json:"update_interval"`
 	Backends       []string    `json:"backends"`
 	Attributes     []Attribute `json:"attributes"`
+
+	// DataNames lists the names of the data sources of the timeseries, if
+	// provided by the server.
+	DataNames []string `json:"data_names,omitempty"`
+	// Store describes the backing store of the timeseries, if provided by
+	// the server.
+	Store *MetricStore `json:"store,omitempty"`
 }
 
 // A Service describes a service object stored in the SysDB store.
@@ -243,12 +388,194 @@ type Host struct {
 	Services       []Service   `json:"services"`
 }
 
+// A HostService is a service along with the name of its parent host.
+type HostService struct {
+	Host string `json:"host"`
+	Service
+}
+
+// A ServiceList is a list of services as returned when listing or looking up
+// services.
+//
+// It supports unmarshaling from the SysDB JSON format, either a list of
+// hosts including their services or a list of services including the name
+// of their host.
+type ServiceList []HostService
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (l *ServiceList) UnmarshalJSON(data []byte) error {
+	bare, err := isChildList(data)
+	if err != nil {
+		return err
+	}
+	if bare {
+		var svcs []HostService
+		if err := json.Unmarshal(data, &svcs); err != nil {
+			return err
+		}
+		*l = svcs
+		return nil
+	}
+
+	var hosts []Host
+	if err := json.Unmarshal(data, &hosts); err != nil {
+		return err
+	}
+	*l = Services(hosts)
+	return nil
+}
+
+// A HostMetric is a metric along with the name of its parent host.
+type HostMetric struct {
+	Host string `json:"host"`
+	Metric
+}
+
+// A MetricList is a list of metrics as returned when listing or looking up
+// metrics.
+//
+// Like a ServiceList, it supports unmarshaling from the SysDB JSON format,
+// either a list of hosts or a list of metrics.
+type MetricList []HostMetric
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (l *MetricList) UnmarshalJSON(data []byte) error {
+	bare, err := isChildList(data)
+	if err != nil {
+		return err
+	}
+	if bare {
+		var metrics []HostMetric
+		if err := json.Unmarshal(data, &metrics); err != nil {
+			return err
+		}
+		*l = metrics
+		return nil
+	}
+
+	var hosts []Host
+	if err := json.Unmarshal(data, &hosts); err != nil {
+		return err
+	}
+	*l = Metrics(hosts)
+	return nil
+}
+
+// isChildList reports whether the JSON list data describes services or
+// metrics along with the name of their host rather than hosts. Only the first
+// element of the list is decoded.
+func isChildList(data []byte) (bool, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	tok, err := dec.Token()
+	if err != nil {
+		return false, err
+	}
+	if tok != json.Delim('[') {
+		return false, fmt.Errorf("expected list, got %v", tok)
+	}
+	if !dec.More() {
+		return false, nil
+	}
+	var o map[string]json.RawMessage
+	if err := dec.Decode(&o); err != nil {
+		return false, err
+	}
+	_, ok := o["host"]
+	return ok, nil
+}
+
+// Services returns the services of all hosts.
+func Services(hosts []Host) ServiceList {
+	var l ServiceList
+	for _, h := range hosts {
+		for _, s := range h.Services {
+			l = append(l, HostService{Host: h.Name, Service: s})
+		}
+	}
+	return l
+}
+
+// Metrics returns the metrics of all hosts.
+func Metrics(hosts []Host) MetricList {
+	var l MetricList
+	for _, h := range hosts {
+		for _, m := range h.Metrics {
+			l = append(l, HostMetric{Host: h.Name, Metric: m})
+		}
+	}
+	return l
+}
+
 // A DataPoint describes a datum at a certain point of time.
 type DataPoint struct {
 	Timestamp Time    `json:"timestamp"`
 	Value     float64 `json:"value,string"`
 }
 
+// MarshalJSON implements the json.Marshaler interface. The value is encoded
+// as a quoted number, like the server does. Unlike the default encoding, NaN
+// and infinite values are supported and encoded as "nan", "inf", and "-inf".
+func (p DataPoint) MarshalJSON() ([]byte, error) {
+	var v []byte
+	switch {
+	case math.IsNaN(p.Value):
+		v = []byte("nan")
+	case math.IsInf(p.Value, 1):
+		v = []byte("inf")
+	case math.IsInf(p.Value, -1):
+		v = []byte("-inf")
+	default:
+		var err error
+		if v, err = json.Marshal(p.Value); err != nil {
+			return nil, err
+		}
+	}
+	ts, err := p.Timestamp.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(fmt.Sprintf(`{"timestamp":%s,"value":"%s"}`, ts, v)), nil
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface. In addition to
+// the quoted values emitted by the server, it accepts bare JSON numbers as
+// well as "nan" and "inf" tokens (quoted or unquoted, case insensitive).
+func (p *DataPoint) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Timestamp Time            `json:"timestamp"`
+		Value     json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	v, err := parseValue(raw.Value)
+	if err != nil {
+		return err
+	}
+	p.Timestamp, p.Value = raw.Timestamp, v
+	return nil
+}
+
+// parseValue parses a raw data-point value.
+func parseValue(data []byte) (float64, error) {
+	s := string(bytes.TrimSpace(data))
+	if s == "" || s == "null" {
+		return 0, nil
+	}
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		if err := json.Unmarshal([]byte(s), &s); err != nil {
+			return 0, Errorf(CodeInvalidFormat, "invalid value %s: %v", data, err)
+		}
+		s = strings.TrimSpace(s)
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, Errorf(CodeInvalidFormat, "invalid value %s", data)
+	}
+	return v, nil
+}
+
 // A Timeseries describes a sequence of data-points.
 type Timeseries struct {
 	Start Time                   `json:"start"`
@@ -26,6 +26,9 @@
 package sysdb
 
 import (
+	"encoding/json"
+	"math"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -98,6 +101,103 @@ func TestUnmarshalDuration(t *testing.T) {
 	}
 }
 
+func TestParseDuration(t *testing.T) {
+	for _, test := range []struct {
+		s        string
+		expected Duration
+		err      bool
+	}{
+		{"", 0, true},
+		{"-", 0, true},
+		{"1", 0, true},
+		{"1X", 0, true},
+		{"1.5m", 0, true},
+		{"0s", 0, false},
+		{"1Y6M7D2h", 47940228000000000 + 2*Hour, false},
+		{"1.5s", 1500000000, false},
+		{"-1m30s", -(Minute + 30*Second), false},
+		{"2D2D", 4 * Day, false},
+	} {
+		d, err := ParseDuration(test.s)
+		if (err != nil) != test.err || d != test.expected {
+			t.Errorf("ParseDuration(%q) = %s, %v; want %s (error: %v)", test.s, d, err, test.expected, test.err)
+		}
+		if err != nil && ErrorCode(err) != CodeInvalidFormat {
+			t.Errorf("ParseDuration(%q) = %v; want <error %v>", test.s, err, CodeInvalidFormat)
+		}
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	for _, test := range []struct {
+		d             Duration
+		compact, long string
+	}{
+		{0, "0s", "0 seconds"},
+		{123, ".000000123s", "0.000000123 seconds"},
+		{Second, "1s", "1 second"},
+		{1500 * Duration(time.Millisecond), "1.5s", "1.5 seconds"},
+		{Year + 2*Month + Day + Hour + 2*Minute, "1Y2M1D1h2m", "1 year 2 months 1 day 1 hour 2 minutes"},
+		{-(Minute + 30*Second), "-1m30s", "-1 minute 30 seconds"},
+	} {
+		if got := test.d.Format(Compact); got != test.compact {
+			t.Errorf("%d.Format(Compact) = %q; want %q", int64(test.d), got, test.compact)
+		}
+		if got := test.d.Format(Long); got != test.long {
+			t.Errorf("%d.Format(Long) = %q; want %q", int64(test.d), got, test.long)
+		}
+		if d, err := ParseDuration(test.d.Format(Compact)); err != nil || d != test.d {
+			t.Errorf("ParseDuration(%q) = %d, %v; want %d, <nil>", test.d.Format(Compact), int64(d), err, int64(test.d))
+		}
+	}
+}
+
+func TestFormatPrecision(t *testing.T) {
+	d := Year + 2*Month + Day + Hour + 2*Minute + 1500*Duration(time.Millisecond)
+	for _, test := range []struct {
+		d        Duration
+		units    int
+		expected string
+	}{
+		{d, 0, "1Y2M1D1h2m1.5s"},
+		{d, 1, "1Y"},
+		{d, 2, "1Y2M"},
+		{d, 4, "1Y2M1D1h"},
+		{d, 5, "1Y2M1D1h2m"},
+		{d, 6, "1Y2M1D1h2m1.5s"},
+		{d, 10, "1Y2M1D1h2m1.5s"},
+		{-d, 2, "-1Y2M"},
+		{Hour + 59*Minute + 59*Second, 2, "2h"},
+		{Hour + 29*Minute + 31*Second, 2, "1h30m"},
+		{Hour + 29*Minute + 29*Second, 2, "1h29m"},
+		{1500 * Duration(time.Millisecond), 1, "1.5s"},
+		{0, 1, "0s"},
+	} {
+		if got := test.d.FormatPrecision(Compact, test.units); got != test.expected {
+			t.Errorf("%d.FormatPrecision(Compact, %d) = %q; want %q", int64(test.d), test.units, got, test.expected)
+		}
+	}
+	if got, expected := d.FormatPrecision(Long, 2), "1 year 2 months"; got != expected {
+		t.Errorf("%d.FormatPrecision(Long, 2) = %q; want %q", int64(d), got, expected)
+	}
+}
+
+func TestDurationString(t *testing.T) {
+	for _, test := range []struct {
+		d        Duration
+		expected string
+	}{
+		{0, "0s"},
+		{150 * Year, "150Y"},
+		{Day + 90*Second, "1D1m30s"},
+		{-Second, "-1s"},
+	} {
+		if got := test.d.String(); got != test.expected {
+			t.Errorf("%d.String() = %q; want %q", int64(test.d), got, test.expected)
+		}
+	}
+}
+
 func TestMarshalTime(t *testing.T) {
 	tm := Time(time.Date(2014, 9, 18, 23, 42, 12, 123, time.UTC))
 	expected := `"2014-09-18 23:42:12 +0000"`
@@ -142,4 +242,110 @@ func TestUnmarshalTime(t *testing.T) {
 	}
 }
 
+func TestUnmarshalDataPoint(t *testing.T) {
+	ts := Time(time.Date(2014, 9, 18, 23, 42, 12, 0, time.UTC))
+	for _, test := range []struct {
+		value    string
+		expected float64
+		err      bool
+	}{
+		{`"42.5"`, 42.5, false},
+		{`42.5`, 42.5, false},
+		{`-1e3`, -1000, false},
+		{`" 7 "`, 7, false},
+		{`"nan"`, math.NaN(), false},
+		{`"NaN"`, math.NaN(), false},
+		{`"inf"`, math.Inf(1), false},
+		{`"-Inf"`, math.Inf(-1), false},
+		{`null`, 0, false},
+		{`""`, 0, true},
+		{`"abc"`, 0, true},
+		{`true`, 0, true},
+		{`[1]`, 0, true},
+	} {
+		data := `{"timestamp": "2014-09-18 23:42:12 +0000", "value": ` + test.value + `}`
+		var p DataPoint
+		err := json.Unmarshal([]byte(data), &p)
+		if (err != nil) != test.err {
+			t.Errorf("Unmarshal(%s) = %v; want error: %v", data, err, test.err)
+			continue
+		}
+		if test.err {
+			continue
+		}
+		if !p.Timestamp.Equal(ts) || !(p.Value == test.expected ||
+			math.IsNaN(p.Value) && math.IsNaN(test.expected)) {
+			t.Errorf("Unmarshal(%s) = %v; want {%s %v}", data, p, ts, test.expected)
+		}
+	}
+
+	// The output format is unchanged.
+	got, err := json.Marshal(DataPoint{Timestamp: ts, Value: 42.5})
+	expected := `{"timestamp":"2014-09-18 23:42:12 +0000","value":"42.5"}`
+	if err != nil || string(got) != expected {
+		t.Errorf("Marshal(DataPoint) = %s, %v; want %s, <nil>", got, err, expected)
+	}
+}
+
+func TestMarshalDataPoint(t *testing.T) {
+	ts := Time(time.Date(2014, 9, 18, 23, 42, 12, 0, time.UTC))
+	for _, test := range []struct {
+		value    float64
+		expected string
+	}{
+		{42.5, `"42.5"`},
+		{-3, `"-3"`},
+		{100000000, `"100000000"`},
+		{1e21, `"1e+21"`},
+		{math.NaN(), `"nan"`},
+		{math.Inf(1), `"inf"`},
+		{math.Inf(-1), `"-inf"`},
+	} {
+		p := DataPoint{Timestamp: ts, Value: test.value}
+		got, err := json.Marshal(p)
+		expected := `{"timestamp":"2014-09-18 23:42:12 +0000","value":` + test.expected + `}`
+		if err != nil || string(got) != expected {
+			t.Errorf("Marshal(%v) = %s, %v; want %s, <nil>", p, got, err, expected)
+			continue
+		}
+
+		var q DataPoint
+		if err := json.Unmarshal(got, &q); err != nil || !q.Timestamp.Equal(ts) ||
+			!(q.Value == test.value || math.IsNaN(q.Value) && math.IsNaN(test.value)) {
+			t.Errorf("Unmarshal(Marshal(%v)) = %v, %v; want %v, <nil>", p, q, err, p)
+		}
+	}
+}
+
+func TestUnmarshalLists(t *testing.T) {
+	for _, data := range []string{
+		`[{"name": "h1", "services": [{"name": "s1"}, {"name": "s2"}], "metrics": [{"name": "m1"}, {"name": "m2"}]}]`,
+		`[{"host": "h1", "name": "s1"}, {"host": "h1", "name": "s2"}]`,
+	} {
+		var svcs ServiceList
+		if err := json.Unmarshal([]byte(data), &svcs); err != nil || len(svcs) != 2 ||
+			svcs[0].Host != "h1" || svcs[0].Name != "s1" || svcs[1].Name != "s2" {
+			t.Errorf("json.Unmarshal(%s, ServiceList) = %v, %v; want [h1.s1 h1.s2]", data, svcs, err)
+		}
+	}
+
+	data := `[{"name": "h1", "metrics": [{"name": "m1", "timeseries": true}]}, {"name": "h2", "metrics": [{"name": "m2"}]}]`
+	var metrics MetricList
+	if err := json.Unmarshal([]byte(data), &metrics); err != nil || len(metrics) != 2 ||
+		metrics[0].Host != "h1" || !metrics[0].Timeseries || metrics[1].Host != "h2" || metrics[1].Name != "m2" {
+		t.Errorf("json.Unmarshal(%s, MetricList) = %v, %v; want [h1.m1 h2.m2]", data, metrics, err)
+	}
+
+	data = `[{"name": "h1", "metrics": [{"name": "m1", "timeseries": true, "data_names": ["rx", "tx"], "store": {"type": "rrdtool", "id": "/var/lib/m1.rrd"}}]}]`
+	if err := json.Unmarshal([]byte(data), &metrics); err != nil || len(metrics) != 1 ||
+		!reflect.DeepEqual(metrics[0].DataNames, []string{"rx", "tx"}) ||
+		metrics[0].Store == nil || *metrics[0].Store != (MetricStore{Type: "rrdtool", ID: "/var/lib/m1.rrd"}) {
+		t.Errorf("json.Unmarshal(%s, MetricList) = %+v, %v; want data names and store", data, metrics, err)
+	}
+
+	if err := json.Unmarshal([]byte(`{"name": "h1"}`), &metrics); err == nil {
+		t.Errorf("json.Unmarshal(<object>, MetricList) = <nil>; want error")
+	}
+}
+
 // vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,125 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sysdb
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A TimeParser parses date-time values in any of the formats emitted by
+// SysDB servers and related tools:
+//
+//	2006-01-02 15:04:05 -0700             the SysDB JSON format
+//	2006-01-02 15:04:05.999999999 -0700   the same with fractional seconds
+//	2006-01-02T15:04:05.999999999Z07:00   RFC 3339
+//	2006-01-02 15:04:05.999999999         without time zone
+//	2006-01-02T15:04:05.999999999         without time zone
+//	2006-01-02                            without time zone
+//	1136214245.999999999                  seconds since the epoch
+type TimeParser struct {
+	// Location is used for timestamps without time zone information. If
+	// nil, UTC is used.
+	Location *time.Location
+	// Strict rejects timestamps without time zone information since their
+	// meaning depends on the configured location.
+	Strict bool
+}
+
+// DefaultTimeParser is used by ParseTime and Time.UnmarshalJSON. It may be
+// configured during initialization, that is, before parsing any times.
+var DefaultTimeParser = &TimeParser{}
+
+var (
+	zonedLayouts = []string{
+		"2006-01-02 15:04:05.999999999 -0700",
+		time.RFC3339Nano,
+	}
+	naiveLayouts = []string{
+		"2006-01-02 15:04:05.999999999",
+		"2006-01-02T15:04:05.999999999",
+		"2006-01-02",
+	}
+)
+
+// ParseTime parses a date-time value using DefaultTimeParser.
+func ParseTime(s string) (Time, error) {
+	return DefaultTimeParser.Parse(s)
+}
+
+// Parse parses a date-time value in any of the supported formats.
+func (p *TimeParser) Parse(s string) (Time, error) {
+	s = strings.TrimSpace(s)
+	if t, ok := parseEpoch(s); ok {
+		return t, nil
+	}
+
+	for _, layout := range zonedLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return Time(t), nil
+		}
+	}
+	for _, layout := range naiveLayouts {
+		loc := p.Location
+		if loc == nil {
+			loc = time.UTC
+		}
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			if p.Strict {
+				return Time{}, Errorf(CodeInvalidFormat, "ambiguous time %q: missing time zone", s)
+			}
+			return Time(t), nil
+		}
+	}
+	return Time{}, Errorf(CodeInvalidFormat, "invalid time %q", s)
+}
+
+var epochRE = regexp.MustCompile(`^(-?)([0-9]+)(?:\.([0-9]{1,9})[0-9]*)?$`)
+
+// parseEpoch parses a (possibly fractional) number of seconds since the
+// epoch.
+func parseEpoch(s string) (Time, bool) {
+	m := epochRE.FindStringSubmatch(s)
+	if m == nil {
+		return Time{}, false
+	}
+	sec, err := strconv.ParseInt(m[2], 10, 64)
+	if err != nil {
+		return Time{}, false
+	}
+	var nsec int64
+	if m[3] != "" {
+		nsec, _ = strconv.ParseInt((m[3] + "00000000")[:9], 10, 64)
+	}
+	if m[1] == "-" {
+		sec, nsec = -sec, -nsec
+	}
+	return Time(time.Unix(sec, nsec).UTC()), true
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,101 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sysdb
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestTimeParser(t *testing.T) {
+	berlin := time.FixedZone("CET", 3600)
+	utc := func(s string) Time {
+		tm, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			t.Fatalf("time.Parse(%q) = %v", s, err)
+		}
+		return Time(tm)
+	}
+
+	for _, test := range []struct {
+		p        TimeParser
+		s        string
+		expected Time
+		err      bool
+	}{
+		{TimeParser{}, "2014-09-18 23:42:12 +0000", utc("2014-09-18T23:42:12Z"), false},
+		{TimeParser{}, "2014-09-18 23:42:12.123456789 +0200", utc("2014-09-18T21:42:12.123456789Z"), false},
+		{TimeParser{}, "2014-09-18T23:42:12.5Z", utc("2014-09-18T23:42:12.5Z"), false},
+		{TimeParser{}, "2014-09-18T23:42:12+02:00", utc("2014-09-18T21:42:12Z"), false},
+		{TimeParser{}, "2014-09-18 23:42:12", utc("2014-09-18T23:42:12Z"), false},
+		{TimeParser{}, "2014-09-18T23:42:12.25", utc("2014-09-18T23:42:12.25Z"), false},
+		{TimeParser{}, "2014-09-18", utc("2014-09-18T00:00:00Z"), false},
+		{TimeParser{Location: berlin}, "2014-09-18 23:42:12", utc("2014-09-18T22:42:12Z"), false},
+		{TimeParser{Location: berlin}, "2014-09-18 23:42:12 +0000", utc("2014-09-18T23:42:12Z"), false},
+		{TimeParser{Strict: true}, "2014-09-18 23:42:12", Time{}, true},
+		{TimeParser{Strict: true}, "2014-09-18 23:42:12 +0000", utc("2014-09-18T23:42:12Z"), false},
+		{TimeParser{}, "1411083732", utc("2014-09-18T23:42:12Z"), false},
+		{TimeParser{Strict: true}, "1411083732.5", utc("2014-09-18T23:42:12.5Z"), false},
+		{TimeParser{}, "-1.5", utc("1969-12-31T23:59:58.5Z"), false},
+		{TimeParser{}, "1e9", Time{}, true},
+		{TimeParser{}, "", Time{}, true},
+		{TimeParser{}, "2014-09-18T23:42:12Z00:00", Time{}, true},
+	} {
+		got, err := test.p.Parse(test.s)
+		if (err != nil) != test.err || !got.Equal(test.expected) {
+			t.Errorf("%+v.Parse(%q) = %s, %v; want %s (error: %v)", test.p, test.s, got, err, test.expected, test.err)
+		}
+		if err != nil && ErrorCode(err) != CodeInvalidFormat {
+			t.Errorf("%+v.Parse(%q) = %v; want <error %v>", test.p, test.s, err, CodeInvalidFormat)
+		}
+	}
+}
+
+func TestUnmarshalTimeFormats(t *testing.T) {
+	expected := Time(time.Date(2014, 9, 18, 23, 42, 12, 0, time.UTC))
+	for _, data := range []string{
+		`"2014-09-18 23:42:12 +0000"`,
+		`"2014-09-18T23:42:12Z"`,
+		`1411083732`,
+		`"1411083732"`,
+	} {
+		var tm Time
+		if err := json.Unmarshal([]byte(data), &tm); err != nil || !tm.Equal(expected) {
+			t.Errorf("Unmarshal(%s) = %s, %v; want %s, <nil>", data, tm, err, expected)
+		}
+	}
+
+	tm := expected
+	if err := json.Unmarshal([]byte(`null`), &tm); err != nil || !tm.Equal(expected) {
+		t.Errorf("Unmarshal(null) = %s, %v; want %s, <nil>", tm, err, expected)
+	}
+	if err := tm.UnmarshalJSON([]byte(`true`)); ErrorCode(err) != CodeInvalidFormat {
+		t.Errorf("UnmarshalJSON(true) = %v; want <error %v>", err, CodeInvalidFormat)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
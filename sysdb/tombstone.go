@@ -0,0 +1,112 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sysdb
+
+import "time"
+
+// A Tombstone represents an object which disappeared from the store. Keeping
+// tombstones around for a while allows consumers of snapshots to distinguish
+// deleted objects from objects which were merely not part of a query result.
+type Tombstone struct {
+	// Type is the type of the object ("host", "service", or "metric").
+	Type string `json:"type"`
+	// Host is the name of the parent host of services and metrics.
+	Host string `json:"host,omitempty"`
+	// Name is the name of the object.
+	Name string `json:"name"`
+	// LastSeen is the last time the object was known to exist, for example,
+	// the time of the last snapshot including it.
+	LastSeen Time `json:"last_seen"`
+}
+
+// Tombstones is a list of tombstones.
+type Tombstones []Tombstone
+
+// TombstonesOf returns tombstones for all hosts, services, and metrics
+// removed according to changes (see DiffHosts). Removed attributes are
+// ignored. All tombstones are last seen at the specified time, usually the
+// time of the old snapshot.
+func TombstonesOf(changes []Change, lastSeen Time) Tombstones {
+	var res Tombstones
+	for _, c := range changes {
+		if c.Kind != Removed {
+			continue
+		}
+		switch c.Type {
+		case "host":
+			res = append(res, Tombstone{Type: c.Type, Name: c.Host, LastSeen: lastSeen})
+		case "service":
+			res = append(res, Tombstone{Type: c.Type, Host: c.Host, Name: c.Service, LastSeen: lastSeen})
+		case "metric":
+			res = append(res, Tombstone{Type: c.Type, Host: c.Host, Name: c.Metric, LastSeen: lastSeen})
+		}
+	}
+	return res
+}
+
+// Retain returns the tombstones which have been seen within the specified
+// retention period before now, dropping all older ones. A retention of zero
+// retains all tombstones.
+func (ts Tombstones) Retain(now time.Time, retention Duration) Tombstones {
+	if retention == 0 {
+		return ts
+	}
+	cutoff := now.Add(-time.Duration(retention))
+	var res Tombstones
+	for _, t := range ts {
+		if !time.Time(t.LastSeen).Before(cutoff) {
+			res = append(res, t)
+		}
+	}
+	return res
+}
+
+// Revive returns the tombstones of objects which do not exist in hosts,
+// dropping those of objects which reappeared.
+func (ts Tombstones) Revive(hosts []Host) Tombstones {
+	index := make(map[string]*Host, len(hosts))
+	for i := range hosts {
+		index[hosts[i].Name] = &hosts[i]
+	}
+	var res Tombstones
+	for _, t := range ts {
+		exists := false
+		switch t.Type {
+		case "host":
+			exists = index[t.Name] != nil
+		case "service":
+			exists = index[t.Host] != nil && index[t.Host].Service(t.Name) != nil
+		case "metric":
+			exists = index[t.Host] != nil && index[t.Host].Metric(t.Name) != nil
+		}
+		if !exists {
+			res = append(res, t)
+		}
+	}
+	return res
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,117 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sysdb
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTombstonesOf(t *testing.T) {
+	seen := Time(time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC))
+	old := []Host{
+		{Name: "a"},
+		{Name: "b", Services: []Service{{Name: "s1"}, {Name: "s2"}}, Metrics: []Metric{{Name: "m1"}},
+			Attributes: []Attribute{{Name: "x", Value: "1"}}},
+	}
+	new := []Host{
+		{Name: "b", Services: []Service{{Name: "s2"}}},
+		{Name: "c"},
+	}
+	expected := Tombstones{
+		{Type: "host", Name: "a", LastSeen: seen},
+		{Type: "metric", Host: "b", Name: "m1", LastSeen: seen},
+		{Type: "service", Host: "b", Name: "s1", LastSeen: seen},
+	}
+	if got := TombstonesOf(DiffHosts(old, new), seen); !reflect.DeepEqual(got, expected) {
+		t.Errorf("TombstonesOf(DiffHosts(%v, %v)) = %+v; want %+v", old, new, got, expected)
+	}
+	if got := TombstonesOf(nil, seen); got != nil {
+		t.Errorf("TombstonesOf(<nil>) = %+v; want <nil>", got)
+	}
+}
+
+func TestTombstonesRetain(t *testing.T) {
+	now := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+	ts := Tombstones{
+		{Type: "host", Name: "old", LastSeen: Time(now.Add(-2 * time.Hour))},
+		{Type: "host", Name: "edge", LastSeen: Time(now.Add(-time.Hour))},
+		{Type: "host", Name: "new", LastSeen: Time(now.Add(-time.Minute))},
+	}
+	for _, test := range []struct {
+		retention Duration
+		expected  Tombstones
+	}{
+		{0, ts},
+		{Duration(3 * time.Hour), ts},
+		{Duration(time.Hour), ts[1:]},
+		{Duration(time.Minute), ts[2:]},
+		{Duration(time.Second), nil},
+	} {
+		if got := ts.Retain(now, test.retention); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("Retain(%v, %v) = %+v; want %+v", now, test.retention, got, test.expected)
+		}
+	}
+}
+
+func TestTombstonesRevive(t *testing.T) {
+	ts := Tombstones{
+		{Type: "host", Name: "a"},
+		{Type: "host", Name: "b"},
+		{Type: "service", Host: "b", Name: "s1"},
+		{Type: "service", Host: "c", Name: "s1"},
+		{Type: "metric", Host: "c", Name: "m1"},
+		{Type: "metric", Host: "c", Name: "m2"},
+	}
+	for _, test := range []struct {
+		hosts    []Host
+		expected Tombstones
+	}{
+		{nil, ts},
+		{
+			[]Host{
+				{Name: "b"},
+				{Name: "c", Services: []Service{{Name: "s1"}}, Metrics: []Metric{{Name: "m2"}}},
+			},
+			Tombstones{ts[0], ts[2], ts[4]},
+		},
+		{
+			[]Host{
+				{Name: "a"},
+				{Name: "b", Services: []Service{{Name: "s1"}}},
+				{Name: "c", Services: []Service{{Name: "s1"}}, Metrics: []Metric{{Name: "m1"}, {Name: "m2"}}},
+			},
+			nil,
+		},
+	} {
+		if got := ts.Revive(test.hosts); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("Revive(%v) = %+v; want %+v", test.hosts, got, test.expected)
+		}
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,105 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sysdb
+
+import "errors"
+
+// SkipChildren may be returned by a WalkFunc to skip the children of the
+// visited object. It is not returned as an error by Walk.
+var SkipChildren = errors.New("skip children")
+
+// A Node is an object visited by Walk.
+type Node struct {
+	// Object is the visited object: a *Host, *Service, *Metric, or
+	// *Attribute referring to the walked host or its children.
+	Object Object
+	// Parent is the parent object of the visited object (the *Host of
+	// services and metrics or the *Host, *Service, or *Metric owning an
+	// attribute). It is nil for hosts.
+	Parent Object
+	// Host is the walked host.
+	Host *Host
+}
+
+// A WalkFunc is called by Walk for each visited object. If it returns
+// SkipChildren, the children of the object are not visited. Any other error
+// stops the walk.
+type WalkFunc func(n Node) error
+
+// Walk traverses the host and all of its children in depth-first order,
+// calling fn for each object: the host, its attributes, its metrics (each
+// followed by its attributes), and its services (each followed by its
+// attributes). Children are visited in the order in which they are stored.
+// Walk returns the first error returned by fn other than SkipChildren.
+func Walk(h *Host, fn WalkFunc) error {
+	err := fn(Node{Object: h, Host: h})
+	if err == SkipChildren {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if err := walkAttributes(h, h, h.Attributes, fn); err != nil {
+		return err
+	}
+	for i := range h.Metrics {
+		m := &h.Metrics[i]
+		err := fn(Node{Object: m, Parent: h, Host: h})
+		if err == SkipChildren {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if err := walkAttributes(h, m, m.Attributes, fn); err != nil {
+			return err
+		}
+	}
+	for i := range h.Services {
+		s := &h.Services[i]
+		err := fn(Node{Object: s, Parent: h, Host: h})
+		if err == SkipChildren {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if err := walkAttributes(h, s, s.Attributes, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func walkAttributes(h *Host, parent Object, attrs []Attribute, fn WalkFunc) error {
+	for i := range attrs {
+		// attributes do not have any children
+		if err := fn(Node{Object: &attrs[i], Parent: parent, Host: h}); err != nil && err != SkipChildren {
+			return err
+		}
+	}
+	return nil
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
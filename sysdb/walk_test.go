@@ -0,0 +1,145 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sysdb
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// describe returns a textual description of the node.
+func describe(n Node) string {
+	name := func(obj Object) string {
+		switch o := obj.(type) {
+		case *Host:
+			return "host " + o.Name
+		case *Service:
+			return "service " + o.Name
+		case *Metric:
+			return "metric " + o.Name
+		case *Attribute:
+			return "attribute " + o.Name
+		case nil:
+			return "<nil>"
+		}
+		return fmt.Sprintf("<%T>", obj)
+	}
+	return name(n.Object) + " (" + name(n.Parent) + ")"
+}
+
+func TestWalk(t *testing.T) {
+	h := testHost()
+	stop := errors.New("stop")
+
+	for _, test := range []struct {
+		skip, stop string
+		expected   []string
+		err        error
+	}{
+		{
+			"", "",
+			[]string{
+				"host h1 (<nil>)",
+				"attribute b (host h1)",
+				"attribute a (host h1)",
+				"metric m2 (host h1)",
+				"metric m1 (host h1)",
+				"attribute unit (metric m1)",
+				"attribute type (metric m1)",
+				"service s2 (host h1)",
+				"service s1 (host h1)",
+				"attribute z (service s1)",
+				"attribute y (service s1)",
+			},
+			nil,
+		},
+		{"host h1", "", []string{"host h1 (<nil>)"}, nil},
+		{
+			"metric m1", "",
+			[]string{
+				"host h1 (<nil>)",
+				"attribute b (host h1)",
+				"attribute a (host h1)",
+				"metric m2 (host h1)",
+				"metric m1 (host h1)",
+				"service s2 (host h1)",
+				"service s1 (host h1)",
+				"attribute z (service s1)",
+				"attribute y (service s1)",
+			},
+			nil,
+		},
+		{
+			"attribute a", "attribute unit",
+			[]string{
+				"host h1 (<nil>)",
+				"attribute b (host h1)",
+				"attribute a (host h1)",
+				"metric m2 (host h1)",
+				"metric m1 (host h1)",
+				"attribute unit (metric m1)",
+			},
+			stop,
+		},
+		{"", "service s2", nil, stop},
+	} {
+		var got []string
+		err := Walk(&h, func(n Node) error {
+			if n.Host != &h {
+				t.Errorf("Walk(): Node.Host = %p; want %p", n.Host, &h)
+			}
+			got = append(got, describe(n))
+			name := describe(Node{Object: n.Object})
+			name = name[:len(name)-len(" (<nil>)")]
+			if name == test.skip {
+				return SkipChildren
+			}
+			if name == test.stop {
+				return stop
+			}
+			return nil
+		})
+		if test.expected != nil && !reflect.DeepEqual(got, test.expected) || err != test.err {
+			t.Errorf("Walk(skip: %q, stop: %q) = %v; want %v\nvisited: %q\nwant: %q",
+				test.skip, test.stop, err, test.err, got, test.expected)
+		}
+	}
+
+	// Objects may be modified through the visited nodes.
+	Walk(&h, func(n Node) error {
+		if a, ok := n.Object.(*Attribute); ok {
+			a.Value = "x"
+		}
+		return nil
+	})
+	if h.Attributes[0].Value != "x" || h.Services[1].Attributes[1].Value != "x" {
+		t.Errorf("Walk() did not allow modifying attributes: %+v", h)
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
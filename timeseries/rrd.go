@@ -0,0 +1,154 @@
+//go:build !sysdb_no_rrd
+
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package timeseries
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sysdb/go/registry"
+	"github.com/sysdb/go/sysdb"
+)
+
+func init() {
+	registry.Register(registry.TimeseriesFetcher, "rrdtool", func(config map[string]string) (interface{}, error) {
+		return &RRD{Dir: config["dir"], CF: config["cf"], Command: config["command"]}, nil
+	})
+}
+
+// RRD fetches timeseries from RRD files using the rrdtool command.
+type RRD struct {
+	// Dir is the base directory of all RRD files. Unless Path is set, the
+	// file of a metric is <Dir>/<host>/<metric>.rrd, as used by collectd.
+	// Names referring to files outside of the host's directory are
+	// rejected.
+	Dir string
+	// Path optionally determines the file name of a metric.
+	Path func(host, metric string) (string, error)
+	// CF is the consolidation function (default: AVERAGE).
+	CF string
+	// Command is the rrdtool executable (default: rrdtool).
+	Command string
+}
+
+// Fetch implements the client.TimeseriesFetcher interface.
+func (r *RRD) Fetch(host, metric string, start, end time.Time) (*sysdb.Timeseries, error) {
+	var path string
+	var err error
+	if r.Path != nil {
+		path, err = r.Path(host, metric)
+	} else {
+		path, err = metricPath(r.Dir, host, metric, ".rrd")
+	}
+	if err != nil {
+		return nil, err
+	}
+	cf, cmd := r.CF, r.Command
+	if cf == "" {
+		cf = "AVERAGE"
+	}
+	if cmd == "" {
+		cmd = "rrdtool"
+	}
+
+	out, err := exec.Command(cmd, "fetch", path, cf,
+		"--start", strconv.FormatInt(start.Unix(), 10),
+		"--end", strconv.FormatInt(end.Unix(), 10)).Output()
+	if err != nil {
+		if e, ok := err.(*exec.ExitError); ok && len(e.Stderr) > 0 {
+			return nil, sysdb.Errorf(sysdb.CodeRequestFailed, "rrdtool fetch %s: %s",
+				path, strings.TrimSpace(string(e.Stderr)))
+		}
+		return nil, err
+	}
+	ts, err := parseRRDFetch(bytes.NewReader(out))
+	if err != nil {
+		return nil, err
+	}
+	ts.Start, ts.End = sysdb.Time(start), sysdb.Time(end)
+	return ts, nil
+}
+
+// parseRRDFetch parses the output of 'rrdtool fetch': a header line listing
+// all data sources followed by one line per timestamp listing all values.
+func parseRRDFetch(r io.Reader) (*sysdb.Timeseries, error) {
+	ts := &sysdb.Timeseries{Data: make(map[string][]sysdb.DataPoint)}
+	var names []string
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" {
+			continue
+		}
+		if names == nil {
+			names = strings.Fields(line)
+			continue
+		}
+
+		i := strings.IndexByte(line, ':')
+		if i < 0 {
+			return nil, sysdb.Errorf(sysdb.CodeMalformedMessage, "invalid rrdtool output %q", line)
+		}
+		secs, err := strconv.ParseInt(line[:i], 10, 64)
+		if err != nil {
+			return nil, sysdb.Errorf(sysdb.CodeMalformedMessage, "invalid timestamp in rrdtool output %q", line)
+		}
+		values := strings.Fields(line[i+1:])
+		if len(values) != len(names) {
+			return nil, sysdb.Errorf(sysdb.CodeMalformedMessage,
+				"expected %d values in rrdtool output %q", len(names), line)
+		}
+		for j, v := range values {
+			// Unknown values are printed as "nan" or "-nan" but the
+			// latter is not understood by ParseFloat.
+			f, err := strconv.ParseFloat(strings.TrimPrefix(v, "-"), 64)
+			if err != nil {
+				return nil, sysdb.Errorf(sysdb.CodeMalformedMessage, "invalid value in rrdtool output %q", line)
+			}
+			if strings.HasPrefix(v, "-") {
+				f = -f
+			}
+			ts.Data[names[j]] = append(ts.Data[names[j]], sysdb.DataPoint{
+				Timestamp: sysdb.Time(time.Unix(secs, 0)),
+				Value:     f,
+			})
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return ts, nil
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,74 @@
+//go:build !sysdb_no_rrd
+
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package timeseries
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+func TestParseRRDFetch(t *testing.T) {
+	out := `                          shortterm           midterm
+
+1420070400: 1.0000000000e+00 2.5000000000e-01
+1420070460: -nan -nan
+1420070520: 3.0000000000e+00 -1.0000000000e+00
+`
+	ts, err := parseRRDFetch(strings.NewReader(out))
+	if err != nil {
+		t.Fatalf("parseRRDFetch() = %v", err)
+	}
+	if len(ts.Data) != 2 || len(ts.Data["shortterm"]) != 3 || len(ts.Data["midterm"]) != 3 {
+		t.Fatalf("parseRRDFetch() = %v; want two data sources with three points each", ts.Data)
+	}
+	mid := ts.Data["midterm"]
+	if mid[0].Value != 0.25 || !math.IsNaN(mid[1].Value) || mid[2].Value != -1 ||
+		time.Time(mid[2].Timestamp).Unix() != 1420070520 {
+		t.Errorf("parseRRDFetch() midterm = %v; want [0.25 NaN -1]", mid)
+	}
+
+	if _, err := parseRRDFetch(strings.NewReader("a b\n1: 1\n")); err == nil {
+		t.Errorf("parseRRDFetch(<missing value>) = <nil>; want <err>")
+	}
+}
+
+func TestRRDTraversal(t *testing.T) {
+	// The command must not be run for invalid names.
+	r := &RRD{Dir: t.TempDir(), Command: "/nonexistent/rrdtool"}
+	for _, name := range [][2]string{{"h1", "../../x"}, {"..", "x"}, {"h1/../../x", "y"}} {
+		if ts, err := r.Fetch(name[0], name[1], time.Unix(0, 0), time.Unix(60, 0)); sysdb.ErrorCode(err) != sysdb.CodeInvalidArgument {
+			t.Errorf("Fetch(%q, %q) = %v, %v; want <error %v>", name[0], name[1], ts, err, sysdb.CodeInvalidArgument)
+		}
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
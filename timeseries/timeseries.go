@@ -0,0 +1,172 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package timeseries provides implementations of client.TimeseriesFetcher
+// accessing timeseries data stores directly.
+//
+// Timeseries may be read from RRD files (using the rrdtool command), from
+// Whisper files as used by Graphite, or from HTTP services. A Mux selects
+// the fetcher to use for each metric based on the metric's attributes:
+//
+//	c, err := client.Connect(addr, user)
+//	// ...
+//	f := &timeseries.Mux{
+//		Client:    c,
+//		Attribute: "timeseries_backend",
+//		Fetchers: map[string]client.TimeseriesFetcher{
+//			"rrdtool": &timeseries.RRD{Dir: "/var/lib/collectd/rrd"},
+//			"whisper": &timeseries.Whisper{Dir: "/var/lib/graphite/whisper"},
+//		},
+//		Default: client.TimeseriesFunc(c.Timeseries),
+//	}
+//	ts, err := f.Fetch("host.example.com", "load/load", start, end)
+//
+// All fetchers are registered with the github.com/sysdb/go/registry package
+// as timeseries fetchers named "rrdtool" (options: dir, cf, command),
+// "whisper" (options: dir), and "http" (options: url). RRD and Whisper
+// support may be excluded from the build using the sysdb_no_rrd and
+// sysdb_no_whisper build tags respectively.
+package timeseries
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sysdb/go/client"
+	"github.com/sysdb/go/registry"
+	"github.com/sysdb/go/sysdb"
+)
+
+func init() {
+	registry.Register(registry.TimeseriesFetcher, "http", func(config map[string]string) (interface{}, error) {
+		if config["url"] == "" {
+			return nil, sysdb.Errorf(sysdb.CodeInvalidArgument, "missing url option")
+		}
+		return &HTTP{URL: config["url"]}, nil
+	})
+}
+
+// A Mux dispatches Fetch calls to one of several fetchers based on the value
+// of an attribute of the requested metric.
+type Mux struct {
+	// Client is used to look up metrics.
+	Client *client.Client
+	// Attribute is the name of the metric attribute selecting the fetcher.
+	Attribute string
+	// Fetchers maps attribute values to fetchers.
+	Fetchers map[string]client.TimeseriesFetcher
+	// Default is used for metrics without a matching attribute. If nil,
+	// fetching such metrics fails.
+	Default client.TimeseriesFetcher
+}
+
+// Fetch implements the client.TimeseriesFetcher interface.
+func (m *Mux) Fetch(host, metric string, start, end time.Time) (*sysdb.Timeseries, error) {
+	q, err := client.QueryString("FETCH host %s", host)
+	if err != nil {
+		return nil, err
+	}
+	var h sysdb.Host
+	if err := m.Client.QueryInto(q, &h); err != nil {
+		return nil, err
+	}
+
+	f := m.Default
+	if met := h.Metric(metric); met != nil {
+		if a := met.Attribute(m.Attribute); a != nil {
+			if mf, ok := m.Fetchers[a.Value]; ok {
+				f = mf
+			}
+		}
+	}
+	if f == nil {
+		return nil, sysdb.Errorf(sysdb.CodeUnsupported, "no timeseries fetcher for metric %s.%s", host, metric)
+	}
+	return f.Fetch(host, metric, start, end)
+}
+
+// metricPath returns the file <dir>/<host>/<metric><ext>. It fails if host is
+// not a single path element or if metric refers to a file outside of the
+// host's directory, for example using "..".
+func metricPath(dir, host, metric, ext string) (string, error) {
+	if host == "" || host == "." || host == ".." || strings.ContainsRune(host, '/') ||
+		strings.ContainsRune(host, filepath.Separator) {
+		return "", sysdb.Errorf(sysdb.CodeInvalidArgument, "invalid host name %q", host)
+	}
+	hostDir := filepath.Join(dir, host)
+	path := filepath.Join(hostDir, metric+ext)
+	rel, err := filepath.Rel(hostDir, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", sysdb.Errorf(sysdb.CodeInvalidArgument, "invalid metric name %q", metric)
+	}
+	return path, nil
+}
+
+// HTTP fetches timeseries from an HTTP service returning timeseries in the
+// SysDB JSON format.
+type HTTP struct {
+	// URL is the URL of the service. The placeholders {host} and {metric}
+	// are replaced by the (escaped) host and metric names, {start} and
+	// {end} by the respective times in seconds since the epoch.
+	URL string
+	// Client is used to send requests. If nil, http.DefaultClient is used.
+	Client *http.Client
+}
+
+// Fetch implements the client.TimeseriesFetcher interface.
+func (h *HTTP) Fetch(host, metric string, start, end time.Time) (*sysdb.Timeseries, error) {
+	u := strings.NewReplacer(
+		"{host}", url.QueryEscape(host),
+		"{metric}", url.QueryEscape(metric),
+		"{start}", strconv.FormatInt(start.Unix(), 10),
+		"{end}", strconv.FormatInt(end.Unix(), 10),
+	).Replace(h.URL)
+
+	c := h.Client
+	if c == nil {
+		c = http.DefaultClient
+	}
+	resp, err := c.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, sysdb.Errorf(sysdb.CodeRequestFailed, "GET %s: %s", u, resp.Status)
+	}
+
+	var ts sysdb.Timeseries
+	if err := json.NewDecoder(resp.Body).Decode(&ts); err != nil {
+		return nil, sysdb.Errorf(sysdb.CodeMalformedMessage, "GET %s: %v", u, err)
+	}
+	return &ts, nil
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
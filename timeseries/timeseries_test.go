@@ -0,0 +1,178 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package timeseries
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sysdb/go/client"
+	"github.com/sysdb/go/proto"
+	"github.com/sysdb/go/proto/prototest"
+	"github.com/sysdb/go/sysdb"
+)
+
+func TestMetricPath(t *testing.T) {
+	for _, test := range []struct {
+		host, metric string
+		want         string
+	}{
+		{"h1", "load/load", "/d/h1/load/load.rrd"},
+		{"h1", "cpu-0/../cpu-1/idle", "/d/h1/cpu-1/idle.rrd"},
+		{"h1", "../h2/load", ""},
+		{"h1", "../../etc/passwd", ""},
+		{"h1", "/etc/passwd", "/d/h1/etc/passwd.rrd"},
+		{"h1", "../h1/load", "/d/h1/load.rrd"},
+		{"..", "load", ""},
+		{".", "load", ""},
+		{"", "load", ""},
+		{"h1/../h2", "load", ""},
+	} {
+		got, err := metricPath("/d", test.host, test.metric, ".rrd")
+		if test.want == "" {
+			if sysdb.ErrorCode(err) != sysdb.CodeInvalidArgument {
+				t.Errorf("metricPath(%q, %q) = %q, %v; want <error %v>", test.host, test.metric, got, err, sysdb.CodeInvalidArgument)
+			}
+			continue
+		}
+		if want := filepath.FromSlash(test.want); err != nil || got != want {
+			t.Errorf("metricPath(%q, %q) = %q, %v; want %q, <nil>", test.host, test.metric, got, err, want)
+		}
+	}
+}
+
+// fetcher returns a fetcher returning a timeseries with a single data source
+// named name.
+func fetcher(name string) client.TimeseriesFetcher {
+	return client.TimeseriesFunc(func(host, metric string, start, end time.Time) (*sysdb.Timeseries, error) {
+		return &sysdb.Timeseries{Data: map[string][]sysdb.DataPoint{name: nil}}, nil
+	})
+}
+
+func TestMux(t *testing.T) {
+	srv := prototest.NewServer()
+	defer srv.Close()
+	backend := func(v string) []sysdb.Attribute { return []sysdb.Attribute{{Name: "backend", Value: v}} }
+	srv.HandleQuery("FETCH host 'h1'", prototest.Response{
+		Type: proto.ConnectionFetch,
+		Data: sysdb.Host{Name: "h1", Metrics: []sysdb.Metric{
+			{Name: "m1", Attributes: backend("a")},
+			{Name: "m2", Attributes: backend("b")},
+			{Name: "m3", Attributes: backend("c")},
+			{Name: "m4"},
+		}},
+	})
+
+	c, err := client.Connect(srv.Addr, "test", client.WithPoolSize(1))
+	if err != nil {
+		t.Fatalf("Connect() = %v", err)
+	}
+	defer c.Close()
+
+	m := &Mux{
+		Client:    c,
+		Attribute: "backend",
+		Fetchers:  map[string]client.TimeseriesFetcher{"a": fetcher("a"), "b": fetcher("b")},
+	}
+	for _, test := range []struct {
+		host, metric string
+		dflt         bool
+		want         string
+		code         sysdb.Code
+	}{
+		{"h1", "m1", false, "a", ""},
+		{"h1", "m2", false, "b", ""},
+		{"h1", "m3", false, "", sysdb.CodeUnsupported},
+		{"h1", "m3", true, "default", ""},
+		{"h1", "m4", true, "default", ""},
+		{"h1", "unknown", true, "default", ""},
+		{"h1", "unknown", false, "", sysdb.CodeUnsupported},
+		{"h2", "m1", true, "", sysdb.CodeRequestFailed},
+	} {
+		m.Default = nil
+		if test.dflt {
+			m.Default = fetcher("default")
+		}
+		ts, err := m.Fetch(test.host, test.metric, time.Unix(0, 0), time.Unix(60, 0))
+		if test.want == "" {
+			if sysdb.ErrorCode(err) != test.code {
+				t.Errorf("Fetch(%s, %s) = %v, %v; want <error %v>", test.host, test.metric, ts, err, test.code)
+			}
+			continue
+		}
+		if _, ok := ts.Data[test.want]; err != nil || !ok {
+			t.Errorf("Fetch(%s, %s) = %v, %v; want timeseries of fetcher %q", test.host, test.metric, ts, err, test.want)
+		}
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch r.URL.Path {
+		case "/ts":
+			if q.Get("host") != "h1" || q.Get("metric") != "cpu-0/idle" || q.Get("start") != "60" || q.Get("end") != "120" {
+				http.Error(w, fmt.Sprintf("unexpected query %q", r.URL.RawQuery), http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `{"start": 60, "end": 120, "data": {"value": [{"timestamp": 60, "value": "1.5"}]}}`)
+		case "/malformed":
+			fmt.Fprint(w, `{"data": [`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer s.Close()
+
+	start, end := time.Unix(60, 0), time.Unix(120, 0)
+	h := &HTTP{URL: s.URL + "/ts?host={host}&metric={metric}&start={start}&end={end}"}
+	ts, err := h.Fetch("h1", "cpu-0/idle", start, end)
+	if err != nil {
+		t.Fatalf("Fetch() = %v", err)
+	}
+	if p := ts.Data["value"]; len(p) != 1 || p[0].Value != 1.5 || !time.Time(p[0].Timestamp).Equal(start) {
+		t.Errorf("Fetch() = %+v; want a single data-point 1.5 at %v", ts.Data, start)
+	}
+
+	for _, test := range []struct {
+		path string
+		code sysdb.Code
+	}{
+		{"/unknown", sysdb.CodeRequestFailed},
+		{"/malformed", sysdb.CodeMalformedMessage},
+	} {
+		h := &HTTP{URL: s.URL + test.path, Client: s.Client()}
+		if ts, err := h.Fetch("h1", "m1", start, end); sysdb.ErrorCode(err) != test.code {
+			t.Errorf("Fetch(%s) = %v, %v; want <error %v>", test.path, ts, err, test.code)
+		}
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
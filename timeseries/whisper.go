@@ -0,0 +1,197 @@
+//go:build !sysdb_no_whisper
+
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package timeseries
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sysdb/go/registry"
+	"github.com/sysdb/go/sysdb"
+)
+
+func init() {
+	registry.Register(registry.TimeseriesFetcher, "whisper", func(config map[string]string) (interface{}, error) {
+		return &Whisper{Dir: config["dir"]}, nil
+	})
+}
+
+// Whisper fetches timeseries from Whisper files as used by Graphite.
+type Whisper struct {
+	// Dir is the base directory of all Whisper files. Unless Path is set,
+	// the file of a metric is <Dir>/<host>/<metric>.wsp where dots in the
+	// host name are replaced by underscores. Names referring to files
+	// outside of the host's directory are rejected.
+	Dir string
+	// Path optionally determines the file name of a metric.
+	Path func(host, metric string) (string, error)
+}
+
+// Fetch implements the client.TimeseriesFetcher interface. The data source
+// of the returned timeseries is called "value".
+func (w *Whisper) Fetch(host, metric string, start, end time.Time) (*sysdb.Timeseries, error) {
+	var path string
+	var err error
+	if w.Path != nil {
+		path, err = w.Path(host, metric)
+	} else {
+		path, err = metricPath(w.Dir, strings.Replace(host, ".", "_", -1), metric, ".wsp")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	points, err := readWhisper(f, fi.Size(), start, end, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return &sysdb.Timeseries{
+		Start: sysdb.Time(start),
+		End:   sysdb.Time(end),
+		Data:  map[string][]sysdb.DataPoint{"value": points},
+	}, nil
+}
+
+// The Whisper file format; all values are big-endian.
+const (
+	whisperMetadataSize = 16 // aggregation, max retention, xff, archive count
+	whisperArchiveSize  = 12 // offset, seconds per point, points
+	whisperPointSize    = 12 // timestamp, value
+)
+
+type whisperArchive struct {
+	offset, step, points uint32
+}
+
+func (a whisperArchive) retention() int64 { return int64(a.step) * int64(a.points) }
+
+// readWhisper reads all points between start and end from the archive with
+// the highest precision covering the time range. Like Graphite, it returns
+// NaN for points without data. The header is checked against size, the size
+// of the file, before using any of its values.
+func readWhisper(r io.ReaderAt, size int64, start, end, now time.Time) ([]sysdb.DataPoint, error) {
+	var meta [whisperMetadataSize]byte
+	if _, err := r.ReadAt(meta[:], 0); err != nil {
+		return nil, sysdb.Errorf(sysdb.CodeInvalidFormat, "failed to read whisper header: %v", err)
+	}
+	n := binary.BigEndian.Uint32(meta[12:])
+	if n == 0 {
+		return nil, sysdb.Errorf(sysdb.CodeInvalidFormat, "whisper file has no archives")
+	}
+	if int64(n) > (size-whisperMetadataSize)/whisperArchiveSize {
+		return nil, sysdb.Errorf(sysdb.CodeInvalidFormat, "whisper archive count %d exceeds the file size", n)
+	}
+
+	archives := make([]whisperArchive, n)
+	buf := make([]byte, whisperArchiveSize*int(n))
+	if _, err := r.ReadAt(buf, whisperMetadataSize); err != nil {
+		return nil, sysdb.Errorf(sysdb.CodeInvalidFormat, "failed to read whisper archives: %v", err)
+	}
+	for i := range archives {
+		b := buf[i*whisperArchiveSize:]
+		archives[i] = whisperArchive{
+			offset: binary.BigEndian.Uint32(b[0:]),
+			step:   binary.BigEndian.Uint32(b[4:]),
+			points: binary.BigEndian.Uint32(b[8:]),
+		}
+		a := archives[i]
+		if a.step == 0 || a.points == 0 {
+			return nil, sysdb.Errorf(sysdb.CodeInvalidFormat, "whisper archive %d has %d points of %d seconds", i, a.points, a.step)
+		}
+		if int64(a.offset)+int64(a.points)*whisperPointSize > size {
+			return nil, sysdb.Errorf(sysdb.CodeInvalidFormat, "whisper archive %d exceeds the file size", i)
+		}
+	}
+
+	// Archives are sorted by precision; pick the first one covering start.
+	from, until := start.Unix(), end.Unix()
+	a := archives[len(archives)-1]
+	for _, arch := range archives {
+		if now.Unix()-arch.retention() <= from {
+			a = arch
+			break
+		}
+	}
+	if from < now.Unix()-a.retention() {
+		from = now.Unix() - a.retention()
+	}
+	if until > now.Unix() {
+		until = now.Unix()
+	}
+	if from > until {
+		return nil, nil
+	}
+
+	step := int64(a.step)
+	from = from - from%step + step
+	until = until - until%step + step
+
+	// The archive is a ring buffer; the first point determines its base.
+	var p [whisperPointSize]byte
+	if _, err := r.ReadAt(p[:], int64(a.offset)); err != nil {
+		return nil, sysdb.Errorf(sysdb.CodeInvalidFormat, "failed to read whisper data: %v", err)
+	}
+	base := int64(binary.BigEndian.Uint32(p[:4]))
+
+	var points []sysdb.DataPoint
+	for t := from; t < until; t += step {
+		v := math.NaN()
+		if base != 0 {
+			idx := ((t - base) / step) % int64(a.points)
+			if idx < 0 {
+				idx += int64(a.points)
+			}
+			off := int64(a.offset) + idx*whisperPointSize
+			if _, err := r.ReadAt(p[:], off); err != nil {
+				return nil, sysdb.Errorf(sysdb.CodeInvalidFormat, "failed to read whisper data: %v", err)
+			}
+			// Stale slots of the ring buffer carry a different timestamp.
+			if int64(binary.BigEndian.Uint32(p[:4])) == t {
+				v = math.Float64frombits(binary.BigEndian.Uint64(p[4:]))
+			}
+		}
+		points = append(points, sysdb.DataPoint{Timestamp: sysdb.Time(time.Unix(t, 0)), Value: v})
+	}
+	return points, nil
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
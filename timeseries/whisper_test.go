@@ -0,0 +1,117 @@
+//go:build !sysdb_no_whisper
+
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package timeseries
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+func TestReadWhisper(t *testing.T) {
+	// One archive with 10 points of 60 seconds each.
+	const step, n = 60, 10
+	now := time.Unix(1000*step, 0)
+
+	var buf bytes.Buffer
+	put := func(v interface{}) { binary.Write(&buf, binary.BigEndian, v) }
+	put([]uint32{1, step * n})
+	put(float32(0.5))
+	put(uint32(1))
+	put([]uint32{whisperMetadataSize + whisperArchiveSize, step, n})
+
+	// Points for 995*step..999*step in a ring starting at 993*step; one
+	// slot holds stale data from an earlier round.
+	for i := 0; i < n; i++ {
+		ts := uint32((993 + i) * step)
+		if i == 3 {
+			ts -= n * step
+		}
+		put(ts)
+		put(float64(i))
+	}
+
+	points, err := readWhisper(bytes.NewReader(buf.Bytes()), int64(buf.Len()),
+		time.Unix(995*step-1, 0), time.Unix(999*step-1, 0), now)
+	if err != nil {
+		t.Fatalf("readWhisper() = %v", err)
+	}
+	if len(points) != 4 {
+		t.Fatalf("readWhisper() = %v; want 4 points", points)
+	}
+	for i, want := range []float64{2, math.NaN(), 4, 5} {
+		got := points[i].Value
+		if (math.IsNaN(want) && !math.IsNaN(got)) || (!math.IsNaN(want) && got != want) {
+			t.Errorf("readWhisper()[%d] = %v; want %v", i, got, want)
+		}
+		if ts := time.Time(points[i].Timestamp).Unix(); ts != int64((995+i)*step) {
+			t.Errorf("readWhisper()[%d].Timestamp = %d; want %d", i, ts, (995+i)*step)
+		}
+	}
+}
+
+func TestReadWhisperCorrupt(t *testing.T) {
+	now := time.Unix(60000, 0)
+	for _, test := range []struct {
+		desc   string
+		header []uint32
+	}{
+		{"no archives", []uint32{0}},
+		{"huge archive count", []uint32{1 << 31, whisperMetadataSize + whisperArchiveSize, 60, 10}},
+		{"zero step", []uint32{1, whisperMetadataSize + whisperArchiveSize, 0, 10}},
+		{"zero points", []uint32{1, whisperMetadataSize + whisperArchiveSize, 60, 0}},
+		{"truncated archive", []uint32{1, whisperMetadataSize + whisperArchiveSize, 60, 1000}},
+	} {
+		var buf bytes.Buffer
+		put := func(v interface{}) { binary.Write(&buf, binary.BigEndian, v) }
+		put([]uint32{1, 600})
+		put(float32(0.5))
+		put(test.header)
+		put(make([]byte, 10*whisperPointSize))
+
+		points, err := readWhisper(bytes.NewReader(buf.Bytes()), int64(buf.Len()), now.Add(-time.Minute), now, now)
+		if sysdb.ErrorCode(err) != sysdb.CodeInvalidFormat {
+			t.Errorf("readWhisper(<%s>) = %v, %v; want <error %v>", test.desc, points, err, sysdb.CodeInvalidFormat)
+		}
+	}
+}
+
+func TestWhisperTraversal(t *testing.T) {
+	w := &Whisper{Dir: t.TempDir()}
+	for _, name := range [][2]string{{"h1", "../../x"}, {"h1", "/../../x"}, {"h1/../../x", "y"}} {
+		if ts, err := w.Fetch(name[0], name[1], time.Unix(0, 0), time.Unix(60, 0)); sysdb.ErrorCode(err) != sysdb.CodeInvalidArgument {
+			t.Errorf("Fetch(%q, %q) = %v, %v; want <error %v>", name[0], name[1], ts, err, sysdb.CodeInvalidArgument)
+		}
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
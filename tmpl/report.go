@@ -0,0 +1,78 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package tmpl
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/sysdb/go/client"
+)
+
+// A Template renders data to a writer. It is implemented by both
+// text/template and html/template templates.
+type Template interface {
+	Execute(w io.Writer, data interface{}) error
+}
+
+// ReportData is the data passed to report templates.
+type ReportData struct {
+	// Query is the executed query.
+	Query string
+	// Result is the result of the query as returned by client.Query.
+	Result interface{}
+	// Time is the time the query has been executed.
+	Time time.Time
+}
+
+// A Report renders the result of a query using a template, for example, to
+// send a nightly inventory report:
+//
+//	t := template.Must(template.New("report").Funcs(tmpl.FuncMap()).Parse(
+//		`{{range groupBy .Result "location"}}{{.Key}}: {{len .Hosts}} hosts
+//	{{end}}`))
+//	r := tmpl.Report{Query: "LIST hosts", Template: t}
+//	err := r.Run(ctx, c, w)
+type Report struct {
+	// Query is the query to execute.
+	Query string
+	// Template renders a ReportData value.
+	Template Template
+}
+
+// Run executes the query using c and writes the rendered result to w. Nothing
+// is written if the query fails.
+func (r Report) Run(ctx context.Context, c client.Interface, w io.Writer) error {
+	t := now()
+	res, err := c.QueryContext(ctx, r.Query)
+	if err != nil {
+		return err
+	}
+	return r.Template.Execute(w, ReportData{Query: r.Query, Result: res, Time: t})
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
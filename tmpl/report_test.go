@@ -0,0 +1,72 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package tmpl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/sysdb/go/client/clienttest"
+	"github.com/sysdb/go/sysdb"
+)
+
+func TestReport(t *testing.T) {
+	ref := time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return ref }
+	defer func() { now = time.Now }()
+
+	c := clienttest.NewFake()
+	c.SetResult("LIST hosts", []sysdb.Host{
+		{Name: "h1", Attributes: []sysdb.Attribute{{Name: "location", Value: "dc1"}}},
+		{Name: "h2", Attributes: []sysdb.Attribute{{Name: "location", Value: "dc2"}}},
+		{Name: "h3", Attributes: []sysdb.Attribute{{Name: "location", Value: "dc1"}}},
+	})
+	c.SetError("LIST services", errors.New("failed"))
+
+	tm := template.Must(template.New("report").Funcs(FuncMap()).Parse(
+		`Inventory as of {{time .Time}} ({{.Query}})
+{{range groupBy .Result "location"}}{{.Key}}:{{range .Hosts}} {{.Name}}{{end}}
+{{end}}`))
+
+	var buf bytes.Buffer
+	r := Report{Query: "LIST hosts", Template: tm}
+	expected := "Inventory as of 2015-06-01 12:00:00 +0000 (LIST hosts)\ndc1: h1 h3\ndc2: h2\n"
+	if err := r.Run(context.Background(), c, &buf); err != nil || buf.String() != expected {
+		t.Errorf("Run() = %v\n%s\nwant <nil>\n%s", err, buf.String(), expected)
+	}
+
+	buf.Reset()
+	r.Query = "LIST services"
+	if err := r.Run(context.Background(), c, &buf); err == nil || buf.Len() != 0 {
+		t.Errorf("Run(<failing query>) = %v (%q); want error and no output", err, buf.String())
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,442 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package tmpl provides functions for working with SysDB objects in Go
+// templates (see text/template and html/template).
+//
+// The functions are available through FuncMap:
+//
+//	t := template.New("report").Funcs(tmpl.FuncMap())
+//	t, err := t.Parse(`{{range .}}{{.Name}} ({{attr . "architecture"}}), updated {{ago .LastUpdate}}
+//	{{end}}`)
+//
+// The following functions are provided:
+//
+//	attr OBJ NAME     the value of the attribute NAME of a host, service,
+//	                  or metric (or a list of attributes), or an empty string
+//	duration D        a sysdb.Duration or time.Duration in SysDB format
+//	time T [LAYOUT]   a sysdb.Time or time.Time formatted using the
+//	                  optional layout (default: YYYY-MM-DD hh:mm:ss +-zzzz)
+//	since T           the sysdb.Duration elapsed since T
+//	humanize D        a duration in human readable form using its largest
+//	                  unit only (e.g. "3 days")
+//	ago T             the humanized duration since T (e.g. "3 days ago")
+//	number N [PREC]   a number formatted according to the locale with the
+//	                  optional number of decimals (default: as needed)
+//	hasAttr OBJ NAME  whether a host, service, or metric has the attribute
+//	where HOSTS NAME VALUE
+//	                  the hosts whose attribute NAME has the value VALUE
+//	groupBy HOSTS NAME
+//	                  the hosts grouped by the value of the attribute NAME
+//	                  (a list of groups with the fields Key and Hosts)
+//	join LIST SEP     the strings of LIST separated by SEP
+//	sortBy LIST KEY   a copy of a list of hosts, services, metrics, or
+//	                  attributes sorted by KEY: name, last_update,
+//	                  update_interval, host (services and metrics), value
+//	                  (attributes), or attribute.NAME
+//	reverse LIST      a copy of LIST in reverse order
+//
+// Report executes a query and renders its result using a template, for
+// example, to generate inventory reports.
+//
+// Query strings and machine-readable formats never depend on the locale.
+// Presentation of numbers may be customized by using FuncMapLocale instead of
+// FuncMap.
+package tmpl
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+// now returns the current time; it may be overridden for testing.
+var now = time.Now
+
+// A Locale describes how to present numbers to the user.
+type Locale struct {
+	// Decimal is the decimal separator.
+	Decimal string
+	// Group separates groups of thousands; it may be empty.
+	Group string
+}
+
+// DefaultLocale is the locale used by FuncMap. It formats numbers the same
+// way as the strconv package.
+var DefaultLocale = Locale{Decimal: "."}
+
+// FuncMap returns the template functions provided by this package using the
+// default locale. The returned map may be used with both text/template and
+// html/template.
+func FuncMap() template.FuncMap {
+	return FuncMapLocale(DefaultLocale)
+}
+
+// FuncMapLocale returns the template functions provided by this package using
+// the specified locale for presenting numbers.
+func FuncMapLocale(l Locale) template.FuncMap {
+	return template.FuncMap{
+		"number":   l.FormatNumber,
+		"attr":     Attr,
+		"duration": FormatDuration,
+		"time":     FormatTime,
+		"since":    Since,
+		"humanize": Humanize,
+		"ago":      Ago,
+		"hasAttr":  HasAttr,
+		"where":    Where,
+		"groupBy":  GroupBy,
+		"join":     strings.Join,
+		"sortBy":   SortBy,
+		"reverse":  Reverse,
+	}
+}
+
+// Attr returns the value of the named attribute of obj, which may be a host,
+// service, or metric (or a pointer to any of them) or a list of attributes.
+// It returns an empty string if the attribute does not exist.
+func Attr(obj interface{}, name string) (string, error) {
+	attrs, err := attributes(obj)
+	if err != nil {
+		return "", err
+	}
+	for _, a := range attrs {
+		if a.Name == name {
+			return a.Value, nil
+		}
+	}
+	return "", nil
+}
+
+// HasAttr reports whether obj, which may be any object supported by Attr,
+// has the named attribute.
+func HasAttr(obj interface{}, name string) (bool, error) {
+	attrs, err := attributes(obj)
+	if err != nil {
+		return false, err
+	}
+	for _, a := range attrs {
+		if a.Name == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Where returns the hosts whose named attribute has the specified value.
+// Hosts lacking the attribute never match.
+func Where(hosts []sysdb.Host, name, value string) []sysdb.Host {
+	var res []sysdb.Host
+	for _, h := range hosts {
+		for _, a := range h.Attributes {
+			if a.Name == name && a.Value == value {
+				res = append(res, h)
+				break
+			}
+		}
+	}
+	return res
+}
+
+// A Group is a set of hosts sharing the same value of an attribute.
+type Group struct {
+	// Key is the value of the attribute. It is empty for hosts lacking the
+	// attribute.
+	Key   string
+	Hosts []sysdb.Host
+}
+
+// GroupBy groups the hosts by the value of the named attribute. Groups are
+// sorted by their key; hosts keep their order within a group.
+func GroupBy(hosts []sysdb.Host, name string) []Group {
+	var groups []Group
+	index := make(map[string]int)
+	for _, h := range hosts {
+		key, _ := Attr(h, name)
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, Group{Key: key})
+		}
+		groups[i].Hosts = append(groups[i].Hosts, h)
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].Key < groups[j].Key })
+	return groups
+}
+
+// SortBy returns a copy of list sorted by key. The list may be a list of
+// hosts, services (sysdb.ServiceList), metrics (sysdb.MetricList), or
+// attributes. The key is one of "name", "last_update", "update_interval",
+// "host" (services and metrics only), "value" (attributes only), or
+// "attribute.NAME" to sort by the value of the named attribute. Sorting is
+// stable.
+func SortBy(list interface{}, key string) (interface{}, error) {
+	switch l := list.(type) {
+	case []sysdb.Host:
+		res := append([]sysdb.Host(nil), l...)
+		return res, sortObjects(key, func(i int) sysdb.Object { return &res[i] }, nil, res)
+	case sysdb.ServiceList:
+		res := append(sysdb.ServiceList(nil), l...)
+		return res, sortObjects(key, func(i int) sysdb.Object { return &res[i].Service },
+			func(i int) string { return res[i].Host }, res)
+	case sysdb.MetricList:
+		res := append(sysdb.MetricList(nil), l...)
+		return res, sortObjects(key, func(i int) sysdb.Object { return &res[i].Metric },
+			func(i int) string { return res[i].Host }, res)
+	case []sysdb.Attribute:
+		res := append([]sysdb.Attribute(nil), l...)
+		if key == "value" {
+			sort.SliceStable(res, func(i, j int) bool { return res[i].Value < res[j].Value })
+			return res, nil
+		}
+		return res, sortObjects(key, func(i int) sysdb.Object { return &res[i] }, nil, res)
+	}
+	return nil, fmt.Errorf("cannot sort %T", list)
+}
+
+// sortObjects sorts the slice list by key. obj returns the i-th object and
+// host, if not nil, the name of its host.
+func sortObjects(key string, obj func(i int) sysdb.Object, host func(i int) string, list interface{}) error {
+	var less func(i, j int) bool
+	switch {
+	case key == "name":
+		less = func(i, j int) bool { return obj(i).GetName() < obj(j).GetName() }
+	case key == "last_update":
+		less = func(i, j int) bool {
+			return time.Time(obj(i).GetLastUpdate()).Before(time.Time(obj(j).GetLastUpdate()))
+		}
+	case key == "update_interval":
+		less = func(i, j int) bool { return obj(i).GetUpdateInterval() < obj(j).GetUpdateInterval() }
+	case key == "host" && host != nil:
+		less = func(i, j int) bool { return host(i) < host(j) }
+	case strings.HasPrefix(key, "attribute."):
+		name := strings.TrimPrefix(key, "attribute.")
+		value := func(i int) string {
+			v, _ := Attr(obj(i).GetAttributes(), name)
+			return v
+		}
+		less = func(i, j int) bool { return value(i) < value(j) }
+	default:
+		return fmt.Errorf("cannot sort %T by %q", list, key)
+	}
+	sort.SliceStable(list, less)
+	return nil
+}
+
+// Reverse returns a copy of the slice list in reverse order.
+func Reverse(list interface{}) (interface{}, error) {
+	v := reflect.ValueOf(list)
+	if v.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("cannot reverse %T", list)
+	}
+	res := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+	for i := 0; i < v.Len(); i++ {
+		res.Index(v.Len() - 1 - i).Set(v.Index(i))
+	}
+	return res.Interface(), nil
+}
+
+// attributes returns the attributes of obj.
+func attributes(obj interface{}) ([]sysdb.Attribute, error) {
+	var attrs []sysdb.Attribute
+	switch o := obj.(type) {
+	case sysdb.Host:
+		attrs = o.Attributes
+	case *sysdb.Host:
+		attrs = o.Attributes
+	case sysdb.Service:
+		attrs = o.Attributes
+	case *sysdb.Service:
+		attrs = o.Attributes
+	case sysdb.Metric:
+		attrs = o.Attributes
+	case *sysdb.Metric:
+		attrs = o.Attributes
+	case []sysdb.Attribute:
+		attrs = o
+	default:
+		return nil, fmt.Errorf("cannot look up attributes of %T", obj)
+	}
+	return attrs, nil
+}
+
+func toDuration(d interface{}) (sysdb.Duration, error) {
+	switch v := d.(type) {
+	case sysdb.Duration:
+		return v, nil
+	case time.Duration:
+		return sysdb.Duration(v), nil
+	}
+	return 0, fmt.Errorf("cannot convert %T to a duration", d)
+}
+
+func toTime(t interface{}) (time.Time, error) {
+	switch v := t.(type) {
+	case sysdb.Time:
+		return time.Time(v), nil
+	case time.Time:
+		return v, nil
+	}
+	return time.Time{}, fmt.Errorf("cannot convert %T to a time", t)
+}
+
+// FormatDuration formats a sysdb.Duration or time.Duration in the SysDB
+// interval format (e.g. 1Y6M7D).
+func FormatDuration(d interface{}) (string, error) {
+	dur, err := toDuration(d)
+	if err != nil {
+		return "", err
+	}
+	return dur.Format(sysdb.Compact), nil
+}
+
+// FormatTime formats a sysdb.Time or time.Time. An optional layout may be
+// specified as described in the time package.
+func FormatTime(t interface{}, layout ...string) (string, error) {
+	tm, err := toTime(t)
+	if err != nil {
+		return "", err
+	}
+	if len(layout) > 1 {
+		return "", fmt.Errorf("too many layouts")
+	}
+	l := "2006-01-02 15:04:05 -0700"
+	if len(layout) == 1 {
+		l = layout[0]
+	}
+	return tm.Format(l), nil
+}
+
+// Since returns the time elapsed since t with a precision of one second.
+func Since(t interface{}) (sysdb.Duration, error) {
+	tm, err := toTime(t)
+	if err != nil {
+		return 0, err
+	}
+	return sysdb.Duration(now().Sub(tm) / time.Second * time.Second), nil
+}
+
+// Humanize formats a sysdb.Duration or time.Duration using its largest unit
+// only, for example "3 days" or "1 hour".
+func Humanize(d interface{}) (string, error) {
+	dur, err := toDuration(d)
+	if err != nil {
+		return "", err
+	}
+	if dur < 0 {
+		dur = -dur
+	}
+	for _, u := range []struct {
+		d    sysdb.Duration
+		name string
+	}{
+		{sysdb.Year, "year"},
+		{sysdb.Month, "month"},
+		{sysdb.Day, "day"},
+		{sysdb.Hour, "hour"},
+		{sysdb.Minute, "minute"},
+	} {
+		if n := dur / u.d; n > 0 {
+			return plural(int64(n), u.name), nil
+		}
+	}
+	return plural(int64(dur/sysdb.Second), "second"), nil
+}
+
+// Ago returns the humanized time elapsed since t, for example "3 days ago".
+func Ago(t interface{}) (string, error) {
+	d, err := Since(t)
+	if err != nil {
+		return "", err
+	}
+	s, err := Humanize(d)
+	if err != nil {
+		return "", err
+	}
+	return s + " ago", nil
+}
+
+// FormatNumber formats an integer or floating point number according to the
+// locale. An optional precision specifies the number of decimals.
+func (l Locale) FormatNumber(n interface{}, prec ...int) (string, error) {
+	if len(prec) > 1 {
+		return "", fmt.Errorf("too many precisions")
+	}
+	p := -1
+	if len(prec) == 1 {
+		p = prec[0]
+	}
+
+	var s string
+	switch v := n.(type) {
+	case int, int8, int16, int32, int64:
+		s = fmt.Sprintf("%d", v)
+		if p > 0 {
+			s += "." + strings.Repeat("0", p)
+		}
+	case uint, uint8, uint16, uint32, uint64:
+		s = fmt.Sprintf("%d", v)
+		if p > 0 {
+			s += "." + strings.Repeat("0", p)
+		}
+	case float32:
+		s = strconv.FormatFloat(float64(v), 'f', p, 32)
+	case float64:
+		s = strconv.FormatFloat(v, 'f', p, 64)
+	default:
+		return "", fmt.Errorf("cannot format %T as a number", n)
+	}
+
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	frac := ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		s, frac = s[:i], l.Decimal+s[i+1:]
+	}
+	if l.Group != "" {
+		for i := len(s) - 3; i > 0; i -= 3 {
+			s = s[:i] + l.Group + s[i:]
+		}
+	}
+	return sign + s + frac, nil
+}
+
+func plural(n int64, unit string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, unit)
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :
@@ -0,0 +1,246 @@
+//
+// Copyright (C) 2015 Sebastian 'tokkee' Harl <sh@tokkee.org>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// ``AS IS'' AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+// TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+// PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDERS OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+// EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+// PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+// OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+// OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+// ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package tmpl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/sysdb/go/sysdb"
+)
+
+func TestFuncMap(t *testing.T) {
+	ref := time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return ref }
+	defer func() { now = time.Now }()
+
+	host := sysdb.Host{
+		Name:           "h1",
+		LastUpdate:     sysdb.Time(ref.Add(-3 * time.Hour)),
+		UpdateInterval: 5 * sysdb.Minute,
+		Attributes:     []sysdb.Attribute{{Name: "arch", Value: "amd64"}},
+	}
+
+	for _, test := range []struct {
+		tmpl     string
+		expected string
+	}{
+		{`{{attr . "arch"}}`, "amd64"},
+		{`{{attr . "missing"}}`, ""},
+		{`{{duration .UpdateInterval}}`, "5m"},
+		{`{{time .LastUpdate}}`, "2015-06-01 09:00:00 +0000"},
+		{`{{time .LastUpdate "15:04"}}`, "09:00"},
+		{`{{since .LastUpdate | duration}}`, "3h"},
+		{`{{humanize .UpdateInterval}}`, "5 minutes"},
+		{`{{ago .LastUpdate}}`, "3 hours ago"},
+	} {
+		tm, err := template.New("test").Funcs(FuncMap()).Parse(test.tmpl)
+		if err != nil {
+			t.Errorf("Parse(%q) = %v", test.tmpl, err)
+			continue
+		}
+		var buf bytes.Buffer
+		if err := tm.Execute(&buf, &host); err != nil || buf.String() != test.expected {
+			t.Errorf("Execute(%q) = %q, %v; want %q, <nil>",
+				test.tmpl, buf.String(), err, test.expected)
+		}
+	}
+}
+
+func TestGrouping(t *testing.T) {
+	hosts := []sysdb.Host{
+		{Name: "db1", Attributes: []sysdb.Attribute{{Name: "role", Value: "db"}, {Name: "ip", Value: "10.0.0.1"}}},
+		{Name: "web1", Attributes: []sysdb.Attribute{{Name: "role", Value: "web"}, {Name: "ip", Value: "10.0.0.2"}}},
+		{Name: "misc"},
+		{Name: "db2", Attributes: []sysdb.Attribute{{Name: "role", Value: "db"}}},
+		{Name: "old", Attributes: []sysdb.Attribute{{Name: "role", Value: ""}}},
+	}
+
+	for _, test := range []struct {
+		tmpl     string
+		expected string
+	}{
+		{
+			`{{range groupBy . "role"}}[{{.Key}}]{{range .Hosts}} {{.Name}}{{end}}
+{{end}}`,
+			"[] misc old\n[db] db1 db2\n[web] web1\n",
+		},
+		{`{{range where . "role" "db"}}{{.Name}} {{end}}`, "db1 db2 "},
+		{`{{range where . "role" ""}}{{.Name}} {{end}}`, "old "},
+		{
+			`{{range .}}{{if hasAttr . "ip"}}Host {{.Name}}
+    HostName {{attr . "ip"}}
+{{end}}{{end}}`,
+			"Host db1\n    HostName 10.0.0.1\nHost web1\n    HostName 10.0.0.2\n",
+		},
+		{`{{join .Backends ","}}`, ""},
+	} {
+		tm, err := template.New("test").Funcs(FuncMap()).Parse(test.tmpl)
+		if err != nil {
+			t.Errorf("Parse(%q) = %v", test.tmpl, err)
+			continue
+		}
+		var data interface{} = hosts
+		if test.tmpl == `{{join .Backends ","}}` {
+			data = sysdb.Host{Backends: []string{"a", "b"}}
+			test.expected = "a,b"
+		}
+		var buf bytes.Buffer
+		if err := tm.Execute(&buf, data); err != nil || buf.String() != test.expected {
+			t.Errorf("Execute(%q) = %q, %v; want %q, <nil>",
+				test.tmpl, buf.String(), err, test.expected)
+		}
+	}
+
+	if _, err := HasAttr(42, "x"); err == nil {
+		t.Errorf("HasAttr(42, x) = <nil>; want error")
+	}
+}
+
+func TestSortBy(t *testing.T) {
+	t1 := sysdb.Time(time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC))
+	t2 := sysdb.Time(time.Date(2015, 1, 2, 0, 0, 0, 0, time.UTC))
+	hosts := []sysdb.Host{
+		{Name: "b", LastUpdate: t2, UpdateInterval: sysdb.Minute, Attributes: []sysdb.Attribute{{Name: "rack", Value: "r1"}}},
+		{Name: "c", LastUpdate: t1, UpdateInterval: sysdb.Second, Attributes: []sysdb.Attribute{{Name: "rack", Value: "r2"}}},
+		{Name: "a", LastUpdate: t2, UpdateInterval: sysdb.Hour},
+	}
+	services := sysdb.ServiceList{
+		{Host: "h2", Service: sysdb.Service{Name: "a"}},
+		{Host: "h1", Service: sysdb.Service{Name: "b"}},
+	}
+	metrics := sysdb.MetricList{
+		{Host: "h1", Metric: sysdb.Metric{Name: "m2"}},
+		{Host: "h2", Metric: sysdb.Metric{Name: "m1"}},
+	}
+	attrs := []sysdb.Attribute{{Name: "x", Value: "2"}, {Name: "y", Value: "1"}}
+
+	names := func(v interface{}) string {
+		var res []string
+		switch l := v.(type) {
+		case []sysdb.Host:
+			for _, h := range l {
+				res = append(res, h.Name)
+			}
+		case sysdb.ServiceList:
+			for _, s := range l {
+				res = append(res, s.Host+"."+s.Name)
+			}
+		case sysdb.MetricList:
+			for _, m := range l {
+				res = append(res, m.Host+"."+m.Name)
+			}
+		case []sysdb.Attribute:
+			for _, a := range l {
+				res = append(res, a.Name)
+			}
+		}
+		return strings.Join(res, ",")
+	}
+
+	for _, test := range []struct {
+		list     interface{}
+		key      string
+		expected string
+	}{
+		{hosts, "name", "a,b,c"},
+		{hosts, "last_update", "c,b,a"},
+		{hosts, "update_interval", "c,b,a"},
+		{hosts, "attribute.rack", "a,b,c"},
+		{services, "name", "h2.a,h1.b"},
+		{services, "host", "h1.b,h2.a"},
+		{metrics, "name", "h2.m1,h1.m2"},
+		{metrics, "host", "h1.m2,h2.m1"},
+		{attrs, "value", "y,x"},
+		{attrs, "name", "x,y"},
+	} {
+		res, err := SortBy(test.list, test.key)
+		if err != nil || names(res) != test.expected {
+			t.Errorf("SortBy(%T, %q) = %s, %v; want %s, <nil>", test.list, test.key, names(res), err, test.expected)
+		}
+	}
+	if names(hosts) != "b,c,a" {
+		t.Errorf("SortBy() modified its input: %s", names(hosts))
+	}
+
+	for _, test := range []struct {
+		list interface{}
+		key  string
+	}{
+		{hosts, "host"},
+		{hosts, "value"},
+		{hosts, "unknown"},
+		{42, "name"},
+	} {
+		if res, err := SortBy(test.list, test.key); err == nil {
+			t.Errorf("SortBy(%T, %q) = %v, <nil>; want error", test.list, test.key, res)
+		}
+	}
+
+	res, err := Reverse(hosts)
+	if err != nil || names(res) != "a,c,b" || names(hosts) != "b,c,a" {
+		t.Errorf("Reverse(%s) = %s, %v; want a,c,b, <nil>", names(hosts), names(res), err)
+	}
+	if res, err := Reverse(42); err == nil {
+		t.Errorf("Reverse(42) = %v, <nil>; want error", res)
+	}
+
+	tm := template.Must(template.New("test").Funcs(FuncMap()).Parse(
+		`{{range reverse (sortBy . "name")}}{{.Name}}{{end}}`))
+	var buf bytes.Buffer
+	if err := tm.Execute(&buf, hosts); err != nil || buf.String() != "cba" {
+		t.Errorf("Execute(reverse (sortBy . name)) = %q, %v; want cba, <nil>", buf.String(), err)
+	}
+}
+
+func TestFormatNumber(t *testing.T) {
+	de := Locale{Decimal: ",", Group: "."}
+	for _, test := range []struct {
+		l        Locale
+		n        interface{}
+		prec     []int
+		expected string
+	}{
+		{DefaultLocale, 1234567, nil, "1234567"},
+		{DefaultLocale, 1234.5, nil, "1234.5"},
+		{DefaultLocale, 1234.5, []int{2}, "1234.50"},
+		{de, 1234567, nil, "1.234.567"},
+		{de, -1234567.891, []int{2}, "-1.234.567,89"},
+		{de, uint8(12), []int{1}, "12,0"},
+		{de, 123.0, nil, "123"},
+	} {
+		got, err := test.l.FormatNumber(test.n, test.prec...)
+		if err != nil || got != test.expected {
+			t.Errorf("%v.FormatNumber(%v, %v) = %q, %v; want %q, <nil>",
+				test.l, test.n, test.prec, got, err, test.expected)
+		}
+	}
+}
+
+// vim: set tw=78 sw=4 sw=4 noexpandtab :